@@ -1,43 +1,166 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/SkynetLabs/blocker/database"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/SkynetLabs/skyd/skymodules"
+	"go.sia.tech/siad/crypto"
 )
 
 // API is our central entry point to all subsystems relevant to serving
 // requests.
 type API struct {
-	staticDB         *database.DB
-	staticLogger     *logrus.Logger
-	staticRouter     *httprouter.Router
-	staticSkydClient *SkydClient
+	staticBlocker           Blocker
+	staticDB                *database.DB
+	staticFetchMetadata     bool
+	staticLogger            *logrus.Logger
+	staticMaxBlockBodySize  int64
+	staticRequireLegalBasis bool
+	staticRouter            *httprouter.Router
+	staticSigningKey        *crypto.SecretKey
+	staticSkydClient        *SkydClient
+}
+
+// Options holds the configuration of the API.
+type Options struct {
+	// RequireLegalBasis makes the block endpoints reject reports that do not
+	// specify the legal basis of the block. It's disabled by default, which
+	// allows existing reporters to migrate gradually.
+	RequireLegalBasis bool
+
+	// FetchMetadata makes the API fetch the metadata of reported skylinks
+	// from skyd and record it on the blocked skylink, which tells moderators
+	// what kind of content got blocked. It's best-effort, the metadata is
+	// fetched in the background after the skylink got reported. Only
+	// skylinks that are reported one at a time are enriched, hashes don't
+	// allow fetching the metadata.
+	FetchMetadata bool
+
+	// SigningKey is the key the binary blocklist export is signed with,
+	// which allows peers that sync our blocklist to verify it originates
+	// from us. If it's not set the export is not signed.
+	SigningKey *crypto.SecretKey
+
+	// MaxBlockBodySize is the maximum size in bytes of the body of a
+	// request to the block endpoints that report skylinks in bulk, larger
+	// requests are rejected with a 413. Defaults to
+	// DefaultMaxBlockBodySize.
+	MaxBlockBodySize int64
+}
+
+// ResolveResult is the outcome of resolving a skylink as part of a batch, it
+// holds either the V1 skylink the skylink resolved to or the error that made
+// the resolution fail.
+type ResolveResult struct {
+	Resolved skymodules.Skylink
+	Err      error
+}
+
+// Blocker describes the functionality of the blocker that is exposed through
+// the API.
+//
+// NOTE: this is an interface because the blocker package depends on the api
+// package, which means we can't reference the blocker directly.
+type Blocker interface {
+	// BlockHashes blocks the given hashes in skyd and updates their records
+	// in the database. It returns the amount of hashes which were blocked
+	// successfully, the amount that were invalid, and a potential error.
+	BlockHashes(ctx context.Context, hashes []database.Hash) (int, int, error)
+
+	// Config returns the configuration of the blocker that is in effect,
+	// including the values that were adjusted at runtime.
+	Config() BlockerConfig
+
+	// BlockStatus returns the block status of the given skylink, both in the
+	// database and, if checkSkyd is set, in skyd.
+	BlockStatus(ctx context.Context, skylink string, checkSkyd bool) (BlockStatus, error)
+
+	// RestoreToSnapshot reverses the blocks of the skylinks that were added
+	// after the snapshot with the given label, without doing so if dryRun is
+	// set. The outcome holds the hashes that were, or would be, reverted.
+	RestoreToSnapshot(ctx context.Context, label string, dryRun bool) (SnapshotRestore, error)
+
+	// ResolveSkylink resolves the given skylink to a V1 skylink, it applies
+	// the blocker's resolve timeout.
+	ResolveSkylink(ctx context.Context, skylink skymodules.Skylink) (skymodules.Skylink, error)
+
+	// ResolveSkylinks resolves the given skylinks to V1 skylinks, using as
+	// few requests to skyd as possible. The results are in the order of the
+	// given skylinks.
+	ResolveSkylinks(ctx context.Context, skylinks []skymodules.Skylink) []ResolveResult
+
+	// RetryFailed retries all hashes that failed to get blocked. It returns
+	// the amount of hashes that were retried and the amount that are still
+	// failed.
+	RetryFailed(ctx context.Context) (int, int, error)
+
+	// ScanIntegrity scans the database for skylinks that are malformed or in
+	// an inconsistent state, repairing the trivially fixable ones if repair
+	// is set.
+	ScanIntegrity(ctx context.Context, repair bool) (database.IntegrityReport, error)
+
+	// SetMaintenanceSchedule replaces the schedule of the daily maintenance
+	// windows during which the blocker does not block, it takes effect
+	// immediately.
+	SetMaintenanceSchedule(schedule string) error
+
+	// SetSourceEnabled disables or enables the given report source, the
+	// skylinks that were only reported by a disabled source are not blocked.
+	SetSourceEnabled(ctx context.Context, source string, enabled bool) error
+
+	// SetSuspended suspends or resumes the sweeps, it takes effect
+	// immediately.
+	SetSuspended(suspended bool)
+
+	// SetSweepInterval sets the amount of time the blocker waits between
+	// sweeps, a zero interval resets it to the default.
+	SetSweepInterval(interval time.Duration) error
+
+	// SweepStatus returns a snapshot of the state of the block sweeps, it
+	// must be safe to call concurrently with the sweeps.
+	SweepStatus() SweepStatus
 }
 
 // New creates a new API instance.
-func New(skydClient *SkydClient, db *database.DB, logger *logrus.Logger) (*API, error) {
+func New(skydClient *SkydClient, db *database.DB, blocker Blocker, logger *logrus.Logger, opts Options) (*API, error) {
 	if db == nil {
 		return nil, errors.New("no DB provided")
 	}
+	if blocker == nil {
+		return nil, errors.New("no blocker provided")
+	}
 	if logger == nil {
 		return nil, errors.New("no logger provided")
 	}
 	if skydClient == nil {
 		return nil, errors.New("no skyd client provided")
 	}
+	if opts.MaxBlockBodySize < 0 {
+		return nil, errors.New("max block body size can not be negative")
+	}
+	if opts.MaxBlockBodySize == 0 {
+		opts.MaxBlockBodySize = DefaultMaxBlockBodySize
+	}
 	router := httprouter.New()
 	router.RedirectTrailingSlash = true
 
 	api := &API{
-		staticDB:         db,
-		staticLogger:     logger,
-		staticRouter:     router,
-		staticSkydClient: skydClient,
+		staticBlocker:           blocker,
+		staticDB:                db,
+		staticFetchMetadata:     opts.FetchMetadata,
+		staticLogger:            logger,
+		staticMaxBlockBodySize:  opts.MaxBlockBodySize,
+		staticRequireLegalBasis: opts.RequireLegalBasis,
+		staticRouter:            router,
+		staticSigningKey:        opts.SigningKey,
+		staticSkydClient:        skydClient,
 	}
 
 	api.buildHTTPRoutes()
@@ -8,9 +8,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	url "net/url"
+	"time"
 
 	"github.com/SkynetLabs/blocker/database"
 	"github.com/sirupsen/logrus"
+	"gitlab.com/SkynetLabs/skyd/skymodules"
 )
 
 // apiTester is a helper struct wrapping handlers of the underlying API that
@@ -19,6 +21,93 @@ type apiTester struct {
 	staticAPI *API
 }
 
+// mockBlocker is a helper struct that implements the Blocker interface.
+type mockBlocker struct {
+	blockStatus     BlockStatus
+	integrityReport database.IntegrityReport
+	integrityRepair bool
+	suspended       bool
+	sweepInterval   time.Duration
+
+	staticDB         *database.DB
+	staticSkydClient *SkydClient
+}
+
+// BlockHashes implements the Blocker interface.
+func (mb *mockBlocker) BlockHashes(ctx context.Context, hashes []database.Hash) (int, int, error) {
+	return len(hashes), 0, nil
+}
+
+// Config implements the Blocker interface.
+func (mb *mockBlocker) Config() BlockerConfig {
+	return BlockerConfig{SweepInterval: mb.sweepInterval.String()}
+}
+
+// BlockStatus implements the Blocker interface.
+func (mb *mockBlocker) BlockStatus(ctx context.Context, skylink string, checkSkyd bool) (BlockStatus, error) {
+	return mb.blockStatus, nil
+}
+
+// ResolveSkylink implements the Blocker interface.
+func (mb *mockBlocker) ResolveSkylink(ctx context.Context, sl skymodules.Skylink) (skymodules.Skylink, error) {
+	return mb.staticSkydClient.ResolveSkylink(ctx, sl)
+}
+
+// ResolveSkylinks implements the Blocker interface.
+func (mb *mockBlocker) ResolveSkylinks(ctx context.Context, skylinks []skymodules.Skylink) []ResolveResult {
+	results := make([]ResolveResult, len(skylinks))
+	for i, sl := range skylinks {
+		results[i].Resolved, results[i].Err = mb.staticSkydClient.ResolveSkylink(ctx, sl)
+	}
+	return results
+}
+
+// RestoreToSnapshot implements the Blocker interface.
+func (mb *mockBlocker) RestoreToSnapshot(ctx context.Context, label string, dryRun bool) (SnapshotRestore, error) {
+	snapshot, err := mb.staticDB.Snapshot(ctx, label)
+	if err != nil {
+		return SnapshotRestore{}, err
+	}
+	return SnapshotRestore{Label: label, Timestamp: snapshot.Timestamp, DryRun: dryRun}, nil
+}
+
+// RetryFailed implements the Blocker interface.
+func (mb *mockBlocker) RetryFailed(ctx context.Context) (int, int, error) {
+	return 0, 0, nil
+}
+
+// ScanIntegrity implements the Blocker interface.
+func (mb *mockBlocker) ScanIntegrity(ctx context.Context, repair bool) (database.IntegrityReport, error) {
+	mb.integrityRepair = repair
+	return mb.integrityReport, nil
+}
+
+// SetMaintenanceSchedule implements the Blocker interface.
+func (mb *mockBlocker) SetMaintenanceSchedule(schedule string) error {
+	return nil
+}
+
+// SetSourceEnabled implements the Blocker interface.
+func (mb *mockBlocker) SetSourceEnabled(ctx context.Context, source string, enabled bool) error {
+	return mb.staticDB.SetSourceEnabled(ctx, source, enabled)
+}
+
+// SetSuspended implements the Blocker interface.
+func (mb *mockBlocker) SetSuspended(suspended bool) {
+	mb.suspended = suspended
+}
+
+// SetSweepInterval implements the Blocker interface.
+func (mb *mockBlocker) SetSweepInterval(interval time.Duration) error {
+	mb.sweepInterval = interval
+	return nil
+}
+
+// SweepStatus implements the Blocker interface.
+func (mb *mockBlocker) SweepStatus() SweepStatus {
+	return SweepStatus{Suspended: mb.suspended, SweepInterval: mb.sweepInterval}
+}
+
 // newAPITester returns a new instance of apiTester
 func newAPITester(api *API) *apiTester {
 	return &apiTester{staticAPI: api}
@@ -34,7 +123,7 @@ func newTestAPI(dbName string, client *SkydClient) (*API, error) {
 	logger.Out = ioutil.Discard
 
 	// create the API
-	api, err := New(client, db, logger)
+	api, err := New(client, db, &mockBlocker{staticDB: db, staticSkydClient: client}, logger, Options{})
 	if err != nil {
 		return nil, err
 	}
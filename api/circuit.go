@@ -0,0 +1,174 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+)
+
+const (
+	// CircuitClosed is the state of the circuit breaker when skyd is
+	// healthy, all calls go through.
+	CircuitClosed = "closed"
+
+	// CircuitOpen is the state of the circuit breaker after skyd failed too
+	// many times in a row, all calls are short-circuited until the cooldown
+	// expires.
+	CircuitOpen = "open"
+
+	// CircuitHalfOpen is the state of the circuit breaker after the cooldown
+	// expired, a single probe call goes through. If it succeeds the circuit
+	// closes, otherwise it opens again.
+	CircuitHalfOpen = "half-open"
+
+	// DefaultCircuitThreshold is the default number of consecutive failures
+	// after which the circuit opens.
+	DefaultCircuitThreshold = 5
+
+	// DefaultCircuitCooldown is the default amount of time the circuit stays
+	// open before a probe call is let through.
+	DefaultCircuitCooldown = 5 * time.Minute
+)
+
+var (
+	// ErrCircuitOpen is returned by the skyd client when the call was
+	// short-circuited because skyd failed too many times in a row.
+	ErrCircuitOpen = errors.New("skyd circuit breaker is open")
+)
+
+type (
+	// CircuitState describes the state of the circuit breaker around skyd,
+	// along with some counters that allow monitoring it.
+	CircuitState struct {
+		State               string    `json:"state"`
+		ConsecutiveFailures int       `json:"consecutivefailures"`
+		OpenedAt            time.Time `json:"openedat,omitempty"`
+		RetryAt             time.Time `json:"retryat,omitempty"`
+		Opens               uint64    `json:"opens"`
+		ShortCircuited      uint64    `json:"shortcircuited"`
+	}
+
+	// circuitBreaker keeps track of consecutive skyd failures. After the
+	// threshold is reached it opens and short-circuits all calls for the
+	// duration of the cooldown. After the cooldown it half-opens and lets a
+	// single probe call through, which decides whether it closes or opens
+	// again. A threshold of zero disables the circuit breaker.
+	circuitBreaker struct {
+		failures       int
+		openedAt       time.Time
+		opens          uint64
+		probing        bool
+		shortCircuited uint64
+		state          string
+
+		staticMu sync.Mutex
+
+		// the configuration is guarded by the mutex as well, seeing as it
+		// can be changed after the client was created
+		cooldown  time.Duration
+		threshold int
+	}
+)
+
+// newCircuitBreaker returns a closed circuit breaker with the default
+// threshold and cooldown.
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{
+		state:     CircuitClosed,
+		cooldown:  DefaultCircuitCooldown,
+		threshold: DefaultCircuitThreshold,
+	}
+}
+
+// managedAllow returns ErrCircuitOpen if the call should be short-circuited.
+// If the circuit is open and the cooldown expired, the circuit half-opens and
+// the call is let through as probe.
+func (cb *circuitBreaker) managedAllow() error {
+	cb.staticMu.Lock()
+	defer cb.staticMu.Unlock()
+
+	if cb.threshold == 0 || cb.state == CircuitClosed {
+		return nil
+	}
+	if cb.state == CircuitOpen && time.Since(cb.openedAt) >= cb.cooldown {
+		cb.state = CircuitHalfOpen
+	}
+	if cb.state == CircuitHalfOpen && !cb.probing {
+		cb.probing = true
+		return nil
+	}
+	cb.shortCircuited++
+	return errors.AddContext(ErrCircuitOpen, fmt.Sprintf("retrying after %v", cb.openedAt.Add(cb.cooldown).UTC().Format(time.RFC3339)))
+}
+
+// managedRecord records the outcome of a call that was let through.
+func (cb *circuitBreaker) managedRecord(failed bool) {
+	cb.staticMu.Lock()
+	defer cb.staticMu.Unlock()
+
+	if cb.threshold == 0 {
+		return
+	}
+	cb.probing = false
+	if !failed {
+		cb.failures = 0
+		cb.state = CircuitClosed
+		return
+	}
+	cb.failures++
+	if cb.state == CircuitHalfOpen || (cb.state == CircuitClosed && cb.failures >= cb.threshold) {
+		cb.state = CircuitOpen
+		cb.openedAt = time.Now()
+		cb.opens++
+	}
+}
+
+// managedRecordCancelled records a call that was let through but whose context
+// got cancelled, the outcome says nothing about skyd's health. It only frees
+// the probe slot, the state and the consecutive failures are left alone, so a
+// cancelled probe neither closes nor opens the circuit.
+func (cb *circuitBreaker) managedRecordCancelled() {
+	cb.staticMu.Lock()
+	defer cb.staticMu.Unlock()
+	cb.probing = false
+}
+
+// managedConfigure updates the threshold and cooldown of the circuit breaker,
+// it resets the circuit.
+func (cb *circuitBreaker) managedConfigure(threshold int, cooldown time.Duration) error {
+	if threshold < 0 {
+		return errors.New("circuit breaker threshold can not be negative")
+	}
+	if threshold > 0 && cooldown <= 0 {
+		return errors.New("circuit breaker cooldown has to be positive")
+	}
+
+	cb.staticMu.Lock()
+	defer cb.staticMu.Unlock()
+	cb.cooldown = cooldown
+	cb.failures = 0
+	cb.probing = false
+	cb.state = CircuitClosed
+	cb.threshold = threshold
+	return nil
+}
+
+// managedState returns the current state of the circuit breaker.
+func (cb *circuitBreaker) managedState() CircuitState {
+	cb.staticMu.Lock()
+	defer cb.staticMu.Unlock()
+
+	state := CircuitState{
+		State:               cb.state,
+		ConsecutiveFailures: cb.failures,
+		Opens:               cb.opens,
+		ShortCircuited:      cb.shortCircuited,
+	}
+	if cb.state != CircuitClosed {
+		state.OpenedAt = cb.openedAt.UTC()
+		state.RetryAt = cb.openedAt.Add(cb.cooldown).UTC()
+	}
+	return state
+}
@@ -2,33 +2,196 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	skyapi "gitlab.com/SkynetLabs/skyd/node/api"
 	"gitlab.com/SkynetLabs/skyd/skymodules"
 
+	blockerbuild "github.com/SkynetLabs/blocker/build"
 	"github.com/SkynetLabs/blocker/database"
 	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
 	"gitlab.com/SkynetLabs/skyd/node/api"
+	"go.sia.tech/siad/build"
+	"go.sia.tech/siad/crypto"
+	"go.sia.tech/siad/types"
 )
 
 const (
 	// clientDefaultTimeout is the timeout of the http calls to in seconds
 	clientDefaultTimeout = "30"
+
+	// minBlockByHashVersion is the first skyd version that allows adding
+	// hashes of skylinks to its blocklist, older versions only accept
+	// skylinks.
+	minBlockByHashVersion = "1.5.1"
+
+	// skydInvalidAdditions and skydNoEntriesUpdated are the messages skyd's
+	// blocklist endpoint responds with when it failed to parse the hashes we
+	// asked it to block, or when they were all blocked already.
+	skydInvalidAdditions = "unable to parse blocklist additions"
+	skydNoEntriesUpdated = "no entries updated"
+
+	// RequestIDHeader is the header that carries the ID of every request we
+	// send to skyd, it allows correlating a request with skyd's logs.
+	RequestIDHeader = "X-Request-ID"
+
+	// skydUserAgent is the user agent skyd requires on the requests to its
+	// API, every user agent we send has to contain it.
+	skydUserAgent = "Sia-Agent"
+
+	// MaxBlockTagLength is the maximum length in bytes of the tag that is
+	// sent along with the hashes to block, longer tags are truncated.
+	MaxBlockTagLength = 64
+
+	// ManifestFilename is the path of a skapp's manifest within its skylink.
+	ManifestFilename = "manifest.json"
+
+	// MaxManifestSkylinks is the maximum number of skylinks that are returned
+	// from a skapp's manifest, the ones beyond are ignored.
+	MaxManifestSkylinks = 32
+
+	// maxManifestSize is the maximum size in bytes of a skapp's manifest.
+	maxManifestSize = 1 << 20
+)
+
+var (
+	// ErrResolveTimeout is returned when resolving a skylink did not complete
+	// within the deadline of the given context. It indicates skyd is slow,
+	// e.g. because the registry is slow, and the resolution should be retried
+	// later.
+	ErrResolveTimeout = errors.New("timed out resolving skylink")
+
+	// ErrBatchResolveUnsupported is returned when skyd does not expose an
+	// endpoint to resolve multiple skylinks at once, they have to be
+	// resolved one at a time instead.
+	ErrBatchResolveUnsupported = errors.New("skyd does not support resolving skylinks in batches")
+
+	// errSkydNotFound is returned when skyd does not know the endpoint or the
+	// method of the request.
+	errSkydNotFound = errors.New("skyd endpoint not found")
+
+	// ErrBlocklistUnchanged is returned when skyd did not update its
+	// blocklist because all hashes were blocked already, it indicates
+	// success.
+	ErrBlocklistUnchanged = errors.New("skyd blocklist unchanged")
+
+	// ErrSkydInvalidInput is returned when skyd rejected the request because
+	// of its input, e.g. a malformed hash. Retrying the request won't help.
+	ErrSkydInvalidInput = errors.New("skyd rejected the input")
+
+	// ErrSkydInternal is returned when skyd failed to handle the request, the
+	// request should be retried later.
+	ErrSkydInternal = errors.New("skyd internal error")
+
+	// ErrSkydUnauthorized is returned when skyd rejected our API password.
+	ErrSkydUnauthorized = errors.New("skyd rejected the API password")
+
+	// ErrNoManifest is returned by ManifestSkylinks when the skylink does not
+	// hold a manifest, or when it is not valid JSON.
+	ErrNoManifest = errors.New("skylink has no manifest")
+
+	// DefaultSkydPaths are the paths of the endpoints of current skyd
+	// versions.
+	DefaultSkydPaths = SkydPaths{
+		Blocklist: "/skynet/blocklist",
+		Ready:     "/daemon/ready",
+		Resolve:   "/skynet/resolve",
+	}
+
+	// skydPathsByVersion holds the paths of skyd's endpoints by the first
+	// version that exposes them, sorted by version. Unless paths are
+	// configured explicitly, the client uses the paths of the newest entry
+	// that is not newer than the version of skyd it detected. New entries
+	// are added when skyd moves an endpoint.
+	skydPathsByVersion = []struct {
+		version string
+		paths   SkydPaths
+	}{
+		{version: "1.0.0", paths: DefaultSkydPaths},
+	}
 )
 
 type (
 	// SkydClient is a helper struct that gets initialised using a portal url.
 	// It exposes API methods and abstracts the response handling.
 	SkydClient struct {
+		// capabilities holds the capabilities of skyd, they are probed the
+		// first time they are needed and cached until skyd seems to have
+		// restarted.
+		capabilities *SkydCapabilities
+
+		// paths holds the paths of skyd's endpoints if they were configured
+		// explicitly, otherwise they depend on the version of skyd.
+		paths *SkydPaths
+
+		// batchResolveUnsupported is set when skyd turned out not to support
+		// resolving skylinks in batches, it's reset along with the
+		// capabilities.
+		batchResolveUnsupported bool
+
+		// userAgent is the user agent that is set on every request. It's
+		// guarded by a mutex of its own because nothing that is called
+		// while sending a request may lock staticMu.
+		userAgent         string
+		staticUserAgentMu sync.Mutex
+
+		staticBreaker        *circuitBreaker
+		staticConnPool       *connPool
 		staticDefaultHeaders http.Header
+		staticHTTPClient     *http.Client
+		staticMu             sync.Mutex
 		staticPortalURL      string
+		staticResolveCache   *resolveCache
+	}
+
+	// SkydCapabilities describes the version of skyd and the features of its
+	// API that depend on it.
+	SkydCapabilities struct {
+		Version     string    `json:"version"`
+		GitRevision string    `json:"gitrevision"`
+		BlockByHash bool      `json:"blockbyhash"`
+		Paths       SkydPaths `json:"paths"`
+	}
+
+	// SkydPaths holds the paths of the skyd endpoints the client calls, they
+	// differ between skyd versions. The skylink that has to be resolved is
+	// appended to the resolve path.
+	SkydPaths struct {
+		Blocklist string `json:"blocklist"`
+		Ready     string `json:"ready"`
+		Resolve   string `json:"resolve"`
+	}
+
+	// BlockResult is the outcome of blocking hashes in skyd, it holds the
+	// hashes that got blocked and the hashes skyd rejected as invalid,
+	// alongside the error skyd rejected every invalid hash with.
+	BlockResult struct {
+		Blocked    []database.Hash
+		Invalid    []database.Hash
+		Rejections map[database.Hash]error
+	}
+
+	// blocklistPOST is the body of a request to skyd's blocklist endpoint.
+	// The tag is recorded with the blocked entries by skyd versions that
+	// support it, e.g. the source of the report, other versions ignore it.
+	blocklistPOST struct {
+		skyapi.SkynetBlocklistPOST
+		Tag string `json:"tag,omitempty"`
 	}
 
 	// BlockResponse is the response object returned by the Skyd API's block
@@ -53,34 +216,127 @@ type (
 		Error string `json:"error"`
 	}
 
+	// SkylinkMetadata describes the content of a skylink, it's derived from
+	// the metadata returned by the Skyd API's metadata endpoint.
+	SkylinkMetadata struct {
+		ContentType string `json:"contenttype"`
+		Filename    string `json:"filename"`
+		Length      uint64 `json:"length"`
+	}
+
+	// requestIDKey is the key under which the request ID is stored in a
+	// context.
+	requestIDKey struct{}
+
 	// resolveResponse is the response object returned by the Skyd API's resolve
 	// endpoint
 	resolveResponse struct {
 		Skylink string `json:"skylink"`
 	}
+
+	// resolveBatchRequest is the request body of a POST request to the Skyd
+	// API's resolve endpoint, which resolves multiple skylinks at once.
+	resolveBatchRequest struct {
+		Skylinks []string `json:"skylinks"`
+	}
+
+	// resolveBatchResponse is the response object returned by a POST request
+	// to the Skyd API's resolve endpoint, it maps the skylinks that were
+	// resolved to the V1 skylink they resolved to. Skylinks that could not be
+	// resolved are omitted.
+	resolveBatchResponse struct {
+		Skylinks map[string]string `json:"skylinks"`
+	}
 )
 
 // NewSkydClient returns a client that has the default user-agent set.
 func NewSkydClient(portalURL, apiPassword string) *SkydClient {
+	return NewSkydClientWithTLS(portalURL, apiPassword, nil)
+}
+
+// NewSkydClientWithTLS returns a client that has the default user-agent set
+// and that uses the given TLS config to connect to skyd. This allows talking
+// HTTPS to skyd, optionally presenting a client certificate. If the given TLS
+// config is nil, the client is equal to the one returned by NewSkydClient.
+func NewSkydClientWithTLS(portalURL, apiPassword string, tlsConfig *tls.Config) *SkydClient {
 	headers := http.Header{}
 	if apiPassword != "" {
 		encoded := base64.StdEncoding.EncodeToString([]byte(":" + apiPassword))
 		headers.Set("Authorization", fmt.Sprintf("Basic %s", encoded))
 	}
-	headers.Set("User-Agent", "Sia-Agent")
-	return NewCustomSkydClient(portalURL, headers)
+	return newSkydClient(portalURL, headers, tlsConfig)
 }
 
 // NewCustomSkydClient returns a new SkydClient instance for given portal url
 // and lets you pass a set of headers that will be set on every request.
 func NewCustomSkydClient(portalURL string, headers http.Header) *SkydClient {
-	headers.Set("User-Agent", "Sia-Agent")
+	return newSkydClient(portalURL, headers, nil)
+}
+
+// LoadTLSConfig returns a TLS config that trusts the CA certificates in the
+// given CA bundle and presents the given client certificate. The CA bundle is
+// optional, if it's empty the system's root CAs are used. The certificate and
+// key are optional as well, but they have to be given together.
+func LoadTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	// load the CA bundle
+	if caFile != "" {
+		caPEM, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, errors.AddContext(err, "failed to read CA bundle")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in CA bundle '%v'", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// load the client certificate
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("client certificate and key have to be given together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.AddContext(err, "failed to load client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// newSkydClient returns a new SkydClient instance for given portal url that
+// sets the given headers on every request. If a TLS config is given, it is
+// used by the client's transport.
+func newSkydClient(portalURL string, headers http.Header, tlsConfig *tls.Config) *SkydClient {
+	connPool := newConnPool(tlsConfig)
 	return &SkydClient{
+		staticBreaker:        newCircuitBreaker(),
+		staticConnPool:       connPool,
 		staticDefaultHeaders: headers,
+		staticHTTPClient:     &http.Client{Transport: connPool},
 		staticPortalURL:      portalURL,
+		staticResolveCache:   newResolveCache(),
+		userAgent:            DefaultUserAgent(),
 	}
 }
 
+// DefaultUserAgent returns the user agent the client sets on its requests
+// unless another one is configured, it includes the version of the blocker.
+func DefaultUserAgent() string {
+	return fmt.Sprintf("%s SkynetLabs-Blocker/%s", skydUserAgent, blockerbuild.Version())
+}
+
+// WithRequestID returns a copy of the given context that carries the given
+// ID, e.g. the ID of a sweep. The IDs of the requests that are sent with the
+// returned context are prefixed with it, which allows correlating them with
+// the sweep that issued them.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
 // InvalidHashes is a helper method that converts the list of invalid inputs to
 // an array of hashes.
 func (br *BlockResponse) InvalidHashes() ([]database.Hash, error) {
@@ -100,6 +356,17 @@ func (br *BlockResponse) InvalidHashes() ([]database.Hash, error) {
 	return hashes, nil
 }
 
+// rejection returns the error skyd listed for the given hash, or the given
+// error if skyd did not list one.
+func (br *BlockResponse) rejection(hash database.Hash, fallback error) error {
+	for _, invalid := range br.Invalids {
+		if invalid.Error != "" && strings.EqualFold(invalid.Input, hash.String()) {
+			return errors.New(invalid.Error)
+		}
+	}
+	return fallback
+}
+
 // BlocklistGET calls the `/portal/blocklist` endpoint with given parameters
 func (c *SkydClient) BlocklistGET(offset int) (*BlocklistGET, error) {
 	// set url values
@@ -117,24 +384,141 @@ func (c *SkydClient) BlocklistGET(offset int) (*BlocklistGET, error) {
 	return &blg, nil
 }
 
+// BlocklistBinary fetches the entire blocklist in the binary format from the
+// `/portal/blocklist` endpoint, most recently blocked first, and calls the given
+// function for every hash. Iteration stops at the first error returned by the
+// given function, which allows the caller to stop once it encounters a hash it
+// synced already. If the export is truncated or corrupt, the returned error
+// contains ErrBinaryBlocklistCorrupt.
+func (c *SkydClient) BlocklistBinary(ctx context.Context, fn func(database.Hash) error) error {
+	return c.blocklistBinary(ctx, nil, fn)
+}
+
+// BlocklistBinaryVerified is like BlocklistBinary but the export has to be
+// signed by the given key. The signature is verified after the last hash, the
+// caller must therefore not act on the hashes unless nil is returned, and
+// stopping early means the signature is not verified. If the export is
+// unsigned or the signature is invalid, the returned error contains
+// ErrBinaryBlocklistSignature.
+func (c *SkydClient) BlocklistBinaryVerified(ctx context.Context, pk crypto.PublicKey, fn func(database.Hash) error) error {
+	return c.blocklistBinary(ctx, &pk, fn)
+}
+
+// blocklistBinary streams the binary blocklist, verifying its signature if a
+// key is given.
+func (c *SkydClient) blocklistBinary(ctx context.Context, pk *crypto.PublicKey, fn func(database.Hash) error) error {
+	// set url values
+	query := url.Values{}
+	query.Set("format", FormatBinary)
+	query.Set("sort", "desc")
+
+	// create the request
+	url := fmt.Sprintf("%s/skynet/portal/blocklist?%s", c.staticPortalURL, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return errors.AddContext(err, "failed to create request")
+	}
+
+	// set headers and execute the request
+	for k, v := range c.staticDefaultHeaders {
+		req.Header.Set(k, v[0])
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return err
+	}
+
+	// NOTE: we purposefully don't drain the body, the caller might stop
+	// early and draining would mean downloading the entire blocklist anyway
+	defer res.Body.Close()
+
+	// return an error if the status code is not in the 200s
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return classifySkydError(res.StatusCode, fmt.Errorf("GET request to '%s' with status %d error %v", url, res.StatusCode, readAPIError(res.Body)))
+	}
+
+	// read the hashes
+	br, err := newBinaryBlocklistReader(res.Body, pk)
+	if err != nil {
+		return errors.AddContext(err, fmt.Sprintf("failed to read binary blocklist of portal %s", c.staticPortalURL))
+	}
+	for {
+		hash, err := br.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.AddContext(err, fmt.Sprintf("failed to read binary blocklist of portal %s", c.staticPortalURL))
+		}
+		err = fn(hash)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Blocklist calls the `/skynet/blocklist` endpoint and returns all hashes that
+// are currently blocked by skyd.
+func (c *SkydClient) Blocklist() ([]database.Hash, error) {
+	var blg skyapi.SkynetBlocklistGET
+	err := c.get(c.managedPaths().Blocklist, url.Values{}, &blg)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to execute GET request")
+	}
+
+	hashes := make([]database.Hash, len(blg.Blocklist))
+	for i, hash := range blg.Blocklist {
+		hashes[i] = database.Hash{Hash: hash}
+	}
+	return hashes, nil
+}
+
 // BlockHashes will perform an API call to skyd to block the given hashes. It
 // returns which hashes were blocked, which hashes were invalid and potentially
 // an error.
 func (c *SkydClient) BlockHashes(hashes []database.Hash) ([]database.Hash, []database.Hash, error) {
+	return c.BlockHashesWithContext(context.Background(), hashes)
+}
+
+// BlockHashesWithContext is the same as BlockHashes, but the requests are
+// aborted when the given context is cancelled. If skyd rejects the hashes as
+// invalid input, the context is checked before every request that isolates
+// the invalid hashes, a cancelled context fails the whole call.
+func (c *SkydClient) BlockHashesWithContext(ctx context.Context, hashes []database.Hash) ([]database.Hash, []database.Hash, error) {
+	res, err := c.BlockHashesDetailed(ctx, hashes)
+	return res.Blocked, res.Invalid, err
+}
+
+// BlockHashesDetailed is the same as BlockHashesWithContext, but the result
+// also holds the error skyd responded with for every hash it rejected.
+func (c *SkydClient) BlockHashesDetailed(ctx context.Context, hashes []database.Hash) (BlockResult, error) {
+	return c.BlockHashesTagged(ctx, hashes, "")
+}
+
+// BlockHashesTagged is the same as BlockHashesDetailed, but skyd is asked to
+// record the given tag with the blocked hashes, e.g. the source of the report,
+// which helps when inspecting skyd's blocklist directly. Skyd versions that
+// don't support tags ignore it, the hashes are blocked regardless. Tags that
+// exceed MaxBlockTagLength are truncated, an empty tag is not sent.
+func (c *SkydClient) BlockHashesTagged(ctx context.Context, hashes []database.Hash, tag string) (BlockResult, error) {
 	// convert the hashes to strings
 	adds := make([]string, len(hashes))
 	for h, hash := range hashes {
 		adds[h] = hash.String()
 	}
+	tag = truncateBlockTag(tag)
 
 	// build the post body
-	reqBody, err := json.Marshal(skyapi.SkynetBlocklistPOST{
-		Add:    adds,
-		Remove: nil,
-		IsHash: true,
+	reqBody, err := json.Marshal(blocklistPOST{
+		SkynetBlocklistPOST: skyapi.SkynetBlocklistPOST{
+			Add:    adds,
+			Remove: nil,
+			IsHash: true,
+		},
+		Tag: tag,
 	})
 	if err != nil {
-		return nil, nil, errors.AddContext(err, "failed to build request body")
+		return BlockResult{}, errors.AddContext(err, "failed to build request body")
 	}
 	body := bytes.NewBuffer(reqBody)
 
@@ -144,62 +528,611 @@ func (c *SkydClient) BlockHashes(hashes []database.Hash) ([]database.Hash, []dat
 
 	// execute the request
 	var response BlockResponse
-	err = c.post("/skynet/blocklist", query, body, &response)
+	err = c.postWithContext(ctx, c.managedPaths().Blocklist, query, body, &response)
+	if errors.Contains(err, ErrBlocklistUnchanged) {
+		return BlockResult{Blocked: hashes}, nil
+	}
+	if errors.Contains(err, ErrSkydInvalidInput) {
+		return c.blockHashesSkipInvalid(ctx, hashes, tag, response, err)
+	}
+	if err != nil && ctx.Err() != nil {
+		return BlockResult{}, errors.Compose(err, ctx.Err())
+	}
 	if err != nil {
-		return nil, nil, errors.AddContext(err, "failed to execute POST request")
+		// skyd might be restarting, possibly with another version
+		c.ResetCapabilities()
+		return BlockResult{}, errors.AddContext(err, "failed to execute POST request")
 	}
 
 	// parse the invalid hashes from the response
 	invalids, err := response.InvalidHashes()
 	if err != nil {
-		return nil, nil, errors.AddContext(err, "failed to parse invalid hashes from skyd response")
+		return BlockResult{}, errors.AddContext(err, "failed to parse invalid hashes from skyd response")
+	}
+	res := BlockResult{Blocked: database.DiffHashes(hashes, invalids)}
+	for _, hash := range invalids {
+		res.addRejected([]database.Hash{hash}, response.rejection(hash, errors.New("skyd deemed the hash invalid")))
 	}
+	return res, nil
+}
 
-	return database.DiffHashes(hashes, invalids), invalids, nil
+// BlockRegistryEntry blocks the registry entry with the given public key, e.g.
+// 'ed25519:<hex>', and hex encoded tweak in skyd. Skyd checks V2 skylinks
+// against its blocklist before resolving them, blocking the registry entry
+// therefore blocks the V2 skylink that points to it, regardless of the content
+// the registry entry is updated to point to.
+func (c *SkydClient) BlockRegistryEntry(pubkey, tweak string) error {
+	hash, err := ParseRegistryEntry(pubkey, tweak)
+	if err != nil {
+		return err
+	}
+	_, invalid, err := c.BlockHashes([]database.Hash{hash})
+	if err != nil {
+		return err
+	}
+	if len(invalid) > 0 {
+		return errors.AddContext(ErrSkydInvalidInput, "skyd deemed the registry entry invalid")
+	}
+	return nil
 }
 
-// ResolveSkylink will resolve the given skylink.
-func (c *SkydClient) ResolveSkylink(skylink skymodules.Skylink) (skymodules.Skylink, error) {
+// ParseRegistryEntry returns the hash of the registry entry with the given
+// public key and hex encoded tweak, the public key is expected to be in the
+// format 'ed25519:<hex>'.
+func ParseRegistryEntry(pubkey, tweak string) (database.Hash, error) {
+	var spk types.SiaPublicKey
+	err := spk.LoadString(pubkey)
+	if err != nil {
+		return database.Hash{}, errors.AddContext(err, "invalid public key")
+	}
+	if spk.Algorithm != types.SignatureEd25519 || len(spk.Key) != crypto.PublicKeySize {
+		return database.Hash{}, errors.New("invalid public key, expected an ed25519 key")
+	}
+	var t crypto.Hash
+	err = t.LoadString(tweak)
+	if err != nil {
+		return database.Hash{}, errors.AddContext(err, "invalid tweak")
+	}
+	return database.HashFromRegistryEntry(spk, t), nil
+}
+
+// blockHashesSkipInvalid is called when skyd rejected the given hashes as
+// invalid input. If skyd's error response lists which hashes are invalid, the
+// remaining hashes are blocked in a single request. Otherwise we fall back to
+// isolating the invalid hashes by splitting the hashes.
+func (c *SkydClient) blockHashesSkipInvalid(ctx context.Context, hashes []database.Hash, tag string, response BlockResponse, rejectErr error) (BlockResult, error) {
+	// only consider the listed hashes that are part of the request, if skyd
+	// lists hashes we can't parse or didn't send we can't rely on the detail
+	listed, err := response.InvalidHashes()
+	if err != nil {
+		return c.blockHashesIsolateInvalid(ctx, hashes, tag, rejectErr)
+	}
+	valid := database.DiffHashes(hashes, listed)
+	invalid := database.DiffHashes(hashes, valid)
+	if len(invalid) == 0 {
+		return c.blockHashesIsolateInvalid(ctx, hashes, tag, rejectErr)
+	}
+	var res BlockResult
+	for _, hash := range invalid {
+		res.addRejected([]database.Hash{hash}, response.rejection(hash, rejectErr))
+	}
+	if len(valid) == 0 {
+		return res, nil
+	}
+
+	// skyd rejected the whole request, so block the remaining hashes
+	if err := ctx.Err(); err != nil {
+		return BlockResult{}, err
+	}
+	more, err := c.BlockHashesTagged(ctx, valid, tag)
+	if err != nil {
+		return BlockResult{}, err
+	}
+	res.Merge(more)
+	return res, nil
+}
+
+// blockHashesIsolateInvalid is called when skyd rejected the given hashes as
+// invalid input. Skyd rejects the whole request if a single hash is
+// malformed, so we split the hashes in half and block both halves separately
+// until we isolated the hashes skyd deems invalid. A single hash that is
+// rejected is considered invalid.
+func (c *SkydClient) blockHashesIsolateInvalid(ctx context.Context, hashes []database.Hash, tag string, rejectErr error) (BlockResult, error) {
+	if len(hashes) == 1 {
+		var res BlockResult
+		res.addRejected(hashes, rejectErr)
+		return res, nil
+	}
+	if len(hashes) == 0 {
+		return BlockResult{}, errors.AddContext(rejectErr, "failed to execute POST request")
+	}
+
+	mid := len(hashes) / 2
+	if err := ctx.Err(); err != nil {
+		return BlockResult{}, err
+	}
+	res, err := c.BlockHashesTagged(ctx, hashes[:mid], tag)
+	if err != nil {
+		return BlockResult{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return BlockResult{}, err
+	}
+	more, err := c.BlockHashesTagged(ctx, hashes[mid:], tag)
+	if err != nil {
+		return BlockResult{}, err
+	}
+	res.Merge(more)
+	return res, nil
+}
+
+// truncateBlockTag truncates the given tag to MaxBlockTagLength bytes, without
+// splitting a multi-byte character.
+func truncateBlockTag(tag string) string {
+	if len(tag) <= MaxBlockTagLength {
+		return tag
+	}
+	end := MaxBlockTagLength
+	for end > 0 && !utf8.RuneStart(tag[end]) {
+		end--
+	}
+	return tag[:end]
+}
+
+// addRejected adds the given hashes to the invalid hashes of the result, along
+// with the error skyd rejected them with.
+func (res *BlockResult) addRejected(hashes []database.Hash, err error) {
+	if len(hashes) == 0 {
+		return
+	}
+	if res.Rejections == nil {
+		res.Rejections = make(map[database.Hash]error, len(hashes))
+	}
+	for _, hash := range hashes {
+		res.Invalid = append(res.Invalid, hash)
+		res.Rejections[hash] = err
+	}
+}
+
+// Merge adds the hashes of the given result to the result.
+func (res *BlockResult) Merge(other BlockResult) {
+	res.Blocked = append(res.Blocked, other.Blocked...)
+	for _, hash := range other.Invalid {
+		res.addRejected([]database.Hash{hash}, other.Rejections[hash])
+	}
+}
+
+// UnblockHashes will perform an API call to skyd to remove the given hashes
+// from its blocklist.
+func (c *SkydClient) UnblockHashes(hashes []database.Hash) error {
+	// convert the hashes to strings
+	removes := make([]string, len(hashes))
+	for h, hash := range hashes {
+		removes[h] = hash.String()
+	}
+
+	// build the post body
+	reqBody, err := json.Marshal(skyapi.SkynetBlocklistPOST{
+		Add:    nil,
+		Remove: removes,
+		IsHash: true,
+	})
+	if err != nil {
+		return errors.AddContext(err, "failed to build request body")
+	}
+	body := bytes.NewBuffer(reqBody)
+
+	// build the query parameters
+	query := url.Values{}
+	query.Add("timeout", clientDefaultTimeout)
+
+	// execute the request
+	var response BlockResponse
+	err = c.post(c.managedPaths().Blocklist, query, body, &response)
+	if err != nil {
+		return errors.AddContext(err, "failed to execute POST request")
+	}
+	return nil
+}
+
+// ResolveSkylink will resolve the given skylink. The resolution is aborted when
+// the given context is cancelled, if it is aborted because the context's
+// deadline was exceeded the returned error contains ErrResolveTimeout.
+func (c *SkydClient) ResolveSkylink(ctx context.Context, skylink skymodules.Skylink) (skymodules.Skylink, error) {
 	// no need to resolve the skylink if it's a v1 skylink
 	if skylink.IsSkylinkV1() {
 		return skylink, nil
 	}
 
+	// check whether we resolved the skylink recently
+	if resolved, cached := c.staticResolveCache.managedGet(skylink); cached {
+		return resolved, nil
+	}
+
 	// execute the request
 	var response resolveResponse
-	endpoint := fmt.Sprintf("/skynet/resolve/%s", skylink.String())
-	err := c.get(endpoint, url.Values{}, &response)
+	endpoint := fmt.Sprintf("%s/%s", c.managedPaths().Resolve, skylink.String())
+	err := c.getWithContext(ctx, endpoint, url.Values{}, &response)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return skymodules.Skylink{}, errors.Compose(err, ErrResolveTimeout)
+	}
 	if err != nil {
 		return skymodules.Skylink{}, errors.AddContext(err, "failed to execute GET request")
 	}
 
 	// check whether we resolved a valid skylink
-	err = skylink.LoadString(response.Skylink)
+	var resolved skymodules.Skylink
+	err = resolved.LoadString(response.Skylink)
 	if err != nil {
 		return skymodules.Skylink{}, errors.AddContext(err, "unable to load the resolved skylink")
 	}
-	return skylink, nil
+	c.staticResolveCache.managedAdd(skylink, resolved)
+	return resolved, nil
+}
+
+// ResolveSkylinks resolves the given skylinks in a single request to skyd. The
+// returned map holds the V1 skylink every skylink resolved to, keyed by the
+// skylink. V1 skylinks resolve to themselves and recently resolved skylinks
+// are served from the cache. Skylinks skyd failed to resolve are omitted, it's
+// up to the caller to retry them. If skyd does not support resolving skylinks
+// in batches ErrBatchResolveUnsupported is returned, which is remembered until
+// the capabilities of skyd are reset.
+func (c *SkydClient) ResolveSkylinks(ctx context.Context, skylinks []skymodules.Skylink) (map[string]skymodules.Skylink, error) {
+	resolved := make(map[string]skymodules.Skylink, len(skylinks))
+	var unresolved []string
+	for _, skylink := range skylinks {
+		if skylink.IsSkylinkV1() {
+			resolved[skylink.String()] = skylink
+			continue
+		}
+		if v1, cached := c.staticResolveCache.managedGet(skylink); cached {
+			resolved[skylink.String()] = v1
+			continue
+		}
+		unresolved = append(unresolved, skylink.String())
+	}
+	if len(unresolved) == 0 {
+		return resolved, nil
+	}
+
+	// escape early if skyd is known not to support batches
+	c.staticMu.Lock()
+	unsupported := c.batchResolveUnsupported
+	c.staticMu.Unlock()
+	if unsupported {
+		return nil, ErrBatchResolveUnsupported
+	}
+
+	// build the request body
+	reqBody, err := json.Marshal(resolveBatchRequest{Skylinks: unresolved})
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to build request body")
+	}
+
+	// execute the request
+	var response resolveBatchResponse
+	err = c.postWithContext(ctx, c.managedPaths().Resolve, url.Values{}, bytes.NewBuffer(reqBody), &response)
+	if errors.Contains(err, errSkydNotFound) {
+		c.staticMu.Lock()
+		c.batchResolveUnsupported = true
+		c.staticMu.Unlock()
+		return nil, errors.Compose(err, ErrBatchResolveUnsupported)
+	}
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return nil, errors.Compose(err, ErrResolveTimeout)
+	}
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to execute POST request")
+	}
+
+	// only accept resolutions to valid skylinks of skylinks we asked for
+	for _, skylink := range unresolved {
+		v1Str, exists := response.Skylinks[skylink]
+		if !exists {
+			continue
+		}
+		var sl, v1 skymodules.Skylink
+		if sl.LoadString(skylink) != nil || v1.LoadString(v1Str) != nil || !v1.IsSkylinkV1() {
+			continue
+		}
+		resolved[skylink] = v1
+		c.staticResolveCache.managedAdd(sl, v1)
+	}
+	return resolved, nil
+}
+
+// SkylinkMetadata fetches the metadata of the given skylink from skyd. The
+// request is aborted when the given context is cancelled. The content type is
+// only known for skylinks that hold a single file or have a default path,
+// for other directories it's left empty.
+func (c *SkydClient) SkylinkMetadata(ctx context.Context, skylink skymodules.Skylink) (SkylinkMetadata, error) {
+	var sm skymodules.SkyfileMetadata
+	endpoint := fmt.Sprintf("/skynet/metadata/%s", skylink.String())
+	err := c.getWithContext(ctx, endpoint, url.Values{}, &sm)
+	if err != nil {
+		return SkylinkMetadata{}, errors.AddContext(err, "failed to execute GET request")
+	}
+
+	metadata := SkylinkMetadata{
+		Filename: sm.Filename,
+		Length:   sm.Length,
+	}
+	if len(sm.Subfiles) == 1 {
+		for _, subfile := range sm.Subfiles {
+			metadata.ContentType = subfile.ContentType
+		}
+	} else if subfile, exists := sm.Subfiles[strings.TrimPrefix(sm.DefaultPath, "/")]; exists {
+		metadata.ContentType = subfile.ContentType
+	}
+	return metadata, nil
+}
+
+// ManifestSkylinks fetches the manifest of the skapp with the given skylink
+// from skyd and returns the skylinks it references, in the order they appear
+// and normalized like ExtractSkylinks does. References to the skapp itself are
+// omitted and at most MaxManifestSkylinks skylinks are returned.
+//
+// NOTE: the manifests of the referenced skylinks are not fetched, following the
+// references only one level deep is what guards against reference loops.
+func (c *SkydClient) ManifestSkylinks(ctx context.Context, skylink skymodules.Skylink) ([]string, error) {
+	url := fmt.Sprintf("%s/skynet/skylink/%s/%s", c.staticPortalURL, skylink.String(), ManifestFilename)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to create request")
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer drainAndClose(res.Body)
+
+	// skyd responds with a not found if either the skylink or the manifest
+	// is unknown
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNoManifest
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, classifySkydError(res.StatusCode, fmt.Errorf("GET request to '%s' with status %d error %v", url, res.StatusCode, readAPIError(res.Body)))
+	}
+
+	// read the manifest, skyd serves the skapp's index instead if the skapp
+	// has no manifest but configures try files, so we only accept JSON
+	manifest, err := ioutil.ReadAll(io.LimitReader(res.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to read manifest")
+	}
+	if len(manifest) > maxManifestSize {
+		return nil, fmt.Errorf("manifest exceeds the maximum size of %d bytes", maxManifestSize)
+	}
+	if !json.Valid(manifest) {
+		return nil, errors.AddContext(ErrNoManifest, "manifest is not valid JSON")
+	}
+
+	skylinks := make([]string, 0)
+	for _, sl := range ExtractSkylinks(string(manifest)) {
+		if sl == skylink.String() {
+			continue
+		}
+		if len(skylinks) == MaxManifestSkylinks {
+			break
+		}
+		skylinks = append(skylinks, sl)
+	}
+	return skylinks, nil
 }
 
 // DaemonReady connects to the local skyd and checks its status.
 // Returns true only if skyd is fully ready.
 func (c *SkydClient) DaemonReady() bool {
 	var response DaemonReadyResponse
-	err := c.get("/daemon/ready", url.Values{}, &response)
-	if err != nil {
-		return false
-	}
-
-	return response.Ready &&
+	err := c.get(c.managedPaths().Ready, url.Values{}, &response)
+	ready := err == nil &&
+		response.Ready &&
 		response.Consensus &&
 		response.Gateway &&
 		response.Renter
+
+	// skyd might be restarting, possibly with another version
+	if !ready {
+		c.ResetCapabilities()
+	}
+	return ready
+}
+
+// Capabilities returns the capabilities of skyd, which depend on its version.
+// They are probed once and cached until ResetCapabilities is called, which
+// happens when skyd seems to have restarted. A failed probe is not cached.
+// The lock is not held while probing skyd, so a slow skyd does not block the
+// callers that only need the cached paths, concurrent probes are harmless.
+func (c *SkydClient) Capabilities() (SkydCapabilities, error) {
+	c.staticMu.Lock()
+	cached := c.capabilities
+	c.staticMu.Unlock()
+	if cached != nil {
+		return *cached, nil
+	}
+
+	var response skyapi.DaemonVersion
+	err := c.get("/daemon/version", url.Values{}, &response)
+	if err != nil {
+		return SkydCapabilities{}, errors.AddContext(err, "failed to fetch skyd version")
+	}
+	if !build.IsVersion(response.Version) {
+		return SkydCapabilities{}, fmt.Errorf("invalid skyd version '%v'", response.Version)
+	}
+	capabilities := SkydCapabilities{
+		Version:     response.Version,
+		GitRevision: response.GitRevision,
+		BlockByHash: build.VersionCmp(response.Version, minBlockByHashVersion) >= 0,
+		Paths:       skydPathsForVersion(response.Version),
+	}
+
+	c.staticMu.Lock()
+	c.capabilities = &capabilities
+	c.staticMu.Unlock()
+	return capabilities, nil
+}
+
+// ResetCapabilities clears the cached capabilities of skyd, they are probed
+// again the next time they are needed.
+func (c *SkydClient) ResetCapabilities() {
+	c.staticMu.Lock()
+	defer c.staticMu.Unlock()
+	c.capabilities = nil
+	c.batchResolveUnsupported = false
+}
+
+// CircuitState returns the state of the circuit breaker around skyd.
+func (c *SkydClient) CircuitState() CircuitState {
+	return c.staticBreaker.managedState()
+}
+
+// ConfigureCircuitBreaker sets the number of consecutive failures after which
+// the circuit breaker opens and the amount of time it stays open before a
+// probe call is let through. A threshold of zero disables the circuit breaker.
+func (c *SkydClient) ConfigureCircuitBreaker(threshold int, cooldown time.Duration) error {
+	return c.staticBreaker.managedConfigure(threshold, cooldown)
+}
+
+// ConfigureConnectionPool sets the number of idle connections to skyd that
+// are kept for reuse, the limit on the number of connections to skyd, where
+// zero means there's no limit, and the amount of time an idle connection is
+// kept before it's closed.
+func (c *SkydClient) ConfigureConnectionPool(maxIdleConnsPerHost, maxConnsPerHost int, idleConnTimeout time.Duration) error {
+	return c.staticConnPool.managedConfigure(maxIdleConnsPerHost, maxConnsPerHost, idleConnTimeout)
+}
+
+// Config returns the configuration of the client that is in effect. The API
+// password is never returned, only whether it is set.
+func (c *SkydClient) Config() SkydConfig {
+	portalURL := c.staticPortalURL
+	if u, err := url.Parse(portalURL); err == nil {
+		portalURL = u.Redacted()
+	}
+	pool := c.staticConnPool.managedStats()
+	return SkydConfig{
+		URL:                 portalURL,
+		APIPasswordSet:      c.staticDefaultHeaders.Get("Authorization") != "",
+		IdleConnTimeout:     pool.IdleConnTimeout,
+		MaxConnsPerHost:     pool.MaxConnsPerHost,
+		MaxIdleConnsPerHost: pool.MaxIdleConnsPerHost,
+		Paths:               c.managedPaths(),
+		TLS:                 c.staticConnPool.staticTLSConfig != nil,
+		UserAgent:           c.managedUserAgent(),
+	}
+}
+
+// ConnectionPoolStats returns the metrics of the pool of connections to skyd.
+func (c *SkydClient) ConnectionPoolStats() ConnectionPoolStats {
+	return c.staticConnPool.managedStats()
+}
+
+// ConfigurePaths sets the paths of the skyd endpoints the client calls,
+// overriding the paths it selects based on the version of skyd. Empty paths
+// default to DefaultSkydPaths.
+func (c *SkydClient) ConfigurePaths(paths SkydPaths) error {
+	if paths.Blocklist == "" {
+		paths.Blocklist = DefaultSkydPaths.Blocklist
+	}
+	if paths.Ready == "" {
+		paths.Ready = DefaultSkydPaths.Ready
+	}
+	if paths.Resolve == "" {
+		paths.Resolve = DefaultSkydPaths.Resolve
+	}
+	for _, path := range []string{paths.Blocklist, paths.Ready, paths.Resolve} {
+		if !strings.HasPrefix(path, "/") || strings.ContainsAny(path, "?#") {
+			return fmt.Errorf("invalid skyd path '%v', paths have to be absolute and can't hold a query", path)
+		}
+	}
+	paths.Resolve = strings.TrimSuffix(paths.Resolve, "/")
+
+	c.staticMu.Lock()
+	defer c.staticMu.Unlock()
+	c.paths = &paths
+	return nil
+}
+
+// ConfigureUserAgent sets the user agent of the requests to skyd. An empty
+// user agent resets it to DefaultUserAgent. Skyd rejects requests whose user
+// agent does not contain 'Sia-Agent'.
+func (c *SkydClient) ConfigureUserAgent(userAgent string) error {
+	if userAgent == "" {
+		userAgent = DefaultUserAgent()
+	}
+	if !strings.Contains(userAgent, skydUserAgent) {
+		return fmt.Errorf("invalid user agent '%v', it has to contain '%v'", userAgent, skydUserAgent)
+	}
+
+	c.staticUserAgentMu.Lock()
+	defer c.staticUserAgentMu.Unlock()
+	c.userAgent = userAgent
+	return nil
+}
+
+// ConfigureResolveCache updates the size of the cache of resolved skylinks and
+// the amount of time they are cached, it clears the cache. A size of zero
+// disables the cache.
+func (c *SkydClient) ConfigureResolveCache(size int, ttl time.Duration) error {
+	return c.staticResolveCache.managedConfigure(size, ttl)
+}
+
+// InvalidateResolveCache removes the given skylinks from the cache of resolved
+// skylinks, forcing them to be resolved by skyd again. If no skylinks are
+// given the whole cache is cleared. It returns the number of removed entries.
+func (c *SkydClient) InvalidateResolveCache(skylinks ...skymodules.Skylink) int {
+	return c.staticResolveCache.managedInvalidate(skylinks...)
+}
+
+// ResolveCacheStats returns the metrics of the cache of resolved skylinks.
+func (c *SkydClient) ResolveCacheStats() ResolveCacheStats {
+	return c.staticResolveCache.managedStats()
+}
+
+// managedPaths returns the paths of the skyd endpoints, the configured paths
+// take precedence over the paths of the detected skyd version. If the version
+// was not detected yet the default paths are returned.
+func (c *SkydClient) managedPaths() SkydPaths {
+	c.staticMu.Lock()
+	defer c.staticMu.Unlock()
+	if c.paths != nil {
+		return *c.paths
+	}
+	if c.capabilities != nil {
+		return c.capabilities.Paths
+	}
+	return DefaultSkydPaths
+}
+
+// managedUserAgent returns the user agent of the requests to skyd.
+func (c *SkydClient) managedUserAgent() string {
+	c.staticUserAgentMu.Lock()
+	defer c.staticUserAgentMu.Unlock()
+	return c.userAgent
+}
+
+// skydPathsForVersion returns the paths of the endpoints of the given skyd
+// version.
+func skydPathsForVersion(version string) SkydPaths {
+	paths := DefaultSkydPaths
+	for _, entry := range skydPathsByVersion {
+		if build.VersionCmp(version, entry.version) >= 0 {
+			paths = entry.paths
+		}
+	}
+	return paths
 }
 
 // get is a helper function that executes a GET request on the given endpoint
 // with the provided query values. The response will get unmarshaled into the
 // given response object.
 func (c *SkydClient) get(endpoint string, query url.Values, obj interface{}) error {
+	return c.getWithContext(context.Background(), endpoint, query, obj)
+}
+
+// getWithContext is the same as get, but the request is aborted when the given
+// context is cancelled.
+func (c *SkydClient) getWithContext(ctx context.Context, endpoint string, query url.Values, obj interface{}) error {
 	// create the request
 	queryString := query.Encode()
 	url := fmt.Sprintf("%s%s", c.staticPortalURL, endpoint)
@@ -207,14 +1140,13 @@ func (c *SkydClient) get(endpoint string, query url.Values, obj interface{}) err
 		url = fmt.Sprintf("%s%s?%s", c.staticPortalURL, endpoint, queryString)
 	}
 
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return errors.AddContext(err, "failed to create request")
 	}
 
-	// set headers and execute the request
-	req.Header.Set("User-Agent", "Sia-Agent")
-	res, err := http.DefaultClient.Do(req)
+	// execute the request
+	res, err := c.do(req)
 	if err != nil {
 		return err
 	}
@@ -222,7 +1154,7 @@ func (c *SkydClient) get(endpoint string, query url.Values, obj interface{}) err
 
 	// return an error if the status code is not in the 200s
 	if res.StatusCode < 200 || res.StatusCode >= 300 {
-		return fmt.Errorf("GET request to '%s' with status %d error %v", url, res.StatusCode, readAPIError(res.Body))
+		return classifySkydError(res.StatusCode, fmt.Errorf("GET request to '%s' with status %d error %v", url, res.StatusCode, readAPIError(res.Body)))
 	}
 
 	// handle the response body
@@ -236,9 +1168,15 @@ func (c *SkydClient) get(endpoint string, query url.Values, obj interface{}) err
 // post is a helper function that executes a POST request on the given endpoint
 // with the provided query values.
 func (c *SkydClient) post(endpoint string, query url.Values, body io.Reader, obj interface{}) error {
+	return c.postWithContext(context.Background(), endpoint, query, body, obj)
+}
+
+// postWithContext is the same as post, but the request is aborted when the
+// given context is cancelled.
+func (c *SkydClient) postWithContext(ctx context.Context, endpoint string, query url.Values, body io.Reader, obj interface{}) error {
 	// create the request
 	url := fmt.Sprintf("%s%s?%s", c.staticPortalURL, endpoint, query.Encode())
-	req, err := http.NewRequest(http.MethodPost, url, body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
 	if err != nil {
 		return errors.AddContext(err, "failed to create request")
 	}
@@ -247,15 +1185,20 @@ func (c *SkydClient) post(endpoint string, query url.Values, body io.Reader, obj
 	for k, v := range c.staticDefaultHeaders {
 		req.Header.Set(k, v[0])
 	}
-	res, err := http.DefaultClient.Do(req)
+	res, err := c.do(req)
 	if err != nil {
 		return err
 	}
 	defer drainAndClose(res.Body)
 
-	// return an error if the status code is not in the 200s
+	// return an error if the status code is not in the 200s, skyd might
+	// include detail about the error alongside the message, so we decode
+	// the error response into the given object as well, allowing the caller
+	// to inspect it
 	if res.StatusCode < 200 || res.StatusCode >= 300 {
-		return fmt.Errorf("POST request to '%s' with status %d error %v", url, res.StatusCode, readAPIError(res.Body))
+		errBody, _ := ioutil.ReadAll(res.Body)
+		_ = json.Unmarshal(errBody, obj)
+		return classifySkydError(res.StatusCode, fmt.Errorf("POST request to '%s' with status %d error %v", url, res.StatusCode, readAPIError(bytes.NewReader(errBody))))
 	}
 
 	// handle the response body
@@ -266,6 +1209,71 @@ func (c *SkydClient) post(endpoint string, query url.Values, body io.Reader, obj
 	return nil
 }
 
+// do executes the given request through the circuit breaker, after setting
+// the user agent and the request ID. Requests are short-circuited while the
+// circuit is open. Transport errors and server errors count as failures,
+// unless the request's context was cancelled, in which case the outcome says
+// nothing about skyd's health. Server errors are classified before they are
+// recorded, skyd responds with a server error to hashes it can't parse, which
+// is bad input rather than an unhealthy skyd.
+func (c *SkydClient) do(req *http.Request) (*http.Response, error) {
+	err := c.staticBreaker.managedAllow()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.managedUserAgent())
+	req.Header.Set(RequestIDHeader, newRequestID(req.Context()))
+	res, err := c.staticHTTPClient.Do(req)
+	if err != nil && req.Context().Err() != nil {
+		c.staticBreaker.managedRecordCancelled()
+		return nil, err
+	}
+	if err != nil {
+		c.staticBreaker.managedRecord(true)
+		return nil, err
+	}
+	if res.StatusCode < http.StatusInternalServerError {
+		c.staticBreaker.managedRecord(false)
+		return res, nil
+	}
+
+	// read the error response to classify it, the body is replaced so the
+	// caller can still read it
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil && req.Context().Err() != nil {
+		c.staticBreaker.managedRecordCancelled()
+		return nil, err
+	}
+	if err != nil {
+		c.staticBreaker.managedRecord(true)
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	c.staticBreaker.managedRecord(isSkydFailure(classifySkydError(res.StatusCode, errors.New(string(body)))))
+	return res, nil
+}
+
+// isSkydFailure returns whether the given classified error indicates skyd is
+// unhealthy, in which case it counts as a failure towards the circuit breaker.
+// Errors caused by the input, or by the blocklist being unchanged, don't.
+func isSkydFailure(err error) bool {
+	if errors.Contains(err, ErrSkydInvalidInput) || errors.Contains(err, ErrBlocklistUnchanged) {
+		return false
+	}
+	return errors.Contains(err, ErrSkydInternal)
+}
+
+// newRequestID returns a random request ID, prefixed with the ID the given
+// context carries, if any.
+func newRequestID(ctx context.Context) string {
+	id := hex.EncodeToString(fastrand.Bytes(8))
+	if prefix, ok := ctx.Value(requestIDKey{}).(string); ok && prefix != "" {
+		return fmt.Sprintf("%s-%s", prefix, id)
+	}
+	return id
+}
+
 // drainAndClose reads rc until EOF and then closes it. drainAndClose should
 // always be called on HTTP response bodies, because if the body is not fully
 // read, the underlying connection can't be reused.
@@ -274,6 +1282,30 @@ func drainAndClose(rc io.ReadCloser) {
 	rc.Close()
 }
 
+// classifySkydError adds a typed error to the given error, derived from the
+// status code and the message of skyd's error response, which allows the
+// caller to decide how to handle it. Errors that can't be classified are
+// returned as is.
+func classifySkydError(statusCode int, err error) error {
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return errors.Compose(err, ErrSkydUnauthorized)
+	case strings.Contains(err.Error(), skydNoEntriesUpdated):
+		return errors.Compose(err, ErrBlocklistUnchanged)
+	case strings.Contains(err.Error(), skydInvalidAdditions):
+		// skyd responds with a server error if it failed to parse the
+		// hashes, which is why this has to be checked first
+		return errors.Compose(err, ErrSkydInvalidInput)
+	case statusCode >= http.StatusInternalServerError:
+		return errors.Compose(err, ErrSkydInternal)
+	case statusCode == http.StatusNotFound || statusCode == http.StatusMethodNotAllowed:
+		return errors.Compose(err, ErrSkydInvalidInput, errSkydNotFound)
+	case statusCode >= http.StatusBadRequest:
+		return errors.Compose(err, ErrSkydInvalidInput)
+	}
+	return err
+}
+
 // readAPIError decodes and returns an api.Error.
 func readAPIError(r io.Reader) error {
 	var apiErr api.Error
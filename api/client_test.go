@@ -1,11 +1,30 @@
 package api
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/SkynetLabs/blocker/database"
+	"gitlab.com/NebulousLabs/errors"
 	skyapi "gitlab.com/SkynetLabs/skyd/node/api"
+	"gitlab.com/SkynetLabs/skyd/skymodules"
+	"go.sia.tech/siad/crypto"
+	"go.sia.tech/siad/types"
 )
 
 // mockPortalBlocklistResponse is a mock handler for the
@@ -56,3 +75,1548 @@ func testBlocklistGET(t *testing.T, s *httptest.Server) {
 		t.Fatal("expected at least one entry")
 	}
 }
+
+// TestBlockHashesErrors verifies skyd's error responses are classified and
+// that the block outcome is derived from them.
+func TestBlockHashesErrors(t *testing.T) {
+	t.Parallel()
+
+	hashes := []database.Hash{
+		database.HashBytes([]byte("hash_1")),
+		database.HashBytes([]byte("hash_2")),
+		database.HashBytes([]byte("hash_3")),
+	}
+	malformed := hashes[1].String()
+
+	tests := []struct {
+		name        string
+		status      int
+		message     string
+		detail      bool
+		expectedErr error
+		blocked     int
+		invalid     int
+		requests    int
+	}{
+		{
+			name:    "Unchanged",
+			status:  http.StatusInternalServerError,
+			message: "unable to update the skynet blocklist: " + skydNoEntriesUpdated,
+			blocked: 3,
+		},
+		{
+			name:    "InvalidHash",
+			status:  http.StatusInternalServerError,
+			message: "unable to update the skynet blocklist: " + skydInvalidAdditions + ": invalid hash",
+			blocked: 2,
+			invalid: 1,
+			// the hashes are split until the invalid hash is isolated
+			requests: 5,
+		},
+		{
+			name:    "InvalidHashDetail",
+			status:  http.StatusBadRequest,
+			message: "unable to update the skynet blocklist: " + skydInvalidAdditions,
+			detail:  true,
+			blocked: 2,
+			invalid: 1,
+			// the valid hashes are blocked in a single request
+			requests: 2,
+		},
+		{
+			name:        "Internal",
+			status:      http.StatusInternalServerError,
+			message:     "unable to update the skynet blocklist: renter is shutting down",
+			expectedErr: ErrSkydInternal,
+		},
+		{
+			name:        "Unauthorized",
+			status:      http.StatusUnauthorized,
+			message:     "API authentication failed.",
+			expectedErr: ErrSkydUnauthorized,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			// create a mock skyd that responds with the error, unless it's
+			// an invalid hash error and the request does not contain the
+			// malformed hash, if the test expects detail the error response
+			// lists the malformed hash
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				var req skyapi.SkynetBlocklistPOST
+				err := json.NewDecoder(r.Body).Decode(&req)
+				if err != nil {
+					skyapi.WriteError(w, skyapi.Error{Message: "invalid parameters"}, http.StatusBadRequest)
+					return
+				}
+				if test.invalid > 0 {
+					var containsMalformed bool
+					for _, add := range req.Add {
+						containsMalformed = containsMalformed || add == malformed
+					}
+					if !containsMalformed {
+						skyapi.WriteJSON(w, BlockResponse{})
+						return
+					}
+				}
+				if test.detail {
+					w.WriteHeader(test.status)
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{
+						"message":  test.message,
+						"invalids": []InvalidInput{{Input: malformed, Error: "invalid hash"}},
+					})
+					return
+				}
+				skyapi.WriteError(w, skyapi.Error{Message: test.message}, test.status)
+			}))
+			defer server.Close()
+
+			c := NewSkydClient(server.URL, "")
+			err := c.ConfigureCircuitBreaker(0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocked, invalid, err := c.BlockHashes(hashes)
+			if test.expectedErr != nil {
+				if !errors.Contains(err, test.expectedErr) {
+					t.Fatal("unexpected error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(blocked) != test.blocked || len(invalid) != test.invalid {
+				t.Fatal("unexpected outcome", blocked, invalid)
+			}
+			if test.invalid > 0 && invalid[0].String() != malformed {
+				t.Fatal("unexpected invalid hash", invalid[0])
+			}
+			if n := int(atomic.LoadInt32(&requests)); test.requests > 0 && n != test.requests {
+				t.Fatal("unexpected number of requests", n)
+			}
+		})
+	}
+}
+
+// TestBlockHashesDetailed verifies the result holds the error skyd rejected
+// every invalid hash with.
+func TestBlockHashesDetailed(t *testing.T) {
+	t.Parallel()
+
+	listed := database.HashBytes([]byte("listed"))
+	isolated := database.HashBytes([]byte("isolated"))
+	valid := database.HashBytes([]byte("valid"))
+
+	// create a mock skyd that lists the first hash as invalid and rejects
+	// the second hash without detail
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req skyapi.SkynetBlocklistPOST
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for _, add := range req.Add {
+			if add == listed.String() {
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"message":  "unable to update the skynet blocklist: " + skydInvalidAdditions,
+					"invalids": []InvalidInput{{Input: add, Error: "listed error"}},
+				})
+				return
+			}
+		}
+		for _, add := range req.Add {
+			if add == isolated.String() {
+				skyapi.WriteError(w, skyapi.Error{Message: "unable to update the skynet blocklist: " + skydInvalidAdditions}, http.StatusBadRequest)
+				return
+			}
+		}
+		skyapi.WriteJSON(w, BlockResponse{})
+	}))
+	defer server.Close()
+
+	// assert the outcome
+	c := NewSkydClient(server.URL, "")
+	res, err := c.BlockHashesDetailed(context.Background(), []database.Hash{listed, valid, isolated})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Blocked) != 1 || res.Blocked[0] != valid || len(res.Invalid) != 2 || len(res.Rejections) != 2 {
+		t.Fatal("unexpected result", res)
+	}
+	if err := res.Rejections[listed]; err == nil || err.Error() != "listed error" {
+		t.Fatal("unexpected rejection", err)
+	}
+	if err := res.Rejections[isolated]; err == nil || !strings.Contains(err.Error(), skydInvalidAdditions) {
+		t.Fatal("unexpected rejection", err)
+	}
+}
+
+// TestBlockHashesTagged verifies the tag is sent along with the hashes, that
+// it's omitted when blocking untagged and that it's truncated to its maximum
+// length.
+func TestBlockHashesTagged(t *testing.T) {
+	t.Parallel()
+
+	// create a mock skyd that records the tag of the last request
+	var mu sync.Mutex
+	var tag *string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		mu.Lock()
+		tag = nil
+		if v, ok := req["tag"].(string); ok {
+			tag = &v
+		}
+		mu.Unlock()
+		skyapi.WriteJSON(w, BlockResponse{})
+	}))
+	defer server.Close()
+	lastTag := func() *string {
+		mu.Lock()
+		defer mu.Unlock()
+		return tag
+	}
+
+	c := NewSkydClient(server.URL, "")
+	hashes := []database.Hash{database.HashBytes([]byte("tagged"))}
+
+	// assert the tag is omitted when blocking untagged
+	_, err := c.BlockHashesDetailed(context.Background(), hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lastTag(); got != nil {
+		t.Fatal("unexpected tag", *got)
+	}
+
+	// assert the tag is sent
+	_, err = c.BlockHashesTagged(context.Background(), hashes, "abuse-reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lastTag(); got == nil || *got != "abuse-reports" {
+		t.Fatal("unexpected tag", got)
+	}
+
+	// assert long tags are truncated without splitting a character
+	long := strings.Repeat("a", MaxBlockTagLength-1) + "é"
+	_, err = c.BlockHashesTagged(context.Background(), hashes, long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lastTag(); got == nil || *got != strings.Repeat("a", MaxBlockTagLength-1) {
+		t.Fatal("unexpected tag", got)
+	}
+}
+
+// TestBlockHashesWithContext verifies the context is checked between the
+// requests that isolate the invalid hashes.
+func TestBlockHashesWithContext(t *testing.T) {
+	t.Parallel()
+
+	// create a mock skyd that rejects every request as invalid input and
+	// cancels the context on the first request
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		cancel()
+		skyapi.WriteError(w, skyapi.Error{Message: "unable to update the skynet blocklist: " + skydInvalidAdditions}, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	// assert the invalid hashes are not isolated after the cancellation
+	c := NewSkydClient(server.URL, "")
+	hashes := []database.Hash{
+		database.HashBytes([]byte("hash_1")),
+		database.HashBytes([]byte("hash_2")),
+	}
+	_, _, err := c.BlockHashesWithContext(ctx, hashes)
+	if !errors.Contains(err, context.Canceled) {
+		t.Fatal("unexpected error", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatal("unexpected number of requests", n)
+	}
+}
+
+// TestBlockRegistryEntry verifies the client blocks the hash of a registry
+// entry, which is the hash skyd derives from the V2 skylink that points to the
+// entry, and that malformed keys and tweaks are rejected.
+func TestBlockRegistryEntry(t *testing.T) {
+	t.Parallel()
+
+	_, pk := crypto.GenerateKeyPair()
+	spk := types.Ed25519PublicKey(pk)
+	tweak := crypto.HashBytes([]byte("tweak"))
+
+	// assert the hash matches the hash of the V2 skylink
+	expected, err := database.HashFromSkylink(skymodules.NewSkylinkV2(spk, tweak).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := ParseRegistryEntry(spk.String(), tweak.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != expected {
+		t.Fatal("unexpected hash", hash)
+	}
+
+	// assert malformed input is rejected
+	for _, input := range [][2]string{
+		{"", tweak.String()},
+		{"ed25519:nothex", tweak.String()},
+		{types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: pk[:16]}.String(), tweak.String()},
+		{spk.String(), ""},
+		{spk.String(), "tweak"},
+	} {
+		_, err = ParseRegistryEntry(input[0], input[1])
+		if err == nil {
+			t.Fatal("expected error", input)
+		}
+	}
+
+	// create a mock skyd that captures the blocked hashes
+	var blocked []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req skyapi.SkynetBlocklistPOST
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			skyapi.WriteError(w, skyapi.Error{Message: "invalid parameters"}, http.StatusBadRequest)
+			return
+		}
+		blocked = append(blocked, req.Add...)
+		skyapi.WriteJSON(w, BlockResponse{})
+	}))
+	defer server.Close()
+
+	// assert the registry entry gets blocked
+	c := NewSkydClient(server.URL, "")
+	err = c.BlockRegistryEntry(spk.String(), tweak.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocked) != 1 || blocked[0] != expected.String() {
+		t.Fatal("unexpected blocked hashes", blocked)
+	}
+
+	// assert malformed input is not sent to skyd
+	err = c.BlockRegistryEntry(spk.String(), "tweak")
+	if err == nil || len(blocked) != 1 {
+		t.Fatal("unexpected outcome", blocked, err)
+	}
+}
+
+// TestResolveSkylinkTimeout verifies resolving a skylink is aborted when the
+// context's deadline is exceeded or when the context gets cancelled.
+func TestResolveSkylinkTimeout(t *testing.T) {
+	t.Parallel()
+
+	// create a mock skyd that takes a long time to resolve a skylink
+	release := make(chan struct{})
+	defer close(release)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		skyapi.WriteJSON(w, resolveResponse{Skylink: v1SkylinkStr})
+	}))
+	defer server.Close()
+
+	var sl skymodules.Skylink
+	err := sl.LoadString(v2SkylinkStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewSkydClient(server.URL, "")
+
+	// assert the resolution times out
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = c.ResolveSkylink(ctx, sl)
+	if !errors.Contains(err, ErrResolveTimeout) {
+		t.Fatal("unexpected error", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("resolution was not aborted", time.Since(start))
+	}
+
+	// assert cancelling the context aborts the resolution, which is not
+	// considered a timeout
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	_, err = c.ResolveSkylink(ctx, sl)
+	if err == nil || errors.Contains(err, ErrResolveTimeout) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert v1 skylinks are returned as is, without calling skyd
+	err = sl.LoadString(v1SkylinkStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := c.ResolveSkylink(ctx, sl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.String() != v1SkylinkStr {
+		t.Fatal("unexpected skylink", resolved)
+	}
+}
+
+// TestSkydCapabilities verifies the capabilities of skyd are derived from its
+// version, that they are cached and that they are probed again after skyd
+// seems to have restarted.
+func TestSkydCapabilities(t *testing.T) {
+	t.Parallel()
+
+	// create a mock skyd that reports a configurable version
+	var mu sync.Mutex
+	var probes int
+	version := "1.5.0"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path != "/daemon/version" {
+			skyapi.WriteError(w, skyapi.Error{Message: "down"}, http.StatusInternalServerError)
+			return
+		}
+		probes++
+		skyapi.WriteJSON(w, skyapi.DaemonVersion{Version: version})
+	}))
+	defer server.Close()
+	c := NewSkydClient(server.URL, "")
+
+	// assert an old skyd does not support blocking by hash
+	capabilities, err := c.Capabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capabilities.Version != "1.5.0" || capabilities.BlockByHash {
+		t.Fatal("unexpected capabilities", capabilities)
+	}
+
+	// upgrade skyd and assert the capabilities are cached
+	mu.Lock()
+	version = "1.5.9"
+	mu.Unlock()
+	capabilities, err = c.Capabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capabilities.Version != "1.5.0" || probes != 1 {
+		t.Fatal("expected capabilities to be cached", capabilities, probes)
+	}
+
+	// assert they are probed again once skyd seems to have restarted
+	if c.DaemonReady() {
+		t.Fatal("expected skyd to not be ready")
+	}
+	capabilities, err = c.Capabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capabilities.Version != "1.5.9" || !capabilities.BlockByHash || probes != 2 {
+		t.Fatal("unexpected capabilities", capabilities, probes)
+	}
+
+	// assert an invalid version is not cached
+	c.ResetCapabilities()
+	mu.Lock()
+	version = "unknown"
+	mu.Unlock()
+	_, err = c.Capabilities()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if c.capabilities != nil {
+		t.Fatal("expected failed probe to not be cached")
+	}
+}
+
+// TestSkydCapabilitiesUnlocked verifies a slow capabilities probe does not
+// block the requests that only need the paths of the skyd endpoints.
+func TestSkydCapabilitiesUnlocked(t *testing.T) {
+	t.Parallel()
+
+	// create a mock skyd that hangs on the version probe until released
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/daemon/version" {
+			<-release
+			skyapi.WriteJSON(w, skyapi.DaemonVersion{Version: "1.5.9"})
+			return
+		}
+		skyapi.WriteJSON(w, DaemonReadyResponse{Ready: true, Consensus: true, Gateway: true, Renter: true})
+	}))
+	defer server.Close()
+	c := NewSkydClient(server.URL, "")
+
+	// probe the capabilities in the background
+	probed := make(chan error)
+	go func() {
+		_, err := c.Capabilities()
+		probed <- err
+	}()
+
+	// assert skyd's readiness can be checked while the probe is in flight
+	ready := make(chan bool)
+	go func() {
+		ready <- c.DaemonReady()
+	}()
+	select {
+	case r := <-ready:
+		if !r {
+			t.Fatal("expected skyd to be ready")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("readiness check blocked by the capabilities probe")
+	}
+
+	// release the probe and assert the capabilities are cached
+	close(release)
+	if err := <-probed; err != nil {
+		t.Fatal(err)
+	}
+	c.staticMu.Lock()
+	cached := c.capabilities
+	c.staticMu.Unlock()
+	if cached == nil || cached.Version != "1.5.9" {
+		t.Fatal("expected capabilities to be cached", cached)
+	}
+}
+
+// TestSkydPaths verifies the client calls the endpoints at the paths of the
+// detected skyd version by default, and at the configured paths otherwise.
+func TestSkydPaths(t *testing.T) {
+	t.Parallel()
+
+	// create a mock skyd that records the paths it's called on
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/daemon/version":
+			skyapi.WriteJSON(w, skyapi.DaemonVersion{Version: "1.5.9"})
+		case strings.HasSuffix(r.URL.Path, "/ready"):
+			skyapi.WriteJSON(w, DaemonReadyResponse{Ready: true, Consensus: true, Gateway: true, Renter: true})
+		case strings.Contains(r.URL.Path, "/resolve/"):
+			skyapi.WriteJSON(w, resolveResponse{Skylink: v1SkylinkStr})
+		default:
+			skyapi.WriteJSON(w, BlockResponse{})
+		}
+	}))
+	defer server.Close()
+	lastPath := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return paths[len(paths)-1]
+	}
+
+	var sl skymodules.Skylink
+	err := sl.LoadString(v2SkylinkStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewSkydClient(server.URL, "")
+
+	// assert the paths of the detected version are used
+	capabilities, err := c.Capabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capabilities.Paths != DefaultSkydPaths || c.managedPaths() != DefaultSkydPaths {
+		t.Fatal("unexpected paths", capabilities.Paths)
+	}
+	if !c.DaemonReady() || lastPath() != "/daemon/ready" {
+		t.Fatal("unexpected path", lastPath())
+	}
+
+	// configure the blocklist and resolve paths and assert they are hit
+	err = c.ConfigurePaths(SkydPaths{Blocklist: "/v2/blocklist", Resolve: "/v2/resolve/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = c.BlockHashes([]database.Hash{database.HashBytes([]byte("skylink"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastPath() != "/v2/blocklist" {
+		t.Fatal("unexpected path", lastPath())
+	}
+	_, err = c.ResolveSkylink(context.Background(), sl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastPath() != "/v2/resolve/"+v2SkylinkStr {
+		t.Fatal("unexpected path", lastPath())
+	}
+
+	// assert the path that was not configured defaults to the default path
+	if !c.DaemonReady() || lastPath() != DefaultSkydPaths.Ready {
+		t.Fatal("unexpected path", lastPath())
+	}
+
+	// assert invalid paths are rejected
+	for _, path := range []string{"skynet/blocklist", "/skynet/blocklist?timeout=30", "/skynet/blocklist#add"} {
+		err = c.ConfigurePaths(SkydPaths{Blocklist: path})
+		if err == nil {
+			t.Fatal("expected error", path)
+		}
+	}
+	if c.managedPaths().Blocklist != "/v2/blocklist" {
+		t.Fatal("expected the configured paths to remain", c.managedPaths())
+	}
+}
+
+// TestSkydRequestHeaders verifies every request to skyd carries the user agent
+// and a unique request ID, that the request ID is prefixed with the ID carried
+// by the context and that the user agent can be configured.
+func TestSkydRequestHeaders(t *testing.T) {
+	t.Parallel()
+
+	// create a mock skyd that records the headers of the requests
+	var mu sync.Mutex
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Clone())
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/daemon/version":
+			skyapi.WriteJSON(w, skyapi.DaemonVersion{Version: "1.5.9"})
+		case "/daemon/ready":
+			skyapi.WriteJSON(w, DaemonReadyResponse{Ready: true, Consensus: true, Gateway: true, Renter: true})
+		default:
+			skyapi.WriteJSON(w, BlockResponse{})
+		}
+	}))
+	defer server.Close()
+	lastHeader := func() http.Header {
+		mu.Lock()
+		defer mu.Unlock()
+		return headers[len(headers)-1]
+	}
+
+	// assert GET and POST requests carry the default user agent and a request
+	// ID
+	c := NewSkydClient(server.URL, "")
+	if !c.DaemonReady() {
+		t.Fatal("expected skyd to be ready")
+	}
+	get := lastHeader()
+	if get.Get("User-Agent") != DefaultUserAgent() || !strings.Contains(DefaultUserAgent(), "Sia-Agent") {
+		t.Fatal("unexpected user agent", get.Get("User-Agent"))
+	}
+	_, err := c.BlockHashesDetailed(WithRequestID(context.Background(), "sweep"), []database.Hash{database.HashBytes([]byte("skylink"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := lastHeader()
+	if post.Get("User-Agent") != DefaultUserAgent() {
+		t.Fatal("unexpected user agent", post.Get("User-Agent"))
+	}
+
+	// assert the request IDs are unique and the ID of the context is used as
+	// prefix
+	if get.Get(RequestIDHeader) == "" || strings.Contains(get.Get(RequestIDHeader), "-") {
+		t.Fatal("unexpected request ID", get.Get(RequestIDHeader))
+	}
+	if !strings.HasPrefix(post.Get(RequestIDHeader), "sweep-") {
+		t.Fatal("unexpected request ID", post.Get(RequestIDHeader))
+	}
+	mu.Lock()
+	seen := make(map[string]struct{})
+	for _, header := range headers {
+		id := header.Get(RequestIDHeader)
+		if _, exists := seen[id]; exists {
+			t.Fatal("duplicate request ID", id)
+		}
+		seen[id] = struct{}{}
+	}
+	mu.Unlock()
+
+	// configure the user agent
+	err = c.ConfigureUserAgent("Sia-Agent custom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.DaemonReady() || lastHeader().Get("User-Agent") != "Sia-Agent custom" {
+		t.Fatal("unexpected user agent", lastHeader().Get("User-Agent"))
+	}
+
+	// assert user agents skyd would reject are rejected
+	err = c.ConfigureUserAgent("custom")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	// assert the user agent can be reset
+	err = c.ConfigureUserAgent("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.DaemonReady() || lastHeader().Get("User-Agent") != DefaultUserAgent() {
+		t.Fatal("unexpected user agent", lastHeader().Get("User-Agent"))
+	}
+}
+
+// TestSkydCircuitBreaker verifies the circuit breaker opens after the
+// configured number of consecutive failures, short-circuits calls during the
+// cooldown and closes again after a successful probe.
+func TestSkydCircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	// create a mock skyd that can be taken down
+	var mu sync.Mutex
+	var calls int
+	down := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if down {
+			skyapi.WriteError(w, skyapi.Error{Message: "down"}, http.StatusInternalServerError)
+			return
+		}
+		skyapi.WriteJSON(w, DaemonReadyResponse{
+			Ready:     true,
+			Consensus: true,
+			Gateway:   true,
+			Renter:    true,
+		})
+	}))
+	defer server.Close()
+	c := NewSkydClient(server.URL, "")
+
+	// assert invalid configurations are rejected
+	if err := c.ConfigureCircuitBreaker(-1, time.Second); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := c.ConfigureCircuitBreaker(1, 0); err == nil {
+		t.Fatal("expected error")
+	}
+	cooldown := 100 * time.Millisecond
+	err := c.ConfigureCircuitBreaker(3, cooldown)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the circuit opens after three failures
+	for i := 0; i < 3; i++ {
+		if state := c.CircuitState(); state.State != CircuitClosed || state.ConsecutiveFailures != i {
+			t.Fatal("unexpected state", state)
+		}
+		c.DaemonReady()
+	}
+	state := c.CircuitState()
+	if state.State != CircuitOpen || state.Opens != 1 || state.RetryAt.IsZero() {
+		t.Fatal("unexpected state", state)
+	}
+
+	// assert calls are short-circuited while the circuit is open
+	_, err = c.Blocklist()
+	if !errors.Contains(err, ErrCircuitOpen) {
+		t.Fatal("unexpected error", err)
+	}
+	mu.Lock()
+	if calls != 3 {
+		t.Fatal("unexpected number of calls", calls)
+	}
+	mu.Unlock()
+	if state := c.CircuitState(); state.ShortCircuited != 1 {
+		t.Fatal("unexpected state", state)
+	}
+
+	// assert a failing probe after the cooldown opens the circuit again
+	time.Sleep(cooldown)
+	if c.DaemonReady() {
+		t.Fatal("expected skyd to not be ready")
+	}
+	if state := c.CircuitState(); state.State != CircuitOpen || state.Opens != 2 {
+		t.Fatal("unexpected state", state)
+	}
+
+	// assert a successful probe closes the circuit
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	time.Sleep(cooldown)
+	if !c.DaemonReady() {
+		t.Fatal("expected skyd to be ready")
+	}
+	if state := c.CircuitState(); state.State != CircuitClosed || state.ConsecutiveFailures != 0 {
+		t.Fatal("unexpected state", state)
+	}
+
+	// assert the circuit breaker can be disabled
+	mu.Lock()
+	down = true
+	mu.Unlock()
+	err = c.ConfigureCircuitBreaker(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		c.DaemonReady()
+	}
+	if state := c.CircuitState(); state.State != CircuitClosed {
+		t.Fatal("unexpected state", state)
+	}
+}
+
+// TestSkydCircuitBreakerCancelledProbe verifies a probe whose context gets
+// cancelled neither closes nor opens the circuit, and that the next call is
+// let through as probe.
+func TestSkydCircuitBreakerCancelledProbe(t *testing.T) {
+	t.Parallel()
+
+	// create a mock skyd that fails, hangs until the test is done or
+	// succeeds
+	var mu sync.Mutex
+	mode := "down"
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		m := mode
+		mu.Unlock()
+		switch m {
+		case "down":
+			skyapi.WriteError(w, skyapi.Error{Message: "down"}, http.StatusInternalServerError)
+		case "hang":
+			<-done
+		default:
+			skyapi.WriteJSON(w, BlockResponse{})
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+	c := NewSkydClient(server.URL, "")
+	cooldown := 50 * time.Millisecond
+	err := c.ConfigureCircuitBreaker(1, cooldown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := []database.Hash{database.HashBytes([]byte("skylink"))}
+
+	// open the circuit
+	_, _ = c.BlockHashesDetailed(context.Background(), hashes)
+	if state := c.CircuitState(); state.State != CircuitOpen {
+		t.Fatal("unexpected state", state)
+	}
+
+	// let the probe hang until its context times out
+	mu.Lock()
+	mode = "hang"
+	mu.Unlock()
+	time.Sleep(cooldown)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = c.BlockHashesDetailed(ctx, hashes)
+	if err == nil || errors.Contains(err, ErrCircuitOpen) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert the circuit did not close
+	if state := c.CircuitState(); state.State != CircuitHalfOpen || state.ConsecutiveFailures != 1 {
+		t.Fatal("unexpected state", state)
+	}
+
+	// assert the next call is let through as probe and closes the circuit
+	mu.Lock()
+	mode = "up"
+	mu.Unlock()
+	_, err = c.BlockHashesDetailed(context.Background(), hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := c.CircuitState(); state.State != CircuitClosed || state.ConsecutiveFailures != 0 {
+		t.Fatal("unexpected state", state)
+	}
+}
+
+// TestSkydCircuitBreakerInvalidInput verifies the server errors skyd responds
+// with to hashes it can't parse don't count as failures, isolating a single
+// invalid hash in a large batch does not open the circuit.
+func TestSkydCircuitBreakerInvalidInput(t *testing.T) {
+	t.Parallel()
+
+	// create a mock skyd that fails to parse any batch holding the invalid
+	// hash
+	invalid := database.HashBytes([]byte("invalid"))
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		var req skyapi.SkynetBlocklistPOST
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for _, add := range req.Add {
+			if add == invalid.String() {
+				skyapi.WriteError(w, skyapi.Error{Message: "unable to update the skynet blocklist: " + skydInvalidAdditions}, http.StatusInternalServerError)
+				return
+			}
+		}
+		skyapi.WriteJSON(w, BlockResponse{})
+	}))
+	defer server.Close()
+	c := NewSkydClient(server.URL, "")
+	err := c.ConfigureCircuitBreaker(DefaultCircuitThreshold, DefaultCircuitCooldown)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// block a large batch with the invalid hash at the start
+	hashes := []database.Hash{invalid}
+	for i := 0; i < 127; i++ {
+		hashes = append(hashes, database.HashBytes([]byte(fmt.Sprintf("skylink_%d", i))))
+	}
+	res, err := c.BlockHashesDetailed(context.Background(), hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Invalid) != 1 || res.Invalid[0] != invalid || len(res.Blocked) != 127 {
+		t.Fatal("unexpected result", len(res.Invalid), len(res.Blocked))
+	}
+
+	// assert the bisection took more calls than the threshold and the
+	// circuit stayed closed
+	if n := atomic.LoadInt32(&requests); n <= DefaultCircuitThreshold {
+		t.Fatal("unexpected number of requests", n)
+	}
+	if state := c.CircuitState(); state.State != CircuitClosed || state.ConsecutiveFailures != 0 {
+		t.Fatal("unexpected state", state)
+	}
+}
+
+// TestSkydConnectionPool verifies concurrent requests to skyd don't serialize
+// on a single connection, that the connections are counted and that the pool
+// can be reconfigured.
+func TestSkydConnectionPool(t *testing.T) {
+	t.Parallel()
+
+	// create a mock skyd that only responds once all requests arrived, which
+	// requires them to be in flight at the same time, and that records the
+	// address of the connection every request arrived on
+	const numRequests = 8
+	var mu sync.Mutex
+	var arrived int
+	addrs := make(map[string]struct{})
+	barrier := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		addrs[r.RemoteAddr] = struct{}{}
+		arrived++
+		if arrived == numRequests {
+			close(barrier)
+		}
+		mu.Unlock()
+		select {
+		case <-barrier:
+		case <-time.After(5 * time.Second):
+		}
+		skyapi.WriteJSON(w, resolveResponse{Skylink: v1SkylinkStr})
+	}))
+	defer server.Close()
+	numAddrs := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(addrs)
+	}
+
+	var sl skymodules.Skylink
+	err := sl.LoadString(v2SkylinkStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewSkydClient(server.URL, "")
+	err = c.ConfigureResolveCache(0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// resolve the skylink concurrently
+	resolve := func(n int) []error {
+		var wg sync.WaitGroup
+		errs := make([]error, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = c.ResolveSkylink(context.Background(), sl)
+			}(i)
+		}
+		wg.Wait()
+		return errs
+	}
+
+	// assert the requests were sent over a connection each
+	start := time.Now()
+	for _, err := range resolve(numRequests) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if time.Since(start) >= 5*time.Second {
+		t.Fatal("requests were serialized", time.Since(start))
+	}
+	if numAddrs() != numRequests {
+		t.Fatal("unexpected number of connections", numAddrs())
+	}
+
+	// assert the connections are idle and kept for reuse
+	stats := c.ConnectionPoolStats()
+	if stats.InUse != 0 || stats.Open != numRequests || stats.MaxIdleConnsPerHost != DefaultSkydMaxIdleConnsPerHost {
+		t.Fatal("unexpected stats", stats)
+	}
+
+	// assert invalid settings are rejected
+	tests := []struct {
+		maxIdle  int
+		maxConns int
+		timeout  time.Duration
+	}{
+		{0, 0, time.Minute},
+		{1, -1, time.Minute},
+		{2, 1, time.Minute},
+		{1, 1, 0},
+	}
+	for _, test := range tests {
+		err = c.ConfigureConnectionPool(test.maxIdle, test.maxConns, test.timeout)
+		if err == nil {
+			t.Fatal("expected error", test)
+		}
+	}
+
+	// limit the pool to a single connection and assert the idle connections
+	// got closed
+	err = c.ConfigureConnectionPool(1, 1, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; c.ConnectionPoolStats().Open != 0; i++ {
+		if i == 100 {
+			t.Fatal("idle connections were not closed", c.ConnectionPoolStats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats = c.ConnectionPoolStats()
+	if stats.MaxIdleConnsPerHost != 1 || stats.MaxConnsPerHost != 1 || stats.IdleConnTimeout != "1m0s" {
+		t.Fatal("unexpected stats", stats)
+	}
+
+	// assert concurrent requests now share a single connection
+	mu.Lock()
+	addrs = make(map[string]struct{})
+	mu.Unlock()
+	for _, err := range resolve(2) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if numAddrs() != 1 {
+		t.Fatal("unexpected number of connections", numAddrs())
+	}
+}
+
+// TestResolveCache verifies resolved V2 skylinks are cached, that the cache
+// entries expire and that the cache can be invalidated.
+func TestResolveCache(t *testing.T) {
+	t.Parallel()
+
+	// create a mock skyd that counts the resolutions
+	var mu sync.Mutex
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		skyapi.WriteJSON(w, resolveResponse{Skylink: v1SkylinkStr})
+	}))
+	defer server.Close()
+	callCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+
+	var sl skymodules.Skylink
+	err := sl.LoadString(v2SkylinkStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewSkydClient(server.URL, "")
+
+	// assert invalid configurations are rejected
+	if err := c.ConfigureResolveCache(-1, time.Second); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := c.ConfigureResolveCache(1, 0); err == nil {
+		t.Fatal("expected error")
+	}
+	ttl := 100 * time.Millisecond
+	err = c.ConfigureResolveCache(10, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the second resolution hits the cache
+	for i := 0; i < 2; i++ {
+		resolved, err := c.ResolveSkylink(context.Background(), sl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolved.String() != v1SkylinkStr {
+			t.Fatal("unexpected skylink", resolved)
+		}
+	}
+	if callCount() != 1 {
+		t.Fatal("unexpected number of calls", callCount())
+	}
+	stats := c.ResolveCacheStats()
+	if stats.Size != 1 || stats.Hits != 1 || stats.Misses != 1 || stats.HitRate != 0.5 {
+		t.Fatal("unexpected stats", stats)
+	}
+
+	// assert the entry expires
+	time.Sleep(ttl)
+	_, err = c.ResolveSkylink(context.Background(), sl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if callCount() != 2 {
+		t.Fatal("unexpected number of calls", callCount())
+	}
+
+	// assert the entry can be invalidated
+	if removed := c.InvalidateResolveCache(sl); removed != 1 {
+		t.Fatal("unexpected number of removed entries", removed)
+	}
+	_, err = c.ResolveSkylink(context.Background(), sl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if callCount() != 3 {
+		t.Fatal("unexpected number of calls", callCount())
+	}
+	if removed := c.InvalidateResolveCache(); removed != 1 {
+		t.Fatal("unexpected number of removed entries", removed)
+	}
+
+	// assert the least recently used entry is evicted
+	err = c.ConfigureResolveCache(1, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v1 skymodules.Skylink
+	err = v1.LoadString(v1SkylinkStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.staticResolveCache.managedAdd(v1, v1)
+	c.staticResolveCache.managedAdd(sl, v1)
+	if _, cached := c.staticResolveCache.managedGet(v1); cached {
+		t.Fatal("expected entry to be evicted")
+	}
+	if _, cached := c.staticResolveCache.managedGet(sl); !cached {
+		t.Fatal("expected entry to be cached")
+	}
+
+	// assert the cache can be disabled
+	err = c.ConfigureResolveCache(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err = c.ResolveSkylink(context.Background(), sl)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if callCount() != 5 {
+		t.Fatal("unexpected number of calls", callCount())
+	}
+}
+
+// TestResolveSkylinks verifies skylinks are resolved in a single request, that
+// skylinks skyd failed to resolve are omitted and that skyd not supporting
+// batches is detected and remembered until the capabilities are reset.
+func TestResolveSkylinks(t *testing.T) {
+	t.Parallel()
+
+	// create two V2 skylinks, skyd only resolves the first one
+	_, pk := crypto.GenerateKeyPair()
+	spk := types.Ed25519PublicKey(pk)
+	resolvable := skymodules.NewSkylinkV2(spk, crypto.HashBytes([]byte("resolvable")))
+	unresolvable := skymodules.NewSkylinkV2(spk, crypto.HashBytes([]byte("unresolvable")))
+	var v1 skymodules.Skylink
+	err := v1.LoadString(v1SkylinkStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// create a mock skyd that counts the batches, it supports batches
+	// depending on the flag
+	var mu sync.Mutex
+	var batches int
+	supported := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		batches++
+		if !supported {
+			skyapi.WriteError(w, skyapi.Error{Message: "404 page not found"}, http.StatusNotFound)
+			return
+		}
+		var req resolveBatchRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			skyapi.WriteError(w, skyapi.Error{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		resp := resolveBatchResponse{Skylinks: make(map[string]string)}
+		for _, sl := range req.Skylinks {
+			if sl == resolvable.String() {
+				resp.Skylinks[sl] = v1SkylinkStr
+			}
+		}
+		skyapi.WriteJSON(w, resp)
+	}))
+	defer server.Close()
+	batchCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return batches
+	}
+	c := NewSkydClient(server.URL, "")
+
+	// assert V1 skylinks resolve to themselves and the unresolvable skylink
+	// is omitted
+	resolved, err := c.ResolveSkylinks(context.Background(), []skymodules.Skylink{v1, resolvable, unresolvable})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resolved) != 2 || resolved[v1.String()] != v1 || resolved[resolvable.String()] != v1 {
+		t.Fatal("unexpected resolutions", resolved)
+	}
+	if batchCount() != 1 {
+		t.Fatal("unexpected number of batches", batchCount())
+	}
+
+	// assert resolved skylinks are cached and no batch is sent if there's
+	// nothing left to resolve
+	resolved, err = c.ResolveSkylinks(context.Background(), []skymodules.Skylink{v1, resolvable})
+	if err != nil || len(resolved) != 2 {
+		t.Fatal("unexpected outcome", resolved, err)
+	}
+	if batchCount() != 1 {
+		t.Fatal("unexpected number of batches", batchCount())
+	}
+
+	// make skyd not support batches, assert it's detected and remembered
+	mu.Lock()
+	supported = false
+	mu.Unlock()
+	for i := 0; i < 2; i++ {
+		_, err = c.ResolveSkylinks(context.Background(), []skymodules.Skylink{unresolvable})
+		if !errors.Contains(err, ErrBatchResolveUnsupported) {
+			t.Fatal("unexpected error", err)
+		}
+	}
+	if batchCount() != 2 {
+		t.Fatal("unexpected number of batches", batchCount())
+	}
+
+	// assert skyd is probed again after resetting the capabilities
+	c.ResetCapabilities()
+	_, err = c.ResolveSkylinks(context.Background(), []skymodules.Skylink{unresolvable})
+	if !errors.Contains(err, ErrBatchResolveUnsupported) {
+		t.Fatal("unexpected error", err)
+	}
+	if batchCount() != 3 {
+		t.Fatal("unexpected number of batches", batchCount())
+	}
+}
+
+// TestSkylinkMetadata verifies the metadata of a skylink is derived from
+// skyd's metadata response.
+func TestSkylinkMetadata(t *testing.T) {
+	t.Parallel()
+
+	// create a mock skyd that returns the metadata of a single file and a
+	// directory with a default path
+	var sl skymodules.Skylink
+	err := sl.LoadString(v1SkylinkStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	dir := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path != "/skynet/metadata/"+v1SkylinkStr {
+			skyapi.WriteError(w, skyapi.Error{Message: "not found"}, http.StatusNotFound)
+			return
+		}
+		sm := skymodules.SkyfileMetadata{
+			Filename: "file.png",
+			Length:   64,
+			Subfiles: skymodules.SkyfileSubfiles{
+				"file.png": {Filename: "file.png", ContentType: "image/png", Len: 64},
+			},
+		}
+		if dir {
+			sm.Filename = "dir"
+			sm.DefaultPath = "/index.html"
+			sm.Subfiles["index.html"] = skymodules.SkyfileSubfileMetadata{Filename: "index.html", ContentType: "text/html"}
+		}
+		skyapi.WriteJSON(w, sm)
+	}))
+	defer server.Close()
+	c := NewSkydClient(server.URL, "")
+
+	// assert the metadata of a single file
+	metadata, err := c.SkylinkMetadata(context.Background(), sl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata != (SkylinkMetadata{ContentType: "image/png", Filename: "file.png", Length: 64}) {
+		t.Fatal("unexpected metadata", metadata)
+	}
+
+	// assert the content type of a directory is the one of its default path
+	mu.Lock()
+	dir = true
+	mu.Unlock()
+	metadata, err = c.SkylinkMetadata(context.Background(), sl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.ContentType != "text/html" || metadata.Filename != "dir" {
+		t.Fatal("unexpected metadata", metadata)
+	}
+
+	// assert the fetch is time-bounded
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.SkylinkMetadata(ctx, sl)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// TestManifestSkylinks verifies the skylinks referenced by a skapp's manifest
+// are returned without references to the skapp itself, that their number is
+// capped and that skylinks without a manifest are recognized.
+func TestManifestSkylinks(t *testing.T) {
+	t.Parallel()
+
+	// create a mock skyd that serves a manifest
+	var sl skymodules.Skylink
+	err := sl.LoadString(v1SkylinkStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	manifest := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path != fmt.Sprintf("/skynet/skylink/%s/%s", v1SkylinkStr, ManifestFilename) || manifest == "" {
+			skyapi.WriteError(w, skyapi.Error{Message: "not found"}, http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(manifest))
+	}))
+	defer server.Close()
+	c := NewSkydClient(server.URL, "")
+	setManifest := func(m string) {
+		mu.Lock()
+		manifest = m
+		mu.Unlock()
+	}
+
+	// assert a skylink without manifest is recognized
+	_, err = c.ManifestSkylinks(context.Background(), sl)
+	if !errors.Contains(err, ErrNoManifest) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert a manifest that is not JSON is treated as missing
+	setManifest("<html></html>")
+	_, err = c.ManifestSkylinks(context.Background(), sl)
+	if !errors.Contains(err, ErrNoManifest) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert the referenced skylinks are returned, without the skapp itself
+	// and without duplicates
+	setManifest(fmt.Sprintf(`{
+		"name": "skapp",
+		"start_url": "sia://%[1]s/index.html",
+		"icons": [
+			{"src": "https://siasky.net/%[2]s/icon.png"},
+			{"src": "https://siasky.net/%[2]s/icon.png"},
+			{"src": "/%[3]s"}
+		]
+	}`, v1SkylinkStr, v2SkylinkStr, manifestRefSkylinkStr))
+	skylinks, err := c.ManifestSkylinks(context.Background(), sl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skylinks) != 2 || skylinks[0] != v2SkylinkStr || skylinks[1] != manifestRefSkylinkStr {
+		t.Fatal("unexpected skylinks", skylinks)
+	}
+
+	// assert the number of skylinks is capped
+	refs := make([]string, MaxManifestSkylinks+1)
+	for i := range refs {
+		ref, err := skymodules.NewSkylinkV1(crypto.HashObject(i), 0, 4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs[i] = ref.String()
+	}
+	b, err := json.Marshal(map[string][]string{"skylinks": refs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setManifest(string(b))
+	skylinks, err = c.ManifestSkylinks(context.Background(), sl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skylinks) != MaxManifestSkylinks || skylinks[0] != refs[0] {
+		t.Fatal("unexpected skylinks", len(skylinks))
+	}
+
+	// assert manifests that exceed the maximum size are rejected
+	setManifest(fmt.Sprintf(`{"name":"%s"}`, strings.Repeat("a", maxManifestSize)))
+	_, err = c.ManifestSkylinks(context.Background(), sl)
+	if err == nil || errors.Contains(err, ErrNoManifest) {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+// TestSkydClientTLS verifies the client can talk to skyd over mutual TLS and
+// that it presents its client certificate.
+func TestSkydClientTLS(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// create a client certificate
+	clientCert, err := newTestCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert.Leaf)
+
+	// create a TLS server that requires a client certificate
+	mux := http.NewServeMux()
+	mux.HandleFunc("/daemon/ready", func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			skyapi.WriteError(w, skyapi.Error{Message: "no client certificate"}, http.StatusUnauthorized)
+			return
+		}
+		skyapi.WriteJSON(w, DaemonReadyResponse{
+			Ready:     true,
+			Consensus: true,
+			Gateway:   true,
+			Renter:    true,
+		})
+	})
+	server := httptest.NewUnstartedServer(mux)
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	// trust the server's certificate
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+
+	// assert a client that does not present a certificate fails
+	c := NewSkydClientWithTLS(server.URL, "", &tls.Config{RootCAs: rootCAs})
+	if c.DaemonReady() {
+		t.Fatal("expected the request without client certificate to fail")
+	}
+
+	// assert a client that presents its certificate succeeds
+	c = NewSkydClientWithTLS(server.URL, "", &tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      rootCAs,
+	})
+	if !c.DaemonReady() {
+		t.Fatal("expected the request with client certificate to succeed")
+	}
+
+	// assert a plain client does not trust the server
+	c = NewSkydClient(server.URL, "")
+	if c.DaemonReady() {
+		t.Fatal("expected the request from a plain client to fail")
+	}
+}
+
+// newTestCertificate returns a self-signed certificate that can be used as a
+// client certificate in tests.
+func newTestCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "blocker"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+)
+
+const (
+	// DefaultSkydMaxIdleConnsPerHost is the default number of idle
+	// connections to skyd that are kept for reuse. The default of the
+	// standard library is two, which makes concurrent callers, e.g. a sweep
+	// and the API handlers, dial a new connection for nearly every request.
+	DefaultSkydMaxIdleConnsPerHost = 16
+
+	// DefaultSkydMaxConnsPerHost is the default limit on the number of
+	// connections to skyd, zero means there's no limit.
+	DefaultSkydMaxConnsPerHost = 0
+
+	// DefaultSkydIdleConnTimeout is the default amount of time an idle
+	// connection to skyd is kept before it's closed.
+	DefaultSkydIdleConnTimeout = 90 * time.Second
+)
+
+type (
+	// ConnectionPoolStats contains the metrics of the pool of connections to
+	// skyd. InUse is the number of requests that currently hold a connection,
+	// Open is the number of connections that are open, including idle ones.
+	ConnectionPoolStats struct {
+		InUse               int64  `json:"inuse"`
+		Open                int64  `json:"open"`
+		MaxIdleConnsPerHost int    `json:"maxidleconnsperhost"`
+		MaxConnsPerHost     int    `json:"maxconnsperhost"`
+		IdleConnTimeout     string `json:"idleconntimeout"`
+	}
+
+	// connPool is the transport of the skyd client, it wraps an
+	// http.Transport whose pool settings can be changed after the client was
+	// created and counts the connections that are open and in use.
+	connPool struct {
+		inUse int64
+		open  int64
+
+		maxConnsPerHost     int
+		maxIdleConnsPerHost int
+		idleConnTimeout     time.Duration
+		transport           *http.Transport
+
+		staticDialer    *net.Dialer
+		staticMu        sync.Mutex
+		staticTLSConfig *tls.Config
+	}
+
+	// countedConn is a connection that decrements the number of open
+	// connections of its pool when it's closed.
+	countedConn struct {
+		net.Conn
+		staticCloseOnce sync.Once
+		staticPool      *connPool
+	}
+
+	// countedBody is a response body that decrements the number of
+	// connections in use of its pool when it's closed.
+	countedBody struct {
+		io.ReadCloser
+		staticCloseOnce sync.Once
+		staticPool      *connPool
+	}
+)
+
+// newConnPool returns a connection pool with the default settings that uses
+// the given TLS config, which may be nil.
+func newConnPool(tlsConfig *tls.Config) *connPool {
+	cp := &connPool{
+		maxConnsPerHost:     DefaultSkydMaxConnsPerHost,
+		maxIdleConnsPerHost: DefaultSkydMaxIdleConnsPerHost,
+		idleConnTimeout:     DefaultSkydIdleConnTimeout,
+
+		staticDialer: &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		},
+		staticTLSConfig: tlsConfig,
+	}
+	cp.transport = cp.newTransport()
+	return cp
+}
+
+// RoundTrip implements the http.RoundTripper interface. The request counts as
+// holding a connection until its response body is closed.
+func (cp *connPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	cp.staticMu.Lock()
+	transport := cp.transport
+	cp.staticMu.Unlock()
+
+	atomic.AddInt64(&cp.inUse, 1)
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		atomic.AddInt64(&cp.inUse, -1)
+		return nil, err
+	}
+	res.Body = &countedBody{ReadCloser: res.Body, staticPool: cp}
+	return res, nil
+}
+
+// managedConfigure updates the settings of the pool. The connections of the
+// previous settings are closed once they become idle.
+func (cp *connPool) managedConfigure(maxIdleConnsPerHost, maxConnsPerHost int, idleConnTimeout time.Duration) error {
+	if maxIdleConnsPerHost < 1 {
+		return errors.New("max idle connections per host has to be positive")
+	}
+	if maxConnsPerHost < 0 {
+		return errors.New("max connections per host can't be negative")
+	}
+	if maxConnsPerHost > 0 && maxIdleConnsPerHost > maxConnsPerHost {
+		return errors.New("max idle connections per host can't exceed the max connections per host")
+	}
+	if idleConnTimeout <= 0 {
+		return errors.New("idle connection timeout has to be positive")
+	}
+
+	cp.staticMu.Lock()
+	defer cp.staticMu.Unlock()
+	cp.maxConnsPerHost = maxConnsPerHost
+	cp.maxIdleConnsPerHost = maxIdleConnsPerHost
+	cp.idleConnTimeout = idleConnTimeout
+	old := cp.transport
+	cp.transport = cp.newTransport()
+	old.CloseIdleConnections()
+	return nil
+}
+
+// managedStats returns the metrics of the pool.
+func (cp *connPool) managedStats() ConnectionPoolStats {
+	cp.staticMu.Lock()
+	defer cp.staticMu.Unlock()
+	return ConnectionPoolStats{
+		InUse:               atomic.LoadInt64(&cp.inUse),
+		Open:                atomic.LoadInt64(&cp.open),
+		MaxIdleConnsPerHost: cp.maxIdleConnsPerHost,
+		MaxConnsPerHost:     cp.maxConnsPerHost,
+		IdleConnTimeout:     cp.idleConnTimeout.String(),
+	}
+}
+
+// newTransport returns a transport with the current settings of the pool, it
+// has to be called with the mutex held.
+func (cp *connPool) newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = cp.dialContext
+	transport.TLSClientConfig = cp.staticTLSConfig
+	transport.MaxConnsPerHost = cp.maxConnsPerHost
+	transport.MaxIdleConnsPerHost = cp.maxIdleConnsPerHost
+	transport.IdleConnTimeout = cp.idleConnTimeout
+	// all requests go to skyd, so the total number of idle connections is
+	// bound by the number per host
+	transport.MaxIdleConns = cp.maxIdleConnsPerHost
+	return transport
+}
+
+// dialContext dials a new connection and counts it as open until it's
+// closed.
+func (cp *connPool) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := cp.staticDialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&cp.open, 1)
+	return &countedConn{Conn: conn, staticPool: cp}, nil
+}
+
+// Close implements the net.Conn interface.
+func (cc *countedConn) Close() error {
+	cc.staticCloseOnce.Do(func() {
+		atomic.AddInt64(&cc.staticPool.open, -1)
+	})
+	return cc.Conn.Close()
+}
+
+// Close implements the io.Closer interface.
+func (cb *countedBody) Close() error {
+	cb.staticCloseOnce.Do(func() {
+		atomic.AddInt64(&cb.staticPool.inUse, -1)
+	})
+	return cb.ReadCloser.Close()
+}
@@ -0,0 +1,387 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/SkynetLabs/blocker/database"
+	"gitlab.com/NebulousLabs/errors"
+	"go.sia.tech/siad/crypto"
+)
+
+const (
+	// FormatBinary is the value of the 'format' parameter of the /blocklist
+	// endpoint that requests the binary export.
+	FormatBinary = "binary"
+
+	// FormatSkyd is the value of the 'format' parameter of the /blocklist
+	// endpoint that requests the export in the format of skyd's blocklist
+	// persist file.
+	FormatSkyd = "skyd"
+
+	// SkydBlocklistFilename is the name of skyd's blocklist persist file, the
+	// skyd export has to be stored under this name in skyd's renter
+	// directory.
+	SkydBlocklistFilename = "skynetblocklist.dat"
+
+	// BinaryBlocklistVersion is the schema version of the binary export.
+	BinaryBlocklistVersion = 1
+
+	// binaryBlocklistContentType is the content type of the binary export.
+	binaryBlocklistContentType = "application/octet-stream"
+
+	// binaryBlocklistHeaderSize is the size of the header of the binary
+	// export, it consists of the magic, the schema version, the flags and
+	// the number of hashes.
+	binaryBlocklistHeaderSize = 4 + 2 + 2 + 8
+
+	// binaryBlocklistTrailerSize is the size of the trailer of the binary
+	// export, it holds the CRC32 checksum of the header and the hashes.
+	binaryBlocklistTrailerSize = 4
+
+	// binaryBlocklistSignatureSize is the size of the signature that follows
+	// the trailer of a signed binary export.
+	binaryBlocklistSignatureSize = crypto.SignatureSize
+
+	// binaryBlocklistFlagSigned is set in the flags of the header if the
+	// export is signed.
+	binaryBlocklistFlagSigned = 1 << 0
+
+	// skydBlocklistMetadataSize is the size of the metadata page of skyd's
+	// blocklist persist file, it holds the header, the version and the
+	// length of the file and is padded with zeros.
+	skydBlocklistMetadataSize = 4096
+
+	// skydBlocklistEntrySize is the size of an entry of skyd's blocklist
+	// persist file, it consists of the hash and a flag that indicates
+	// whether the hash is blocked or unblocked.
+	skydBlocklistEntrySize = crypto.HashSize + 1
+)
+
+var (
+	// ErrBinaryBlocklistCorrupt is returned when the binary export is
+	// truncated or its checksum does not match.
+	ErrBinaryBlocklistCorrupt = errors.New("binary blocklist is corrupt")
+
+	// ErrBinaryBlocklistSignature is returned when the binary export is
+	// expected to be signed by a certain key but it is unsigned or the
+	// signature is invalid.
+	ErrBinaryBlocklistSignature = errors.New("binary blocklist signature verification failed")
+
+	// binaryBlocklistMagic identifies the binary export.
+	binaryBlocklistMagic = []byte("SKBL")
+
+	// skydBlocklistHeader and skydBlocklistVersion are the header and the
+	// version skyd expects in the metadata of its blocklist persist file,
+	// they are 16 byte specifiers padded with zeros.
+	skydBlocklistHeader  = []byte("SkynetBlocklist\n")
+	skydBlocklistVersion = []byte("v1.5.1\n")
+)
+
+type (
+	// BinaryBlocklistWriter writes the binary export of a blocklist. The
+	// export consists of a fixed size header, followed by the raw bytes of
+	// the hashes and a trailer that holds a CRC32 checksum. The number of
+	// hashes is part of the header, which allows the reader to detect a
+	// truncated export. A signed export is followed by an ed25519 signature
+	// of the hash of everything that precedes it.
+	BinaryBlocklistWriter struct {
+		count   uint64
+		crc     hash.Hash32
+		hasher  hash.Hash
+		sk      *crypto.SecretKey
+		w       io.Writer
+		written uint64
+	}
+
+	// SkydBlocklistWriter writes a blocklist in the format of skyd's
+	// blocklist persist file, which allows seeding a skyd without having to
+	// block every hash through its API. The file consists of a metadata page
+	// that holds the length of the file, followed by an entry for every
+	// hash.
+	SkydBlocklistWriter struct {
+		count   uint64
+		w       io.Writer
+		written uint64
+	}
+
+	// BinaryBlocklistReader reads the binary export of a blocklist.
+	BinaryBlocklistReader struct {
+		count  uint64
+		crc    hash.Hash32
+		hasher hash.Hash
+		pk     *crypto.PublicKey
+		r      io.Reader
+		read   uint64
+		signed bool
+	}
+)
+
+// BinaryBlocklistSize returns the size of the binary export of a blocklist
+// with the given number of hashes.
+func BinaryBlocklistSize(count uint64, signed bool) uint64 {
+	size := binaryBlocklistHeaderSize + count*crypto.HashSize + binaryBlocklistTrailerSize
+	if signed {
+		size += binaryBlocklistSignatureSize
+	}
+	return size
+}
+
+// NewBinaryBlocklistWriter writes the header of a binary export of the given
+// number of hashes to the given writer, and returns a writer for the hashes.
+func NewBinaryBlocklistWriter(w io.Writer, count uint64) (*BinaryBlocklistWriter, error) {
+	return newBinaryBlocklistWriter(w, count, nil)
+}
+
+// NewSignedBinaryBlocklistWriter is like NewBinaryBlocklistWriter but the
+// export gets signed with the given key when the writer is closed.
+func NewSignedBinaryBlocklistWriter(w io.Writer, count uint64, sk crypto.SecretKey) (*BinaryBlocklistWriter, error) {
+	return newBinaryBlocklistWriter(w, count, &sk)
+}
+
+// newBinaryBlocklistWriter writes the header of a binary export and returns a
+// writer for the hashes, if a key is given the export is signed.
+func newBinaryBlocklistWriter(w io.Writer, count uint64, sk *crypto.SecretKey) (*BinaryBlocklistWriter, error) {
+	bw := &BinaryBlocklistWriter{
+		count:  count,
+		crc:    crc32.NewIEEE(),
+		hasher: crypto.NewHash(),
+		sk:     sk,
+		w:      w,
+	}
+	var flags uint16
+	if sk != nil {
+		flags |= binaryBlocklistFlagSigned
+	}
+	header := make([]byte, binaryBlocklistHeaderSize)
+	copy(header, binaryBlocklistMagic)
+	binary.BigEndian.PutUint16(header[4:], BinaryBlocklistVersion)
+	binary.BigEndian.PutUint16(header[6:], flags)
+	binary.BigEndian.PutUint64(header[8:], count)
+	err := bw.write(header)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to write header")
+	}
+	return bw, nil
+}
+
+// WriteHash writes the given hash.
+func (bw *BinaryBlocklistWriter) WriteHash(h database.Hash) error {
+	if bw.written == bw.count {
+		return fmt.Errorf("can't write more than the %d hashes announced in the header", bw.count)
+	}
+	err := bw.write(h.Hash[:])
+	if err != nil {
+		return err
+	}
+	bw.written++
+	return nil
+}
+
+// Close writes the trailer and the signature, if the export is signed. It
+// returns an error if fewer hashes were written than announced in the header.
+// It does not close the underlying writer.
+func (bw *BinaryBlocklistWriter) Close() error {
+	if bw.written != bw.count {
+		return fmt.Errorf("wrote %d hashes but announced %d in the header", bw.written, bw.count)
+	}
+	trailer := make([]byte, binaryBlocklistTrailerSize)
+	binary.BigEndian.PutUint32(trailer, bw.crc.Sum32())
+	err := bw.write(trailer)
+	if err != nil || bw.sk == nil {
+		return err
+	}
+	sig := crypto.SignHash(sumHash(bw.hasher), *bw.sk)
+	_, err = bw.w.Write(sig[:])
+	return err
+}
+
+// write writes the given bytes and adds them to the checksum and the hash.
+func (bw *BinaryBlocklistWriter) write(b []byte) error {
+	_, err := bw.w.Write(b)
+	if err != nil {
+		return err
+	}
+	_, err = bw.crc.Write(b)
+	if err != nil {
+		return err
+	}
+	_, err = bw.hasher.Write(b)
+	return err
+}
+
+// NewBinaryBlocklistReader reads and validates the header of a binary export
+// from the given reader, and returns a reader for the hashes. The signature of
+// signed exports is not verified.
+func NewBinaryBlocklistReader(r io.Reader) (*BinaryBlocklistReader, error) {
+	return newBinaryBlocklistReader(r, nil)
+}
+
+// NewVerifiedBinaryBlocklistReader is like NewBinaryBlocklistReader but the
+// export has to be signed by the given key. The signature can only be
+// verified once all hashes are read, so the caller must not act on the hashes
+// before Next returned io.EOF.
+func NewVerifiedBinaryBlocklistReader(r io.Reader, pk crypto.PublicKey) (*BinaryBlocklistReader, error) {
+	return newBinaryBlocklistReader(r, &pk)
+}
+
+// newBinaryBlocklistReader reads and validates the header of a binary export
+// and returns a reader for the hashes, if a key is given the export has to be
+// signed by that key.
+func newBinaryBlocklistReader(r io.Reader, pk *crypto.PublicKey) (*BinaryBlocklistReader, error) {
+	br := &BinaryBlocklistReader{
+		crc:    crc32.NewIEEE(),
+		hasher: crypto.NewHash(),
+		pk:     pk,
+		r:      bufio.NewReader(r),
+	}
+	header := make([]byte, binaryBlocklistHeaderSize)
+	err := br.readFull(header)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to read header")
+	}
+	if !bytes.Equal(header[:4], binaryBlocklistMagic) {
+		return nil, errors.New("not a binary blocklist")
+	}
+	if version := binary.BigEndian.Uint16(header[4:]); version != BinaryBlocklistVersion {
+		return nil, fmt.Errorf("unsupported binary blocklist version %d", version)
+	}
+	br.signed = binary.BigEndian.Uint16(header[6:])&binaryBlocklistFlagSigned != 0
+	br.count = binary.BigEndian.Uint64(header[8:])
+	if pk != nil && !br.signed {
+		return nil, errors.AddContext(ErrBinaryBlocklistSignature, "binary blocklist is not signed")
+	}
+	return br, nil
+}
+
+// Count returns the number of hashes announced in the header.
+func (br *BinaryBlocklistReader) Count() uint64 {
+	return br.count
+}
+
+// Next returns the next hash. After the last hash it verifies the checksum,
+// and the signature if the reader was created with a key, and returns io.EOF.
+// If the export is truncated, or the checksum does not match, the returned
+// error contains ErrBinaryBlocklistCorrupt. If the signature is invalid the
+// returned error contains ErrBinaryBlocklistSignature.
+func (br *BinaryBlocklistReader) Next() (database.Hash, error) {
+	if br.read == br.count {
+		return database.Hash{}, br.readTrailer()
+	}
+
+	var h database.Hash
+	err := br.readFull(h.Hash[:])
+	if err != nil {
+		return database.Hash{}, err
+	}
+	br.read++
+	return h, nil
+}
+
+// readTrailer reads the trailer and the signature of a signed export, it
+// returns io.EOF if the export is valid.
+func (br *BinaryBlocklistReader) readTrailer() error {
+	trailer := make([]byte, binaryBlocklistTrailerSize)
+	_, err := io.ReadFull(br.r, trailer)
+	if err != nil {
+		return errors.Compose(err, ErrBinaryBlocklistCorrupt)
+	}
+	if binary.BigEndian.Uint32(trailer) != br.crc.Sum32() {
+		return errors.AddContext(ErrBinaryBlocklistCorrupt, "checksum mismatch")
+	}
+	if !br.signed {
+		return io.EOF
+	}
+
+	// read the signature, the trailer is part of the signed content
+	_, err = br.hasher.Write(trailer)
+	if err != nil {
+		return err
+	}
+	var sig crypto.Signature
+	_, err = io.ReadFull(br.r, sig[:])
+	if err != nil {
+		return errors.Compose(err, ErrBinaryBlocklistCorrupt)
+	}
+	if br.pk != nil && crypto.VerifyHash(sumHash(br.hasher), *br.pk, sig) != nil {
+		return ErrBinaryBlocklistSignature
+	}
+	return io.EOF
+}
+
+// readFull fills the given buffer and adds its bytes to the checksum and the
+// hash.
+func (br *BinaryBlocklistReader) readFull(b []byte) error {
+	_, err := io.ReadFull(br.r, b)
+	if errors.Contains(err, io.EOF) || errors.Contains(err, io.ErrUnexpectedEOF) {
+		return errors.Compose(err, ErrBinaryBlocklistCorrupt)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = br.crc.Write(b)
+	if err != nil {
+		return err
+	}
+	_, err = br.hasher.Write(b)
+	return err
+}
+
+// sumHash returns the sum of the given hasher as a crypto.Hash.
+func sumHash(hasher hash.Hash) (h crypto.Hash) {
+	copy(h[:], hasher.Sum(nil))
+	return
+}
+
+// SkydBlocklistSize returns the size of skyd's blocklist persist file that
+// holds the given number of hashes.
+func SkydBlocklistSize(count uint64) uint64 {
+	return skydBlocklistMetadataSize + count*skydBlocklistEntrySize
+}
+
+// NewSkydBlocklistWriter writes the metadata of skyd's blocklist persist file
+// holding the given number of hashes to the given writer, and returns a writer
+// for the hashes. The length of the file is part of the metadata, so the
+// number of hashes has to be known upfront.
+func NewSkydBlocklistWriter(w io.Writer, count uint64) (*SkydBlocklistWriter, error) {
+	metadata := make([]byte, skydBlocklistMetadataSize)
+	copy(metadata, skydBlocklistHeader)
+	copy(metadata[16:], skydBlocklistVersion)
+	binary.LittleEndian.PutUint64(metadata[32:], SkydBlocklistSize(count))
+	_, err := w.Write(metadata)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to write metadata")
+	}
+	return &SkydBlocklistWriter{count: count, w: w}, nil
+}
+
+// WriteHash writes the given hash as blocked.
+func (sw *SkydBlocklistWriter) WriteHash(h database.Hash) error {
+	if sw.written == sw.count {
+		return fmt.Errorf("can't write more than the %d hashes announced in the metadata", sw.count)
+	}
+	entry := make([]byte, skydBlocklistEntrySize)
+	copy(entry, h.Hash[:])
+	entry[crypto.HashSize] = 1
+	_, err := sw.w.Write(entry)
+	if err != nil {
+		return err
+	}
+	sw.written++
+	return nil
+}
+
+// Close returns an error if fewer hashes were written than announced in the
+// metadata, skyd would otherwise read past the end of the file. It does not
+// close the underlying writer.
+func (sw *SkydBlocklistWriter) Close() error {
+	if sw.written != sw.count {
+		return fmt.Errorf("wrote %d hashes but announced %d in the metadata", sw.written, sw.count)
+	}
+	return nil
+}
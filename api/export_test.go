@@ -0,0 +1,381 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SkynetLabs/blocker/database"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/SkynetLabs/skyd/skymodules/renter/skynetblocklist"
+	"go.sia.tech/siad/crypto"
+)
+
+// TestBinaryBlocklist verifies the binary export can be written and read back,
+// and that truncated or corrupt exports are detected.
+func TestBinaryBlocklist(t *testing.T) {
+	t.Parallel()
+
+	hashes := []database.Hash{
+		database.HashBytes([]byte("skylink_1")),
+		database.HashBytes([]byte("skylink_2")),
+		database.HashBytes([]byte("skylink_3")),
+	}
+	export := writeBinaryBlocklist(t, hashes)
+	if uint64(len(export)) != BinaryBlocklistSize(uint64(len(hashes)), false) {
+		t.Fatal("unexpected size", len(export))
+	}
+
+	// assert we can read the export
+	read, err := readBinaryBlocklist(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != len(hashes) {
+		t.Fatal("unexpected number of hashes", len(read))
+	}
+	for i := range hashes {
+		if read[i] != hashes[i] {
+			t.Fatal("unexpected hash", read[i])
+		}
+	}
+
+	// assert an empty export is valid
+	read, err = readBinaryBlocklist(writeBinaryBlocklist(t, nil))
+	if err != nil || len(read) != 0 {
+		t.Fatal("unexpected outcome", read, err)
+	}
+
+	// assert truncated exports are detected, in the header, in the hashes and
+	// in the trailer
+	for _, size := range []int{10, binaryBlocklistHeaderSize + 40, len(export) - 1} {
+		_, err = readBinaryBlocklist(export[:size])
+		if !errors.Contains(err, ErrBinaryBlocklistCorrupt) {
+			t.Fatal("unexpected error", size, err)
+		}
+	}
+
+	// assert a flipped bit is detected
+	corrupt := append([]byte{}, export...)
+	corrupt[binaryBlocklistHeaderSize] ^= 1
+	_, err = readBinaryBlocklist(corrupt)
+	if !errors.Contains(err, ErrBinaryBlocklistCorrupt) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert the magic and the version are validated
+	corrupt = append([]byte{}, export...)
+	copy(corrupt, "JSON")
+	_, err = readBinaryBlocklist(corrupt)
+	if err == nil || !strings.Contains(err.Error(), "not a binary blocklist") {
+		t.Fatal("unexpected error", err)
+	}
+	corrupt = append([]byte{}, export...)
+	corrupt[5] = BinaryBlocklistVersion + 1
+	_, err = readBinaryBlocklist(corrupt)
+	if err == nil || !strings.Contains(err.Error(), "unsupported binary blocklist version") {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert the writer refuses to write more or fewer hashes than announced
+	bw, err := NewBinaryBlocklistWriter(ioutil.Discard, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bw.Close() == nil {
+		t.Fatal("expected error")
+	}
+	_ = bw.WriteHash(hashes[0])
+	if bw.WriteHash(hashes[1]) == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// TestSignedBinaryBlocklist verifies signed exports can be verified, that
+// unsigned exports or exports signed by another key are rejected by the
+// verifying reader and that signed exports remain readable without key.
+func TestSignedBinaryBlocklist(t *testing.T) {
+	t.Parallel()
+
+	hashes := []database.Hash{
+		database.HashBytes([]byte("skylink_1")),
+		database.HashBytes([]byte("skylink_2")),
+	}
+	sk, pk := crypto.GenerateKeyPair()
+	export := writeSignedBinaryBlocklist(t, hashes, sk)
+	if uint64(len(export)) != BinaryBlocklistSize(uint64(len(hashes)), true) {
+		t.Fatal("unexpected size", len(export))
+	}
+
+	// assert we can verify the export
+	read, err := readVerifiedBinaryBlocklist(export, pk)
+	if err != nil || len(read) != len(hashes) {
+		t.Fatal("unexpected outcome", read, err)
+	}
+
+	// assert the export can be read without verifying it
+	read, err = readBinaryBlocklist(export)
+	if err != nil || len(read) != len(hashes) {
+		t.Fatal("unexpected outcome", read, err)
+	}
+
+	// assert the signature of another key is rejected
+	_, otherPK := crypto.GenerateKeyPair()
+	_, err = readVerifiedBinaryBlocklist(export, otherPK)
+	if !errors.Contains(err, ErrBinaryBlocklistSignature) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert an unsigned export is rejected
+	_, err = readVerifiedBinaryBlocklist(writeBinaryBlocklist(t, hashes), pk)
+	if !errors.Contains(err, ErrBinaryBlocklistSignature) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert a tampered signature is rejected
+	corrupt := append([]byte{}, export...)
+	corrupt[len(corrupt)-1] ^= 1
+	_, err = readVerifiedBinaryBlocklist(corrupt, pk)
+	if !errors.Contains(err, ErrBinaryBlocklistSignature) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert a truncated signature is detected
+	_, err = readVerifiedBinaryBlocklist(export[:len(export)-1], pk)
+	if !errors.Contains(err, ErrBinaryBlocklistCorrupt) {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+// TestBlocklistBinary verifies the client streams the binary export and stops
+// when the callback returns an error.
+func TestBlocklistBinary(t *testing.T) {
+	t.Parallel()
+
+	hashes := []database.Hash{
+		database.HashBytes([]byte("skylink_1")),
+		database.HashBytes([]byte("skylink_2")),
+		database.HashBytes([]byte("skylink_3")),
+	}
+	export := writeBinaryBlocklist(t, hashes)
+
+	// create a server that serves the export
+	mux := http.NewServeMux()
+	mux.HandleFunc("/skynet/portal/blocklist", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("format") != FormatBinary {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", binaryBlocklistContentType)
+		_, _ = w.Write(export)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	c := NewSkydClient(server.URL, "")
+
+	// assert we receive all hashes
+	var received []database.Hash
+	err := c.BlocklistBinary(context.Background(), func(h database.Hash) error {
+		received = append(received, h)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != len(hashes) {
+		t.Fatal("unexpected number of hashes", len(received))
+	}
+
+	// assert the callback's error stops the iteration
+	errStop := errors.New("stop")
+	received = received[:0]
+	err = c.BlocklistBinary(context.Background(), func(h database.Hash) error {
+		if h == hashes[1] {
+			return errStop
+		}
+		received = append(received, h)
+		return nil
+	})
+	if !errors.Contains(err, errStop) {
+		t.Fatal("unexpected error", err)
+	}
+	if len(received) != 1 {
+		t.Fatal("unexpected number of hashes", len(received))
+	}
+}
+
+// TestSkydBlocklist verifies the skyd export is loaded by skyd's blocklist
+// implementation, and that the writer refuses to write more or fewer hashes
+// than announced in the metadata.
+func TestSkydBlocklist(t *testing.T) {
+	t.Parallel()
+
+	hashes := []database.Hash{
+		database.HashBytes([]byte("skylink_1")),
+		database.HashBytes([]byte("skylink_2")),
+		database.HashBytes([]byte("skylink_3")),
+	}
+
+	// loadSkydBlocklist stores the skyd export of the given hashes in a new
+	// directory and loads it the way skyd does on startup
+	loadSkydBlocklist := func(name string, hashes []database.Hash) *skynetblocklist.SkynetBlocklist {
+		var buf bytes.Buffer
+		sw, err := NewSkydBlocklistWriter(&buf, uint64(len(hashes)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, h := range hashes {
+			err = sw.WriteHash(h)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = sw.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uint64(buf.Len()) != SkydBlocklistSize(uint64(len(hashes))) {
+			t.Fatal("unexpected size", buf.Len())
+		}
+
+		dir := filepath.Join(t.TempDir(), name)
+		err = os.MkdirAll(dir, 0700)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, SkydBlocklistFilename), buf.Bytes(), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sb, err := skynetblocklist.New(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = sb.Close()
+		})
+		return sb
+	}
+
+	// assert skyd loads all hashes
+	sb := loadSkydBlocklist("full", hashes)
+	if len(sb.Blocklist()) != len(hashes) {
+		t.Fatal("unexpected number of hashes", len(sb.Blocklist()))
+	}
+	for _, h := range hashes {
+		if !sb.IsHashBlocked(h.Hash) {
+			t.Fatal("expected hash to be blocked", h)
+		}
+	}
+
+	// assert skyd can keep appending to the export
+	extra := database.HashBytes([]byte("skylink_4"))
+	err := sb.UpdateBlocklist([]crypto.Hash{extra.Hash}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sb.IsHashBlocked(extra.Hash) {
+		t.Fatal("expected hash to be blocked")
+	}
+
+	// assert an empty export is valid
+	sb = loadSkydBlocklist("empty", nil)
+	if len(sb.Blocklist()) != 0 {
+		t.Fatal("unexpected number of hashes", len(sb.Blocklist()))
+	}
+
+	// assert the writer refuses to write more or fewer hashes than announced
+	sw, err := NewSkydBlocklistWriter(ioutil.Discard, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sw.Close() == nil {
+		t.Fatal("expected error")
+	}
+	_ = sw.WriteHash(hashes[0])
+	if sw.WriteHash(hashes[1]) == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// writeBinaryBlocklist returns the binary export of the given hashes.
+func writeBinaryBlocklist(t *testing.T, hashes []database.Hash) []byte {
+	var buf bytes.Buffer
+	bw, err := NewBinaryBlocklistWriter(&buf, uint64(len(hashes)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range hashes {
+		err = bw.WriteHash(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = bw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// writeSignedBinaryBlocklist returns the binary export of the given hashes,
+// signed with the given key.
+func writeSignedBinaryBlocklist(t *testing.T, hashes []database.Hash, sk crypto.SecretKey) []byte {
+	var buf bytes.Buffer
+	bw, err := NewSignedBinaryBlocklistWriter(&buf, uint64(len(hashes)), sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range hashes {
+		err = bw.WriteHash(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = bw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readBinaryBlocklist reads all hashes from the given binary export.
+func readBinaryBlocklist(export []byte) ([]database.Hash, error) {
+	br, err := NewBinaryBlocklistReader(bytes.NewReader(export))
+	if err != nil {
+		return nil, err
+	}
+	return readAllHashes(br)
+}
+
+// readVerifiedBinaryBlocklist reads all hashes from the given binary export,
+// verifying it's signed by the given key.
+func readVerifiedBinaryBlocklist(export []byte, pk crypto.PublicKey) ([]database.Hash, error) {
+	br, err := NewVerifiedBinaryBlocklistReader(bytes.NewReader(export), pk)
+	if err != nil {
+		return nil, err
+	}
+	return readAllHashes(br)
+}
+
+// readAllHashes reads all hashes from the given reader.
+func readAllHashes(br *BinaryBlocklistReader) ([]database.Hash, error) {
+	var hashes []database.Hash
+	for {
+		h, err := br.Next()
+		if err == io.EOF {
+			return hashes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, h)
+	}
+}
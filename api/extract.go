@@ -0,0 +1,63 @@
+package api
+
+import (
+	"regexp"
+
+	"gitlab.com/SkynetLabs/skyd/skymodules"
+)
+
+const (
+	// base64SkylinkSize is the length of a base64 encoded skylink, which is
+	// how skylinks appear in portal URLs and sia:// links.
+	base64SkylinkSize = 46
+
+	// base32SkylinkSize is the length of a base32 encoded skylink, which is
+	// how skylinks appear in subdomains of portal URLs.
+	base32SkylinkSize = 55
+)
+
+var (
+	// skylinkTokenRE matches runs of characters that make up a base64 or
+	// base32 encoded skylink. Everything else, such as the slashes of a URL,
+	// the dots of a domain or whitespace, separates the tokens.
+	skylinkTokenRE = regexp.MustCompile(`[A-Za-z0-9_-]+`)
+)
+
+// ExtractSkylinks scans the given text for skylinks and returns them in the
+// order they were found, without duplicates, normalized to their base64
+// encoding. It finds bare skylinks, skylinks in portal URLs, both in the path
+// and as base32 encoded subdomain, and sia:// links.
+//
+// The extraction is conservative, a token is only considered a skylink if it
+// has exactly the length of an encoded skylink, is not part of an email
+// address and decodes into a valid skylink. This avoids false positives such as
+// hashes or the IDs found in email headers, but it means skylinks that were
+// broken up, e.g. by line wrapping, are missed.
+func ExtractSkylinks(blob string) []string {
+	seen := make(map[string]struct{})
+	skylinks := make([]string, 0)
+	for _, loc := range skylinkTokenRE.FindAllStringIndex(blob, -1) {
+		start, end := loc[0], loc[1]
+		token := blob[start:end]
+		if len(token) != base64SkylinkSize && len(token) != base32SkylinkSize {
+			continue
+		}
+
+		// skip the local part and the domain of email addresses
+		if (start > 0 && blob[start-1] == '@') || (end < len(blob) && blob[end] == '@') {
+			continue
+		}
+
+		var sl skymodules.Skylink
+		if err := sl.LoadString(token); err != nil {
+			continue
+		}
+		skylink := sl.String()
+		if _, exists := seen[skylink]; exists {
+			continue
+		}
+		seen[skylink] = struct{}{}
+		skylinks = append(skylinks, skylink)
+	}
+	return skylinks
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitlab.com/SkynetLabs/skyd/skymodules"
+)
+
+// TestExtractSkylinks verifies skylinks are extracted from free text in the
+// common formats, and that the extraction is conservative.
+func TestExtractSkylinks(t *testing.T) {
+	t.Parallel()
+
+	var v1, v2 skymodules.Skylink
+	err := v1.LoadString(v1SkylinkStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v2.LoadString(v2SkylinkStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		blob     string
+		expected []string
+	}{
+		{
+			name:     "Bare",
+			blob:     fmt.Sprintf("please take down %s, thanks", v1SkylinkStr),
+			expected: []string{v1SkylinkStr},
+		},
+		{
+			name:     "URL",
+			blob:     fmt.Sprintf("Found at https://siasky.net/%s/index.html?foo=bar.", v1SkylinkStr),
+			expected: []string{v1SkylinkStr},
+		},
+		{
+			name:     "Subdomain",
+			blob:     fmt.Sprintf("See https://%s.siasky.net", v1.Base32EncodedString()),
+			expected: []string{v1SkylinkStr},
+		},
+		{
+			name:     "Sia",
+			blob:     fmt.Sprintf("<a href=\"sia://%s\">link</a>", v2SkylinkStr),
+			expected: []string{v2SkylinkStr},
+		},
+		{
+			name:     "Multiple",
+			blob:     fmt.Sprintf("%s\nhttps://skyportal.xyz/%s\r\nsia://%s/file", v1SkylinkStr, v2SkylinkStr, v1SkylinkStr),
+			expected: []string{v1SkylinkStr, v2SkylinkStr},
+		},
+		{
+			name:     "Email",
+			blob:     fmt.Sprintf("Message-ID: <%s@mail.example.com>", v1SkylinkStr),
+			expected: []string{},
+		},
+		{
+			name:     "Hash",
+			blob:     "hash " + strings.Repeat("ab", 32),
+			expected: []string{},
+		},
+		{
+			name:     "Malformed",
+			blob:     "token " + strings.Repeat("_", base64SkylinkSize),
+			expected: []string{},
+		},
+		{
+			name:     "Empty",
+			blob:     "",
+			expected: []string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			skylinks := ExtractSkylinks(test.blob)
+			if !reflect.DeepEqual(skylinks, test.expected) {
+				t.Fatal("unexpected skylinks", skylinks)
+			}
+		})
+	}
+}
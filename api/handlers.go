@@ -2,9 +2,12 @@ package api
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	url "net/url"
 	"regexp"
@@ -15,6 +18,7 @@ import (
 	"github.com/SkynetLabs/blocker/database"
 	"github.com/SkynetLabs/blocker/modules"
 	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
 	"gitlab.com/NebulousLabs/errors"
 	skyapi "gitlab.com/SkynetLabs/skyd/node/api"
 	"gitlab.com/SkynetLabs/skyd/skymodules"
@@ -22,19 +26,49 @@ import (
 )
 
 const (
+	// DefaultMaxBlockBodySize is the default maximum size of the POST body
+	// when making a request to the block endpoints that allow reporting
+	// skylinks in bulk. It fits about 100,000 skylinks.
+	DefaultMaxBlockBodySize = int64(1 << 23) // 8mib
+
 	// maxBodySize defines the maximum size of the POST body when making request
 	// to the block endpoints
 	maxBodySize = int64(1 << 16) // 64kib
 
+	// reblockChunkSize is the number of hashes the reblock endpoint blocks
+	// before reporting its progress.
+	reblockChunkSize = 1000
+
+	// blockedMaxAge is the amount of time edges are allowed to cache the
+	// response of the blocked endpoint before they have to revalidate it
+	blockedMaxAge = 10 * time.Second
+
+	// maxReportIDLength is the maximum length of a report ID supplied by the
+	// caller
+	maxReportIDLength = 64
+
+	// metadataTimeout is the maximum amount of time fetching the metadata of
+	// a reported skylink may take.
+	metadataTimeout = 10 * time.Second
+
 	// maxLimit defines the maximum value for the limit parameter used by the
 	// blocklist endpoint
 	maxLimit = 1000
 
+	// defaultPageSize is the default value of the 'page[size]' parameter
+	// used by the blocked endpoint, the maximum is maxLimit.
+	defaultPageSize = 100
+
 	// sortAscending defines the query string parameter option that can be
 	// passed as 'sort' parameter. If passed the response will contain the
 	// entries sorted by the 'sortBy' parameter in ascending fashion.
 	sortAscending = "asc"
 
+	// reportFormatCSV and reportFormatJSON define the formats the report
+	// endpoint can emit, passed as 'format' parameter.
+	reportFormatCSV  = "csv"
+	reportFormatJSON = "json"
+
 	// sortDescending defines the query string parameter option that can be
 	// passed as 'sort' parameter. If passed the response will contain the
 	// entries sorted by the 'sortBy' parameter in descending fashion.
@@ -42,9 +76,21 @@ const (
 )
 
 var (
+	// ErrLegalBasisRequired is returned when a block request does not specify
+	// the legal basis of the block while the API requires it.
+	ErrLegalBasisRequired = errors.New("the legal basis of the block is required")
+
 	// errResolve is the error returned when we failed to resolve a skylink,
 	// indicating skyd failure
 	errResolve = errors.New("failed to resolve skylink")
+
+	// ErrMaintenance is returned by the blocker when it's asked to block
+	// hashes during a maintenance window.
+	ErrMaintenance = errors.New("blocker is in maintenance")
+
+	// errBodyTooLarge is the error http.MaxBytesReader returns once the body
+	// exceeds its limit.
+	errBodyTooLarge = errors.New("http: request body too large")
 )
 
 type (
@@ -62,6 +108,72 @@ type (
 		// services that interact with the blocker to only deal with hashes
 		// instead of skylinks.
 		Hash crypto.Hash `json:"hash"`
+
+		// ReportID is an optional identifier of the report, it is included
+		// in all log lines concerning the reported skylink. If it's not set,
+		// a report ID is generated.
+		ReportID string `json:"reportid"`
+
+		// LegalBasis is the legal basis of the block, e.g. the DMCA notice or
+		// the law it's based on. It's recorded in the skylink's history and
+		// included in the report. Depending on the API's configuration it
+		// is required.
+		LegalBasis string `json:"legalbasis"`
+
+		// Test marks the report as a test record, e.g. when validating an
+		// integration. Test records get blocked like any other skylink, but
+		// they are excluded from the blocklist and the reports unless they
+		// are explicitly included.
+		Test bool `json:"test"`
+
+		// FollowManifest extends the report to the skylinks referenced by
+		// the manifest of the reported skapp, they are reported alongside
+		// the skapp. It's only supported for reports of a single skylink
+		// and the response is the one of a bulk report.
+		FollowManifest bool `json:"followmanifest"`
+	}
+
+	// BlockBulkPOST describes a request to the /block endpoint. Next to a
+	// single skylink it allows reporting multiple skylinks or hashes at
+	// once, they are all reported with the same reporter, tags and report
+	// ID. MerkleRoots holds hex encoded raw merkle roots, which are reported
+	// as the V1 skylinks of their base sector.
+	BlockBulkPOST struct {
+		BlockPOST
+		Hashes      []crypto.Hash `json:"hashes"`
+		MerkleRoots []string      `json:"merkleroots"`
+		Skylinks    []skylink     `json:"skylinks"`
+	}
+
+	// BlockBulkResponse is the response to a bulk request to the /block
+	// endpoint. It contains the number of skylinks that were newly reported,
+	// the number of skylinks that were already reported, the number of
+	// skylinks that are on the allow list and the skylinks that could not be
+	// resolved.
+	BlockBulkResponse struct {
+		Status      string         `json:"status"`
+		ReportID    string         `json:"reportid"`
+		Inserted    int            `json:"inserted"`
+		Duplicates  int            `json:"duplicates"`
+		AllowListed int            `json:"allowlisted"`
+		Invalids    []InvalidInput `json:"invalids"`
+	}
+
+	// BlockTextResponse is the response to a request to the /block/text
+	// endpoint. Next to the outcome of blocking the skylinks, it contains
+	// the skylinks that were extracted from the text.
+	BlockTextResponse struct {
+		BlockBulkResponse
+		Extracted []string `json:"extracted"`
+	}
+
+	// BlockManifestResponse is the response to a request to the /block
+	// endpoint that follows the manifest of the reported skapp. Next to the
+	// outcome of blocking the skylinks, it contains the skylinks that were
+	// referenced by the manifest.
+	BlockManifestResponse struct {
+		BlockBulkResponse
+		Referenced []string `json:"referenced"`
 	}
 
 	// BlocklistGET returns a list of blocked hashes
@@ -70,6 +182,81 @@ type (
 		HasMore bool          `json:"hasmore"`
 	}
 
+	// BlockedListGET is the response returned by the /blocked endpoint, it
+	// follows the JSON:API conventions for pagination. The next link is
+	// omitted on the last page.
+	BlockedListGET struct {
+		Data  []BlockedListEntry `json:"data"`
+		Meta  BlockedListMeta    `json:"meta"`
+		Links BlockedListLinks   `json:"links"`
+	}
+
+	// BlockedListEntry describes a skylink in the response of the /blocked
+	// endpoint. BlockedAt is the time skyd confirmed the block, it's omitted
+	// for skylinks that were blocked before that time was recorded.
+	BlockedListEntry struct {
+		Hash           crypto.Hash `json:"hash"`
+		Source         string      `json:"source"`
+		State          string      `json:"state"`
+		Tags           []string    `json:"tags"`
+		TimestampAdded time.Time   `json:"timestampadded"`
+		BlockedAt      *time.Time  `json:"blockedat,omitempty"`
+
+		Annotations map[string]string `json:"annotations,omitempty"`
+	}
+
+	// AnnotationsPATCH is the response returned by the
+	// /blocked/:skylink/annotations endpoint, it holds the annotations of
+	// the skylink after the update.
+	AnnotationsPATCH struct {
+		Annotations map[string]string `json:"annotations"`
+	}
+
+	// BlockedListMeta holds the number of skylinks that match the filter
+	// across all pages.
+	BlockedListMeta struct {
+		Total int64 `json:"total"`
+	}
+
+	// BlockedListLinks holds the link to the next page.
+	BlockedListLinks struct {
+		Next string `json:"next,omitempty"`
+	}
+
+	// BlockedHashGET is the response returned by the /blockedhash endpoint,
+	// it contains the blocked hashes that start with the requested prefix.
+	BlockedHashGET struct {
+		Entries []BlockedHash `json:"entries"`
+	}
+
+	// BlockStatus describes the block status of a skylink. It contains both
+	// the state of the skylink's record in the database and whether skyd
+	// actually reports it as blocked, along with the version of that skyd.
+	// TimestampAdded is the time the skylink got reported and BlockedAt the
+	// time skyd confirmed its block, the latter is omitted if the skylink is
+	// not blocked or was blocked before that time was recorded.
+	BlockStatus struct {
+		Hash          crypto.Hash `json:"hash"`
+		AllowListed   bool        `json:"allowlisted"`
+		BlockedInSkyd bool        `json:"blockedinskyd"`
+		Failed        bool        `json:"failed"`
+		Found         bool        `json:"found"`
+		Invalid       bool        `json:"invalid"`
+		Reverted      bool        `json:"reverted"`
+		SkydVersion   string      `json:"skydversion,omitempty"`
+
+		TimestampAdded *time.Time `json:"timestampadded,omitempty"`
+		BlockedAt      *time.Time `json:"blockedat,omitempty"`
+
+		// Annotations are the free-form notes the moderators attached to
+		// the skylink.
+		Annotations map[string]string `json:"annotations,omitempty"`
+
+		// Metadata describes the content of the skylink, it's only set if
+		// it was fetched when the skylink got reported.
+		Metadata *SkylinkMetadata `json:"metadata,omitempty"`
+	}
+
 	// BlockedHash describes a blocked hash along with the set of tags it was
 	// reported with
 	BlockedHash struct {
@@ -90,6 +277,221 @@ type (
 		Target string `json:"target"`
 	}
 
+	// ReportEntry describes a blocked skylink in the report returned by the
+	// /report endpoint. Skylinks are never persisted, only their hash is.
+	ReportEntry struct {
+		Hash       crypto.Hash `json:"hash"`
+		Source     string      `json:"source"`
+		Reporter   Reporter    `json:"reporter"`
+		LegalBasis string      `json:"legalbasis"`
+		Timestamp  time.Time   `json:"timestamp"`
+	}
+
+	// ReblockPOST describes the progress of a request to the /admin/reblock
+	// endpoint. The endpoint streams one object per processed chunk of
+	// hashes, the last object is the summary and has 'done' set to true.
+	ReblockPOST struct {
+		Total     int  `json:"total"`
+		Processed int  `json:"processed"`
+		Blocked   int  `json:"blocked"`
+		Failed    int  `json:"failed"`
+		Invalid   int  `json:"invalid"`
+		Done      bool `json:"done"`
+	}
+
+	// ResolveCacheDELETE is the response returned by the /admin/resolvecache
+	// endpoint, it contains the number of cached resolutions that were
+	// removed.
+	ResolveCacheDELETE struct {
+		Removed int `json:"removed"`
+	}
+
+	// TestRecordsDELETE is the response returned by the /admin/test
+	// endpoint, it contains the number of test records that were purged.
+	TestRecordsDELETE struct {
+		Removed int `json:"removed"`
+	}
+
+	// IntegrityPOST is the response returned by the /admin/integrity
+	// endpoint. It contains the number of skylinks that were scanned and an
+	// entry for every type of problem that was checked.
+	IntegrityPOST struct {
+		Scanned  int64              `json:"scanned"`
+		Problems []IntegrityProblem `json:"problems"`
+	}
+
+	// IntegrityProblem describes the skylinks that suffer from a certain
+	// problem, it holds the number of skylinks that were found and repaired
+	// and the IDs of some of them.
+	IntegrityProblem struct {
+		Type      string   `json:"type"`
+		Count     int64    `json:"count"`
+		Repaired  int64    `json:"repaired"`
+		SampleIDs []string `json:"sampleids"`
+	}
+
+	// RetryPOST is the response returned by the /admin/retry endpoint. It
+	// contains the amount of failed hashes that were retried and the amount
+	// that are still failed, along with the error that made them fail.
+	RetryPOST struct {
+		Retried     int    `json:"retried"`
+		StillFailed int    `json:"stillfailed"`
+		Error       string `json:"error,omitempty"`
+	}
+
+	// ServiceStatusGET is the response returned by the /status endpoint. It
+	// contains the state of the circuit breaker around skyd, while it's not
+	// closed the blocker does not block any hashes. PublicKey is the hex
+	// encoded key that verifies the signature of the binary blocklist
+	// export, it's empty if the export is not signed. DisabledSources are
+	// the report sources whose skylinks are currently not blocked.
+	ServiceStatusGET struct {
+		DBConnected     bool         `json:"dbconnected"`
+		DisabledSources []string     `json:"disabledsources,omitempty"`
+		PublicKey       string       `json:"publickey,omitempty"`
+		SkydCircuit     CircuitState `json:"skydcircuit"`
+		Sweep           SweepStatus  `json:"sweep"`
+	}
+
+	// SnapshotPOST is the response returned by the /admin/snapshot
+	// endpoint, it describes the snapshot that got created.
+	SnapshotPOST struct {
+		Label     string    `json:"label"`
+		Note      string    `json:"note,omitempty"`
+		Timestamp time.Time `json:"timestamp"`
+	}
+
+	// SnapshotRestore is the outcome of restoring the blocklist to the
+	// snapshot with the given label, which was created at the given time.
+	// Unblocked holds the hashes that got unblocked in skyd, Cancelled the
+	// hashes that were not blocked yet and got cancelled. If DryRun is set
+	// nothing was changed and the hashes are the ones that would be reverted.
+	SnapshotRestore struct {
+		Label     string          `json:"label"`
+		Timestamp time.Time       `json:"timestamp"`
+		DryRun    bool            `json:"dryrun"`
+		Unblocked []database.Hash `json:"unblocked"`
+		Cancelled []database.Hash `json:"cancelled"`
+	}
+
+	// SourcePUT is the response returned by the /admin/source endpoint, it
+	// contains the report sources that are disabled after the update.
+	SourcePUT struct {
+		DisabledSources []string `json:"disabledsources"`
+	}
+
+	// SweepStatus describes the state of the blocker's block sweeps. Paused
+	// indicates the sweeps are skipped because the circuit breaker around
+	// skyd is open, SkydDown indicates the last call to skyd to block hashes
+	// failed. LeaseHeld is always true if the sweep lease is disabled.
+	// Backoff is the amount of time the blocker waits before the next sweep
+	// because of the consecutive errors, it's zero if the last sweep
+	// succeeded. Maintenance indicates the sweeps are skipped because of a
+	// maintenance window of the MaintenanceSchedule. Rejected is the number
+	// of hashes skyd permanently rejected as invalid since the blocker
+	// started, these are quarantined and never sent to skyd again.
+	// Unverified is the number of hashes skyd accepted to block but that
+	// were missing from its blocklist when verified, these are retried.
+	// SweepInterval is the amount of time the blocker waits between sweeps.
+	// Suspended indicates an operator suspended the sweeps, they're skipped
+	// until they get resumed.
+	SweepStatus struct {
+		LastSweep           time.Time     `json:"lastsweep"`
+		ConsecutiveErrors   int           `json:"consecutiveerrors"`
+		Backoff             time.Duration `json:"backoff"`
+		LeaseHeld           bool          `json:"leaseheld"`
+		Maintenance         bool          `json:"maintenance"`
+		MaintenanceSchedule string        `json:"maintenanceschedule"`
+		Paused              bool          `json:"paused"`
+		Rejected            uint64        `json:"rejected"`
+		SkydDown            bool          `json:"skyddown"`
+		Suspended           bool          `json:"suspended"`
+		SweepInterval       time.Duration `json:"sweepinterval"`
+		Unverified          uint64        `json:"unverified"`
+	}
+
+	// DebugConfigGET is the response returned by the /debug/config endpoint,
+	// it holds the configuration that is in effect, including the values
+	// that were adjusted at runtime. Secrets are never included, only
+	// whether they are set.
+	DebugConfigGET struct {
+		API     APIConfig     `json:"api"`
+		Blocker BlockerConfig `json:"blocker"`
+		Skyd    SkydConfig    `json:"skyd"`
+	}
+
+	// APIConfig describes the configuration of the API.
+	APIConfig struct {
+		AdminPasswordSet  bool  `json:"adminpasswordset"`
+		FetchMetadata     bool  `json:"fetchmetadata"`
+		MaxBlockBodySize  int64 `json:"maxblockbodysize"`
+		RequireLegalBasis bool  `json:"requirelegalbasis"`
+		SigningKeySet     bool  `json:"signingkeyset"`
+	}
+
+	// BlockerConfig describes the configuration of the blocker. BatchSize is
+	// the number of hashes that are sent to skyd at once, MaxBlockDelay is
+	// the longest amount of time reported skylinks are held back for and
+	// SweepLeaseTTL is zero if the sweep lease is disabled. The durations
+	// are formatted as strings, e.g. '1m0s'.
+	BlockerConfig struct {
+		BatchSize           int     `json:"batchsize"`
+		BlockTag            string  `json:"blocktag,omitempty"`
+		BlockLogMaxSize     int64   `json:"blocklogmaxsize,omitempty"`
+		BlockLogPath        string  `json:"blocklogpath,omitempty"`
+		ErrorBackoffMax     string  `json:"errorbackoffmax"`
+		ErrorBackoffStep    string  `json:"errorbackoffstep"`
+		ErrorBackoffSteps   int     `json:"errorbackoffsteps"`
+		MaintenanceSchedule string  `json:"maintenanceschedule"`
+		MaxBlockDelay       string  `json:"maxblockdelay"`
+		MaxClockSkew        string  `json:"maxclockskew"`
+		MaxRejectionRate    float64 `json:"maxrejectionrate"`
+		PortalBlocker       bool    `json:"portalblocker"`
+		PrePolicy           bool    `json:"prepolicy"`
+		ResolveTimeout      string  `json:"resolvetimeout"`
+		RetryInterval       string  `json:"retryinterval"`
+		SweepInterval       string  `json:"sweepinterval"`
+		SweepLeaseTTL       string  `json:"sweepleasettl"`
+		VerifyRate          float64 `json:"verifyrate"`
+		WarmStart           int     `json:"warmstart"`
+		WatchInserts        bool    `json:"watchinserts"`
+	}
+
+	// SkydConfig describes the configuration of the skyd client. The URL has
+	// its password redacted, if it holds one. Paths are the paths of the
+	// endpoints that are in effect, whether they were configured or depend
+	// on the version of skyd.
+	SkydConfig struct {
+		URL                 string    `json:"url"`
+		APIPasswordSet      bool      `json:"apipasswordset"`
+		IdleConnTimeout     string    `json:"idleconntimeout"`
+		MaxConnsPerHost     int       `json:"maxconnsperhost"`
+		MaxIdleConnsPerHost int       `json:"maxidleconnsperhost"`
+		Paths               SkydPaths `json:"paths"`
+		TLS                 bool      `json:"tls"`
+		UserAgent           string    `json:"useragent"`
+	}
+
+	// SkydMetricsGET is the response returned by the /metrics/skyd endpoint.
+	SkydMetricsGET struct {
+		Circuit        CircuitState        `json:"circuit"`
+		ConnectionPool ConnectionPoolStats `json:"connectionpool"`
+		ResolveCache   ResolveCacheStats   `json:"resolvecache"`
+	}
+
+	// SourcesGET is the response returned by the /metrics/sources endpoint,
+	// it contains the number of blocked skylinks per source.
+	SourcesGET struct {
+		Sources []SourceCount `json:"sources"`
+	}
+
+	// SourceCount holds the number of skylinks that were blocked following
+	// reports of a certain source.
+	SourceCount struct {
+		Source string `json:"source"`
+		Count  int    `json:"count"`
+	}
+
 	// Reporter is a person who reported that a given skylink should be
 	// blocked.
 	Reporter struct {
@@ -100,7 +502,19 @@ type (
 
 	// statusResponse is what we return on block requests
 	statusResponse struct {
-		Status string `json:"status"`
+		Status   string `json:"status"`
+		ReportID string `json:"reportid,omitempty"`
+	}
+
+	// UtilHashGET is the response returned by the /util/hash endpoint. Hash
+	// is the hash the blocker uses for the skylink, if the skylink is a V2
+	// skylink it's the hash of the V1 skylink it resolved to, which is set
+	// in Resolved, and V2Hash is the hash of the V2 skylink itself.
+	UtilHashGET struct {
+		Skylink  string         `json:"skylink"`
+		Resolved string         `json:"resolved,omitempty"`
+		Hash     database.Hash  `json:"hash"`
+		V2Hash   *database.Hash `json:"v2hash,omitempty"`
 	}
 
 	// skylink is a helper type which adds custom decoding for skylinks.
@@ -114,21 +528,10 @@ func (sl *skylink) UnmarshalJSON(b []byte) error {
 	if err != nil {
 		return err
 	}
-	// Trim all the redundant information.
-	//
-	// TODO: is this really necessary? if possible we should try and drop this
-	link, err = extractSkylinkHash(link)
+	slNormalized, err := parseSkylink(link)
 	if err != nil {
 		return err
 	}
-	// Normalise the skylink hash. We want to use the same hash encoding in the
-	// database, regardless of the encoding of the skylink when we receive it -
-	// base32 or base64.
-	var slNormalized skymodules.Skylink
-	err = slNormalized.LoadString(link)
-	if err != nil {
-		return errors.AddContext(err, "invalid skylink provided")
-	}
 	*sl = skylink(slNormalized.String())
 	return nil
 }
@@ -146,8 +549,27 @@ func (api *API) blocklistGET(w http.ResponseWriter, r *http.Request, _ httproute
 		WriteError(w, err, http.StatusBadRequest)
 		return
 	}
+	includeTest, err := parseIncludeTest(r)
+	if err != nil {
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
 
-	blocked, more, err := api.staticDB.BlockedHashes(r.Context(), sort, offset, limit)
+	// large blocklists can be transferred in a compact binary format
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+	case FormatBinary:
+		api.blocklistBinaryGET(w, r, sort, includeTest)
+		return
+	case FormatSkyd:
+		api.blocklistSkydGET(w, r, sort, includeTest)
+		return
+	default:
+		WriteError(w, fmt.Errorf("invalid value for 'format' parameter, can only be 'json', '%v' or '%v'", FormatBinary, FormatSkyd), http.StatusBadRequest)
+		return
+	}
+
+	blocked, more, err := api.staticDB.BlockedHashes(r.Context(), sort, offset, limit, includeTest)
 	if err != nil {
 		WriteError(w, err, http.StatusInternalServerError)
 		return
@@ -166,10 +588,254 @@ func (api *API) blocklistGET(w http.ResponseWriter, r *http.Request, _ httproute
 	})
 }
 
+// blocklistBinaryGET streams the entire blocklist in the binary format, it is
+// not paginated. The number of hashes is fixed before streaming starts, if
+// fewer hashes are found while streaming, e.g. because some got unblocked, the
+// connection is aborted and the reader detects the truncated export.
+func (api *API) blocklistBinaryGET(w http.ResponseWriter, r *http.Request, sort int, includeTest bool) {
+	count, err := api.staticDB.CountBlockedHashes(r.Context(), includeTest)
+	if err != nil {
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", binaryBlocklistContentType)
+	w.Header().Set("Content-Length", fmt.Sprint(BinaryBlocklistSize(uint64(count), api.staticSigningKey != nil)))
+	var bw *BinaryBlocklistWriter
+	if api.staticSigningKey != nil {
+		bw, err = NewSignedBinaryBlocklistWriter(w, uint64(count), *api.staticSigningKey)
+	} else {
+		bw, err = NewBinaryBlocklistWriter(w, uint64(count))
+	}
+	if err == nil {
+		err = api.staticDB.ForEachBlockedHash(r.Context(), sort, count, includeTest, bw.WriteHash)
+	}
+	if err == nil {
+		err = bw.Close()
+	}
+	if err != nil {
+		// the status code was sent already, aborting the handler closes
+		// the connection which the reader detects
+		api.staticLogger.Errorf("failed to stream binary blocklist: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// blocklistSkydGET streams the entire blocklist in the format of skyd's
+// blocklist persist file, it is not paginated. Like the binary export, the
+// number of hashes is fixed before streaming starts and the connection is
+// aborted if fewer hashes are found while streaming.
+func (api *API) blocklistSkydGET(w http.ResponseWriter, r *http.Request, sort int, includeTest bool) {
+	count, err := api.staticDB.CountBlockedHashes(r.Context(), includeTest)
+	if err != nil {
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", binaryBlocklistContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", SkydBlocklistFilename))
+	w.Header().Set("Content-Length", fmt.Sprint(SkydBlocklistSize(uint64(count))))
+	sw, err := NewSkydBlocklistWriter(w, uint64(count))
+	if err == nil {
+		err = api.staticDB.ForEachBlockedHash(r.Context(), sort, count, includeTest, sw.WriteHash)
+	}
+	if err == nil {
+		err = sw.Close()
+	}
+	if err != nil {
+		// the status code was sent already, aborting the handler closes
+		// the connection which the reader detects
+		api.staticLogger.Errorf("failed to stream skyd blocklist: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// blockedGET is a cheap probe that returns whether the given skylink is
+// blocked, it is meant to be called by edges before serving a skylink. It
+// responds with a 200 if the skylink is blocked and a 404 if it is not, without
+// a body. V2 skylinks are not resolved, instead they are matched against the
+// V2 skylinks that were recorded when blocking. The response carries an ETag
+// and Last-Modified header that are tied to the revision of the blocklist,
+// allowing edges to cheaply revalidate their cached response.
+func (api *API) blockedGET(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	sl, err := parseSkylink(ps.ByName("skylink"))
+	if err != nil {
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// set the cache headers, the time of the revision is part of the ETag
+	// so it changes if the revisions start over, e.g. on a new database
+	rev, err := api.staticDB.BlocklistRevision(r.Context())
+	if err != nil {
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+	etag := fmt.Sprintf(`"%x-%x"`, rev.Revision, rev.Timestamp.UnixNano())
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(blockedMaxAge.Seconds())))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", rev.Timestamp.UTC().Format(http.TimeFormat))
+
+	// return early if the edge's cached response is still valid
+	if notModified(r, etag, rev.Timestamp) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	blocked, err := api.staticDB.IsBlocked(r.Context(), database.NewHash(sl))
+	if err != nil {
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if !blocked {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// blockedListGET returns a page of the skylinks in the database, it is meant
+// to be used by moderation dashboards. The skylinks are filtered by the
+// optional 'filter[source]', 'filter[state]', 'filter[from]', 'filter[to]',
+// 'filter[blockedfrom]' and 'filter[blockedto]' parameters, the latter two
+// bound the time skyd confirmed the block. They are sorted by the time they
+// were added, passing
+// '-timestamp_added' as 'sort' parameter returns the newest skylinks first.
+// Pages are requested through the 'page[size]' and 'page[cursor]' parameters,
+// the link to the next page is part of the response. Test records are only
+// included if the 'includetest' parameter is set.
+func (api *API) blockedListGET(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	query := r.URL.Query()
+	filter, pageSize, err := parseBlockedListParameters(query)
+	if err != nil {
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+	filter.IncludeTest, err = parseIncludeTest(r)
+	if err != nil {
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	page, err := api.staticDB.ListBlockedSkylinks(r.Context(), filter, query.Get("page[cursor]"), pageSize)
+	if errors.Contains(err, database.ErrInvalidCursor) {
+		WriteError(w, errors.AddContext(err, "invalid value for 'page[cursor]' parameter"), http.StatusBadRequest)
+		return
+	}
+	if errors.Contains(err, database.ErrInvalidState) {
+		WriteError(w, errors.AddContext(err, "invalid value for 'filter[state]' parameter"), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp := BlockedListGET{
+		Data: make([]BlockedListEntry, len(page.Entries)),
+		Meta: BlockedListMeta{Total: page.Total},
+	}
+	for i, bsl := range page.Entries {
+		resp.Data[i] = BlockedListEntry{
+			Hash:           bsl.Hash.Hash,
+			Source:         bsl.Reporter.Name,
+			State:          bsl.State(),
+			Tags:           bsl.Tags,
+			TimestampAdded: bsl.TimestampAdded.UTC(),
+			Annotations:    bsl.Annotations,
+		}
+		if !bsl.BlockedAt.IsZero() {
+			blockedAt := bsl.BlockedAt.UTC()
+			resp.Data[i].BlockedAt = &blockedAt
+		}
+	}
+	if page.NextCursor != "" {
+		query.Set("page[cursor]", page.NextCursor)
+		resp.Links.Next = (&url.URL{Path: r.URL.Path, RawQuery: query.Encode()}).String()
+	}
+	skyapi.WriteJSON(w, resp)
+}
+
+// annotationsPATCH updates the annotations of a blocked skylink, which are
+// free-form notes of the moderators, e.g. a link to a ticket. The body is a
+// JSON object that maps keys to their new value, keys that map to null are
+// removed and keys that are omitted are left untouched. V2 skylinks are
+// resolved. It responds with the annotations after the update.
+func (api *API) annotationsPATCH(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	sl, err := parseSkylink(ps.ByName("skylink"))
+	if err != nil {
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// parse the patch
+	var patch map[string]*string
+	err = json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&patch)
+	if isBodyTooLarge(err) {
+		WriteError(w, fmt.Errorf("request body exceeds the maximum size of %d bytes", maxBodySize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		WriteError(w, errors.AddContext(err, "failed to parse annotations"), http.StatusBadRequest)
+		return
+	}
+
+	// resolve the skylink
+	sl, err = api.staticBlocker.ResolveSkylink(r.Context(), sl)
+	if err != nil {
+		WriteError(w, errors.AddContext(err, "failed to resolve skylink"), http.StatusInternalServerError)
+		return
+	}
+
+	annotations, err := api.staticDB.UpdateAnnotations(r.Context(), database.NewHash(sl), patch)
+	if errors.Contains(err, database.ErrInvalidAnnotations) {
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+	if errors.Contains(err, database.ErrNoDocumentsFound) {
+		WriteError(w, errors.New("skylink not found"), http.StatusNotFound)
+		return
+	}
+	if errors.Contains(err, database.ErrAnnotationsConflict) {
+		WriteError(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+	skyapi.WriteJSON(w, AnnotationsPATCH{Annotations: annotations})
+}
+
+// blockedHashGET returns the blocked hashes that start with the given hex
+// encoded prefix, allowing integrations that only know part of a hash to look
+// it up. Prefixes that are too short to be looked up efficiently are rejected.
+func (api *API) blockedHashGET(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	blocked, err := api.staticDB.BlockedByHashPrefix(r.Context(), ps.ByName("prefix"))
+	if errors.Contains(err, database.ErrInvalidHashPrefix) {
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	hashes := make([]BlockedHash, len(blocked))
+	for i, bh := range blocked {
+		hashes[i] = BlockedHash{
+			Hash: bh.Hash.Hash,
+			Tags: bh.Tags,
+		}
+	}
+	skyapi.WriteJSON(w, BlockedHashGET{Entries: hashes})
+}
+
 // healthGET returns the status of the service
 func (api *API) healthGET(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	status := struct {
-		DBAlive bool `json:"dbAlive"`
+		DBAlive     bool `json:"dbAlive"`
+		DBConnected bool `json:"dbConnected"`
 	}{}
 
 	// Apply a timeout.
@@ -178,30 +844,786 @@ func (api *API) healthGET(w http.ResponseWriter, r *http.Request, _ httprouter.P
 
 	err := api.staticDB.Ping(ctx)
 	status.DBAlive = err == nil
+	status.DBConnected = api.staticDB.Connected()
+	skyapi.WriteJSON(w, status)
+}
+
+// readyGET returns whether the service is ready to serve requests, which is
+// not the case while the database is not connected. Contrary to the health
+// endpoint it returns an error status code if the service is not ready.
+func (api *API) readyGET(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !api.staticDB.Connected() {
+		WriteError(w, errors.New("database not connected"), http.StatusServiceUnavailable)
+		return
+	}
+	skyapi.WriteSuccess(w)
+}
+
+// serviceStatusGET returns the status of the service, it allows operators to
+// see why blocking is paused and how peers can verify our blocklist export.
+func (api *API) serviceStatusGET(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	status := ServiceStatusGET{
+		DBConnected: api.staticDB.Connected(),
+		SkydCircuit: api.staticSkydClient.CircuitState(),
+		Sweep:       api.staticBlocker.SweepStatus(),
+	}
+	if api.staticSigningKey != nil {
+		pk := api.staticSigningKey.PublicKey()
+		status.PublicKey = hex.EncodeToString(pk[:])
+	}
+	if status.DBConnected {
+		disabled, err := api.staticDB.DisabledSources(r.Context())
+		if err != nil {
+			api.staticLogger.Errorf("failed to fetch the disabled sources, err: %v", err)
+		}
+		status.DisabledSources = disabled
+	}
+	skyapi.WriteJSON(w, status)
+}
+
+// skydMetricsGET returns the metrics of the circuit breaker around skyd, of the
+// pool of connections to skyd and of the cache of resolved skylinks.
+func (api *API) skydMetricsGET(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	skyapi.WriteJSON(w, SkydMetricsGET{
+		Circuit:        api.staticSkydClient.CircuitState(),
+		ConnectionPool: api.staticSkydClient.ConnectionPoolStats(),
+		ResolveCache:   api.staticSkydClient.ResolveCacheStats(),
+	})
+}
+
+// debugConfigGET returns the configuration that is in effect, including the
+// values that were adjusted at runtime, e.g. the sweep interval. It allows
+// confirming a change of the configuration took effect.
+func (api *API) debugConfigGET(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	skyapi.WriteJSON(w, DebugConfigGET{
+		API: APIConfig{
+			AdminPasswordSet:  AdminPassword != "",
+			FetchMetadata:     api.staticFetchMetadata,
+			MaxBlockBodySize:  api.staticMaxBlockBodySize,
+			RequireLegalBasis: api.staticRequireLegalBasis,
+			SigningKeySet:     api.staticSigningKey != nil,
+		},
+		Blocker: api.staticBlocker.Config(),
+		Skyd:    api.staticSkydClient.Config(),
+	})
+}
+
+// cancelPOST cancels the block of a skylink that is held back by the block
+// delay, before it gets sent to skyd. The skylink is identified by either the
+// 'hash' or the 'skylink' parameter, the optional 'reason' is recorded in the
+// skylink's history. If the skylink got blocked already it has to be unblocked
+// instead, in which case a conflict is returned.
+func (api *API) cancelPOST(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// parse the hash
+	var hash database.Hash
+	if hashStr := r.FormValue("hash"); hashStr != "" {
+		err := hash.LoadString(hashStr)
+		if err != nil {
+			WriteError(w, errors.AddContext(err, "invalid value for 'hash' parameter"), http.StatusBadRequest)
+			return
+		}
+	} else {
+		sl, err := parseSkylink(r.FormValue("skylink"))
+		if err != nil {
+			WriteError(w, errors.AddContext(err, "invalid value for 'skylink' parameter"), http.StatusBadRequest)
+			return
+		}
+		sl, err = api.staticBlocker.ResolveSkylink(r.Context(), sl)
+		if err != nil {
+			WriteError(w, errors.AddContext(err, "failed to resolve skylink"), http.StatusInternalServerError)
+			return
+		}
+		hash = database.NewHash(sl)
+	}
+
+	reason := r.FormValue("reason")
+	if reason == "" {
+		reason = "cancelled during the block delay"
+	}
+	err := api.staticDB.CancelPending(r.Context(), hash, reason)
+	if errors.Contains(err, database.ErrNoDocumentsFound) {
+		WriteError(w, errors.New("skylink is not pending, it's unknown or got blocked already"), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+	api.staticLogger.Infof("cancelled the block of hash %v, reason: %v", hash, reason)
+	skyapi.WriteSuccess(w)
+}
+
+// resolveCacheDELETE removes cached resolutions, forcing the skylinks to be
+// resolved by skyd again. This is useful when a V2 skylink got updated to
+// point to other content. If the 'skylink' parameter is set, only that
+// skylink is removed, otherwise the whole cache is cleared.
+func (api *API) resolveCacheDELETE(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var skylinks []skymodules.Skylink
+	if str := r.FormValue("skylink"); str != "" {
+		sl, err := parseSkylink(str)
+		if err != nil {
+			WriteError(w, errors.AddContext(err, "invalid value for 'skylink' parameter"), http.StatusBadRequest)
+			return
+		}
+		skylinks = append(skylinks, sl)
+	}
+	skyapi.WriteJSON(w, ResolveCacheDELETE{
+		Removed: api.staticSkydClient.InvalidateResolveCache(skylinks...),
+	})
+}
+
+// maintenancePUT replaces the schedule of the blocker's maintenance windows
+// with the schedule in the 'schedule' parameter, e.g. '02:00-03:30', without
+// restarting the blocker. An empty schedule removes all maintenance windows.
+func (api *API) maintenancePUT(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	err := api.staticBlocker.SetMaintenanceSchedule(r.FormValue("schedule"))
+	if err != nil {
+		WriteError(w, errors.AddContext(err, "invalid value for 'schedule' parameter"), http.StatusBadRequest)
+		return
+	}
+	skyapi.WriteJSON(w, api.staticBlocker.SweepStatus())
+}
+
+// suspendPUT suspends or resumes the blocker's sweeps, depending on the
+// 'suspended' parameter, without restarting the blocker. The blocker keeps
+// reporting healthy while its sweeps are suspended.
+func (api *API) suspendPUT(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	suspended, err := strconv.ParseBool(r.FormValue("suspended"))
+	if err != nil {
+		WriteError(w, errors.AddContext(err, "invalid value for 'suspended' parameter"), http.StatusBadRequest)
+		return
+	}
+	api.staticBlocker.SetSuspended(suspended)
+	skyapi.WriteJSON(w, api.staticBlocker.SweepStatus())
+}
+
+// sweepIntervalPUT sets the amount of time the blocker waits between sweeps
+// to the duration in the 'interval' parameter, e.g. '10s', without restarting
+// the blocker. An empty interval resets it to the default.
+func (api *API) sweepIntervalPUT(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var interval time.Duration
+	if intervalStr := r.FormValue("interval"); intervalStr != "" {
+		var err error
+		interval, err = time.ParseDuration(intervalStr)
+		if err != nil {
+			WriteError(w, errors.AddContext(err, "invalid value for 'interval' parameter"), http.StatusBadRequest)
+			return
+		}
+		if interval <= 0 {
+			WriteError(w, errors.New("invalid value for 'interval' parameter, it has to be positive"), http.StatusBadRequest)
+			return
+		}
+	}
+	err := api.staticBlocker.SetSweepInterval(interval)
+	if err != nil {
+		WriteError(w, errors.AddContext(err, "invalid value for 'interval' parameter"), http.StatusBadRequest)
+		return
+	}
+	skyapi.WriteJSON(w, api.staticBlocker.SweepStatus())
+}
+
+// sourcePUT disables or enables the report source in the 'source' parameter,
+// depending on the 'enabled' parameter. The skylinks that were only reported
+// by a disabled source are not blocked, the ones that were blocked already
+// stay blocked.
+func (api *API) sourcePUT(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	source := r.FormValue("source")
+	if source == "" {
+		WriteError(w, errors.New("parameter 'source' is required"), http.StatusBadRequest)
+		return
+	}
+	enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+	if err != nil {
+		WriteError(w, errors.AddContext(err, "invalid value for 'enabled' parameter"), http.StatusBadRequest)
+		return
+	}
+	err = api.staticBlocker.SetSourceEnabled(r.Context(), source, enabled)
+	if err != nil {
+		WriteError(w, errors.AddContext(err, "failed to update source"), http.StatusInternalServerError)
+		return
+	}
+	disabled, err := api.staticDB.DisabledSources(r.Context())
+	if err != nil {
+		WriteError(w, errors.AddContext(err, "failed to fetch the disabled sources"), http.StatusInternalServerError)
+		return
+	}
+	skyapi.WriteJSON(w, SourcePUT{DisabledSources: disabled})
+}
+
+// snapshotPOST creates a snapshot of the blocklist with the label in the
+// 'label' parameter and the optional 'note', e.g. before a bulk import. The
+// blocks of the skylinks that get added after it can be reversed through
+// snapshotRestorePOST.
+func (api *API) snapshotPOST(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	label := r.FormValue("label")
+	if label == "" {
+		WriteError(w, errors.New("parameter 'label' is required"), http.StatusBadRequest)
+		return
+	}
+	snapshot, err := api.staticDB.CreateSnapshot(r.Context(), label, r.FormValue("note"))
+	if errors.Contains(err, database.ErrSnapshotExists) {
+		WriteError(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		WriteError(w, errors.AddContext(err, "failed to create snapshot"), http.StatusInternalServerError)
+		return
+	}
+	api.staticLogger.Infof("created snapshot '%s'", label)
+	skyapi.WriteJSON(w, SnapshotPOST{
+		Label:     snapshot.Label,
+		Note:      snapshot.Note,
+		Timestamp: snapshot.Timestamp,
+	})
+}
+
+// snapshotRestorePOST reverses the blocks of the skylinks that were added after
+// the snapshot with the label in the 'label' parameter. If the 'dryrun'
+// parameter is set the hashes that would be reverted are returned without
+// reverting them.
+func (api *API) snapshotRestorePOST(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	label := r.FormValue("label")
+	if label == "" {
+		WriteError(w, errors.New("parameter 'label' is required"), http.StatusBadRequest)
+		return
+	}
+	var dryRun bool
+	if dryRunStr := r.FormValue("dryrun"); dryRunStr != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(dryRunStr)
+		if err != nil {
+			WriteError(w, errors.AddContext(err, "invalid value for 'dryrun' parameter"), http.StatusBadRequest)
+			return
+		}
+	}
+	restore, err := api.staticBlocker.RestoreToSnapshot(r.Context(), label, dryRun)
+	if errors.Contains(err, database.ErrNoDocumentsFound) {
+		WriteError(w, fmt.Errorf("snapshot '%s' not found", label), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		WriteError(w, errors.AddContext(err, "failed to restore snapshot"), http.StatusInternalServerError)
+		return
+	}
+	skyapi.WriteJSON(w, restore)
+}
+
+// testRecordsDELETE purges all test records from the database, they are not
+// unblocked in skyd.
+func (api *API) testRecordsDELETE(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	removed, err := api.staticDB.PurgeTestRecords(r.Context())
+	if err != nil {
+		WriteError(w, errors.AddContext(err, "failed to purge test records"), http.StatusInternalServerError)
+		return
+	}
+	api.staticLogger.Infof("purged %v test records", removed)
+	skyapi.WriteJSON(w, TestRecordsDELETE{Removed: removed})
+}
+
+// sourcesGET returns the number of blocked skylinks per source. The counts can
+// be limited to a time range through the optional 'from' and 'to' parameters,
+// which are either unix timestamps or RFC3339 formatted. Test records are only
+// counted if the 'includetest' parameter is set.
+func (api *API) sourcesGET(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// parse the optional time range
+	var from, to time.Time
+	var err error
+	if fromStr := r.FormValue("from"); fromStr != "" {
+		from, err = parseTimestamp(fromStr)
+		if err != nil {
+			WriteError(w, errors.AddContext(err, "invalid value for 'from' parameter"), http.StatusBadRequest)
+			return
+		}
+	}
+	if toStr := r.FormValue("to"); toStr != "" {
+		to, err = parseTimestamp(toStr)
+		if err != nil {
+			WriteError(w, errors.AddContext(err, "invalid value for 'to' parameter"), http.StatusBadRequest)
+			return
+		}
+	}
+	includeTest, err := parseIncludeTest(r)
+	if err != nil {
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	counts, err := api.staticDB.BlockCountsBySource(r.Context(), from, to, includeTest)
+	if err != nil {
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	sources := make([]SourceCount, len(counts))
+	for i, count := range counts {
+		sources[i] = SourceCount{
+			Source: count.Source,
+			Count:  count.Count,
+		}
+	}
+	skyapi.WriteJSON(w, SourcesGET{Sources: sources})
+}
+
+// reportGET returns all skylinks that were blocked in the time range given by
+// the 'from' and 'to' parameters, the start is inclusive and the end is
+// exclusive. The report is emitted as JSON array by default, or as CSV if the
+// 'format' parameter is 'csv'. Test records are only included if the
+// 'includetest' parameter is set. The skylinks are streamed from the database,
+// which means an error halfway through can only be signalled by aborting the
+// response.
+func (api *API) reportGET(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// parse the time range
+	from, err := parseTimestamp(r.FormValue("from"))
+	if err != nil {
+		WriteError(w, errors.AddContext(err, "invalid value for 'from' parameter"), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimestamp(r.FormValue("to"))
+	if err != nil {
+		WriteError(w, errors.AddContext(err, "invalid value for 'to' parameter"), http.StatusBadRequest)
+		return
+	}
+	if !from.Before(to) {
+		WriteError(w, errors.New("'from' has to be before 'to'"), http.StatusBadRequest)
+		return
+	}
+
+	// parse the format
+	format := strings.ToLower(r.FormValue("format"))
+	if format == "" {
+		format = reportFormatJSON
+	}
+	if format != reportFormatCSV && format != reportFormatJSON {
+		WriteError(w, fmt.Errorf("invalid value for 'format' parameter, can only be '%v' or '%v'", reportFormatCSV, reportFormatJSON), http.StatusBadRequest)
+		return
+	}
+	includeTest, err := parseIncludeTest(r)
+	if err != nil {
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// stream the report
+	if format == reportFormatCSV {
+		err = api.writeReportCSV(r.Context(), w, from, to, includeTest)
+	} else {
+		err = api.writeReportJSON(r.Context(), w, from, to, includeTest)
+	}
+	if err != nil {
+		api.staticLogger.Errorf("failed to write report for range %v to %v: %v", from, to, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// writeReportCSV streams the report for the given time range as CSV.
+func (api *API) writeReportCSV(ctx context.Context, w http.ResponseWriter, from, to time.Time, includeTest bool) error {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="report-%s-%s.csv"`, from.Format("20060102"), to.Format("20060102")))
+
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"hash", "source", "reporter", "legalbasis", "timestamp"})
+	if err != nil {
+		return err
+	}
+	err = api.staticDB.ForEachBlockedSkylinkInRange(ctx, from, to, includeTest, func(bsl database.BlockedSkylink) error {
+		entry := newReportEntry(bsl)
+		contact := entry.Reporter.Email
+		if contact == "" {
+			contact = entry.Reporter.OtherContact
+		}
+		return cw.Write([]string{
+			bsl.Hash.String(),
+			entry.Source,
+			contact,
+			entry.LegalBasis,
+			entry.Timestamp.Format(time.RFC3339),
+		})
+	})
+	cw.Flush()
+	return errors.Compose(err, cw.Error())
+}
+
+// writeReportJSON streams the report for the given time range as JSON array.
+func (api *API) writeReportJSON(ctx context.Context, w http.ResponseWriter, from, to time.Time, includeTest bool) error {
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err := w.Write([]byte("["))
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	first := true
+	err = api.staticDB.ForEachBlockedSkylinkInRange(ctx, from, to, includeTest, func(bsl database.BlockedSkylink) error {
+		if !first {
+			_, err := w.Write([]byte(","))
+			if err != nil {
+				return err
+			}
+		}
+		first = false
+		return enc.Encode(newReportEntry(bsl))
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write([]byte("]"))
+	return err
+}
+
+// newReportEntry converts the given blocked skylink into a report entry. The
+// source is the name of the reporter, which for skylinks that were synced
+// from other portals is the portal's URL.
+func newReportEntry(bsl database.BlockedSkylink) ReportEntry {
+	return ReportEntry{
+		Hash:   bsl.Hash.Hash,
+		Source: bsl.Reporter.Name,
+		Reporter: Reporter{
+			Name:         bsl.Reporter.Name,
+			Email:        bsl.Reporter.Email,
+			OtherContact: bsl.Reporter.OtherContact,
+		},
+		LegalBasis: bsl.LegalBasis,
+		Timestamp:  bsl.TimestampAdded.UTC(),
+	}
+}
+
+// statusGET returns the block status of the given skylink, as recorded in the
+// database. The skylink can be either a V1 or a V2 skylink, the latter is
+// resolved before checking. The annotations and the metadata of the skylink
+// are meant for the moderators, they are only returned by adminStatusGET.
+func (api *API) statusGET(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	api.writeBlockStatus(w, r, ps, false)
+}
+
+// adminStatusGET returns the block status of the given skylink. Unlike
+// statusGET it cross-checks the skylink's record in the database against
+// skyd's blocklist.
+func (api *API) adminStatusGET(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	api.writeBlockStatus(w, r, ps, true)
+}
+
+// writeBlockStatus writes the block status of the skylink in the given params,
+// optionally cross-checked against skyd's blocklist. Only the admin route
+// cross-checks skyd, so the annotations and the metadata are stripped from the
+// status if checkSkyd is not set.
+func (api *API) writeBlockStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params, checkSkyd bool) {
+	sl, err := parseSkylink(ps.ByName("skylink"))
+	if err != nil {
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	status, err := api.staticBlocker.BlockStatus(r.Context(), sl.String(), checkSkyd)
+	if err != nil {
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if !checkSkyd {
+		status.Annotations = nil
+		status.Metadata = nil
+	}
 	skyapi.WriteJSON(w, status)
 }
 
-// blockPOST blocks a skylink
+// utilHashGET returns the hash the blocker uses for the given skylink, V2
+// skylinks are resolved to the V1 skylink they point to. This allows cross
+// checking a skylink against the blocklist of skyd.
+func (api *API) utilHashGET(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	sl, err := parseSkylink(ps.ByName("skylink"))
+	if err != nil {
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+	resp := UtilHashGET{Skylink: sl.String()}
+
+	// resolve V2 skylinks, keeping track of the V2 skylink's hash
+	if sl.IsSkylinkV2() {
+		v2Hash := database.NewHash(sl)
+		resp.V2Hash = &v2Hash
+
+		sl, err = api.staticBlocker.ResolveSkylink(r.Context(), sl)
+		if errors.Contains(err, ErrResolveTimeout) {
+			WriteError(w, errors.AddContext(err, "failed to resolve skylink"), http.StatusGatewayTimeout)
+			return
+		}
+		if err != nil {
+			WriteError(w, errors.AddContext(err, "failed to resolve skylink"), http.StatusInternalServerError)
+			return
+		}
+		resp.Resolved = sl.String()
+	}
+
+	resp.Hash, err = database.HashFromSkylink(sl.String())
+	if err != nil {
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+	skyapi.WriteJSON(w, resp)
+}
+
+// retryPOST retries all hashes that failed to get blocked, without waiting for
+// the blocker's retry loop. This is useful after fixing whatever made skyd
+// fail, it does not touch the latest block timestamp. Hashes that fail again
+// are not considered an error, they remain failed and the error is returned
+// in the response. The retry stops when the client goes away.
+func (api *API) retryPOST(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	retried, stillFailed, err := api.staticBlocker.RetryFailed(r.Context())
+
+	// the client went away, there's no one to respond to
+	if r.Context().Err() != nil {
+		api.staticLogger.Infof("retry cancelled, %v of %v hashes are still failed", stillFailed, retried)
+		return
+	}
+	if errors.Contains(err, ErrMaintenance) {
+		WriteError(w, err, http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil && retried == 0 {
+		WriteError(w, errors.AddContext(err, "failed to retry failed hashes"), http.StatusInternalServerError)
+		return
+	}
+	resp := RetryPOST{
+		Retried:     retried,
+		StillFailed: stillFailed,
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	skyapi.WriteJSON(w, resp)
+}
+
+// integrityPOST scans the database for skylinks that are malformed or in an
+// inconsistent state and returns a report of the problems it found. The
+// trivially fixable problems are repaired if the 'repair' parameter is set to
+// true. The scan reads the entire collection, it's meant to run periodically.
+func (api *API) integrityPOST(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var repair bool
+	if repairStr := r.FormValue("repair"); repairStr != "" {
+		var err error
+		repair, err = strconv.ParseBool(repairStr)
+		if err != nil {
+			WriteError(w, errors.AddContext(err, "invalid value for 'repair' parameter"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := api.staticBlocker.ScanIntegrity(r.Context(), repair)
+	if err != nil {
+		WriteError(w, errors.AddContext(err, "failed to scan integrity"), http.StatusInternalServerError)
+		return
+	}
+	resp := IntegrityPOST{
+		Scanned:  report.Scanned,
+		Problems: make([]IntegrityProblem, len(report.Problems)),
+	}
+	for i, problem := range report.Problems {
+		ids := make([]string, len(problem.SampleIDs))
+		for j, id := range problem.SampleIDs {
+			ids[j] = id.Hex()
+		}
+		resp.Problems[i] = IntegrityProblem{
+			Type:      problem.Type,
+			Count:     problem.Count,
+			Repaired:  problem.Repaired,
+			SampleIDs: ids,
+		}
+	}
+	skyapi.WriteJSON(w, resp)
+}
+
+// reblockPOST blocks all skylinks that were reported in the given time range
+// again. This allows repairing ranges that were skipped by the blocker without
+// touching the latest block timestamp. The time range is passed through the
+// 'from' and 'to' parameters, which are either unix timestamps or RFC3339
+// formatted. The progress is streamed as newline delimited JSON objects.
+func (api *API) reblockPOST(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// parse the time range
+	from, err := parseTimestamp(r.FormValue("from"))
+	if err != nil {
+		WriteError(w, errors.AddContext(err, "invalid value for 'from' parameter"), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimestamp(r.FormValue("to"))
+	if err != nil {
+		WriteError(w, errors.AddContext(err, "invalid value for 'to' parameter"), http.StatusBadRequest)
+		return
+	}
+	if !from.Before(to) {
+		WriteError(w, errors.New("'from' has to be before 'to'"), http.StatusBadRequest)
+		return
+	}
+
+	// the blocker rejects blocks during maintenance, so we reject the
+	// request rather than streaming a failure for every chunk
+	if api.staticBlocker.SweepStatus().Maintenance {
+		WriteError(w, ErrMaintenance, http.StatusServiceUnavailable)
+		return
+	}
+
+	// fetch the hashes in the given range
+	hashes, err := api.staticDB.HashesInRange(r.Context(), from, to)
+	if err != nil {
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	api.staticLogger.Infof("reblocking %v hashes reported between %v and %v", len(hashes), from, to)
+
+	// block the hashes in chunks, streaming the progress after every chunk
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	progress := ReblockPOST{Total: len(hashes)}
+	for start := 0; start < len(hashes); start += reblockChunkSize {
+		end := start + reblockChunkSize
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+
+		// hashes that failed to get blocked are retried by the blocker's
+		// retry loop, so we keep going
+		chunk := hashes[start:end]
+		blocked, invalid, err := api.staticBlocker.BlockHashes(r.Context(), chunk)
+		if err != nil {
+			api.staticLogger.Errorf("failed to reblock hashes: %v", err)
+		}
+
+		// the client went away, there's no point in reblocking the rest
+		if r.Context().Err() != nil {
+			api.staticLogger.Infof("reblock cancelled after %v of %v hashes", progress.Processed, len(hashes))
+			return
+		}
+		progress.Processed += len(chunk)
+		progress.Blocked += blocked
+		progress.Invalid += invalid
+		progress.Failed += len(chunk) - blocked - invalid
+
+		if err := enc.Encode(progress); err != nil {
+			api.staticLogger.Errorf("failed to write reblock progress: %v", err)
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	// write the summary
+	progress.Done = true
+	if err := enc.Encode(progress); err != nil {
+		api.staticLogger.Errorf("failed to write reblock summary: %v", err)
+	}
+}
+
+// blockPOST blocks a skylink
+//
+// NOTE: This route requires no authentication and thus it is meant to be used
+// by trusted sources such as the malware scanner or abuse email scanner. There
+// is another route called 'blockWithPoWPOST' that requires some proof of work
+// to be done by means of 'authenticating' the caller.
+func (api *API) blockPOST(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// Protect against large bodies.
+	b := http.MaxBytesReader(w, r.Body, api.staticMaxBlockBodySize)
+	defer b.Close()
+
+	// Parse the request, the skylinks and hashes are decoded as they are
+	// read rather than buffering the entire body.
+	body, err := decodeBlockBulkPOST(b)
+	if isBodyTooLarge(err) {
+		api.writeBodyTooLarge(w)
+		return
+	}
+	if err != nil {
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Get the sub from the form
+	sub := r.FormValue("sub")
+	if sub == "" {
+		// No sub. Maybe we didn't try to fetch it? Try now. Don't log errors.
+		u, err := UserFromReq(r, api.staticLogger)
+		if err == nil {
+			sub = u.Sub
+		}
+	}
+
+	// Handle the request
+	if body.FollowManifest {
+		api.handleManifestBlockRequest(r.Context(), w, body, sub)
+		return
+	}
+	if body.isBulk() {
+		api.handleBulkBlockRequest(r.Context(), w, body, sub)
+		return
+	}
+	api.handleBlockRequest(r.Context(), w, body.BlockPOST, sub)
+}
+
+// blockTextPOST blocks all skylinks found in the raw text in the request body,
+// e.g. an abuse email. The skylinks are extracted using ExtractSkylinks. As
+// the body is not JSON, the reporter, tags and legal basis are passed as query
+// string parameters: 'name', 'email', 'othercontact', 'tags', which is a comma
+// separated list, 'legalbasis', 'reportid' and 'test'.
 //
-// NOTE: This route requires no authentication and thus it is meant to be used
-// by trusted sources such as the malware scanner or abuse email scanner. There
-// is another route called 'blockWithPoWPOST' that requires some proof of work
-// to be done by means of 'authenticating' the caller.
-func (api *API) blockPOST(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+// NOTE: like blockPOST this route requires no authentication and is meant to
+// be used by trusted sources.
+func (api *API) blockTextPOST(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	// Protect against large bodies.
-	b := http.MaxBytesReader(w, r.Body, maxBodySize)
+	b := http.MaxBytesReader(w, r.Body, api.staticMaxBlockBodySize)
 	defer b.Close()
 
-	// Parse the request.
-	var body BlockPOST
-	err := json.NewDecoder(b).Decode(&body)
+	// Read the text.
+	text, err := ioutil.ReadAll(b)
+	if isBodyTooLarge(err) {
+		api.writeBodyTooLarge(w)
+		return
+	}
 	if err != nil {
 		WriteError(w, err, http.StatusBadRequest)
 		return
 	}
 
-	// Get the sub from the form
-	sub := r.FormValue("sub")
+	// Parse the query string, we don't use FormValue as that would try to
+	// parse the body as form.
+	query := r.URL.Query()
+	var bp BlockBulkPOST
+	bp.Reporter = Reporter{
+		Name:         query.Get("name"),
+		Email:        query.Get("email"),
+		OtherContact: query.Get("othercontact"),
+	}
+	for _, tag := range strings.Split(query.Get("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			bp.Tags = append(bp.Tags, tag)
+		}
+	}
+	bp.LegalBasis = query.Get("legalbasis")
+	bp.ReportID = query.Get("reportid")
+	if testStr := query.Get("test"); testStr != "" {
+		bp.Test, err = strconv.ParseBool(testStr)
+		if err != nil {
+			WriteError(w, fmt.Errorf("invalid value for 'test' parameter, '%v' is not a boolean", testStr), http.StatusBadRequest)
+			return
+		}
+	}
+	err = errors.Compose(bp.validate(), api.validateLegalBasis(bp.BlockPOST))
+	if err != nil {
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Extract the skylinks.
+	extracted := ExtractSkylinks(string(text))
+	if len(extracted) == 0 {
+		WriteError(w, errors.New("no skylinks found in text"), http.StatusBadRequest)
+		return
+	}
+	for _, sl := range extracted {
+		bp.Skylinks = append(bp.Skylinks, skylink(sl))
+	}
+
+	// Get the sub from the query string
+	sub := query.Get("sub")
 	if sub == "" {
 		// No sub. Maybe we didn't try to fetch it? Try now. Don't log errors.
 		u, err := UserFromReq(r, api.staticLogger)
@@ -210,8 +1632,16 @@ func (api *API) blockPOST(w http.ResponseWriter, r *http.Request, _ httprouter.P
 		}
 	}
 
-	// Handle the request
-	api.handleBlockRequest(r.Context(), w, body, sub)
+	// Block the skylinks.
+	resp, err := api.blockBulk(r.Context(), bp, sub)
+	if err != nil {
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+	skyapi.WriteJSON(w, BlockTextResponse{
+		BlockBulkResponse: resp,
+		Extracted:         extracted,
+	})
 }
 
 // blockWithPoWPOST blocks a skylink. It is meant to be used by untrusted
@@ -232,6 +1662,13 @@ func (api *API) blockWithPoWPOST(w http.ResponseWriter, r *http.Request, _ httpr
 		return
 	}
 
+	// Following the manifest expands the scope of the report, which we only
+	// allow trusted sources to do.
+	if body.FollowManifest {
+		WriteError(w, errors.New("followmanifest is not supported for reports with proof of work"), http.StatusBadRequest)
+		return
+	}
+
 	// Use the MySkyID as the sub to consider the reporter authenticated.
 	sub := hex.EncodeToString(body.PoW.MySkyID[:])
 
@@ -257,13 +1694,23 @@ func (api *API) blockWithPoWGET(w http.ResponseWriter, r *http.Request, _ httpro
 // block handlers. It executes all code which is shared between the two
 // handlers.
 func (api *API) handleBlockRequest(ctx context.Context, w http.ResponseWriter, bp BlockPOST, sub string) {
+	// Ensure the legal basis is specified if required
+	err := api.validateLegalBasis(bp)
+	if err != nil {
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+
 	// Resolve the post body into a hash
-	hash, err := api.resolveHash(bp)
+	hash, v2Hash, err := api.resolveHash(ctx, bp)
 	if err != nil {
 		// return an internal server error if the resolve failed due to skyd
-		// either being down or behaving unexpectedly
+		// either being down or behaving unexpectedly, if skyd was too slow we
+		// return a gateway timeout to indicate the caller should try again
 		code := http.StatusBadRequest
-		if errors.Contains(err, errResolve) {
+		if errors.Contains(err, ErrResolveTimeout) {
+			code = http.StatusGatewayTimeout
+		} else if errors.Contains(err, errResolve) {
 			code = http.StatusInternalServerError
 		}
 		WriteError(w, errors.AddContext(err, "failed to resolve hash"), code)
@@ -272,7 +1719,7 @@ func (api *API) handleBlockRequest(ctx context.Context, w http.ResponseWriter, b
 
 	// Check whether the skylink is on the allow list
 	if api.isAllowListed(ctx, hash) {
-		skyapi.WriteJSON(w, statusResponse{"reported"})
+		skyapi.WriteJSON(w, statusResponse{Status: "reported"})
 		return
 	}
 
@@ -286,23 +1733,314 @@ func (api *API) handleBlockRequest(ctx context.Context, w http.ResponseWriter, b
 			Sub:             sub,
 			Unauthenticated: sub == "",
 		},
+		LegalBasis:     bp.LegalBasis,
+		ReportID:       bp.ReportID,
 		Tags:           bp.Tags,
+		Test:           bp.Test,
 		TimestampAdded: time.Now().UTC(),
 	}
+	if bs.ReportID == "" {
+		bs.ReportID = database.NewReportID()
+	}
+	logger := api.staticLogger.WithFields(logrus.Fields{
+		"hash":     bs.Hash.String(),
+		"reportid": bs.ReportID,
+	})
 
 	// Block the link.
-	api.staticLogger.Debugf("blocking hash %s", bs.Hash)
+	logger.Debug("blocking hash")
 	err = api.staticDB.CreateBlockedSkylink(ctx, bs)
-	if errors.Contains(err, database.ErrSkylinkExists) {
-		skyapi.WriteJSON(w, statusResponse{"duplicate"})
+	exists := errors.Contains(err, database.ErrSkylinkExists)
+	if err != nil && !exists {
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// Keep track of the V2 skylink that resolved to the blocked skylink and
+	// block its registry entry
+	if v2Hash != (crypto.Hash{}) {
+		err = api.staticDB.AddV2Pointer(ctx, bs.Hash, database.Hash{Hash: v2Hash})
+		if err != nil {
+			api.staticLogger.Errorf("failed to record V2 pointer for hash %s, err: %v", bs.Hash, err)
+		}
+		err = api.blockRegistryEntry(ctx, *bs, database.Hash{Hash: v2Hash})
+		if err != nil {
+			api.staticLogger.Errorf("failed to block registry entry of V2 skylink that resolved to hash %s, err: %v", bs.Hash, err)
+		}
+	}
+	if exists {
+		// return the report ID of the report that got the skylink blocked
+		reportID := bs.ReportID
+		doc, err := api.staticDB.FindByHash(ctx, bs.Hash)
+		if err == nil && doc != nil && doc.ReportID != "" {
+			reportID = doc.ReportID
+		}
+		logger.Debugf("hash already blocked by report %s", reportID)
+		skyapi.WriteJSON(w, statusResponse{Status: "duplicate", ReportID: reportID})
+		return
+	}
+	logger.Debug("blocked hash")
+
+	// Enrich the blocked skylink with its metadata in the background
+	if api.staticFetchMetadata && bp.Skylink != "" {
+		go api.threadedFetchMetadata(logger, string(bp.Skylink), bs.Hash)
+	}
+	skyapi.WriteJSON(w, statusResponse{Status: "reported", ReportID: bs.ReportID})
+}
+
+// threadedFetchMetadata fetches the metadata of the given skylink from skyd
+// and records it on the blocked skylink with the given hash. It's best-effort,
+// failing to do so is logged but does not affect the block.
+func (api *API) threadedFetchMetadata(logger *logrus.Entry, skylink string, hash database.Hash) {
+	sl, err := parseSkylink(skylink)
+	if err != nil {
+		logger.Debugf("failed to parse skylink to fetch its metadata: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), metadataTimeout)
+	defer cancel()
+	metadata, err := api.staticSkydClient.SkylinkMetadata(ctx, sl)
+	if err != nil {
+		logger.Debugf("failed to fetch skylink metadata: %v", err)
+		return
+	}
+
+	dbCtx, dbCancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer dbCancel()
+	err = api.staticDB.SetMetadata(dbCtx, hash, database.SkylinkMetadata{
+		ContentType:      metadata.ContentType,
+		Filename:         metadata.Filename,
+		Length:           metadata.Length,
+		TimestampFetched: time.Now().UTC(),
+	})
+	if err != nil {
+		logger.Errorf("failed to record skylink metadata: %v", err)
+	}
+}
+
+// handleBulkBlockRequest is a bulk version of handleBlockRequest, it reports
+// all skylinks and hashes in the given request at once. Skylinks that can not
+// be resolved are returned as invalids, skylinks that were already reported
+// are skipped.
+func (api *API) handleBulkBlockRequest(ctx context.Context, w http.ResponseWriter, bp BlockBulkPOST, sub string) {
+	err := errors.Compose(bp.validate(), api.validateLegalBasis(bp.BlockPOST))
+	if err != nil {
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+	resp, err := api.blockBulk(ctx, bp, sub)
+	if err != nil {
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+	skyapi.WriteJSON(w, resp)
+}
+
+// handleManifestBlockRequest reports the skapp of the given block post along
+// with the skylinks referenced by its manifest, using the same reporter, tags
+// and report ID. Skapps without a manifest are reported on their own. If the
+// manifest can't be fetched nothing is reported, the caller should retry.
+func (api *API) handleManifestBlockRequest(ctx context.Context, w http.ResponseWriter, bp BlockBulkPOST, sub string) {
+	if bp.isBulk() || bp.Skylink == "" {
+		WriteError(w, errors.New("followmanifest requires a single skylink"), http.StatusBadRequest)
+		return
+	}
+	err := errors.Compose(bp.BlockPOST.validate(), api.validateLegalBasis(bp.BlockPOST))
+	if err != nil {
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+	var sl skymodules.Skylink
+	err = sl.LoadString(string(bp.Skylink))
+	if err != nil {
+		WriteError(w, errors.AddContext(err, "failed to load skylink"), http.StatusBadRequest)
+		return
+	}
+
+	// Fetch the skylinks referenced by the manifest
+	referenced, err := api.staticSkydClient.ManifestSkylinks(ctx, sl)
+	if errors.Contains(err, ErrNoManifest) {
+		referenced, err = []string{}, nil
+	}
+	if err != nil {
+		WriteError(w, errors.AddContext(err, "failed to fetch manifest"), http.StatusInternalServerError)
 		return
 	}
+
+	// Report the skapp and the referenced skylinks in bulk
+	bp.Skylinks = []skylink{bp.Skylink}
+	for _, ref := range referenced {
+		bp.Skylinks = append(bp.Skylinks, skylink(ref))
+	}
+	bp.Skylink = ""
+	resp, err := api.blockBulk(ctx, bp, sub)
 	if err != nil {
 		WriteError(w, err, http.StatusInternalServerError)
 		return
 	}
-	api.staticLogger.Debugf("blocked hash %s", bs.Hash)
-	skyapi.WriteJSON(w, statusResponse{"reported"})
+	api.staticLogger.WithField("reportid", resp.ReportID).Infof("reported skapp %v along with %v skylinks referenced by its manifest", sl, len(referenced))
+	skyapi.WriteJSON(w, BlockManifestResponse{
+		BlockBulkResponse: resp,
+		Referenced:        referenced,
+	})
+}
+
+// blockBulk reports all hashes and skylinks of the given, validated, bulk
+// block post. Skylinks that can't be resolved are returned as invalid inputs
+// rather than failing the whole request.
+func (api *API) blockBulk(ctx context.Context, bp BlockBulkPOST, sub string) (BlockBulkResponse, error) {
+	resp := BlockBulkResponse{
+		Status:   "reported",
+		ReportID: bp.ReportID,
+		Invalids: []InvalidInput{},
+	}
+	if resp.ReportID == "" {
+		resp.ReportID = database.NewReportID()
+	}
+
+	// Decode the skylinks
+	inputs := make([]skylink, 0, len(bp.Skylinks))
+	parsed := make([]skymodules.Skylink, 0, len(bp.Skylinks))
+	for _, sl := range bp.Skylinks {
+		var parsedSl skymodules.Skylink
+		err := parsedSl.LoadString(string(sl))
+		if err != nil {
+			err = errors.AddContext(err, "failed to load skylink")
+			resp.Invalids = append(resp.Invalids, InvalidInput{Input: string(sl), Error: err.Error()})
+			continue
+		}
+		inputs = append(inputs, sl)
+		parsed = append(parsed, parsedSl)
+	}
+
+	// Resolve all skylinks into hashes in a single batch, keeping track of
+	// the V2 skylinks
+	hashes := make([]database.Hash, 0, len(bp.Hashes)+len(bp.MerkleRoots)+len(parsed))
+	for _, hash := range bp.Hashes {
+		hashes = append(hashes, database.Hash{Hash: hash})
+	}
+	for _, root := range bp.MerkleRoots {
+		b, err := hex.DecodeString(root)
+		if err != nil {
+			err = errors.AddContext(err, "failed to decode merkle root")
+			resp.Invalids = append(resp.Invalids, InvalidInput{Input: root, Error: err.Error()})
+			continue
+		}
+		sl, err := SkylinkFromMerkleRoot(b)
+		if err != nil {
+			resp.Invalids = append(resp.Invalids, InvalidInput{Input: root, Error: err.Error()})
+			continue
+		}
+		hashes = append(hashes, database.NewHash(sl))
+	}
+	v2Hashes := make(map[database.Hash]database.Hash)
+	for i, res := range api.staticBlocker.ResolveSkylinks(ctx, parsed) {
+		if res.Err != nil || !res.Resolved.IsSkylinkV1() {
+			err := errors.Compose(res.Err, errResolve)
+			resp.Invalids = append(resp.Invalids, InvalidInput{Input: string(inputs[i]), Error: err.Error()})
+			continue
+		}
+		hash := database.NewHash(res.Resolved)
+		hashes = append(hashes, hash)
+		if parsed[i].IsSkylinkV2() {
+			v2Hashes[hash] = database.NewHash(parsed[i])
+		}
+	}
+
+	// Skip the hashes that are on the allow list
+	allowListed, err := api.staticDB.AllowListedHashes(ctx, hashes)
+	if err != nil {
+		return BlockBulkResponse{}, errors.AddContext(err, "failed to verify skylinks against the allow list")
+	}
+
+	// Create the blocked skylink objects
+	now := time.Now().UTC()
+	skylinks := make([]database.BlockedSkylink, 0, len(hashes))
+	for _, hash := range hashes {
+		if _, exists := allowListed[hash]; exists {
+			resp.AllowListed++
+			continue
+		}
+		skylinks = append(skylinks, database.BlockedSkylink{
+			Hash: hash,
+			Reporter: database.Reporter{
+				Name:            bp.Reporter.Name,
+				Email:           bp.Reporter.Email,
+				OtherContact:    bp.Reporter.OtherContact,
+				Sub:             sub,
+				Unauthenticated: sub == "",
+			},
+			LegalBasis:     bp.LegalBasis,
+			ReportID:       resp.ReportID,
+			Tags:           bp.Tags,
+			Test:           bp.Test,
+			TimestampAdded: now,
+		})
+	}
+
+	// Block the links, duplicates are skipped by the database.
+	logger := api.staticLogger.WithField("reportid", resp.ReportID)
+	logger.Debugf("blocking %v hashes", len(skylinks))
+	resp.Inserted, err = api.staticDB.CreateBlockedSkylinkBulk(ctx, skylinks)
+	if err != nil {
+		return BlockBulkResponse{}, err
+	}
+	resp.Duplicates = len(skylinks) - resp.Inserted
+	logger.Debugf("blocked %v hashes, %v duplicates", resp.Inserted, resp.Duplicates)
+
+	// Keep track of the V2 skylinks that resolved to the blocked skylinks
+	// and block their registry entries
+	for _, bs := range skylinks {
+		v2Hash, exists := v2Hashes[bs.Hash]
+		if !exists {
+			continue
+		}
+		err = api.staticDB.AddV2Pointer(ctx, bs.Hash, v2Hash)
+		if err != nil {
+			logger.Errorf("failed to record V2 pointer for hash %s, err: %v", bs.Hash, err)
+		}
+		err = api.blockRegistryEntry(ctx, bs, v2Hash)
+		if err != nil {
+			logger.Errorf("failed to block registry entry of V2 skylink that resolved to hash %s, err: %v", bs.Hash, err)
+		}
+	}
+	return resp, nil
+}
+
+// blockRegistryEntry records the registry entry of a reported V2 skylink as a
+// blocked skylink of its own, which makes the sweep block it in skyd alongside
+// the V1 skylink it resolved to. This prevents the V2 skylink from serving
+// other content after it's updated to point elsewhere. The registry entry
+// inherits the report of the given blocked V1 skylink.
+func (api *API) blockRegistryEntry(ctx context.Context, bs database.BlockedSkylink, v2Hash database.Hash) error {
+	entry := database.BlockedSkylink{
+		Hash:       v2Hash,
+		LegalBasis: bs.LegalBasis,
+		RegistryEntry: &database.RegistryEntry{
+			ResolvedTo:        bs.Hash,
+			TimestampResolved: time.Now().UTC(),
+		},
+		ReportID:       bs.ReportID,
+		Reporter:       bs.Reporter,
+		Tags:           bs.Tags,
+		Test:           bs.Test,
+		TimestampAdded: time.Now().UTC(),
+	}
+	err := api.staticDB.CreateBlockedSkylink(ctx, &entry)
+	if errors.Contains(err, database.ErrSkylinkExists) {
+		return nil
+	}
+	return err
+}
+
+// validateLegalBasis returns ErrLegalBasisRequired if the API requires the
+// legal basis of the block and the given block post does not specify it.
+func (api *API) validateLegalBasis(bp BlockPOST) error {
+	if api.staticRequireLegalBasis && strings.TrimSpace(bp.LegalBasis) == "" {
+		return ErrLegalBasisRequired
+	}
+	return nil
 }
 
 // isAllowListed returns true if the given skylink is on the allow list
@@ -321,38 +2059,197 @@ func (api *API) isAllowListed(ctx context.Context, hash crypto.Hash) bool {
 // resolveHash resolves the given block post object into a hash. If a hash was
 // already given, it will simply return that. If a skylink was given, it will
 // try to resolve it first if necessary and return the hash of the v1 skylink.
-func (api *API) resolveHash(bp BlockPOST) (crypto.Hash, error) {
+// If the given skylink was a v2 skylink, its hash is returned as well.
+func (api *API) resolveHash(ctx context.Context, bp BlockPOST) (crypto.Hash, crypto.Hash, error) {
 	// validate the block post
 	err := bp.validate()
 	if err != nil {
-		return crypto.Hash{}, err
+		return crypto.Hash{}, crypto.Hash{}, err
 	}
 
 	// if the hash is set, we are done
 	if bp.Hash != (crypto.Hash{}) {
-		return bp.Hash, nil
+		return bp.Hash, crypto.Hash{}, nil
 	}
 
 	// decode the skylink
 	var skylink skymodules.Skylink
 	err = skylink.LoadString(string(bp.Skylink))
 	if err != nil {
-		return crypto.Hash{}, errors.AddContext(err, "failed to load skylink")
+		return crypto.Hash{}, crypto.Hash{}, errors.AddContext(err, "failed to load skylink")
+	}
+
+	// keep track of the v2 skylink's hash
+	var v2Hash crypto.Hash
+	if skylink.IsSkylinkV2() {
+		v2Hash = database.NewHash(skylink).Hash
 	}
 
 	// resolve the skylink
-	skylink, err = api.staticSkydClient.ResolveSkylink(skylink)
+	skylink, err = api.staticBlocker.ResolveSkylink(ctx, skylink)
 	if err != nil {
-		return crypto.Hash{}, errors.Compose(err, errResolve)
+		return crypto.Hash{}, crypto.Hash{}, errors.Compose(err, errResolve)
 	}
 
 	// sanity check the skylink is a v1 skylink
 	if !skylink.IsSkylinkV1() {
-		return crypto.Hash{}, errors.Compose(err, errResolve)
+		return crypto.Hash{}, crypto.Hash{}, errors.Compose(err, errResolve)
 	}
 
 	// return the hash
-	return crypto.HashObject(skylink.MerkleRoot()), nil
+	return crypto.HashObject(skylink.MerkleRoot()), v2Hash, nil
+}
+
+// decodeBlockBulkPOST decodes a bulk block post from the given reader. Rather
+// than buffering the entire object, which is what json.Decoder does, the
+// skylinks, hashes and merkle roots are decoded one at a time and every skylink is validated
+// as it's decoded. The other fields are small and decoded as usual.
+func decodeBlockBulkPOST(r io.Reader) (BlockBulkPOST, error) {
+	dec := json.NewDecoder(r)
+	err := expectDelim(dec, '{')
+	if err != nil {
+		return BlockBulkPOST{}, err
+	}
+
+	var bp BlockBulkPOST
+	fields := make(map[string]json.RawMessage)
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return BlockBulkPOST{}, err
+		}
+		key, _ := token.(string)
+
+		// field names are matched case-insensitively, like json.Unmarshal
+		// does
+		switch {
+		case strings.EqualFold(key, "skylinks"):
+			bp.Skylinks = nil
+			err = decodeArray(dec, func(i int) error {
+				var sl skylink
+				err := dec.Decode(&sl)
+				if err != nil {
+					return errors.AddContext(err, fmt.Sprintf("invalid skylink at index %d", i))
+				}
+				bp.Skylinks = append(bp.Skylinks, sl)
+				return nil
+			})
+		case strings.EqualFold(key, "hashes"):
+			bp.Hashes = nil
+			err = decodeArray(dec, func(i int) error {
+				var hash crypto.Hash
+				err := dec.Decode(&hash)
+				if err != nil {
+					return errors.AddContext(err, fmt.Sprintf("invalid hash at index %d", i))
+				}
+				bp.Hashes = append(bp.Hashes, hash)
+				return nil
+			})
+		case strings.EqualFold(key, "merkleroots"):
+			bp.MerkleRoots = nil
+			err = decodeArray(dec, func(i int) error {
+				var root string
+				err := dec.Decode(&root)
+				if err != nil {
+					return errors.AddContext(err, fmt.Sprintf("invalid merkle root at index %d", i))
+				}
+				bp.MerkleRoots = append(bp.MerkleRoots, root)
+				return nil
+			})
+		default:
+			var raw json.RawMessage
+			err = dec.Decode(&raw)
+			fields[key] = raw
+		}
+		if err != nil {
+			return BlockBulkPOST{}, err
+		}
+	}
+	err = expectDelim(dec, '}')
+	if err != nil {
+		return BlockBulkPOST{}, err
+	}
+
+	// decode the other fields
+	if len(fields) == 0 {
+		return bp, nil
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return BlockBulkPOST{}, err
+	}
+	err = json.Unmarshal(b, &bp.BlockPOST)
+	if err != nil {
+		return BlockBulkPOST{}, err
+	}
+	return bp, nil
+}
+
+// decodeArray reads a JSON array from the given decoder and calls the given
+// function for every element, which has to decode it. A null value is treated
+// as an empty array.
+func decodeArray(dec *json.Decoder, fn func(i int) error) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected an array, got '%v'", token)
+	}
+	for i := 0; dec.More(); i++ {
+		err = fn(i)
+		if err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+// expectDelim reads the next token from the given decoder and returns an
+// error if it's not the given delimiter.
+func expectDelim(dec *json.Decoder, expected json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != expected {
+		return fmt.Errorf("expected '%v', got '%v'", expected, token)
+	}
+	return nil
+}
+
+// isBodyTooLarge returns whether the given error was returned by
+// http.MaxBytesReader because the body exceeds its limit.
+func isBodyTooLarge(err error) bool {
+	return err != nil && strings.Contains(err.Error(), errBodyTooLarge.Error())
+}
+
+// writeBodyTooLarge writes the error that's returned when the body of a block
+// request exceeds the maximum size.
+func (api *API) writeBodyTooLarge(w http.ResponseWriter) {
+	err := fmt.Errorf("request body exceeds the maximum size of %d bytes, split the skylinks across multiple requests or drop them in the ingest directory as a file", api.staticMaxBlockBodySize)
+	WriteError(w, err, http.StatusRequestEntityTooLarge)
+}
+
+// isBulk returns true if the request reports multiple skylinks, hashes or
+// merkle roots.
+func (bp *BlockBulkPOST) isBulk() bool {
+	return len(bp.Hashes) > 0 || len(bp.MerkleRoots) > 0 || len(bp.Skylinks) > 0
+}
+
+// validate returns an error if the bulk block post object sets both the
+// single and the bulk fields.
+func (bp *BlockBulkPOST) validate() error {
+	if bp.Hash != (crypto.Hash{}) || bp.Skylink != "" {
+		return errors.New("either hash or skylink, or hashes and skylinks can be set")
+	}
+	if len(bp.ReportID) > maxReportIDLength {
+		return fmt.Errorf("report ID can not be longer than %v characters", maxReportIDLength)
+	}
+	return nil
 }
 
 // validate returns an error if the block post object does not contain a hash or
@@ -361,6 +2258,9 @@ func (bp *BlockPOST) validate() error {
 	if bp.Hash == (crypto.Hash{}) && bp.Skylink == "" {
 		return errors.New("hash or skylink is required")
 	}
+	if len(bp.ReportID) > maxReportIDLength {
+		return fmt.Errorf("report ID can not be longer than %v characters", maxReportIDLength)
+	}
 	return nil
 }
 
@@ -378,6 +2278,48 @@ func extractSkylinkHash(skylink string) (string, error) {
 	return m[2], nil
 }
 
+// parseSkylink parses the given string into a skylink. The string is allowed
+// to contain redundant information, such as the protocol or a path.
+func parseSkylink(str string) (skymodules.Skylink, error) {
+	// Trim all the redundant information.
+	//
+	// TODO: is this really necessary? if possible we should try and drop this
+	link, err := extractSkylinkHash(str)
+	if err != nil {
+		return skymodules.Skylink{}, err
+	}
+	// Normalise the skylink hash. We want to use the same hash encoding in the
+	// database, regardless of the encoding of the skylink when we receive it -
+	// base32 or base64.
+	var sl skymodules.Skylink
+	err = sl.LoadString(link)
+	if err != nil {
+		return skymodules.Skylink{}, errors.AddContext(err, "invalid skylink provided")
+	}
+	return sl, nil
+}
+
+// notModified returns true if the conditional headers of the given request
+// indicate the client's cached response, identified by the given ETag and last
+// modified time, is still valid. If-None-Match takes precedence over
+// If-Modified-Since.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == etag || tag == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(ims)
+}
+
 // parseListParameters parses sort, offset and limit from the given query. If
 // not present, they default to 1 ('asc'), 0 and 1000 respectively.
 func parseListParameters(query url.Values) (int, int, int, error) {
@@ -424,6 +2366,100 @@ func parseListParameters(query url.Values) (int, int, int, error) {
 	return sort, offset, limit, nil
 }
 
+// parseBlockedListParameters parses the filter, sort and page size parameters
+// of the blocked endpoint.
+func parseBlockedListParameters(query url.Values) (database.ListFilter, int, error) {
+	filter := database.ListFilter{
+		Source: query.Get("filter[source]"),
+		State:  strings.ToLower(query.Get("filter[state]")),
+		Sort:   1,
+	}
+
+	// parse the time range
+	var err error
+	if fromStr := query.Get("filter[from]"); fromStr != "" {
+		filter.From, err = parseTimestamp(fromStr)
+		if err != nil {
+			return database.ListFilter{}, 0, errors.AddContext(err, "invalid value for 'filter[from]' parameter")
+		}
+	}
+	if toStr := query.Get("filter[to]"); toStr != "" {
+		filter.To, err = parseTimestamp(toStr)
+		if err != nil {
+			return database.ListFilter{}, 0, errors.AddContext(err, "invalid value for 'filter[to]' parameter")
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return database.ListFilter{}, 0, errors.New("'filter[from]' has to be before 'filter[to]'")
+	}
+
+	// parse the range of the time the skylinks got blocked
+	if fromStr := query.Get("filter[blockedfrom]"); fromStr != "" {
+		filter.BlockedFrom, err = parseTimestamp(fromStr)
+		if err != nil {
+			return database.ListFilter{}, 0, errors.AddContext(err, "invalid value for 'filter[blockedfrom]' parameter")
+		}
+	}
+	if toStr := query.Get("filter[blockedto]"); toStr != "" {
+		filter.BlockedTo, err = parseTimestamp(toStr)
+		if err != nil {
+			return database.ListFilter{}, 0, errors.AddContext(err, "invalid value for 'filter[blockedto]' parameter")
+		}
+	}
+	if !filter.BlockedFrom.IsZero() && !filter.BlockedTo.IsZero() && !filter.BlockedFrom.Before(filter.BlockedTo) {
+		return database.ListFilter{}, 0, errors.New("'filter[blockedfrom]' has to be before 'filter[blockedto]'")
+	}
+
+	// parse sort
+	switch sortStr := query.Get("sort"); sortStr {
+	case "", "timestamp_added":
+	case "-timestamp_added":
+		filter.Sort = -1
+	default:
+		return database.ListFilter{}, 0, errors.New("invalid value for 'sort' parameter, can only be 'timestamp_added' or '-timestamp_added'")
+	}
+
+	// parse the page size
+	pageSize := defaultPageSize
+	if sizeStr := query.Get("page[size]"); sizeStr != "" {
+		pageSize, err = strconv.Atoi(sizeStr)
+		if err != nil || pageSize < 1 || pageSize > maxLimit {
+			return database.ListFilter{}, 0, fmt.Errorf("invalid value for 'page[size]' parameter, must be between 1 and %v", maxLimit)
+		}
+	}
+	return filter, pageSize, nil
+}
+
+// parseIncludeTest parses the optional 'includetest' parameter, which
+// indicates whether test records are included. It defaults to false.
+func parseIncludeTest(r *http.Request) (bool, error) {
+	str := r.FormValue("includetest")
+	if str == "" {
+		return false, nil
+	}
+	includeTest, err := strconv.ParseBool(str)
+	if err != nil {
+		return false, fmt.Errorf("invalid value for 'includetest' parameter, '%v' is not a boolean", str)
+	}
+	return includeTest, nil
+}
+
+// parseTimestamp parses the given timestamp, which is either a unix timestamp
+// or RFC3339 formatted.
+func parseTimestamp(str string) (time.Time, error) {
+	if str == "" {
+		return time.Time{}, errors.New("timestamp is required")
+	}
+	if unix, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return time.Unix(unix, 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, str)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("timestamp '%v' is neither a unix timestamp nor RFC3339 formatted", str)
+	}
+	return t.UTC(), nil
+}
+
 // WriteError wraps WriteError from the skyd node api
 func WriteError(w http.ResponseWriter, err error, code int) {
 	skyapi.WriteError(w, skyapi.Error{Message: err.Error()}, code)
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"fmt"
+
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/SkynetLabs/skyd/skymodules"
+	"go.sia.tech/siad/crypto"
+)
+
+// SkylinkFromMerkleRoot returns the V1 skylink of the base sector with the
+// given raw merkle root, which allows reporting content by its merkle root
+// rather than its skylink. The skylink has an offset of zero and fetches the
+// entire sector. These don't affect the hash the skylink gets blocked by, it
+// only depends on the merkle root.
+//
+// NOTE: there's no V2 counterpart, a V2 skylink is derived from its registry
+// entry rather than from a merkle root.
+func SkylinkFromMerkleRoot(root []byte) (skymodules.Skylink, error) {
+	if len(root) != crypto.HashSize {
+		return skymodules.Skylink{}, fmt.Errorf("merkle root has to be %d bytes long, got %d", crypto.HashSize, len(root))
+	}
+	var mr crypto.Hash
+	copy(mr[:], root)
+	if mr == (crypto.Hash{}) {
+		return skymodules.Skylink{}, errors.New("merkle root can not be empty")
+	}
+	sl, err := skymodules.NewSkylinkV1(mr, 0, skymodules.SkylinkMaxFetchSize)
+	if err != nil {
+		return skymodules.Skylink{}, errors.AddContext(err, "failed to create skylink")
+	}
+	return sl, nil
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/SkynetLabs/blocker/database"
+	"gitlab.com/SkynetLabs/skyd/skymodules"
+	"go.sia.tech/siad/crypto"
+)
+
+// TestSkylinkFromMerkleRoot is a unit test for SkylinkFromMerkleRoot, it
+// verifies the skylinks against known skylink and merkle root pairs and
+// that malformed roots are rejected.
+func TestSkylinkFromMerkleRoot(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		root    string
+		skylink string
+	}{
+		// the merkle root of v1SkylinkStr, which fetches a smaller part of
+		// the sector
+		{
+			root:    "168b7a2ee75a821f6e089b41124bee7f80a83ad2a18862db5afabcab9759019d",
+			skylink: "_B0Wi3ou51qCH24Im0ESS-5_gKg60qGIYtta-ryrl1kBnQ",
+		},
+		{
+			root:    strings.Repeat("ab", crypto.HashSize),
+			skylink: "_B2rq6urq6urq6urq6urq6urq6urq6urq6urq6urq6urqw",
+		},
+	}
+	for _, test := range tests {
+		root, err := hex.DecodeString(test.root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sl, err := SkylinkFromMerkleRoot(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sl.String() != test.skylink {
+			t.Fatal("unexpected skylink", sl.String(), test.skylink)
+		}
+
+		// assert the skylink is a valid V1 skylink that fetches the entire
+		// sector and that it's blocked by the hash of the root
+		var loaded skymodules.Skylink
+		err = loaded.LoadString(sl.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset, fetchSize, err := loaded.OffsetAndFetchSize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !loaded.IsSkylinkV1() || offset != 0 || fetchSize != skymodules.SkylinkMaxFetchSize {
+			t.Fatal("unexpected skylink", loaded, offset, fetchSize)
+		}
+		if database.NewHash(loaded) != database.HashBytes(root) {
+			t.Fatal("unexpected hash", database.NewHash(loaded))
+		}
+	}
+
+	// assert the root of the known skylink is blocked by the same hash as
+	// the skylink itself
+	known, err := database.HashFromSkylink(v1SkylinkStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := hex.DecodeString(tests[0].root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if database.HashBytes(root) != known {
+		t.Fatal("unexpected hash", database.HashBytes(root), known)
+	}
+
+	// assert malformed roots are rejected
+	for _, root := range [][]byte{nil, make([]byte, 31), make([]byte, 33), make([]byte, crypto.HashSize)} {
+		_, err := SkylinkFromMerkleRoot(root)
+		if err == nil {
+			t.Fatal("expected error", len(root))
+		}
+	}
+}
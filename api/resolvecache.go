@@ -0,0 +1,187 @@
+package api
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/SkynetLabs/skyd/skymodules"
+)
+
+const (
+	// DefaultResolveCacheSize is the default number of resolved skylinks the
+	// skyd client caches.
+	DefaultResolveCacheSize = 10000
+
+	// DefaultResolveCacheTTL is the default amount of time a resolved skylink
+	// is cached. V2 skylinks can be updated to point to other content, the
+	// TTL has to be short enough for such updates to be picked up.
+	DefaultResolveCacheTTL = time.Minute
+)
+
+type (
+	// ResolveCacheStats contains the metrics of the resolve cache.
+	ResolveCacheStats struct {
+		Size    int     `json:"size"`
+		MaxSize int     `json:"maxsize"`
+		TTL     string  `json:"ttl"`
+		Hits    uint64  `json:"hits"`
+		Misses  uint64  `json:"misses"`
+		HitRate float64 `json:"hitrate"`
+	}
+
+	// resolveCache is an LRU cache that maps V2 skylinks to the V1 skylink
+	// they resolved to. Entries expire after the TTL. A size of zero
+	// disables the cache.
+	resolveCache struct {
+		entries map[string]*list.Element
+		hits    uint64
+		lru     *list.List
+		misses  uint64
+
+		staticMu sync.Mutex
+
+		// the configuration is guarded by the mutex as well, seeing as it
+		// can be changed after the client was created
+		size int
+		ttl  time.Duration
+	}
+
+	// resolveCacheEntry is an entry in the resolve cache.
+	resolveCacheEntry struct {
+		expiry   time.Time
+		key      string
+		resolved skymodules.Skylink
+	}
+)
+
+// newResolveCache returns an empty resolve cache with the default size and
+// TTL.
+func newResolveCache() *resolveCache {
+	return &resolveCache{
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		size:    DefaultResolveCacheSize,
+		ttl:     DefaultResolveCacheTTL,
+	}
+}
+
+// managedGet returns the skylink the given skylink resolved to, if it's
+// cached and not expired.
+func (rc *resolveCache) managedGet(skylink skymodules.Skylink) (skymodules.Skylink, bool) {
+	rc.staticMu.Lock()
+	defer rc.staticMu.Unlock()
+
+	if rc.size == 0 {
+		return skymodules.Skylink{}, false
+	}
+	el, exists := rc.entries[skylink.String()]
+	if !exists {
+		rc.misses++
+		return skymodules.Skylink{}, false
+	}
+	entry := el.Value.(*resolveCacheEntry)
+	if time.Now().After(entry.expiry) {
+		rc.remove(el)
+		rc.misses++
+		return skymodules.Skylink{}, false
+	}
+	rc.lru.MoveToFront(el)
+	rc.hits++
+	return entry.resolved, true
+}
+
+// managedAdd caches the skylink the given skylink resolved to, evicting the
+// least recently used entry if the cache is full.
+func (rc *resolveCache) managedAdd(skylink, resolved skymodules.Skylink) {
+	rc.staticMu.Lock()
+	defer rc.staticMu.Unlock()
+
+	if rc.size == 0 {
+		return
+	}
+	key := skylink.String()
+	expiry := time.Now().Add(rc.ttl)
+	if el, exists := rc.entries[key]; exists {
+		entry := el.Value.(*resolveCacheEntry)
+		entry.expiry = expiry
+		entry.resolved = resolved
+		rc.lru.MoveToFront(el)
+		return
+	}
+	rc.entries[key] = rc.lru.PushFront(&resolveCacheEntry{
+		expiry:   expiry,
+		key:      key,
+		resolved: resolved,
+	})
+	for rc.lru.Len() > rc.size {
+		rc.remove(rc.lru.Back())
+	}
+}
+
+// managedConfigure updates the size and TTL of the cache, it clears the
+// cache.
+func (rc *resolveCache) managedConfigure(size int, ttl time.Duration) error {
+	if size < 0 {
+		return errors.New("resolve cache size can not be negative")
+	}
+	if size > 0 && ttl <= 0 {
+		return errors.New("resolve cache TTL has to be positive")
+	}
+
+	rc.staticMu.Lock()
+	defer rc.staticMu.Unlock()
+	rc.entries = make(map[string]*list.Element)
+	rc.lru.Init()
+	rc.size = size
+	rc.ttl = ttl
+	return nil
+}
+
+// managedInvalidate removes the given skylinks from the cache, if no skylinks
+// are given the whole cache is cleared. It returns the number of removed
+// entries.
+func (rc *resolveCache) managedInvalidate(skylinks ...skymodules.Skylink) int {
+	rc.staticMu.Lock()
+	defer rc.staticMu.Unlock()
+
+	if len(skylinks) == 0 {
+		removed := rc.lru.Len()
+		rc.entries = make(map[string]*list.Element)
+		rc.lru.Init()
+		return removed
+	}
+	var removed int
+	for _, skylink := range skylinks {
+		if el, exists := rc.entries[skylink.String()]; exists {
+			rc.remove(el)
+			removed++
+		}
+	}
+	return removed
+}
+
+// managedStats returns the metrics of the cache.
+func (rc *resolveCache) managedStats() ResolveCacheStats {
+	rc.staticMu.Lock()
+	defer rc.staticMu.Unlock()
+
+	stats := ResolveCacheStats{
+		Size:    rc.lru.Len(),
+		MaxSize: rc.size,
+		TTL:     rc.ttl.String(),
+		Hits:    rc.hits,
+		Misses:  rc.misses,
+	}
+	if total := rc.hits + rc.misses; total > 0 {
+		stats.HitRate = float64(rc.hits) / float64(total)
+	}
+	return stats
+}
+
+// remove removes the given element from the cache.
+func (rc *resolveCache) remove(el *list.Element) {
+	rc.lru.Remove(el)
+	delete(rc.entries, el.Value.(*resolveCacheEntry).key)
+}
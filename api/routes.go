@@ -1,6 +1,7 @@
 package api
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -22,15 +23,67 @@ var (
 	// AccountsPort is the port on which the accounts service is listening.
 	// NOTE: this variable is overwritten with what is set in the environment
 	AccountsPort = "3000"
+
+	// AdminPassword is the password that protects the admin routes. The
+	// admin routes are disabled if it is not set.
+	// NOTE: this variable is overwritten with what is set in the environment
+	AdminPassword = ""
 )
 
 // buildHTTPRoutes registers all HTTP routes and their handlers.
 func (api *API) buildHTTPRoutes() {
 	api.staticRouter.GET("/health", api.healthGET)
+	api.staticRouter.GET("/ready", api.readyGET)
+	api.staticRouter.GET("/status", api.serviceStatusGET)
 	api.staticRouter.GET("/blocklist", api.blocklistGET)
 	api.staticRouter.POST("/block", api.blockPOST)
+	api.staticRouter.POST("/block/text", api.blockTextPOST)
 	api.staticRouter.GET("/powblock", api.blockWithPoWGET)
 	api.staticRouter.POST("/powblock", api.blockWithPoWPOST)
+	api.staticRouter.GET("/status/:skylink", api.statusGET)
+	api.staticRouter.GET("/blocked/:skylink", api.blockedGET)
+	api.staticRouter.HEAD("/blocked/:skylink", api.blockedGET)
+	api.staticRouter.GET("/blockedhash/:prefix", api.blockedHashGET)
+	api.staticRouter.GET("/util/hash/:skylink", api.utilHashGET)
+
+	api.staticRouter.GET("/metrics/skyd", api.validateAdmin(api.skydMetricsGET))
+	api.staticRouter.GET("/metrics/sources", api.validateAdmin(api.sourcesGET))
+	api.staticRouter.GET("/report", api.validateAdmin(api.reportGET))
+	api.staticRouter.GET("/admin/status/:skylink", api.validateAdmin(api.adminStatusGET))
+	api.staticRouter.GET("/blocked", api.validateAdmin(api.blockedListGET))
+	api.staticRouter.PATCH("/blocked/:skylink/annotations", api.validateAdmin(api.annotationsPATCH))
+	api.staticRouter.GET("/debug/config", api.validateAdmin(api.debugConfigGET))
+	api.staticRouter.POST("/admin/reblock", api.validateAdmin(api.reblockPOST))
+	api.staticRouter.POST("/admin/retry", api.validateAdmin(api.retryPOST))
+	api.staticRouter.POST("/admin/cancel", api.validateAdmin(api.cancelPOST))
+	api.staticRouter.POST("/admin/integrity", api.validateAdmin(api.integrityPOST))
+	api.staticRouter.DELETE("/admin/resolvecache", api.validateAdmin(api.resolveCacheDELETE))
+	api.staticRouter.DELETE("/admin/test", api.validateAdmin(api.testRecordsDELETE))
+	api.staticRouter.PUT("/admin/maintenance", api.validateAdmin(api.maintenancePUT))
+	api.staticRouter.PUT("/admin/suspend", api.validateAdmin(api.suspendPUT))
+	api.staticRouter.PUT("/admin/sweepinterval", api.validateAdmin(api.sweepIntervalPUT))
+	api.staticRouter.PUT("/admin/source", api.validateAdmin(api.sourcePUT))
+	api.staticRouter.POST("/admin/snapshot", api.validateAdmin(api.snapshotPOST))
+	api.staticRouter.POST("/admin/snapshot/restore", api.validateAdmin(api.snapshotRestorePOST))
+}
+
+// validateAdmin ensures the incoming request is authenticated as an admin
+// request. Admin requests use basic auth, where the password has to match
+// the configured admin password. The username is ignored.
+func (api *API) validateAdmin(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		if AdminPassword == "" {
+			api2.WriteError(w, api2.Error{"admin routes are disabled"}, http.StatusUnauthorized)
+			return
+		}
+		_, password, ok := req.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(AdminPassword)) != 1 {
+			api2.WriteError(w, api2.Error{"Unauthorized"}, http.StatusUnauthorized)
+			return
+		}
+
+		h(w, req, ps)
+	}
 }
 
 // validateCookie extracts the cookie from the incoming blocking request and
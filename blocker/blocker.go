@@ -2,14 +2,20 @@ package blocker
 
 import (
 	"context"
+	"encoding/hex"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/SkynetLabs/blocker/api"
 	"github.com/SkynetLabs/blocker/database"
+	"github.com/SkynetLabs/blocker/events"
+	"github.com/SkynetLabs/blocker/portal"
 	"github.com/SkynetLabs/skynet-accounts/build"
 	"github.com/sirupsen/logrus"
 	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+	"gitlab.com/SkynetLabs/skyd/skymodules"
 )
 
 const (
@@ -17,13 +23,57 @@ const (
 	// blocking simultaneously.
 	blockBatchSize = 100
 
+	// loopBlock and loopRetry identify the loop that performed a sweep in
+	// the sweep statistics.
+	loopBlock     = "block"
+	loopRetry     = "retry"
+	loopWarmStart = "warmstart"
+
+	// integritySampleSize is the number of IDs of the skylinks that suffer
+	// from a problem that are included in the integrity report.
+	integritySampleSize = 10
+
+	// eventBufferSize is the number of block events that are buffered before
+	// they get dropped, if publishing them can't keep up.
+	eventBufferSize = 10000
+
+	// defaultResolveTimeout is the default maximum amount of time resolving
+	// a single skylink may take.
+	defaultResolveTimeout = 30 * time.Second
+
+	// defaultMaxClockSkew is the default amount of time the latest block
+	// timestamp may be in the future before it's considered corrupt.
+	defaultMaxClockSkew = time.Hour
+
 	// stopTimeoutDuration is the amount of time we wait when stop is called
 	// before cancelling out and returning with an error indicating an unclean
 	// shutdown.
 	stopTimeoutDuration = time.Minute
+
+	// unverifiedReason is the reason recorded in the history of hashes that
+	// skyd accepted to block but that are missing from its blocklist.
+	unverifiedReason = "skyd accepted the block but the hash is missing from its blocklist"
+
+	// verifySampleResolution is the resolution at which the blocked hashes
+	// that get verified are sampled.
+	verifySampleResolution = 1 << 20
 )
 
 var (
+	// ErrSweepLeaseNotHeld is returned by Sweep if another instance holds the
+	// sweep lease.
+	ErrSweepLeaseNotHeld = errors.New("sweep lease is held by another instance")
+
+	// ErrHighRejectionRate is returned when a sweep is aborted because skyd
+	// rejected too many of the hashes as invalid, which indicates skyd is
+	// broken rather than the hashes being invalid.
+	ErrHighRejectionRate = errors.New("skyd rejected too many hashes")
+
+	// errLatestBlockTimestampChanged is returned when the latest block
+	// timestamp changed behind the sweep's back, e.g. because it got rewound
+	// when a report source was enabled again.
+	errLatestBlockTimestampChanged = errors.New("latest block timestamp changed during the sweep")
+
 	// blockInterval defines the amount of time between fetching hashes that
 	// need to be blocked from the database.
 	blockInterval = build.Select(
@@ -34,6 +84,28 @@ var (
 		},
 	).(time.Duration)
 
+	// defaultErrorBackoffStep is the default amount of time the block loop
+	// backs off by for every consecutive failed sweep.
+	defaultErrorBackoffStep = build.Select(
+		build.Var{
+			Dev:      time.Second,
+			Testing:  10 * time.Millisecond,
+			Standard: 10 * time.Second,
+		},
+	).(time.Duration)
+
+	// minSweepInterval and maxSweepInterval bound the interval between the
+	// block sweeps that can be set at runtime, a zero interval would make
+	// the block loop spin.
+	minSweepInterval = build.Select(
+		build.Var{
+			Dev:      time.Second,
+			Testing:  10 * time.Millisecond,
+			Standard: 5 * time.Second,
+		},
+	).(time.Duration)
+	maxSweepInterval = 24 * time.Hour
+
 	// retryInterval defines the amount of time between retries of blocked
 	// hashes that failed to get blocked the first time around. This interval
 	// is (a lot) higher than the blockInterval.
@@ -49,25 +121,309 @@ var (
 type (
 	// Blocker scans the database for skylinks that should be blocked and calls
 	// skyd to block them.
+	//
+	// The fields that are not static are mutated by the background loops and
+	// read by the API handlers concurrently, they are guarded by staticMu and
+	// must only be accessed through the managed methods.
 	Blocker struct {
 		started bool
 
-		// latestBlockTime is the time at which we ran 'BlockHashes' the last
-		// time, this timestamp is used as an offset when fetch all 'new' hashes
-		// to block.
-		latestBlockTime time.Time
+		// lastSweep is the time at which the last block sweep completed
+		// successfully, it's zero if no sweep completed yet.
+		lastSweep time.Time
+
+		// consecutiveSweepErrors is the number of block sweeps that failed
+		// in a row, it's reset by a successful sweep.
+		consecutiveSweepErrors int
+
+		// leaseHeld indicates whether this instance holds the sweep lease,
+		// it is only relevant if the sweep lease is enabled.
+		leaseHeld bool
+
+		// skydDown indicates whether the last call to skyd to block hashes
+		// failed, it's used to log when skyd goes down or comes back up.
+		skydDown bool
+
+		// rejected is the number of hashes skyd permanently rejected as
+		// invalid since the blocker started, these hashes are quarantined
+		// and never sent to skyd again.
+		rejected uint64
+
+		// unverified is the number of hashes that skyd accepted to block
+		// but that were missing from its blocklist when verified, since the
+		// blocker started.
+		unverified uint64
+
+		// circuitOpen indicates whether the sweeps are paused because the
+		// circuit breaker around skyd is open, it's used to log when the
+		// sweeps get paused or resumed.
+		circuitOpen bool
+
+		// maintenance is the schedule of the daily maintenance windows
+		// during which the sweeps are skipped, it can be replaced while the
+		// blocker is running.
+		maintenance MaintenanceSchedule
+
+		// inMaintenance indicates whether the sweeps are skipped because of
+		// a maintenance window, it's used to log when a window starts or
+		// ends.
+		inMaintenance bool
+
+		// suspended indicates whether an operator suspended the sweeps,
+		// e.g. during an incident, they stay suspended until an operator
+		// resumes them.
+		suspended bool
+
+		// sweepInterval is the amount of time the block loop waits between
+		// sweeps, it defaults to the configured sweep interval and can be
+		// adjusted while the blocker is running.
+		sweepInterval time.Duration
+
+		// latestBlockTimestamp caches the latest block timestamp, the
+		// blocker is its only writer so it's only read from the database
+		// if latestBlockTimestampCached is false, e.g. on startup or after
+		// the cache got invalidated.
+		latestBlockTimestamp       time.Time
+		latestBlockTimestampCached bool
+
+		staticBlockLog       *blockLog
+		staticBlockTag       string
+		staticDB             *database.DB
+		staticErrorBackoff   ErrorBackoff
+		staticMaxClockSkew   time.Duration
+		staticLogger         *logrus.Entry
+		staticMu             sync.Mutex
+		staticPortalBlocker  *portal.PortalBlocker
+		staticPrePolicy      PrePolicy
+		staticPublisher      events.Publisher
+		staticRejectionRate  float64
+		staticVerifyRate     float64
+		staticResolveTimeout time.Duration
+		staticSkydClient     *api.SkydClient
+		staticResumeChan     chan struct{}
+		staticStopChan       chan struct{}
+		staticSweepInterval  time.Duration
+		staticSweepLease     time.Duration
+		staticWaitGroup      sync.WaitGroup
+		staticWarmStart      int
+		staticWatchInserts   bool
+	}
+
+	// SweepResult describes the outcome of a block sweep. Hashes is the
+	// number of hashes the sweep found, Blocked, Invalid and Failed are the
+	// number of hashes that got blocked, that skyd deemed invalid and that
+	// failed to get blocked and are retried later. Skipped is the number of
+	// hashes the pre-block policy denied. Drained indicates the sweep
+	// processed every hash it found, it's false if the sweep failed or got
+	// interrupted, in which case the next sweep picks up the rest.
+	// SkydCalls holds the calls the sweep made to skyd to block the hashes.
+	SweepResult struct {
+		Hashes    int
+		Blocked   int
+		Invalid   int
+		Failed    int
+		Skipped   int
+		Duration  time.Duration
+		Drained   bool
+		SkydCalls SkydCalls
+	}
+
+	// SkydCalls counts the calls that are made to skyd to block hashes. Calls
+	// is the number of calls, BatchSizes maps the number of hashes that were
+	// sent in a call to the number of calls that sent that many. Tagging the
+	// blocks sends a call for every tag in a batch, so a batch can take many
+	// calls.
+	SkydCalls struct {
+		Calls      int
+		BatchSizes map[int]int
+	}
+
+	// Options holds the configurable options of the blocker.
+	Options struct {
+		// SweepLeaseTTL enables the sweep lease when set. Only the blocker
+		// instance that holds the lease sweeps the database and blocks the
+		// hashes, which allows running multiple instances against the same
+		// database. The instance renews the lease every block interval, if it
+		// stops doing so another instance takes over once the lease expires.
+		// The TTL must therefore exceed the sweep interval. Defaults to zero,
+		// which disables the lease.
+		SweepLeaseTTL time.Duration
+
+		// SweepInterval is the amount of time the block loop waits between
+		// sweeps, it allows tuning the interval per deployment, e.g. sweeping
+		// a busy portal more often than a quiet one. It can be adjusted while
+		// the blocker is running through SetSweepInterval, resetting it
+		// restores this interval. Defaults to the block interval of the
+		// build, which is a minute in standard builds.
+		SweepInterval time.Duration
+
+		// ResolveTimeout is the maximum amount of time resolving a single
+		// skylink may take. Resolving a V2 skylink involves a registry lookup
+		// which can be slow, a timeout should be treated as temporary and the
+		// resolution should be retried later. Defaults to 30 seconds.
+		ResolveTimeout time.Duration
+
+		// MaxClockSkew is the amount of time the latest block timestamp may
+		// be in the future. A timestamp further in the future, e.g. written
+		// by a host with a skewed clock, would make every sweep come up
+		// empty, so it's clamped. Defaults to an hour.
+		MaxClockSkew time.Duration
+
+		// PortalBlocker is optional, if set the hashes that got blocked by
+		// the local skyd are blocked on the downstream portals as well.
+		PortalBlocker *portal.PortalBlocker
+
+		// Publisher is optional, if set an event is published for every hash
+		// that got blocked. Publishing happens in the background and never
+		// blocks the sweep, the events are buffered and dropped when the
+		// buffer is full. Defaults to a publisher that discards all events.
+		Publisher events.Publisher
+
+		// BlockLogPath is optional, if set the block event of every hash
+		// that got blocked is appended to the file at this path as a JSON
+		// line. It's a local record for auditing that survives the loss of
+		// the database. Failing to write to it is logged but does not fail
+		// the block. Defaults to an empty path, which disables the log.
+		BlockLogPath string
+
+		// BlockLogMaxSize is the size in bytes at which the block log is
+		// rotated, the rotated file is renamed to the path followed by the
+		// time of the rotation and kept. Defaults to 100 MiB.
+		BlockLogMaxSize int64
+
+		// LogLevel is the log level of the blocker, e.g. 'info'. It allows
+		// logging the sweeps at a different level than the other components.
+		// Defaults to the level of the given logger.
+		LogLevel string
+
+		// ErrorBackoff configures how long the block loop waits after a
+		// failed sweep, unset fields default to DefaultErrorBackoff.
+		ErrorBackoff ErrorBackoff
+
+		// Maintenance is the schedule of the daily maintenance windows
+		// during which the blocker skips its sweeps and rejects on-demand
+		// blocks. It can be replaced while the blocker is running through
+		// SetMaintenanceSchedule. Defaults to no maintenance windows.
+		Maintenance MaintenanceSchedule
+
+		// PrePolicy is optional, if set the sweeps consult it for every
+		// skylink before blocking it. Defaults to nil, which allows all
+		// skylinks to be blocked.
+		PrePolicy PrePolicy
+
+		// MaxRejectionRate is the fraction of hashes skyd may reject as
+		// invalid within a sweep, e.g. 0.5. Once at least a batch of hashes
+		// was sent and the fraction of rejected hashes exceeds it, skyd is
+		// considered broken and the sweep is aborted with
+		// ErrHighRejectionRate. The hashes of the batch that tripped the
+		// guard are marked as failed rather than invalid so they are
+		// retried. Defaults to zero, which disables the guard.
+		MaxRejectionRate float64
 
-		staticDB         *database.DB
-		staticLogger     *logrus.Logger
-		staticMu         sync.Mutex
-		staticSkydClient *api.SkydClient
-		staticStopChan   chan struct{}
-		staticWaitGroup  sync.WaitGroup
+		// VerifyRate is the fraction of blocked hashes that are verified to
+		// be in skyd's blocklist after skyd accepted their block, e.g. 0.1.
+		// Hashes that are missing are marked as failed and retried.
+		// Verifying fetches skyd's entire blocklist, so it's expensive.
+		// Defaults to zero, which disables verification.
+		VerifyRate float64
+
+		// BlockTag makes the blocker ask skyd to record a tag with every hash
+		// it blocks, which helps when inspecting skyd's blocklist directly.
+		// It's either BlockTagSource or BlockTagLegalBasis, the hashes of a
+		// batch are grouped by their tag. Skyd versions that don't support
+		// tags ignore them. Defaults to an empty tag, which disables tagging.
+		BlockTag string
+
+		// WarmStart is the number of the most recently added skylinks that
+		// are blocked first, newest first, before the first sweep after
+		// Start. After a restart the sweep might have a long backlog to work
+		// through, the warm start ensures the freshest reports don't have to
+		// wait for it. The latest block timestamp is left untouched, the
+		// sweep skips the skylinks that got blocked. Defaults to zero, which
+		// disables the warm start.
+		WarmStart int
+
+		// WatchInserts enables blocking skylinks as soon as they're
+		// inserted, by tailing a change stream on the skylinks collection,
+		// see WatchAndBlock. The sweeps keep running as a backstop. Change
+		// streams require the database to be a replica set. Defaults to
+		// false.
+		WatchInserts bool
+	}
+
+	// PrePolicy decides whether the given skylink is allowed to be blocked,
+	// it allows operators to implement custom guards, e.g. limiting the rate
+	// of blocks per source. If it disallows the block, the skylink is skipped
+	// and the given reason is logged and recorded in the skylink's history.
+	// If it returns an error, the skylink is marked as failed and the policy
+	// is consulted again when the retry loop picks it up.
+	PrePolicy func(ctx context.Context, skylink database.BlockedSkylink) (allow bool, reason string, err error)
+
+	// ErrorBackoff describes how long the block loop waits after failed
+	// sweeps. The wait grows linearly by Step for the first Steps
+	// consecutive failures, after which it doubles for every failure until
+	// it reaches Max. Max defaults to Step times Steps, in which case the
+	// wait tops out after the linear ramp.
+	ErrorBackoff struct {
+		Step  time.Duration
+		Steps int
+		Max   time.Duration
 	}
 )
 
+// DefaultErrorBackoff returns the default error backoff, which ramps up to a
+// minute in six steps.
+func DefaultErrorBackoff() ErrorBackoff {
+	return ErrorBackoff{
+		Step:  defaultErrorBackoffStep,
+		Steps: 6,
+		Max:   6 * defaultErrorBackoffStep,
+	}
+}
+
+// Duration returns the amount of time to wait after the given number of
+// consecutive failures.
+func (eb ErrorBackoff) Duration(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	if failures <= eb.Steps {
+		return time.Duration(failures) * eb.Step
+	}
+	backoff := time.Duration(eb.Steps) * eb.Step
+	for i := eb.Steps; i < failures && backoff < eb.Max; i++ {
+		backoff *= 2
+	}
+	if backoff > eb.Max {
+		backoff = eb.Max
+	}
+	return backoff
+}
+
+// withDefaults returns the error backoff with the unset fields set to their
+// default and validates it.
+func (eb ErrorBackoff) withDefaults() (ErrorBackoff, error) {
+	if eb.Step < 0 || eb.Steps < 0 || eb.Max < 0 {
+		return ErrorBackoff{}, errors.New("error backoff can not be negative")
+	}
+	def := DefaultErrorBackoff()
+	if eb.Step == 0 {
+		eb.Step = def.Step
+	}
+	if eb.Steps == 0 {
+		eb.Steps = def.Steps
+	}
+	if eb.Max == 0 {
+		eb.Max = time.Duration(eb.Steps) * eb.Step
+	}
+	if eb.Max < eb.Step {
+		return ErrorBackoff{}, fmt.Errorf("error backoff ceiling %v can not be lower than its step %v", eb.Max, eb.Step)
+	}
+	return eb, nil
+}
+
 // New returns a new Blocker with the given parameters.
-func New(skydClient *api.SkydClient, db *database.DB, logger *logrus.Logger) (*Blocker, error) {
+func New(skydClient *api.SkydClient, db *database.DB, opts Options, logger *logrus.Logger) (*Blocker, error) {
 	if db == nil {
 		return nil, errors.New("no DB provided")
 	}
@@ -77,30 +433,187 @@ func New(skydClient *api.SkydClient, db *database.DB, logger *logrus.Logger) (*B
 	if skydClient == nil {
 		return nil, errors.New("no Skyd client provided")
 	}
+	if opts.SweepLeaseTTL < 0 {
+		return nil, errors.New("sweep lease TTL can not be negative")
+	}
+	if opts.SweepInterval < 0 {
+		return nil, errors.New("sweep interval can not be negative")
+	}
+	if opts.SweepInterval == 0 {
+		opts.SweepInterval = blockInterval
+	}
+	if opts.SweepInterval < minSweepInterval || opts.SweepInterval > maxSweepInterval {
+		return nil, fmt.Errorf("sweep interval must be between %v and %v", minSweepInterval, maxSweepInterval)
+	}
+	if opts.SweepLeaseTTL > 0 && opts.SweepLeaseTTL <= opts.SweepInterval {
+		return nil, fmt.Errorf("sweep lease TTL must exceed the sweep interval of %v", opts.SweepInterval)
+	}
+	if opts.ResolveTimeout < 0 {
+		return nil, errors.New("resolve timeout can not be negative")
+	}
+	if opts.ResolveTimeout == 0 {
+		opts.ResolveTimeout = defaultResolveTimeout
+	}
+	if opts.MaxClockSkew < 0 {
+		return nil, errors.New("max clock skew can not be negative")
+	}
+	if opts.MaxClockSkew == 0 {
+		opts.MaxClockSkew = defaultMaxClockSkew
+	}
+	if opts.MaxRejectionRate < 0 || opts.MaxRejectionRate >= 1 {
+		return nil, errors.New("max rejection rate must be between 0 and 1")
+	}
+	if opts.VerifyRate < 0 || opts.VerifyRate > 1 {
+		return nil, errors.New("verify rate must be between 0 and 1")
+	}
+	if err := validateBlockTag(opts.BlockTag); err != nil {
+		return nil, err
+	}
+	if opts.WarmStart < 0 {
+		return nil, errors.New("warm start can not be negative")
+	}
+	componentLogger, err := newComponentLogger(logger, opts.LogLevel)
+	if err != nil {
+		return nil, errors.AddContext(err, "invalid log level")
+	}
+	errorBackoff, err := opts.ErrorBackoff.withDefaults()
+	if err != nil {
+		return nil, errors.AddContext(err, "invalid error backoff")
+	}
+	if opts.BlockLogMaxSize < 0 {
+		return nil, errors.New("block log max size can not be negative")
+	}
+	if opts.BlockLogMaxSize == 0 {
+		opts.BlockLogMaxSize = defaultBlockLogMaxSize
+	}
+	var bLog *blockLog
+	if opts.BlockLogPath != "" {
+		bLog, err = newBlockLog(opts.BlockLogPath, opts.BlockLogMaxSize)
+		if err != nil {
+			return nil, errors.AddContext(err, "failed to open block log")
+		}
+	}
+	var publisher events.Publisher = events.NoopPublisher{}
+	if opts.Publisher != nil {
+		publisher, err = events.NewBufferedPublisher(opts.Publisher, eventBufferSize, logger)
+		if err != nil {
+			return nil, errors.AddContext(err, "failed to create event publisher")
+		}
+	}
 	bl := &Blocker{
-		staticDB:         db,
-		staticLogger:     logger,
-		staticSkydClient: skydClient,
-		staticStopChan:   make(chan struct{}),
+		maintenance:   opts.Maintenance,
+		sweepInterval: opts.SweepInterval,
+
+		staticBlockLog:       bLog,
+		staticBlockTag:       opts.BlockTag,
+		staticDB:             db,
+		staticErrorBackoff:   errorBackoff,
+		staticMaxClockSkew:   opts.MaxClockSkew,
+		staticLogger:         componentLogger,
+		staticPortalBlocker:  opts.PortalBlocker,
+		staticPrePolicy:      opts.PrePolicy,
+		staticPublisher:      publisher,
+		staticRejectionRate:  opts.MaxRejectionRate,
+		staticVerifyRate:     opts.VerifyRate,
+		staticResolveTimeout: opts.ResolveTimeout,
+		staticSkydClient:     skydClient,
+		staticResumeChan:     make(chan struct{}, 1),
+		staticStopChan:       make(chan struct{}),
+		staticSweepInterval:  opts.SweepInterval,
+		staticSweepLease:     opts.SweepLeaseTTL,
+		staticWarmStart:      opts.WarmStart,
+		staticWatchInserts:   opts.WatchInserts,
 	}
 	return bl, nil
 }
 
+// record records a call to skyd that sent the given number of hashes, it's a
+// no-op if sc is nil, which allows callers to opt out of counting.
+func (sc *SkydCalls) record(size int) {
+	if sc == nil {
+		return
+	}
+	if sc.BatchSizes == nil {
+		sc.BatchSizes = make(map[int]int)
+	}
+	sc.Calls++
+	sc.BatchSizes[size]++
+}
+
+// PerBlocked returns the number of calls per blocked hash, given the number of
+// hashes that got blocked. It's zero if no hashes got blocked.
+func (sc SkydCalls) PerBlocked(blocked int) float64 {
+	if blocked == 0 {
+		return 0
+	}
+	return float64(sc.Calls) / float64(blocked)
+}
+
 // BlockHashes blocks the given list of hashes. It returns the amount of hashes
 // which were blocked successfully, the amount that were invalid, and a
-// potential error.
-func (bl *Blocker) BlockHashes(hashes []database.Hash) (int, int, error) {
+// potential error. If the given context is cancelled it escapes after the
+// current batch, the remaining hashes are not counted.
+func (bl *Blocker) BlockHashes(ctx context.Context, hashes []database.Hash) (int, int, error) {
+	if err := bl.managedMaintenanceError(); err != nil {
+		return 0, 0, err
+	}
+	blocked, invalid, _, err := bl.blockHashes(ctx, bl.staticLogger, hashes, nil, nil)
+	return blocked, invalid, err
+}
+
+// blockHashes blocks the given list of hashes in batches. It returns the amount
+// of hashes that got blocked, the amount skyd deemed invalid and the amount
+// that were marked as failed, and are retried later. If a checkpoint function
+// is given, it's called with every batch that got processed successfully,
+// batches are processed in order. If it returns an error the remaining batches
+// are not processed and that error is returned. All log lines are written to
+// the given logger, which allows correlating them with a sweep. If the given
+// context is cancelled, or the blocker is stopped, the call to skyd for the
+// current batch is aborted and it escapes without an error, the interrupted
+// batch is neither counted nor checkpointed. If skyd rejects more hashes than
+// the max rejection rate allows, the sweep is aborted with ErrHighRejectionRate
+// after the batch that tripped the guard. Depending on the verify rate, a
+// sample of the blocked hashes is verified to be in skyd's blocklist, missing
+// hashes are marked as failed. If calls is given, every call to skyd to block
+// hashes is recorded in it.
+func (bl *Blocker) blockHashes(ctx context.Context, logger *logrus.Entry, hashes []database.Hash, checkpoint func(batch []database.Hash) error, calls *SkydCalls) (int, int, int, error) {
+	// we only ever persist the hashes of skylinks, so we can only block them
+	// if skyd supports blocking by hash. Older versions would try to parse
+	// the hashes as skylinks and deem them all invalid, so if we can't tell
+	// we mark them as failed and retry later.
+	if err := bl.staticCheckBlockByHash(); err != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+		defer cancel()
+		return 0, 0, len(hashes), errors.Compose(err, bl.staticDB.MarkFailed(ctx, hashes))
+	}
+
+	// abort the call to skyd if the blocker is stopped or the context is
+	// cancelled while skyd is processing a batch
+	ctx, cancel := bl.staticStopContext(ctx)
+	defer cancel()
+
+	// tie the requests to skyd to the sweep, if any
+	if id := sweepID(logger); id != "" {
+		ctx = api.WithRequestID(ctx, id)
+	}
+
 	start := 0
 
-	// keep track of the amount of blocked and invalid hashes
+	// keep track of the amount of blocked, invalid and failed hashes, and of
+	// the amount of hashes that were sent to skyd and rejected
 	var numBlocked int
 	var numInvalid int
+	var numFailed int
+	var numSent int
+	var numRejected int
 
 	for start < len(hashes) {
 		// check whether we need to escape
 		select {
 		case <-bl.staticStopChan:
-			return numBlocked, numInvalid, nil
+			return numBlocked, numInvalid, numFailed, nil
+		case <-ctx.Done():
+			return numBlocked, numInvalid, numFailed, nil
 		default:
 		}
 
@@ -114,219 +627,1789 @@ func (bl *Blocker) BlockHashes(hashes []database.Hash) (int, int, error) {
 		batch := hashes[start:end]
 
 		// send the batch to skyd, if an error occurs we mark it as failed and
-		// escape early because something is probably wrong
-		blocked, invalid, err := bl.staticSkydClient.BlockHashes(batch)
+		// escape early because something is probably wrong. Hashes skyd
+		// rejected as invalid input are returned as invalid by the client.
+		res, err := bl.staticBlockBatch(ctx, logger, batch, calls)
+		blocked, invalid := res.Blocked, res.Invalid
+		confirmedAt := time.Now().UTC()
+		if ctx.Err() != nil {
+			// the batch got interrupted, it's not marked as failed
+			// seeing as the next sweep resumes from the last checkpoint
+			logger.Debugf("blockHashes interrupted, %d hashes left unprocessed", len(hashes)-start)
+			return numBlocked, numInvalid, numFailed, nil
+		}
+		bl.managedUpdateSkydDown(logger, err)
+		if errors.Contains(err, api.ErrSkydUnauthorized) {
+			// marking the hashes as failed won't help, they'd fail again
+			// until the API password is fixed, so we leave them to the
+			// next sweep which starts from the last checkpoint
+			logger.Errorf("skyd rejected the API password, check SIA_API_PASSWORD: %v", err)
+			return numBlocked, numInvalid, numFailed, err
+		}
 		if err != nil {
 			ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
 			defer cancel()
+			bl.staticLogHashes(ctx, logger, batch, "failed to block hash")
 			err = errors.Compose(err, bl.staticDB.MarkFailed(ctx, batch))
-			return numBlocked, numInvalid, err
+			numFailed += len(batch)
+			return numBlocked, numInvalid, numFailed, err
+		}
+
+		// skyd might accept the block without applying it, so we verify a
+		// sample of the blocked hashes and retry the ones that are missing
+		unverified := bl.managedVerifyBlocked(logger, blocked)
+		blocked = database.DiffHashes(blocked, unverified)
+
+		// if skyd rejects too many hashes it's likely broken, in which case
+		// the rejected hashes are marked as failed rather than invalid
+		numSent += len(batch)
+		numRejected += len(invalid)
+		var failed []database.Hash
+		abort := bl.staticRejectionRateExceeded(numSent, numRejected)
+		if abort {
+			failed, invalid = invalid, nil
 		}
 
 		// update the counts
 		numBlocked += len(blocked)
 		numInvalid += len(invalid)
+		numFailed += len(failed) + len(unverified)
 
 		// create a context
-		ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+		dbCtx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+
+		// log the outcome for every hash
+		bl.staticLogHashes(dbCtx, logger, blocked, "blocked hash")
+		if abort {
+			bl.staticLogHashes(dbCtx, logger, failed, "skyd rejected hash, marked as failed")
+		} else {
+			bl.managedLogRejections(dbCtx, logger, res)
+		}
 
 		// update the documents
-		err1 := bl.staticDB.MarkSucceeded(ctx, blocked)
-		err2 := bl.staticDB.MarkInvalid(ctx, invalid)
-		if err := errors.Compose(err1, err2); err != nil {
+		err1 := bl.staticDB.MarkSucceeded(dbCtx, blocked, confirmedAt)
+		err2 := bl.staticDB.MarkInvalid(dbCtx, invalid)
+		err3 := bl.staticDB.MarkFailed(dbCtx, failed)
+		err4 := bl.staticDB.MarkUnverified(dbCtx, unverified, unverifiedReason)
+		if err := errors.Compose(err1, err2, err3, err4); err != nil {
 			cancel()
-			return numBlocked, numInvalid, err
+			return numBlocked, numInvalid, numFailed, err
 		}
 		cancel()
 
+		// propagate the block to the downstream portals, failing to do so is
+		// logged but does not fail the block, skyd blocked the hashes
+		bl.staticBlockOnPortals(ctx, logger, blocked)
+
+		// publish a block event for every blocked hash and append it to
+		// the block log
+		bl.staticRecordBlocked(logger, blocked, confirmedAt)
+
+		// abort without checkpointing the batch, the next sweep resumes from
+		// the last checkpoint
+		if abort {
+			err := fmt.Errorf("skyd rejected %d of the %d hashes sent, exceeding the max rejection rate of %v", numRejected, numSent, bl.staticRejectionRate)
+			logger.Errorf("aborting, skyd seems to reject all hashes: %v", err)
+			return numBlocked, numInvalid, numFailed, errors.Compose(err, ErrHighRejectionRate)
+		}
+
+		// checkpoint the batch
+		if checkpoint != nil {
+			err := checkpoint(batch)
+			if err != nil {
+				return numBlocked, numInvalid, numFailed, err
+			}
+		}
+
 		// update start
 		start = end
 	}
 
-	return numBlocked, numInvalid, nil
+	return numBlocked, numInvalid, numFailed, nil
 }
 
-// Start launches the two backgrounds that periodically scan for new hashes to
-// block or retry hashes that failed to get blocked the first time around.
-func (bl *Blocker) Start() error {
-	bl.staticMu.Lock()
-	defer bl.staticMu.Unlock()
+// managedVerifyBlocked verifies a sample of the given hashes, which skyd
+// accepted to block, are in skyd's blocklist. The size of the sample depends
+// on the verify rate. It returns the hashes that are missing, which means skyd
+// dropped their block. Failing to fetch skyd's blocklist is logged but not
+// considered an error, as skyd did accept the block.
+func (bl *Blocker) managedVerifyBlocked(logger *logrus.Entry, blocked []database.Hash) []database.Hash {
+	if bl.staticVerifyRate == 0 || len(blocked) == 0 {
+		return nil
+	}
 
-	// assert 'Start' is only called once
-	if bl.started {
-		return errors.New("blocker already started")
+	// sample the hashes, every hash is verified with a probability equal
+	// to the verify rate
+	var sample []database.Hash
+	for _, hash := range blocked {
+		if float64(fastrand.Intn(verifySampleResolution)) < bl.staticVerifyRate*verifySampleResolution {
+			sample = append(sample, hash)
+		}
+	}
+	if len(sample) == 0 {
+		return nil
 	}
-	bl.started = true
 
-	// start the loops
-	bl.staticWaitGroup.Add(1)
-	go func() {
-		bl.threadedBlockLoop()
-		bl.staticWaitGroup.Done()
-	}()
+	// check them against skyd's blocklist
+	blocklist, err := bl.staticSkydClient.Blocklist()
+	if err != nil {
+		logger.Warnf("failed to fetch skyd's blocklist, %d blocked hashes are not verified: %v", len(sample), err)
+		return nil
+	}
+	inBlocklist := make(map[database.Hash]struct{}, len(blocklist))
+	for _, hash := range blocklist {
+		inBlocklist[hash] = struct{}{}
+	}
+	var missing []database.Hash
+	for _, hash := range sample {
+		if _, exists := inBlocklist[hash]; !exists {
+			missing = append(missing, hash)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
 
-	bl.staticWaitGroup.Add(1)
+	bl.staticMu.Lock()
+	bl.unverified += uint64(len(missing))
+	bl.staticMu.Unlock()
+	for _, hash := range missing {
+		logger.WithField("hash", hash.String()).Warn(unverifiedReason)
+	}
+	return missing
+}
+
+// staticRejectionRateExceeded returns true if the fraction of the given sent
+// hashes that skyd rejected exceeds the max rejection rate. The rate is only
+// evaluated once at least a batch of hashes was sent.
+func (bl *Blocker) staticRejectionRateExceeded(sent, rejected int) bool {
+	if bl.staticRejectionRate == 0 || sent < blockBatchSize {
+		return false
+	}
+	return float64(rejected)/float64(sent) > bl.staticRejectionRate
+}
+
+// staticStopContext returns a child of the given context that is cancelled
+// when the blocker is stopped.
+func (bl *Blocker) staticStopContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
 	go func() {
-		bl.threadedRetryLoop()
-		bl.staticWaitGroup.Done()
+		select {
+		case <-bl.staticStopChan:
+			cancel()
+		case <-ctx.Done():
+		}
 	}()
+	return ctx, cancel
+}
 
+// staticCheckBlockByHash returns an error if skyd does not support blocking by
+// hash, or if its capabilities could not be probed.
+func (bl *Blocker) staticCheckBlockByHash() error {
+	capabilities, err := bl.staticSkydClient.Capabilities()
+	if err != nil {
+		return errors.AddContext(err, "failed to probe skyd capabilities")
+	}
+	if !capabilities.BlockByHash {
+		return fmt.Errorf("skyd %v does not support blocking by hash", capabilities.Version)
+	}
 	return nil
 }
 
-// Stop waits for the blocker's waitgroup and times out after one minute.
-func (bl *Blocker) Stop() error {
-	// check whether the blocker was started
-	bl.staticMu.Lock()
-	if !bl.started {
-		bl.staticMu.Unlock()
-		return errors.New("blocker not started")
+// staticBlockOnPortals blocks the given hashes on the downstream portals, if
+// a portal blocker is configured. The requests to the portals are aborted when
+// the given context is cancelled. The portals the hashes failed to get blocked
+// on are recorded, the retry loop retries them.
+func (bl *Blocker) staticBlockOnPortals(ctx context.Context, logger *logrus.Entry, hashes []database.Hash) {
+	if bl.staticPortalBlocker == nil || len(hashes) == 0 {
+		return
+	}
+	failed, err := bl.staticPortalBlocker.BlockHashes(ctx, hashes)
+	if err != nil {
+		logger.Errorf("Failed to block %d hashes on downstream portals: %s", len(hashes), err)
+	}
+	logger.Debugf("Downstream portal block counts: %v", bl.staticPortalBlocker.SuccessCounts())
+	if len(failed) == 0 {
+		return
 	}
-	bl.started = false
-	bl.staticMu.Unlock()
 
-	// stop the blocker by closing the stop channel
-	close(bl.staticStopChan)
+	dbCtx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	for _, portalURL := range failed {
+		err := bl.staticDB.MarkPortalFailed(dbCtx, hashes, portalURL)
+		if err != nil {
+			logger.Errorf("Failed to mark %d hashes as failed on portal %s: %s", len(hashes), portalURL, err)
+		}
+	}
+}
 
-	// wait for the waitgroup, timeout and signal unclean shutdown after 1m
-	c := make(chan struct{})
-	go func() {
-		defer close(c)
-		bl.staticWaitGroup.Wait()
-	}()
-	select {
-	case <-c:
+// staticRetryPortals retries blocking the hashes that failed to get blocked
+// on the downstream portals, if a portal blocker is configured. A portal that
+// fails again is left to the next retry, the other portals are retried
+// regardless.
+func (bl *Blocker) staticRetryPortals(logger *logrus.Entry) error {
+	if bl.staticPortalBlocker == nil {
 		return nil
-	case <-time.After(stopTimeoutDuration):
-		return errors.New("unclean blocker shutdown")
 	}
-}
 
-// threadedBlockLoop holds the main block loop
-func (bl *Blocker) threadedBlockLoop() {
-	// convenience variables
-	logger := bl.staticLogger
+	// abort the requests to the portals if the blocker is stopped
+	ctx, cancel := bl.staticStopContext(context.Background())
+	defer cancel()
 
-	for {
-		err := bl.managedBlock()
-		if err != nil {
-			logger.Debugf("threadedBlockLoop error: %v", err)
-		} else {
-			logger.Debugf("threadedBlockLoop ran successfully.")
+	var errs []error
+	for _, portalURL := range bl.staticPortalBlocker.URLs() {
+		retried, err := bl.staticRetryPortal(ctx, portalURL)
+		if retried > 0 {
+			logger.Infof("Blocked %d previously failed hashes on portal %s", retried, portalURL)
 		}
-
-		select {
-		case <-bl.staticStopChan:
-			return
-		case <-time.After(blockInterval):
+		if err != nil {
+			errs = append(errs, errors.AddContext(err, fmt.Sprintf("failed to retry portal %s", portalURL)))
 		}
 	}
+	return errors.Compose(errs...)
 }
 
-// threadedRetryLoop holds the retry loop
-func (bl *Blocker) threadedRetryLoop() {
-	// convenience variables
-	logger := bl.staticLogger
+// staticRetryPortal retries blocking the hashes that failed to get blocked on
+// the downstream portal with the given URL, in batches. It returns the amount
+// of hashes that got blocked, it escapes on the first batch that fails.
+func (bl *Blocker) staticRetryPortal(ctx context.Context, portalURL string) (int, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, database.MongoDefaultTimeout)
+	hashes, err := bl.staticDB.HashesToRetryOnPortal(dbCtx, portalURL)
+	cancel()
+	if err != nil {
+		return 0, errors.AddContext(err, "failed to fetch the hashes to retry")
+	}
 
-	for {
-		err := bl.managedRetryHashes()
+	var retried int
+	for start := 0; start < len(hashes); start += blockBatchSize {
+		end := start + blockBatchSize
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+		batch := hashes[start:end]
+
+		err := bl.staticPortalBlocker.BlockHashesOn(ctx, portalURL, batch)
 		if err != nil {
-			logger.Debugf("threadedRetryLoop error: %v", err)
-		} else {
-			logger.Debugf("threadedRetryLoop ran successfully.")
+			return retried, err
 		}
 
-		select {
-		case <-bl.staticStopChan:
-			return
-		case <-time.After(retryInterval):
+		dbCtx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+		err = bl.staticDB.MarkPortalSucceeded(dbCtx, batch, portalURL)
+		cancel()
+		if err != nil {
+			return retried, err
 		}
+		retried += len(batch)
 	}
+	return retried, nil
 }
 
-// managedBlock sweeps the DB for new hashes to block.
-func (bl *Blocker) managedBlock() error {
-	now := time.Now().UTC()
-	from := bl.managedLatestBlockTime()
+// staticRecordBlocked publishes a block event for every given hash and
+// appends it to the block log, if any. The events carry the time skyd
+// confirmed the block. Failing to publish an event or to write to the block
+// log is logged but does not fail the block.
+func (bl *Blocker) staticRecordBlocked(logger *logrus.Entry, hashes []database.Hash, blockedAt time.Time) {
+	_, noop := bl.staticPublisher.(events.NoopPublisher)
+	if (noop && bl.staticBlockLog == nil) || len(hashes) == 0 {
+		return
+	}
 
-	// Create a context
 	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
 	defer cancel()
-
-	bl.staticLogger.Debugf("managedBlock blocking hashes from %v", from)
-
-	// Fetch hashes to block
-	hashes, err := bl.staticDB.HashesToBlock(ctx, from)
+	sources, err := bl.staticDB.Sources(ctx, hashes)
 	if err != nil {
-		return err
+		logger.Errorf("failed to fetch the sources of the blocked hashes: %v", err)
 	}
-	bl.staticLogger.Debugf("managedBlock found %d hashes", len(hashes))
-	if len(hashes) == 0 {
-		return nil
+	reportIDs, err := bl.staticDB.ReportIDs(ctx, hashes)
+	if err != nil {
+		logger.Errorf("failed to fetch the report IDs of the blocked hashes: %v", err)
 	}
 
-	bl.staticLogger.Tracef("managedBlock will block all these: %+v", hashes)
+	blockEvents := make([]events.BlockEvent, len(hashes))
+	var dropped int
+	for i, hash := range hashes {
+		blockEvents[i] = events.BlockEvent{
+			Hash:      hash,
+			Source:    sources[hash],
+			ReportID:  reportIDs[hash],
+			Timestamp: blockedAt,
+		}
+		if noop {
+			continue
+		}
+		err := bl.staticPublisher.Publish(blockEvents[i])
+		if err != nil {
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		logger.Warnf("failed to publish %d block events", dropped)
+	}
 
-	// Block the hashes
-	blocked, invalid, err := bl.BlockHashes(hashes)
+	if bl.staticBlockLog == nil {
+		return
+	}
+	err = bl.staticBlockLog.managedAppend(blockEvents)
 	if err != nil {
-		bl.staticLogger.Errorf("Failed to block hashes: %s", err)
-		return err
+		logger.Errorf("failed to append %d blocked hashes to the block log: %v", len(hashes), err)
 	}
+}
+
+// managedUpdateSkydDown keeps track of whether skyd is down, depending on the
+// outcome of the last call to block hashes. It logs when skyd goes down or
+// comes back up, rather than on every failed call.
+func (bl *Blocker) managedUpdateSkydDown(logger *logrus.Entry, err error) {
+	bl.staticMu.Lock()
+	defer bl.staticMu.Unlock()
+
+	down := err != nil
+	if down && !bl.skydDown {
+		logger.Warnf("skyd is down, failed to block hashes: %v", err)
+	} else if !down && bl.skydDown {
+		logger.Info("skyd is back up")
+	}
+	bl.skydDown = down
+}
+
+// managedSkydAvailable returns false if the circuit breaker around skyd is
+// open, in which case the sweeps are skipped entirely. Once the cooldown of the
+// circuit breaker expired we probe skyd, if that succeeds the circuit closes
+// and the sweeps resume. It logs when the sweeps get paused or resumed.
+func (bl *Blocker) managedSkydAvailable(logger *logrus.Entry) bool {
+	available := bl.staticSkydClient.CircuitState().State == api.CircuitClosed
+	if !available {
+		available = bl.staticSkydClient.DaemonReady() && bl.staticSkydClient.CircuitState().State == api.CircuitClosed
+	}
+
+	bl.staticMu.Lock()
+	defer bl.staticMu.Unlock()
+	if !available && !bl.circuitOpen {
+		state := bl.staticSkydClient.CircuitState()
+		logger.Warnf("skyd is unavailable, pausing sweeps until at least %v, circuit breaker is %v after %d consecutive failures", state.RetryAt, state.State, state.ConsecutiveFailures)
+	} else if available && bl.circuitOpen {
+		logger.Info("skyd circuit breaker closed, resuming sweeps")
+	}
+	bl.circuitOpen = !available
+	return available
+}
+
+// SetMaintenanceSchedule replaces the schedule of the maintenance windows, it
+// takes effect immediately. The schedule is parsed by ParseMaintenanceSchedule,
+// an empty schedule removes all maintenance windows.
+func (bl *Blocker) SetMaintenanceSchedule(schedule string) error {
+	ms, err := ParseMaintenanceSchedule(schedule)
+	if err != nil {
+		return err
+	}
+	bl.staticMu.Lock()
+	defer bl.staticMu.Unlock()
+	bl.maintenance = ms
+	bl.staticLogger.Infof("maintenance schedule set to '%v'", ms)
+	return nil
+}
+
+// SetSweepInterval sets the amount of time the block loop waits between
+// sweeps, it takes effect after the current wait. A zero interval resets it to
+// the sweep interval the blocker was configured with. If the sweep lease is
+// enabled the interval has to stay below the lease's TTL, otherwise the lease
+// would expire between sweeps.
+func (bl *Blocker) SetSweepInterval(interval time.Duration) error {
+	if interval == 0 {
+		interval = bl.staticSweepInterval
+	}
+	if interval < minSweepInterval || interval > maxSweepInterval {
+		return fmt.Errorf("sweep interval must be between %v and %v", minSweepInterval, maxSweepInterval)
+	}
+	if bl.staticSweepLease > 0 && interval >= bl.staticSweepLease {
+		return fmt.Errorf("sweep interval must be lower than the sweep lease TTL of %v", bl.staticSweepLease)
+	}
+	bl.staticMu.Lock()
+	defer bl.staticMu.Unlock()
+	bl.sweepInterval = interval
+	bl.staticLogger.Infof("sweep interval set to %v", interval)
+	return nil
+}
+
+// SetSuspended suspends or resumes the sweeps, it takes effect immediately.
+// While the sweeps are suspended the block loop, the retry loop and the change
+// stream skip blocking, skylinks that get reported are blocked once the sweeps
+// are resumed, at which point the block loop sweeps right away. Blocks that are
+// requested on demand are not affected.
+func (bl *Blocker) SetSuspended(suspended bool) {
+	bl.staticMu.Lock()
+	defer bl.staticMu.Unlock()
+	if suspended == bl.suspended {
+		return
+	}
+	bl.suspended = suspended
+	if suspended {
+		bl.staticLogger.Info("sweeps suspended")
+		return
+	}
+	bl.staticLogger.Info("sweeps resumed")
+
+	// wake up the block loop, unless it's woken up already
+	select {
+	case bl.staticResumeChan <- struct{}{}:
+	default:
+	}
+}
+
+// ToggleSuspended suspends the sweeps if they're running and resumes them if
+// they're suspended. It returns whether the sweeps are suspended afterwards.
+func (bl *Blocker) ToggleSuspended() bool {
+	bl.staticMu.Lock()
+	suspended := !bl.suspended
+	bl.staticMu.Unlock()
+	bl.SetSuspended(suspended)
+	return suspended
+}
+
+// managedSuspended returns true if an operator suspended the sweeps.
+func (bl *Blocker) managedSuspended() bool {
+	bl.staticMu.Lock()
+	defer bl.staticMu.Unlock()
+	return bl.suspended
+}
+
+// managedSweepInterval returns the amount of time the block loop waits
+// between sweeps.
+func (bl *Blocker) managedSweepInterval() time.Duration {
+	bl.staticMu.Lock()
+	defer bl.staticMu.Unlock()
+	return bl.sweepInterval
+}
+
+// managedInMaintenance returns true if the current time falls in one of the
+// maintenance windows, it logs when a window starts or ends.
+func (bl *Blocker) managedInMaintenance(logger *logrus.Entry) bool {
+	bl.staticMu.Lock()
+	defer bl.staticMu.Unlock()
+	mw, active := bl.maintenance.Active(time.Now())
+	if active && !bl.inMaintenance {
+		logger.Infof("maintenance window %v started, pausing sweeps", mw)
+	} else if !active && bl.inMaintenance {
+		logger.Info("maintenance window ended, resuming sweeps")
+	}
+	bl.inMaintenance = active
+	return active
+}
+
+// managedMaintenanceError returns an error that contains api.ErrMaintenance
+// if the current time falls in one of the maintenance windows.
+func (bl *Blocker) managedMaintenanceError() error {
+	bl.staticMu.Lock()
+	defer bl.staticMu.Unlock()
+	if mw, active := bl.maintenance.Active(time.Now()); active {
+		return errors.AddContext(api.ErrMaintenance, fmt.Sprintf("maintenance window %v", mw))
+	}
+	return nil
+}
+
+// ResolveSkylink resolves the given skylink to a V1 skylink. The resolution
+// is aborted if it takes longer than the resolve timeout, in which case the
+// returned error contains api.ErrResolveTimeout, or if the blocker is stopped.
+func (bl *Blocker) ResolveSkylink(ctx context.Context, sl skymodules.Skylink) (skymodules.Skylink, error) {
+	ctx, cancel := bl.resolveContext(ctx)
+	defer cancel()
+	return bl.staticSkydClient.ResolveSkylink(ctx, sl)
+}
+
+// ResolveSkylinks resolves the given skylinks to V1 skylinks. The skylinks are
+// resolved in a single request to skyd, which is subject to the resolve
+// timeout. If skyd does not support resolving skylinks in batches, or fails to
+// resolve some of them, those skylinks are resolved one at a time. The results
+// are in the order of the given skylinks.
+func (bl *Blocker) ResolveSkylinks(ctx context.Context, skylinks []skymodules.Skylink) []api.ResolveResult {
+	batchCtx, cancel := bl.resolveContext(ctx)
+	resolved, err := bl.staticSkydClient.ResolveSkylinks(batchCtx, skylinks)
+	cancel()
+	if err != nil && !errors.Contains(err, api.ErrBatchResolveUnsupported) {
+		bl.staticLogger.Debugf("failed to resolve %v skylinks in a batch, resolving them one at a time, err: %v", len(skylinks), err)
+	}
+
+	results := make([]api.ResolveResult, len(skylinks))
+	for i, sl := range skylinks {
+		if v1, exists := resolved[sl.String()]; exists {
+			results[i].Resolved = v1
+			continue
+		}
+		results[i].Resolved, results[i].Err = bl.ResolveSkylink(ctx, sl)
+	}
+	return results
+}
+
+// resolveContext returns a context for resolving skylinks, it's cancelled
+// after the resolve timeout or when the blocker is stopped.
+func (bl *Blocker) resolveContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, bl.staticResolveTimeout)
+
+	// abort the resolution when the blocker is stopped
+	go func() {
+		select {
+		case <-bl.staticStopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// BlockStatus returns the block status of the given skylink. If checkSkyd is
+// set, it cross-checks the skylink's record in the database against skyd's
+// blocklist, allowing the caller to verify whether a skylink is blocked end to
+// end. Seeing as that downloads skyd's entire blocklist, it's only meant for
+// admins, otherwise skyd is considered to block the skylink if its record says
+// so. If the given skylink is a V2 skylink, it is resolved before checking its
+// status. If it can't be resolved, the status of its registry entry is
+// returned instead, which is what blocks the V2 skylink itself.
+func (bl *Blocker) BlockStatus(ctx context.Context, skylink string, checkSkyd bool) (api.BlockStatus, error) {
+	// decode the skylink
+	var sl skymodules.Skylink
+	err := sl.LoadString(skylink)
+	if err != nil {
+		return api.BlockStatus{}, errors.AddContext(err, "invalid skylink provided")
+	}
+
+	// resolve the skylink, falling back to the V2 skylink's own hash
+	resolved, err := bl.ResolveSkylink(ctx, sl)
+	if err != nil {
+		bl.staticLogger.Debugf("failed to resolve skylink %v for its block status, err: %v", sl, err)
+		resolved = sl
+	}
+	hash := database.NewHash(resolved)
+	status := api.BlockStatus{Hash: hash.Hash}
+
+	// check the allow list
+	status.AllowListed, err = bl.staticDB.IsAllowListed(ctx, hash.Hash)
+	if err != nil {
+		return api.BlockStatus{}, errors.AddContext(err, "failed to check the allow list")
+	}
+
+	// check the record in the database
+	doc, err := bl.staticDB.FindByHash(ctx, hash)
+	if err != nil {
+		return api.BlockStatus{}, errors.AddContext(err, "failed to find the blocked skylink")
+	}
+	if doc != nil {
+		status.Found = true
+		status.Failed = doc.Failed
+		status.Invalid = doc.Invalid
+		status.Reverted = doc.Reverted
+		status.Annotations = doc.Annotations
+		timestampAdded := doc.TimestampAdded.UTC()
+		status.TimestampAdded = &timestampAdded
+		if !doc.BlockedAt.IsZero() {
+			blockedAt := doc.BlockedAt.UTC()
+			status.BlockedAt = &blockedAt
+		}
+		if doc.Metadata != nil {
+			status.Metadata = &api.SkylinkMetadata{
+				ContentType: doc.Metadata.ContentType,
+				Filename:    doc.Metadata.Filename,
+				Length:      doc.Metadata.Length,
+			}
+		}
+	}
+
+	// without the cross-check the record tells whether skyd blocked it
+	if !checkSkyd {
+		status.BlockedInSkyd = status.BlockedAt != nil && !status.Reverted
+		return status, nil
+	}
+
+	// check whether skyd reports the hash as blocked
+	blocklist, err := bl.staticSkydClient.Blocklist()
+	if err != nil {
+		return api.BlockStatus{}, errors.AddContext(err, "failed to fetch skyd's blocklist")
+	}
+	for _, blocked := range blocklist {
+		if blocked == hash {
+			status.BlockedInSkyd = true
+			break
+		}
+	}
+
+	// add the version of skyd, failing to probe it is not an error
+	capabilities, err := bl.staticSkydClient.Capabilities()
+	if err == nil {
+		status.SkydVersion = capabilities.Version
+	}
+	return status, nil
+}
+
+// UnblockHashes removes the given hashes from skyd's blocklist and marks them
+// as unblocked in the database, recording the given reason. The records are
+// kept in the database so we retain the full history of every skylink.
+func (bl *Blocker) UnblockHashes(ctx context.Context, hashes []database.Hash, reason string) error {
+	// remove the hashes from skyd's blocklist
+	err := bl.staticSkydClient.UnblockHashes(hashes)
+	if err != nil {
+		return errors.AddContext(err, "failed to unblock hashes in skyd")
+	}
+
+	// mark the hashes as unblocked in the database, hashes we have no record
+	// of are ignored
+	var errs []error
+	for _, hash := range hashes {
+		err := bl.staticDB.Unblock(ctx, hash, reason)
+		if err != nil && !errors.Contains(err, database.ErrNoDocumentsFound) {
+			errs = append(errs, errors.AddContext(err, fmt.Sprintf("failed to unblock hash %v", hash)))
+		}
+	}
+	return errors.Compose(errs...)
+}
+
+// UnblockBySource unblocks every skylink that is currently blocked following
+// a report of the given source, e.g. because the source turned out to file
+// reports in bad faith. Skylinks that were reported by other sources as well
+// stay blocked, seeing as those reports are independent of the revoked source,
+// the revocation is recorded in their history instead. It returns the number
+// of skylinks that got unblocked.
+func (bl *Blocker) UnblockBySource(ctx context.Context, source string) (int, error) {
+	if source == "" {
+		return 0, errors.New("source can not be empty")
+	}
+
+	// fetch the skylinks the source reported
+	skylinks, err := bl.staticDB.BlockedBySource(ctx, source)
+	if err != nil {
+		return 0, errors.AddContext(err, "failed to fetch the skylinks reported by the source")
+	}
+
+	// only unblock the skylinks that no other source reported
+	var unblock, keep []database.Hash
+	for _, bsl := range skylinks {
+		if bsl.ReportedByOthers(source) {
+			keep = append(keep, bsl.Hash)
+			continue
+		}
+		unblock = append(unblock, bsl.Hash)
+	}
+
+	// record the revocation in the history of the skylinks that stay blocked
+	reason := fmt.Sprintf("source '%s' got revoked", source)
+	err = bl.staticDB.MarkSourceRevoked(ctx, keep, reason)
+	if err != nil {
+		return 0, errors.AddContext(err, "failed to record the revocation")
+	}
+
+	// unblock the others, in batches to keep the requests to skyd small
+	var unblocked int
+	for start := 0; start < len(unblock); start += blockBatchSize {
+		end := start + blockBatchSize
+		if end > len(unblock) {
+			end = len(unblock)
+		}
+		err = bl.UnblockHashes(ctx, unblock[start:end], reason)
+		if err != nil {
+			return unblocked, errors.AddContext(err, fmt.Sprintf("failed to unblock the skylinks reported by source '%s'", source))
+		}
+		unblocked += end - start
+	}
+
+	bl.staticLogger.Infof("unblocked %v skylinks reported by revoked source '%s', %v skylinks stay blocked because other sources reported them", unblocked, source, len(keep))
+	return unblocked, nil
+}
+
+// RestoreToSnapshot reverses the blocks of the skylinks that were added after
+// the snapshot with the given label, e.g. to roll back a bad bulk import. The
+// skylinks that got blocked are unblocked in skyd and the ones that were not
+// blocked yet are cancelled. Skylinks that were added before the snapshot stay
+// blocked, even if they got reported again after it, so the blocks the import
+// overlaps with are kept. It only reverses blocks, skylinks that got unblocked
+// after the snapshot are not blocked again. If dryRun is set nothing is
+// changed and the outcome holds the hashes that would be reverted. If the
+// snapshot is unknown database.ErrNoDocumentsFound is returned.
+func (bl *Blocker) RestoreToSnapshot(ctx context.Context, label string, dryRun bool) (api.SnapshotRestore, error) {
+	snapshot, err := bl.staticDB.Snapshot(ctx, label)
+	if err != nil {
+		return api.SnapshotRestore{}, err
+	}
+	skylinks, err := bl.staticDB.AddedSince(ctx, snapshot.Timestamp)
+	if err != nil {
+		return api.SnapshotRestore{}, errors.AddContext(err, "failed to fetch the skylinks added after the snapshot")
+	}
+
+	// split the skylinks in the ones to unblock and the ones to cancel
+	var unblock, cancel []database.Hash
+	for _, bsl := range skylinks {
+		if bsl.BlockedAt.IsZero() {
+			cancel = append(cancel, bsl.Hash)
+			continue
+		}
+		unblock = append(unblock, bsl.Hash)
+	}
+	restore := api.SnapshotRestore{
+		Label:     label,
+		Timestamp: snapshot.Timestamp,
+		DryRun:    dryRun,
+	}
+	if dryRun {
+		restore.Unblocked = unblock
+		restore.Cancelled = cancel
+		return restore, nil
+	}
+
+	// cancel the pending skylinks, the ones the sweep blocked in the
+	// meantime are unblocked instead
+	reason := fmt.Sprintf("restored to snapshot '%s'", label)
+	for _, hash := range cancel {
+		err = bl.staticDB.CancelPending(ctx, hash, reason)
+		if errors.Contains(err, database.ErrNoDocumentsFound) {
+			unblock = append(unblock, hash)
+			continue
+		}
+		if err != nil {
+			return restore, errors.AddContext(err, fmt.Sprintf("failed to cancel hash %v", hash))
+		}
+		restore.Cancelled = append(restore.Cancelled, hash)
+	}
+
+	// unblock the others, in batches to keep the requests to skyd small
+	for start := 0; start < len(unblock); start += blockBatchSize {
+		end := start + blockBatchSize
+		if end > len(unblock) {
+			end = len(unblock)
+		}
+		err = bl.UnblockHashes(ctx, unblock[start:end], reason)
+		if err != nil {
+			return restore, errors.AddContext(err, fmt.Sprintf("failed to unblock the skylinks added after snapshot '%s'", label))
+		}
+		restore.Unblocked = append(restore.Unblocked, unblock[start:end]...)
+	}
+
+	bl.staticLogger.Infof("restored to snapshot '%s', unblocked %v skylinks and cancelled %v pending skylinks", label, len(restore.Unblocked), len(restore.Cancelled))
+	return restore, nil
+}
+
+// SetSourceEnabled disables or enables the given report source. The sweep
+// skips the skylinks that were only reported by a disabled source, without
+// unblocking the ones that are already blocked, which allows quarantining a
+// suspect source while its reports are being investigated. Enabling the source
+// again rewinds the latest block timestamp so its skylinks get picked up.
+func (bl *Blocker) SetSourceEnabled(ctx context.Context, source string, enabled bool) error {
+	err := bl.staticDB.SetSourceEnabled(ctx, source, enabled)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		bl.InvalidateLatestBlockTimestamp()
+		bl.staticLogger.Infof("enabled report source '%s'", source)
+		return nil
+	}
+	bl.staticLogger.Infof("disabled report source '%s'", source)
+	return nil
+}
+
+// Start launches the two backgrounds that periodically scan for new hashes to
+// block or retry hashes that failed to get blocked the first time around. If
+// watching inserts is enabled, a third one blocks the skylinks as soon as
+// they're inserted.
+func (bl *Blocker) Start() error {
+	bl.staticMu.Lock()
+	defer bl.staticMu.Unlock()
+
+	// assert 'Start' is only called once
+	if bl.started {
+		return errors.New("blocker already started")
+	}
+	bl.started = true
+
+	// start the loops
+	bl.staticWaitGroup.Add(1)
+	go func() {
+		bl.threadedBlockLoop()
+		bl.staticWaitGroup.Done()
+	}()
+
+	bl.staticWaitGroup.Add(1)
+	go func() {
+		bl.threadedRetryLoop()
+		bl.staticWaitGroup.Done()
+	}()
+
+	if bl.staticWatchInserts {
+		bl.staticWaitGroup.Add(1)
+		go func() {
+			bl.threadedWatchLoop()
+			bl.staticWaitGroup.Done()
+		}()
+	}
+
+	return nil
+}
+
+// Stop waits for the blocker's waitgroup and times out after one minute.
+func (bl *Blocker) Stop() error {
+	// check whether the blocker was started
+	bl.staticMu.Lock()
+	if !bl.started {
+		bl.staticMu.Unlock()
+		return errors.New("blocker not started")
+	}
+	bl.started = false
+	bl.staticMu.Unlock()
+
+	// stop the blocker by closing the stop channel
+	close(bl.staticStopChan)
+
+	// wait for the waitgroup, timeout and signal unclean shutdown after 1m
+	c := make(chan struct{})
+	go func() {
+		defer close(c)
+		bl.staticWaitGroup.Wait()
+	}()
+	select {
+	case <-c:
+	case <-time.After(stopTimeoutDuration):
+		return errors.New("unclean blocker shutdown")
+	}
+
+	// flush the block events, close the block log and release the sweep
+	// lease so another instance can take over immediately
+	var publishErr, blockLogErr error
+	if bp, ok := bl.staticPublisher.(*events.BufferedPublisher); ok {
+		publishErr = bp.Close()
+	}
+	if bl.staticBlockLog != nil {
+		blockLogErr = bl.staticBlockLog.managedClose()
+	}
+	return errors.Compose(publishErr, blockLogErr, bl.managedReleaseSweepLease())
+}
+
+// Sweep runs a single sweep of the database, blocking all hashes that need to
+// be blocked. It's meant for running a sweep on demand, without starting the
+// blocker. It returns the outcome of the sweep, which allows the caller to
+// decide whether to sweep again right away. If the sweep lease is enabled and
+// another instance holds it, ErrSweepLeaseNotHeld is returned.
+func (bl *Blocker) Sweep() (SweepResult, error) {
+	held, err := bl.managedSweepLease()
+	if err != nil {
+		return SweepResult{}, errors.AddContext(err, "failed to acquire the sweep lease")
+	}
+	if !held {
+		return SweepResult{}, ErrSweepLeaseNotHeld
+	}
+	return bl.managedBlock()
+}
+
+// RunUntilDrained sweeps the database back to back, without waiting for the
+// block interval, until there are no more hashes to block. Unlike Start it
+// returns once the backlog is drained, which is useful for one-off migrations
+// and batch jobs. It returns the total amount of hashes that got blocked and
+// the amount that did not, either because skyd deemed them invalid or because
+// they failed to get blocked, across all sweeps. It escapes when the given
+// context is cancelled or the blocker is stopped, in which case the context's
+// error is returned. If the sweep lease is enabled and another instance holds
+// it, ErrSweepLeaseNotHeld is returned.
+//
+// NOTE: if a sweep fails the hashes it did not get to are counted as failed as
+// well, they remain in the backlog and are picked up by the next sweep.
+func (bl *Blocker) RunUntilDrained(ctx context.Context) (int, int, error) {
+	var totalBlocked, totalFailed int
+	for sweeps := 1; ; sweeps++ {
+		// check whether we need to escape
+		select {
+		case <-bl.staticStopChan:
+			return totalBlocked, totalFailed, errors.New("blocker was stopped")
+		case <-ctx.Done():
+			return totalBlocked, totalFailed, ctx.Err()
+		default:
+		}
+
+		held, err := bl.managedSweepLease()
+		if err != nil {
+			return totalBlocked, totalFailed, errors.AddContext(err, "failed to acquire the sweep lease")
+		}
+		if !held {
+			return totalBlocked, totalFailed, ErrSweepLeaseNotHeld
+		}
+
+		result, err := bl.managedBlockSweep(ctx)
+		totalBlocked += result.Blocked
+		if err != nil {
+			totalFailed += result.Hashes - result.Blocked
+			return totalBlocked, totalFailed, errors.AddContext(err, fmt.Sprintf("sweep %d failed", sweeps))
+		}
+		totalFailed += result.Invalid + result.Failed
+		if result.Hashes == 0 {
+			bl.staticLogger.Infof("backlog drained after %d sweeps, blocked %d hashes, %d failed", sweeps, totalBlocked, totalFailed)
+			return totalBlocked, totalFailed, nil
+		}
+	}
+}
+
+// threadedBlockLoop holds the main block loop
+func (bl *Blocker) threadedBlockLoop() {
+	// convenience variables
+	logger := bl.staticLogger
+	warmStart := bl.staticWarmStart > 0
+
+	for {
+		wait := bl.managedSweepInterval()
+
+		// skip the sweep if the database is not connected yet
+		if !bl.staticDB.Connected() {
+			logger.Warnf("threadedBlockLoop skipped, the database is not connected")
+		} else if bl.managedSuspended() {
+			logger.Debugf("threadedBlockLoop skipped, the sweeps are suspended")
+		} else if bl.managedInMaintenance(logger) {
+			logger.Debugf("threadedBlockLoop skipped, in maintenance window")
+		} else if !bl.managedSkydAvailable(logger) {
+			logger.Debugf("threadedBlockLoop skipped, the skyd circuit breaker is open")
+		} else {
+			held, err := bl.managedSweepLease()
+			if err != nil {
+				logger.Errorf("threadedBlockLoop failed to update the sweep lease: %v", err)
+			}
+			if held && warmStart {
+				// the warm start runs once, before the first sweep
+				warmStart = false
+				err = bl.managedWarmStart(context.Background())
+				if err != nil {
+					logger.Errorf("threadedBlockLoop warm start failed, leaving the skylinks to the sweep: %v", err)
+				}
+			}
+			if held {
+				result, err := bl.managedBlock()
+				if err != nil {
+					// back off, rather than waiting for the block
+					// interval, the backoff starts short to recover
+					// quickly from a blip and grows during an outage
+					wait = bl.SweepStatus().Backoff
+					logger.Debugf("threadedBlockLoop error, backing off for %v: %v", wait, err)
+				} else if !result.Drained {
+					// the sweep got interrupted, sweep again right
+					// away rather than waiting for the sweep interval
+					wait = 0
+					logger.Debugf("threadedBlockLoop ran successfully, %d of %d hashes left", result.Hashes-result.Blocked-result.Invalid-result.Failed-result.Skipped, result.Hashes)
+				} else {
+					logger.Debugf("threadedBlockLoop ran successfully in %v, blocked %d hashes", result.Duration, result.Blocked)
+				}
+			}
+		}
+
+		// the sweeps getting resumed cuts the wait short
+		select {
+		case <-bl.staticStopChan:
+			return
+		case <-bl.staticResumeChan:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// threadedRetryLoop holds the retry loop
+func (bl *Blocker) threadedRetryLoop() {
+	// convenience variables
+	logger := bl.staticLogger
+
+	for {
+		// skip the sweep if the database is not connected yet
+		if !bl.staticDB.Connected() {
+			logger.Warnf("threadedRetryLoop skipped, the database is not connected")
+		} else if bl.managedSuspended() {
+			logger.Debugf("threadedRetryLoop skipped, the sweeps are suspended")
+		} else if bl.managedInMaintenance(logger) {
+			logger.Debugf("threadedRetryLoop skipped, in maintenance window")
+		} else if !bl.managedSkydAvailable(logger) {
+			logger.Debugf("threadedRetryLoop skipped, the skyd circuit breaker is open")
+		} else {
+			held, err := bl.managedSweepLease()
+			if err != nil {
+				logger.Errorf("threadedRetryLoop failed to update the sweep lease: %v", err)
+			}
+			if held {
+				err = bl.managedRetryHashes()
+				if err != nil {
+					logger.Debugf("threadedRetryLoop error: %v", err)
+				} else {
+					logger.Debugf("threadedRetryLoop ran successfully.")
+				}
+			}
+		}
+
+		select {
+		case <-bl.staticStopChan:
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// managedWarmStart blocks the most recently added skylinks that have to be
+// blocked, newest first, up to the configured warm start. It does not touch
+// the latest block timestamp, the sweep skips the skylinks that got blocked
+// and the ones that failed are left to the retry loop.
+func (bl *Blocker) managedWarmStart(ctx context.Context) error {
+	logger := bl.staticLogger.WithFields(logrus.Fields{
+		"loop":     loopWarmStart,
+		"sweep_id": newSweepID(),
+	})
+
+	// fetch the most recently added hashes
+	fetchCtx, cancel := context.WithTimeout(ctx, database.MongoDefaultTimeout)
+	defer cancel()
+	hashes, err := bl.staticDB.RecentHashesToBlock(fetchCtx, bl.staticWarmStart)
+	if err != nil {
+		return errors.AddContext(err, "failed to fetch the most recently added hashes")
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+	logger.Infof("warm start, blocking the %d most recently added hashes", len(hashes))
+
+	// consult the pre-block policy and block the hashes, without a
+	// checkpoint as they're not in the order of the sweep
+	start := time.Now().UTC()
+	allowed, skipped, err := bl.staticApplyPrePolicy(fetchCtx, logger, hashes)
+	if err != nil {
+		err = errors.AddContext(err, "failed to apply the pre-block policy")
+		bl.staticRecordSweepStats(logger, loopWarmStart, start, len(hashes), 0, 0, 0, SkydCalls{}, err)
+		return err
+	}
+	var calls SkydCalls
+	blocked, invalid, failed, err := bl.blockHashes(ctx, logger, allowed, nil, &calls)
+	bl.staticRecordSweepStats(logger, loopWarmStart, start, len(hashes), blocked, invalid, 0, calls, err)
+	if err != nil {
+		return err
+	}
+	logger.Infof("warm start blocked %d of %d hashes, %d invalid, %d failed, %d skipped", blocked, len(hashes), invalid, failed, skipped)
+	return nil
+}
+
+// managedBlock sweeps the DB for new hashes to block, it records the outcome
+// of the sweep in the sweep status.
+func (bl *Blocker) managedBlock() (SweepResult, error) {
+	result, err := bl.managedBlockSweep(context.Background())
+	bl.managedRecordSweep(time.Now().UTC(), err)
+	return result, err
+}
+
+// managedRecordSweep records the outcome of a block sweep that completed at
+// the given time.
+func (bl *Blocker) managedRecordSweep(completed time.Time, err error) {
+	bl.staticMu.Lock()
+	defer bl.staticMu.Unlock()
+	if err != nil {
+		bl.consecutiveSweepErrors++
+		return
+	}
+	bl.consecutiveSweepErrors = 0
+	bl.lastSweep = completed
+}
+
+// SweepStatus returns a snapshot of the state of the block sweeps. It's safe
+// to call while the blocker is running.
+func (bl *Blocker) SweepStatus() api.SweepStatus {
+	bl.staticMu.Lock()
+	defer bl.staticMu.Unlock()
+	_, maintenance := bl.maintenance.Active(time.Now())
+	return api.SweepStatus{
+		LastSweep:           bl.lastSweep,
+		ConsecutiveErrors:   bl.consecutiveSweepErrors,
+		Backoff:             bl.staticErrorBackoff.Duration(bl.consecutiveSweepErrors),
+		LeaseHeld:           bl.staticSweepLease == 0 || bl.leaseHeld,
+		Maintenance:         maintenance,
+		MaintenanceSchedule: bl.maintenance.String(),
+		Paused:              bl.circuitOpen,
+		Rejected:            bl.rejected,
+		SkydDown:            bl.skydDown,
+		Suspended:           bl.suspended,
+		SweepInterval:       bl.sweepInterval,
+		Unverified:          bl.unverified,
+	}
+}
+
+// Config returns the configuration of the blocker that is in effect, including
+// the sweep interval and maintenance schedule that might have been adjusted
+// while the blocker is running.
+func (bl *Blocker) Config() api.BlockerConfig {
+	config := api.BlockerConfig{
+		BatchSize:         blockBatchSize,
+		BlockTag:          bl.staticBlockTag,
+		ErrorBackoffMax:   bl.staticErrorBackoff.Max.String(),
+		ErrorBackoffStep:  bl.staticErrorBackoff.Step.String(),
+		ErrorBackoffSteps: bl.staticErrorBackoff.Steps,
+		MaxBlockDelay:     bl.staticDB.MaxBlockDelay().String(),
+		MaxClockSkew:      bl.staticMaxClockSkew.String(),
+		MaxRejectionRate:  bl.staticRejectionRate,
+		PortalBlocker:     bl.staticPortalBlocker != nil,
+		PrePolicy:         bl.staticPrePolicy != nil,
+		ResolveTimeout:    bl.staticResolveTimeout.String(),
+		RetryInterval:     retryInterval.String(),
+		SweepLeaseTTL:     bl.staticSweepLease.String(),
+		VerifyRate:        bl.staticVerifyRate,
+		WarmStart:         bl.staticWarmStart,
+		WatchInserts:      bl.staticWatchInserts,
+	}
+	if bl.staticBlockLog != nil {
+		config.BlockLogMaxSize = bl.staticBlockLog.staticMaxSize
+		config.BlockLogPath = bl.staticBlockLog.staticPath
+	}
+
+	bl.staticMu.Lock()
+	defer bl.staticMu.Unlock()
+	config.MaintenanceSchedule = bl.maintenance.String()
+	config.SweepInterval = bl.sweepInterval.String()
+	return config
+}
+
+// managedBlockSweep sweeps the DB for new hashes to block and returns the
+// outcome of the sweep. If the given context is cancelled the sweep escapes
+// after the current batch.
+func (bl *Blocker) managedBlockSweep(sweepCtx context.Context) (result SweepResult, err error) {
+	now := time.Now().UTC()
+	defer func() {
+		result.Duration = time.Since(now)
+	}()
+
+	// Skylinks that were added after the horizon might still be held back by
+	// the block delay, so the latest block timestamp can't be advanced past
+	// it. Without a block delay the horizon is now.
+	horizon := now.Add(-bl.staticDB.MaxBlockDelay())
+
+	// Every log line of the sweep carries the sweep ID for correlation
+	logger := bl.staticLogger.WithFields(logrus.Fields{
+		"loop":     loopBlock,
+		"sweep_id": newSweepID(),
+	})
+
+	// Create a context
+	ctx, cancel := context.WithTimeout(sweepCtx, database.MongoDefaultTimeout)
+	defer cancel()
+
+	// Fetch the latest block timestamp, this is the time at which we ran
+	// 'BlockHashes' the last time and is used as an offset when fetching all
+	// 'new' hashes to block.
+	from, err := bl.managedLatestBlockTimestamp(ctx)
+	if err != nil {
+		return SweepResult{}, errors.AddContext(err, "failed to fetch latest block timestamp")
+	}
+	if from.After(now.Add(bl.staticMaxClockSkew)) {
+		from, err = bl.managedClampLatestBlockTimestamp(ctx, logger, from, horizon)
+		if err != nil {
+			return SweepResult{}, errors.AddContext(err, "failed to clamp latest block timestamp")
+		}
+	}
+
+	logger.Debugf("managedBlock blocking hashes from %v", from)
+
+	// Quarantine the skylinks with a malformed hash, they can't be blocked
+	// and would otherwise be fetched over and over again
+	malformed, err := bl.staticDB.QuarantineMalformed(ctx, from)
+	if err != nil {
+		logger.Errorf("Failed to quarantine malformed skylinks: %s", err)
+	}
+	if malformed > 0 {
+		logger.Warnf("managedBlock quarantined %d skylinks with a malformed hash", malformed)
+	}
+
+	// Fetch hashes to block
+	hashes, err := bl.staticDB.HashesToBlock(ctx, from)
+	if err != nil {
+		return SweepResult{}, err
+	}
+	logger.Debugf("managedBlock found %d hashes", len(hashes))
+	if len(hashes) == 0 {
+		if malformed > 0 {
+			bl.staticRecordSweepStats(logger, loopBlock, now, 0, 0, 0, malformed, SkydCalls{}, nil)
+		}
+		return SweepResult{Drained: true}, nil
+	}
+
+	logger.Infof("sweep started, blocking %d hashes added since %v", len(hashes), from)
+	logger.Tracef("managedBlock will block all these: %+v", hashes)
+
+	// Consult the pre-block policy
+	result.Hashes = len(hashes)
+	allowed, skipped, err := bl.staticApplyPrePolicy(ctx, logger, hashes)
+	if err != nil {
+		err = errors.AddContext(err, "failed to apply the pre-block policy")
+		bl.staticRecordSweepStats(logger, loopBlock, now, len(hashes), 0, 0, malformed, SkydCalls{}, err)
+		return result, err
+	}
+
+	// The hashes the policy failed to evaluate are marked as failed
+	result.Skipped = skipped
+	result.Failed = len(hashes) - len(allowed) - skipped
 
-	bl.staticLogger.Tracef("managedBlock blocked %v hashes, %v invalid hashes", blocked, invalid)
+	// Block the hashes, the latest block timestamp is advanced after every
+	// batch so a crash mid-sweep loses at most one batch of progress. The
+	// sweep lease is renewed with every checkpoint, if we lost it the sweep
+	// stops without checkpointing, another instance might have taken over.
+	// Every checkpoint only advances the timestamp from the previous one, if
+	// it changed behind our back the sweep stops as well.
+	var checkpointed int
+	last := from
+	checkpoint := func(batch []database.Hash) error {
+		latest, err := bl.managedCheckpointSweep(logger, last, horizon, batch)
+		if err != nil {
+			return err
+		}
+		last = latest
+		checkpointed += len(batch)
+		return nil
+	}
+	blocked, invalid, failed, err := bl.blockHashes(sweepCtx, logger, allowed, checkpoint, &result.SkydCalls)
+	if checkpointed < len(allowed) {
+		bl.staticLogSweepBoundary(logger, allowed, checkpointed)
+	}
+	changed := errors.Contains(err, errLatestBlockTimestampChanged)
+	if changed {
+		// the next sweep resumes from the changed timestamp
+		logger.Infof("managedBlock stopped, the latest block timestamp changed during the sweep")
+		err = nil
+	}
+	result.Blocked = blocked
+	result.Invalid = invalid
+	result.Failed += failed
+	bl.staticRecordSweepStats(logger, loopBlock, now, len(hashes), blocked, invalid, malformed, result.SkydCalls, err)
+	if err != nil {
+		logger.Errorf("Failed to block hashes: %s", err)
+		return result, err
+	}
+
+	// If the blocker got stopped or the sweep got cancelled mid-sweep not all
+	// hashes were processed, in which case we can't advance the timestamp past
+	// the last checkpoint.
+	if changed || blocked+invalid+failed < len(allowed) {
+		return result, nil
+	}
 
 	// Update the latest block time to the time immediately prior to fetching
-	// the hashes from the database.
-	bl.managedUpdateLatestBlockTime(now)
+	// the hashes from the database, or the horizon of the block delay. We use
+	// a new context here because blocking the hashes might have taken longer
+	// than the timeout of the other one.
+	if !horizon.After(last) {
+		result.Drained = true
+		return result, nil
+	}
+	updateCtx, updateCancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer updateCancel()
+	err = bl.managedSetLatestBlockTimestamp(updateCtx, last, horizon)
+	if errors.Contains(err, errLatestBlockTimestampChanged) {
+		logger.Infof("managedBlock did not advance the latest block timestamp, it changed during the sweep")
+		return result, nil
+	}
+	if err != nil {
+		return result, errors.AddContext(err, "failed to update latest block timestamp")
+	}
+	result.Drained = true
+	return result, nil
+}
+
+// managedCheckpointSweep advances the latest block timestamp from the given
+// one, which is the previous checkpoint, to the most recent timestamp at which
+// one of the hashes in the given batch was added. Batches are ordered by that
+// timestamp, so all hashes added before it got processed. The timestamp is
+// never moved back, and never advanced past the given horizon of the block
+// delay. It returns the timestamp the sweep is checkpointed at. The sweep
+// lease is renewed before checkpointing, if that fails an error is returned and
+// the sweep has to stop, as it has if the timestamp changed behind the sweep's
+// back. Failing to checkpoint is logged but not considered an error, it only
+// means more work is redone after a crash.
+func (bl *Blocker) managedCheckpointSweep(logger *logrus.Entry, from, horizon time.Time, batch []database.Hash) (time.Time, error) {
+	held, err := bl.managedRenewSweepLease()
+	if err != nil {
+		return from, errors.AddContext(err, "failed to renew the sweep lease")
+	}
+	if !held {
+		return from, ErrSweepLeaseNotHeld
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+
+	latest, err := bl.staticDB.LatestTimestampAdded(ctx, batch)
+	if err != nil {
+		logger.Errorf("Failed to fetch the timestamp of the sweep checkpoint: %s", err)
+		return from, nil
+	}
+	if latest.After(horizon) {
+		latest = horizon
+	}
+	if !latest.After(from) {
+		return from, nil
+	}
+	err = bl.managedSetLatestBlockTimestamp(ctx, from, latest)
+	if errors.Contains(err, errLatestBlockTimestampChanged) {
+		return from, err
+	}
+	if err != nil {
+		logger.Errorf("Failed to checkpoint the sweep: %s", err)
+		return from, nil
+	}
+	logger.Tracef("managedBlock checkpointed the sweep at %v", latest)
+	return latest, nil
+}
+
+// staticLogSweepBoundary logs the record at which the sweep stopped advancing
+// the latest block timestamp, which is the first of the given hashes that was
+// not checkpointed. The next sweep resumes from that record, logging it allows
+// explaining why a skylink did or did not get retried. The record is only
+// looked up if debug logging is enabled.
+func (bl *Blocker) staticLogSweepBoundary(logger *logrus.Entry, hashes []database.Hash, checkpointed int) {
+	if !logger.Logger.IsLevelEnabled(logrus.DebugLevel) || checkpointed >= len(hashes) {
+		return
+	}
+	boundary := hashes[checkpointed]
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	bsl, err := bl.staticDB.FindByHash(ctx, boundary)
+	if err != nil || bsl == nil {
+		logger.Debugf("managedBlock stopped advancing the latest block timestamp at hash %v after %d of %d hashes, failed to fetch its record: %v", boundary, checkpointed, len(hashes), err)
+		return
+	}
+	logger.Debugf("managedBlock stopped advancing the latest block timestamp at hash %v, added at %v with id %v, after %d of %d hashes", boundary, bsl.TimestampAdded, bsl.ID.Hex(), checkpointed, len(hashes))
+}
+
+// managedClampLatestBlockTimestamp clamps the given latest block timestamp,
+// which is too far in the future. That happens when it's written by a host
+// with a skewed clock, after which every sweep comes up empty. The skylinks
+// added since then were never swept, so it's clamped to the time at which the
+// most recently added skylink that got blocked was added, but never past the
+// given horizon of the block delay. It returns the clamped timestamp.
+func (bl *Blocker) managedClampLatestBlockTimestamp(ctx context.Context, logger *logrus.Entry, latest, horizon time.Time) (time.Time, error) {
+	clamped, err := bl.staticDB.LatestBlockedTimestampAdded(ctx)
+	if err != nil {
+		return time.Time{}, errors.AddContext(err, "failed to fetch the timestamp of the latest blocked skylink")
+	}
+	if clamped.After(horizon) {
+		clamped = horizon
+	}
+	logger.Errorf("latest block timestamp %v is more than %v in the future, likely due to clock skew, clamping it to %v", latest, bl.staticMaxClockSkew, clamped)
+	err = bl.managedSetLatestBlockTimestamp(ctx, latest, clamped)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return clamped, nil
+}
+
+// InvalidateLatestBlockTimestamp drops the cached latest block timestamp,
+// forcing the next sweep to read it from the database. It has to be called by
+// anything that updates the latest block timestamp in the database other than
+// the blocker itself, e.g. to rewind it.
+func (bl *Blocker) InvalidateLatestBlockTimestamp() {
+	bl.staticMu.Lock()
+	defer bl.staticMu.Unlock()
+	bl.latestBlockTimestamp = time.Time{}
+	bl.latestBlockTimestampCached = false
+}
+
+// managedLatestBlockTimestamp returns the latest block timestamp, it's only
+// read from the database if it's not cached.
+func (bl *Blocker) managedLatestBlockTimestamp(ctx context.Context) (time.Time, error) {
+	bl.staticMu.Lock()
+	latest, cached := bl.latestBlockTimestamp, bl.latestBlockTimestampCached
+	bl.staticMu.Unlock()
+	if cached {
+		return latest, nil
+	}
+
+	latest, err := bl.staticDB.LatestBlockTimestamp(ctx, database.DefaultSkydTarget)
+	if err != nil {
+		return time.Time{}, err
+	}
+	bl.staticMu.Lock()
+	bl.latestBlockTimestamp = latest
+	bl.latestBlockTimestampCached = true
+	bl.staticMu.Unlock()
+	return latest, nil
+}
+
+// managedSetLatestBlockTimestamp updates the latest block timestamp in the
+// database from the given expected timestamp, which is the one the caller
+// started from, to the given one and caches it. The timestamp is never written
+// blindly, if it changed in the meantime, e.g. because it got rewound when a
+// report source was enabled again, it's left untouched, the cache is
+// invalidated and errLatestBlockTimestampChanged is returned. If the update
+// fails the cache is invalidated too, as we can't tell whether the update got
+// persisted. The database stores timestamps with millisecond precision, so we
+// cache what reading it back would return.
+func (bl *Blocker) managedSetLatestBlockTimestamp(ctx context.Context, expected, latest time.Time) error {
+	swapped, err := bl.staticDB.SwapLatestBlockTimestamp(ctx, database.DefaultSkydTarget, expected, latest)
+	if err != nil {
+		bl.InvalidateLatestBlockTimestamp()
+		return err
+	}
+	if !swapped {
+		bl.InvalidateLatestBlockTimestamp()
+		return errLatestBlockTimestampChanged
+	}
+	bl.staticMu.Lock()
+	bl.latestBlockTimestamp = latest.UTC().Truncate(time.Millisecond)
+	bl.latestBlockTimestampCached = true
+	bl.staticMu.Unlock()
+	return nil
+}
+
+// managedReleaseSweepLease releases the sweep lease if this instance holds it.
+func (bl *Blocker) managedReleaseSweepLease() error {
+	bl.staticMu.Lock()
+	held := bl.leaseHeld
+	bl.leaseHeld = false
+	bl.staticMu.Unlock()
+	if !held {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	err := bl.staticDB.ReleaseSweepLease(ctx, database.ServerUID)
+	if err != nil {
+		return errors.AddContext(err, "failed to release sweep lease")
+	}
 	return nil
 }
 
-// managedLatestBlockTime returns the latest block time
-func (bl *Blocker) managedLatestBlockTime() time.Time {
+// managedSweepLease returns whether this instance is allowed to sweep the
+// database. If the sweep lease is disabled that is always the case, otherwise
+// it renews the lease if we hold it or tries to acquire it if we don't.
+func (bl *Blocker) managedSweepLease() (bool, error) {
+	if bl.staticSweepLease == 0 {
+		return true, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+
+	// the lock is not held while talking to the database, which would block
+	// everything that reports on the blocker's state
+	bl.staticMu.Lock()
+	held := bl.leaseHeld
+	bl.staticMu.Unlock()
+
+	// renew the lease if we hold it, if that fails we try to acquire it
+	var err error
+	if held {
+		held, err = bl.staticDB.RenewSweepLease(ctx, database.ServerUID, bl.staticSweepLease)
+	}
+	if !held && err == nil {
+		held, err = bl.staticDB.AcquireSweepLease(ctx, database.ServerUID, bl.staticSweepLease)
+	}
+	if err != nil {
+		held = false
+	}
+	bl.managedSetLeaseHeld(held)
+	return held, err
+}
+
+// managedRenewSweepLease renews the sweep lease, it's called by the sweep after
+// every batch. Unlike managedSweepLease it does not try to acquire the lease if
+// we lost it, another instance might be sweeping by now. It returns whether
+// this instance still holds the lease, which is always the case if the sweep
+// lease is disabled.
+func (bl *Blocker) managedRenewSweepLease() (bool, error) {
+	if bl.staticSweepLease == 0 {
+		return true, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+
+	held, err := bl.staticDB.RenewSweepLease(ctx, database.ServerUID, bl.staticSweepLease)
+	if err != nil {
+		held = false
+	}
+	bl.managedSetLeaseHeld(held)
+	return held, err
+}
+
+// managedSetLeaseHeld records whether this instance holds the sweep lease.
+func (bl *Blocker) managedSetLeaseHeld(held bool) {
 	bl.staticMu.Lock()
 	defer bl.staticMu.Unlock()
-	return bl.latestBlockTime
+
+	// another instance might have advanced the latest block timestamp
+	// while we did not hold the lease, so we drop the cached one
+	if held != bl.leaseHeld {
+		bl.latestBlockTimestamp = time.Time{}
+		bl.latestBlockTimestampCached = false
+	}
+
+	// log when we take over or lose the lease
+	if held && !bl.leaseHeld {
+		bl.staticLogger.Infof("acquired the sweep lease, instance %v is now sweeping", database.ServerUID)
+	} else if !held && bl.leaseHeld {
+		bl.staticLogger.Infof("lost the sweep lease, instance %v is now standing by", database.ServerUID)
+	}
+	bl.leaseHeld = held
 }
 
 // managedRetryHashes fetches all blocked skylinks that failed to get blocked
 // the first time and retries them.
 func (bl *Blocker) managedRetryHashes() error {
-	// Create a context
-	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
-	defer cancel()
+	_, _, err := bl.RetryFailed(context.Background())
+
+	// retry the hashes that failed to get blocked on the downstream portals
+	logger := bl.staticLogger.WithField("loop", loopRetry)
+	return errors.Compose(err, bl.staticRetryPortals(logger))
+}
+
+// RetryFailed retries all hashes that failed to get blocked, it's called by
+// the retry loop but can be called on demand as well, e.g. after fixing
+// whatever made skyd fail. Hashes that get blocked are marked as succeeded,
+// hashes that fail again remain failed and are retried by the retry loop. It
+// returns the amount of hashes that were retried and the amount that are still
+// failed. If the given context is cancelled, or the blocker is stopped, the
+// retry stops after the call to skyd for the current batch is aborted, the
+// remaining hashes stay failed.
+//
+// NOTE: the latest block timestamp is purposefully not updated.
+func (bl *Blocker) RetryFailed(ctx context.Context) (int, int, error) {
+	if err := bl.managedMaintenanceError(); err != nil {
+		return 0, 0, err
+	}
+
+	// Every log line of the sweep carries the sweep ID for correlation
+	logger := bl.staticLogger.WithFields(logrus.Fields{
+		"loop":     loopRetry,
+		"sweep_id": newSweepID(),
+	})
 
 	// Fetch hashes to retry
-	hashes, err := bl.staticDB.HashesToRetry(ctx)
+	fetchCtx, fetchCancel := context.WithTimeout(ctx, database.MongoDefaultTimeout)
+	defer fetchCancel()
+	hashes, err := bl.staticDB.HashesToRetry(fetchCtx)
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 
 	// Escape early if there are none
 	if len(hashes) == 0 {
-		return nil
+		return 0, 0, nil
 	}
 
-	bl.staticLogger.Tracef("managedRetryHashes will retry all these: %+v", hashes)
+	logger.Infof("sweep started, retrying %d hashes", len(hashes))
+	logger.Tracef("RetryFailed will retry all these: %+v", hashes)
 
-	// Retry the hashes
-	blocked, _, err := bl.BlockHashes(hashes)
+	// Consult the pre-block policy, the hashes it denies are no longer
+	// failed
+	start := time.Now().UTC()
+	policyCtx, policyCancel := context.WithTimeout(ctx, database.MongoDefaultTimeout)
+	defer policyCancel()
+	allowed, skipped, err := bl.staticApplyPrePolicy(policyCtx, logger, hashes)
 	if err != nil {
-		bl.staticLogger.Errorf("Failed to retry skylinks: %s", err)
-		return err
+		err = errors.AddContext(err, "failed to apply the pre-block policy")
+		bl.staticRecordSweepStats(logger, loopRetry, start, len(hashes), 0, 0, 0, SkydCalls{}, err)
+		return len(hashes), len(hashes), err
 	}
 
-	bl.staticLogger.Tracef("managedRetryHashes blocked %v hashes", blocked)
+	// Retry the hashes, the hashes skyd deemed invalid are no longer failed
+	var calls SkydCalls
+	blocked, invalid, _, err := bl.blockHashes(ctx, logger, allowed, nil, &calls)
+	bl.staticRecordSweepStats(logger, loopRetry, start, len(hashes), blocked, invalid, 0, calls, err)
+	stillFailed := len(hashes) - skipped - blocked - invalid
+	if err != nil {
+		logger.Errorf("Failed to retry skylinks: %s", err)
+		return len(hashes), stillFailed, err
+	}
+	return len(hashes), stillFailed, nil
+}
 
-	// NOTE: we purposefully do not update the latest block timestamp in the
-	// retry loop
+// ScanIntegrity scans the database for skylinks that are malformed or in an
+// inconsistent state and returns a report of the problems it found. Pending
+// skylinks that were added too long before the latest block timestamp for the
+// sweeps to pick them up are reported as stranded. If repair is set the
+// problems that are trivially fixable are repaired, e.g. stranded skylinks are
+// handed to the retry loop. The problems that are found are logged.
+func (bl *Blocker) ScanIntegrity(ctx context.Context, repair bool) (database.IntegrityReport, error) {
+	latest, err := bl.managedLatestBlockTimestamp(ctx)
+	if err != nil {
+		return database.IntegrityReport{}, errors.AddContext(err, "failed to fetch the latest block timestamp")
+	}
+	report, err := bl.staticDB.ScanIntegrity(ctx, database.IntegrityScanOptions{
+		Repair:         repair,
+		SampleSize:     integritySampleSize,
+		StrandedBefore: latest,
+	})
+	if err != nil {
+		return database.IntegrityReport{}, err
+	}
+	for _, problem := range report.Problems {
+		if problem.Count > 0 {
+			bl.staticLogger.Warnf("ScanIntegrity found %d skylinks with problem '%v', repaired %d", problem.Count, problem.Type, problem.Repaired)
+		}
+	}
+	return report, nil
+}
 
-	return nil
+// staticApplyPrePolicy consults the pre-block policy for every given hash and
+// returns the hashes that are allowed to be blocked, in the given order, and
+// the number of hashes it denied. The hashes the policy denies are marked as
+// skipped. The hashes the policy failed to evaluate are marked as failed and
+// omitted as well, the retry loop consults the policy again. If no policy is
+// set all hashes are allowed.
+func (bl *Blocker) staticApplyPrePolicy(ctx context.Context, logger *logrus.Entry, hashes []database.Hash) ([]database.Hash, int, error) {
+	if bl.staticPrePolicy == nil || len(hashes) == 0 {
+		return hashes, 0, nil
+	}
+
+	skylinks, err := bl.staticDB.FindByHashes(ctx, hashes)
+	if err != nil {
+		return nil, 0, errors.AddContext(err, "failed to fetch the skylinks")
+	}
+	byHash := make(map[database.Hash]database.BlockedSkylink, len(skylinks))
+	for _, sl := range skylinks {
+		byHash[sl.Hash] = sl
+	}
+
+	allowed := make([]database.Hash, 0, len(hashes))
+	var failed []database.Hash
+	var skipped int
+	var skipErr error
+	for _, hash := range hashes {
+		sl, exists := byHash[hash]
+		if !exists {
+			continue
+		}
+		allow, reason, err := bl.staticPrePolicy(ctx, sl)
+		if err != nil {
+			logger.Errorf("pre-block policy failed to evaluate hash %v, retrying later: %v", hash, err)
+			failed = append(failed, hash)
+			continue
+		}
+		if allow {
+			allowed = append(allowed, hash)
+			continue
+		}
+		logger.Infof("pre-block policy skipped hash %v: %v", hash, reason)
+		skipped++
+		err = bl.staticDB.MarkSkipped(ctx, hash, reason)
+		if err != nil && !errors.Contains(err, database.ErrNoDocumentsFound) {
+			skipErr = errors.Compose(skipErr, err)
+		}
+	}
+	if skipErr != nil {
+		return nil, 0, errors.AddContext(skipErr, "failed to mark skipped hashes")
+	}
+	err = bl.staticDB.MarkFailed(ctx, failed)
+	if err != nil {
+		return nil, 0, errors.AddContext(err, "failed to mark hashes the policy failed to evaluate")
+	}
+	return allowed, skipped, nil
+}
+
+// staticLogHashes logs the given message at debug level for every given hash,
+// the log lines include the report ID of the hash as a structured field which
+// allows tracing a report all the way from ingestion to skyd.
+func (bl *Blocker) staticLogHashes(ctx context.Context, logger *logrus.Entry, hashes []database.Hash, msg string) {
+	if len(hashes) == 0 || !logger.Logger.IsLevelEnabled(logrus.DebugLevel) {
+		return
+	}
+
+	reportIDs, err := bl.staticDB.ReportIDs(ctx, hashes)
+	if err != nil {
+		logger.Errorf("failed to fetch report IDs: %v", err)
+	}
+	for _, hash := range hashes {
+		logger.WithFields(logrus.Fields{
+			"hash":     hash.String(),
+			"reportid": reportIDs[hash],
+		}).Debug(msg)
+	}
 }
 
-// managedUpdateLatestBlockTime updates the latest block time
-func (bl *Blocker) managedUpdateLatestBlockTime(latest time.Time) {
+// managedLogRejections logs every hash skyd rejected as invalid at warning
+// level, alongside the error skyd rejected it with, and counts the rejections.
+// Skyd rejects these hashes permanently, they are quarantined by marking them
+// as invalid, so they should be looked into.
+func (bl *Blocker) managedLogRejections(ctx context.Context, logger *logrus.Entry, res api.BlockResult) {
+	if len(res.Invalid) == 0 {
+		return
+	}
+
 	bl.staticMu.Lock()
-	defer bl.staticMu.Unlock()
-	bl.latestBlockTime = latest
+	bl.rejected += uint64(len(res.Invalid))
+	bl.staticMu.Unlock()
+
+	reportIDs, err := bl.staticDB.ReportIDs(ctx, res.Invalid)
+	if err != nil {
+		logger.Errorf("failed to fetch report IDs: %v", err)
+	}
+	for _, hash := range res.Invalid {
+		logger.WithFields(logrus.Fields{
+			"hash":     hash.String(),
+			"reportid": reportIDs[hash],
+			"error":    res.Rejections[hash],
+		}).Warn("skyd rejected hash, it is quarantined")
+	}
+}
+
+// staticRecordSweepStats logs the outcome of a sweep and records its
+// statistics in the database, including the number of calls to skyd per
+// blocked hash, which surfaces sweeps that take an unusual amount of calls.
+// Failing to record them is logged but not considered an error, as these
+// statistics are purely diagnostic.
+func (bl *Blocker) staticRecordSweepStats(logger *logrus.Entry, loop string, start time.Time, hashes, blocked, invalid, malformed int, calls SkydCalls, sweepErr error) {
+	stats := database.SweepStats{
+		Timestamp:       start,
+		Loop:            loop,
+		Hashes:          hashes,
+		Blocked:         blocked,
+		Invalid:         invalid,
+		Malformed:       malformed,
+		SkydCalls:       calls.Calls,
+		CallsPerBlocked: calls.PerBlocked(blocked),
+		Duration:        time.Since(start),
+	}
+	if sweepErr != nil {
+		stats.Error = sweepErr.Error()
+	}
+	stats.SweepID = sweepID(logger)
+
+	logger.WithFields(logrus.Fields{
+		"hashes":            hashes,
+		"blocked":           blocked,
+		"invalid":           invalid,
+		"malformed":         malformed,
+		"skyd_calls":        stats.SkydCalls,
+		"calls_per_blocked": stats.CallsPerBlocked,
+		"duration":          stats.Duration,
+	}).Info("sweep finished")
+
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	err := bl.staticDB.InsertSweepStats(ctx, stats)
+	if err != nil {
+		logger.Errorf("failed to record sweep stats: %v", err)
+	}
+}
+
+// newComponentLogger returns the logger of the blocker, all of its log lines
+// carry the component field. If a log level is given, the blocker gets a
+// logger of its own that shares the output, formatter and hooks of the given
+// logger but logs at the given level.
+func newComponentLogger(logger *logrus.Logger, level string) (*logrus.Entry, error) {
+	if level != "" {
+		lvl, err := logrus.ParseLevel(level)
+		if err != nil {
+			return nil, err
+		}
+		own := logrus.New()
+		own.Out = logger.Out
+		own.Formatter = logger.Formatter
+		own.Hooks = logger.Hooks
+		own.ReportCaller = logger.ReportCaller
+		own.ExitFunc = logger.ExitFunc
+		own.SetLevel(lvl)
+		logger = own
+	}
+	return logger.WithField("component", "blocker"), nil
+}
+
+// sweepID returns the ID of the sweep the given logger belongs to, or an empty
+// string if it does not belong to a sweep.
+func sweepID(logger *logrus.Entry) string {
+	id, _ := logger.Data["sweep_id"].(string)
+	return id
+}
+
+// newSweepID returns a random identifier for a sweep, it's included in every
+// log line of the sweep.
+func newSweepID() string {
+	return hex.EncodeToString(fastrand.Bytes(8))
 }
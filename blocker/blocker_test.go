@@ -1,22 +1,52 @@
 package blocker
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/SkynetLabs/blocker/api"
 	"github.com/SkynetLabs/blocker/database"
 	"github.com/sirupsen/logrus"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
 	skyapi "gitlab.com/SkynetLabs/skyd/node/api"
+	"gitlab.com/SkynetLabs/skyd/skymodules"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.sia.tech/siad/crypto"
+	"go.sia.tech/siad/types"
+)
+
+var (
+	// blockedSkylinkStr is a skylink that is reported as blocked by the mocked
+	// skyd blocklist endpoint
+	blockedSkylinkStr = "_B19BtlWtjjR7AD0DDzxYanvIhZ7cxXrva5tNNxDht1kaA"
 )
 
 // mockBlocklistResponse is a mock handler for the /skynet/blocklist endpoint
 func mockBlocklistResponse(w http.ResponseWriter, r *http.Request) {
+	// GET requests return skyd's blocklist
+	if r.Method == http.MethodGet {
+		var sl skymodules.Skylink
+		err := sl.LoadString(blockedSkylinkStr)
+		if err != nil {
+			panic(err)
+		}
+		skyapi.WriteJSON(w, skyapi.SkynetBlocklistGET{
+			Blocklist: []crypto.Hash{database.NewHash(sl).Hash},
+		})
+		return
+	}
+
 	var request skyapi.SkynetBlocklistPOST
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
@@ -36,6 +66,11 @@ func mockBlocklistResponse(w http.ResponseWriter, r *http.Request) {
 	skyapi.WriteJSON(w, response)
 }
 
+// mockVersionResponse is a mock handler for the /daemon/version endpoint
+func mockVersionResponse(w http.ResponseWriter, r *http.Request) {
+	skyapi.WriteJSON(w, skyapi.DaemonVersion{Version: "1.5.9"})
+}
+
 // TestBlocker runs the blocker unit tests
 func TestBlocker(t *testing.T) {
 	if testing.Short() {
@@ -46,6 +81,7 @@ func TestBlocker(t *testing.T) {
 	// create a test server that returns mocked responses used by our subtests
 	mux := http.NewServeMux()
 	mux.HandleFunc("/skynet/blocklist", mockBlocklistResponse)
+	mux.HandleFunc("/daemon/version", mockVersionResponse)
 	server := httptest.NewServer(mux)
 	defer server.Close()
 
@@ -57,6 +93,78 @@ func TestBlocker(t *testing.T) {
 			name: "BlockHashes",
 			test: testBlockHashes,
 		},
+		{
+			name: "RejectedHash",
+			test: testRejectedHash,
+		},
+		{
+			name: "HighRejectionRate",
+			test: testHighRejectionRate,
+		},
+		{
+			name: "VerifyBlocks",
+			test: testVerifyBlocks,
+		},
+		{
+			name: "BlockStatus",
+			test: testBlockStatus,
+		},
+		{
+			name: "UnblockBySource",
+			test: testUnblockBySource,
+		},
+		{
+			name: "RestoreToSnapshot",
+			test: testRestoreToSnapshot,
+		},
+		{
+			name: "LatestBlockTimestampCache",
+			test: testLatestBlockTimestampCache,
+		},
+		{
+			name: "FutureLatestBlockTimestamp",
+			test: testFutureLatestBlockTimestamp,
+		},
+		{
+			name: "PrePolicy",
+			test: testPrePolicy,
+		},
+		{
+			name: "RetryFailed",
+			test: testRetryFailed,
+		},
+		{
+			name: "RunUntilDrained",
+			test: testRunUntilDrained,
+		},
+		{
+			name: "RetryFailedInterrupted",
+			test: testRetryFailedInterrupted,
+		},
+		{
+			name: "SweepCheckpoint",
+			test: testSweepCheckpoint,
+		},
+		{
+			name: "SweepLeaseLost",
+			test: testSweepLeaseLost,
+		},
+		{
+			name: "SkydCallsTagged",
+			test: testSkydCallsTagged,
+		},
+		{
+			name: "SweepOrder",
+			test: testSweepOrder,
+		},
+		{
+			name: "WarmStart",
+			test: testWarmStart,
+		},
+		{
+			name: "WatchAndBlock",
+			test: testWatchAndBlock,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -65,6 +173,203 @@ func TestBlocker(t *testing.T) {
 	}
 }
 
+// TestNewComponentLogger is a unit test for the newComponentLogger helper.
+func TestNewComponentLogger(t *testing.T) {
+	t.Parallel()
+
+	// create a logger that logs at info level
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &buf
+	logger.SetLevel(logrus.InfoLevel)
+
+	// assert the level is inherited by default
+	entry, err := newComponentLogger(logger, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Logger != logger {
+		t.Fatal("expected the given logger to be used")
+	}
+
+	// assert the blocker can log at its own level
+	entry, err = newComponentLogger(logger, "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !entry.Logger.IsLevelEnabled(logrus.DebugLevel) || logger.IsLevelEnabled(logrus.DebugLevel) {
+		t.Fatal("unexpected log levels")
+	}
+
+	// assert it shares the output and adds the component field
+	entry.Debug("message")
+	if !strings.Contains(buf.String(), "component=blocker") {
+		t.Fatal("unexpected output", buf.String())
+	}
+
+	// assert invalid levels are rejected
+	_, err = newComponentLogger(logger, "verbose")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// TestSweepStatus verifies the sweep status reflects the outcome of the sweeps
+// and can be read while the sweeps record their outcome, run it with -race to
+// detect unsynchronized access.
+func TestSweepStatus(t *testing.T) {
+	t.Parallel()
+
+	bl := &Blocker{}
+
+	// record sweeps concurrently while reading the status
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			bl.managedRecordSweep(time.Now(), errors.New("sweep failed"))
+		}()
+		go func() {
+			defer wg.Done()
+			_ = bl.SweepStatus()
+		}()
+	}
+	wg.Wait()
+
+	// assert the errors were counted
+	status := bl.SweepStatus()
+	if status.ConsecutiveErrors != 10 || !status.LastSweep.IsZero() {
+		t.Fatal("unexpected status", status)
+	}
+
+	// assert a successful sweep resets the error count
+	completed := time.Now()
+	bl.managedRecordSweep(completed, nil)
+	status = bl.SweepStatus()
+	if status.ConsecutiveErrors != 0 || !status.LastSweep.Equal(completed) {
+		t.Fatal("unexpected status", status)
+	}
+
+	// assert the lease is considered held if the sweep lease is disabled
+	if !status.LeaseHeld {
+		t.Fatal("expected lease to be held")
+	}
+}
+
+// TestErrorBackoff verifies the backoff curve matches the configured
+// parameters and that the parameters are validated.
+func TestErrorBackoff(t *testing.T) {
+	t.Parallel()
+
+	// assert the default curve tops out after the linear ramp
+	def, err := ErrorBackoff{}.withDefaults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def != DefaultErrorBackoff() {
+		t.Fatal("unexpected defaults", def)
+	}
+	if def.Duration(6) != def.Max || def.Duration(100) != def.Max {
+		t.Fatal("unexpected backoff", def.Duration(6), def.Duration(100))
+	}
+
+	// assert a configured curve ramps up linearly, then doubles until it
+	// reaches the ceiling
+	eb, err := ErrorBackoff{Step: time.Second, Steps: 3, Max: 20 * time.Second}.withDefaults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second, 6 * time.Second, 12 * time.Second, 20 * time.Second, 20 * time.Second}
+	for failures, backoff := range expected {
+		if eb.Duration(failures) != backoff {
+			t.Fatalf("unexpected backoff after %d failures, %v != %v", failures, eb.Duration(failures), backoff)
+		}
+	}
+
+	// assert invalid parameters are rejected
+	_, err = ErrorBackoff{Step: -time.Second}.withDefaults()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	_, err = ErrorBackoff{Step: time.Minute, Max: time.Second}.withDefaults()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	// assert the backoff is exposed in the sweep status
+	bl := &Blocker{staticErrorBackoff: eb}
+	bl.managedRecordSweep(time.Now(), errors.New("sweep failed"))
+	bl.managedRecordSweep(time.Now(), errors.New("sweep failed"))
+	if status := bl.SweepStatus(); status.ConsecutiveErrors != 2 || status.Backoff != 2*time.Second {
+		t.Fatal("unexpected status", status)
+	}
+}
+
+// TestBlockHashesInterrupted verifies a slow call to skyd is aborted when the
+// context is cancelled or the blocker is stopped, and that the interrupted
+// batch is not considered a failure.
+func TestBlockHashesInterrupted(t *testing.T) {
+	t.Parallel()
+
+	// create a skyd that hangs until the request is aborted, the body has to
+	// be read for the server to notice the client went away
+	mux := http.NewServeMux()
+	mux.HandleFunc("/daemon/version", mockVersionResponse)
+	mux.HandleFunc("/skynet/blocklist", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Minute):
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		interrupt func(bl *Blocker, cancel context.CancelFunc)
+	}{
+		{
+			name:      "Cancelled",
+			interrupt: func(_ *Blocker, cancel context.CancelFunc) { cancel() },
+		},
+		{
+			name:      "Stopped",
+			interrupt: func(bl *Blocker, _ context.CancelFunc) { close(bl.staticStopChan) },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger := logrus.New()
+			logger.Out = ioutil.Discard
+			bl := &Blocker{
+				staticLogger:     logrus.NewEntry(logger),
+				staticSkydClient: api.NewSkydClient(server.URL, ""),
+				staticStopChan:   make(chan struct{}),
+			}
+
+			// interrupt the blocker while skyd is processing the batch
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			time.AfterFunc(100*time.Millisecond, func() { test.interrupt(bl, cancel) })
+
+			start := time.Now()
+			hashes := []database.Hash{database.HashBytes([]byte("skylink"))}
+			blocked, invalid, failed, err := bl.blockHashes(ctx, bl.staticLogger, hashes, nil, nil)
+			if err != nil || blocked != 0 || invalid != 0 || failed != 0 {
+				t.Fatal("unexpected outcome", blocked, invalid, failed, err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Fatal("blockHashes did not return promptly", elapsed)
+			}
+			if bl.SweepStatus().SkydDown {
+				t.Fatal("an interrupted call should not mark skyd as down")
+			}
+		})
+	}
+}
+
 // testBlockHashes is a unit test that covers the 'blockHashes' method.
 func testBlockHashes(t *testing.T, server *httptest.Server) {
 	// create a client that connects to our server
@@ -92,11 +397,8 @@ func testBlockHashes(t *testing.T, server *httptest.Server) {
 		}
 	}()
 
-	// create a list of 16 hashes, where the 10th hash is one that triggers an
-	// error to be thrown in skyd, this will ensure the blocker tries:
-	// - all hashes in 1 batch
-	// - a batch size of 10, which still fails
-	// - all hashes in a batch size of 1, which returns the failing hash
+	// create a list of 16 hashes, where the 10th hash is one that skyd deems
+	// invalid, skyd reports it rather than failing the batch
 	var hashes []database.Hash
 	var i int
 	for ; i < 9; i++ {
@@ -112,7 +414,7 @@ func testBlockHashes(t *testing.T, server *httptest.Server) {
 		hashes = append(hashes, hash)
 	}
 
-	blocked, invalid, err := blocker.BlockHashes(hashes)
+	blocked, invalid, err := blocker.BlockHashes(ctx, hashes)
 	if err != nil {
 		t.Fatal("unexpected error thrown", err)
 	}
@@ -123,21 +425,1778 @@ func testBlockHashes(t *testing.T, server *httptest.Server) {
 	if invalid != 1 {
 		t.Fatalf("unexpected return values for invalid, %v != 1", invalid)
 	}
+
+	// assert the hashes took a single call to skyd
+	var calls SkydCalls
+	_, _, _, err = blocker.blockHashes(ctx, blocker.staticLogger, hashes, nil, &calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls.Calls != 1 || !reflect.DeepEqual(calls.BatchSizes, map[int]int{len(hashes): 1}) {
+		t.Fatal("unexpected calls", calls)
+	}
+
+	// assert more hashes than fit in a batch take a call per batch
+	hashes = nil
+	for i := 0; i < 2*blockBatchSize+blockBatchSize/2; i++ {
+		hashes = append(hashes, database.HashBytes([]byte(fmt.Sprintf("skylink_batch_%d", i))))
+	}
+	calls = SkydCalls{}
+	_, _, _, err = blocker.blockHashes(ctx, blocker.staticLogger, hashes, nil, &calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[int]int{blockBatchSize: 2, blockBatchSize / 2: 1}
+	if calls.Calls != 3 || !reflect.DeepEqual(calls.BatchSizes, expected) {
+		t.Fatal("unexpected calls", calls)
+	}
 }
 
-// newTestBlocker returns a new blocker instance
-func newTestBlocker(ctx context.Context, dbName string, skydClient *api.SkydClient) (*Blocker, error) {
-	// create database
-	db := database.NewTestDB(context.Background(), dbName)
+// testRejectedHash verifies a hash skyd rejects is counted and quarantined, so
+// it's no longer picked up by the sweeps.
+func testRejectedHash(t *testing.T, server *httptest.Server) {
+	// create a client that connects to our server
+	client := api.NewSkydClient(server.URL, "")
 
-	// create a nil logger
+	// create the blocker
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	blocker, err := newTestBlocker(ctx, "RejectedHash", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// report a valid hash and the hash the mocked skyd rejects
+	valid := database.HashBytes([]byte("skylink_hash"))
+	rejected := database.HashBytes([]byte("invalid_hash"))
+	for _, hash := range []database.Hash{valid, rejected} {
+		err = blocker.staticDB.CreateBlockedSkylink(ctx, &database.BlockedSkylink{
+			Hash:           hash,
+			TimestampAdded: time.Now().UTC(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// block them
+	blocked, invalid, err := blocker.BlockHashes(ctx, []database.Hash{valid, rejected})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocked != 1 || invalid != 1 {
+		t.Fatal("unexpected outcome", blocked, invalid)
+	}
+
+	// assert the rejection got counted
+	if status := blocker.SweepStatus(); status.Rejected != 1 {
+		t.Fatal("unexpected number of rejections", status.Rejected)
+	}
+
+	// assert the rejected hash is quarantined
+	doc, err := blocker.staticDB.FindByHash(ctx, rejected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc == nil || !doc.Invalid {
+		t.Fatal("expected the rejected hash to be marked invalid", doc)
+	}
+	toBlock, err := blocker.staticDB.HashesToBlock(ctx, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	toRetry, err := blocker.staticDB.HashesToRetry(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toBlock) != 0 || len(toRetry) != 0 {
+		t.Fatal("expected the rejected hash to be quarantined", toBlock, toRetry)
+	}
+}
+
+// testHighRejectionRate verifies the blocker aborts when skyd rejects more
+// hashes than the max rejection rate allows, and that the rejected hashes are
+// marked as failed rather than invalid.
+func testHighRejectionRate(t *testing.T, _ *httptest.Server) {
+	// create a server that rejects every hash
+	var requests int
+	var mu sync.Mutex
+	mux := http.NewServeMux()
+	mux.HandleFunc("/daemon/version", mockVersionResponse)
+	mux.HandleFunc("/skynet/blocklist", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+
+		var request skyapi.SkynetBlocklistPOST
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			panic(err)
+		}
+		var response api.BlockResponse
+		for _, hash := range request.Add {
+			response.Invalids = append(response.Invalids, api.InvalidInput{Input: hash, Error: "invalid hash"})
+		}
+		skyapi.WriteJSON(w, response)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// create a blocker that allows half of the hashes to be rejected
 	logger := logrus.New()
 	logger.Out = ioutil.Discard
+	db := database.NewTestDB(context.Background(), "HighRejectionRate")
+	blocker, err := New(api.NewSkydClient(server.URL, ""), db, Options{MaxRejectionRate: 0.5}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	// create the blocker
-	blocker, err := New(skydClient, db, logger)
+	// report two batches worth of hashes
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	hashes := make([]database.Hash, 2*blockBatchSize)
+	for i := range hashes {
+		hashes[i] = database.HashBytes([]byte(fmt.Sprintf("skylink_%d", i)))
+		err = db.CreateBlockedSkylink(ctx, &database.BlockedSkylink{
+			Hash:           hashes[i],
+			TimestampAdded: time.Now().UTC(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// assert the blocker aborts after the first batch
+	blocked, invalid, err := blocker.BlockHashes(ctx, hashes)
+	if !errors.Contains(err, ErrHighRejectionRate) {
+		t.Fatal("unexpected error", err)
+	}
+	if blocked != 0 || invalid != 0 {
+		t.Fatal("unexpected outcome", blocked, invalid)
+	}
+	mu.Lock()
+	numRequests := requests
+	mu.Unlock()
+	if numRequests != 1 {
+		t.Fatal("unexpected number of requests", numRequests)
+	}
+	if status := blocker.SweepStatus(); status.Rejected != 0 {
+		t.Fatal("unexpected number of rejections", status.Rejected)
+	}
+
+	// assert the first batch is retried rather than quarantined
+	toRetry, err := db.HashesToRetry(ctx)
 	if err != nil {
-		return nil, err
+		t.Fatal(err)
+	}
+	if len(toRetry) != blockBatchSize {
+		t.Fatal("unexpected number of hashes to retry", len(toRetry))
+	}
+	doc, err := db.FindByHash(ctx, hashes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc == nil || doc.Invalid {
+		t.Fatal("expected the rejected hash not to be marked invalid", doc)
+	}
+}
+
+// testVerifyBlocks verifies the blocker marks hashes skyd accepted to block,
+// but that are missing from its blocklist, as failed.
+func testVerifyBlocks(t *testing.T, _ *httptest.Server) {
+	hashes := []database.Hash{
+		database.HashBytes([]byte("skylink_1")),
+		database.HashBytes([]byte("skylink_2")),
+		database.HashBytes([]byte("skylink_dropped")),
+	}
+	dropped := hashes[2]
+
+	// create a server that accepts every hash but drops one
+	var mu sync.Mutex
+	var blocklist []crypto.Hash
+	mux := http.NewServeMux()
+	mux.HandleFunc("/daemon/version", mockVersionResponse)
+	mux.HandleFunc("/skynet/blocklist", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodGet {
+			skyapi.WriteJSON(w, skyapi.SkynetBlocklistGET{Blocklist: blocklist})
+			return
+		}
+		var request skyapi.SkynetBlocklistPOST
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			panic(err)
+		}
+		for _, str := range request.Add {
+			var hash database.Hash
+			err = hash.LoadString(str)
+			if err != nil {
+				panic(err)
+			}
+			if hash != dropped {
+				blocklist = append(blocklist, hash.Hash)
+			}
+		}
+		skyapi.WriteJSON(w, api.BlockResponse{})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// create a blocker that verifies every block
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	db := database.NewTestDB(context.Background(), "VerifyBlocks")
+	blocker, err := New(api.NewSkydClient(server.URL, ""), db, Options{VerifyRate: 1}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// report the hashes
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	for _, hash := range hashes {
+		err = db.CreateBlockedSkylink(ctx, &database.BlockedSkylink{
+			Hash:           hash,
+			TimestampAdded: time.Now().UTC(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// assert the dropped hash is not counted as blocked
+	blocked, invalid, err := blocker.BlockHashes(ctx, hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocked != 2 || invalid != 0 {
+		t.Fatal("unexpected outcome", blocked, invalid)
+	}
+	if status := blocker.SweepStatus(); status.Unverified != 1 {
+		t.Fatal("unexpected number of unverified hashes", status.Unverified)
+	}
+
+	// assert the dropped hash is retried and its history records why
+	toRetry, err := db.HashesToRetry(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toRetry) != 1 || toRetry[0] != dropped {
+		t.Fatal("unexpected hashes to retry", toRetry)
+	}
+	history, err := db.BlockHistory(ctx, dropped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) == 0 || history[len(history)-1].Type != database.BlockEventUnverified || history[len(history)-1].Reason != unverifiedReason {
+		t.Fatal("unexpected history", history)
+	}
+	doc, err := db.FindByHash(ctx, dropped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc == nil || !doc.BlockedAt.IsZero() {
+		t.Fatal("expected the dropped hash to not be marked as blocked", doc)
+	}
+}
+
+// TestRejectionRateExceeded is a unit test for the
+// 'staticRejectionRateExceeded' method.
+func TestRejectionRateExceeded(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		rate     float64
+		sent     int
+		rejected int
+		exceeded bool
+	}{
+		{0, blockBatchSize, blockBatchSize, false},
+		{0.5, blockBatchSize - 1, blockBatchSize - 1, false},
+		{0.5, blockBatchSize, blockBatchSize / 2, false},
+		{0.5, blockBatchSize, blockBatchSize/2 + 1, true},
+		{0.9, 2 * blockBatchSize, 2 * blockBatchSize, true},
+	}
+	for _, test := range tests {
+		bl := &Blocker{staticRejectionRate: test.rate}
+		if bl.staticRejectionRateExceeded(test.sent, test.rejected) != test.exceeded {
+			t.Fatal("unexpected outcome", test)
+		}
+	}
+
+	// assert an invalid rate is rejected
+	for _, rate := range []float64{-0.1, 1} {
+		_, err := New(&api.SkydClient{}, &database.DB{}, Options{MaxRejectionRate: rate}, logrus.New())
+		if err == nil || !strings.Contains(err.Error(), "max rejection rate") {
+			t.Fatal("unexpected outcome", rate, err)
+		}
+	}
+
+	// assert an invalid verify rate is rejected as well
+	for _, rate := range []float64{-0.1, 1.1} {
+		_, err := New(&api.SkydClient{}, &database.DB{}, Options{VerifyRate: rate}, logrus.New())
+		if err == nil || !strings.Contains(err.Error(), "verify rate") {
+			t.Fatal("unexpected outcome", rate, err)
+		}
+	}
+}
+
+// testUnblockBySource verifies revoking a source unblocks the skylinks it
+// reported, except for the ones that were reported by other sources as well.
+func testUnblockBySource(t *testing.T, _ *httptest.Server) {
+	// create a server that records the hashes that get unblocked
+	var mu sync.Mutex
+	var removed []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/daemon/version", mockVersionResponse)
+	mux.HandleFunc("/skynet/blocklist", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var request skyapi.SkynetBlocklistPOST
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			panic(err)
+		}
+		removed = append(removed, request.Remove...)
+		skyapi.WriteJSON(w, api.BlockResponse{})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// create the blocker
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	bl, err := newTestBlocker(ctx, "UnblockBySource", api.NewSkydClient(server.URL, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// report a skylink by the revoked source only, one by both sources and
+	// one by the legitimate source only
+	revoked := database.Reporter{Name: "revoked"}
+	legit := database.Reporter{Name: "legit"}
+	onlyRevoked := database.HashBytes([]byte("skylink_revoked"))
+	both := database.HashBytes([]byte("skylink_both"))
+	onlyLegit := database.HashBytes([]byte("skylink_legit"))
+	reports := []struct {
+		hash     database.Hash
+		reporter database.Reporter
+	}{
+		{onlyRevoked, revoked},
+		{both, legit},
+		{both, revoked},
+		{onlyLegit, legit},
+	}
+	for _, report := range reports {
+		err = bl.staticDB.CreateBlockedSkylink(ctx, &database.BlockedSkylink{
+			Hash:           report.hash,
+			Reporter:       report.reporter,
+			TimestampAdded: time.Now().UTC(),
+		})
+		if err != nil && !errors.Contains(err, database.ErrSkylinkExists) {
+			t.Fatal(err)
+		}
+	}
+	err = bl.staticDB.MarkSucceeded(ctx, []database.Hash{onlyRevoked, both, onlyLegit}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// revoke the source
+	unblocked, err := bl.UnblockBySource(ctx, revoked.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unblocked != 1 {
+		t.Fatal("unexpected number of unblocked skylinks", unblocked)
+	}
+
+	// assert only the skylink reported by the revoked source alone got
+	// unblocked in skyd
+	mu.Lock()
+	if len(removed) != 1 || removed[0] != onlyRevoked.String() {
+		t.Fatal("unexpected hashes unblocked in skyd", removed)
+	}
+	mu.Unlock()
+
+	// assert the database reflects that
+	tests := []struct {
+		hash     database.Hash
+		reverted bool
+		event    string
+	}{
+		{onlyRevoked, true, database.BlockEventUnblocked},
+		{both, false, database.BlockEventSourceRevoked},
+		{onlyLegit, false, database.BlockEventBlocked},
+	}
+	for _, test := range tests {
+		bsl, err := bl.staticDB.FindByHash(ctx, test.hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bsl.Reverted != test.reverted {
+			t.Fatal("unexpected reverted state", test.hash, bsl.Reverted)
+		}
+		if last := bsl.History[len(bsl.History)-1]; last.Type != test.event {
+			t.Fatal("unexpected last event", test.hash, last.Type)
+		}
+	}
+
+	// assert revoking the source again is a no-op
+	unblocked, err = bl.UnblockBySource(ctx, revoked.Name)
+	if err != nil || unblocked != 0 {
+		t.Fatal("unexpected outcome", unblocked, err)
+	}
+}
+
+// testRestoreToSnapshot verifies restoring a snapshot reverses the blocks of
+// the skylinks that were added after it, that the skylinks that were added
+// before it stay blocked and that a dry run leaves everything untouched.
+func testRestoreToSnapshot(t *testing.T, _ *httptest.Server) {
+	// create a server that records the hashes that get unblocked
+	var mu sync.Mutex
+	var removed []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/daemon/version", mockVersionResponse)
+	mux.HandleFunc("/skynet/blocklist", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var request skyapi.SkynetBlocklistPOST
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			panic(err)
+		}
+		removed = append(removed, request.Remove...)
+		skyapi.WriteJSON(w, api.BlockResponse{})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// create the blocker
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	bl, err := newTestBlocker(ctx, "RestoreToSnapshot", api.NewSkydClient(server.URL, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// report is a helper that reports the given hash at the given time
+	report := func(hash database.Hash, added time.Time) {
+		t.Helper()
+		err := bl.staticDB.CreateBlockedSkylink(ctx, &database.BlockedSkylink{
+			Hash:           hash,
+			Reporter:       database.Reporter{Name: "import"},
+			TimestampAdded: added,
+		})
+		if err != nil && !errors.Contains(err, database.ErrSkylinkExists) {
+			t.Fatal(err)
+		}
+	}
+
+	// block a skylink before the snapshot
+	before := database.HashBytes([]byte("skylink_before"))
+	report(before, time.Now().UTC().Add(-time.Hour))
+	err = bl.staticDB.MarkSucceeded(ctx, []database.Hash{before}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// create the snapshot
+	snapshot, err := bl.staticDB.CreateSnapshot(ctx, "before-import", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// import a skylink that gets blocked, one that is still pending and the
+	// skylink that was blocked already
+	blocked := database.HashBytes([]byte("skylink_blocked"))
+	pending := database.HashBytes([]byte("skylink_pending"))
+	added := snapshot.Timestamp.Add(time.Second)
+	for _, hash := range []database.Hash{before, blocked, pending} {
+		report(hash, added)
+	}
+	err = bl.staticDB.MarkSucceeded(ctx, []database.Hash{blocked}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert a dry run previews the restore without reverting anything
+	restore, err := bl.RestoreToSnapshot(ctx, snapshot.Label, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restore.Timestamp.Equal(snapshot.Timestamp) {
+		t.Fatal("unexpected timestamp", restore.Timestamp, snapshot.Timestamp)
+	}
+	expected := api.SnapshotRestore{
+		Label:     snapshot.Label,
+		Timestamp: restore.Timestamp,
+		DryRun:    true,
+		Unblocked: []database.Hash{blocked},
+		Cancelled: []database.Hash{pending},
+	}
+	if !reflect.DeepEqual(restore, expected) {
+		t.Fatal("unexpected dry run", restore)
+	}
+	mu.Lock()
+	if len(removed) != 0 {
+		t.Fatal("unexpected hashes unblocked in skyd", removed)
+	}
+	mu.Unlock()
+	bsl, err := bl.staticDB.FindByHash(ctx, blocked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bsl.Reverted {
+		t.Fatal("a dry run should not revert the skylink")
+	}
+
+	// restore the snapshot
+	restore, err = bl.RestoreToSnapshot(ctx, snapshot.Label, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected.DryRun = false
+	if !reflect.DeepEqual(restore, expected) {
+		t.Fatal("unexpected restore", restore)
+	}
+
+	// assert only the skylink that got blocked after the snapshot got
+	// unblocked in skyd
+	mu.Lock()
+	if len(removed) != 1 || removed[0] != blocked.String() {
+		t.Fatal("unexpected hashes unblocked in skyd", removed)
+	}
+	mu.Unlock()
+
+	// assert the database reflects that
+	tests := []struct {
+		hash     database.Hash
+		reverted bool
+		event    string
+	}{
+		{before, false, database.BlockEventBlocked},
+		{blocked, true, database.BlockEventUnblocked},
+		{pending, true, database.BlockEventCancelled},
+	}
+	for _, test := range tests {
+		bsl, err := bl.staticDB.FindByHash(ctx, test.hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bsl.Reverted != test.reverted {
+			t.Fatal("unexpected reverted state", test.hash, bsl.Reverted)
+		}
+		if last := bsl.History[len(bsl.History)-1]; last.Type != test.event {
+			t.Fatal("unexpected last event", test.hash, last.Type)
+		}
+	}
+
+	// assert restoring the snapshot again is a no-op
+	restore, err = bl.RestoreToSnapshot(ctx, snapshot.Label, false)
+	if err != nil || len(restore.Unblocked) != 0 || len(restore.Cancelled) != 0 {
+		t.Fatal("unexpected outcome", restore, err)
+	}
+
+	// assert an unknown snapshot is rejected
+	_, err = bl.RestoreToSnapshot(ctx, "unknown", true)
+	if !errors.Contains(err, database.ErrNoDocumentsFound) {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+// testSweepLeaseLost verifies the sweep renews the sweep lease with every
+// checkpoint and stops, without checkpointing, when another instance took it
+// over mid-sweep.
+func testSweepLeaseLost(t *testing.T, _ *httptest.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+
+	// create a server that hands the lease to another instance while it
+	// processes the second batch
+	var bl *Blocker
+	var posts int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/skynet/blocklist", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			posts++
+			if posts == 2 {
+				err := bl.staticDB.ReleaseSweepLease(ctx, database.ServerUID)
+				if err != nil {
+					t.Error(err)
+				}
+				_, err = bl.staticDB.AcquireSweepLease(ctx, "other", time.Minute)
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}
+		mockBlocklistResponse(w, r)
+	})
+	mux.HandleFunc("/daemon/version", mockVersionResponse)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// create the blocker and acquire the lease
+	bl, err := newTestBlocker(ctx, "SweepLeaseLost", api.NewSkydClient(server.URL, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bl.staticSweepLease = time.Minute
+	held, err := bl.managedSweepLease()
+	if err != nil || !held {
+		t.Fatal("failed to acquire the lease", held, err)
+	}
+
+	// add three batches worth of skylinks with increasing timestamps
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Millisecond)
+	var skylinks []database.BlockedSkylink
+	for i := 0; i < 3*blockBatchSize; i++ {
+		skylinks = append(skylinks, database.BlockedSkylink{
+			Hash:           database.HashBytes([]byte(fmt.Sprintf("skylink_%d", i))),
+			TimestampAdded: start.Add(time.Duration(i) * time.Second),
+		})
+	}
+	_, err = bl.staticDB.CreateBlockedSkylinkBulk(ctx, skylinks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the sweep stops after the second batch
+	result, err := bl.managedBlock()
+	if !errors.Contains(err, ErrSweepLeaseNotHeld) {
+		t.Fatal("unexpected error", err)
+	}
+	if posts != 2 || result.Blocked != 2*blockBatchSize || result.Drained {
+		t.Fatal("unexpected result", posts, result)
+	}
+	if bl.SweepStatus().LeaseHeld {
+		t.Fatal("expected the lease to be lost")
+	}
+
+	// assert only the first batch got checkpointed
+	latest, err := bl.staticDB.LatestBlockTimestamp(ctx, database.DefaultSkydTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := skylinks[blockBatchSize-1].TimestampAdded
+	if !latest.Equal(expected) {
+		t.Fatalf("unexpected latest block timestamp, %v != %v", latest, expected)
+	}
+}
+
+// testBlockStatus is a unit test that covers the 'BlockStatus' method.
+func testBlockStatus(t *testing.T, server *httptest.Server) {
+	// create a client that connects to our server
+	client := api.NewSkydClient(server.URL, "")
+
+	// create the blocker
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	blocker, err := newTestBlocker(ctx, "BlockStatus", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert an invalid skylink is rejected
+	_, err = blocker.BlockStatus(ctx, "invalid_skylink", true)
+	if err == nil {
+		t.Fatal("expected error for invalid skylink")
+	}
+
+	// assert the status of a skylink that is blocked in skyd but that has no
+	// record in the database
+	status, err := blocker.BlockStatus(ctx, blockedSkylinkStr, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Found || !status.BlockedInSkyd || status.TimestampAdded != nil || status.BlockedAt != nil {
+		t.Fatal("unexpected status", status)
+	}
+
+	// assert skyd is not consulted without the cross-check
+	status, err = blocker.BlockStatus(ctx, blockedSkylinkStr, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Found || status.BlockedInSkyd || status.SkydVersion != "" {
+		t.Fatal("unexpected status", status)
+	}
+
+	// add a record to the database and mark it as failed
+	var sl skymodules.Skylink
+	err = sl.LoadString(blockedSkylinkStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := database.NewHash(sl)
+	err = blocker.staticDB.CreateBlockedSkylink(ctx, &database.BlockedSkylink{
+		Hash:           hash,
+		Failed:         true,
+		TimestampAdded: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the status reflects the record in the database
+	status, err = blocker.BlockStatus(ctx, blockedSkylinkStr, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Found || !status.Failed || status.Invalid || !status.BlockedInSkyd {
+		t.Fatal("unexpected status", status)
+	}
+	if status.Hash != hash.Hash {
+		t.Fatal("unexpected hash", status.Hash)
+	}
+	if status.TimestampAdded == nil || status.BlockedAt != nil {
+		t.Fatal("unexpected timestamps", status.TimestampAdded, status.BlockedAt)
+	}
+
+	// mark it as blocked and assert the time skyd confirmed the block is
+	// returned
+	blockedAt := time.Now().UTC().Truncate(time.Millisecond)
+	err = blocker.staticDB.MarkSucceeded(ctx, []database.Hash{hash}, blockedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err = blocker.BlockStatus(ctx, blockedSkylinkStr, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.BlockedAt == nil || !status.BlockedAt.Equal(blockedAt) {
+		t.Fatal("unexpected blocked at", status.BlockedAt)
+	}
+
+	// assert the record is enough to tell skyd blocked it
+	status, err = blocker.BlockStatus(ctx, blockedSkylinkStr, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Found || !status.BlockedInSkyd {
+		t.Fatal("unexpected status", status)
+	}
+}
+
+// testRunUntilDrained verifies the blocker sweeps until the backlog is
+// drained, that it returns the total counts across all sweeps and that it
+// respects context cancellation.
+func testRunUntilDrained(t *testing.T, server *httptest.Server) {
+	// create the blocker
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	bl, err := newTestBlocker(ctx, "RunUntilDrained", api.NewSkydClient(server.URL, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add a couple of batches worth of skylinks, including an invalid one
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Millisecond)
+	var skylinks []database.BlockedSkylink
+	for i := 0; i < 2*blockBatchSize; i++ {
+		skylinks = append(skylinks, database.BlockedSkylink{
+			Hash:           database.HashBytes([]byte(fmt.Sprintf("skylink_%d", i))),
+			TimestampAdded: start.Add(time.Duration(i) * time.Second),
+		})
+	}
+	skylinks = append(skylinks, database.BlockedSkylink{
+		Hash:           database.HashBytes([]byte("invalid_hash")),
+		TimestampAdded: start.Add(-time.Second),
+	})
+	_, err = bl.staticDB.CreateBlockedSkylinkBulk(ctx, skylinks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert a cancelled context is respected
+	cancelled, cancelFn := context.WithCancel(ctx)
+	cancelFn()
+	_, _, err = bl.RunUntilDrained(cancelled)
+	if !errors.Contains(err, context.Canceled) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// drain the backlog
+	blocked, failed, err := bl.RunUntilDrained(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocked != 2*blockBatchSize || failed != 1 {
+		t.Fatal("unexpected counts", blocked, failed)
+	}
+
+	// assert there is nothing left to block
+	hashes, err := bl.staticDB.HashesToBlock(ctx, start.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 0 {
+		t.Fatal("expected the backlog to be drained", len(hashes))
+	}
+
+	// assert draining an empty backlog returns immediately
+	blocked, failed, err = bl.RunUntilDrained(ctx)
+	if err != nil || blocked != 0 || failed != 0 {
+		t.Fatal("unexpected outcome", blocked, failed, err)
+	}
+}
+
+// testRetryFailedInterrupted verifies the retry stops when its context is
+// cancelled while skyd is processing a batch, the hashes remain failed.
+func testRetryFailedInterrupted(t *testing.T, _ *httptest.Server) {
+	// create a skyd that hangs until the request is aborted
+	mux := http.NewServeMux()
+	mux.HandleFunc("/daemon/version", mockVersionResponse)
+	mux.HandleFunc("/skynet/blocklist", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Minute):
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// create the blocker
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	bl, err := newTestBlocker(ctx, "RetryFailedInterrupted", api.NewSkydClient(server.URL, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add a failed skylink
+	hash := database.HashBytes([]byte("skylink"))
+	err = bl.staticDB.CreateBlockedSkylink(ctx, &database.BlockedSkylink{
+		Hash:           hash,
+		TimestampAdded: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bl.staticDB.MarkFailed(ctx, []database.Hash{hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// cancel the retry while skyd is processing the batch
+	retryCtx, retryCancel := context.WithCancel(ctx)
+	defer retryCancel()
+	time.AfterFunc(100*time.Millisecond, retryCancel)
+	start := time.Now()
+	retried, stillFailed, err := bl.RetryFailed(retryCtx)
+	if err != nil || retried != 1 || stillFailed != 1 {
+		t.Fatal("unexpected outcome", retried, stillFailed, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatal("RetryFailed did not return promptly", elapsed)
+	}
+
+	// assert the hash is still failed
+	toRetry, err := bl.staticDB.HashesToRetry(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toRetry) != 1 || toRetry[0] != hash {
+		t.Fatal("unexpected hashes to retry", toRetry)
+	}
+}
+
+// testSweepCheckpoint verifies the sweep checkpoints its progress after every
+// batch, and that the next sweep resumes where the previous one stopped.
+func testSweepCheckpoint(t *testing.T, _ *httptest.Server) {
+	// create a server that simulates a crash by stopping the blocker while it
+	// processes the second batch, the request gets aborted
+	var bl *Blocker
+	var posts int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/skynet/blocklist", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			posts++
+			if posts == 2 {
+				_, _ = ioutil.ReadAll(r.Body)
+				close(bl.staticStopChan)
+				<-r.Context().Done()
+				return
+			}
+		}
+		mockBlocklistResponse(w, r)
+	})
+	mux.HandleFunc("/daemon/version", mockVersionResponse)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// create the blocker
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	bl, err := newTestBlocker(ctx, "SweepCheckpoint", api.NewSkydClient(server.URL, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add three batches worth of skylinks with increasing timestamps
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Millisecond)
+	var skylinks []database.BlockedSkylink
+	for i := 0; i < 3*blockBatchSize; i++ {
+		skylinks = append(skylinks, database.BlockedSkylink{
+			Hash:           database.HashBytes([]byte(fmt.Sprintf("skylink_%d", i))),
+			TimestampAdded: start.Add(time.Duration(i) * time.Second),
+		})
+	}
+	_, err = bl.staticDB.CreateBlockedSkylinkBulk(ctx, skylinks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// log at debug level
+	var logs bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &logs
+	logger.SetLevel(logrus.DebugLevel)
+	bl.staticLogger = logrus.NewEntry(logger)
+
+	// sweep the database, assert only the first batch got blocked and the
+	// sweep is reported as interrupted
+	result, err := bl.managedBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Hashes != 3*blockBatchSize || result.Blocked != blockBatchSize || result.Failed != 0 || result.Drained {
+		t.Fatal("unexpected result", result)
+	}
+
+	// assert the timestamp got advanced to the last skylink of the first
+	// batch, and not to the time of the sweep
+	latest, err := bl.staticDB.LatestBlockTimestamp(ctx, database.DefaultSkydTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := skylinks[blockBatchSize-1].TimestampAdded
+	if !latest.Equal(expected) {
+		t.Fatalf("unexpected latest block timestamp, %v != %v", latest, expected)
+	}
+
+	// assert the first skylink of the second batch was logged as the record
+	// at which the sweep stopped advancing the timestamp
+	boundary := fmt.Sprintf("stopped advancing the latest block timestamp at hash %v, added at", skylinks[blockBatchSize].Hash)
+	if !strings.Contains(logs.String(), boundary) {
+		t.Fatal("boundary record was not logged", logs.String())
+	}
+
+	// assert the next sweep resumes with the interrupted second batch
+	hashes, err := bl.staticDB.HashesToBlock(ctx, latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 2*blockBatchSize {
+		t.Fatalf("unexpected number of hashes to block, %v != %v", len(hashes), 2*blockBatchSize)
+	}
+	if hashes[0] != skylinks[blockBatchSize].Hash {
+		t.Fatal("unexpected first hash to block", hashes[0])
+	}
+}
+
+// testSweepOrder verifies the sweep blocks the skylinks in a deterministic
+// order, by the time they were added and then by their id, regardless of the
+// order in which they were inserted.
+func testSweepOrder(t *testing.T, _ *httptest.Server) {
+	// create a server that records the hashes in the order they got blocked
+	var mu sync.Mutex
+	var sequence []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/skynet/blocklist", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var request skyapi.SkynetBlocklistPOST
+			err := json.NewDecoder(r.Body).Decode(&request)
+			if err != nil {
+				panic(err)
+			}
+			mu.Lock()
+			sequence = append(sequence, request.Add...)
+			mu.Unlock()
+			skyapi.WriteJSON(w, api.BlockResponse{})
+			return
+		}
+		mockBlocklistResponse(w, r)
+	})
+	mux.HandleFunc("/daemon/version", mockVersionResponse)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// create more than two batches worth of skylinks that were all added at
+	// the same time, with increasing ids
+	added := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	skylinks := make([]database.BlockedSkylink, 2*blockBatchSize+3)
+	expected := make([]string, len(skylinks))
+	for i := range skylinks {
+		skylinks[i] = database.BlockedSkylink{
+			ID:             primitive.NewObjectID(),
+			Hash:           database.HashBytes([]byte(fmt.Sprintf("skylink_%d", i))),
+			TimestampAdded: added,
+		}
+		expected[i] = skylinks[i].Hash.String()
+	}
+
+	// sweep two databases into which the skylinks were inserted in a
+	// different order, and return the order in which they got blocked
+	sweep := func(dbName string, perm []int) []string {
+		ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+		defer cancel()
+		bl, err := newTestBlocker(ctx, dbName, api.NewSkydClient(server.URL, ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		shuffled := make([]database.BlockedSkylink, len(perm))
+		for i, j := range perm {
+			shuffled[i] = skylinks[j]
+		}
+		_, err = bl.staticDB.CreateBlockedSkylinkBulk(ctx, shuffled)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mu.Lock()
+		sequence = nil
+		mu.Unlock()
+		result, err := bl.managedBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Blocked != len(skylinks) || !result.Drained {
+			t.Fatal("unexpected result", result)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), sequence...)
+	}
+	first := sweep("SweepOrder1", fastrand.Perm(len(skylinks)))
+	second := sweep("SweepOrder2", fastrand.Perm(len(skylinks)))
+
+	// assert both sweeps blocked the skylinks in the order of their ids
+	for _, seq := range [][]string{first, second} {
+		if len(seq) != len(expected) {
+			t.Fatalf("unexpected number of blocked hashes, %v != %v", len(seq), len(expected))
+		}
+		for i := range seq {
+			if seq[i] != expected[i] {
+				t.Fatalf("unexpected hash at position %d, %v != %v", i, seq[i], expected[i])
+			}
+		}
+	}
+}
+
+// testFutureLatestBlockTimestamp verifies a latest block timestamp that is too
+// far in the future gets clamped, and that the skylinks that were added in the
+// meantime get blocked.
+func testFutureLatestBlockTimestamp(t *testing.T, server *httptest.Server) {
+	// create the blocker
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	bl, err := newTestBlocker(ctx, "FutureLatestBlockTimestamp", api.NewSkydClient(server.URL, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add a skylink that got blocked and one that got added after
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	blocked := database.BlockedSkylink{
+		Hash:           database.HashBytes([]byte("skylink_blocked")),
+		TimestampAdded: now.Add(-2 * time.Hour),
+	}
+	pending := database.BlockedSkylink{
+		Hash:           database.HashBytes([]byte("skylink_pending")),
+		TimestampAdded: now.Add(-time.Hour),
+	}
+	_, err = bl.staticDB.CreateBlockedSkylinkBulk(ctx, []database.BlockedSkylink{blocked, pending})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bl.staticDB.MarkSucceeded(ctx, []database.Hash{blocked.Hash}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// corrupt the latest block timestamp
+	err = bl.staticDB.SetLatestBlockTimestamp(ctx, database.DefaultSkydTarget, now.AddDate(1, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bl.InvalidateLatestBlockTimestamp()
+
+	// assert the sweep picks up the pending skylink
+	result, err := bl.managedBlockSweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Hashes != 1 || result.Blocked != 1 || !result.Drained {
+		t.Fatal("unexpected result", result)
+	}
+
+	// assert the timestamp is no longer in the future
+	latest, err := bl.staticDB.LatestBlockTimestamp(ctx, database.DefaultSkydTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.After(time.Now().UTC()) {
+		t.Fatal("unexpected latest block timestamp", latest)
+	}
+}
+
+// testLatestBlockTimestampCache verifies the latest block timestamp is cached
+// after it's written, and that it's read from the database again after the
+// cache got invalidated.
+func testLatestBlockTimestampCache(t *testing.T, server *httptest.Server) {
+	// create the blocker
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	bl, err := newTestBlocker(ctx, "LatestBlockTimestampCache", api.NewSkydClient(server.URL, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the timestamp is read from the database initially
+	latest, err := bl.managedLatestBlockTimestamp(ctx)
+	if err != nil || !latest.IsZero() {
+		t.Fatal("unexpected outcome", latest, err)
+	}
+
+	// set the timestamp and assert it's persisted and cached
+	now := time.Now().UTC()
+	err = bl.managedSetLatestBlockTimestamp(ctx, latest, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	persisted, err := bl.staticDB.LatestBlockTimestamp(ctx, database.DefaultSkydTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err = bl.managedLatestBlockTimestamp(ctx)
+	if err != nil || !latest.Equal(persisted) {
+		t.Fatal("unexpected outcome", latest, persisted, err)
+	}
+
+	// rewind the timestamp behind the blocker's back, assert the cached
+	// timestamp is returned until the cache is invalidated
+	rewound := now.Add(-time.Hour).Truncate(time.Millisecond)
+	err = bl.staticDB.SetLatestBlockTimestamp(ctx, database.DefaultSkydTarget, rewound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err = bl.managedLatestBlockTimestamp(ctx)
+	if err != nil || !latest.Equal(persisted) {
+		t.Fatal("unexpected outcome", latest, err)
+	}
+	// assert advancing the timestamp from the cached one does not overwrite
+	// the rewind, and that it invalidates the cache
+	err = bl.managedSetLatestBlockTimestamp(ctx, persisted, now.Add(time.Hour))
+	if !errors.Contains(err, errLatestBlockTimestampChanged) {
+		t.Fatal("unexpected error", err)
+	}
+	latest, err = bl.managedLatestBlockTimestamp(ctx)
+	if err != nil || !latest.Equal(rewound) {
+		t.Fatal("unexpected outcome", latest, err)
+	}
+
+	// assert it's advanced from the rewound timestamp
+	err = bl.managedSetLatestBlockTimestamp(ctx, rewound, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bl.InvalidateLatestBlockTimestamp()
+	latest, err = bl.managedLatestBlockTimestamp(ctx)
+	if err != nil || !latest.Equal(persisted) {
+		t.Fatal("unexpected outcome", latest, err)
+	}
+}
+
+// testPrePolicy verifies the sweeps consult the pre-block policy, skylinks it
+// denies are skipped and skylinks it fails to evaluate are retried.
+func testPrePolicy(t *testing.T, server *httptest.Server) {
+	// create the blocker
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	bl, err := newTestBlocker(ctx, "PrePolicy", api.NewSkydClient(server.URL, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add a skylink for every outcome of the policy
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Millisecond)
+	allowed := database.HashBytes([]byte("allowed"))
+	denied := database.HashBytes([]byte("denied"))
+	erred := database.HashBytes([]byte("erred"))
+	var skylinks []database.BlockedSkylink
+	for i, hash := range []database.Hash{allowed, denied, erred} {
+		skylinks = append(skylinks, database.BlockedSkylink{
+			Hash:           hash,
+			Reporter:       database.Reporter{Name: "reporter"},
+			TimestampAdded: start.Add(time.Duration(i) * time.Second),
+		})
+	}
+	_, err = bl.staticDB.CreateBlockedSkylinkBulk(ctx, skylinks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// set a policy that denies one skylink and fails to evaluate another
+	var evaluated int
+	bl.staticPrePolicy = func(_ context.Context, sl database.BlockedSkylink) (bool, string, error) {
+		evaluated++
+		if sl.Reporter.Name != "reporter" {
+			return false, "", errors.New("unexpected reporter")
+		}
+		switch sl.Hash {
+		case denied:
+			return false, "outside business hours", nil
+		case erred:
+			return false, "", errors.New("rate limiter unavailable")
+		}
+		return true, "", nil
+	}
+
+	// sweep the database
+	result, err := bl.managedBlockSweep(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evaluated != 3 {
+		t.Fatal("unexpected number of evaluated skylinks", evaluated)
+	}
+	expected := SweepResult{
+		Hashes:    3,
+		Blocked:   1,
+		Failed:    1,
+		Skipped:   1,
+		Duration:  result.Duration,
+		Drained:   true,
+		SkydCalls: SkydCalls{Calls: 1, BatchSizes: map[int]int{1: 1}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatal("unexpected result", result)
+	}
+
+	// assert the allowed skylink got blocked
+	doc, err := bl.staticDB.FindByHash(ctx, allowed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.BlockedAt.IsZero() || doc.Skipped || doc.Failed {
+		t.Fatal("unexpected document", doc)
+	}
+
+	// assert the denied skylink got skipped and the reason got recorded
+	doc, err = bl.staticDB.FindByHash(ctx, denied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !doc.BlockedAt.IsZero() || !doc.Skipped || doc.SkippedReason != "outside business hours" {
+		t.Fatal("unexpected document", doc)
+	}
+	if len(doc.History) != 1 || doc.History[0].Type != database.BlockEventSkipped || doc.History[0].Reason != doc.SkippedReason {
+		t.Fatal("unexpected history", doc.History)
+	}
+
+	// assert the skylink the policy failed to evaluate is retried
+	doc, err = bl.staticDB.FindByHash(ctx, erred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !doc.BlockedAt.IsZero() || doc.Skipped || !doc.Failed {
+		t.Fatal("unexpected document", doc)
+	}
+	retry, err := bl.staticDB.HashesToRetry(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(retry) != 1 || retry[0] != erred {
+		t.Fatal("unexpected hashes to retry", retry)
+	}
+
+	// allow all skylinks and assert the retry consults the policy again, the
+	// skipped skylink is not picked up
+	evaluated = 0
+	bl.staticPrePolicy = func(context.Context, database.BlockedSkylink) (bool, string, error) {
+		evaluated++
+		return true, "", nil
+	}
+	retried, stillFailed, err := bl.RetryFailed(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried != 1 || stillFailed != 0 || evaluated != 1 {
+		t.Fatal("unexpected outcome", retried, stillFailed, evaluated)
+	}
+	result, err = bl.managedBlockSweep(ctx)
+	if err != nil || result.Hashes != 0 || !result.Drained {
+		t.Fatal("unexpected outcome", result, err)
+	}
+}
+
+// testRetryFailed verifies failed hashes can be retried on demand, hashes that
+// fail again remain failed.
+func testRetryFailed(t *testing.T, _ *httptest.Server) {
+	// create a server that fails to block until told otherwise
+	var mu sync.Mutex
+	failing := true
+	mux := http.NewServeMux()
+	mux.HandleFunc("/skynet/blocklist", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fail := failing
+		mu.Unlock()
+		if fail && r.Method == http.MethodPost {
+			skyapi.WriteError(w, skyapi.Error{Message: "misconfigured"}, http.StatusInternalServerError)
+			return
+		}
+		mockBlocklistResponse(w, r)
+	})
+	mux.HandleFunc("/daemon/version", mockVersionResponse)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// create the blocker
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	bl, err := newTestBlocker(ctx, "RetryFailed", api.NewSkydClient(server.URL, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add a couple of failed skylinks and an invalid one
+	var hashes []database.Hash
+	for i := 0; i < 3; i++ {
+		hashes = append(hashes, database.HashBytes([]byte(fmt.Sprintf("skylink_%d", i))))
+	}
+	hashes = append(hashes, database.HashBytes([]byte("invalid_hash")))
+	for _, hash := range hashes {
+		err = bl.staticDB.CreateBlockedSkylink(ctx, &database.BlockedSkylink{
+			Hash:           hash,
+			TimestampAdded: time.Now().UTC(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = bl.staticDB.MarkFailed(ctx, hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the hashes remain failed if skyd still fails
+	retried, stillFailed, err := bl.RetryFailed(ctx)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if retried != 4 || stillFailed != 4 {
+		t.Fatal("unexpected counts", retried, stillFailed)
+	}
+	toRetry, err := bl.staticDB.HashesToRetry(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toRetry) != 4 {
+		t.Fatal("unexpected number of hashes to retry", len(toRetry))
+	}
+
+	// fix skyd and assert the hashes get blocked
+	mu.Lock()
+	failing = false
+	mu.Unlock()
+	retried, stillFailed, err = bl.RetryFailed(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried != 4 || stillFailed != 0 {
+		t.Fatal("unexpected counts", retried, stillFailed)
+	}
+	toRetry, err = bl.staticDB.HashesToRetry(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toRetry) != 0 {
+		t.Fatal("unexpected number of hashes to retry", len(toRetry))
+	}
+	doc, err := bl.staticDB.FindByHash(ctx, hashes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Failed || doc.BlockedAt.IsZero() {
+		t.Fatal("expected hash to be blocked", doc)
+	}
+}
+
+// testWarmStart verifies the warm start blocks the most recently added
+// skylinks first, newest first, without touching the latest block timestamp,
+// and that the sweep that follows blocks the remaining skylinks.
+func testWarmStart(t *testing.T, _ *httptest.Server) {
+	// create a server that records the hashes in the order they got blocked
+	var mu sync.Mutex
+	var sequence []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/skynet/blocklist", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var request skyapi.SkynetBlocklistPOST
+			err := json.NewDecoder(r.Body).Decode(&request)
+			if err != nil {
+				panic(err)
+			}
+			mu.Lock()
+			sequence = append(sequence, request.Add...)
+			mu.Unlock()
+			skyapi.WriteJSON(w, api.BlockResponse{})
+			return
+		}
+		mockBlocklistResponse(w, r)
+	})
+	mux.HandleFunc("/daemon/version", mockVersionResponse)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// create a blocker that warm starts with the two most recent skylinks
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	db := database.NewTestDB(ctx, "WarmStart")
+	bl, err := New(api.NewSkydClient(server.URL, ""), db, Options{WarmStart: 2}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add skylinks that were added a minute apart
+	added := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	var hashes []string
+	for i := 0; i < 5; i++ {
+		hash := database.HashBytes([]byte(fmt.Sprintf("skylink_%d", i)))
+		err = db.CreateBlockedSkylink(ctx, &database.BlockedSkylink{
+			Hash:           hash,
+			TimestampAdded: added.Add(time.Duration(i) * time.Minute),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash.String())
+	}
+
+	// assert the warm start blocks the most recent skylinks, newest first,
+	// and leaves the latest block timestamp untouched
+	err = bl.managedWarmStart(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	warm := append([]string(nil), sequence...)
+	mu.Unlock()
+	if !reflect.DeepEqual(warm, []string{hashes[4], hashes[3]}) {
+		t.Fatal("unexpected warm start", warm)
+	}
+	latest, err := db.LatestBlockTimestamp(ctx, database.DefaultSkydTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !latest.IsZero() {
+		t.Fatal("unexpected latest block timestamp", latest)
+	}
+
+	// assert the sweep blocks the remaining skylinks in order
+	result, err := bl.managedBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Blocked != 3 || !result.Drained {
+		t.Fatal("unexpected result", result)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(sequence[2:], hashes[:3]) {
+		t.Fatal("unexpected sweep", sequence[2:])
+	}
+}
+
+// newTestBlocker returns a new blocker instance
+func newTestBlocker(ctx context.Context, dbName string, skydClient *api.SkydClient) (*Blocker, error) {
+	// create database
+	db := database.NewTestDB(context.Background(), dbName)
+
+	// create a nil logger
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	// create the blocker
+	blocker, err := New(skydClient, db, Options{}, logger)
+	if err != nil {
+		return nil, err
+	}
+	return blocker, nil
+}
+
+// TestSetSweepInterval verifies the sweep interval can be adjusted at runtime,
+// that it's reflected in the sweep status and that it's bounds-checked.
+func TestSetSweepInterval(t *testing.T) {
+	t.Parallel()
+
+	// create a blocker with a discard logger
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	bl := &Blocker{
+		sweepInterval:       blockInterval,
+		staticLogger:        logrus.NewEntry(logger),
+		staticSweepInterval: blockInterval,
+		staticSweepLease:    2 * time.Minute,
+	}
+
+	// assert the interval can be set
+	err := bl.SetSweepInterval(10 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bl.managedSweepInterval() != 10*time.Second || bl.SweepStatus().SweepInterval != 10*time.Second {
+		t.Fatal("unexpected sweep interval", bl.managedSweepInterval())
+	}
+
+	// assert intervals out of bounds are rejected
+	for _, interval := range []time.Duration{-time.Second, minSweepInterval / 2, maxSweepInterval + time.Second, 2 * time.Minute} {
+		err = bl.SetSweepInterval(interval)
+		if err == nil {
+			t.Fatal("expected error", interval)
+		}
+	}
+	if bl.managedSweepInterval() != 10*time.Second {
+		t.Fatal("expected the sweep interval to remain", bl.managedSweepInterval())
+	}
+
+	// assert a zero interval resets it
+	err = bl.SetSweepInterval(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bl.managedSweepInterval() != blockInterval {
+		t.Fatal("unexpected sweep interval", bl.managedSweepInterval())
+	}
+}
+
+// TestSweepIntervalOption verifies the sweep interval can be configured, that
+// resetting it at runtime restores the configured interval and that invalid
+// intervals are rejected.
+func TestSweepIntervalOption(t *testing.T) {
+	t.Parallel()
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	// assert it defaults to the block interval
+	bl, err := New(&api.SkydClient{}, &database.DB{}, Options{}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bl.managedSweepInterval() != blockInterval {
+		t.Fatal("unexpected sweep interval", bl.managedSweepInterval())
+	}
+
+	// assert it can be configured and is restored when reset
+	bl, err = New(&api.SkydClient{}, &database.DB{}, Options{SweepInterval: 3 * blockInterval}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bl.SetSweepInterval(2 * blockInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bl.SetSweepInterval(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bl.managedSweepInterval() != 3*blockInterval {
+		t.Fatal("unexpected sweep interval", bl.managedSweepInterval())
+	}
+
+	// assert invalid intervals are rejected
+	tests := []struct {
+		opts Options
+		err  string
+	}{
+		{Options{SweepInterval: -time.Second}, "can not be negative"},
+		{Options{SweepInterval: minSweepInterval / 2}, "must be between"},
+		{Options{SweepInterval: maxSweepInterval + time.Second}, "must be between"},
+		{Options{SweepInterval: time.Minute, SweepLeaseTTL: time.Minute}, "must exceed the sweep interval"},
+	}
+	for _, test := range tests {
+		_, err = New(&api.SkydClient{}, &database.DB{}, test.opts, logger)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatal("unexpected outcome", test.opts, err)
+		}
+	}
+}
+
+// TestResolveSkylinks verifies skylinks are resolved in a batch, that the
+// skylinks the batch did not resolve are resolved one at a time and that the
+// blocker falls back to resolving every skylink one at a time if skyd does not
+// support batches.
+func TestResolveSkylinks(t *testing.T) {
+	t.Parallel()
+
+	// create three V2 skylinks, the batch only resolves the first one and
+	// the last one can't be resolved at all
+	_, pk := crypto.GenerateKeyPair()
+	spk := types.Ed25519PublicKey(pk)
+	batched := skymodules.NewSkylinkV2(spk, crypto.HashBytes([]byte("batched")))
+	single := skymodules.NewSkylinkV2(spk, crypto.HashBytes([]byte("single")))
+	unresolvable := skymodules.NewSkylinkV2(spk, crypto.HashBytes([]byte("unresolvable")))
+	var v1 skymodules.Skylink
+	err := v1.LoadString(blockedSkylinkStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		batchSupported  bool
+		expectedBatches int
+		expectedSingles int
+	}{
+		{name: "Batch", batchSupported: true, expectedBatches: 1, expectedSingles: 2},
+		{name: "Fallback", batchSupported: false, expectedBatches: 1, expectedSingles: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// create a mock skyd that counts the requests
+			var mu sync.Mutex
+			var batches, singles int
+			mux := http.NewServeMux()
+			mux.HandleFunc("/skynet/resolve", func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				batches++
+				mu.Unlock()
+				if !test.batchSupported {
+					skyapi.WriteError(w, skyapi.Error{Message: "404 page not found"}, http.StatusNotFound)
+					return
+				}
+				skyapi.WriteJSON(w, map[string]map[string]string{
+					"skylinks": {batched.String(): v1.String()},
+				})
+			})
+			mux.HandleFunc("/skynet/resolve/", func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				singles++
+				mu.Unlock()
+				if strings.HasSuffix(r.URL.Path, unresolvable.String()) {
+					skyapi.WriteError(w, skyapi.Error{Message: "registry entry not found"}, http.StatusNotFound)
+					return
+				}
+				skyapi.WriteJSON(w, map[string]string{"skylink": v1.String()})
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			logger := logrus.New()
+			logger.Out = ioutil.Discard
+			bl := &Blocker{
+				staticLogger:         logrus.NewEntry(logger),
+				staticResolveTimeout: time.Minute,
+				staticSkydClient:     api.NewSkydClient(server.URL, ""),
+				staticStopChan:       make(chan struct{}),
+			}
+
+			// assert the results are in order and the unresolvable skylink
+			// failed
+			results := bl.ResolveSkylinks(context.Background(), []skymodules.Skylink{batched, single, unresolvable})
+			if len(results) != 3 {
+				t.Fatal("unexpected number of results", len(results))
+			}
+			for i, res := range results[:2] {
+				if res.Err != nil || res.Resolved != v1 {
+					t.Fatal("unexpected result", i, res)
+				}
+			}
+			if results[2].Err == nil {
+				t.Fatal("expected the unresolvable skylink to fail")
+			}
+
+			// assert the number of requests
+			mu.Lock()
+			defer mu.Unlock()
+			if batches != test.expectedBatches || singles != test.expectedSingles {
+				t.Fatal("unexpected number of requests", batches, singles)
+			}
+		})
+	}
+}
+
+// TestSetSuspended verifies the sweeps can be suspended and resumed at
+// runtime, that it's reflected in the sweep status and that resuming the
+// sweeps wakes up the block loop exactly once.
+func TestSetSuspended(t *testing.T) {
+	t.Parallel()
+
+	// create a blocker with a discard logger
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	bl := &Blocker{
+		staticLogger:     logrus.NewEntry(logger),
+		staticResumeChan: make(chan struct{}, 1),
+	}
+
+	// assert the sweeps can be suspended without waking up the block loop
+	bl.SetSuspended(true)
+	if !bl.managedSuspended() || !bl.SweepStatus().Suspended {
+		t.Fatal("expected the sweeps to be suspended")
+	}
+	if len(bl.staticResumeChan) != 0 {
+		t.Fatal("unexpected wake up")
+	}
+
+	// assert toggling resumes the sweeps and wakes up the block loop
+	if bl.ToggleSuspended() {
+		t.Fatal("expected the sweeps to be resumed")
+	}
+	if bl.managedSuspended() || bl.SweepStatus().Suspended {
+		t.Fatal("expected the sweeps to be resumed")
+	}
+	if len(bl.staticResumeChan) != 1 {
+		t.Fatal("expected a wake up")
+	}
+
+	// assert resuming again, or suspending and resuming before the block
+	// loop woke up, does not block nor queue another wake up
+	bl.SetSuspended(false)
+	if !bl.ToggleSuspended() {
+		t.Fatal("expected the sweeps to be suspended")
+	}
+	bl.SetSuspended(false)
+	if len(bl.staticResumeChan) != 1 {
+		t.Fatal("expected a single wake up", len(bl.staticResumeChan))
+	}
+}
+
+// TestSkydCalls verifies the calls to skyd are counted per batch size, that a
+// nil counter is ignored and that the calls per blocked hash are computed.
+func TestSkydCalls(t *testing.T) {
+	t.Parallel()
+
+	// assert a nil counter does not panic
+	var nilCalls *SkydCalls
+	nilCalls.record(1)
+
+	var calls SkydCalls
+	for _, size := range []int{100, 100, 10, 1} {
+		calls.record(size)
+	}
+	if calls.Calls != 4 || !reflect.DeepEqual(calls.BatchSizes, map[int]int{100: 2, 10: 1, 1: 1}) {
+		t.Fatal("unexpected calls", calls)
+	}
+
+	tests := []struct {
+		blocked  int
+		expected float64
+	}{
+		{0, 0},
+		{1, 4},
+		{8, 0.5},
+	}
+	for _, test := range tests {
+		if perBlocked := calls.PerBlocked(test.blocked); perBlocked != test.expected {
+			t.Fatal("unexpected calls per blocked hash", test.blocked, perBlocked)
+		}
 	}
-	return blocker, nil
 }
@@ -0,0 +1,136 @@
+package blocker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/SkynetLabs/blocker/events"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+const (
+	// defaultBlockLogMaxSize is the size at which the block log is rotated,
+	// unless configured otherwise.
+	defaultBlockLogMaxSize = 100 << 20 // 100 MiB
+
+	// blockLogRotationFormat is the format of the timestamp that is appended
+	// to the path of a rotated block log.
+	blockLogRotationFormat = "20060102T150405.000000000Z"
+)
+
+// blockLog is an append-only file that holds a JSON line for every hash that
+// got blocked, it serves as a record for auditing that does not depend on the
+// database. Once the file would exceed its max size, it's renamed to its path
+// followed by the time of the rotation and a new file is started. Rotated
+// files are never removed.
+type blockLog struct {
+	file *os.File
+	size int64
+
+	staticMaxSize int64
+	staticMu      sync.Mutex
+	staticPath    string
+}
+
+// newBlockLog opens the block log at the given path, creating it if it does
+// not exist yet.
+func newBlockLog(path string, maxSize int64) (*blockLog, error) {
+	if maxSize <= 0 {
+		return nil, errors.New("max size has to be positive")
+	}
+	lg := &blockLog{
+		staticMaxSize: maxSize,
+		staticPath:    path,
+	}
+	err := lg.open()
+	if err != nil {
+		return nil, err
+	}
+	return lg, nil
+}
+
+// managedAppend appends a line for every given event to the block log. The
+// lines of a single call are written at once and are never split across a
+// rotation.
+func (lg *blockLog) managedAppend(entries []events.BlockEvent) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, entry := range entries {
+		err := enc.Encode(entry)
+		if err != nil {
+			return errors.AddContext(err, "failed to encode block log entry")
+		}
+	}
+
+	lg.staticMu.Lock()
+	defer lg.staticMu.Unlock()
+
+	// reopen the file if a previous rotation failed to do so
+	if lg.file == nil {
+		err := lg.open()
+		if err != nil {
+			return err
+		}
+	}
+
+	// rotate the file if the entries don't fit
+	if lg.size > 0 && lg.size+int64(buf.Len()) > lg.staticMaxSize {
+		err := lg.rotate()
+		if err != nil {
+			return errors.AddContext(err, "failed to rotate block log")
+		}
+	}
+
+	n, err := lg.file.Write(buf.Bytes())
+	lg.size += int64(n)
+	if err != nil {
+		return errors.AddContext(err, "failed to write to block log")
+	}
+	return nil
+}
+
+// managedClose closes the block log.
+func (lg *blockLog) managedClose() error {
+	lg.staticMu.Lock()
+	defer lg.staticMu.Unlock()
+	if lg.file == nil {
+		return nil
+	}
+	err := lg.file.Close()
+	lg.file = nil
+	return err
+}
+
+// open opens the file at the block log's path for appending.
+func (lg *blockLog) open() error {
+	file, err := os.OpenFile(lg.staticPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.AddContext(err, "failed to open block log")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return errors.Compose(errors.AddContext(err, "failed to stat block log"), file.Close())
+	}
+	lg.file = file
+	lg.size = info.Size()
+	return nil
+}
+
+// rotate renames the current file and opens a new one in its place.
+func (lg *blockLog) rotate() error {
+	err := lg.file.Close()
+	lg.file = nil
+	if err != nil {
+		return err
+	}
+	rotated := fmt.Sprintf("%s.%s", lg.staticPath, time.Now().UTC().Format(blockLogRotationFormat))
+	err = os.Rename(lg.staticPath, rotated)
+	if err != nil {
+		return err
+	}
+	return lg.open()
+}
@@ -0,0 +1,111 @@
+package blocker
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SkynetLabs/blocker/database"
+	"github.com/SkynetLabs/blocker/events"
+)
+
+// TestBlockLog verifies the block log appends a JSON line for every event,
+// that it picks up where it left off after being reopened and that it's
+// rotated once it would exceed its max size.
+func TestBlockLog(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "blocked.log")
+
+	// readEvents is a helper that reads the events from the given file
+	readEvents := func(path string) []events.BlockEvent {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		var entries []events.BlockEvent
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var entry events.BlockEvent
+			err = json.Unmarshal(scanner.Bytes(), &entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries = append(entries, entry)
+		}
+		if err := scanner.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return entries
+	}
+
+	// assert the max size has to be positive
+	_, err := newBlockLog(path, 0)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	// create an event and determine the size of its line
+	event := events.BlockEvent{
+		Hash:      database.HashBytes([]byte("skylink")),
+		Source:    "reporter",
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lineSize := int64(len(line) + 1)
+
+	// append two events to a log that fits three
+	lg, err := newBlockLog(path, 3*lineSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lg.managedAppend([]events.BlockEvent{event, event})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lg.managedClose(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopen the log and append another event, assert it's appended
+	lg, err = newBlockLog(path, 3*lineSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lg.managedClose()
+	err = lg.managedAppend([]events.BlockEvent{event})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := readEvents(path)
+	if len(entries) != 3 || entries[2].Hash != event.Hash || entries[2].Source != event.Source || !entries[2].Timestamp.Equal(event.Timestamp) {
+		t.Fatal("unexpected entries", entries)
+	}
+
+	// append another event, assert the log got rotated
+	err = lg.managedAppend([]events.BlockEvent{event})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := readEvents(path); len(entries) != 1 {
+		t.Fatal("unexpected number of entries", len(entries))
+	}
+	rotated, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 1 {
+		t.Fatal("unexpected rotated files", rotated)
+	}
+	if entries := readEvents(rotated[0]); len(entries) != 3 {
+		t.Fatal("unexpected number of rotated entries", len(entries))
+	}
+}
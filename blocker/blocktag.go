@@ -0,0 +1,98 @@
+package blocker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/SkynetLabs/blocker/api"
+	"github.com/SkynetLabs/blocker/database"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// BlockTagSource makes the blocker tag the hashes it blocks in skyd with
+	// the name of the source that reported them.
+	BlockTagSource = "source"
+
+	// BlockTagLegalBasis makes the blocker tag the hashes it blocks in skyd
+	// with the legal basis of their block.
+	BlockTagLegalBasis = "legalbasis"
+)
+
+// tagGroup is a group of hashes that are blocked with the same tag.
+type tagGroup struct {
+	tag    string
+	hashes []database.Hash
+}
+
+// validateBlockTag returns an error if the given block tag is unknown, an empty
+// block tag disables tagging.
+func validateBlockTag(blockTag string) error {
+	switch blockTag {
+	case "", BlockTagSource, BlockTagLegalBasis:
+		return nil
+	}
+	return fmt.Errorf("unknown block tag '%v', expected '%v' or '%v'", blockTag, BlockTagSource, BlockTagLegalBasis)
+}
+
+// staticBlockBatch sends the given batch of hashes to skyd. If tagging is
+// enabled, the batch is split into groups of hashes that share a tag and every
+// group is sent with its tag, so skyd records the right tag with every hash.
+// Failing to fetch the tags is logged and the batch is sent untagged, tags are
+// informational. If a group fails, the error is returned for the whole batch,
+// the groups that were sent already are blocked again on retry. Every call to
+// skyd is recorded in the given calls, if any.
+func (bl *Blocker) staticBlockBatch(ctx context.Context, logger *logrus.Entry, batch []database.Hash, calls *SkydCalls) (api.BlockResult, error) {
+	if bl.staticBlockTag == "" {
+		calls.record(len(batch))
+		return bl.staticSkydClient.BlockHashesDetailed(ctx, batch)
+	}
+
+	tags, err := bl.staticBlockTags(ctx, batch)
+	if err != nil {
+		logger.Warnf("failed to fetch the %v of %d hashes, blocking them untagged: %v", bl.staticBlockTag, len(batch), err)
+	}
+	var res api.BlockResult
+	for _, group := range groupByTag(batch, tags) {
+		calls.record(len(group.hashes))
+		more, err := bl.staticSkydClient.BlockHashesTagged(ctx, group.hashes, group.tag)
+		if err != nil {
+			return api.BlockResult{}, err
+		}
+		res.Merge(more)
+	}
+	return res, nil
+}
+
+// staticBlockTags returns the tag of every given hash, depending on the
+// configured block tag. Hashes without a tag are omitted.
+func (bl *Blocker) staticBlockTags(ctx context.Context, hashes []database.Hash) (map[database.Hash]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, database.MongoDefaultTimeout)
+	defer cancel()
+	switch bl.staticBlockTag {
+	case BlockTagSource:
+		return bl.staticDB.Sources(ctx, hashes)
+	case BlockTagLegalBasis:
+		return bl.staticDB.LegalBases(ctx, hashes)
+	}
+	return nil, nil
+}
+
+// groupByTag groups the given hashes by their tag. The groups are ordered by
+// the first hash of every group and the hashes keep their order within a
+// group. Hashes without a tag form a group with an empty tag.
+func groupByTag(hashes []database.Hash, tags map[database.Hash]string) []tagGroup {
+	var groups []tagGroup
+	index := make(map[string]int)
+	for _, hash := range hashes {
+		tag := tags[hash]
+		i, exists := index[tag]
+		if !exists {
+			i = len(groups)
+			index[tag] = i
+			groups = append(groups, tagGroup{tag: tag})
+		}
+		groups[i].hashes = append(groups[i].hashes, hash)
+	}
+	return groups
+}
@@ -0,0 +1,113 @@
+package blocker
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SkynetLabs/blocker/api"
+	"github.com/SkynetLabs/blocker/database"
+)
+
+// TestGroupByTag verifies hashes are grouped by their tag, in the order they
+// first appear, and that hashes without a tag form their own group.
+func TestGroupByTag(t *testing.T) {
+	t.Parallel()
+
+	h1 := database.HashBytes([]byte("h1"))
+	h2 := database.HashBytes([]byte("h2"))
+	h3 := database.HashBytes([]byte("h3"))
+	h4 := database.HashBytes([]byte("h4"))
+
+	tests := []struct {
+		name     string
+		hashes   []database.Hash
+		tags     map[database.Hash]string
+		expected []tagGroup
+	}{
+		{
+			name:     "NoHashes",
+			expected: nil,
+		},
+		{
+			name:     "NoTags",
+			hashes:   []database.Hash{h1, h2},
+			expected: []tagGroup{{tag: "", hashes: []database.Hash{h1, h2}}},
+		},
+		{
+			name:   "Mixed",
+			hashes: []database.Hash{h1, h2, h3, h4},
+			tags:   map[database.Hash]string{h1: "b", h2: "a", h3: "b"},
+			expected: []tagGroup{
+				{tag: "b", hashes: []database.Hash{h1, h3}},
+				{tag: "a", hashes: []database.Hash{h2}},
+				{tag: "", hashes: []database.Hash{h4}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			groups := groupByTag(test.hashes, test.tags)
+			if !reflect.DeepEqual(groups, test.expected) {
+				t.Fatalf("unexpected groups %v, expected %v", groups, test.expected)
+			}
+		})
+	}
+}
+
+// TestValidateBlockTag verifies only the known block tags are accepted.
+func TestValidateBlockTag(t *testing.T) {
+	t.Parallel()
+
+	for _, tag := range []string{"", BlockTagSource, BlockTagLegalBasis} {
+		if err := validateBlockTag(tag); err != nil {
+			t.Fatal("unexpected error", tag, err)
+		}
+	}
+	if err := validateBlockTag("reporter"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// testSkydCallsTagged verifies tagging the blocks sends a call to skyd for
+// every tag in a batch, and that every call is counted.
+func testSkydCallsTagged(t *testing.T, server *httptest.Server) {
+	// create the blocker
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	bl, err := newTestBlocker(ctx, "SkydCallsTagged", api.NewSkydClient(server.URL, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bl.staticBlockTag = BlockTagSource
+
+	// report three hashes by two sources
+	var hashes []database.Hash
+	for i, source := range []string{"a", "b", "a"} {
+		hash := database.HashBytes([]byte{byte(i)})
+		err = bl.staticDB.CreateBlockedSkylink(ctx, &database.BlockedSkylink{
+			Hash:           hash,
+			Reporter:       database.Reporter{Name: source},
+			TimestampAdded: time.Now().UTC(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	// assert the batch took a call per source
+	var calls SkydCalls
+	blocked, _, _, err := bl.blockHashes(ctx, bl.staticLogger, hashes, nil, &calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocked != 3 || calls.Calls != 2 || !reflect.DeepEqual(calls.BatchSizes, map[int]int{2: 1, 1: 1}) {
+		t.Fatal("unexpected calls", blocked, calls)
+	}
+	if calls.PerBlocked(blocked) != 2.0/3 {
+		t.Fatal("unexpected calls per blocked hash", calls.PerBlocked(blocked))
+	}
+}
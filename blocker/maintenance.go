@@ -0,0 +1,102 @@
+package blocker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+)
+
+type (
+	// MaintenanceWindow is a daily time of day range, in UTC, during which
+	// the blocker does not sweep. Start and End are offsets from midnight, a
+	// window whose end is before its start wraps around midnight.
+	MaintenanceWindow struct {
+		Start time.Duration
+		End   time.Duration
+	}
+
+	// MaintenanceSchedule is a set of daily maintenance windows.
+	MaintenanceSchedule []MaintenanceWindow
+)
+
+// ParseMaintenanceSchedule parses a comma separated list of time of day
+// ranges in UTC, e.g. '02:00-03:30,23:30-00:15'. An empty string results in
+// an empty schedule.
+func ParseMaintenanceSchedule(schedule string) (MaintenanceSchedule, error) {
+	var ms MaintenanceSchedule
+	for _, window := range strings.Split(schedule, ",") {
+		window = strings.TrimSpace(window)
+		if window == "" {
+			continue
+		}
+		bounds := strings.Split(window, "-")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid maintenance window '%v', expected 'HH:MM-HH:MM'", window)
+		}
+		start, err := parseTimeOfDay(bounds[0])
+		if err != nil {
+			return nil, errors.AddContext(err, fmt.Sprintf("invalid start of maintenance window '%v'", window))
+		}
+		end, err := parseTimeOfDay(bounds[1])
+		if err != nil {
+			return nil, errors.AddContext(err, fmt.Sprintf("invalid end of maintenance window '%v'", window))
+		}
+		if start == end {
+			return nil, fmt.Errorf("maintenance window '%v' is empty", window)
+		}
+		ms = append(ms, MaintenanceWindow{Start: start, End: end})
+	}
+	return ms, nil
+}
+
+// Active returns the maintenance window the given time falls in, if any.
+func (ms MaintenanceSchedule) Active(t time.Time) (MaintenanceWindow, bool) {
+	t = t.UTC()
+	tod := t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))
+	for _, mw := range ms {
+		if mw.contains(tod) {
+			return mw, true
+		}
+	}
+	return MaintenanceWindow{}, false
+}
+
+// String implements the fmt.Stringer interface, the output can be parsed by
+// ParseMaintenanceSchedule.
+func (ms MaintenanceSchedule) String() string {
+	windows := make([]string, len(ms))
+	for i, mw := range ms {
+		windows[i] = mw.String()
+	}
+	return strings.Join(windows, ",")
+}
+
+// String implements the fmt.Stringer interface.
+func (mw MaintenanceWindow) String() string {
+	return fmt.Sprintf("%s-%s", formatTimeOfDay(mw.Start), formatTimeOfDay(mw.End))
+}
+
+// contains returns true if the given time of day falls in the window.
+func (mw MaintenanceWindow) contains(tod time.Duration) bool {
+	if mw.Start < mw.End {
+		return tod >= mw.Start && tod < mw.End
+	}
+	return tod >= mw.Start || tod < mw.End
+}
+
+// parseTimeOfDay parses a time of day in the 'HH:MM' format and returns it as
+// an offset from midnight.
+func parseTimeOfDay(str string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(str))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// formatTimeOfDay formats the given offset from midnight as 'HH:MM'.
+func formatTimeOfDay(tod time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(tod.Hours()), int(tod.Minutes())%60)
+}
@@ -0,0 +1,129 @@
+package blocker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/SkynetLabs/blocker/api"
+	"github.com/SkynetLabs/blocker/database"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+// TestMaintenanceSchedule verifies maintenance schedules are parsed, that
+// windows wrapping around midnight are supported and that invalid schedules
+// are rejected.
+func TestMaintenanceSchedule(t *testing.T) {
+	t.Parallel()
+
+	ms, err := ParseMaintenanceSchedule(" 02:00-03:30, 23:30-00:15 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms.String() != "02:00-03:30,23:30-00:15" {
+		t.Fatal("unexpected schedule", ms)
+	}
+
+	// assert the windows are active at the expected times of day
+	tests := []struct {
+		tod    string
+		active bool
+	}{
+		{"01:59", false},
+		{"02:00", true},
+		{"03:29", true},
+		{"03:30", false},
+		{"23:29", false},
+		{"23:45", true},
+		{"00:10", true},
+		{"00:15", false},
+	}
+	for _, test := range tests {
+		tod, err := time.Parse("15:04", test.tod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := time.Date(2022, 3, 14, tod.Hour(), tod.Minute(), 0, 0, time.UTC)
+		if _, active := ms.Active(now); active != test.active {
+			t.Fatalf("unexpected state at %v, %v != %v", test.tod, active, test.active)
+		}
+	}
+
+	// assert the windows are in UTC
+	cet := time.FixedZone("CET", int(time.Hour.Seconds()))
+	if _, active := ms.Active(time.Date(2022, 3, 14, 2, 30, 0, 0, cet)); active {
+		t.Fatal("expected the window to be evaluated in UTC")
+	}
+
+	// assert an empty schedule has no windows
+	ms, err = ParseMaintenanceSchedule("")
+	if err != nil || len(ms) != 0 {
+		t.Fatal("unexpected outcome", ms, err)
+	}
+
+	// assert invalid schedules are rejected
+	for _, schedule := range []string{"02:00", "02:00-25:00", "2am-3am", "02:00-02:00", "02:00-03:00-04:00"} {
+		_, err = ParseMaintenanceSchedule(schedule)
+		if err == nil {
+			t.Fatal("expected error", schedule)
+		}
+	}
+}
+
+// TestMaintenanceWindow verifies the blocker rejects blocks during a
+// maintenance window, that the schedule can be replaced at runtime and that
+// the window is reflected in the sweep status.
+func TestMaintenanceWindow(t *testing.T) {
+	t.Parallel()
+
+	// create a blocker with a discard logger
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	bl := &Blocker{staticLogger: logrus.NewEntry(logger)}
+
+	// set a window that spans the current time
+	now := time.Now().UTC()
+	tod := now.Sub(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC))
+	schedule := fmt.Sprintf("%s-%s", formatTimeOfDay((tod+23*time.Hour)%(24*time.Hour)), formatTimeOfDay((tod+time.Hour)%(24*time.Hour)))
+	err := bl.SetMaintenanceSchedule(schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert we're in maintenance
+	if !bl.managedInMaintenance(bl.staticLogger) {
+		t.Fatal("expected to be in maintenance")
+	}
+	status := bl.SweepStatus()
+	if !status.Maintenance || status.MaintenanceSchedule != schedule {
+		t.Fatal("unexpected status", status)
+	}
+	_, _, err = bl.BlockHashes(context.Background(), []database.Hash{database.HashBytes([]byte("skylink"))})
+	if !errors.Contains(err, api.ErrMaintenance) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert an invalid schedule does not replace the current one
+	err = bl.SetMaintenanceSchedule("always")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if bl.SweepStatus().MaintenanceSchedule != schedule {
+		t.Fatal("unexpected schedule")
+	}
+
+	// clear the schedule and assert we're no longer in maintenance
+	err = bl.SetMaintenanceSchedule("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bl.managedInMaintenance(bl.staticLogger) || bl.SweepStatus().Maintenance {
+		t.Fatal("expected maintenance to be over")
+	}
+	if bl.managedMaintenanceError() != nil {
+		t.Fatal("expected no error")
+	}
+}
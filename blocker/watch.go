@@ -0,0 +1,147 @@
+package blocker
+
+import (
+	"context"
+	"time"
+
+	"github.com/SkynetLabs/blocker/database"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+const (
+	// loopWatch identifies the change stream in the logs.
+	loopWatch = "watch"
+
+	// watchCheckpointSource is the name under which the resume token of the
+	// change stream is persisted, alongside the checkpoints of the report
+	// sources.
+	watchCheckpointSource = "changestream:skylinks"
+
+	// watchBackoffMin and watchBackoffMax bound the amount of time we wait
+	// before reopening a change stream that failed, the backoff doubles
+	// with every consecutive failure.
+	watchBackoffMin = time.Second
+	watchBackoffMax = time.Minute
+)
+
+// WatchAndBlock tails a change stream on the skylinks collection and blocks
+// the skylinks that get inserted within seconds, rather than waiting for the
+// next sweep. It resumes after the last processed insert when it's restarted.
+// The inserted skylinks are subject to the same rules as the ones the sweep
+// finds, e.g. skylinks that are held back by the block delay are left to the
+// sweeps, which remain the backstop for anything the stream misses.
+//
+// If the stream got invalidated or can't be resumed, e.g. because the oplog no
+// longer holds the resume token, a new stream is opened, the inserts in
+// between are left to the sweeps. Other failures are retried with a backoff.
+// It returns when the given context is cancelled or the blocker is stopped,
+// or with database.ErrChangeStreamUnsupported if the database is not a
+// replica set.
+func (bl *Blocker) WatchAndBlock(ctx context.Context) error {
+	ctx, cancel := bl.staticStopContext(ctx)
+	defer cancel()
+	logger := bl.staticLogger.WithField("loop", loopWatch)
+
+	backoff := watchBackoffMin
+	for {
+		err := bl.managedWatch(ctx, logger)
+		if ctx.Err() != nil {
+			return nil
+		}
+		switch {
+		case errors.Contains(err, database.ErrChangeStreamUnsupported):
+			return err
+		case errors.Contains(err, database.ErrChangeStreamInvalidated), errors.Contains(err, database.ErrChangeStreamResumeFailed):
+			// start over with a new stream
+			logger.Warnf("WatchAndBlock opens a new change stream, inserts until now are left to the sweeps: %v", err)
+			err = bl.staticDB.SetSourceCheckpoint(ctx, watchCheckpointSource, "")
+			if err == nil {
+				backoff = watchBackoffMin
+				continue
+			}
+			logger.Errorf("WatchAndBlock failed to reset the resume token: %v", err)
+		default:
+			logger.Errorf("WatchAndBlock change stream failed, reopening in %v: %v", backoff, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > watchBackoffMax {
+			backoff = watchBackoffMax
+		}
+	}
+}
+
+// threadedWatchLoop blocks the skylinks as soon as they're inserted until the
+// blocker is stopped.
+func (bl *Blocker) threadedWatchLoop() {
+	err := bl.WatchAndBlock(context.Background())
+	if err != nil {
+		bl.staticLogger.Errorf("threadedWatchLoop stopped, skylinks are blocked by the sweeps only: %v", err)
+	}
+}
+
+// managedWatch opens a change stream that resumes after the persisted resume
+// token and blocks the inserted skylinks, the resume token is persisted after
+// every batch of inserts.
+func (bl *Blocker) managedWatch(ctx context.Context, logger *logrus.Entry) error {
+	token, err := bl.staticDB.SourceCheckpoint(ctx, watchCheckpointSource)
+	if err != nil {
+		return errors.AddContext(err, "failed to fetch the resume token")
+	}
+	logger.Debugf("WatchAndBlock opening change stream, resuming: %v", token != "")
+	return bl.staticDB.WatchInserts(ctx, token, blockBatchSize, func(hashes []database.Hash, token string) error {
+		bl.managedBlockInserted(ctx, logger, hashes)
+		err := bl.staticDB.SetSourceCheckpoint(ctx, watchCheckpointSource, token)
+		if err != nil {
+			return errors.AddContext(err, "failed to persist the resume token")
+		}
+		return nil
+	})
+}
+
+// managedBlockInserted blocks the given hashes of skylinks that just got
+// inserted. Hashes that don't have to be blocked, or that can't be blocked
+// right now, are left to the sweeps. Failures are logged rather than
+// returned, hashes that failed to get blocked are marked as failed and
+// retried by the retry loop.
+func (bl *Blocker) managedBlockInserted(ctx context.Context, logger *logrus.Entry, hashes []database.Hash) {
+	if len(hashes) == 0 {
+		return
+	}
+
+	// leave the hashes to the sweeps if those are skipped as well
+	if bl.managedSuspended() || bl.managedInMaintenance(logger) || !bl.managedSkydAvailable(logger) {
+		logger.Debugf("WatchAndBlock left %d inserted hashes to the sweeps", len(hashes))
+		return
+	}
+	held, err := bl.managedSweepLease()
+	if err != nil || !held {
+		logger.Debugf("WatchAndBlock left %d inserted hashes to the sweeps, sweep lease not held: %v", len(hashes), err)
+		return
+	}
+
+	// filter out the hashes that don't have to be blocked
+	pending, err := bl.staticDB.PendingHashes(ctx, hashes)
+	if err != nil {
+		logger.Errorf("WatchAndBlock failed to fetch the pending hashes: %v", err)
+		return
+	}
+	allowed, skipped, err := bl.staticApplyPrePolicy(ctx, logger, pending)
+	if err != nil {
+		logger.Errorf("WatchAndBlock failed to apply the pre-block policy: %v", err)
+		return
+	}
+
+	blocked, invalid, failed, err := bl.blockHashes(ctx, logger, allowed, nil, nil)
+	if err != nil {
+		logger.Errorf("WatchAndBlock failed to block hashes: %v", err)
+		return
+	}
+	logger.Debugf("WatchAndBlock blocked %d of %d inserted hashes, %d invalid, %d failed, %d skipped", blocked, len(hashes), invalid, failed, skipped)
+}
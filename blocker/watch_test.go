@@ -0,0 +1,143 @@
+package blocker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SkynetLabs/blocker/api"
+	"github.com/SkynetLabs/blocker/database"
+	"gitlab.com/NebulousLabs/errors"
+	skyapi "gitlab.com/SkynetLabs/skyd/node/api"
+)
+
+// testWatchAndBlock verifies skylinks are blocked as soon as they're inserted
+// and that the change stream resumes after the last processed insert when
+// it's restarted.
+func testWatchAndBlock(t *testing.T, _ *httptest.Server) {
+	// create a server that passes on the hashes it's asked to block
+	blockedChan := make(chan string, 100)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/skynet/blocklist", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var request skyapi.SkynetBlocklistPOST
+			err := json.NewDecoder(r.Body).Decode(&request)
+			if err != nil {
+				panic(err)
+			}
+			for _, hash := range request.Add {
+				blockedChan <- hash
+			}
+			skyapi.WriteJSON(w, api.BlockResponse{})
+			return
+		}
+		mockBlocklistResponse(w, r)
+	})
+	mux.HandleFunc("/daemon/version", mockVersionResponse)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// create the blocker
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+	bl, err := newTestBlocker(ctx, "WatchAndBlock", api.NewSkydClient(server.URL, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// start watching, in the background
+	watch := func() (context.CancelFunc, chan error) {
+		watchCtx, watchCancel := context.WithCancel(context.Background())
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- bl.WatchAndBlock(watchCtx)
+		}()
+		return watchCancel, errChan
+	}
+	insert := func(i int) database.Hash {
+		hash := database.HashBytes([]byte(fmt.Sprintf("watched_%d", i)))
+		err := bl.staticDB.CreateBlockedSkylink(ctx, &database.BlockedSkylink{
+			Hash:           hash,
+			TimestampAdded: time.Now().UTC(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	watchCancel, errChan := watch()
+
+	// insert skylinks until one gets blocked, the stream might not be open
+	// right away
+	var blocked string
+	for i := 0; blocked == ""; i++ {
+		if i == 100 {
+			t.Fatal("no inserted skylink got blocked")
+		}
+		insert(i)
+		select {
+		case err := <-errChan:
+			if errors.Contains(err, database.ErrChangeStreamUnsupported) {
+				t.Skip("the test database does not support change streams")
+			}
+			t.Fatal("unexpected error", err)
+		case blocked = <-blockedChan:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	// assert the blocked skylink got marked as blocked
+	var hash database.Hash
+	err = hash.LoadString(blocked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bsl, err := bl.staticDB.FindByHash(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bsl.BlockedAt.IsZero() {
+		t.Fatal("expected the skylink to be marked as blocked")
+	}
+
+	// stop watching
+	watchCancel()
+	select {
+	case err := <-errChan:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("WatchAndBlock did not return")
+	}
+
+	// drain the skylinks that got blocked in the meantime
+	for len(blockedChan) > 0 {
+		<-blockedChan
+	}
+
+	// insert a skylink while not watching, assert it gets blocked once the
+	// stream resumes
+	missed := insert(1000)
+	watchCancel, errChan = watch()
+	defer func() {
+		watchCancel()
+		<-errChan
+	}()
+	for {
+		select {
+		case err := <-errChan:
+			t.Fatal("unexpected error", err)
+		case blocked = <-blockedChan:
+		case <-time.After(10 * time.Second):
+			t.Fatal("skylink that was inserted while not watching did not get blocked")
+		}
+		if blocked == missed.String() {
+			break
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package build
+
+// These variables are set at build time through the linker flags in the
+// Makefile.
+var (
+	// BuildTime is the time at which the binary was built.
+	BuildTime string
+
+	// GitRevision is the git revision the binary was built from, it's
+	// prefixed with a marker if the working tree was dirty.
+	GitRevision string
+)
+
+// Version returns the version of the blocker, which is the git revision it
+// was built from, or 'dev' if the binary was not built through the Makefile.
+func Version() string {
+	if GitRevision == "" {
+		return "dev"
+	}
+	return GitRevision
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gitlab.com/NebulousLabs/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// MaxAnnotations is the maximum number of annotations a blocked skylink
+	// can hold.
+	MaxAnnotations = 32
+
+	// MaxAnnotationKeyLength is the maximum length in bytes of the key of an
+	// annotation.
+	MaxAnnotationKeyLength = 64
+
+	// MaxAnnotationValueLength is the maximum length in bytes of the value of
+	// an annotation.
+	MaxAnnotationValueLength = 1024
+
+	// annotationsMaxAttempts is the number of times an update of the
+	// annotations is attempted when it keeps conflicting with concurrent
+	// updates.
+	annotationsMaxAttempts = 10
+)
+
+var (
+	// ErrInvalidAnnotations is returned by UpdateAnnotations when the
+	// annotations would exceed their bounds, or when a key is malformed.
+	ErrInvalidAnnotations = errors.New("invalid annotations")
+
+	// ErrAnnotationsConflict is returned by UpdateAnnotations when the
+	// annotations kept getting updated concurrently and the update could not
+	// be applied.
+	ErrAnnotationsConflict = errors.New("annotations were updated concurrently")
+)
+
+// UpdateAnnotations applies the given patch to the annotations of the blocked
+// skylink with the given hash and returns the annotations that result from it.
+// Keys that map to nil are removed, the other keys are set to the given value.
+// The annotations are free-form notes of the moderators, e.g. a link to a
+// ticket, the sweeps ignore them.
+//
+// The update is atomic, the patch is applied to the annotations that were read
+// and only written if they were not updated in the meantime, otherwise it's
+// applied again. Concurrent updates of different keys are therefore all kept.
+// If the skylink is unknown ErrNoDocumentsFound is returned.
+func (db *DB) UpdateAnnotations(ctx context.Context, hash Hash, patch map[string]*string) (map[string]string, error) {
+	err := validateAnnotationsPatch(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.FindOne().SetProjection(bson.M{
+		"annotations":         1,
+		"annotations_version": 1,
+	})
+	for i := 0; i < annotationsMaxAttempts; i++ {
+		// fetch the current annotations
+		var doc struct {
+			Annotations map[string]string `bson:"annotations"`
+			Version     int64             `bson:"annotations_version"`
+		}
+		err = db.staticSkylinks.FindOne(ctx, bson.M{"hash": hash}, opts).Decode(&doc)
+		if errors.Contains(err, mongo.ErrNoDocuments) {
+			return nil, ErrNoDocumentsFound
+		}
+		if err != nil {
+			return nil, errors.AddContext(err, "failed to fetch annotations")
+		}
+
+		// apply the patch
+		annotations := applyAnnotationsPatch(doc.Annotations, patch)
+		if len(annotations) > MaxAnnotations {
+			return nil, errors.AddContext(ErrInvalidAnnotations, fmt.Sprintf("a skylink can hold at most %d annotations", MaxAnnotations))
+		}
+
+		// write the annotations, unless they were updated in the meantime
+		filter := bson.M{"hash": hash, "annotations_version": doc.Version}
+		if doc.Version == 0 {
+			filter["annotations_version"] = bson.M{"$exists": false}
+		}
+		update := bson.M{"$inc": bson.M{"annotations_version": 1}}
+		if len(annotations) > 0 {
+			update["$set"] = bson.M{"annotations": annotations}
+		} else {
+			update["$unset"] = bson.M{"annotations": ""}
+		}
+		res, err := db.staticSkylinks.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return nil, errors.AddContext(err, "failed to update annotations")
+		}
+		if res.MatchedCount == 1 {
+			return annotations, nil
+		}
+	}
+	return nil, ErrAnnotationsConflict
+}
+
+// applyAnnotationsPatch returns a copy of the given annotations with the given
+// patch applied.
+func applyAnnotationsPatch(annotations map[string]string, patch map[string]*string) map[string]string {
+	patched := make(map[string]string, len(annotations)+len(patch))
+	for key, value := range annotations {
+		patched[key] = value
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(patched, key)
+			continue
+		}
+		patched[key] = *value
+	}
+	return patched
+}
+
+// validateAnnotationsPatch returns ErrInvalidAnnotations if the given patch
+// holds an empty key, a key that can't be stored as a field name, or a key or
+// value that exceeds its maximum length.
+func validateAnnotationsPatch(patch map[string]*string) error {
+	if len(patch) == 0 {
+		return errors.AddContext(ErrInvalidAnnotations, "no annotations given")
+	}
+	for key, value := range patch {
+		if key == "" {
+			return errors.AddContext(ErrInvalidAnnotations, "key can't be empty")
+		}
+		if strings.HasPrefix(key, "$") || strings.Contains(key, ".") {
+			return errors.AddContext(ErrInvalidAnnotations, fmt.Sprintf("key '%s' can't start with '$' or contain '.'", key))
+		}
+		if len(key) > MaxAnnotationKeyLength {
+			return errors.AddContext(ErrInvalidAnnotations, fmt.Sprintf("key '%.16s...' exceeds the maximum length of %d bytes", key, MaxAnnotationKeyLength))
+		}
+		if value != nil && len(*value) > MaxAnnotationValueLength {
+			return errors.AddContext(ErrInvalidAnnotations, fmt.Sprintf("value of key '%s' exceeds the maximum length of %d bytes", key, MaxAnnotationValueLength))
+		}
+	}
+	return nil
+}
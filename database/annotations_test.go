@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+)
+
+// TestApplyAnnotationsPatch is a unit test for 'applyAnnotationsPatch'.
+func TestApplyAnnotationsPatch(t *testing.T) {
+	t.Parallel()
+
+	value := func(s string) *string { return &s }
+	annotations := map[string]string{"ticket": "1", "status": "open"}
+	patched := applyAnnotationsPatch(annotations, map[string]*string{
+		"status": nil,
+		"ticket": value("2"),
+		"owner":  value("mod"),
+		"absent": nil,
+	})
+	if len(patched) != 2 || patched["ticket"] != "2" || patched["owner"] != "mod" {
+		t.Fatal("unexpected annotations", patched)
+	}
+
+	// assert the given annotations are left untouched
+	if len(annotations) != 2 || annotations["ticket"] != "1" || annotations["status"] != "open" {
+		t.Fatal("annotations were modified", annotations)
+	}
+}
+
+// TestValidateAnnotationsPatch is a unit test for 'validateAnnotationsPatch'.
+func TestValidateAnnotationsPatch(t *testing.T) {
+	t.Parallel()
+
+	value := func(s string) *string { return &s }
+	tests := []struct {
+		patch map[string]*string
+		valid bool
+	}{
+		{map[string]*string{"ticket": value("https://example.com/1")}, true},
+		{map[string]*string{"ticket": nil}, true},
+		{map[string]*string{"ticket": value(strings.Repeat("a", MaxAnnotationValueLength))}, true},
+		{map[string]*string{}, false},
+		{map[string]*string{"": value("empty")}, false},
+		{map[string]*string{"$set": value("operator")}, false},
+		{map[string]*string{"a.b": value("dotted")}, false},
+		{map[string]*string{strings.Repeat("k", MaxAnnotationKeyLength+1): value("long")}, false},
+		{map[string]*string{"ticket": value(strings.Repeat("a", MaxAnnotationValueLength+1))}, false},
+	}
+	for i, test := range tests {
+		err := validateAnnotationsPatch(test.patch)
+		if test.valid && err != nil {
+			t.Fatal("unexpected error", i, err)
+		}
+		if !test.valid && !errors.Contains(err, ErrInvalidAnnotations) {
+			t.Fatal("expected ErrInvalidAnnotations", i, err)
+		}
+	}
+}
+
+// testUpdateAnnotations verifies annotations can be added, updated and removed,
+// that they're bounded and that concurrent updates of different keys are all
+// applied.
+func testUpdateAnnotations(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// assert unknown skylinks are rejected
+	hash := HashBytes([]byte("skylink"))
+	value := func(s string) *string { return &s }
+	_, err := db.UpdateAnnotations(ctx, hash, map[string]*string{"ticket": value("1")})
+	if !errors.Contains(err, ErrNoDocumentsFound) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// insert a skylink
+	err = db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+		Hash:           hash,
+		TimestampAdded: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add and update annotations
+	annotations, err := db.UpdateAnnotations(ctx, hash, map[string]*string{"ticket": value("1"), "status": value("open")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(annotations) != 2 {
+		t.Fatal("unexpected annotations", annotations)
+	}
+	annotations, err = db.UpdateAnnotations(ctx, hash, map[string]*string{"status": nil, "ticket": value("2")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(annotations) != 1 || annotations["ticket"] != "2" {
+		t.Fatal("unexpected annotations", annotations)
+	}
+
+	// assert they are persisted
+	doc, err := db.FindByHash(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc == nil || len(doc.Annotations) != 1 || doc.Annotations["ticket"] != "2" {
+		t.Fatal("unexpected document", doc)
+	}
+
+	// update different keys concurrently and assert none are lost
+	var wg sync.WaitGroup
+	errs := make([]error, MaxAnnotations-1)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = db.UpdateAnnotations(ctx, hash, map[string]*string{fmt.Sprintf("key_%d", i): value("value")})
+		}(i)
+	}
+	wg.Wait()
+	if err := errors.Compose(errs...); err != nil && !errors.Contains(err, ErrAnnotationsConflict) {
+		t.Fatal(err)
+	}
+	doc, err = db.FindByHash(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conflicts int
+	for _, err := range errs {
+		if err != nil {
+			conflicts++
+		}
+	}
+	if len(doc.Annotations)+conflicts != MaxAnnotations {
+		t.Fatal("unexpected number of annotations", len(doc.Annotations), conflicts)
+	}
+
+	// assert the number of annotations is bounded
+	if conflicts == 0 {
+		_, err = db.UpdateAnnotations(ctx, hash, map[string]*string{"one_too_many": value("value")})
+		if !errors.Contains(err, ErrInvalidAnnotations) {
+			t.Fatal("unexpected error", err)
+		}
+	}
+
+	// assert removing all annotations removes the field
+	patch := make(map[string]*string)
+	for key := range doc.Annotations {
+		patch[key] = nil
+	}
+	annotations, err = db.UpdateAnnotations(ctx, hash, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(annotations) != 0 {
+		t.Fatal("unexpected annotations", annotations)
+	}
+}
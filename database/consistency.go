@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"gitlab.com/NebulousLabs/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// hashConsistencySampleSize is the maximum number of skylinks with a
+	// non-canonical hash the self-check inspects on startup.
+	hashConsistencySampleSize = 1000
+)
+
+var (
+	// nonCanonicalHash is the filter that matches well formed hashes that are
+	// not in their canonical, lowercase, representation.
+	nonCanonicalHash = bson.A{
+		bson.M{"hash": hashRegex},
+		bson.M{"hash": primitive.Regex{Pattern: "[A-F]"}},
+	}
+)
+
+type (
+	// HashConsistencyReport is the outcome of CheckHashConsistency.
+	// NonCanonical is the number of inspected skylinks whose hash is not
+	// canonical, Collisions holds the groups of distinct skylinks that share
+	// a canonical hash.
+	HashConsistencyReport struct {
+		NonCanonical int
+		Collisions   []HashCollision
+	}
+
+	// HashCollision describes distinct skylinks that share the same
+	// canonical hash, the unique index on the hash considers them distinct
+	// while the blocker considers them equal. Hashes holds the hash of every
+	// skylink as it's stored, in the order of the IDs.
+	HashCollision struct {
+		Canonical string
+		IDs       []primitive.ObjectID
+		Hashes    []string
+	}
+
+	// rawHashDoc is a skylink's ID and its hash as it's stored, without
+	// decoding it.
+	rawHashDoc struct {
+		ID   primitive.ObjectID `bson:"_id"`
+		Hash string             `bson:"hash"`
+	}
+)
+
+// CheckHashConsistency verifies no two distinct skylinks share a canonical
+// hash. The blocker always writes canonical hashes, so only skylinks that
+// were written by other means, e.g. inserted manually, can have a hash that is
+// not canonical. Up to sampleSize of those are inspected and grouped with the
+// skylinks that share their canonical hash.
+func (db *DB) CheckHashConsistency(ctx context.Context, sampleSize int) (HashConsistencyReport, error) {
+	if sampleSize < 1 {
+		return HashConsistencyReport{}, errors.New("sample size must be positive")
+	}
+
+	// fetch the skylinks with a non-canonical hash
+	opts := options.Find()
+	opts.SetLimit(int64(sampleSize))
+	opts.SetProjection(bson.M{"_id": 1, "hash": 1})
+	c, err := db.staticSkylinks.Find(ctx, bson.M{"$and": nonCanonicalHash}, opts)
+	if err != nil {
+		return HashConsistencyReport{}, errors.AddContext(err, "failed to fetch skylinks with a non-canonical hash")
+	}
+	var docs []rawHashDoc
+	err = c.All(ctx, &docs)
+	if err != nil {
+		return HashConsistencyReport{}, errors.AddContext(err, "failed to decode skylinks with a non-canonical hash")
+	}
+
+	// group them by their canonical hash
+	var canonicals []string
+	groups := make(map[string][]rawHashDoc)
+	for _, doc := range docs {
+		var h Hash
+		err = h.LoadString(doc.Hash)
+		if err != nil {
+			continue
+		}
+		canonical := CanonicalHash(h)
+		if _, exists := groups[canonical]; !exists {
+			canonicals = append(canonicals, canonical)
+		}
+		groups[canonical] = append(groups[canonical], doc)
+	}
+
+	// add the skylinks that share the canonical hash, the other non-canonical
+	// variants of the hash are only found if they were part of the sample
+	report := HashConsistencyReport{NonCanonical: len(docs)}
+	for _, canonical := range canonicals {
+		var doc rawHashDoc
+		err = db.staticSkylinks.FindOne(ctx, bson.M{"hash": canonical}, options.FindOne().SetProjection(bson.M{"_id": 1, "hash": 1})).Decode(&doc)
+		if err != nil && !isDocumentNotFound(err) {
+			return HashConsistencyReport{}, errors.AddContext(err, "failed to fetch skylink by canonical hash")
+		}
+		group := groups[canonical]
+		if err == nil {
+			group = append([]rawHashDoc{doc}, group...)
+		}
+		if len(group) < 2 {
+			continue
+		}
+		collision := HashCollision{Canonical: canonical}
+		for _, doc := range group {
+			collision.IDs = append(collision.IDs, doc.ID)
+			collision.Hashes = append(collision.Hashes, doc.Hash)
+		}
+		report.Collisions = append(report.Collisions, collision)
+	}
+	return report, nil
+}
+
+// checkHashConsistency runs CheckHashConsistency on a sample of the skylinks
+// and logs the skylinks that collide, so operators can merge them. Failing to
+// run the check is logged but not considered an error.
+func (db *DB) checkHashConsistency(ctx context.Context) {
+	logger := db.staticLogger
+	report, err := db.CheckHashConsistency(ctx, hashConsistencySampleSize)
+	if err != nil {
+		logger.Errorf("failed to check the consistency of the hashes, err: %v", err)
+		return
+	}
+	if report.NonCanonical > 0 {
+		logger.Warnf("found %v skylinks with a non-canonical hash, they were not written by the blocker", report.NonCanonical)
+	}
+	for _, collision := range report.Collisions {
+		ids := make([]string, len(collision.IDs))
+		for i, id := range collision.IDs {
+			ids[i] = id.Hex()
+		}
+		logger.Errorf(`[CRITICAL] skylinks %v share the canonical hash %v but are stored as %v, they have to be merged`, strings.Join(ids, ", "), collision.Canonical, strings.Join(collision.Hashes, ", "))
+	}
+}
@@ -4,12 +4,16 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"gitlab.com/NebulousLabs/errors"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -25,6 +29,11 @@ const (
 	// mongoIndexCreateTimeout is the timeout used when creating indices
 	mongoIndexCreateTimeout = time.Minute
 
+	// MongoWriteTimeout is the amount of time a write waits for the write
+	// concern to be satisfied before it fails, without it a write with a
+	// majority write concern blocks indefinitely if the majority is lost.
+	MongoWriteTimeout = 30 * time.Second
+
 	// mongoTestUsername is the username used for the test database.
 	mongoTestUsername = "admin"
 
@@ -33,6 +42,20 @@ const (
 
 	// mongoTestConnString is the connection string used for the test database.
 	mongoTestConnString = "mongodb://localhost:37017"
+
+	// MinHashPrefixLength is the minimum number of hex characters of a hash
+	// prefix, shorter prefixes would match too many hashes.
+	MinHashPrefixLength = 8
+
+	// maxHashPrefixMatches is the maximum number of skylinks returned by a
+	// hash prefix lookup.
+	maxHashPrefixMatches = 100
+
+	// secondaryReadLookback is the amount of time we look back further than
+	// the latest block timestamp when the sweep reads from secondaries and no
+	// max staleness was configured on the read preference. This ensures we do
+	// not miss hashes that had not been replicated yet during the last sweep.
+	secondaryReadLookback = time.Hour
 )
 
 var (
@@ -40,6 +63,10 @@ var (
 	// unique constraint on a certain field.
 	ErrDuplicateKey = errors.New("E11000 duplicate key")
 
+	// ErrInvalidHashPrefix is returned when a hash prefix is not hex encoded,
+	// or too short to be looked up efficiently.
+	ErrInvalidHashPrefix = errors.New("invalid hash prefix")
+
 	// ErrIndexCreateFailed is returned when an error occurred when trying to
 	// ensure an index
 	ErrIndexCreateFailed = errors.New("failed to create index")
@@ -74,6 +101,109 @@ var (
 
 	// collAllowlist defines the name of the allowlist collection
 	collAllowlist = "allowlist"
+
+	// collLatestBlockTimestamps defines the name of the collection that holds
+	// the latest block timestamp for every skyd target
+	collLatestBlockTimestamps = "latest_block_timestamps"
+
+	// collLeases defines the name of the collection that holds the leases
+	// that ensure only one blocker instance performs a certain task
+	collLeases = "leases"
+
+	// collSweepStats defines the name of the collection that holds the
+	// statistics of every sweep performed by the blocker
+	collSweepStats = "sweep_stats"
+
+	// collSourceCheckpoints defines the name of the collection that holds the
+	// checkpoint of every report source
+	collSourceCheckpoints = "source_checkpoints"
+
+	// collDisabledSources defines the name of the collection that holds the
+	// report sources whose reports are not acted upon
+	collDisabledSources = "disabled_sources"
+
+	// collMigrations defines the name of the collection that holds the
+	// versions of the migrations that were applied
+	collMigrations = "migrations"
+
+	// collSnapshots defines the name of the collection that holds the
+	// snapshots of the blocklist
+	collSnapshots = "snapshots"
+
+	// collRevisions defines the name of the collection that holds the
+	// revision of the blocklist
+	collRevisions = "revisions"
+)
+
+const (
+	// DefaultSkydTarget is the identifier under which the latest block
+	// timestamp is stored when the blocker talks to a single skyd instance.
+	DefaultSkydTarget = "default"
+
+	// leaseSweep is the name of the lease that must be held by a blocker
+	// instance in order to sweep the database for hashes to block.
+	leaseSweep = "sweep"
+
+	// defaultDiagnosticsRetention is the default amount of time diagnostic
+	// data, such as the sweep statistics, is kept in the database.
+	defaultDiagnosticsRetention = 90 * 24 * time.Hour
+
+	// ttlIndexName is the name of the TTL index on collections that hold
+	// diagnostic data.
+	ttlIndexName = "timestamp_ttl"
+
+	// connectBackoffMin and connectBackoffMax define the bounds of the
+	// exponential backoff used when retrying to connect to the database
+	// after starting in degraded mode.
+	connectBackoffMin = time.Second
+	connectBackoffMax = time.Minute
+
+	// timestampWriteAttempts is the number of times we try to write the
+	// latest block timestamp before giving up, transient errors such as a
+	// primary stepping down during a replica set election are retried.
+	timestampWriteAttempts = 3
+)
+
+var (
+	// timestampWriteBackoff is the amount of time we wait before retrying a
+	// failed timestamp write, it doubles after every attempt.
+	timestampWriteBackoff = 250 * time.Millisecond
+
+	// retryableErrorCodes are the codes of the mongo errors that are caused
+	// by a replica set election or a node shutting down, these are transient
+	// and the operation is expected to succeed when it's retried.
+	retryableErrorCodes = []int{
+		6,     // HostUnreachable
+		7,     // HostNotFound
+		89,    // NetworkTimeout
+		91,    // ShutdownInProgress
+		189,   // PrimarySteppedDown
+		9001,  // SocketException
+		10107, // NotWritablePrimary
+		11600, // InterruptedAtShutdown
+		11602, // InterruptedDueToReplStateChange
+		13435, // NotPrimaryNoSecondaryOk
+		13436, // NotPrimaryOrSecondary
+	}
+)
+
+var (
+	// tenantRegex matches the valid tenants, the tenant becomes part of the
+	// collection names so we restrict it to a safe set of characters.
+	tenantRegex = regexp.MustCompile("^[a-zA-Z0-9_-]{1,64}$")
+)
+
+var (
+	// hashRegex matches the string representation of a hash.
+	hashRegex = primitive.Regex{Pattern: "^[0-9a-fA-F]{64}$"}
+
+	// emptyHash is the string representation of the empty hash.
+	emptyHash = Hash{}.String()
+
+	// wellFormedHash is the filter that matches well formed hashes, skylinks
+	// that have a missing, empty or otherwise malformed hash can't be decoded
+	// nor blocked.
+	wellFormedHash = bson.M{"$regex": hashRegex, "$ne": emptyHash}
 )
 
 // DB holds a connection to the database, as well as helpful shortcuts to
@@ -81,27 +211,228 @@ var (
 //
 // NOTE: update the 'Purge' method when adding new collections
 type DB struct {
-	staticClient    *mongo.Client
-	staticDB        *mongo.Database
-	staticAllowList *mongo.Collection
-	staticSkylinks  *mongo.Collection
-	staticLogger    *logrus.Logger
+	staticClient                *mongo.Client
+	staticDB                    *mongo.Database
+	staticAllowList             *mongo.Collection
+	staticDisabledSources       *mongo.Collection
+	staticLatestBlockTimestamps *mongo.Collection
+	staticLeases                *mongo.Collection
+	staticMigrations            *mongo.Collection
+	staticRevisions             *mongo.Collection
+	staticSkylinks              *mongo.Collection
+	staticSnapshots             *mongo.Collection
+	staticSourceCheckpoints     *mongo.Collection
+	staticSweepStats            *mongo.Collection
+	staticLogger                *logrus.Logger
+
+	// staticTenant is the tenant the collections belong to, it's empty if
+	// the database is not shared with other blockers.
+	staticTenant string
+
+	// staticSweepSkylinks is the skylinks collection configured with the
+	// read preference of the sweep queries, staticSweepLookback is the
+	// additional amount of time these queries look back to account for
+	// replication lag.
+	staticSweepSkylinks *mongo.Collection
+	staticSweepLookback time.Duration
+
+	// staticBlockDelay is the amount of time newly reported skylinks are held
+	// back before the sweep picks them up, which allows reviewing them.
+	staticBlockDelay BlockDelay
+
+	// staticReportThreshold is the number of distinct reporters that have to
+	// report a skylink before the sweep picks it up.
+	staticReportThreshold ReportThreshold
+
+	// connected indicates whether the database was reachable and its schema
+	// got ensured, it is only ever false when starting in degraded mode.
+	connected      bool
+	staticMu       sync.Mutex
+	staticStopChan chan struct{}
+}
+
+// Options holds the configurable options of the database.
+type Options struct {
+	// SweepReadPreference is the read preference used by the queries that
+	// sweep the database for hashes to block or retry. Reading from
+	// secondaries offloads the primary, but secondaries may lag behind and
+	// briefly miss fresh hashes. To account for that, the sweep looks back
+	// further than the latest block timestamp by the read preference's max
+	// staleness, or an hour if no max staleness is set. Re-blocking a hash is
+	// a no-op in skyd. Defaults to primary.
+	SweepReadPreference *readpref.ReadPref
+
+	// TimestampWriteConcern is the write concern used when updating the
+	// latest block timestamp. Losing that update, e.g. during a failover,
+	// causes huge ranges of hashes to get blocked again, which is why it
+	// defaults to majority.
+	TimestampWriteConcern *writeconcern.WriteConcern
+
+	// DiagnosticsRetention is the amount of time diagnostic data, such as
+	// the sweep statistics, is kept before it expires. The blocked skylinks
+	// themselves never expire. Defaults to 90 days.
+	DiagnosticsRetention time.Duration
+
+	// AllowDegradedStart allows the database to be created while the
+	// database server is unreachable. In that case the connection is retried
+	// in the background, with backoff, and Connected returns false until it
+	// succeeds. By default we fail fast.
+	AllowDegradedStart bool
+
+	// BlockDelay holds back newly reported skylinks for the configured
+	// amount of time before the sweep picks them up, which opens a window in
+	// which they can be reviewed and cancelled. Defaults to no delay.
+	BlockDelay BlockDelay
+
+	// ReportThreshold requires skylinks to be reported by a number of
+	// distinct reporters before the sweep picks them up, which allows
+	// requiring confirmation of the reports of low-trust sources. Defaults
+	// to a single report.
+	ReportThreshold ReportThreshold
+
+	// Tenant isolates the collections of this blocker from those of other
+	// blockers that share the same database, the tenant is appended to the
+	// name of every collection, e.g. 'skylinks_<tenant>'. Defaults to no
+	// tenant, in which case the collections keep their regular names.
+	Tenant string
+}
+
+// BlockDelay configures the amount of time newly reported skylinks are held
+// back before they get blocked. The delay of a skylink is the longest delay
+// configured for any of its tags, skylinks without any of these tags are
+// delayed by the default delay.
+type BlockDelay struct {
+	Default time.Duration
+	Tags    map[string]time.Duration
+}
+
+// Max returns the longest configured delay.
+func (bd BlockDelay) Max() time.Duration {
+	max := bd.Default
+	for _, delay := range bd.Tags {
+		if delay > max {
+			max = delay
+		}
+	}
+	return max
+}
+
+// filter returns the conditions a skylink has to meet at the given time to
+// no longer be held back. A skylink with one of the configured tags has to be
+// older than the delay of every configured tag it has, any other skylink has
+// to be older than the default delay. If no delay is configured, no
+// conditions are returned.
+func (bd BlockDelay) filter(now time.Time) bson.A {
+	if bd.Max() == 0 {
+		return nil
+	}
+
+	// sort the tags to build a deterministic filter
+	tags := make([]string, 0, len(bd.Tags))
+	for tag := range bd.Tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	var conditions bson.A
+	for _, tag := range tags {
+		if bd.Tags[tag] == 0 {
+			continue
+		}
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"tags": bson.M{"$ne": tag}},
+			bson.M{"timestamp_added": bson.M{"$lte": now.Add(-bd.Tags[tag])}},
+		}})
+	}
+	if bd.Default > 0 {
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"tags": bson.M{"$in": tags}},
+			bson.M{"timestamp_added": bson.M{"$lte": now.Add(-bd.Default)}},
+		}})
+	}
+	return conditions
+}
+
+// SweepStats holds the statistics of a single sweep of the blocker.
+type SweepStats struct {
+	Timestamp time.Time     `bson:"timestamp"`
+	Loop      string        `bson:"loop"`
+	SweepID   string        `bson:"sweep_id,omitempty"`
+	Hashes    int           `bson:"hashes"`
+	Blocked   int           `bson:"blocked"`
+	Invalid   int           `bson:"invalid"`
+	Malformed int           `bson:"malformed"`
+	Duration  time.Duration `bson:"duration"`
+	Error     string        `bson:"error,omitempty"`
+
+	// SkydCalls is the number of calls the sweep made to skyd to block the
+	// hashes, CallsPerBlocked is that number divided by the number of
+	// blocked hashes.
+	SkydCalls       int     `bson:"skyd_calls"`
+	CallsPerBlocked float64 `bson:"calls_per_blocked"`
+}
+
+// latestBlockTimestamp is the document that holds the latest block timestamp
+// for a certain skyd target.
+type latestBlockTimestamp struct {
+	Target    string    `bson:"target"`
+	Timestamp time.Time `bson:"timestamp"`
+}
+
+// sourceCheckpoint is the document that holds the checkpoint of a report
+// source, the checkpoint is opaque to the database.
+type sourceCheckpoint struct {
+	Source     string `bson:"source"`
+	Checkpoint string `bson:"checkpoint"`
+}
+
+// lease is the document that holds a lease, it is held by the instance with
+// the given holder id until it expires.
+type lease struct {
+	Name    string    `bson:"name"`
+	Holder  string    `bson:"holder"`
+	Expires time.Time `bson:"expires"`
+}
+
+// DefaultOptions returns the default database options.
+func DefaultOptions() Options {
+	return Options{
+		SweepReadPreference:   readpref.Primary(),
+		TimestampWriteConcern: writeconcern.New(writeconcern.WMajority(), writeconcern.WTimeout(MongoWriteTimeout)),
+		DiagnosticsRetention:  defaultDiagnosticsRetention,
+	}
 }
 
 // New creates a new database connection.
-func New(ctx context.Context, uri string, creds options.Credential, logger *logrus.Logger) (*DB, error) {
-	return NewCustomDB(ctx, uri, dbName, creds, logger)
+func New(ctx context.Context, uri string, creds options.Credential, opts Options, logger *logrus.Logger) (*DB, error) {
+	return NewCustomDB(ctx, uri, dbName, creds, opts, logger)
 }
 
 // NewCustomDB creates a new database connection to a database with a custom
 // name.
-func NewCustomDB(ctx context.Context, uri string, dbName string, creds options.Credential, logger *logrus.Logger) (*DB, error) {
+func NewCustomDB(ctx context.Context, uri string, dbName string, creds options.Credential, dbOpts Options, logger *logrus.Logger) (*DB, error) {
 	if ctx == nil {
 		return nil, errors.New("no context provided")
 	}
 	if logger == nil {
 		return nil, errors.New("no logger provided")
 	}
+	err := ValidateTenant(dbOpts.Tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fall back to the defaults for all options that were not set.
+	defaults := DefaultOptions()
+	if dbOpts.SweepReadPreference == nil {
+		dbOpts.SweepReadPreference = defaults.SweepReadPreference
+	}
+	if dbOpts.TimestampWriteConcern == nil {
+		dbOpts.TimestampWriteConcern = defaults.TimestampWriteConcern
+	}
+	if dbOpts.DiagnosticsRetention == 0 {
+		dbOpts.DiagnosticsRetention = defaults.DiagnosticsRetention
+	}
 
 	// Prepare the options for connecting to the db.
 	opts := options.Client().
@@ -110,7 +441,7 @@ func NewCustomDB(ctx context.Context, uri string, dbName string, creds options.C
 		SetReadPreference(readpref.Primary()).
 		SetWriteConcern(writeconcern.New(
 			writeconcern.WMajority(),
-			writeconcern.WTimeout(time.Second*30),
+			writeconcern.WTimeout(MongoWriteTimeout),
 		)).
 		SetCompressors([]string{"zstd,zlib,snappy"})
 
@@ -123,9 +454,79 @@ func NewCustomDB(ctx context.Context, uri string, dbName string, creds options.C
 		return nil, errors.AddContext(err, "failed to connect to db")
 	}
 
-	// Ensure the database schema
+	// Configure the collections that use custom read preferences or write
+	// concerns.
 	db := c.Database(dbName)
-	err = ensureDBSchema(ctx, db, logger)
+	sweepOpts := options.Collection().SetReadPreference(dbOpts.SweepReadPreference)
+	timestampOpts := options.Collection().SetWriteConcern(dbOpts.TimestampWriteConcern)
+	tenant := dbOpts.Tenant
+
+	// Define the database
+	cdb := &DB{
+		staticClient:                c,
+		staticDB:                    db,
+		staticAllowList:             db.Collection(collectionName(collAllowlist, tenant)),
+		staticDisabledSources:       db.Collection(collectionName(collDisabledSources, tenant)),
+		staticLatestBlockTimestamps: db.Collection(collectionName(collLatestBlockTimestamps, tenant), timestampOpts),
+		staticLeases:                db.Collection(collectionName(collLeases, tenant)),
+		staticMigrations:            db.Collection(collectionName(collMigrations, tenant)),
+		staticRevisions:             db.Collection(collectionName(collRevisions, tenant)),
+		staticSkylinks:              db.Collection(collectionName(collSkylinks, tenant)),
+		staticSnapshots:             db.Collection(collectionName(collSnapshots, tenant)),
+		staticSourceCheckpoints:     db.Collection(collectionName(collSourceCheckpoints, tenant)),
+		staticSweepStats:            db.Collection(collectionName(collSweepStats, tenant)),
+		staticLogger:                logger,
+		staticTenant:                tenant,
+
+		staticSweepSkylinks: db.Collection(collectionName(collSkylinks, tenant), sweepOpts),
+		staticSweepLookback: sweepLookback(dbOpts.SweepReadPreference),
+		staticBlockDelay:    dbOpts.BlockDelay,
+
+		staticReportThreshold: dbOpts.ReportThreshold,
+
+		connected:      true,
+		staticStopChan: make(chan struct{}),
+	}
+
+	// Ensure the database is reachable, if we are allowed to start in
+	// degraded mode we keep trying to connect in the background.
+	err = cdb.Ping(ctx)
+	if err != nil && !dbOpts.AllowDegradedStart {
+		return nil, errors.Compose(errors.AddContext(err, "failed to reach db"), c.Disconnect(context.Background()))
+	}
+	if err != nil {
+		logger.Errorf("failed to reach the db, starting in degraded mode, err: %v", err)
+		cdb.connected = false
+		go cdb.threadedConnect(dbOpts)
+		return cdb, nil
+	}
+
+	// Ensure the database schema
+	err = cdb.ensureSchema(ctx, dbOpts)
+	if err != nil {
+		return nil, err
+	}
+	return cdb, nil
+}
+
+// ensureSchema ensures the database schema and the TTL indices on the
+// collections that hold diagnostic data, and applies the pending migrations.
+func (db *DB) ensureSchema(ctx context.Context, opts Options) error {
+	logger := db.staticLogger
+
+	// Collapse duplicate skylinks if the unique index on the hash does not
+	// exist yet, otherwise creating that index fails.
+	hasHashIndex, err := hasIndex(ctx, db.staticSkylinks, "hash")
+	if err == nil && !hasHashIndex {
+		removed, err := db.CollapseDuplicates(ctx)
+		if err != nil {
+			logger.Errorf(`[CRITICAL] failed to collapse duplicate skylinks, err: %v`, err)
+		} else if removed > 0 {
+			logger.Infof("collapsed duplicate skylinks, removed %v skylinks", removed)
+		}
+	}
+
+	err = ensureDBSchema(ctx, db.staticDB, db.staticTenant, logger)
 	if err != nil && errors.Contains(err, ErrIndexCreateFailed) {
 		// We do not error out if we failed to ensure the existence of an index.
 		// It is definitely an issue that should be looked into, which is why we
@@ -133,19 +534,56 @@ func NewCustomDB(ctx context.Context, uri string, dbName string, creds options.C
 		// without the index it's no reason to prevent it from running.
 		logger.Errorf(`[CRITICAL] failed to ensure DB schema, err: %v`, err)
 	} else if err != nil {
-		return nil, err
+		return err
 	}
 
-	// Define the database
-	cdb := &DB{
-		staticClient:    c,
-		staticDB:        db,
-		staticAllowList: db.Collection(collAllowlist),
-		staticSkylinks:  db.Collection(collSkylinks),
-		staticLogger:    logger,
+	// Verify no two skylinks share a canonical hash, which the unique index
+	// on the hash can't prevent if a hash was not stored canonically
+	db.checkHashConsistency(ctx)
+
+	// Ensure the diagnostic data expires after the retention period
+	err = ensureTTLIndex(ctx, db.staticSweepStats, "timestamp", opts.DiagnosticsRetention)
+	if err != nil {
+		logger.Errorf(`[CRITICAL] failed to ensure TTL index on collection '%v', err: %v`, db.staticSweepStats.Name(), err)
 	}
 
-	return cdb, nil
+	// Apply the pending migrations, a failed migration prevents the
+	// database from being used.
+	return db.Migrate(ctx)
+}
+
+// threadedConnect retries connecting to the database, with exponential
+// backoff, until it succeeds or the database gets closed. Once connected, the
+// database schema is ensured and the database is marked as connected.
+func (db *DB) threadedConnect(opts Options) {
+	backoff := connectBackoffMin
+	for {
+		select {
+		case <-db.staticStopChan:
+			return
+		case <-time.After(backoff):
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+		err := db.Ping(ctx)
+		if err == nil {
+			err = db.ensureSchema(ctx, opts)
+		}
+		cancel()
+		if err == nil {
+			db.staticMu.Lock()
+			db.connected = true
+			db.staticMu.Unlock()
+			db.staticLogger.Info("connected to the db, leaving degraded mode")
+			return
+		}
+
+		backoff *= 2
+		if backoff > connectBackoffMax {
+			backoff = connectBackoffMax
+		}
+		db.staticLogger.Warnf("failed to connect to the db, retrying in %v, err: %v", backoff, err)
+	}
 }
 
 // NewTestDB returns a test database, the database gets purged and on error we
@@ -161,7 +599,7 @@ func NewTestDB(ctx context.Context, dbName string) *DB {
 	db, err := NewCustomDB(ctx, mongoTestConnString, dbName, options.Credential{
 		Username: mongoTestUsername,
 		Password: mongoTestPassword,
-	}, logger)
+	}, DefaultOptions(), logger)
 	if err != nil {
 		panic(err)
 	}
@@ -177,21 +615,66 @@ func NewTestDB(ctx context.Context, dbName string) *DB {
 	return db
 }
 
+// BlockCountsBySource returns the number of blocked skylinks per source, sorted
+// by count in descending order. Only skylinks that were added in the given time
+// range are counted, where a zero time means the range is unbounded on that
+// side. Test records are only counted if includeTest is set. The counts are
+// aggregated by the database.
+func (db *DB) BlockCountsBySource(ctx context.Context, from, to time.Time, includeTest bool) ([]SourceCount, error) {
+	// build the match stage
+	match := bson.M{
+		"invalid":  bson.M{"$ne": true},
+		"reverted": bson.M{"$ne": true},
+	}
+	if !includeTest {
+		match["test"] = bson.M{"$ne": true}
+	}
+	timeRange := bson.M{}
+	if !from.IsZero() {
+		timeRange["$gte"] = from
+	}
+	if !to.IsZero() {
+		timeRange["$lt"] = to
+	}
+	if len(timeRange) > 0 {
+		match["timestamp_added"] = timeRange
+	}
+
+	// group the skylinks by source
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$reporter.name",
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+	c, err := db.staticSkylinks.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var counts []SourceCount
+	err = c.All(ctx, &counts)
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
 // BlockedHashes allows to pass a skip and limit parameter and returns an array
 // of blocked hashes alongside a boolean that indicates whether there's more
-// documents after the current 'page'.
-func (db *DB) BlockedHashes(ctx context.Context, sort, skip, limit int) ([]BlockedSkylink, bool, error) {
+// documents after the current 'page'. Test records are only returned if
+// includeTest is set.
+func (db *DB) BlockedHashes(ctx context.Context, sort, skip, limit int, includeTest bool) ([]BlockedSkylink, bool, error) {
 	// configure the options
 	opts := options.Find()
 	opts.SetSkip(int64(skip))
 	opts.SetLimit(int64(limit + 1))
-	opts.SetSort(bson.M{"timestamp_added": sort})
+	opts.SetSort(sortByTimestampAdded(sort))
 
 	// fetch the documents
-	docs, err := db.find(ctx, bson.M{
-		"invalid": bson.M{"$ne": true},
-		"hash":    bson.M{"$exists": true},
-	}, opts)
+	docs, err := db.find(ctx, blockedHashesFilter(includeTest), opts)
 	if err != nil {
 		return nil, false, err
 	}
@@ -205,13 +688,304 @@ func (db *DB) BlockedHashes(ctx context.Context, sort, skip, limit int) ([]Block
 	return docs, false, nil
 }
 
+// CountBlockedHashes returns the number of blocked hashes, it matches the
+// number of hashes returned by paging through BlockedHashes.
+func (db *DB) CountBlockedHashes(ctx context.Context, includeTest bool) (int64, error) {
+	return db.staticSkylinks.CountDocuments(ctx, blockedHashesFilter(includeTest))
+}
+
+// ForEachBlockedHash calls the given function for every blocked hash, in the
+// order they were added or the reverse order, depending on the given sort.
+// At most limit hashes are iterated. The hashes are streamed from the
+// database rather than loaded into memory all at once. Iteration stops at the
+// first error returned by the given function. Test records are only iterated
+// if includeTest is set.
+func (db *DB) ForEachBlockedHash(ctx context.Context, sort int, limit int64, includeTest bool, fn func(Hash) error) error {
+	opts := options.Find()
+	opts.SetLimit(limit)
+	opts.SetProjection(bson.M{"hash": 1})
+	opts.SetSort(sortByTimestampAdded(sort))
+
+	c, err := db.staticSkylinks.Find(ctx, blockedHashesFilter(includeTest), opts)
+	if err != nil {
+		return err
+	}
+	defer c.Close(ctx)
+
+	for c.Next(ctx) {
+		var bsl BlockedSkylink
+		err = c.Decode(&bsl)
+		if err != nil {
+			return err
+		}
+		err = fn(bsl.Hash)
+		if err != nil {
+			return err
+		}
+	}
+	return c.Err()
+}
+
 // Close disconnects the db.
 func (db *DB) Close(ctx context.Context) error {
+	// stop trying to connect if we are in degraded mode
+	db.staticMu.Lock()
+	select {
+	case <-db.staticStopChan:
+	default:
+		close(db.staticStopChan)
+	}
+	db.staticMu.Unlock()
+
 	return db.staticClient.Disconnect(ctx)
 }
 
+// CollapseDuplicates collapses all blocked skylinks that share the same hash
+// into a single blocked skylink and returns the number of blocked skylinks
+// that were removed. The unique index on the hash prevents duplicates, but if
+// that index failed to get created duplicates might have slipped in, which in
+// turn prevent the index from being created. Of all duplicates we keep the
+// first one that was not unblocked, or the first one if they all were, the
+// tags, reporters, history and V2 pointers of the others are merged into it.
+func (db *DB) CollapseDuplicates(ctx context.Context) (int, error) {
+	// find all hashes that occur more than once
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$hash",
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{
+			"count": bson.M{"$gt": 1},
+		}}},
+	}
+	c, err := db.staticSkylinks.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return 0, err
+	}
+	var groups []struct {
+		Hash Hash `bson:"_id"`
+	}
+	err = c.All(ctx, &groups)
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int
+	for _, group := range groups {
+		// fetch the duplicates, oldest first
+		opts := options.Find().SetSort(sortByTimestampAdded(1))
+		docs, err := db.find(ctx, bson.M{"hash": group.Hash}, opts)
+		if err != nil {
+			return removed, err
+		}
+		if len(docs) < 2 {
+			continue
+		}
+
+		// pick the skylink to keep
+		keep := 0
+		for i, doc := range docs {
+			if !doc.Reverted {
+				keep = i
+				break
+			}
+		}
+
+		// merge the others into it
+		kept := docs[keep]
+		var remove []primitive.ObjectID
+		for i, doc := range docs {
+			if i == keep {
+				continue
+			}
+			kept.Tags = append(kept.Tags, doc.Tags...)
+			kept.Reporters = append(kept.Reporters, doc.Reporter)
+			kept.Reporters = append(kept.Reporters, doc.Reporters...)
+			kept.History = append(kept.History, doc.History...)
+			kept.V2Pointers = append(kept.V2Pointers, doc.V2Pointers...)
+			remove = append(remove, doc.ID)
+		}
+		update := bson.M{"$set": bson.M{
+			"history":     kept.History,
+			"reporters":   kept.Reporters,
+			"tags":        uniqueStrings(kept.Tags),
+			"v2_pointers": kept.V2Pointers,
+		}}
+		_, err = db.staticSkylinks.UpdateOne(ctx, bson.M{"_id": kept.ID}, update)
+		if err != nil {
+			return removed, errors.AddContext(err, "failed to merge duplicates")
+		}
+		res, err := db.staticSkylinks.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": remove}})
+		if err != nil {
+			return removed, errors.AddContext(err, "failed to remove duplicates")
+		}
+		removed += int(res.DeletedCount)
+	}
+	if removed > 0 {
+		db.bumpBlocklistRevision(ctx)
+	}
+	return removed, nil
+}
+
+// Connected returns whether the database is connected. It only ever returns
+// false when the database was started in degraded mode and has not been able
+// to connect to the database server yet.
+func (db *DB) Connected() bool {
+	db.staticMu.Lock()
+	defer db.staticMu.Unlock()
+	return db.connected
+}
+
+// AcquireSweepLease tries to acquire the sweep lease for the instance with the
+// given id. The lease is acquired if it's not held by anyone, if it's already
+// held by the given instance or if it expired. It returns whether the lease is
+// held by the given instance, in which case it's valid for the given ttl.
+func (db *DB) AcquireSweepLease(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"name": leaseSweep,
+		"$or": bson.A{
+			bson.M{"holder": id},
+			bson.M{"expires": bson.M{"$lte": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"name":    leaseSweep,
+			"holder":  id,
+			"expires": now.Add(ttl),
+		},
+	}
+
+	// if the lease is held by another instance the upsert tries to insert a
+	// new lease, which fails due to the unique index on the lease's name
+	opts := options.Update().SetUpsert(true)
+	_, err := db.staticLeases.UpdateOne(ctx, filter, update, opts)
+	if isDuplicateKey(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// AddV2Pointer records that the V2 skylink with the given hash resolved to the
+// blocked skylink with the given hash. This ensures all V2 skylinks that
+// resolve to the same V1 skylink are collapsed into a single blocked skylink,
+// while keeping track of the V2 skylinks that were reported. A V2 pointer is
+// only recorded once per blocked skylink, recording it again updates the time
+// it was resolved at. A V2 skylink can be updated to point elsewhere, so the
+// pointers to it that other blocked skylinks hold are removed, otherwise the
+// V2 skylink would remain blocked by the content it used to point to. If
+// there's no blocked skylink for the given hash, ErrNoDocumentsFound is
+// returned.
+func (db *DB) AddV2Pointer(ctx context.Context, hash, v2Hash Hash) error {
+	doc, err := db.FindByHash(ctx, hash)
+	if err != nil {
+		return err
+	}
+	if doc == nil {
+		return ErrNoDocumentsFound
+	}
+
+	// remove the stale pointers
+	_, err = db.staticSkylinks.UpdateMany(ctx, bson.M{
+		"hash":             bson.M{"$ne": hash},
+		"v2_pointers.hash": v2Hash,
+	}, bson.M{
+		"$pull": bson.M{"v2_pointers": bson.M{"hash": v2Hash}},
+	})
+	if err != nil {
+		return errors.AddContext(err, "failed to remove stale V2 pointers")
+	}
+
+	// update the time the pointer was resolved at if it exists already
+	now := time.Now().UTC()
+	res, err := db.staticSkylinks.UpdateOne(ctx, bson.M{
+		"hash":             hash,
+		"v2_pointers.hash": v2Hash,
+	}, bson.M{
+		"$set": bson.M{"v2_pointers.$.timestamp_resolved": now},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 1 {
+		db.bumpBlocklistRevision(ctx)
+		return nil
+	}
+
+	// otherwise add it, the filter guards against a concurrent insert
+	_, err = db.staticSkylinks.UpdateOne(ctx, bson.M{
+		"hash":             hash,
+		"v2_pointers.hash": bson.M{"$ne": v2Hash},
+	}, bson.M{
+		"$push": bson.M{
+			"v2_pointers": V2Pointer{
+				Hash:              v2Hash,
+				TimestampResolved: now,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	db.bumpBlocklistRevision(ctx)
+	return nil
+}
+
+// SetMetadata records the given metadata on the blocked skylink with the given
+// hash, overwriting any metadata that was recorded before. If there's no
+// blocked skylink for the given hash, ErrNoDocumentsFound is returned.
+func (db *DB) SetMetadata(ctx context.Context, hash Hash, metadata SkylinkMetadata) error {
+	res, err := db.staticSkylinks.UpdateOne(ctx, bson.M{"hash": hash}, bson.M{
+		"$set": bson.M{"metadata": metadata},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNoDocumentsFound
+	}
+	return nil
+}
+
+// BlockHistory returns the lifecycle of the blocked skylink that corresponds to
+// the given hash, in the order in which the events happened. If the skylink
+// does not exist it returns ErrNoDocumentsFound.
+func (db *DB) BlockHistory(ctx context.Context, hash Hash) ([]BlockEvent, error) {
+	doc, err := db.FindByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, ErrNoDocumentsFound
+	}
+
+	// skylinks that were blocked before we kept track of their history have
+	// no events, for those we reconstruct it from their timestamps
+	if len(doc.History) == 0 {
+		history := []BlockEvent{{
+			Type:      BlockEventBlocked,
+			Timestamp: doc.TimestampAdded,
+		}}
+		if doc.Reverted {
+			history = append(history, BlockEvent{
+				Type:      BlockEventUnblocked,
+				Reason:    doc.RevertedReason,
+				Timestamp: doc.TimestampReverted,
+			})
+		}
+		return history, nil
+	}
+	return doc.History, nil
+}
+
 // CreateBlockedSkylink creates a new skylink. If the skylink already exists it
-// returns ErrSkylinkExists.
+// returns ErrSkylinkExists, unless it was unblocked, in which case it gets
+// blocked again. If it already exists, its tags and reporter are merged into
+// the existing skylink.
 func (db *DB) CreateBlockedSkylink(ctx context.Context, skylink *BlockedSkylink) error {
 	// Ensure the given object has all required properties set
 	err := skylink.Validate()
@@ -219,24 +993,50 @@ func (db *DB) CreateBlockedSkylink(ctx context.Context, skylink *BlockedSkylink)
 		return errors.AddContext(err, "unexpected blocked skylink")
 	}
 
-	// Insert the skylink
+	// Assign a report ID if the caller did not supply one
+	if skylink.ReportID == "" {
+		skylink.ReportID = NewReportID()
+	}
+
+	// Record the block event
+	skylink.History = []BlockEvent{{
+		Type:       BlockEventBlocked,
+		LegalBasis: skylink.LegalBasis,
+		ReportID:   skylink.ReportID,
+		Timestamp:  skylink.TimestampAdded,
+	}}
+
+	// Insert the skylink, if it already exists we merge the report into the
+	// existing skylink
 	_, err = db.staticSkylinks.InsertOne(ctx, skylink)
 	if isDuplicateKey(err) {
-		return ErrSkylinkExists
+		_, err = db.staticSkylinks.UpdateOne(ctx, bson.M{"hash": skylink.Hash}, db.mergeReportUpdate(*skylink))
+		if err != nil {
+			return errors.AddContext(err, "failed to merge report")
+		}
+		return db.reblock(ctx, skylink)
 	}
 	if err != nil {
 		db.staticLogger.Debugf("CreateBlockedSkylink: mongodb error '%v'", err)
 		return err
 	}
+	db.bumpBlocklistRevision(ctx)
 	return nil
 }
 
 // CreateBlockedSkylinkBulk creates new blocked skylinks in bulk. It returns the
-// number of created entries.
+// number of created entries, skylinks that already exist are skipped without
+// aborting the rest of the insert. Like CreateBlockedSkylink, skylinks that
+// were unblocked are blocked again, these count as created entries.
 func (db *DB) CreateBlockedSkylinkBulk(ctx context.Context, skylinks []BlockedSkylink) (int, error) {
 	// Convenience variables
 	logger := db.staticLogger
 
+	// return early if no skylinks were given
+	if len(skylinks) == 0 {
+		return 0, nil
+	}
+
 	// Ensure all required properties are set on the given blocked skylinks
 	for _, skylink := range skylinks {
 		err := skylink.Validate()
@@ -245,9 +1045,19 @@ func (db *DB) CreateBlockedSkylinkBulk(ctx context.Context, skylinks []BlockedSk
 		}
 	}
 
-	// Convert the given array to an interface array
+	// Convert the given array to an interface array, assigning a report ID
+	// and recording the block event on every document
 	docs := make([]interface{}, len(skylinks))
 	for i, doc := range skylinks {
+		if doc.ReportID == "" {
+			doc.ReportID = NewReportID()
+		}
+		doc.History = []BlockEvent{{
+			Type:       BlockEventBlocked,
+			LegalBasis: doc.LegalBasis,
+			ReportID:   doc.ReportID,
+			Timestamp:  doc.TimestampAdded,
+		}}
 		docs[i] = doc
 	}
 
@@ -258,16 +1068,52 @@ func (db *DB) CreateBlockedSkylinkBulk(ctx context.Context, skylinks []BlockedSk
 	opts.SetOrdered(false)
 
 	// Insert all objects in the database
-	res, err := db.staticSkylinks.InsertMany(ctx, docs, opts)
+	res, insertErr := db.staticSkylinks.InsertMany(ctx, docs, opts)
 
 	// Handle the error, we want to ignore all duplicate key errors
-	err = ignoreDuplicateKeyErrors(err)
+	err := ignoreDuplicateKeyErrors(insertErr)
 	if err != nil {
 		logger.Debugf("CreateBlockedSkylinkBulk: mongodb error '%v'", err)
 		return 0, err
 	}
 
-	return len(res.InsertedIDs), nil
+	// Merge the reports of the skylinks that already existed into the
+	// existing skylinks
+	var merges []mongo.WriteModel
+	var duplicates []BlockedSkylink
+	if bwe, ok := insertErr.(mongo.BulkWriteException); ok {
+		for _, we := range bwe.WriteErrors {
+			skylink := docs[we.Index].(BlockedSkylink)
+			duplicates = append(duplicates, skylink)
+			merges = append(merges, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"hash": skylink.Hash}).
+				SetUpdate(db.mergeReportUpdate(skylink)))
+		}
+	}
+	if len(merges) > 0 {
+		_, err = db.staticSkylinks.BulkWrite(ctx, merges, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return 0, errors.AddContext(err, "failed to merge reports")
+		}
+	}
+
+	// Block the skylinks that were unblocked again
+	created := len(res.InsertedIDs)
+	for i := range duplicates {
+		err = db.reblock(ctx, &duplicates[i])
+		if errors.Contains(err, ErrSkylinkExists) {
+			continue
+		}
+		if err != nil {
+			return created, errors.AddContext(err, "failed to reblock skylink")
+		}
+		created++
+	}
+
+	if len(res.InsertedIDs) > 0 {
+		db.bumpBlocklistRevision(ctx)
+	}
+	return created, nil
 }
 
 // CreateAllowListedSkylink creates a new allowlisted skylink. If the skylink
@@ -284,92 +1130,951 @@ func (db *DB) CreateAllowListedSkylink(ctx context.Context, skylink *AllowListed
 // FindByHash fetches the DB record that corresponds to the given hash
 // from the database.
 func (db *DB) FindByHash(ctx context.Context, hash Hash) (*BlockedSkylink, error) {
-	return db.findOne(ctx, bson.M{"hash": hash.String()})
+	return db.findOne(ctx, bson.M{"hash": CanonicalHash(hash)})
+}
+
+// FindByHashes fetches the DB records that correspond to the given hashes,
+// hashes for which no record exists are omitted.
+func (db *DB) FindByHashes(ctx context.Context, hashes []Hash) ([]BlockedSkylink, error) {
+	// return early if no hashes were given
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+	return db.find(ctx, bson.M{"hash": bson.M{"$in": hashes}})
+}
+
+// InsertSweepStats inserts the statistics of a sweep. These statistics are
+// diagnostic data and expire after the configured retention period.
+func (db *DB) InsertSweepStats(ctx context.Context, stats SweepStats) error {
+	_, err := db.staticSweepStats.InsertOne(ctx, stats)
+	return err
+}
+
+// IsBlocked returns whether the given hash is blocked. The hash is either the
+// hash of a V1 skylink or the hash of a V2 skylink that was recorded as a
+// pointer to a blocked V1 skylink. Skylinks that were unblocked or deemed
+// invalid are not considered blocked. Both lookups are covered by an index.
+func (db *DB) IsBlocked(ctx context.Context, hash Hash) (bool, error) {
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"hash": hash},
+			bson.M{"v2_pointers.hash": hash},
+		},
+		"invalid":  bson.M{"$ne": true},
+		"reverted": bson.M{"$ne": true},
+	}
+	opts := options.FindOne().SetProjection(bson.M{"_id": 1})
+	res := db.staticSkylinks.FindOne(ctx, filter, opts)
+	if isDocumentNotFound(res.Err()) {
+		return false, nil
+	}
+	if res.Err() != nil {
+		return false, res.Err()
+	}
+	return true, nil
+}
+
+// BlockedByHashPrefix returns the blocked skylinks whose hash starts with the
+// given hex encoded prefix, at most maxHashPrefixMatches are returned. The
+// prefix has to be at least MinHashPrefixLength characters long. Hashes are
+// stored as lowercase hex, an anchored prefix match is therefore a range scan
+// on the index on the hash. Skylinks that were unblocked or deemed invalid are
+// not considered blocked, test records are excluded.
+func (db *DB) BlockedByHashPrefix(ctx context.Context, prefix string) ([]BlockedSkylink, error) {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) < MinHashPrefixLength || len(prefix) > 2*crypto.HashSize {
+		return nil, errors.AddContext(ErrInvalidHashPrefix, fmt.Sprintf("prefix must be between %d and %d characters long", MinHashPrefixLength, 2*crypto.HashSize))
+	}
+	if strings.Trim(prefix, "0123456789abcdef") != "" {
+		return nil, errors.AddContext(ErrInvalidHashPrefix, "prefix must be hex encoded")
+	}
+
+	filter := blockedHashesFilter(false)
+	filter["hash"] = primitive.Regex{Pattern: "^" + prefix}
+	opts := options.Find()
+	opts.SetSort(bson.M{"hash": 1})
+	opts.SetLimit(maxHashPrefixMatches)
+	return db.find(ctx, filter, opts)
+}
+
+// AllowListedHashes returns which of the given hashes are on the allow list,
+// using a single query.
+func (db *DB) AllowListedHashes(ctx context.Context, hashes []Hash) (map[Hash]struct{}, error) {
+	// return early if no hashes were given
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	opts := options.Find()
+	opts.SetProjection(bson.M{"hash": 1})
+	c, err := db.staticAllowList.Find(ctx, bson.M{"hash": bson.M{"$in": hashes}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []AllowListedSkylink
+	err = c.All(ctx, &docs)
+	if err != nil {
+		return nil, err
+	}
+
+	allowListed := make(map[Hash]struct{}, len(docs))
+	for _, doc := range docs {
+		allowListed[doc.Hash] = struct{}{}
+	}
+	return allowListed, nil
+}
+
+// IsAllowListed returns whether the given skylink is on the allow list.
+func (db *DB) IsAllowListed(ctx context.Context, hash crypto.Hash) (bool, error) {
+	res := db.staticAllowList.FindOne(ctx, bson.M{"hash": CanonicalHash(Hash{hash})})
+	if isDocumentNotFound(res.Err()) {
+		return false, nil
+	}
+	if res.Err() != nil {
+		return false, res.Err()
+	}
+	return true, nil
+}
+
+// LatestTimestampAdded returns the most recent timestamp at which one of the
+// given hashes was added. The zero time is returned if none of the hashes
+// were found.
+func (db *DB) LatestTimestampAdded(ctx context.Context, hashes []Hash) (time.Time, error) {
+	opts := options.FindOne()
+	opts.SetProjection(bson.M{"timestamp_added": 1})
+	opts.SetSort(bson.M{"timestamp_added": -1})
+	res := db.staticSkylinks.FindOne(ctx, bson.M{"hash": bson.M{"$in": hashes}}, opts)
+	if isDocumentNotFound(res.Err()) {
+		return time.Time{}, nil
+	}
+	if res.Err() != nil {
+		return time.Time{}, res.Err()
+	}
+
+	var doc struct {
+		TimestampAdded time.Time `bson:"timestamp_added"`
+	}
+	err := res.Decode(&doc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return doc.TimestampAdded, nil
+}
+
+// LatestBlockedTimestampAdded returns the most recent time at which a skylink
+// that got blocked was added. If no skylink got blocked yet, the zero time is
+// returned.
+func (db *DB) LatestBlockedTimestampAdded(ctx context.Context) (time.Time, error) {
+	opts := options.FindOne()
+	opts.SetProjection(bson.M{"timestamp_added": 1})
+	opts.SetSort(bson.M{"timestamp_added": -1})
+	res := db.staticSkylinks.FindOne(ctx, bson.M{"blocked_at": bson.M{"$exists": true}}, opts)
+	if isDocumentNotFound(res.Err()) {
+		return time.Time{}, nil
+	}
+	if res.Err() != nil {
+		return time.Time{}, res.Err()
+	}
+
+	var doc struct {
+		TimestampAdded time.Time `bson:"timestamp_added"`
+	}
+	err := res.Decode(&doc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return doc.TimestampAdded, nil
+}
+
+// LatestBlockTimestamp returns the latest block timestamp for the given skyd
+// target. If no timestamp was ever set for the target, the zero time is
+// returned, causing the blocker to sweep the entire database.
+func (db *DB) LatestBlockTimestamp(ctx context.Context, target string) (time.Time, error) {
+	res := db.staticLatestBlockTimestamps.FindOne(ctx, bson.M{"target": target})
+	if isDocumentNotFound(res.Err()) {
+		return time.Time{}, nil
+	}
+	if res.Err() != nil {
+		return time.Time{}, res.Err()
+	}
+
+	var lbt latestBlockTimestamp
+	err := res.Decode(&lbt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return lbt.Timestamp, nil
+}
+
+// MarkFailed will mark the given documents as failed
+func (db *DB) MarkFailed(ctx context.Context, hashes []Hash) error {
+	return db.updateFailedFlag(ctx, hashes, true)
+}
+
+// MarkPortalFailed records that the given hashes failed to get blocked on the
+// downstream portal with the given URL, the retry loop retries them.
+func (db *DB) MarkPortalFailed(ctx context.Context, hashes []Hash, portalURL string) error {
+	return db.updatePortalsFailed(ctx, hashes, bson.M{
+		"$addToSet": bson.M{"portals_failed": portalURL},
+	})
+}
+
+// MarkPortalSucceeded records that the given hashes got blocked on the
+// downstream portal with the given URL.
+func (db *DB) MarkPortalSucceeded(ctx context.Context, hashes []Hash, portalURL string) error {
+	return db.updatePortalsFailed(ctx, hashes, bson.M{
+		"$pull": bson.M{"portals_failed": portalURL},
+	})
+}
+
+// MarkInvalid will mark the given documents as invalid
+func (db *DB) MarkInvalid(ctx context.Context, hashes []Hash) error {
+	// return early if no hashes were given
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	// create the filter
+	filter := bson.M{
+		"hash": bson.M{"$in": hashes},
+	}
+
+	// define the update
+	update := bson.M{
+		"$set": bson.M{
+			"invalid": True,
+		},
+	}
+
+	// perform the update
+	return db.updateBlocklist(ctx, filter, update)
+}
+
+// MarkSucceeded will mark the given documents as blocked, this is called when
+// skyd confirmed the hashes got blocked. It toggles the failed flag for all
+// documents that are currently marked as failed and sets the time at which
+// they got blocked to the given time, which is the time skyd confirmed the
+// block. This ensures they're skipped by subsequent sweeps.
+func (db *DB) MarkSucceeded(ctx context.Context, hashes []Hash, blockedAt time.Time) error {
+	// return early if no hashes were given
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	// create the filter, we never update invalid documents
+	filter := bson.M{
+		"hash":    bson.M{"$in": hashes},
+		"invalid": bson.M{"$ne": true},
+	}
+
+	// define the update, skylinks that were skipped by the blocker's
+	// pre-block policy might have been blocked on demand
+	update := bson.M{
+		"$set": bson.M{
+			"blocked_at": blockedAt.UTC(),
+			"failed":     false,
+		},
+		"$unset": bson.M{
+			"skipped":        "",
+			"skipped_reason": "",
+		},
+	}
+
+	// perform the update
+	return db.updateBlocklist(ctx, filter, update)
+}
+
+// MarkUnverified marks the given hashes as failed after skyd accepted their
+// block but they turned out to be missing from its blocklist. The time they
+// were blocked at is cleared and the given reason is recorded in their
+// history, the retry loop picks them up like any other failed hash.
+func (db *DB) MarkUnverified(ctx context.Context, hashes []Hash, reason string) error {
+	// return early if no hashes were given
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	filter := bson.M{
+		"hash":     bson.M{"$in": hashes},
+		"invalid":  bson.M{"$ne": true},
+		"reverted": bson.M{"$ne": true},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"failed": true,
+		},
+		"$unset": bson.M{
+			"blocked_at": "",
+		},
+		"$push": bson.M{
+			"history": BlockEvent{
+				Type:      BlockEventUnverified,
+				Reason:    reason,
+				Timestamp: time.Now().UTC(),
+			},
+		},
+	}
+	return db.updateBlocklist(ctx, filter, update)
+}
+
+// MarkSkipped marks the skylink that corresponds to the given hash as skipped,
+// recording the reason why the blocker's pre-block policy decided it should
+// not be blocked. Skipped skylinks are ignored by the sweeps, they can still
+// be blocked on demand. If there's no pending skylink for the given hash,
+// ErrNoDocumentsFound is returned.
+func (db *DB) MarkSkipped(ctx context.Context, hash Hash, reason string) error {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"hash":       hash,
+		"blocked_at": bson.M{"$exists": false},
+		"reverted":   bson.M{"$ne": true},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"failed":         false,
+			"skipped":        true,
+			"skipped_reason": reason,
+		},
+		"$push": bson.M{
+			"history": BlockEvent{
+				Type:      BlockEventSkipped,
+				Reason:    reason,
+				Timestamp: now,
+			},
+		},
+	}
+	res, err := db.staticSkylinks.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNoDocumentsFound
+	}
+	return nil
+}
+
+// Ping sends a ping command to verify that the client can connect to the DB and
+// specifically to the primary.
+func (db *DB) Ping(ctx context.Context) error {
+	return db.staticDB.Client().Ping(ctx, readpref.Primary())
+}
+
+// QuarantineMalformed marks all skylinks that would be picked up by the
+// sweeps, but that have a missing, empty or otherwise malformed hash, as
+// invalid. These skylinks can't be blocked, and marking them as invalid
+// ensures they are not fetched over and over again. It returns the number of
+// skylinks that got quarantined.
+func (db *DB) QuarantineMalformed(ctx context.Context, from time.Time) (int, error) {
+	// NOTE: $ne: true is not the same as $eq: false
+	filter := bson.M{
+		"invalid":  bson.M{"$ne": true},
+		"reverted": bson.M{"$ne": true},
+		"skipped":  bson.M{"$ne": true},
+		"$and": bson.A{
+			// match the skylinks that the sweeps pick up
+			bson.M{"$or": bson.A{
+				bson.M{
+					"blocked_at":      bson.M{"$exists": false},
+					"timestamp_added": bson.M{"$gte": from.Add(-db.staticSweepLookback)},
+				},
+				bson.M{"failed": true},
+			}},
+			// match the malformed hashes
+			bson.M{"$or": bson.A{
+				bson.M{"hash": bson.M{"$not": hashRegex}},
+				bson.M{"hash": emptyHash},
+			}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"failed":  false,
+			"invalid": true,
+		},
+	}
+	res, err := db.staticSkylinks.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	if res.ModifiedCount > 0 {
+		db.bumpBlocklistRevision(ctx)
+	}
+	return int(res.ModifiedCount), nil
+}
+
+// Drop drops the database, or only the collections of the tenant if the
+// database is shared with other blockers.
+//
+// NOTE: this function should never be called in production, it's used to clean
+// up scratch databases
+func (db *DB) Drop(ctx context.Context) error {
+	if db.staticTenant == "" {
+		return db.staticDB.Drop(ctx)
+	}
+	var err error
+	for _, coll := range []*mongo.Collection{
+		db.staticAllowList,
+		db.staticDisabledSources,
+		db.staticLatestBlockTimestamps,
+		db.staticLeases,
+		db.staticMigrations,
+		db.staticRevisions,
+		db.staticSkylinks,
+		db.staticSnapshots,
+		db.staticSourceCheckpoints,
+		db.staticSweepStats,
+	} {
+		err = errors.Compose(err, coll.Drop(ctx))
+	}
+	return err
+}
+
+// Purge deletes all documents from all collections in the database
+//
+// NOTE: this function should never be called in production and should only be
+// used for testing purposes
+func (db *DB) Purge(ctx context.Context) error {
+	_, err := db.staticSkylinks.DeleteMany(ctx, bson.D{})
+	if err != nil {
+		return errors.AddContext(err, "failed to purge skylinks collection")
+	}
+	_, err = db.staticAllowList.DeleteMany(ctx, bson.D{})
+	if err != nil {
+		return errors.AddContext(err, "failed to purge allowlist collection")
+	}
+	_, err = db.staticLatestBlockTimestamps.DeleteMany(ctx, bson.D{})
+	if err != nil {
+		return errors.AddContext(err, "failed to purge latest block timestamps collection")
+	}
+	_, err = db.staticLeases.DeleteMany(ctx, bson.D{})
+	if err != nil {
+		return errors.AddContext(err, "failed to purge leases collection")
+	}
+	_, err = db.staticMigrations.DeleteMany(ctx, bson.D{})
+	if err != nil {
+		return errors.AddContext(err, "failed to purge migrations collection")
+	}
+	_, err = db.staticSweepStats.DeleteMany(ctx, bson.D{})
+	if err != nil {
+		return errors.AddContext(err, "failed to purge sweep stats collection")
+	}
+	_, err = db.staticSourceCheckpoints.DeleteMany(ctx, bson.D{})
+	if err != nil {
+		return errors.AddContext(err, "failed to purge source checkpoints collection")
+	}
+	_, err = db.staticDisabledSources.DeleteMany(ctx, bson.D{})
+	if err != nil {
+		return errors.AddContext(err, "failed to purge disabled sources collection")
+	}
+	_, err = db.staticSnapshots.DeleteMany(ctx, bson.D{})
+	if err != nil {
+		return errors.AddContext(err, "failed to purge snapshots collection")
+	}
+	_, err = db.staticRevisions.DeleteMany(ctx, bson.D{})
+	if err != nil {
+		return errors.AddContext(err, "failed to purge revisions collection")
+	}
+	return nil
+}
+
+// PurgeTestRecords deletes all skylinks that were reported as test records,
+// e.g. after validating an integration. It returns the number of deleted
+// records. Note that the hashes are not unblocked in skyd.
+func (db *DB) PurgeTestRecords(ctx context.Context) (int, error) {
+	res, err := db.staticSkylinks.DeleteMany(ctx, bson.M{"test": true})
+	if err != nil {
+		return 0, err
+	}
+	if res.DeletedCount > 0 {
+		db.bumpBlocklistRevision(ctx)
+	}
+	return int(res.DeletedCount), nil
+}
+
+// ReleaseSweepLease releases the sweep lease if it's held by the instance with
+// the given id, allowing another instance to acquire it without having to wait
+// for it to expire.
+func (db *DB) ReleaseSweepLease(ctx context.Context, id string) error {
+	_, err := db.staticLeases.DeleteOne(ctx, bson.M{
+		"name":   leaseSweep,
+		"holder": id,
+	})
+	return err
+}
+
+// RenewSweepLease extends the sweep lease held by the instance with the given
+// id by the given ttl. It returns false if the lease is no longer held by the
+// given instance, which means another instance took over after it expired.
+func (db *DB) RenewSweepLease(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	filter := bson.M{
+		"name":   leaseSweep,
+		"holder": id,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"expires": time.Now().UTC().Add(ttl),
+		},
+	}
+	res, err := db.staticLeases.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// SourceCheckpoint returns the checkpoint of the given report source. If the
+// source has no checkpoint yet, an empty string is returned.
+func (db *DB) SourceCheckpoint(ctx context.Context, source string) (string, error) {
+	res := db.staticSourceCheckpoints.FindOne(ctx, bson.M{"source": source})
+	if isDocumentNotFound(res.Err()) {
+		return "", nil
+	}
+	if res.Err() != nil {
+		return "", res.Err()
+	}
+
+	var sc sourceCheckpoint
+	err := res.Decode(&sc)
+	if err != nil {
+		return "", err
+	}
+	return sc.Checkpoint, nil
+}
+
+// ReportIDs returns the report IDs of the blocked skylinks that correspond to
+// the given hashes. Hashes for which no blocked skylink exists, or which have no
+// report ID, are omitted from the returned map.
+func (db *DB) ReportIDs(ctx context.Context, hashes []Hash) (map[Hash]string, error) {
+	// return early if no hashes were given
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	opts := options.Find()
+	opts.SetProjection(bson.M{"hash": 1, "report_id": 1})
+	docs, err := db.find(ctx, bson.M{"hash": bson.M{"$in": hashes}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	reportIDs := make(map[Hash]string, len(docs))
+	for _, doc := range docs {
+		if doc.ReportID != "" {
+			reportIDs[doc.Hash] = doc.ReportID
+		}
+	}
+	return reportIDs, nil
+}
+
+// LegalBases returns the legal bases of the blocked skylinks that correspond to
+// the given hashes. Hashes for which no blocked skylink exists, or which have
+// no legal basis, are omitted from the returned map.
+func (db *DB) LegalBases(ctx context.Context, hashes []Hash) (map[Hash]string, error) {
+	// return early if no hashes were given
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	opts := options.Find()
+	opts.SetProjection(bson.M{"hash": 1, "legal_basis": 1})
+	docs, err := db.find(ctx, bson.M{"hash": bson.M{"$in": hashes}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	legalBases := make(map[Hash]string, len(docs))
+	for _, doc := range docs {
+		if doc.LegalBasis != "" {
+			legalBases[doc.Hash] = doc.LegalBasis
+		}
+	}
+	return legalBases, nil
+}
+
+// Sources returns the sources of the blocked skylinks that correspond to the
+// given hashes, the source is the name of the reporter. Hashes for which no
+// blocked skylink exists are omitted from the returned map.
+func (db *DB) Sources(ctx context.Context, hashes []Hash) (map[Hash]string, error) {
+	// return early if no hashes were given
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	opts := options.Find()
+	opts.SetProjection(bson.M{"hash": 1, "reporter.name": 1})
+	docs, err := db.find(ctx, bson.M{"hash": bson.M{"$in": hashes}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[Hash]string, len(docs))
+	for _, doc := range docs {
+		sources[doc.Hash] = doc.Reporter.Name
+	}
+	return sources, nil
+}
+
+// BlockedBySource returns the skylinks that are currently blocked and were
+// reported by the given source, either as the first reporter or as one of the
+// reporters whose report got merged into the skylink. Only the hash and the
+// reporters of the skylinks are fetched.
+func (db *DB) BlockedBySource(ctx context.Context, source string) ([]BlockedSkylink, error) {
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"reporter.name": source},
+			bson.M{"reporters.name": source},
+		},
+		"blocked_at": bson.M{"$exists": true},
+		"invalid":    bson.M{"$ne": true},
+		"reverted":   bson.M{"$ne": true},
+	}
+	opts := options.Find()
+	opts.SetProjection(bson.M{"hash": 1, "reporter": 1, "reporters": 1})
+	return db.find(ctx, filter, opts)
+}
+
+// MarkSourceRevoked records in the history of the skylinks that correspond to
+// the given hashes that one of the sources that reported them got revoked,
+// along with the given reason. The skylinks themselves are left untouched.
+func (db *DB) MarkSourceRevoked(ctx context.Context, hashes []Hash, reason string) error {
+	// return early if no hashes were given
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	filter := bson.M{"hash": bson.M{"$in": hashes}}
+	update := bson.M{
+		"$push": bson.M{
+			"history": BlockEvent{
+				Type:      BlockEventSourceRevoked,
+				Reason:    reason,
+				Timestamp: time.Now().UTC(),
+			},
+		},
+	}
+	_, err := db.staticSkylinks.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// SetSourceCheckpoint updates the checkpoint of the given report source,
+// creating the document if it does not exist yet.
+func (db *DB) SetSourceCheckpoint(ctx context.Context, source, checkpoint string) error {
+	filter := bson.M{"source": source}
+	update := bson.M{
+		"$set": bson.M{
+			"source":     source,
+			"checkpoint": checkpoint,
+		},
+	}
+	opts := options.Update().SetUpsert(true)
+	_, err := db.staticSourceCheckpoints.UpdateOne(ctx, filter, update, opts)
+	return err
+}
+
+// SetLatestBlockTimestamp updates the latest block timestamp for the given skyd
+// target, creating the document if it does not exist yet. Transient errors,
+// e.g. caused by a replica set election, are retried with a short backoff.
+func (db *DB) SetLatestBlockTimestamp(ctx context.Context, target string, latest time.Time) error {
+	filter := bson.M{"target": target}
+	update := bson.M{
+		"$set": bson.M{
+			"target":    target,
+			"timestamp": latest,
+		},
+	}
+	opts := options.Update().SetUpsert(true)
+	return retryTransient(ctx, timestampWriteAttempts, timestampWriteBackoff, func() error {
+		_, err := db.staticLatestBlockTimestamps.UpdateOne(ctx, filter, update, opts)
+		return err
+	})
+}
+
+// SwapLatestBlockTimestamp updates the latest block timestamp for the given
+// skyd target, but only if it's still at the given old timestamp, where the
+// zero time means it was never set. It returns false if the timestamp changed
+// in the meantime, e.g. because it got rewound, in which case it's left
+// untouched. Transient errors are retried with a short backoff.
+func (db *DB) SwapLatestBlockTimestamp(ctx context.Context, target string, old, latest time.Time) (bool, error) {
+	filter := bson.M{
+		"target":    target,
+		"timestamp": old.UTC().Truncate(time.Millisecond),
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"target":    target,
+			"timestamp": latest,
+		},
+	}
+	opts := options.Update().SetUpsert(true)
+
+	var swapped bool
+	err := retryTransient(ctx, timestampWriteAttempts, timestampWriteBackoff, func() error {
+		res, err := db.staticLatestBlockTimestamps.UpdateOne(ctx, filter, update, opts)
+		if isDuplicateKey(err) {
+			// the target's document exists but holds another timestamp
+			swapped = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		swapped = res.MatchedCount > 0 || res.UpsertedCount > 0
+		return nil
+	})
+	return swapped, err
+}
+
+// Unblock marks the blocked skylink that corresponds to the given hash as
+// unblocked, recording the reason why it got unblocked. The record is never
+// deleted, this ensures we keep the full history of the skylink. If there's no
+// blocked skylink for the given hash, ErrNoDocumentsFound is returned.
+func (db *DB) Unblock(ctx context.Context, hash Hash, reason string) error {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"hash":     hash,
+		"reverted": bson.M{"$ne": true},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"reverted":           true,
+			"reverted_reason":    reason,
+			"timestamp_reverted": now,
+		},
+		"$unset": bson.M{
+			"blocked_at": "",
+		},
+		"$push": bson.M{
+			"history": BlockEvent{
+				Type:      BlockEventUnblocked,
+				Reason:    reason,
+				Timestamp: now,
+			},
+		},
+	}
+	res, err := db.staticSkylinks.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNoDocumentsFound
+	}
+	db.bumpBlocklistRevision(ctx)
+	return nil
+}
+
+// CancelPending cancels the block of the given hash, if it was not sent to
+// skyd yet. This allows cancelling skylinks that are held back by the block
+// delay. If the hash is unknown, or it got blocked already, ErrNoDocumentsFound
+// is returned and it has to be unblocked instead.
+func (db *DB) CancelPending(ctx context.Context, hash Hash, reason string) error {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"hash":       hash,
+		"blocked_at": bson.M{"$exists": false},
+		"reverted":   bson.M{"$ne": true},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"failed":             false,
+			"reverted":           true,
+			"reverted_reason":    reason,
+			"timestamp_reverted": now,
+		},
+		"$push": bson.M{
+			"history": BlockEvent{
+				Type:      BlockEventCancelled,
+				Reason:    reason,
+				Timestamp: now,
+			},
+		},
+	}
+	res, err := db.staticSkylinks.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNoDocumentsFound
+	}
+	db.bumpBlocklistRevision(ctx)
+	return nil
+}
+
+// MaxBlockDelay returns the longest block delay, the sweep can't consider any
+// skylink that was added after now minus this delay processed.
+func (db *DB) MaxBlockDelay() time.Duration {
+	return db.staticBlockDelay.Max()
+}
+
+// HashesToBlock sweeps the database for unblocked hashes after the given
+// timestamp. Skylinks with a malformed hash are skipped, they are quarantined
+// by QuarantineMalformed. Skylinks that are held back by the block delay are
+// skipped as well, and so are the skylinks that were only reported by disabled
+// sources. The hashes are sorted by the time their skylink was added and then
+// by its id, so a given state of the database always yields the same order,
+// even if skylinks were added within the same second.
+func (db *DB) HashesToBlock(ctx context.Context, from time.Time) ([]Hash, error) {
+	filter, err := db.hashesToBlockFilter(ctx, wellFormedHash)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: the latest block timestamp is a coarse lower bound, the sweep
+	// looks back further than that, hashes that skyd confirmed are skipped
+	filter["timestamp_added"] = bson.M{"$gte": from.Add(-db.staticSweepLookback)}
+	return db.hashesToBlock(ctx, db.staticSweepSkylinks, filter, 1, 0)
 }
 
-// IsAllowListed returns whether the given skylink is on the allow list.
-func (db *DB) IsAllowListed(ctx context.Context, hash crypto.Hash) (bool, error) {
-	res := db.staticAllowList.FindOne(ctx, bson.M{"hash": hash.String()})
-	if isDocumentNotFound(res.Err()) {
-		return false, nil
+// RecentHashesToBlock returns up to limit hashes that HashesToBlock would
+// return regardless of the time their skylink was added, starting with the
+// skylink that was added most recently. It allows blocking the freshest
+// reports first when the sweeps have a backlog to work through.
+func (db *DB) RecentHashesToBlock(ctx context.Context, limit int) ([]Hash, error) {
+	if limit < 1 {
+		return nil, errors.New("limit has to be positive")
 	}
-	if res.Err() != nil {
-		return false, res.Err()
+	filter, err := db.hashesToBlockFilter(ctx, wellFormedHash)
+	if err != nil {
+		return nil, err
 	}
-	return true, nil
-}
-
-// MarkFailed will mark the given documents as failed
-func (db *DB) MarkFailed(ctx context.Context, hashes []Hash) error {
-	return db.updateFailedFlag(ctx, hashes, true)
+	return db.hashesToBlock(ctx, db.staticSweepSkylinks, filter, -1, int64(limit))
 }
 
-// MarkInvalid will mark the given documents as invalid
-func (db *DB) MarkInvalid(ctx context.Context, hashes []Hash) error {
+// PendingHashes returns those of the given hashes that HashesToBlock would
+// return, regardless of the time their skylink was added, in the same order.
+// It reads from the primary, which allows checking skylinks that were just
+// inserted.
+func (db *DB) PendingHashes(ctx context.Context, hashes []Hash) ([]Hash, error) {
 	// return early if no hashes were given
 	if len(hashes) == 0 {
-		return nil
+		return nil, nil
 	}
+	filter, err := db.hashesToBlockFilter(ctx, bson.M{
+		"$in":    hashes,
+		"$regex": hashRegex,
+		"$ne":    emptyHash,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return db.hashesToBlock(ctx, db.staticSkylinks, filter, 1, 0)
+}
 
-	// create the filter
+// hashesToBlockFilter returns the filter that matches the skylinks that have
+// to be blocked, the given condition is applied to their hash.
+func (db *DB) hashesToBlockFilter(ctx context.Context, hashCond bson.M) (bson.M, error) {
+	// NOTE: $ne: true is not the same as $eq: false
 	filter := bson.M{
-		"hash": bson.M{"$in": hashes},
+		"blocked_at": bson.M{"$exists": false},
+		"failed":     bson.M{"$ne": true},
+		"hash":       hashCond,
+		"invalid":    bson.M{"$ne": true},
+		"reverted":   bson.M{"$ne": true},
+		"skipped":    bson.M{"$ne": true},
 	}
-
-	// define the update
-	update := bson.M{
-		"$set": bson.M{
-			"invalid": True,
-		},
+	conditions := db.staticBlockDelay.filter(time.Now().UTC())
+	if threshold := db.staticReportThreshold.filter(); threshold != nil {
+		conditions = append(conditions, threshold)
+	}
+	if len(conditions) > 0 {
+		filter["$and"] = conditions
 	}
 
-	// perform the update
-	collSkylinks := db.staticDB.Collection(collSkylinks)
-	_, err := collSkylinks.UpdateMany(ctx, filter, update)
-	return err
+	// skip the skylinks that were only reported by disabled sources, they
+	// remain pending until the source is enabled again
+	disabled, err := db.DisabledSources(ctx)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to fetch disabled sources")
+	}
+	if len(disabled) > 0 {
+		filter["$or"] = enabledSourcesFilter(disabled)
+	}
+	return filter, nil
 }
 
-// MarkSucceeded will toggle the failed flag for all documents in the given
-// list of hashes that are currently marked as failed.
-func (db *DB) MarkSucceeded(ctx context.Context, hashes []Hash) error {
-	return db.updateFailedFlag(ctx, hashes, false)
-}
+// hashesToBlock returns the hashes of the skylinks in the given collection
+// that match the given filter, sorted by the time they were added and their
+// id in the given order. A limit of zero returns all hashes.
+func (db *DB) hashesToBlock(ctx context.Context, coll *mongo.Collection, filter bson.M, order int, limit int64) ([]Hash, error) {
+	opts := options.Find()
+	opts.SetProjection(bson.M{"hash": 1})
+	opts.SetSort(sortByTimestampAdded(order))
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
 
-// Ping sends a ping command to verify that the client can connect to the DB and
-// specifically to the primary.
-func (db *DB) Ping(ctx context.Context) error {
-	return db.staticDB.Client().Ping(ctx, readpref.Primary())
+	docs, err := findInColl(ctx, coll, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Extract the hashes
+	hashes := make([]Hash, len(docs))
+	for i, doc := range docs {
+		hashes[i] = doc.Hash
+	}
+	return hashes, nil
 }
 
-// Purge deletes all documents from all collections in the database
-//
-// NOTE: this function should never be called in production and should only be
-// used for testing purposes
-func (db *DB) Purge(ctx context.Context) error {
-	_, err := db.staticSkylinks.DeleteMany(ctx, bson.D{})
+// BlockedSkylinksInRange returns all blocked skylinks that were added in the
+// given time range, the start is inclusive and the end is exclusive. Skylinks
+// that were found to be invalid or got unblocked are excluded, test records
+// are only included if includeTest is set. Large ranges should be iterated
+// using ForEachBlockedSkylinkInRange instead.
+func (db *DB) BlockedSkylinksInRange(ctx context.Context, from, to time.Time, includeTest bool) ([]BlockedSkylink, error) {
+	skylinks := make([]BlockedSkylink, 0)
+	err := db.ForEachBlockedSkylinkInRange(ctx, from, to, includeTest, func(bsl BlockedSkylink) error {
+		skylinks = append(skylinks, bsl)
+		return nil
+	})
 	if err != nil {
-		return errors.AddContext(err, "failed to purge skylinks collection")
+		return nil, err
 	}
-	_, err = db.staticAllowList.DeleteMany(ctx, bson.D{})
+	return skylinks, nil
+}
+
+// ForEachBlockedSkylinkInRange calls the given function for every blocked
+// skylink that was added in the given time range, in the order they were
+// added. The skylinks are streamed from the database rather than loaded into
+// memory all at once. Iteration stops at the first error returned by the
+// given function. Test records are only iterated if includeTest is set.
+func (db *DB) ForEachBlockedSkylinkInRange(ctx context.Context, from, to time.Time, includeTest bool, fn func(BlockedSkylink) error) error {
+	opts := options.Find()
+	opts.SetSort(sortByTimestampAdded(1))
+
+	filter := blockedInRange(from, to)
+	if !includeTest {
+		filter["test"] = bson.M{"$ne": true}
+	}
+	c, err := db.staticSkylinks.Find(ctx, filter, opts)
 	if err != nil {
-		return errors.AddContext(err, "failed to purge allowlist collection")
+		return err
 	}
-	return nil
-}
+	defer c.Close(ctx)
 
-// HashesToBlock sweeps the database for unblocked hashes after the given
-// timestamp.
-func (db *DB) HashesToBlock(ctx context.Context, from time.Time) ([]Hash, error) {
-	// NOTE: $ne: true is not the same as $eq: false
-	filter := bson.M{
-		"timestamp_added": bson.M{"$gte": from},
-		"failed":          bson.M{"$ne": true},
-		"invalid":         bson.M{"$ne": true},
+	for c.Next(ctx) {
+		var bsl BlockedSkylink
+		err = c.Decode(&bsl)
+		if err != nil {
+			return err
+		}
+		err = fn(bsl)
+		if err != nil {
+			return err
+		}
 	}
+	return c.Err()
+}
+
+// HashesInRange returns the hashes of all blocked skylinks that were added in
+// the given time range, the start is inclusive and the end is exclusive.
+// Skylinks that were found to be invalid or got unblocked are excluded.
+func (db *DB) HashesInRange(ctx context.Context, from, to time.Time) ([]Hash, error) {
 	opts := options.Find()
 	opts.SetProjection(bson.M{"hash": 1})
+	opts.SetSort(sortByTimestampAdded(1))
 
-	docs, err := db.find(ctx, filter, opts)
+	docs, err := db.find(ctx, blockedInRange(from, to), opts)
 	if err != nil {
 		return nil, err
 	}
@@ -389,13 +2094,17 @@ func (db *DB) HashesToBlock(ctx context.Context, from time.Time) ([]Hash, error)
 func (db *DB) HashesToRetry(ctx context.Context) ([]Hash, error) {
 	// NOTE: $ne: true is not the same as $eq: false
 	filter := bson.M{
-		"failed":  bson.M{"$eq": true},
-		"invalid": bson.M{"$ne": true},
+		"failed":   bson.M{"$eq": true},
+		"hash":     wellFormedHash,
+		"invalid":  bson.M{"$ne": true},
+		"reverted": bson.M{"$ne": true},
+		"skipped":  bson.M{"$ne": true},
 	}
 	opts := options.Find()
 	opts.SetProjection(bson.M{"hash": 1})
+	opts.SetSort(sortByTimestampAdded(1))
 
-	docs, err := db.find(ctx, filter, opts)
+	docs, err := findInColl(ctx, db.staticSweepSkylinks, filter, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -408,11 +2117,58 @@ func (db *DB) HashesToRetry(ctx context.Context) ([]Hash, error) {
 	return hashes, nil
 }
 
+// HashesToRetryOnPortal returns the hashes that failed to get blocked on the
+// downstream portal with the given URL, in the order they were added. Skylinks
+// that were deemed invalid or got unblocked in the meantime are excluded.
+func (db *DB) HashesToRetryOnPortal(ctx context.Context, portalURL string) ([]Hash, error) {
+	filter := bson.M{
+		"portals_failed": portalURL,
+		"invalid":        bson.M{"$ne": true},
+		"reverted":       bson.M{"$ne": true},
+	}
+	opts := options.Find()
+	opts.SetProjection(bson.M{"hash": 1})
+	opts.SetSort(sortByTimestampAdded(1))
+
+	docs, err := findInColl(ctx, db.staticSweepSkylinks, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]Hash, len(docs))
+	for i, doc := range docs {
+		hashes[i] = doc.Hash
+	}
+	return hashes, nil
+}
+
 // find wraps the `Find` function on the Skylinks collection and returns an
 // array of decoded blocked skylink objects
 func (db *DB) find(ctx context.Context, filter interface{},
 	opts ...*options.FindOptions) ([]BlockedSkylink, error) {
-	c, err := db.staticDB.Collection(collSkylinks).Find(ctx, filter, opts...)
+	return findInColl(ctx, db.staticSkylinks, filter, opts...)
+}
+
+// blockedHashesFilter returns the filter that matches the blocked hashes that
+// are exposed on the blocklist, skylinks that were found to be invalid or got
+// unblocked are excluded, as are test records unless includeTest is set.
+func blockedHashesFilter(includeTest bool) bson.M {
+	filter := bson.M{
+		"invalid":  bson.M{"$ne": true},
+		"reverted": bson.M{"$ne": true},
+		"hash":     bson.M{"$exists": true},
+	}
+	if !includeTest {
+		filter["test"] = bson.M{"$ne": true}
+	}
+	return filter
+}
+
+// findInColl wraps the `Find` function on the given collection and returns an
+// array of decoded blocked skylink objects
+func findInColl(ctx context.Context, coll *mongo.Collection, filter interface{},
+	opts ...*options.FindOptions) ([]BlockedSkylink, error) {
+	c, err := coll.Find(ctx, filter, opts...)
 	if isDocumentNotFound(err) {
 		return nil, nil
 	}
@@ -432,7 +2188,7 @@ func (db *DB) find(ctx context.Context, filter interface{},
 // a decoded blocked skylink object
 func (db *DB) findOne(ctx context.Context, filter interface{},
 	opts ...*options.FindOneOptions) (*BlockedSkylink, error) {
-	sr := db.staticDB.Collection(collSkylinks).FindOne(ctx, filter, opts...)
+	sr := db.staticSkylinks.FindOne(ctx, filter, opts...)
 	if isDocumentNotFound(sr.Err()) {
 		return nil, nil
 	}
@@ -448,6 +2204,73 @@ func (db *DB) findOne(ctx context.Context, filter interface{},
 	return &sl, nil
 }
 
+// reblock is a helper method that blocks a skylink that was unblocked again.
+// The skylink's timestamp is updated to ensure it gets picked up by the next
+// sweep. If the skylink was not unblocked, ErrSkylinkExists is returned.
+func (db *DB) reblock(ctx context.Context, skylink *BlockedSkylink) error {
+	filter := bson.M{
+		"hash":     skylink.Hash,
+		"reverted": true,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"failed":          false,
+			"legal_basis":     skylink.LegalBasis,
+			"report_id":       skylink.ReportID,
+			"reverted":        false,
+			"timestamp_added": skylink.TimestampAdded,
+		},
+		"$unset": bson.M{
+			"blocked_at": "",
+		},
+		"$push": bson.M{
+			"history": BlockEvent{
+				Type:       BlockEventBlocked,
+				LegalBasis: skylink.LegalBasis,
+				ReportID:   skylink.ReportID,
+				Timestamp:  skylink.TimestampAdded,
+			},
+		},
+	}
+	res, err := db.staticSkylinks.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrSkylinkExists
+	}
+	db.bumpBlocklistRevision(ctx)
+	return nil
+}
+
+// V2PointersFor returns the V2 pointers that were recorded for the blocked
+// skylink that corresponds to the given hash. If there's no blocked skylink
+// for the given hash, ErrNoDocumentsFound is returned.
+func (db *DB) V2PointersFor(ctx context.Context, hash Hash) ([]V2Pointer, error) {
+	doc, err := db.FindByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, ErrNoDocumentsFound
+	}
+	return doc.V2Pointers, nil
+}
+
+// updateBlocklist is a helper method that applies the given update to the
+// skylinks that match the given filter, bumping the revision of the blocklist
+// if any of them changed.
+func (db *DB) updateBlocklist(ctx context.Context, filter, update bson.M) error {
+	res, err := db.staticSkylinks.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount > 0 {
+		db.bumpBlocklistRevision(ctx)
+	}
+	return nil
+}
+
 // updateFailedFlag is a helper method that updates the failed flag on the
 // documents that correspond with the skylinks in the given array.
 func (db *DB) updateFailedFlag(ctx context.Context, hashes []Hash, failed bool) error {
@@ -475,8 +2298,21 @@ func (db *DB) updateFailedFlag(ctx context.Context, hashes []Hash, failed bool)
 	}
 
 	// perform the update
-	collSkylinks := db.staticDB.Collection(collSkylinks)
-	_, err := collSkylinks.UpdateMany(ctx, filter, update)
+	_, err := db.staticSkylinks.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// updatePortalsFailed applies the given update, which adds or removes a portal
+// from the portals the skylinks failed to get blocked on, to the skylinks with
+// the given hashes.
+func (db *DB) updatePortalsFailed(ctx context.Context, hashes []Hash, update bson.M) error {
+	// return early if no hashes were given
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	filter := bson.M{"hash": bson.M{"$in": hashes}}
+	_, err := db.staticSkylinks.UpdateMany(ctx, filter, update)
 	return err
 }
 
@@ -511,7 +2347,7 @@ func ignoreDuplicateKeyErrors(err error) error {
 // creates them if needed.
 // See https://docs.mongodb.com/manual/indexes/
 // See https://docs.mongodb.com/manual/core/index-unique/
-func ensureDBSchema(ctx context.Context, db *mongo.Database, log *logrus.Logger) error {
+func ensureDBSchema(ctx context.Context, db *mongo.Database, tenant string, log *logrus.Logger) error {
 	// schema defines a mapping between a collection name and the indexes that
 	// must exist for that collection.
 	schema := map[string][]mongo.IndexModel{
@@ -525,6 +2361,48 @@ func ensureDBSchema(ctx context.Context, db *mongo.Database, log *logrus.Logger)
 				Options: options.Index().SetName("timestamp_added"),
 			},
 		},
+		collLatestBlockTimestamps: {
+			{
+				Keys:    bson.M{"target": 1},
+				Options: options.Index().SetName("target").SetUnique(true),
+			},
+		},
+		collLeases: {
+			{
+				Keys:    bson.M{"name": 1},
+				Options: options.Index().SetName("name").SetUnique(true),
+			},
+		},
+		collMigrations: {
+			{
+				Keys:    bson.M{"version": 1},
+				Options: options.Index().SetName("version").SetUnique(true),
+			},
+		},
+		collSourceCheckpoints: {
+			{
+				Keys:    bson.M{"source": 1},
+				Options: options.Index().SetName("source").SetUnique(true),
+			},
+		},
+		collDisabledSources: {
+			{
+				Keys:    bson.M{"source": 1},
+				Options: options.Index().SetName("source").SetUnique(true),
+			},
+		},
+		collSnapshots: {
+			{
+				Keys:    bson.M{"label": 1},
+				Options: options.Index().SetName("label").SetUnique(true),
+			},
+		},
+		collRevisions: {
+			{
+				Keys:    bson.M{"name": 1},
+				Options: options.Index().SetName("name").SetUnique(true),
+			},
+		},
 		collSkylinks: {
 			{
 				Keys:    bson.M{"hash": 1},
@@ -542,6 +2420,30 @@ func ensureDBSchema(ctx context.Context, db *mongo.Database, log *logrus.Logger)
 				Keys:    bson.M{"invalid": 1},
 				Options: options.Index().SetName("invalid"),
 			},
+			{
+				Keys:    bson.D{{Key: "blocked_at", Value: 1}, {Key: "timestamp_added", Value: 1}},
+				Options: options.Index().SetName("blocked_at_timestamp_added"),
+			},
+			{
+				Keys:    bson.D{{Key: "reporter.name", Value: 1}, {Key: "timestamp_added", Value: 1}, {Key: "_id", Value: 1}},
+				Options: options.Index().SetName("reporter_name_timestamp_added"),
+			},
+			{
+				Keys:    bson.D{{Key: "failed", Value: 1}, {Key: "timestamp_added", Value: 1}, {Key: "_id", Value: 1}},
+				Options: options.Index().SetName("failed_timestamp_added"),
+			},
+			{
+				Keys:    bson.D{{Key: "reverted", Value: 1}, {Key: "timestamp_added", Value: 1}, {Key: "_id", Value: 1}},
+				Options: options.Index().SetName("reverted_timestamp_added"),
+			},
+			{
+				Keys:    bson.M{"v2_pointers.hash": 1},
+				Options: options.Index().SetName("v2_pointers_hash"),
+			},
+			{
+				Keys:    bson.M{"portals_failed": 1},
+				Options: options.Index().SetName("portals_failed"),
+			},
 		},
 	}
 
@@ -553,6 +2455,7 @@ func ensureDBSchema(ctx context.Context, db *mongo.Database, log *logrus.Logger)
 	// ensure all collections and indices exist
 	var createErr error
 	for collName, models := range schema {
+		collName = collectionName(collName, tenant)
 		coll, err := ensureCollection(ctx, db, collName)
 		if err != nil {
 			// no need to continue if ensuring a collection fails
@@ -573,16 +2476,7 @@ func ensureDBSchema(ctx context.Context, db *mongo.Database, log *logrus.Logger)
 	if createErr != nil {
 		createErr = errors.Compose(createErr, ErrIndexCreateFailed)
 	}
-
-	// drop the old indices on 'skylink'
-	_, err1 := dropIndex(ctx, db.Collection(collAllowlist), "skylink")
-	_, err2 := dropIndex(ctx, db.Collection(collSkylinks), "skylink")
-	dropErr := errors.Compose(err1, err2)
-	if dropErr != nil {
-		dropErr = errors.Compose(dropErr, ErrIndexDropFailed)
-	}
-
-	return errors.Compose(createErr, dropErr)
+	return createErr
 }
 
 // dropIndex is a helper function that drops the index with given name on the
@@ -632,6 +2526,69 @@ func hasIndex(ctx context.Context, coll *mongo.Collection, indexName string) (bo
 	return found, nil
 }
 
+// ensureTTLIndex ensures the given collection has a TTL index on the given
+// field that expires documents after the given retention period. If the index
+// exists with a different retention period, it gets updated.
+func ensureTTLIndex(ctx context.Context, coll *mongo.Collection, field string, retention time.Duration) error {
+	expireAfter := int32(retention.Seconds())
+
+	// check whether the index exists
+	cur, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+	var idxs []struct {
+		Name        string `bson:"name"`
+		ExpireAfter *int32 `bson:"expireAfterSeconds"`
+	}
+	err = cur.All(ctx, &idxs)
+	if err != nil {
+		return err
+	}
+	for _, idx := range idxs {
+		if idx.Name != ttlIndexName {
+			continue
+		}
+		if idx.ExpireAfter != nil && *idx.ExpireAfter == expireAfter {
+			return nil
+		}
+
+		// update the retention period of the existing index
+		return coll.Database().RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: coll.Name()},
+			{Key: "index", Value: bson.M{
+				"name":               ttlIndexName,
+				"expireAfterSeconds": expireAfter,
+			}},
+		}).Err()
+	}
+
+	// create the index
+	_, err = coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{field: 1},
+		Options: options.Index().SetName(ttlIndexName).SetExpireAfterSeconds(expireAfter),
+	})
+	return err
+}
+
+// ValidateTenant returns an error if the given tenant can't be used to isolate
+// the collections of a blocker. The empty tenant is valid.
+func ValidateTenant(tenant string) error {
+	if tenant != "" && !tenantRegex.MatchString(tenant) {
+		return fmt.Errorf("invalid tenant '%v', it may only contain up to 64 alphanumeric characters, dashes and underscores", tenant)
+	}
+	return nil
+}
+
+// collectionName returns the name of the given collection for the given
+// tenant.
+func collectionName(collName, tenant string) string {
+	if tenant == "" {
+		return collName
+	}
+	return fmt.Sprintf("%s_%s", collName, tenant)
+}
+
 // ensureCollection gets the given collection from the
 // database and creates it if it doesn't exist.
 func ensureCollection(ctx context.Context, db *mongo.Database, collName string) (*mongo.Collection, error) {
@@ -649,6 +2606,97 @@ func ensureCollection(ctx context.Context, db *mongo.Database, collName string)
 	return coll, nil
 }
 
+// mergeReportUpdate returns the update that merges the report of the given
+// skylink into an existing blocked skylink with the same hash. The tags and the
+// reporter are added to the skylink's tags and reporters, unless they are
+// already present.
+//
+// If a report threshold is configured, the timestamp of a skylink that is
+// still pending is updated to the time of the report, which ensures it gets
+// picked up by the next sweep once it's confirmed by enough reporters.
+//
+// NOTE: we use an update pipeline rather than $addToSet because the tags of
+// skylinks that were reported without tags are null, rather than an empty
+// array, which $addToSet refuses to update.
+func (db *DB) mergeReportUpdate(skylink BlockedSkylink) bson.A {
+	set := bson.M{
+		"reporters": appendToSet("reporters", []Reporter{skylink.Reporter}),
+		"tags":      appendToSet("tags", uniqueStrings(skylink.Tags)),
+	}
+	if db.staticReportThreshold.enabled() {
+		pending := bson.M{"$and": bson.A{
+			bson.M{"$eq": bson.A{bson.M{"$type": "$blocked_at"}, "missing"}},
+			bson.M{"$ne": bson.A{"$reverted", true}},
+		}}
+		set["timestamp_added"] = bson.M{"$cond": bson.A{pending, skylink.TimestampAdded, "$timestamp_added"}}
+	}
+	return bson.A{bson.M{"$set": set}}
+}
+
+// appendToSet returns the aggregation expression that appends the given values
+// to the array in the given field, skipping the values that are already
+// present. A missing or null field is considered an empty array.
+func appendToSet(field string, values interface{}) bson.M {
+	current := bson.M{"$ifNull": bson.A{"$" + field, bson.A{}}}
+	return bson.M{"$concatArrays": bson.A{
+		current,
+		bson.M{"$filter": bson.M{
+			"input": bson.M{"$literal": values},
+			"cond":  bson.M{"$not": bson.A{bson.M{"$in": bson.A{"$$this", current}}}},
+		}},
+	}}
+}
+
+// blockedInRange returns the filter that matches the blocked skylinks that
+// were added in the given time range, excluding the ones that were found to be
+// invalid or got unblocked.
+func blockedInRange(from, to time.Time) bson.M {
+	// NOTE: $ne: true is not the same as $eq: false
+	return bson.M{
+		"timestamp_added": bson.M{"$gte": from, "$lt": to},
+		"invalid":         bson.M{"$ne": true},
+		"reverted":        bson.M{"$ne": true},
+	}
+}
+
+// sortByTimestampAdded returns the sort document that sorts skylinks by the
+// time they were added in the given order, 1 being ascending and -1 being
+// descending. Skylinks added at the same time, which is common with bulk
+// imports, are sorted by their id, ensuring the order is deterministic.
+func sortByTimestampAdded(order int) bson.D {
+	return bson.D{
+		{Key: "timestamp_added", Value: order},
+		{Key: "_id", Value: order},
+	}
+}
+
+// uniqueStrings returns the given strings without duplicates, retaining their
+// order.
+func uniqueStrings(strs []string) []string {
+	seen := make(map[string]struct{}, len(strs))
+	unique := make([]string, 0, len(strs))
+	for _, str := range strs {
+		if _, exists := seen[str]; exists {
+			continue
+		}
+		seen[str] = struct{}{}
+		unique = append(unique, str)
+	}
+	return unique
+}
+
+// sweepLookback returns the amount of time the sweep queries should look back
+// further than the latest block timestamp, given the read preference they use.
+func sweepLookback(rp *readpref.ReadPref) time.Duration {
+	if rp.Mode() == readpref.PrimaryMode {
+		return 0
+	}
+	if maxStaleness, set := rp.MaxStaleness(); set {
+		return maxStaleness
+	}
+	return secondaryReadLookback
+}
+
 // isDocumentNotFound is a helper function that returns whether the given error
 // contains the mongo documents not found error message.
 func isDocumentNotFound(err error) bool {
@@ -658,6 +2706,50 @@ func isDocumentNotFound(err error) bool {
 	return strings.Contains(err.Error(), ErrNoDocumentsFound.Error())
 }
 
+// isRetryable is a helper function that returns whether the given error is a
+// transient mongo error, such as a network error or an error caused by the
+// primary stepping down, after which the operation can be retried.
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if mongo.IsNetworkError(err) {
+		return true
+	}
+	se, ok := err.(mongo.ServerError)
+	if !ok {
+		return false
+	}
+	if se.HasErrorLabel("RetryableWriteError") {
+		return true
+	}
+	for _, code := range retryableErrorCodes {
+		if se.HasErrorCode(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryTransient calls the given function until it succeeds, returns an error
+// that is not retryable, or the given number of attempts is exhausted. The
+// backoff between attempts doubles after every attempt.
+func retryTransient(ctx context.Context, attempts int, backoff time.Duration, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if !isRetryable(err) || attempt == attempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Compose(err, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
 // isDuplicateKey is a helper function that returns whether the given error
 // contains the mongo duplicate key error message.
 func isDuplicateKey(err error) bool {
@@ -5,18 +5,104 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/sirupsen/logrus"
 	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
 	"gitlab.com/SkynetLabs/skyd/skymodules"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.sia.tech/siad/crypto"
 )
 
+// TestDegradedStart verifies the database can be created while the database
+// server is unreachable if degraded start is allowed, and that we fail fast if
+// it's not.
+func TestDegradedStart(t *testing.T) {
+	t.Parallel()
+
+	// create a discard logger
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	// use a connection string that points to a port nothing listens on
+	uri := "mongodb://localhost:1"
+	creds := options.Credential{Username: mongoTestUsername, Password: mongoTestPassword}
+
+	// assert we fail fast by default
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := NewCustomDB(ctx, uri, t.Name(), creds, DefaultOptions(), logger)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	// assert we start in degraded mode if allowed
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	opts := DefaultOptions()
+	opts.AllowDegradedStart = true
+	db, err := NewCustomDB(ctx, uri, t.Name(), creds, opts, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Connected() {
+		t.Fatal("expected database to not be connected")
+	}
+
+	// assert closing the database stops the connect loop
+	err = db.Close(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-db.staticStopChan:
+	default:
+		t.Fatal("expected stop chan to be closed")
+	}
+}
+
+// TestTenant verifies the tenant is validated and appended to the collection
+// names.
+func TestTenant(t *testing.T) {
+	t.Parallel()
+
+	// assert the collection names
+	if collectionName(collSkylinks, "") != "skylinks" {
+		t.Fatal("unexpected name", collectionName(collSkylinks, ""))
+	}
+	if collectionName(collSkylinks, "portal_1") != "skylinks_portal_1" {
+		t.Fatal("unexpected name", collectionName(collSkylinks, "portal_1"))
+	}
+
+	// assert the tenant is validated
+	for _, tenant := range []string{"", "portal", "portal-1", "Portal_1"} {
+		if err := ValidateTenant(tenant); err != nil {
+			t.Fatal("unexpected error", tenant, err)
+		}
+	}
+	for _, tenant := range []string{"portal.1", "portal 1", "portal$1", strings.Repeat("a", 65)} {
+		if err := ValidateTenant(tenant); err == nil {
+			t.Fatal("expected error", tenant)
+		}
+	}
+
+	// assert NewCustomDB rejects an invalid tenant
+	opts := DefaultOptions()
+	opts.Tenant = "portal.1"
+	_, err := NewCustomDB(context.Background(), "mongodb://localhost:1", t.Name(), options.Credential{}, opts, logrus.New())
+	if err == nil || !strings.Contains(err.Error(), "invalid tenant") {
+		t.Fatal("unexpected error", err)
+	}
+}
+
 // TestDatabase runs the database unit tests.
 func TestDatabase(t *testing.T) {
 	if testing.Short() {
@@ -29,6 +115,14 @@ func TestDatabase(t *testing.T) {
 		test func(t *testing.T)
 	}{
 
+		{
+			name: "BlockCountsBySource",
+			test: testBlockCountsBySource,
+		},
+		{
+			name: "BlockDelay",
+			test: testBlockDelay,
+		},
 		{
 			name: "BlockedHashes",
 			test: testBlockedHashes,
@@ -42,14 +136,38 @@ func TestDatabase(t *testing.T) {
 			name: "CreateBlockedSkylink",
 			test: testCreateBlockedSkylinkBulk,
 		},
+		{
+			name: "CollapseDuplicates",
+			test: testCollapseDuplicates,
+		},
+		{
+			name: "CheckHashConsistency",
+			test: testCheckHashConsistency,
+		},
+		{
+			name: "HashesInRange",
+			test: testHashesInRange,
+		},
 		{
 			name: "IgnoreDuplicateKeyErrors",
 			test: testIgnoreDuplicateKeyErrors,
 		},
+		{
+			name: "IsBlocked",
+			test: testIsBlocked,
+		},
 		{
 			name: "IsAllowListedSkylink",
 			test: testIsAllowListedSkylink,
 		},
+		{
+			name: "LatestBlockTimestamp",
+			test: testLatestBlockTimestamp,
+		},
+		{
+			name: "Migrate",
+			test: testMigrate,
+		},
 		{
 			name: "MarkSucceeded",
 			test: testMarkSucceeded,
@@ -62,6 +180,74 @@ func TestDatabase(t *testing.T) {
 			name: "MarkInvalid",
 			test: testMarkInvalid,
 		},
+		{
+			name: "MarkPortalFailed",
+			test: testMarkPortalFailed,
+		},
+		{
+			name: "QuarantineMalformed",
+			test: testQuarantineMalformed,
+		},
+		{
+			name: "RecentHashesToBlock",
+			test: testRecentHashesToBlock,
+		},
+		{
+			name: "ReportIDs",
+			test: testReportIDs,
+		},
+		{
+			name: "ReportThreshold",
+			test: testReportThreshold,
+		},
+		{
+			name: "ScanIntegrity",
+			test: testScanIntegrity,
+		},
+		{
+			name: "Snapshots",
+			test: testSnapshots,
+		},
+		{
+			name: "SourceCheckpoint",
+			test: testSourceCheckpoint,
+		},
+		{
+			name: "SourceEnabled",
+			test: testSourceEnabled,
+		},
+		{
+			name: "SweepOrder",
+			test: testSweepOrder,
+		},
+		{
+			name: "SweepLease",
+			test: testSweepLease,
+		},
+		{
+			name: "Tenants",
+			test: testTenants,
+		},
+		{
+			name: "BlocklistRevision",
+			test: testBlocklistRevision,
+		},
+		{
+			name: "TestRecords",
+			test: testTestRecords,
+		},
+		{
+			name: "Unblock",
+			test: testUnblock,
+		},
+		{
+			name: "V2Pointers",
+			test: testV2Pointers,
+		},
+		{
+			name: "EnsureTTLIndex",
+			test: testEnsureTTLIndex,
+		},
 		{
 			name: "HasIndex",
 			test: testHasIndex,
@@ -74,6 +260,10 @@ func TestDatabase(t *testing.T) {
 			name: "Ping",
 			test: testPing,
 		},
+		{
+			name: "UpdateAnnotations",
+			test: testUpdateAnnotations,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, test.test)
@@ -126,6 +316,92 @@ func testBlockedHashes(t *testing.T) {
 	}
 }
 
+// testSweepOrder verifies skylinks that were added at the same time, as
+// happens with bulk imports, are always returned in the same order.
+func testSweepOrder(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// bulk insert skylinks that share the same timestamp, the hashes are
+	// random so their order differs from the insertion order
+	now := time.Now().UTC().Truncate(time.Second)
+	var skylinks []BlockedSkylink
+	var expected []Hash
+	for i := 0; i < 20; i++ {
+		hash := HashBytes(fastrand.Bytes(32))
+		skylinks = append(skylinks, BlockedSkylink{
+			Hash:           hash,
+			TimestampAdded: now,
+		})
+		expected = append(expected, hash)
+	}
+	added, err := db.CreateBlockedSkylinkBulk(ctx, skylinks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != len(skylinks) {
+		t.Fatalf("expected %v skylinks to be added, instead it was %v", len(skylinks), added)
+	}
+
+	// assert the hashes are returned in insertion order, every time
+	for i := 0; i < 5; i++ {
+		toBlock, err := db.HashesToBlock(ctx, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(toBlock, expected) {
+			t.Fatal("unexpected order", toBlock)
+		}
+		inRange, err := db.HashesInRange(ctx, now, now.Add(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(inRange, expected) {
+			t.Fatal("unexpected order", inRange)
+		}
+	}
+
+	// assert paging through the blocklist returns every hash exactly once,
+	// in both sort orders
+	for _, sort := range []int{1, -1} {
+		var paged []Hash
+		for skip := 0; ; skip += 3 {
+			docs, more, err := db.BlockedHashes(ctx, sort, skip, 3, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, doc := range docs {
+				paged = append(paged, doc.Hash)
+			}
+			if !more {
+				break
+			}
+		}
+		if len(paged) != len(expected) {
+			t.Fatalf("expected %v hashes, instead it was %v", len(expected), len(paged))
+		}
+		for i := range paged {
+			j := i
+			if sort == -1 {
+				j = len(expected) - 1 - i
+			}
+			if paged[i] != expected[j] {
+				t.Fatal("unexpected order", sort, paged)
+			}
+		}
+	}
+}
+
 // testCreateBlockedSkylink tests creating and fetching a blocked skylink from
 // the db.
 func testCreateBlockedSkylink(t *testing.T) {
@@ -211,6 +487,28 @@ func testCreateBlockedSkylink(t *testing.T) {
 		fmt.Println(string(b2))
 		t.Fatal("not equal")
 	}
+
+	// report the skylink again with other tags and assert the report got
+	// merged into the existing skylink
+	err = db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+		Hash:           HashBytes([]byte("somehash")),
+		Reporter:       Reporter{Name: "other"},
+		Tags:           []string{"C"},
+		TimestampAdded: time.Now().UTC(),
+	})
+	if err != ErrSkylinkExists {
+		t.Fatal("unexpected error", err)
+	}
+	fetchedSL, err = db.FindByHash(ctx, HashBytes([]byte("somehash")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fetchedSL.Tags, []string{"C"}) {
+		t.Fatal("unexpected tags", fetchedSL.Tags)
+	}
+	if len(fetchedSL.Reporters) != 1 || fetchedSL.Reporters[0].Name != "other" {
+		t.Fatal("unexpected reporters", fetchedSL.Reporters)
+	}
 }
 
 // testCreateBlockedSkylink tests creating blocked skylinks in bulk
@@ -251,6 +549,215 @@ func testCreateBlockedSkylinkBulk(t *testing.T) {
 	if added != 2 {
 		t.Fatalf("unexpected amount of skylinks blocked, %v != 2", added)
 	}
+
+	// report one of them again, with other tags
+	added, err = db.CreateBlockedSkylinkBulk(ctx, []BlockedSkylink{
+		{
+			Hash:           HashBytes([]byte("somehash1")),
+			Reporter:       Reporter{Name: "other"},
+			Tags:           []string{"tag_b"},
+			TimestampAdded: time.Now().UTC(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 0 {
+		t.Fatalf("unexpected amount of skylinks blocked, %v != 0", added)
+	}
+
+	// assert the report got merged into the existing skylink
+	doc, err := db.FindByHash(ctx, HashBytes([]byte("somehash1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(doc.Tags, []string{"tag_b"}) {
+		t.Fatal("unexpected tags", doc.Tags)
+	}
+	if len(doc.Reporters) != 2 || doc.Reporters[1].Name != "other" {
+		t.Fatal("unexpected reporters", doc.Reporters)
+	}
+
+	// unblock the other one and report it again, assert it got blocked again
+	hash2 := HashBytes([]byte("somehash2"))
+	err = db.Unblock(ctx, hash2, "false positive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reported := time.Now().UTC().Truncate(time.Millisecond)
+	added, err = db.CreateBlockedSkylinkBulk(ctx, []BlockedSkylink{
+		{
+			Hash:           hash2,
+			TimestampAdded: reported,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 1 {
+		t.Fatalf("unexpected amount of skylinks blocked, %v != 1", added)
+	}
+	doc, err = db.FindByHash(ctx, hash2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Reverted || !doc.TimestampAdded.Equal(reported) {
+		t.Fatal("expected the skylink to be blocked again", doc.Reverted, doc.TimestampAdded)
+	}
+}
+
+// testCheckHashConsistency verifies skylinks that share a canonical hash are
+// reported as colliding.
+func testCheckHashConsistency(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// assert a database with canonical hashes is consistent
+	now := time.Now().UTC()
+	collided := HashBytes([]byte("skylink_1"))
+	err := db.CreateBlockedSkylink(ctx, &BlockedSkylink{Hash: collided, TimestampAdded: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := db.CheckHashConsistency(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.NonCanonical != 0 || len(report.Collisions) != 0 {
+		t.Fatal("unexpected report", report)
+	}
+
+	// insert the uppercase variant of the hash, and the uppercase variant of
+	// a hash that has no canonical counterpart, the unique index considers
+	// them distinct
+	upper := strings.ToUpper(collided.String())
+	lonely := strings.ToUpper(HashBytes([]byte("skylink_2")).String())
+	for _, hash := range []string{upper, lonely} {
+		_, err = db.staticSkylinks.InsertOne(ctx, bson.M{"hash": hash, "timestamp_added": now})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// assert the collision is found
+	report, err = db.CheckHashConsistency(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.NonCanonical != 2 || len(report.Collisions) != 1 {
+		t.Fatal("unexpected report", report)
+	}
+	collision := report.Collisions[0]
+	if collision.Canonical != CanonicalHash(collided) || len(collision.IDs) != 2 {
+		t.Fatal("unexpected collision", collision)
+	}
+	if collision.Hashes[0] != CanonicalHash(collided) || collision.Hashes[1] != upper {
+		t.Fatal("unexpected hashes", collision.Hashes)
+	}
+
+	// assert the sample size has to be positive
+	_, err = db.CheckHashConsistency(ctx, 0)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// testCollapseDuplicates is a unit test that covers the 'CollapseDuplicates'
+// method.
+func testCollapseDuplicates(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// drop the unique index so we can insert duplicates
+	_, err := dropIndex(ctx, db.staticSkylinks, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// insert three skylinks with the same hash where the oldest one got
+	// unblocked and one skylink with another hash
+	hash := HashBytes([]byte("skylink_1"))
+	now := time.Now().UTC()
+	for _, doc := range []BlockedSkylink{
+		{Hash: hash, Reverted: true, Tags: []string{"tag_a"}, TimestampAdded: now.Add(-time.Hour)},
+		{Hash: hash, Reporter: Reporter{Name: "b"}, Tags: []string{"tag_b"}, TimestampAdded: now.Add(-time.Minute)},
+		{Hash: hash, Reporter: Reporter{Name: "c"}, Tags: []string{"tag_a", "tag_c"}, TimestampAdded: now},
+		{Hash: HashBytes([]byte("skylink_2")), TimestampAdded: now},
+	} {
+		_, err = db.staticSkylinks.InsertOne(ctx, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// collapse the duplicates
+	removed, err := db.CollapseDuplicates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 {
+		t.Fatalf("expected 2 skylinks to be removed, instead it was %v", removed)
+	}
+
+	// assert the first skylink that was not unblocked was kept, and the
+	// others were merged into it
+	docs, err := db.find(ctx, bson.M{"hash": hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 {
+		t.Fatalf("expected 1 skylink, instead it was %v", len(docs))
+	}
+	doc := docs[0]
+	if doc.Reverted || doc.Reporter.Name != "b" {
+		t.Fatal("unexpected skylink kept", doc)
+	}
+	if !reflect.DeepEqual(doc.Tags, []string{"tag_b", "tag_a", "tag_c"}) {
+		t.Fatal("unexpected tags", doc.Tags)
+	}
+	if len(doc.Reporters) != 2 {
+		t.Fatal("unexpected reporters", doc.Reporters)
+	}
+
+	// assert running it again is a no-op and the unique index can be created
+	removed, err = db.CollapseDuplicates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 0 {
+		t.Fatalf("expected no skylinks to be removed, instead it was %v", removed)
+	}
+	err = db.ensureSchema(ctx, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exists, err := hasIndex(ctx, db.staticSkylinks, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("expected hash index to exist")
+	}
 }
 
 // testIgnoreDuplicateKeyErrors is a unit test that verifies the functionality
@@ -349,9 +856,120 @@ func testIsAllowListedSkylink(t *testing.T) {
 	if allowListed {
 		t.Fatal("unexpected")
 	}
+
+	// Check the result of 'AllowListedHashes'
+	hashes, err := db.AllowListedHashes(ctx, []Hash{{hash}, {hash2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 1 {
+		t.Fatal("unexpected", hashes)
+	}
+	if _, exists := hashes[Hash{hash}]; !exists {
+		t.Fatal("unexpected", hashes)
+	}
 }
 
-// testMarkSucceeded is a unit test that covers the functionality of
+// testLatestBlockTimestamp is a unit test that covers the functionality of the
+// 'LatestBlockTimestamp' and 'SetLatestBlockTimestamp' methods on the database.
+func testLatestBlockTimestamp(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// assert the zero time is returned if no timestamp was set
+	latest, err := db.LatestBlockTimestamp(ctx, DefaultSkydTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !latest.IsZero() {
+		t.Fatalf("unexpected timestamp %v, expected zero time", latest)
+	}
+
+	// set the timestamp for the default target and assert it's returned
+	now := time.Now().Round(time.Second).UTC()
+	err = db.SetLatestBlockTimestamp(ctx, DefaultSkydTarget, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err = db.LatestBlockTimestamp(ctx, DefaultSkydTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !latest.Equal(now) {
+		t.Fatalf("unexpected timestamp, %v != %v", latest, now)
+	}
+
+	// assert other targets track their own progress
+	latest, err = db.LatestBlockTimestamp(ctx, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !latest.IsZero() {
+		t.Fatalf("unexpected timestamp %v, expected zero time", latest)
+	}
+
+	// update the timestamp and assert it got overwritten
+	later := now.Add(time.Hour)
+	err = db.SetLatestBlockTimestamp(ctx, DefaultSkydTarget, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err = db.LatestBlockTimestamp(ctx, DefaultSkydTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !latest.Equal(later) {
+		t.Fatalf("unexpected timestamp, %v != %v", latest, later)
+	}
+
+	// assert swapping from a stale timestamp leaves it untouched
+	swapped, err := db.SwapLatestBlockTimestamp(ctx, DefaultSkydTarget, now, now.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if swapped {
+		t.Fatal("expected the swap to fail")
+	}
+	latest, err = db.LatestBlockTimestamp(ctx, DefaultSkydTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !latest.Equal(later) {
+		t.Fatalf("unexpected timestamp, %v != %v", latest, later)
+	}
+
+	// assert swapping from the current timestamp updates it
+	swapped, err = db.SwapLatestBlockTimestamp(ctx, DefaultSkydTarget, later, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !swapped {
+		t.Fatal("expected the swap to succeed")
+	}
+
+	// assert swapping from the zero time creates the timestamp of a new
+	// target, but only once
+	swapped, err = db.SwapLatestBlockTimestamp(ctx, "new", time.Time{}, now)
+	if err != nil || !swapped {
+		t.Fatal("unexpected outcome", swapped, err)
+	}
+	swapped, err = db.SwapLatestBlockTimestamp(ctx, "new", time.Time{}, later)
+	if err != nil || swapped {
+		t.Fatal("unexpected outcome", swapped, err)
+	}
+}
+
+// testMarkSucceeded is a unit test that covers the functionality of
 // the 'MarkSucceeded' method on the database.
 func testMarkSucceeded(t *testing.T) {
 	// create context
@@ -369,7 +987,7 @@ func testMarkSucceeded(t *testing.T) {
 
 	// ensure 'MarkSucceeded' can handle an empty slice
 	var empty []Hash
-	err := db.MarkSucceeded(ctx, empty)
+	err := db.MarkSucceeded(ctx, empty, time.Now())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -403,7 +1021,7 @@ func testMarkSucceeded(t *testing.T) {
 		t.Fatalf("unexpected number of documents, %v != 1", len(toRetry))
 	}
 
-	err = db.MarkSucceeded(ctx, toRetry)
+	err = db.MarkSucceeded(ctx, toRetry, time.Now())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -415,6 +1033,38 @@ func testMarkSucceeded(t *testing.T) {
 	if len(toRetry) != 0 {
 		t.Fatalf("unexpected number of documents, %v != 0", len(toRetry))
 	}
+
+	// assert the regular document still needs to be blocked
+	toBlock, err := db.HashesToBlock(ctx, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toBlock) != 1 {
+		t.Fatalf("unexpected number of documents, %v != 1", len(toBlock))
+	}
+
+	// mark it as succeeded and assert it's skipped by the sweep
+	blockedAt := time.Now().UTC().Add(-time.Minute).Truncate(time.Millisecond)
+	err = db.MarkSucceeded(ctx, toBlock, blockedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toBlock, err = db.HashesToBlock(ctx, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toBlock) != 0 {
+		t.Fatalf("unexpected number of documents, %v != 0", len(toBlock))
+	}
+
+	// assert the time at which it got blocked was set
+	doc, err := db.FindByHash(ctx, HashBytes([]byte("skylink_1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc == nil || !doc.BlockedAt.Equal(blockedAt) {
+		t.Fatal("expected 'BlockedAt' to be set to the given time", doc)
+	}
 }
 
 // testMarkFailed is a unit test that covers the functionality of the
@@ -581,6 +1231,95 @@ func testDropIndex(t *testing.T) {
 	}
 }
 
+// testMarkPortalFailed is a unit test that covers the functionality of the
+// 'MarkPortalFailed' and 'MarkPortalSucceeded' methods on the database.
+func testMarkPortalFailed(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// insert two regular documents and one invalid one
+	hash1 := HashBytes([]byte("skylink_1"))
+	hash2 := HashBytes([]byte("skylink_2"))
+	hash3 := HashBytes([]byte("skylink_3"))
+	err1 := db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+		Hash:           hash1,
+		TimestampAdded: time.Now().UTC(),
+	})
+	err2 := db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+		Hash:           hash2,
+		TimestampAdded: time.Now().UTC(),
+	})
+	err3 := db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+		Hash:           hash3,
+		TimestampAdded: time.Now().UTC(),
+		Invalid:        true,
+	})
+	if err := errors.Compose(err1, err2, err3); err != nil {
+		t.Fatal(err)
+	}
+
+	// mark all hashes as failed on two portals, twice to ensure the portals
+	// are only recorded once
+	portal1 := "https://portal1.net"
+	portal2 := "https://portal2.net"
+	all := []Hash{hash1, hash2, hash3}
+	for i := 0; i < 2; i++ {
+		err1 = db.MarkPortalFailed(ctx, all, portal1)
+		err2 = db.MarkPortalFailed(ctx, all, portal2)
+		if err := errors.Compose(err1, err2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	doc, err := db.FindByHash(ctx, hash1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.PortalsFailed) != 2 {
+		t.Fatalf("unexpected portals failed %v", doc.PortalsFailed)
+	}
+
+	// assert the invalid hash is not retried
+	toRetry, err := db.HashesToRetryOnPortal(ctx, portal1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toRetry) != 2 || toRetry[0] != hash1 || toRetry[1] != hash2 {
+		t.Fatalf("unexpected hashes to retry %v", toRetry)
+	}
+
+	// mark the first hash as succeeded on the first portal
+	err = db.MarkPortalSucceeded(ctx, []Hash{hash1}, portal1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert it's no longer retried on that portal, but still on the other
+	toRetry, err = db.HashesToRetryOnPortal(ctx, portal1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toRetry) != 1 || toRetry[0] != hash2 {
+		t.Fatalf("unexpected hashes to retry %v", toRetry)
+	}
+	toRetry, err = db.HashesToRetryOnPortal(ctx, portal2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toRetry) != 2 {
+		t.Fatalf("unexpected hashes to retry %v", toRetry)
+	}
+}
+
 // testMarkInvalid is a unit test that covers the functionality of the
 // 'MarkInvalid' method on the database.
 func testMarkInvalid(t *testing.T) {
@@ -659,6 +1398,73 @@ func testMarkInvalid(t *testing.T) {
 	}
 }
 
+// testTenants verifies blockers of different tenants can share a database
+// without seeing each other's skylinks.
+func testTenants(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create a discard logger
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	// create a database for two tenants that share the same database
+	dbName := strings.Replace(t.Name(), "/", "_", -1)
+	creds := options.Credential{Username: mongoTestUsername, Password: mongoTestPassword}
+	tenantDB := func(tenant string) *DB {
+		opts := DefaultOptions()
+		opts.Tenant = tenant
+		db, err := NewCustomDB(ctx, mongoTestConnString, dbName, creds, opts, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.Purge(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+	db1 := tenantDB("portal_1")
+	db2 := tenantDB("portal_2")
+	defer func() {
+		err := errors.Compose(db1.Drop(ctx), db2.Drop(ctx), db1.Close(ctx), db2.Close(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// block a skylink for the first tenant
+	hash := HashBytes([]byte("skylink"))
+	err := db1.CreateBlockedSkylink(ctx, &BlockedSkylink{
+		Hash:           hash,
+		TimestampAdded: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert it's only blocked for the first tenant
+	blocked, err := db1.IsBlocked(ctx, hash)
+	if err != nil || !blocked {
+		t.Fatal("expected skylink to be blocked", err)
+	}
+	blocked, err = db2.IsBlocked(ctx, hash)
+	if err != nil || blocked {
+		t.Fatal("expected skylink to not be blocked", err)
+	}
+
+	// assert the collections are named after the tenant
+	names, err := db1.staticDB.ListCollectionNames(ctx, bson.M{"name": bson.M{"$regex": "^skylinks"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"skylinks_portal_1", "skylinks_portal_2"}) {
+		t.Fatal("unexpected collections", names)
+	}
+}
+
 // testPing is a unit test for the database's Ping method.
 func testPing(t *testing.T) {
 	// create context
@@ -702,3 +1508,1308 @@ func randomHash() crypto.Hash {
 	rand.Read(h[:])
 	return h
 }
+
+// testBlockDelay verifies the sweep skips skylinks that are held back by the
+// block delay, and that these skylinks can be cancelled.
+func testBlockDelay(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database and configure the block delay
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	db.staticBlockDelay = BlockDelay{
+		Default: 30 * time.Minute,
+		Tags: map[string]time.Duration{
+			"community": 24 * time.Hour,
+			"trusted":   0,
+		},
+	}
+	if db.MaxBlockDelay() != 24*time.Hour {
+		t.Fatal("unexpected max block delay", db.MaxBlockDelay())
+	}
+
+	// insert skylinks with various tags and ages
+	now := time.Now().UTC()
+	skylinks := []struct {
+		name     string
+		tags     []string
+		age      time.Duration
+		expected bool
+	}{
+		{name: "untagged_old", age: time.Hour, expected: true},
+		{name: "untagged_new", age: 0, expected: false},
+		{name: "community_new", tags: []string{"community"}, age: time.Hour, expected: false},
+		{name: "community_old", tags: []string{"community"}, age: 25 * time.Hour, expected: true},
+		{name: "trusted_new", tags: []string{"trusted"}, age: 0, expected: true},
+		{name: "both_new", tags: []string{"trusted", "community"}, age: time.Hour, expected: false},
+	}
+	expected := make(map[Hash]string)
+	for _, sl := range skylinks {
+		hash := HashBytes([]byte(sl.name))
+		err := db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+			Hash:           hash,
+			Tags:           sl.tags,
+			TimestampAdded: now.Add(-sl.age),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sl.expected {
+			expected[hash] = sl.name
+		}
+	}
+
+	// assert only the skylinks that are no longer held back are returned
+	hashes, err := db.HashesToBlock(ctx, now.Add(-48*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != len(expected) {
+		t.Fatalf("unexpected number of hashes, %v != %v", len(hashes), len(expected))
+	}
+	for _, hash := range hashes {
+		if _, exists := expected[hash]; !exists {
+			t.Fatal("unexpected hash", hash)
+		}
+	}
+
+	// assert a pending skylink can be cancelled
+	pending := HashBytes([]byte("untagged_new"))
+	err = db.CancelPending(ctx, pending, "reviewed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := db.BlockHistory(ctx, pending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[1].Type != BlockEventCancelled || history[1].Reason != "reviewed" {
+		t.Fatal("unexpected history", history)
+	}
+
+	// assert it can't be cancelled twice
+	err = db.CancelPending(ctx, pending, "reviewed")
+	if !errors.Contains(err, ErrNoDocumentsFound) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert a blocked skylink can't be cancelled
+	blocked := HashBytes([]byte("untagged_old"))
+	err = db.MarkSucceeded(ctx, []Hash{blocked}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.CancelPending(ctx, blocked, "reviewed")
+	if !errors.Contains(err, ErrNoDocumentsFound) {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+// TestRetryTransient verifies transient mongo errors are retried and that
+// permanent errors are returned immediately.
+func TestRetryTransient(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stepdown := mongo.CommandError{Code: 189, Name: "PrimarySteppedDown"}
+	permanent := mongo.CommandError{Code: 2, Name: "BadValue"}
+
+	// assert a transient error is retried and the write succeeds on the
+	// second attempt
+	var calls int
+	err := retryTransient(ctx, 3, time.Millisecond, func() error {
+		calls++
+		if calls == 1 {
+			return stepdown
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Fatal("unexpected outcome", err, calls)
+	}
+
+	// assert a permanent error is not retried
+	calls = 0
+	err = retryTransient(ctx, 3, time.Millisecond, func() error {
+		calls++
+		return permanent
+	})
+	if err == nil || err.Error() != permanent.Error() || calls != 1 {
+		t.Fatal("unexpected outcome", err, calls)
+	}
+
+	// assert we give up after the given number of attempts
+	calls = 0
+	err = retryTransient(ctx, 3, time.Millisecond, func() error {
+		calls++
+		return stepdown
+	})
+	if !isRetryable(err) || calls != 3 {
+		t.Fatal("unexpected outcome", err, calls)
+	}
+
+	// assert we escape when the context is cancelled
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	calls = 0
+	err = retryTransient(cancelled, 3, time.Minute, func() error {
+		calls++
+		return stepdown
+	})
+	if !errors.Contains(err, context.Canceled) || calls != 1 {
+		t.Fatal("unexpected outcome", err, calls)
+	}
+
+	// assert the error classification
+	if !isRetryable(mongo.CommandError{Labels: []string{"RetryableWriteError"}}) {
+		t.Fatal("expected retryable write error to be retryable")
+	}
+	if !isRetryable(mongo.CommandError{Labels: []string{"NetworkError"}}) {
+		t.Fatal("expected network error to be retryable")
+	}
+	if isRetryable(nil) || isRetryable(permanent) || isRetryable(ErrNoDocumentsFound) {
+		t.Fatal("expected error not to be retryable")
+	}
+}
+
+// TestBlockDelayFilter is a unit test for the conditions the block delay adds
+// to the sweep.
+func TestBlockDelayFilter(t *testing.T) {
+	t.Parallel()
+
+	// assert no conditions are added without a delay
+	now := time.Now().UTC()
+	bd := BlockDelay{Tags: map[string]time.Duration{"trusted": 0}}
+	if conditions := bd.filter(now); len(conditions) != 0 {
+		t.Fatal("unexpected conditions", conditions)
+	}
+
+	// assert a condition is added for every delayed tag and the default
+	bd = BlockDelay{
+		Default: time.Minute,
+		Tags: map[string]time.Duration{
+			"community": time.Hour,
+			"abuse":     time.Second,
+			"trusted":   0,
+		},
+	}
+	conditions := bd.filter(now)
+	if len(conditions) != 3 {
+		t.Fatal("unexpected number of conditions", len(conditions))
+	}
+	if bd.Max() != time.Hour {
+		t.Fatal("unexpected max", bd.Max())
+	}
+}
+
+// testUnblock tests unblocking a skylink and verifies its history is kept
+func testUnblock(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// assert unblocking an unknown hash returns ErrNoDocumentsFound
+	hash := HashBytes([]byte("skylink_1"))
+	err := db.Unblock(ctx, hash, "reason")
+	if !errors.Contains(err, ErrNoDocumentsFound) {
+		t.Fatal("unexpected error", err)
+	}
+	_, err = db.BlockHistory(ctx, hash)
+	if !errors.Contains(err, ErrNoDocumentsFound) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// block the skylink
+	err = db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+		Hash:           hash,
+		TimestampAdded: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// unblock it
+	err = db.Unblock(ctx, hash, "false positive")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the record was kept and marked as reverted
+	doc, err := db.FindByHash(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc == nil || !doc.Reverted || doc.RevertedReason != "false positive" || doc.TimestampReverted.IsZero() {
+		t.Fatal("unexpected document", doc)
+	}
+
+	// assert it's not considered for blocking
+	toBlock, err := db.HashesToBlock(ctx, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toBlock) != 0 {
+		t.Fatalf("expected 0 hashes, instead it was %v", len(toBlock))
+	}
+
+	// assert unblocking it again returns ErrNoDocumentsFound
+	err = db.Unblock(ctx, hash, "reason")
+	if !errors.Contains(err, ErrNoDocumentsFound) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// block it again
+	err = db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+		Hash:           hash,
+		TimestampAdded: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert blocking it while it's blocked returns ErrSkylinkExists
+	err = db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+		Hash:           hash,
+		TimestampAdded: time.Now().UTC(),
+	})
+	if err != ErrSkylinkExists {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert the history contains all events in order
+	history, err := db.BlockHistory(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("expected 3 events, instead it was %v", len(history))
+	}
+	if history[0].Type != BlockEventBlocked ||
+		history[1].Type != BlockEventUnblocked ||
+		history[1].Reason != "false positive" ||
+		history[2].Type != BlockEventBlocked {
+		t.Fatal("unexpected history", history)
+	}
+}
+
+// testSweepLease tests acquiring, renewing and releasing the sweep lease
+func testSweepLease(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// assert the first instance acquires the lease
+	acquired, err := db.AcquireSweepLease(ctx, "instance_1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !acquired {
+		t.Fatal("expected the lease to be acquired")
+	}
+
+	// assert it can acquire it again
+	acquired, err = db.AcquireSweepLease(ctx, "instance_1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !acquired {
+		t.Fatal("expected the lease to be acquired")
+	}
+
+	// assert the second instance can't acquire nor renew it
+	acquired, err = db.AcquireSweepLease(ctx, "instance_2", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acquired {
+		t.Fatal("expected the lease not to be acquired")
+	}
+	renewed, err := db.RenewSweepLease(ctx, "instance_2", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed {
+		t.Fatal("expected the lease not to be renewed")
+	}
+
+	// assert the first instance can renew it, using a ttl that expires it
+	renewed, err = db.RenewSweepLease(ctx, "instance_1", -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !renewed {
+		t.Fatal("expected the lease to be renewed")
+	}
+
+	// assert the second instance takes over the expired lease
+	acquired, err = db.AcquireSweepLease(ctx, "instance_2", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !acquired {
+		t.Fatal("expected the lease to be acquired")
+	}
+
+	// assert the first instance lost it
+	renewed, err = db.RenewSweepLease(ctx, "instance_1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed {
+		t.Fatal("expected the lease not to be renewed")
+	}
+
+	// assert releasing the lease allows the first instance to acquire it
+	err = db.ReleaseSweepLease(ctx, "instance_2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired, err = db.AcquireSweepLease(ctx, "instance_1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !acquired {
+		t.Fatal("expected the lease to be acquired")
+	}
+}
+
+// testHashesInRange tests fetching the hashes of skylinks added in a certain
+// time range
+func testHashesInRange(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// insert a skylink every hour, mark one as invalid
+	start := time.Now().Add(-24 * time.Hour).Round(time.Second).UTC()
+	var hashes []Hash
+	for i := 0; i < 4; i++ {
+		hash := HashBytes([]byte(fmt.Sprintf("skylink_%d", i)))
+		err := db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+			Hash:           hash,
+			TimestampAdded: start.Add(time.Duration(i) * time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+	err := db.MarkInvalid(ctx, hashes[2:3])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the range is inclusive at the start and exclusive at the end
+	inRange, err := db.HashesInRange(ctx, start.Add(time.Hour), start.Add(3*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inRange) != 1 || inRange[0] != hashes[1] {
+		t.Fatal("unexpected hashes", inRange)
+	}
+
+	// assert all valid hashes are returned in order for the full range
+	inRange, err = db.HashesInRange(ctx, start, start.Add(4*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inRange) != 3 || inRange[0] != hashes[0] || inRange[2] != hashes[3] {
+		t.Fatal("unexpected hashes", inRange)
+	}
+
+	// assert the blocked skylinks in range match the hashes
+	skylinks, err := db.BlockedSkylinksInRange(ctx, start, start.Add(4*time.Hour), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skylinks) != 3 || skylinks[0].Hash != hashes[0] || skylinks[2].Hash != hashes[3] {
+		t.Fatal("unexpected skylinks", skylinks)
+	}
+	if !skylinks[1].TimestampAdded.Equal(start.Add(time.Hour)) {
+		t.Fatal("unexpected timestamp", skylinks[1].TimestampAdded)
+	}
+
+	// assert iteration stops at the first error
+	var calls int
+	err = db.ForEachBlockedSkylinkInRange(ctx, start, start.Add(4*time.Hour), false, func(BlockedSkylink) error {
+		calls++
+		return errors.New("stop")
+	})
+	if err == nil || calls != 1 {
+		t.Fatal("unexpected outcome", calls, err)
+	}
+}
+
+// testBlocklistRevision verifies every change to the blocklist bumps its
+// revision, and that updates that don't change it leave it untouched.
+func testBlocklistRevision(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// assert the blocklist starts at the zero revision
+	rev, err := db.BlocklistRevision(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev.Revision != 0 || !rev.Timestamp.IsZero() {
+		t.Fatal("unexpected revision", rev)
+	}
+
+	// assertRevision is a helper that asserts the revision of the blocklist
+	assertRevision := func(expected int64) {
+		t.Helper()
+		rev, err := db.BlocklistRevision(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rev.Revision != expected || rev.Timestamp.IsZero() {
+			t.Fatal("unexpected revision", rev, expected)
+		}
+	}
+
+	// block two skylinks
+	hash1 := HashBytes([]byte("skylink_1"))
+	hash2 := HashBytes([]byte("skylink_2"))
+	for _, hash := range []Hash{hash1, hash2} {
+		err = db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+			Hash:           hash,
+			TimestampAdded: time.Now().UTC(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertRevision(2)
+
+	// confirm the block of the first one, twice, only the first time changes
+	// the blocklist
+	for i := 0; i < 2; i++ {
+		err = db.MarkSucceeded(ctx, []Hash{hash1}, time.Now().UTC())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertRevision(3)
+
+	// unblock the first one and cancel the second one
+	err = db.Unblock(ctx, hash1, "false positive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertRevision(4)
+	err = db.CancelPending(ctx, hash2, "false positive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertRevision(5)
+
+	// assert a failed unblock leaves the revision untouched
+	err = db.Unblock(ctx, hash1, "false positive")
+	if !errors.Contains(err, ErrNoDocumentsFound) {
+		t.Fatal("unexpected error", err)
+	}
+	assertRevision(5)
+
+	// assert reporting the unblocked skylink again blocks it again
+	err = db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+		Hash:           hash1,
+		TimestampAdded: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertRevision(6)
+}
+
+// testV2Pointers tests recording and fetching the V2 pointers of a blocked
+// skylink
+func testV2Pointers(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// assert we can't add a pointer to an unknown skylink
+	hash := HashBytes([]byte("skylink_v1"))
+	v2Hash1 := HashBytes([]byte("skylink_v2_1"))
+	v2Hash2 := HashBytes([]byte("skylink_v2_2"))
+	err := db.AddV2Pointer(ctx, hash, v2Hash1)
+	if !errors.Contains(err, ErrNoDocumentsFound) {
+		t.Fatal("unexpected error", err)
+	}
+	_, err = db.V2PointersFor(ctx, hash)
+	if !errors.Contains(err, ErrNoDocumentsFound) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// block the skylink
+	err = db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+		Hash:           hash,
+		TimestampAdded: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add two pointers, one of them twice
+	for _, v2Hash := range []Hash{v2Hash1, v2Hash2, v2Hash1} {
+		err = db.AddV2Pointer(ctx, hash, v2Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// assert both pointers were recorded once
+	pointers, err := db.V2PointersFor(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pointers) != 2 {
+		t.Fatalf("expected 2 pointers, instead it was %v", len(pointers))
+	}
+	if pointers[0].Hash != v2Hash1 || pointers[1].Hash != v2Hash2 {
+		t.Fatal("unexpected pointers", pointers)
+	}
+	if pointers[0].TimestampResolved.IsZero() {
+		t.Fatal("expected resolve timestamp to be set")
+	}
+
+	// block another skylink and point the first V2 skylink to it, as if it
+	// got updated to point elsewhere
+	hash2 := HashBytes([]byte("skylink_v1_2"))
+	err = db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+		Hash:           hash2,
+		TimestampAdded: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AddV2Pointer(ctx, hash2, v2Hash1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the stale pointer got replaced
+	pointers, err = db.V2PointersFor(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pointers) != 1 || pointers[0].Hash != v2Hash2 {
+		t.Fatal("unexpected pointers", pointers)
+	}
+	pointers, err = db.V2PointersFor(ctx, hash2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pointers) != 1 || pointers[0].Hash != v2Hash1 {
+		t.Fatal("unexpected pointers", pointers)
+	}
+
+	// assert unblocking the skylink it points to now unblocks the V2 skylink,
+	// even though the skylink it used to point to is still blocked
+	err = db.Unblock(ctx, hash2, "false positive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocked, err := db.IsBlocked(ctx, v2Hash1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocked {
+		t.Fatal("expected the V2 skylink to not be blocked")
+	}
+}
+
+// testBlockCountsBySource tests counting the blocked skylinks per source
+func testBlockCountsBySource(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// block three skylinks from source 'a', of which one yesterday, and one
+	// skylink from source 'b'
+	now := time.Now().UTC()
+	sources := []string{"a", "a", "a", "b"}
+	for i, source := range sources {
+		added := now
+		if i == 0 {
+			added = now.Add(-24 * time.Hour)
+		}
+		err := db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+			Hash:           HashBytes([]byte(fmt.Sprintf("skylink_%d", i))),
+			Reporter:       Reporter{Name: source},
+			TimestampAdded: added,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// assert the counts without time range
+	counts, err := db.BlockCountsBySource(ctx, time.Time{}, time.Time{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SourceCount{{"a", 3}, {"b", 1}}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Fatal("unexpected counts", counts)
+	}
+
+	// assert the counts within the last hour
+	counts, err = db.BlockCountsBySource(ctx, now.Add(-time.Hour), time.Time{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []SourceCount{{"a", 2}, {"b", 1}}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Fatal("unexpected counts", counts)
+	}
+}
+
+// testTestRecords verifies test records are blocked, but are excluded from the
+// blocklist and the reports unless they're explicitly included, and that they
+// can be purged.
+func testTestRecords(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// insert a regular and a test record
+	now := time.Now().UTC()
+	regular := HashBytes([]byte("regular"))
+	test := HashBytes([]byte("test"))
+	for _, bsl := range []BlockedSkylink{
+		{Hash: regular, Reporter: Reporter{Name: "a"}, TimestampAdded: now},
+		{Hash: test, Reporter: Reporter{Name: "a"}, Test: true, TimestampAdded: now},
+	} {
+		err := db.CreateBlockedSkylink(ctx, &bsl)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// assert the sweep picks up both
+	toBlock, err := db.HashesToBlock(ctx, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toBlock) != 2 {
+		t.Fatal("unexpected hashes to block", toBlock)
+	}
+
+	// assert the test record is excluded by default and included on request
+	for _, includeTest := range []bool{false, true} {
+		expected := 1
+		if includeTest {
+			expected = 2
+		}
+		blocked, _, err := db.BlockedHashes(ctx, 1, 0, 10, includeTest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(blocked) != expected {
+			t.Fatal("unexpected blocked hashes", includeTest, len(blocked))
+		}
+		count, err := db.CountBlockedHashes(ctx, includeTest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != int64(expected) {
+			t.Fatal("unexpected count", includeTest, count)
+		}
+		skylinks, err := db.BlockedSkylinksInRange(ctx, now.Add(-time.Hour), now.Add(time.Hour), includeTest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(skylinks) != expected {
+			t.Fatal("unexpected skylinks in range", includeTest, len(skylinks))
+		}
+		counts, err := db.BlockCountsBySource(ctx, time.Time{}, time.Time{}, includeTest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(counts, []SourceCount{{"a", expected}}) {
+			t.Fatal("unexpected counts", includeTest, counts)
+		}
+	}
+
+	// purge the test records
+	removed, err := db.PurgeTestRecords(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Fatal("unexpected number of purged records", removed)
+	}
+	bsl, err := db.FindByHash(ctx, test)
+	if err != nil || bsl != nil {
+		t.Fatal("expected test record to be purged", bsl, err)
+	}
+	bsl, err = db.FindByHash(ctx, regular)
+	if err != nil || bsl == nil {
+		t.Fatal("expected regular record to remain", err)
+	}
+}
+
+// testEnsureTTLIndex is a unit test that verifies the TTL index is created and
+// updated idempotently
+func testEnsureTTLIndex(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// expireAfter is a helper that returns the retention of the TTL index
+	coll := db.staticSweepStats
+	expireAfter := func() int32 {
+		cur, err := coll.Indexes().List(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var idxs []bson.M
+		err = cur.All(ctx, &idxs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, idx := range idxs {
+			if idx["name"] == ttlIndexName {
+				return idx["expireAfterSeconds"].(int32)
+			}
+		}
+		t.Fatal("TTL index not found")
+		return 0
+	}
+
+	// assert the index was created with the default retention
+	if expireAfter() != int32(defaultDiagnosticsRetention.Seconds()) {
+		t.Fatal("unexpected retention", expireAfter())
+	}
+
+	// assert ensuring the index again is a no-op
+	err := ensureTTLIndex(ctx, coll, "timestamp", defaultDiagnosticsRetention)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the retention gets updated
+	err = ensureTTLIndex(ctx, coll, "timestamp", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expireAfter() != 3600 {
+		t.Fatal("unexpected retention", expireAfter())
+	}
+
+	// assert the skylinks collection has no TTL index
+	found, err := hasIndex(ctx, db.staticSkylinks, ttlIndexName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Fatal("blocked skylinks should never expire")
+	}
+}
+
+// testSourceEnabled tests disabling and enabling a report source, the records
+// of a disabled source are skipped by the sweep until it's enabled again.
+func testSourceEnabled(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// add a skylink reported by the suspect source, one reported by both
+	// sources and one reported by the other source
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	suspect := Reporter{Name: "suspect"}
+	other := Reporter{Name: "other"}
+	onlySuspect := HashBytes([]byte("skylink_suspect"))
+	both := HashBytes([]byte("skylink_both"))
+	onlyOther := HashBytes([]byte("skylink_other"))
+	reports := []struct {
+		hash     Hash
+		reporter Reporter
+		added    time.Time
+	}{
+		{onlySuspect, suspect, now.Add(-time.Hour)},
+		{both, other, now.Add(-time.Minute)},
+		{both, suspect, now.Add(-time.Minute)},
+		{onlyOther, other, now.Add(-time.Minute)},
+	}
+	for _, report := range reports {
+		err := db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+			Hash:           report.hash,
+			Reporter:       report.reporter,
+			TimestampAdded: report.added,
+		})
+		if err != nil && !errors.Contains(err, ErrSkylinkExists) {
+			t.Fatal(err)
+		}
+	}
+
+	// disable the suspect source twice, assert it's listed once
+	for i := 0; i < 2; i++ {
+		err := db.SetSourceEnabled(ctx, suspect.Name, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	disabled, err := db.DisabledSources(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(disabled) != 1 || disabled[0] != suspect.Name {
+		t.Fatal("unexpected disabled sources", disabled)
+	}
+
+	// assert only the skylink reported by the suspect source alone is skipped
+	hashes, err := db.HashesToBlock(ctx, now.Add(-2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 2 || hashes[0] == onlySuspect || hashes[1] == onlySuspect {
+		t.Fatal("unexpected hashes", hashes)
+	}
+
+	// sweep past the skylink, then enable the source again and assert the
+	// latest block timestamp got rewound so the skylink is picked up
+	err = db.SetLatestBlockTimestamp(ctx, DefaultSkydTarget, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.SetSourceEnabled(ctx, suspect.Name, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabled, err = db.DisabledSources(ctx)
+	if err != nil || len(disabled) != 0 {
+		t.Fatal("unexpected disabled sources", disabled, err)
+	}
+	latest, err := db.LatestBlockTimestamp(ctx, DefaultSkydTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !latest.Equal(now.Add(-time.Hour)) {
+		t.Fatal("unexpected latest block timestamp", latest)
+	}
+	hashes, err = db.HashesToBlock(ctx, latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 3 || hashes[0] != onlySuspect {
+		t.Fatal("unexpected hashes", hashes)
+	}
+
+	// assert an empty source is rejected
+	err = db.SetSourceEnabled(ctx, "", false)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// testSourceCheckpoint tests setting and getting the checkpoint of a report
+// source
+func testSourceCheckpoint(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// assert an unknown source has no checkpoint
+	checkpoint, err := db.SourceCheckpoint(ctx, "source_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint != "" {
+		t.Fatal("unexpected checkpoint", checkpoint)
+	}
+
+	// set and overwrite the checkpoint
+	for _, cp := range []string{"1", "2"} {
+		err = db.SetSourceCheckpoint(ctx, "source_a", cp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkpoint, err = db.SourceCheckpoint(ctx, "source_a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if checkpoint != cp {
+			t.Fatal("unexpected checkpoint", checkpoint)
+		}
+	}
+
+	// assert other sources are unaffected
+	checkpoint, err = db.SourceCheckpoint(ctx, "source_b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint != "" {
+		t.Fatal("unexpected checkpoint", checkpoint)
+	}
+}
+
+// testQuarantineMalformed verifies skylinks with a malformed hash get
+// quarantined and are no longer picked up by the sweeps.
+func testQuarantineMalformed(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// insert a valid skylink
+	now := time.Now().UTC()
+	hash := HashBytes([]byte("skylink_1"))
+	err := db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+		Hash:           hash,
+		TimestampAdded: now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// insert skylinks with a malformed hash directly into the collection,
+	// one of which failed to get blocked before
+	malformed := []interface{}{"", nil, emptyHash, "not_a_hash"}
+	for i, h := range malformed {
+		_, err = db.staticSkylinks.InsertOne(ctx, bson.M{
+			"hash":            h,
+			"failed":          i == 0,
+			"timestamp_added": now,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// quarantine the malformed skylinks
+	n, err := db.QuarantineMalformed(ctx, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(malformed) {
+		t.Fatalf("expected %v skylinks to be quarantined, instead it was %v", len(malformed), n)
+	}
+
+	// assert the sweep only returns the valid skylink
+	toBlock, err := db.HashesToBlock(ctx, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toBlock) != 1 || toBlock[0] != hash {
+		t.Fatalf("unexpected hashes to block %v", toBlock)
+	}
+	toRetry, err := db.HashesToRetry(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toRetry) != 0 {
+		t.Fatalf("unexpected hashes to retry %v", toRetry)
+	}
+
+	// assert the malformed skylinks are marked as invalid
+	count, err := db.staticSkylinks.CountDocuments(ctx, bson.M{"invalid": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != int64(len(malformed)) {
+		t.Fatalf("expected %v invalid skylinks, instead it was %v", len(malformed), count)
+	}
+
+	// assert quarantining again is a no-op
+	n, err = db.QuarantineMalformed(ctx, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expected no skylinks to be quarantined, instead it was %v", n)
+	}
+}
+
+// testReportIDs is a unit test that verifies report IDs are assigned to blocked
+// skylinks and can be looked up by hash.
+func testReportIDs(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// block a skylink without report ID and one with a report ID
+	hash1 := HashBytes([]byte("skylink_1"))
+	hash2 := HashBytes([]byte("skylink_2"))
+	err := db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+		Hash:           hash1,
+		TimestampAdded: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+		Hash:           hash2,
+		ReportID:       "myreport",
+		TimestampAdded: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert a report ID got generated for the first skylink
+	reportIDs, err := db.ReportIDs(ctx, []Hash{hash1, hash2, HashBytes([]byte("skylink_3"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reportIDs) != 2 {
+		t.Fatalf("expected 2 report IDs, instead it was %v", len(reportIDs))
+	}
+	if len(reportIDs[hash1]) != 2*reportIDSize {
+		t.Fatal("unexpected report ID", reportIDs[hash1])
+	}
+	if reportIDs[hash2] != "myreport" {
+		t.Fatal("unexpected report ID", reportIDs[hash2])
+	}
+
+	// assert the report ID is recorded in the history
+	history, err := db.BlockHistory(ctx, hash2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].ReportID != "myreport" {
+		t.Fatal("unexpected history", history)
+	}
+}
+
+// testIsBlocked is a unit test that covers the 'IsBlocked' method.
+func testIsBlocked(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// assert an unknown hash is not blocked
+	hash := HashBytes([]byte("skylink_1"))
+	v2Hash := HashBytes([]byte("skylink_1_v2"))
+	blocked, err := db.IsBlocked(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocked {
+		t.Fatal("expected hash to not be blocked")
+	}
+
+	// block the skylink and record a v2 pointer
+	err = db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+		Hash:           hash,
+		TimestampAdded: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AddV2Pointer(ctx, hash, v2Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert both the hash and the v2 hash are blocked
+	for _, h := range []Hash{hash, v2Hash} {
+		blocked, err = db.IsBlocked(ctx, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !blocked {
+			t.Fatal("expected hash to be blocked", h)
+		}
+	}
+
+	// unblock the skylink and assert it's no longer blocked
+	err = db.Unblock(ctx, hash, "false positive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range []Hash{hash, v2Hash} {
+		blocked, err = db.IsBlocked(ctx, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blocked {
+			t.Fatal("expected hash to not be blocked", h)
+		}
+	}
+}
+
+// testRecentHashesToBlock is a unit test that covers the
+// 'RecentHashesToBlock' method.
+func testRecentHashesToBlock(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// insert skylinks that were added a minute apart, and one that got
+	// blocked already
+	now := time.Now().UTC().Truncate(time.Second)
+	var skylinks []BlockedSkylink
+	for i := 0; i < 5; i++ {
+		skylinks = append(skylinks, BlockedSkylink{
+			Hash:           HashBytes([]byte(fmt.Sprintf("skylink_%d", i))),
+			TimestampAdded: now.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	_, err := db.CreateBlockedSkylinkBulk(ctx, skylinks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.MarkSucceeded(ctx, []Hash{skylinks[4].Hash}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the most recently added hashes are returned first, skipping the
+	// one that got blocked
+	hashes, err := db.RecentHashesToBlock(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Hash{skylinks[3].Hash, skylinks[2].Hash}
+	if !reflect.DeepEqual(hashes, expected) {
+		t.Fatal("unexpected hashes", hashes)
+	}
+	hashes, err = db.RecentHashesToBlock(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 4 {
+		t.Fatal("unexpected number of hashes", len(hashes))
+	}
+
+	// assert the limit has to be positive
+	_, err = db.RecentHashesToBlock(ctx, 0)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
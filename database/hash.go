@@ -1,15 +1,49 @@
 package database
 
 import (
+	"encoding/hex"
 	"fmt"
 	"time"
 
 	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
 	"gitlab.com/SkynetLabs/skyd/skymodules"
 	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
 	"go.sia.tech/siad/crypto"
+	"go.sia.tech/siad/types"
+)
+
+const (
+	// BlockEventBlocked is the type of the event that gets recorded when a
+	// skylink gets blocked.
+	BlockEventBlocked = "blocked"
+
+	// BlockEventUnblocked is the type of the event that gets recorded when a
+	// skylink gets unblocked.
+	BlockEventUnblocked = "unblocked"
+
+	// BlockEventCancelled is the type of the event that gets recorded when
+	// the block of a skylink gets cancelled before it was sent to skyd.
+	BlockEventCancelled = "cancelled"
+
+	// BlockEventSkipped is the type of the event that gets recorded when the
+	// blocker's pre-block policy decided a skylink should not be blocked.
+	BlockEventSkipped = "skipped"
+
+	// BlockEventUnverified is the type of the event that gets recorded when
+	// skyd accepted the block of a skylink but verifying it found the hash
+	// missing from skyd's blocklist.
+	BlockEventUnverified = "unverified"
+
+	// BlockEventSourceRevoked is the type of the event that gets recorded
+	// when one of the sources that reported a skylink got revoked, but the
+	// skylink stays blocked because other sources reported it as well.
+	BlockEventSourceRevoked = "source_revoked"
+
+	// reportIDSize is the number of random bytes in a generated report ID.
+	reportIDSize = 16
 )
 
 // Hash is a struct that embeds the crypto.Hash, allowing us to implement the
@@ -18,19 +52,58 @@ type Hash struct {
 	crypto.Hash
 }
 
-// NewHash returns the Hash of the given skylink.
+// NewHash returns the Hash of the given skylink. The Hash of a V2 skylink is
+// the Hash of its registry entry ID.
 func NewHash(sl skymodules.Skylink) Hash {
+	if sl.IsSkylinkV2() {
+		return Hash{crypto.HashObject(sl.RegistryEntryID())}
+	}
 	return Hash{crypto.HashObject(sl.MerkleRoot())}
 }
 
+// HashFromSkylink returns the Hash of the given skylink, which can be base32
+// or base64 encoded. V2 skylinks are not resolved, the blocker blocks the hash
+// of the V1 skylink they resolve to, so V2 skylinks have to be resolved first
+// to get the hash that ends up in the blocklist.
+func HashFromSkylink(skylink string) (Hash, error) {
+	var sl skymodules.Skylink
+	err := sl.LoadString(skylink)
+	if err != nil {
+		return Hash{}, errors.AddContext(err, "invalid skylink")
+	}
+	return NewHash(sl), nil
+}
+
+// HashFromRegistryEntry returns the Hash of the registry entry with the given
+// public key and tweak, it's the Hash of the V2 skylink that points to it.
+func HashFromRegistryEntry(spk types.SiaPublicKey, tweak crypto.Hash) Hash {
+	return NewHash(skymodules.NewSkylinkV2(spk, tweak))
+}
+
+// NewReportID returns a new random report ID. The report ID identifies the
+// report that caused a skylink to get blocked and is included in all log lines
+// concerning that skylink, allowing to trace a report through the system.
+func NewReportID() string {
+	return hex.EncodeToString(fastrand.Bytes(reportIDSize))
+}
+
 // HashBytes returns the Hash of the given bytes.
 func HashBytes(b []byte) Hash {
 	return Hash{crypto.HashBytes(b)}
 }
 
+// CanonicalHash returns the canonical representation of the given hash, which
+// is lowercase hex. Hashes are persisted in their canonical representation, so
+// it's the key of the unique index on the hash, and hashes are deduplicated in
+// memory on it as well, which ensures the two never disagree on whether two
+// hashes are equal.
+func CanonicalHash(h Hash) string {
+	return h.Hash.String()
+}
+
 // MarshalBSONValue implements the bsoncodec.ValueMarshaler interface.
 func (h Hash) MarshalBSONValue() (bsontype.Type, []byte, error) {
-	return bsontype.String, bsoncore.AppendString(nil, h.String()), nil
+	return bsontype.String, bsoncore.AppendString(nil, CanonicalHash(h)), nil
 }
 
 // UnmarshalBSONValue implements the bsoncodec.ValueUnmarshaler interface.
@@ -56,13 +129,13 @@ func DiffHashes(array []Hash, others ...[]Hash) []Hash {
 	seen := make(map[string]struct{})
 	for _, other := range others {
 		for _, hash := range other {
-			seen[hash.String()] = struct{}{}
+			seen[CanonicalHash(hash)] = struct{}{}
 		}
 	}
 
 	var diff []Hash
 	for _, hash := range array {
-		if _, exists := seen[hash.String()]; !exists {
+		if _, exists := seen[CanonicalHash(hash)]; !exists {
 			diff = append(diff, hash)
 		}
 	}
@@ -78,18 +151,102 @@ type AllowListedSkylink struct {
 	TimestampAdded time.Time          `bson:"timestamp_added"`
 }
 
-// BlockedSkylink is a skylink blocked by an external request.
+// BlockedSkylink is a skylink blocked by an external request. There's only
+// ever one blocked skylink per hash, subsequent reports of the same skylink
+// are merged into it, where the tags are added to the skylink's tags and the
+// reporters are added to its reporters. The reporter that reported the
+// skylink first is kept separately. Annotations are free-form notes of the
+// moderators, they are updated through UpdateAnnotations.
 type BlockedSkylink struct {
 	ID                primitive.ObjectID `bson:"_id,omitempty"`
+	Annotations       map[string]string  `bson:"annotations,omitempty"`
+	BlockedAt         time.Time          `bson:"blocked_at,omitempty"`
 	Failed            bool               `bson:"failed"`
 	Hash              Hash               `bson:"hash"`
+	History           []BlockEvent       `bson:"history,omitempty"`
 	Invalid           bool               `bson:"invalid"`
+	LegalBasis        string             `bson:"legal_basis,omitempty"`
+	Metadata          *SkylinkMetadata   `bson:"metadata,omitempty"`
+	PortalsFailed     []string           `bson:"portals_failed,omitempty"`
+	ReportID          string             `bson:"report_id,omitempty"`
 	Reporter          Reporter           `bson:"reporter"`
+	RegistryEntry     *RegistryEntry     `bson:"registry_entry,omitempty"`
+	Reporters         []Reporter         `bson:"reporters,omitempty"`
 	Reverted          bool               `bson:"reverted"`
+	RevertedReason    string             `bson:"reverted_reason,omitempty"`
 	RevertedTags      []string           `bson:"reverted_tags"`
+	Skipped           bool               `bson:"skipped,omitempty"`
+	SkippedReason     string             `bson:"skipped_reason,omitempty"`
 	Tags              []string           `bson:"tags"`
+	Test              bool               `bson:"test,omitempty"`
 	TimestampAdded    time.Time          `bson:"timestamp_added"`
 	TimestampReverted time.Time          `bson:"timestamp_reverted"`
+	V2Pointers        []V2Pointer        `bson:"v2_pointers,omitempty"`
+}
+
+// ReportedByOthers returns true if the skylink was reported by any source
+// other than the given one. The source is the name of the reporter.
+func (bsl BlockedSkylink) ReportedByOthers(source string) bool {
+	if bsl.Reporter.Name != source {
+		return true
+	}
+	for _, reporter := range bsl.Reporters {
+		if reporter.Name != source {
+			return true
+		}
+	}
+	return false
+}
+
+// SourceCount holds the number of skylinks that were blocked following reports
+// of a certain source. The source is the reporter's name, which for skylinks
+// that were synced from other portals is the portal's URL.
+type SourceCount struct {
+	Source string `bson:"_id"`
+	Count  int    `bson:"count"`
+}
+
+// SkylinkMetadata describes the content of a blocked skylink, as reported by
+// skyd. It's fetched on a best-effort basis when the skylink gets reported and
+// allows moderators to see what kind of content got blocked without having to
+// download it.
+type SkylinkMetadata struct {
+	ContentType      string    `bson:"content_type,omitempty"`
+	Filename         string    `bson:"filename,omitempty"`
+	Length           uint64    `bson:"length"`
+	TimestampFetched time.Time `bson:"timestamp_fetched"`
+}
+
+// V2Pointer is a reference to a V2 skylink that resolved to the blocked
+// skylink. It allows tracing which V2 reports led to a skylink being blocked.
+// Only the hash of the V2 skylink is stored, seeing as we don't want to persist
+// abusive skylinks. Note that the V2 skylink can be updated to point elsewhere,
+// which is why we keep track of the time at which it was resolved.
+type V2Pointer struct {
+	Hash              Hash      `bson:"hash"`
+	TimestampResolved time.Time `bson:"timestamp_resolved"`
+}
+
+// RegistryEntry is set on blocked skylinks that are the registry entry of a
+// reported V2 skylink rather than a V1 skylink. Blocking the registry entry
+// blocks the V2 skylink itself, so it stays blocked when it's updated to point
+// to other content. ResolvedTo is the hash of the V1 skylink the V2 skylink
+// resolved to when it was reported, which is blocked separately.
+type RegistryEntry struct {
+	ResolvedTo        Hash      `bson:"resolved_to"`
+	TimestampResolved time.Time `bson:"timestamp_resolved"`
+}
+
+// BlockEvent is an event in the lifecycle of a blocked skylink. A skylink can
+// be blocked and unblocked multiple times, every time that happens an event is
+// appended to the skylink's history. Block events record the legal basis of
+// the block, if one was given.
+type BlockEvent struct {
+	Type       string    `bson:"type"`
+	LegalBasis string    `bson:"legal_basis,omitempty"`
+	Reason     string    `bson:"reason,omitempty"`
+	ReportID   string    `bson:"report_id,omitempty"`
+	Timestamp  time.Time `bson:"timestamp"`
 }
 
 // Validate is a small helper function that ensures the required properties are
@@ -2,9 +2,12 @@ package database
 
 import (
 	"context"
+	"strings"
 	"testing"
 
+	"gitlab.com/SkynetLabs/skyd/skymodules"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
 	"go.sia.tech/siad/crypto"
 )
 
@@ -96,3 +99,89 @@ func TestDiffHashes(t *testing.T) {
 		t.Fatal("unexpected diff", output)
 	}
 }
+
+// TestCanonicalHash verifies hashes that differ only in the case of their hex
+// representation share a canonical hash, which is what they are persisted as.
+func TestCanonicalHash(t *testing.T) {
+	t.Parallel()
+
+	hash := HashBytes([]byte("skylink"))
+	var upper Hash
+	err := upper.LoadString(strings.ToUpper(hash.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if CanonicalHash(upper) != CanonicalHash(hash) || CanonicalHash(hash) != strings.ToLower(hash.String()) {
+		t.Fatal("unexpected canonical hash", CanonicalHash(upper), CanonicalHash(hash))
+	}
+
+	// assert the persisted value is the canonical hash
+	_, b, err := upper.MarshalBSONValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str, _, ok := bsoncore.ReadString(b); !ok || str != CanonicalHash(hash) {
+		t.Fatal("unexpected persisted hash", str)
+	}
+
+	// assert the in-memory deduplication agrees
+	if diff := DiffHashes([]Hash{upper}, []Hash{hash}); len(diff) != 0 {
+		t.Fatal("unexpected diff", diff)
+	}
+}
+
+// TestHashFromSkylink verifies the hash of a skylink is independent of its
+// encoding and that invalid skylinks are rejected.
+func TestHashFromSkylink(t *testing.T) {
+	t.Parallel()
+
+	// the same skylink, base64 and base32 encoded
+	base64 := "BAAWi3ou51qCH24Im0ESS-5_gKg60qGIYtta-ryrl1kBnQ"
+	var sl skymodules.Skylink
+	err := sl.LoadString(base64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base32 := sl.Base32EncodedString()
+
+	for _, str := range []string{base64, base32} {
+		hash, err := HashFromSkylink(str)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash != NewHash(sl) {
+			t.Fatal("unexpected hash", hash)
+		}
+	}
+
+	// assert malformed skylinks are rejected
+	for _, str := range []string{"", "not a skylink", base64[:45]} {
+		_, err = HashFromSkylink(str)
+		if err == nil {
+			t.Fatal("expected error", str)
+		}
+	}
+}
+
+// TestReportedByOthers is a unit test for the 'ReportedByOthers' method.
+func TestReportedByOthers(t *testing.T) {
+	t.Parallel()
+
+	revoked := Reporter{Name: "revoked"}
+	legit := Reporter{Name: "legit"}
+	tests := []struct {
+		bsl    BlockedSkylink
+		others bool
+	}{
+		{BlockedSkylink{Reporter: revoked}, false},
+		{BlockedSkylink{Reporter: revoked, Reporters: []Reporter{{Name: "revoked", Email: "other@example.com"}}}, false},
+		{BlockedSkylink{Reporter: revoked, Reporters: []Reporter{legit}}, true},
+		{BlockedSkylink{Reporter: legit, Reporters: []Reporter{revoked}}, true},
+		{BlockedSkylink{Reporter: legit}, true},
+	}
+	for _, test := range tests {
+		if test.bsl.ReportedByOthers(revoked.Name) != test.others {
+			t.Fatal("unexpected outcome", test.bsl)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// IntegrityMalformedHash identifies skylinks with a missing, empty or
+	// otherwise malformed hash. They can't be blocked, nor repaired, seeing
+	// as we never store the skylink itself.
+	IntegrityMalformedHash = "malformedhash"
+
+	// IntegrityNonCanonicalHash identifies skylinks with a well formed hash
+	// that is not in its canonical, lowercase, representation. They are
+	// repaired by rewriting the hash, unless another skylink holds the
+	// canonical hash already, those are reported by CheckHashConsistency.
+	IntegrityNonCanonicalHash = "noncanonicalhash"
+
+	// IntegrityMissingTimestamp identifies skylinks without the time they
+	// were added, the sweeps never pick them up.
+	IntegrityMissingTimestamp = "missingtimestamp"
+
+	// IntegrityConflictingState identifies skylinks that are blocked but
+	// also marked as failed, invalid or unblocked.
+	IntegrityConflictingState = "conflictingstate"
+
+	// IntegrityMissingRevertTimestamp identifies skylinks that got unblocked
+	// or cancelled without the time at which that happened.
+	IntegrityMissingRevertTimestamp = "missingreverttimestamp"
+
+	// IntegrityStranded identifies skylinks that are pending but were added
+	// too long before the latest block timestamp to be picked up by the
+	// sweeps. They are repaired by marking them as failed, which hands them
+	// to the retry loop.
+	IntegrityStranded = "stranded"
+)
+
+type (
+	// IntegrityScanOptions configure ScanIntegrity. SampleSize is the number
+	// of IDs that are returned per problem. StrandedBefore is the latest
+	// block timestamp of the sweeps, pending skylinks that fall outside of
+	// the range the sweeps look at are considered stranded, they are not
+	// checked if it's zero. Repair enables repairing the problems that are
+	// trivially fixable.
+	IntegrityScanOptions struct {
+		Repair         bool
+		SampleSize     int
+		StrandedBefore time.Time
+	}
+
+	// IntegrityReport is the outcome of ScanIntegrity. Scanned is the number
+	// of skylinks in the collection, Problems holds an entry for every type
+	// of problem that is checked, including the ones that were not found.
+	IntegrityReport struct {
+		Scanned  int64
+		Problems []IntegrityProblem
+	}
+
+	// IntegrityProblem describes the skylinks that suffer from a certain
+	// problem. Count is the number of skylinks that were found before
+	// repairing them, Repaired is the number of those that got repaired and
+	// SampleIDs holds the IDs of some of them.
+	IntegrityProblem struct {
+		Type      string
+		Count     int64
+		Repaired  int64
+		SampleIDs []primitive.ObjectID
+	}
+
+	// integrityCheck is a type of problem along with the filter that matches
+	// the skylinks that suffer from it and the function that repairs them,
+	// which is nil if they can't be repaired.
+	integrityCheck struct {
+		problem string
+		filter  bson.M
+		repair  func(ctx context.Context, filter bson.M) (int64, error)
+	}
+)
+
+// ScanIntegrity scans the skylinks collection for records that are malformed
+// or in an inconsistent state and returns a report holding the number of
+// skylinks per problem, along with a sample of their IDs. If repair is enabled
+// the problems that are trivially fixable are repaired.
+//
+// NOTE: the problems are counted with queries that can't use an index, every
+// check scans the entire collection. It is meant to run periodically, e.g.
+// weekly, not as part of the sweeps.
+func (db *DB) ScanIntegrity(ctx context.Context, opts IntegrityScanOptions) (IntegrityReport, error) {
+	if opts.SampleSize < 0 {
+		return IntegrityReport{}, errors.New("sample size can't be negative")
+	}
+
+	scanned, err := db.staticSkylinks.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return IntegrityReport{}, errors.AddContext(err, "failed to count skylinks")
+	}
+	report := IntegrityReport{Scanned: scanned}
+	checks, err := db.integrityChecks(ctx, opts.StrandedBefore)
+	if err != nil {
+		return IntegrityReport{}, err
+	}
+	for _, check := range checks {
+		problem, err := db.runIntegrityCheck(ctx, check, opts)
+		if err != nil {
+			return IntegrityReport{}, errors.AddContext(err, fmt.Sprintf("failed to check for %v", check.problem))
+		}
+		report.Problems = append(report.Problems, problem)
+	}
+	return report, nil
+}
+
+// integrityChecks returns the checks ScanIntegrity runs, stranded skylinks are
+// only checked for if strandedBefore is not zero.
+func (db *DB) integrityChecks(ctx context.Context, strandedBefore time.Time) ([]integrityCheck, error) {
+	// NOTE: $ne: true is not the same as $eq: false and the zero time is
+	// stored as a date, hence we consider every date before the epoch unset
+	unset := bson.M{"$not": bson.M{"$gt": time.Unix(0, 0).UTC()}}
+	checks := []integrityCheck{
+		{
+			problem: IntegrityMalformedHash,
+			filter: bson.M{"$or": bson.A{
+				bson.M{"hash": bson.M{"$not": hashRegex}},
+				bson.M{"hash": emptyHash},
+			}},
+		},
+		{
+			problem: IntegrityNonCanonicalHash,
+			filter:  bson.M{"$and": nonCanonicalHash},
+			repair:  db.repairNonCanonicalHashes,
+		},
+		{
+			problem: IntegrityMissingTimestamp,
+			filter:  bson.M{"timestamp_added": unset},
+		},
+		{
+			problem: IntegrityConflictingState,
+			filter: bson.M{
+				"blocked_at": bson.M{"$exists": true},
+				"$or": bson.A{
+					bson.M{"failed": true},
+					bson.M{"invalid": true},
+					bson.M{"reverted": true},
+				},
+			},
+		},
+		{
+			problem: IntegrityMissingRevertTimestamp,
+			filter: bson.M{
+				"reverted":           true,
+				"timestamp_reverted": unset,
+			},
+		},
+	}
+	if strandedBefore.IsZero() {
+		return checks, nil
+	}
+
+	// skylinks that are held back by the block delay are not stranded, and
+	// neither are the ones the sweep would pick up
+	before := strandedBefore.Add(-db.staticSweepLookback).Add(-db.MaxBlockDelay())
+	stranded := bson.M{
+		"blocked_at":      bson.M{"$exists": false},
+		"failed":          bson.M{"$ne": true},
+		"hash":            wellFormedHash,
+		"invalid":         bson.M{"$ne": true},
+		"reverted":        bson.M{"$ne": true},
+		"skipped":         bson.M{"$ne": true},
+		"timestamp_added": bson.M{"$gt": time.Unix(0, 0).UTC(), "$lt": before},
+	}
+
+	// the skylinks that were only reported by disabled sources are pending
+	// on purpose
+	disabled, err := db.DisabledSources(ctx)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to fetch disabled sources")
+	}
+	if len(disabled) > 0 {
+		stranded["$or"] = enabledSourcesFilter(disabled)
+	}
+
+	// and so are the ones that await confirmation by more reporters
+	if threshold := db.staticReportThreshold.filter(); threshold != nil {
+		stranded["$and"] = bson.A{threshold}
+	}
+	return append(checks, integrityCheck{
+		problem: IntegrityStranded,
+		filter:  stranded,
+		repair:  db.repairStranded,
+	}), nil
+}
+
+// runIntegrityCheck counts the skylinks that match the given check, fetches a
+// sample of their IDs and repairs them if that's enabled.
+func (db *DB) runIntegrityCheck(ctx context.Context, check integrityCheck, opts IntegrityScanOptions) (IntegrityProblem, error) {
+	problem := IntegrityProblem{Type: check.problem}
+	count, err := db.staticSkylinks.CountDocuments(ctx, check.filter)
+	if err != nil {
+		return IntegrityProblem{}, errors.AddContext(err, "failed to count skylinks")
+	}
+	problem.Count = count
+	if count == 0 {
+		return problem, nil
+	}
+
+	// fetch a sample of the IDs
+	if opts.SampleSize > 0 {
+		findOpts := options.Find()
+		findOpts.SetLimit(int64(opts.SampleSize))
+		findOpts.SetProjection(bson.M{"_id": 1})
+		findOpts.SetSort(bson.M{"_id": 1})
+		c, err := db.staticSkylinks.Find(ctx, check.filter, findOpts)
+		if err != nil {
+			return IntegrityProblem{}, errors.AddContext(err, "failed to fetch sample")
+		}
+		var docs []struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		err = c.All(ctx, &docs)
+		if err != nil {
+			return IntegrityProblem{}, errors.AddContext(err, "failed to decode sample")
+		}
+		for _, doc := range docs {
+			problem.SampleIDs = append(problem.SampleIDs, doc.ID)
+		}
+	}
+
+	// repair the skylinks
+	if opts.Repair && check.repair != nil {
+		problem.Repaired, err = check.repair(ctx, check.filter)
+		if err != nil {
+			return IntegrityProblem{}, errors.AddContext(err, "failed to repair skylinks")
+		}
+	}
+	return problem, nil
+}
+
+// repairNonCanonicalHashes rewrites the non-canonical hashes of the skylinks
+// that match the given filter to their canonical representation. Skylinks
+// whose canonical hash is held by another skylink already are left alone, they
+// have to be merged. It returns the number of skylinks that got repaired.
+func (db *DB) repairNonCanonicalHashes(ctx context.Context, filter bson.M) (int64, error) {
+	opts := options.Find()
+	opts.SetProjection(bson.M{"_id": 1, "hash": 1})
+	c, err := db.staticSkylinks.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, err
+	}
+	var docs []rawHashDoc
+	err = c.All(ctx, &docs)
+	if err != nil {
+		return 0, err
+	}
+
+	var repaired int64
+	for _, doc := range docs {
+		var h Hash
+		if h.LoadString(doc.Hash) != nil {
+			continue
+		}
+		res, err := db.staticSkylinks.UpdateOne(ctx, bson.M{
+			"_id":  doc.ID,
+			"hash": doc.Hash,
+		}, bson.M{
+			"$set": bson.M{"hash": CanonicalHash(h)},
+		})
+		if isDuplicateKey(err) {
+			continue
+		}
+		if err != nil {
+			return repaired, err
+		}
+		repaired += res.ModifiedCount
+	}
+	if repaired > 0 {
+		db.bumpBlocklistRevision(ctx)
+	}
+	return repaired, nil
+}
+
+// repairStranded marks the skylinks that match the given filter as failed, the
+// retry loop picks them up regardless of the time they were added. It returns
+// the number of skylinks that got repaired.
+func (db *DB) repairStranded(ctx context.Context, filter bson.M) (int64, error) {
+	res, err := db.staticSkylinks.UpdateMany(ctx, filter, bson.M{
+		"$set": bson.M{"failed": true},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
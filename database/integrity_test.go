@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// testScanIntegrity is a unit test that covers the 'ScanIntegrity' method.
+func testScanIntegrity(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// insert a healthy skylink, which is blocked, and a skylink that suffers
+	// from every problem
+	now := time.Now().UTC()
+	old := now.Add(-30 * 24 * time.Hour)
+	healthy := HashBytes([]byte("healthy"))
+	stranded := HashBytes([]byte("stranded"))
+	noncanonical := HashBytes([]byte("noncanonical"))
+	docs := []interface{}{
+		bson.M{"hash": healthy.String(), "timestamp_added": now, "blocked_at": now},
+		bson.M{"hash": "malformed", "timestamp_added": now},
+		bson.M{"hash": strings.ToUpper(noncanonical.String()), "timestamp_added": now, "blocked_at": now},
+		bson.M{"hash": HashBytes([]byte("notimestamp")).String()},
+		bson.M{"hash": HashBytes([]byte("conflicting")).String(), "timestamp_added": now, "blocked_at": now, "invalid": true},
+		bson.M{"hash": HashBytes([]byte("noreverttimestamp")).String(), "timestamp_added": now, "reverted": true},
+		bson.M{"hash": stranded.String(), "timestamp_added": old},
+	}
+	_, err := db.staticSkylinks.InsertMany(ctx, docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the problems are found, stranded skylinks are only checked for
+	// if the latest block timestamp is given
+	report, err := db.ScanIntegrity(ctx, IntegrityScanOptions{SampleSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Scanned != int64(len(docs)) || len(report.Problems) != 5 {
+		t.Fatal("unexpected report", report)
+	}
+	report, err = db.ScanIntegrity(ctx, IntegrityScanOptions{SampleSize: 1, StrandedBefore: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 6 {
+		t.Fatal("unexpected number of problems", len(report.Problems))
+	}
+	for _, problem := range report.Problems {
+		if problem.Count != 1 || problem.Repaired != 0 || len(problem.SampleIDs) != 1 {
+			t.Fatal("unexpected problem", problem)
+		}
+	}
+
+	// assert the trivially fixable problems are repaired
+	report, err = db.ScanIntegrity(ctx, IntegrityScanOptions{Repair: true, StrandedBefore: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range report.Problems {
+		repairable := problem.Type == IntegrityNonCanonicalHash || problem.Type == IntegrityStranded
+		if repairable && problem.Repaired != 1 {
+			t.Fatal("expected problem to be repaired", problem)
+		}
+		if !repairable && problem.Repaired != 0 {
+			t.Fatal("unexpected repair", problem)
+		}
+		if len(problem.SampleIDs) != 0 {
+			t.Fatal("unexpected sample", problem)
+		}
+	}
+	blocked, err := db.IsBlocked(ctx, noncanonical)
+	if err != nil || !blocked {
+		t.Fatal("expected the repaired hash to be found", blocked, err)
+	}
+	hashes, err := db.HashesToRetry(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 1 || hashes[0] != stranded {
+		t.Fatal("expected the stranded hash to be retried", hashes)
+	}
+
+	// assert the repaired problems are gone
+	report, err = db.ScanIntegrity(ctx, IntegrityScanOptions{StrandedBefore: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range report.Problems {
+		repairable := problem.Type == IntegrityNonCanonicalHash || problem.Type == IntegrityStranded
+		if repairable && problem.Count != 0 {
+			t.Fatal("expected problem to be repaired", problem)
+		}
+	}
+
+	// assert the sample size can't be negative
+	_, err = db.ScanIntegrity(ctx, IntegrityScanOptions{SampleSize: -1})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
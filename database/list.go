@@ -0,0 +1,256 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// StateBlocked is the state of skylinks that were blocked in skyd.
+	StateBlocked = "blocked"
+
+	// StateFailed is the state of skylinks that failed to get blocked and
+	// are retried.
+	StateFailed = "failed"
+
+	// StateInvalid is the state of skylinks that skyd rejected.
+	StateInvalid = "invalid"
+
+	// StatePending is the state of skylinks that were not sent to skyd yet.
+	StatePending = "pending"
+
+	// StateUnblocked is the state of skylinks that got unblocked.
+	StateUnblocked = "unblocked"
+)
+
+var (
+	// ErrInvalidCursor is returned when the cursor passed to
+	// ListBlockedSkylinks can't be decoded.
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrInvalidState is returned when the state passed to
+	// ListBlockedSkylinks is unknown.
+	ErrInvalidState = errors.New("invalid state")
+)
+
+type (
+	// ListFilter filters the skylinks returned by ListBlockedSkylinks. All
+	// fields are optional. Source matches the name of the reporter, State is
+	// one of the State constants, From and To bound the time the skylinks
+	// were added, the start is inclusive and the end exclusive. BlockedFrom
+	// and BlockedTo bound the time skyd confirmed the block in the same way,
+	// setting either only matches skylinks with a known block time. The
+	// skylinks are sorted by the time they were added, Sort is 1 for
+	// ascending and -1 for descending order and defaults to ascending. Test
+	// records are only included if IncludeTest is set.
+	ListFilter struct {
+		Source      string
+		State       string
+		From        time.Time
+		To          time.Time
+		BlockedFrom time.Time
+		BlockedTo   time.Time
+		Sort        int
+		IncludeTest bool
+	}
+
+	// ListPage is a page of skylinks returned by ListBlockedSkylinks. Total
+	// is the number of skylinks that match the filter across all pages.
+	// NextCursor is empty on the last page.
+	ListPage struct {
+		Entries    []BlockedSkylink
+		Total      int64
+		NextCursor string
+	}
+
+	// listCursor is the position of the last skylink of a page, it's passed
+	// to the caller base64 encoded.
+	listCursor struct {
+		TimestampAdded time.Time          `json:"t"`
+		ID             primitive.ObjectID `json:"id"`
+	}
+)
+
+// State returns the state of the skylink, which is one of the State
+// constants.
+func (bsl BlockedSkylink) State() string {
+	switch {
+	case bsl.Reverted:
+		return StateUnblocked
+	case bsl.Invalid:
+		return StateInvalid
+	case bsl.Failed:
+		return StateFailed
+	case !bsl.BlockedAt.IsZero():
+		return StateBlocked
+	default:
+		return StatePending
+	}
+}
+
+// ListBlockedSkylinks returns a page of at most pageSize skylinks that match
+// the given filter, starting after the given cursor. An empty cursor returns
+// the first page, the cursor of the next page is part of the returned page.
+// Rather than skipping over the previous pages, the cursor holds the position
+// of the last skylink of the page, which keeps the pages stable when skylinks
+// are added concurrently. The sort on the time added is covered by an index
+// for the source and state filters.
+func (db *DB) ListBlockedSkylinks(ctx context.Context, filter ListFilter, cursor string, pageSize int) (ListPage, error) {
+	if pageSize < 1 {
+		return ListPage{}, errors.New("page size must be positive")
+	}
+	if filter.Sort == 0 {
+		filter.Sort = 1
+	}
+	if filter.Sort != 1 && filter.Sort != -1 {
+		return ListPage{}, fmt.Errorf("invalid sort %d", filter.Sort)
+	}
+	query, err := listFilter(filter)
+	if err != nil {
+		return ListPage{}, err
+	}
+
+	// count the matching skylinks
+	total, err := db.staticSkylinks.CountDocuments(ctx, query)
+	if err != nil {
+		return ListPage{}, errors.AddContext(err, "failed to count skylinks")
+	}
+
+	// continue after the cursor, the sort is on the time added and the id
+	// which makes the position unique
+	if cursor != "" {
+		lc, err := decodeListCursor(cursor)
+		if err != nil {
+			return ListPage{}, err
+		}
+		op := "$gt"
+		if filter.Sort == -1 {
+			op = "$lt"
+		}
+		query["$or"] = bson.A{
+			bson.M{"timestamp_added": bson.M{op: lc.TimestampAdded}},
+			bson.M{"timestamp_added": lc.TimestampAdded, "_id": bson.M{op: lc.ID}},
+		}
+	}
+
+	// fetch one more skylink than requested to know whether there's a next
+	// page
+	opts := options.Find()
+	opts.SetSort(sortByTimestampAdded(filter.Sort))
+	opts.SetLimit(int64(pageSize + 1))
+	docs, err := db.find(ctx, query, opts)
+	if err != nil {
+		return ListPage{}, errors.AddContext(err, "failed to fetch skylinks")
+	}
+
+	page := ListPage{Entries: docs, Total: total}
+	if len(docs) > pageSize {
+		page.Entries = docs[:pageSize]
+		last := page.Entries[pageSize-1]
+		page.NextCursor, err = encodeListCursor(listCursor{
+			TimestampAdded: last.TimestampAdded,
+			ID:             last.ID,
+		})
+		if err != nil {
+			return ListPage{}, err
+		}
+	}
+	return page, nil
+}
+
+// listFilter returns the query that corresponds to the given filter.
+func listFilter(filter ListFilter) (bson.M, error) {
+	query := bson.M{}
+	if !filter.IncludeTest {
+		query["test"] = bson.M{"$ne": true}
+	}
+	if filter.Source != "" {
+		query["reporter.name"] = filter.Source
+	}
+
+	// filter on the time added
+	timeRange := bson.M{}
+	if !filter.From.IsZero() {
+		timeRange["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		timeRange["$lt"] = filter.To
+	}
+	if len(timeRange) > 0 {
+		query["timestamp_added"] = timeRange
+	}
+
+	// filter on the time blocked, this is served by the index that starts
+	// with the time blocked
+	blockedRange := bson.M{}
+	if !filter.BlockedFrom.IsZero() {
+		blockedRange["$gte"] = filter.BlockedFrom
+	}
+	if !filter.BlockedTo.IsZero() {
+		blockedRange["$lt"] = filter.BlockedTo
+	}
+
+	// filter on the state, the conditions mirror BlockedSkylink.State
+	switch filter.State {
+	case "":
+	case StateBlocked:
+		blockedRange["$exists"] = true
+		query["failed"] = bson.M{"$ne": true}
+		query["invalid"] = bson.M{"$ne": true}
+		query["reverted"] = bson.M{"$ne": true}
+	case StateFailed:
+		query["failed"] = true
+		query["invalid"] = bson.M{"$ne": true}
+		query["reverted"] = bson.M{"$ne": true}
+	case StateInvalid:
+		query["invalid"] = true
+		query["reverted"] = bson.M{"$ne": true}
+	case StatePending:
+		blockedRange["$exists"] = false
+		query["failed"] = bson.M{"$ne": true}
+		query["invalid"] = bson.M{"$ne": true}
+		query["reverted"] = bson.M{"$ne": true}
+	case StateUnblocked:
+		query["reverted"] = true
+	default:
+		return nil, errors.AddContext(ErrInvalidState, fmt.Sprintf("unknown state '%s'", filter.State))
+	}
+	if len(blockedRange) > 0 {
+		query["blocked_at"] = blockedRange
+	}
+	return query, nil
+}
+
+// encodeListCursor encodes the given cursor.
+func encodeListCursor(lc listCursor) (string, error) {
+	b, err := json.Marshal(lc)
+	if err != nil {
+		return "", errors.AddContext(err, "failed to encode cursor")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeListCursor decodes the given cursor.
+func decodeListCursor(cursor string) (listCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return listCursor{}, errors.Compose(err, ErrInvalidCursor)
+	}
+	var lc listCursor
+	err = json.Unmarshal(b, &lc)
+	if err != nil {
+		return listCursor{}, errors.Compose(err, ErrInvalidCursor)
+	}
+	if lc.TimestampAdded.IsZero() || lc.ID.IsZero() {
+		return listCursor{}, ErrInvalidCursor
+	}
+	return lc, nil
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestBlockedSkylinkState is a unit test for the 'State' method.
+func TestBlockedSkylinkState(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().UTC()
+	tests := []struct {
+		bsl   BlockedSkylink
+		state string
+	}{
+		{BlockedSkylink{}, StatePending},
+		{BlockedSkylink{BlockedAt: now}, StateBlocked},
+		{BlockedSkylink{BlockedAt: now, Failed: true}, StateFailed},
+		{BlockedSkylink{Invalid: true}, StateInvalid},
+		{BlockedSkylink{Invalid: true, Reverted: true}, StateUnblocked},
+		{BlockedSkylink{Reverted: true}, StateUnblocked},
+	}
+	for _, test := range tests {
+		if state := test.bsl.State(); state != test.state {
+			t.Fatal("unexpected state", state, test.state)
+		}
+	}
+
+	// assert every state can be filtered on
+	for _, test := range tests {
+		_, err := listFilter(ListFilter{State: test.state})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := listFilter(ListFilter{State: "deleted"})
+	if !errors.Contains(err, ErrInvalidState) {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+// TestListCursor verifies cursors can be decoded after being encoded and that
+// malformed cursors are rejected.
+func TestListCursor(t *testing.T) {
+	t.Parallel()
+
+	lc := listCursor{
+		TimestampAdded: time.Date(2022, 3, 14, 15, 9, 26, 535000000, time.UTC),
+		ID:             primitive.NewObjectID(),
+	}
+	cursor, err := encodeListCursor(lc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeListCursor(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.TimestampAdded.Equal(lc.TimestampAdded) || decoded.ID != lc.ID {
+		t.Fatal("unexpected cursor", decoded)
+	}
+
+	// assert malformed cursors are rejected
+	empty, err := encodeListCursor(listCursor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cursor := range []string{"garbage!", "e30", empty} {
+		_, err = decodeListCursor(cursor)
+		if !errors.Contains(err, ErrInvalidCursor) {
+			t.Fatal("unexpected error", cursor, err)
+		}
+	}
+}
+
+// TestListFilterBlockedRange verifies the range of the time skylinks got
+// blocked is combined with the conditions of the state filter.
+func TestListFilterBlockedRange(t *testing.T) {
+	t.Parallel()
+
+	from := time.Date(2022, 3, 14, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+
+	// assert the range is applied
+	query, err := listFilter(ListFilter{BlockedFrom: from, BlockedTo: to})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockedAt, ok := query["blocked_at"].(bson.M)
+	if !ok || len(blockedAt) != 2 || blockedAt["$gte"] != from || blockedAt["$lt"] != to {
+		t.Fatal("unexpected query", query)
+	}
+
+	// assert the range does not replace the condition of the state
+	query, err = listFilter(ListFilter{State: StateBlocked, BlockedFrom: from})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockedAt, ok = query["blocked_at"].(bson.M)
+	if !ok || len(blockedAt) != 2 || blockedAt["$gte"] != from || blockedAt["$exists"] != true {
+		t.Fatal("unexpected query", query)
+	}
+
+	// assert the time blocked is not filtered on without a range
+	query, err = listFilter(ListFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := query["blocked_at"]; exists {
+		t.Fatal("unexpected query", query)
+	}
+}
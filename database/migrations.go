@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type (
+	// Migration is a change to the database schema or its data, such as
+	// adding an index or backfilling a field. Migrations are applied in order
+	// of their version and every version is applied once, but migrations
+	// must be idempotent as a migration is applied again if recording it
+	// fails or if several blocker instances start at the same time. The
+	// tenant is passed to the migration so it can derive the names of the
+	// collections it changes.
+	Migration struct {
+		Version int
+		Name    string
+		Apply   func(ctx context.Context, db *mongo.Database, tenant string) error
+	}
+
+	// appliedMigration is the document that records a migration was applied.
+	appliedMigration struct {
+		Version   int       `bson:"version"`
+		Name      string    `bson:"name"`
+		AppliedAt time.Time `bson:"applied_at"`
+	}
+)
+
+// migrations holds all migrations, new migrations are appended with the next
+// version.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "drop the indices on 'skylink'",
+		Apply:   migrateDropSkylinkIndices,
+	},
+}
+
+// Migrate applies the migrations that were not applied yet, in order of their
+// version. It stops at the first migration that fails, the migrations that
+// were applied before it remain applied.
+func (db *DB) Migrate(ctx context.Context) error {
+	return db.migrate(ctx, migrations)
+}
+
+// migrate applies the given migrations that were not applied yet.
+func (db *DB) migrate(ctx context.Context, migrations []Migration) error {
+	err := validateMigrations(migrations)
+	if err != nil {
+		return err
+	}
+
+	// fetch the applied versions
+	c, err := db.staticMigrations.Find(ctx, bson.M{})
+	if err != nil {
+		return errors.AddContext(err, "failed to fetch applied migrations")
+	}
+	var applied []appliedMigration
+	err = c.All(ctx, &applied)
+	if err != nil {
+		return errors.AddContext(err, "failed to decode applied migrations")
+	}
+	versions := make(map[int]struct{}, len(applied))
+	for _, am := range applied {
+		versions[am.Version] = struct{}{}
+	}
+
+	// apply the pending migrations
+	for _, m := range migrations {
+		if _, exists := versions[m.Version]; exists {
+			continue
+		}
+		db.staticLogger.Infof("applying migration %d '%s'", m.Version, m.Name)
+		err = m.Apply(ctx, db.staticDB, db.staticTenant)
+		if err != nil {
+			return errors.AddContext(err, fmt.Sprintf("migration %d '%s' failed", m.Version, m.Name))
+		}
+		_, err = db.staticMigrations.UpdateOne(ctx, bson.M{"version": m.Version}, bson.M{
+			"$setOnInsert": appliedMigration{
+				Version:   m.Version,
+				Name:      m.Name,
+				AppliedAt: time.Now().UTC(),
+			},
+		}, options.Update().SetUpsert(true))
+		if err != nil && !isDuplicateKey(err) {
+			return errors.AddContext(err, fmt.Sprintf("failed to record migration %d '%s'", m.Version, m.Name))
+		}
+	}
+	return nil
+}
+
+// validateMigrations returns an error if the versions of the given migrations
+// are not strictly increasing, or if a migration can't be applied.
+func validateMigrations(migrations []Migration) error {
+	for i, m := range migrations {
+		if m.Version <= 0 {
+			return fmt.Errorf("migration '%s' has invalid version %d", m.Name, m.Version)
+		}
+		if i > 0 && m.Version <= migrations[i-1].Version {
+			return fmt.Errorf("migration %d '%s' is out of order", m.Version, m.Name)
+		}
+		if m.Apply == nil {
+			return fmt.Errorf("migration %d '%s' has no apply function", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+// migrateDropSkylinkIndices drops the indices on the 'skylink' field, which
+// got replaced by the indices on the hash.
+func migrateDropSkylinkIndices(ctx context.Context, db *mongo.Database, tenant string) error {
+	_, err1 := dropIndex(ctx, db.Collection(collectionName(collAllowlist, tenant)), "skylink")
+	_, err2 := dropIndex(ctx, db.Collection(collectionName(collSkylinks, tenant)), "skylink")
+	if err := errors.Compose(err1, err2); err != nil {
+		return errors.Compose(err, ErrIndexDropFailed)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gitlab.com/NebulousLabs/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TestValidateMigrations verifies migrations have to be ordered by version
+// and that the registered migrations are valid.
+func TestValidateMigrations(t *testing.T) {
+	t.Parallel()
+
+	noop := func(context.Context, *mongo.Database, string) error { return nil }
+
+	// assert the registered migrations are valid
+	if err := validateMigrations(migrations); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		migrations []Migration
+		err        string
+	}{
+		{"Empty", nil, ""},
+		{"Ordered", []Migration{{1, "one", noop}, {3, "three", noop}}, ""},
+		{"ZeroVersion", []Migration{{0, "zero", noop}}, "invalid version"},
+		{"Duplicate", []Migration{{1, "one", noop}, {1, "uno", noop}}, "out of order"},
+		{"Unordered", []Migration{{2, "two", noop}, {1, "one", noop}}, "out of order"},
+		{"NoApply", []Migration{{1, "one", nil}}, "no apply function"},
+	}
+	for _, test := range tests {
+		err := validateMigrations(test.migrations)
+		if test.err == "" && err != nil {
+			t.Fatal(test.name, "unexpected error", err)
+		}
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Fatal(test.name, "unexpected error", err)
+		}
+	}
+}
+
+// testMigrate verifies migrations are applied once, in order, and that a
+// failed migration stops the pending migrations from being applied.
+func testMigrate(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// create migrations that record they were applied
+	var applied []int
+	apply := func(version int) func(context.Context, *mongo.Database, string) error {
+		return func(context.Context, *mongo.Database, string) error {
+			applied = append(applied, version)
+			return nil
+		}
+	}
+	errFailed := errors.New("migration failed")
+	ms := []Migration{
+		{1, "one", apply(1)},
+		{2, "two", apply(2)},
+	}
+
+	// assert the migrations are applied in order
+	err := db.migrate(ctx, ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 || applied[0] != 1 || applied[1] != 2 {
+		t.Fatal("unexpected migrations applied", applied)
+	}
+
+	// assert they are not applied again
+	err = db.migrate(ctx, ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 {
+		t.Fatal("unexpected migrations applied", applied)
+	}
+
+	// add a failing migration followed by another one and assert the
+	// failure is reported and the last migration is not applied
+	ms = append(ms, Migration{3, "three", func(context.Context, *mongo.Database, string) error {
+		return errFailed
+	}}, Migration{4, "four", apply(4)})
+	err = db.migrate(ctx, ms)
+	if !errors.Contains(err, errFailed) || !strings.Contains(err.Error(), "migration 3 'three' failed") {
+		t.Fatal("unexpected error", err)
+	}
+	if len(applied) != 2 {
+		t.Fatal("unexpected migrations applied", applied)
+	}
+
+	// assert the failed migration is not recorded
+	n, err := db.staticMigrations.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatal("unexpected number of applied migrations", n)
+	}
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// revisionBlocklist is the name of the revision of the blocklist.
+	revisionBlocklist = "blocklist"
+)
+
+// Revision identifies a state of the blocklist. The revision is incremented
+// with every change to the blocklist, e.g. when a skylink is added, unblocked,
+// cancelled or confirmed blocked by skyd, and the timestamp is the time of the
+// last change. It allows caches to cheaply tell whether the blocklist changed.
+type Revision struct {
+	Revision  int64     `bson:"revision"`
+	Timestamp time.Time `bson:"timestamp"`
+}
+
+// BlocklistRevision returns the current revision of the blocklist. If the
+// blocklist never changed the zero revision is returned.
+func (db *DB) BlocklistRevision(ctx context.Context) (Revision, error) {
+	var rev Revision
+	err := db.staticRevisions.FindOne(ctx, bson.M{"name": revisionBlocklist}).Decode(&rev)
+	if isDocumentNotFound(err) {
+		return Revision{}, nil
+	}
+	if err != nil {
+		return Revision{}, err
+	}
+	return rev, nil
+}
+
+// bumpBlocklistRevision increments the revision of the blocklist, it's called
+// by every method that changes the blocklist after it did so. Failing to bump
+// the revision is logged rather than returned, seeing as the change itself
+// went through, caches only serve the previous state for a little longer.
+func (db *DB) bumpBlocklistRevision(ctx context.Context) {
+	filter := bson.M{"name": revisionBlocklist}
+	update := bson.M{
+		"$inc": bson.M{"revision": 1},
+		"$set": bson.M{"timestamp": time.Now().UTC().Truncate(time.Millisecond)},
+	}
+	opts := options.Update().SetUpsert(true)
+	_, err := db.staticRevisions.UpdateOne(ctx, filter, update, opts)
+	if isDuplicateKey(err) {
+		// two concurrent upserts of the first revision, retry as an update
+		_, err = db.staticRevisions.UpdateOne(ctx, filter, update, opts)
+	}
+	if err != nil {
+		db.staticLogger.Errorf("failed to bump the revision of the blocklist: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrSnapshotExists is returned by CreateSnapshot when a snapshot with
+	// the given label exists already.
+	ErrSnapshotExists = errors.New("snapshot already exists")
+)
+
+// Snapshot marks the state of the blocklist at a point in time, e.g. before a
+// bulk import, which allows reversing the blocks of the skylinks that were
+// added after it. It's a marker rather than a copy of the blocklist, it only
+// holds the time at which it was created and an optional note.
+type Snapshot struct {
+	Label     string    `bson:"label"`
+	Note      string    `bson:"note,omitempty"`
+	Timestamp time.Time `bson:"timestamp"`
+}
+
+// CreateSnapshot creates a snapshot of the blocklist with the given label and
+// note. If a snapshot with that label exists already ErrSnapshotExists is
+// returned.
+func (db *DB) CreateSnapshot(ctx context.Context, label, note string) (Snapshot, error) {
+	if label == "" {
+		return Snapshot{}, errors.New("label can not be empty")
+	}
+
+	// mongo stores times with millisecond precision, so we truncate the
+	// timestamp to return what is stored
+	snapshot := Snapshot{
+		Label:     label,
+		Note:      note,
+		Timestamp: time.Now().UTC().Truncate(time.Millisecond),
+	}
+	_, err := db.staticSnapshots.InsertOne(ctx, snapshot)
+	if isDuplicateKey(err) {
+		return Snapshot{}, ErrSnapshotExists
+	}
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return snapshot, nil
+}
+
+// Snapshot returns the snapshot with the given label. If the snapshot is
+// unknown ErrNoDocumentsFound is returned.
+func (db *DB) Snapshot(ctx context.Context, label string) (Snapshot, error) {
+	var snapshot Snapshot
+	err := db.staticSnapshots.FindOne(ctx, bson.M{"label": label}).Decode(&snapshot)
+	if errors.Contains(err, mongo.ErrNoDocuments) {
+		return Snapshot{}, ErrNoDocumentsFound
+	}
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return snapshot, nil
+}
+
+// AddedSince returns the skylinks that were added after the given time and are
+// blocked, or are still to be blocked, in the order they were added. Skylinks
+// that were deemed invalid, got unblocked or were skipped by the pre-block
+// policy are excluded, as are the skylinks that were added before the given
+// time and reported again after it, unless they were still awaiting
+// confirmation by more reporters, in which case the report counts as their
+// addition. Only the hash and the time the skylinks got blocked at are fetched.
+func (db *DB) AddedSince(ctx context.Context, since time.Time) ([]BlockedSkylink, error) {
+	filter := bson.M{
+		"timestamp_added": bson.M{"$gt": since},
+		"invalid":         bson.M{"$ne": true},
+		"reverted":        bson.M{"$ne": true},
+		"skipped":         bson.M{"$ne": true},
+	}
+	opts := options.Find()
+	opts.SetProjection(bson.M{"hash": 1, "blocked_at": 1})
+	opts.SetSort(bson.D{{Key: "timestamp_added", Value: 1}, {Key: "_id", Value: 1}})
+	return db.find(ctx, filter, opts)
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+)
+
+// testSnapshots verifies snapshots can be created and fetched by their label,
+// that labels are unique and that AddedSince only returns the skylinks that
+// were added after a snapshot and still have to be reverted.
+func testSnapshots(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// assert an empty label is rejected
+	_, err := db.CreateSnapshot(ctx, "", "")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	// create a snapshot and assert it can be fetched
+	snapshot, err := db.CreateSnapshot(ctx, "before-import", "ticket 42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetched, err := db.Snapshot(ctx, "before-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetched.Label != snapshot.Label || fetched.Note != snapshot.Note || !fetched.Timestamp.Equal(snapshot.Timestamp) {
+		t.Fatal("unexpected snapshot", fetched, snapshot)
+	}
+
+	// assert labels are unique and unknown labels are reported
+	_, err = db.CreateSnapshot(ctx, "before-import", "")
+	if !errors.Contains(err, ErrSnapshotExists) {
+		t.Fatal("unexpected error", err)
+	}
+	_, err = db.Snapshot(ctx, "unknown")
+	if !errors.Contains(err, ErrNoDocumentsFound) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// insert a skylink before the snapshot and a couple after it, in various
+	// states
+	before := HashBytes([]byte("before"))
+	pending := HashBytes([]byte("pending"))
+	blocked := HashBytes([]byte("blocked"))
+	invalid := HashBytes([]byte("invalid"))
+	reverted := HashBytes([]byte("reverted"))
+	reports := []struct {
+		hash  Hash
+		added time.Time
+	}{
+		{before, snapshot.Timestamp.Add(-time.Minute)},
+		{pending, snapshot.Timestamp.Add(time.Minute)},
+		{blocked, snapshot.Timestamp.Add(2 * time.Minute)},
+		{invalid, snapshot.Timestamp.Add(3 * time.Minute)},
+		{reverted, snapshot.Timestamp.Add(4 * time.Minute)},
+	}
+	for _, report := range reports {
+		err = db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+			Hash:           report.hash,
+			Reporter:       Reporter{Name: "import"},
+			TimestampAdded: report.added,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = db.MarkSucceeded(ctx, []Hash{before, blocked}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.MarkInvalid(ctx, []Hash{invalid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.CancelPending(ctx, reverted, "cancelled")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert only the pending and blocked skylinks are returned, in the
+	// order they were added
+	skylinks, err := db.AddedSince(ctx, snapshot.Timestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skylinks) != 2 || skylinks[0].Hash != pending || skylinks[1].Hash != blocked {
+		t.Fatal("unexpected skylinks", skylinks)
+	}
+	if !skylinks[0].BlockedAt.IsZero() || skylinks[1].BlockedAt.IsZero() {
+		t.Fatal("unexpected blocked at", skylinks[0].BlockedAt, skylinks[1].BlockedAt)
+	}
+}
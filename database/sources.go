@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// disabledSource is the document that marks a report source as disabled, the
+// sweeps don't act on the reports of disabled sources.
+type disabledSource struct {
+	Source            string    `bson:"source"`
+	TimestampDisabled time.Time `bson:"timestamp_disabled"`
+}
+
+// DisabledSources returns the names of the report sources that are disabled,
+// sorted by name.
+func (db *DB) DisabledSources(ctx context.Context) ([]string, error) {
+	opts := options.Find().SetSort(bson.M{"source": 1})
+	c, err := db.staticDisabledSources.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var docs []disabledSource
+	err = c.All(ctx, &docs)
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]string, len(docs))
+	for i, doc := range docs {
+		sources[i] = doc.Source
+	}
+	return sources, nil
+}
+
+// SetSourceEnabled enables or disables the given report source, the source is
+// the name of the reporter. The skylinks that were only reported by disabled
+// sources are skipped by the sweeps but they remain pending, the skylinks the
+// source blocked already are left untouched. When a disabled source gets
+// enabled again, the latest block timestamps are rewound to the time at which
+// its oldest pending skylink was added, so the next sweep picks it up.
+//
+// NOTE: the blocker caches the latest block timestamp, so it has to be
+// invalidated after enabling a source.
+func (db *DB) SetSourceEnabled(ctx context.Context, source string, enabled bool) error {
+	if source == "" {
+		return errors.New("source can not be empty")
+	}
+
+	// disable the source, retaining the time at which it got disabled first
+	if !enabled {
+		update := bson.M{
+			"$setOnInsert": disabledSource{
+				Source:            source,
+				TimestampDisabled: time.Now().UTC(),
+			},
+		}
+		opts := options.Update().SetUpsert(true)
+		_, err := db.staticDisabledSources.UpdateOne(ctx, bson.M{"source": source}, update, opts)
+		return err
+	}
+
+	// enable the source, escape early if it was not disabled
+	res, err := db.staticDisabledSources.DeleteOne(ctx, bson.M{"source": source})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return nil
+	}
+
+	// rewind the latest block timestamps to the oldest pending skylink of
+	// the source
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"reporter.name": source},
+			bson.M{"reporters.name": source},
+		},
+		"blocked_at": bson.M{"$exists": false},
+		"failed":     bson.M{"$ne": true},
+		"invalid":    bson.M{"$ne": true},
+		"reverted":   bson.M{"$ne": true},
+		"skipped":    bson.M{"$ne": true},
+	}
+	opts := options.FindOne()
+	opts.SetProjection(bson.M{"timestamp_added": 1})
+	opts.SetSort(sortByTimestampAdded(1))
+	oldest, err := db.findOne(ctx, filter, opts)
+	if err != nil {
+		return errors.AddContext(err, "failed to fetch the oldest pending skylink of the source")
+	}
+	if oldest == nil {
+		return nil
+	}
+	_, err = db.staticLatestBlockTimestamps.UpdateMany(ctx,
+		bson.M{"timestamp": bson.M{"$gt": oldest.TimestampAdded}},
+		bson.M{"$set": bson.M{"timestamp": oldest.TimestampAdded}},
+	)
+	if err != nil {
+		return errors.AddContext(err, "failed to rewind the latest block timestamps")
+	}
+	return nil
+}
+
+// enabledSourcesFilter returns the filter that matches the skylinks that were
+// reported by at least one source that is not in the given list of disabled
+// sources, either as the first reporter or as one of the reporters whose
+// report got merged into the skylink.
+func enabledSourcesFilter(disabled []string) bson.A {
+	return bson.A{
+		bson.M{"reporter.name": bson.M{"$nin": disabled}},
+		bson.M{"reporters": bson.M{"$elemMatch": bson.M{"name": bson.M{"$nin": disabled}}}},
+	}
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"sort"
+
+	"gitlab.com/NebulousLabs/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ReportThreshold configures the number of distinct reporters that have to
+// report a skylink before it gets blocked, which allows requiring confirmation
+// of the reports of low-trust sources. The threshold of a skylink is the lowest
+// threshold of the sources that reported it, sources without a configured
+// threshold use the default. Thresholds below one are treated as one, which is
+// also the default, so a single report suffices.
+//
+// Reporters are told apart by their sub, by their email if they have no sub,
+// and by their name if they have neither.
+type ReportThreshold struct {
+	Default int
+	Sources map[string]int
+}
+
+// enabled returns true if any skylink requires more than one reporter.
+func (rt ReportThreshold) enabled() bool {
+	if rt.Default > 1 {
+		return true
+	}
+	for _, threshold := range rt.Sources {
+		if threshold > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the condition a skylink has to meet to no longer await
+// confirmation, which is that it was reported by at least as many distinct
+// reporters as its threshold. If no threshold above one is configured, nil is
+// returned.
+func (rt ReportThreshold) filter() bson.M {
+	if !rt.enabled() {
+		return nil
+	}
+	return bson.M{"$expr": bson.M{"$gte": bson.A{distinctReportersExpr(), rt.thresholdExpr()}}}
+}
+
+// thresholdExpr returns the aggregation expression that evaluates to the
+// threshold of a skylink, the lowest threshold of the sources that reported it.
+func (rt ReportThreshold) thresholdExpr() interface{} {
+	threshold := func(t int) int {
+		if t < 1 {
+			return 1
+		}
+		return t
+	}
+	if len(rt.Sources) == 0 {
+		return threshold(rt.Default)
+	}
+
+	// sort the sources to build a deterministic expression
+	sources := make([]string, 0, len(rt.Sources))
+	for source := range rt.Sources {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	branches := make(bson.A, 0, len(sources))
+	for _, source := range sources {
+		branches = append(branches, bson.M{
+			"case": bson.M{"$eq": bson.A{"$$source", source}},
+			"then": threshold(rt.Sources[source]),
+		})
+	}
+
+	names := bson.M{"$setUnion": bson.A{
+		bson.A{"$reporter.name"},
+		bson.M{"$map": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$reporters", bson.A{}}},
+			"in":    "$$this.name",
+		}},
+	}}
+	return bson.M{"$min": bson.M{"$map": bson.M{
+		"input": names,
+		"as":    "source",
+		"in": bson.M{"$switch": bson.M{
+			"branches": branches,
+			"default":  threshold(rt.Default),
+		}},
+	}}}
+}
+
+// distinctReportersExpr returns the aggregation expression that evaluates to
+// the number of distinct reporters of a skylink, counting the reporter of the
+// first report along with the reporters whose report got merged into it.
+func distinctReportersExpr() bson.M {
+	return bson.M{"$size": bson.M{"$setUnion": bson.A{
+		bson.A{reporterKeyExpr("$reporter")},
+		bson.M{"$map": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$reporters", bson.A{}}},
+			"in":    reporterKeyExpr("$$this"),
+		}},
+	}}}
+}
+
+// reporterKeyExpr returns the aggregation expression that evaluates to the key
+// that identifies the given reporter, its sub, its email or its name, in that
+// order of preference.
+func reporterKeyExpr(reporter string) bson.M {
+	return bson.M{"$switch": bson.M{
+		"branches": bson.A{
+			bson.M{
+				"case": bson.M{"$gt": bson.A{reporter + ".sub", ""}},
+				"then": bson.M{"$concat": bson.A{"sub:", reporter + ".sub"}},
+			},
+			bson.M{
+				"case": bson.M{"$gt": bson.A{reporter + ".email", ""}},
+				"then": bson.M{"$concat": bson.A{"email:", reporter + ".email"}},
+			},
+		},
+		"default": bson.M{"$concat": bson.A{"name:", bson.M{"$ifNull": bson.A{reporter + ".name", ""}}}},
+	}}
+}
+
+// DistinctReporters returns the number of distinct reporters of the skylink
+// with the given hash, reporters are told apart as described by
+// ReportThreshold. If the skylink is unknown ErrNoDocumentsFound is returned.
+func (db *DB) DistinctReporters(ctx context.Context, hash Hash) (int, error) {
+	c, err := db.staticSkylinks.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"hash": hash}}},
+		{{Key: "$project", Value: bson.M{"count": distinctReportersExpr()}}},
+	})
+	if err != nil {
+		return 0, errors.AddContext(err, "failed to count distinct reporters")
+	}
+	var docs []struct {
+		Count int `bson:"count"`
+	}
+	err = c.All(ctx, &docs)
+	if err != nil {
+		return 0, errors.AddContext(err, "failed to decode distinct reporters")
+	}
+	if len(docs) == 0 {
+		return 0, ErrNoDocumentsFound
+	}
+	return docs[0].Count, nil
+}
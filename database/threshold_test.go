@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+)
+
+// testReportThreshold verifies the sweep skips skylinks that were not reported
+// by enough distinct reporters, and that merging the report that confirms a
+// skylink makes the sweep pick it up.
+func testReportThreshold(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database and configure the report threshold
+	db := NewTestDB(ctx, t.Name())
+	defer func() {
+		err := db.Close(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	db.staticReportThreshold = ReportThreshold{
+		Default: 2,
+		Sources: map[string]int{"ncmec": 1},
+	}
+
+	// report is a helper that reports the given hash
+	report := func(hash Hash, reporter Reporter, added time.Time) {
+		t.Helper()
+		err := db.CreateBlockedSkylink(ctx, &BlockedSkylink{
+			Hash:           hash,
+			Reporter:       reporter,
+			TimestampAdded: added,
+		})
+		if err != nil && !errors.Contains(err, ErrSkylinkExists) {
+			t.Fatal(err)
+		}
+	}
+
+	// assertDistinctReporters is a helper that asserts the number of distinct
+	// reporters of the given hash
+	assertDistinctReporters := func(hash Hash, expected int) {
+		t.Helper()
+		count, err := db.DistinctReporters(ctx, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != expected {
+			t.Fatalf("unexpected number of distinct reporters, %v != %v", count, expected)
+		}
+	}
+
+	// report a skylink by a trusted source and one by a crowd source
+	now := time.Now().UTC()
+	trusted := HashBytes([]byte("trusted"))
+	crowd := HashBytes([]byte("crowd"))
+	report(trusted, Reporter{Name: "ncmec"}, now.Add(-time.Hour))
+	report(crowd, Reporter{Name: "abuse skapp", Sub: "reporter_1"}, now.Add(-time.Hour))
+	assertDistinctReporters(crowd, 1)
+
+	// assert only the skylink of the trusted source is returned
+	hashes, err := db.HashesToBlock(ctx, now.Add(-2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hashes, []Hash{trusted}) {
+		t.Fatal("unexpected hashes", hashes)
+	}
+
+	// assert reporting it again by the same reporter does not confirm it
+	report(crowd, Reporter{Name: "abuse skapp", Sub: "reporter_1", Email: "reporter@example.com"}, now)
+	assertDistinctReporters(crowd, 1)
+	hashes, err = db.HashesToBlock(ctx, now.Add(-2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hashes, []Hash{trusted}) {
+		t.Fatal("unexpected hashes", hashes)
+	}
+
+	// assert it's confirmed by another reporter, and that its timestamp got
+	// updated so the next sweep picks it up
+	report(crowd, Reporter{Name: "abuse skapp", Sub: "reporter_2"}, now)
+	assertDistinctReporters(crowd, 2)
+	hashes, err = db.HashesToBlock(ctx, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hashes, []Hash{crowd}) {
+		t.Fatal("unexpected hashes", hashes)
+	}
+
+	// assert unknown skylinks are recognized
+	_, err = db.DistinctReporters(ctx, HashBytes([]byte("unknown")))
+	if !errors.Contains(err, ErrNoDocumentsFound) {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+// TestReportThresholdFilter is a unit test for the condition the report
+// threshold adds to the sweep.
+func TestReportThresholdFilter(t *testing.T) {
+	t.Parallel()
+
+	// assert no condition is added unless a threshold above one is configured
+	for _, rt := range []ReportThreshold{
+		{},
+		{Default: 1},
+		{Default: -1, Sources: map[string]int{"ncmec": 1, "other": 0}},
+	} {
+		if rt.enabled() || rt.filter() != nil {
+			t.Fatal("unexpected condition", rt)
+		}
+	}
+
+	// assert the default threshold is a constant if no source is configured
+	rt := ReportThreshold{Default: 3}
+	if rt.filter() == nil || rt.thresholdExpr() != 3 {
+		t.Fatal("unexpected threshold", rt.thresholdExpr())
+	}
+
+	// assert a source threshold above one enables the condition
+	rt = ReportThreshold{Sources: map[string]int{"abuse skapp": 2}}
+	if !rt.enabled() || rt.filter() == nil {
+		t.Fatal("expected a condition")
+	}
+}
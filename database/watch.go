@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+
+	"gitlab.com/NebulousLabs/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrChangeStreamUnsupported is returned by WatchInserts when the
+	// database does not support change streams, they require a replica set.
+	ErrChangeStreamUnsupported = errors.New("change streams are not supported, the database has to be a replica set")
+
+	// ErrChangeStreamInvalidated is returned by WatchInserts when the change
+	// stream got invalidated, e.g. because the collection got dropped or
+	// renamed. It can't be resumed, a new stream has to be opened.
+	ErrChangeStreamInvalidated = errors.New("change stream invalidated")
+
+	// ErrChangeStreamResumeFailed is returned by WatchInserts when the change
+	// stream can't be resumed after the given resume token, e.g. because the
+	// oplog no longer holds it. A new stream has to be opened.
+	ErrChangeStreamResumeFailed = errors.New("failed to resume change stream")
+
+	// changeStreamResumeErrorCodes are the codes of the errors mongo returns
+	// when a change stream can't be resumed, these are InvalidResumeToken,
+	// ChangeStreamFatalError and ChangeStreamHistoryLost.
+	changeStreamResumeErrorCodes = []int{260, 280, 286}
+
+	// changeStreamUnsupportedErrorCodes are the codes of the errors mongo
+	// returns when change streams are not supported, e.g. on a standalone
+	// server.
+	changeStreamUnsupportedErrorCodes = []int{40573}
+)
+
+type (
+	// insertEvent is an event of the change stream on the skylinks
+	// collection. The hash is decoded as a string, skylinks with a malformed
+	// hash are skipped rather than failing the stream.
+	insertEvent struct {
+		ID            bson.Raw `bson:"_id"`
+		OperationType string   `bson:"operationType"`
+		FullDocument  struct {
+			Hash string `bson:"hash"`
+		} `bson:"fullDocument"`
+	}
+)
+
+// WatchInserts opens a change stream on the skylinks collection and calls the
+// given function with the hashes of the skylinks that get inserted, along
+// with the resume token that follows them. The inserts that are available at
+// once are passed in a single call, up to maxBatch of them. If a resume token
+// is given, the stream resumes after it, which allows picking up where a
+// previous stream left off. Skylinks with a malformed hash are skipped.
+//
+// It returns when the context is cancelled, when the given function returns
+// an error or when the stream fails. If the stream got invalidated
+// ErrChangeStreamInvalidated is returned, after the inserts that preceded the
+// invalidation were passed to the function. If the stream can't be resumed
+// after the given token ErrChangeStreamResumeFailed is returned.
+func (db *DB) WatchInserts(ctx context.Context, resumeToken string, maxBatch int, fn func(hashes []Hash, resumeToken string) error) error {
+	if maxBatch < 1 {
+		return errors.New("max batch has to be positive")
+	}
+	opts := options.ChangeStream()
+	if resumeToken != "" {
+		token, err := decodeResumeToken(resumeToken)
+		if err != nil {
+			return errors.Compose(err, ErrChangeStreamResumeFailed)
+		}
+		opts.SetResumeAfter(token)
+	}
+	pipeline := mongo.Pipeline{{{
+		Key:   "$match",
+		Value: bson.M{"operationType": bson.M{"$in": bson.A{"insert", "invalidate"}}},
+	}}}
+	cs, err := db.staticSkylinks.Watch(ctx, pipeline, opts)
+	if err != nil {
+		return classifyChangeStreamError(err)
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), MongoDefaultTimeout)
+		defer cancel()
+		_ = cs.Close(closeCtx)
+	}()
+
+	for cs.Next(ctx) {
+		// collect the inserts that are available, without waiting
+		var hashes []Hash
+		var token bson.Raw
+		var invalidated bool
+		for {
+			var event insertEvent
+			err = cs.Decode(&event)
+			if err != nil {
+				return errors.AddContext(err, "failed to decode change event")
+			}
+			if event.OperationType == "invalidate" {
+				invalidated = true
+				break
+			}
+			// copy the token, the event might reference the cursor's
+			// buffer
+			token = append(bson.Raw(nil), event.ID...)
+			var hash Hash
+			if hash.LoadString(event.FullDocument.Hash) == nil {
+				hashes = append(hashes, hash)
+			}
+			if len(hashes) >= maxBatch || !cs.TryNext(ctx) {
+				break
+			}
+		}
+
+		// pass them on, unless the stream got invalidated before the
+		// first insert
+		if token != nil {
+			err = fn(hashes, encodeResumeToken(token))
+			if err != nil {
+				return err
+			}
+		}
+		if invalidated {
+			return ErrChangeStreamInvalidated
+		}
+		if cs.Err() != nil {
+			return classifyChangeStreamError(cs.Err())
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return classifyChangeStreamError(cs.Err())
+}
+
+// classifyChangeStreamError adds a typed error to the given error if it
+// indicates change streams are unsupported or the stream can't be resumed.
+func classifyChangeStreamError(err error) error {
+	se, ok := err.(mongo.ServerError)
+	if !ok {
+		return err
+	}
+	for _, code := range changeStreamUnsupportedErrorCodes {
+		if se.HasErrorCode(code) {
+			return errors.Compose(err, ErrChangeStreamUnsupported)
+		}
+	}
+	for _, code := range changeStreamResumeErrorCodes {
+		if se.HasErrorCode(code) {
+			return errors.Compose(err, ErrChangeStreamResumeFailed)
+		}
+	}
+	return err
+}
+
+// encodeResumeToken encodes the given resume token so it can be persisted as
+// a string.
+func encodeResumeToken(token bson.Raw) string {
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// decodeResumeToken decodes the given resume token.
+func decodeResumeToken(token string) (bson.Raw, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to decode resume token")
+	}
+	raw := bson.Raw(b)
+	err = raw.Validate()
+	if err != nil {
+		return nil, errors.AddContext(err, "invalid resume token")
+	}
+	return raw, nil
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"bytes"
+	"testing"
+
+	"gitlab.com/NebulousLabs/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TestResumeToken verifies resume tokens can be decoded after being encoded
+// and that malformed tokens are rejected.
+func TestResumeToken(t *testing.T) {
+	t.Parallel()
+
+	token, err := bson.Marshal(bson.M{"_data": "8262A1B2C3000000012B022C0100296E5A1004"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeResumeToken(encodeResumeToken(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, token) {
+		t.Fatal("unexpected token", decoded)
+	}
+
+	// assert malformed tokens are rejected
+	for _, token := range []string{"garbage!", "AAAA"} {
+		_, err = decodeResumeToken(token)
+		if err == nil {
+			t.Fatal("expected error", token)
+		}
+	}
+}
+
+// TestClassifyChangeStreamError verifies the errors of change streams are
+// classified by their code.
+func TestClassifyChangeStreamError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		code     int32
+		expected error
+	}{
+		{40573, ErrChangeStreamUnsupported},
+		{260, ErrChangeStreamResumeFailed},
+		{286, ErrChangeStreamResumeFailed},
+		{11600, nil},
+	}
+	for _, test := range tests {
+		err := classifyChangeStreamError(mongo.CommandError{Code: test.code, Message: "change stream error"})
+		for _, typed := range []error{ErrChangeStreamUnsupported, ErrChangeStreamResumeFailed} {
+			if errors.Contains(err, typed) != (typed == test.expected) {
+				t.Fatal("unexpected error", test.code, err)
+			}
+		}
+	}
+}
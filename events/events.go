@@ -0,0 +1,137 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SkynetLabs/blocker/database"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+const (
+	// closeTimeout is the amount of time Close waits for the buffered events
+	// to be flushed.
+	closeTimeout = 30 * time.Second
+)
+
+var (
+	// ErrBufferFull is returned by the buffered publisher if the event could
+	// not be buffered because the buffer is full, the event is dropped.
+	ErrBufferFull = errors.New("event buffer is full")
+
+	// ErrPublisherClosed is returned by the buffered publisher if an event is
+	// published after it got closed.
+	ErrPublisherClosed = errors.New("publisher is closed")
+)
+
+type (
+	// BlockEvent is the event that gets published for every hash that got
+	// blocked. Skylinks are never persisted, which is why the event only
+	// contains the hash. The source is the name of the reporter, which for
+	// skylinks that were synced from other portals is the portal's URL.
+	BlockEvent struct {
+		Hash      database.Hash `json:"hash"`
+		Source    string        `json:"source"`
+		ReportID  string        `json:"reportid,omitempty"`
+		Timestamp time.Time     `json:"timestamp"`
+	}
+
+	// Publisher publishes block events to a message broker.
+	Publisher interface {
+		Publish(event BlockEvent) error
+	}
+
+	// NoopPublisher is a publisher that discards all events, it's used when
+	// no message broker is configured.
+	NoopPublisher struct{}
+
+	// BufferedPublisher wraps a publisher and publishes the events in the
+	// background, which ensures publishing never blocks the caller. Events
+	// that can't be buffered are dropped, failing to publish an event is
+	// logged.
+	BufferedPublisher struct {
+		closed bool
+
+		staticDone      chan struct{}
+		staticEvents    chan BlockEvent
+		staticLogger    *logrus.Logger
+		staticMu        sync.RWMutex
+		staticPublisher Publisher
+	}
+)
+
+// Publish implements the Publisher interface.
+func (NoopPublisher) Publish(BlockEvent) error {
+	return nil
+}
+
+// NewBufferedPublisher returns a new buffered publisher that buffers up to
+// the given amount of events and publishes them using the given publisher in
+// the background. The caller should call Close when finished.
+func NewBufferedPublisher(publisher Publisher, size int, logger *logrus.Logger) (*BufferedPublisher, error) {
+	if publisher == nil {
+		return nil, errors.New("no publisher provided")
+	}
+	if logger == nil {
+		return nil, errors.New("no logger provided")
+	}
+	if size <= 0 {
+		return nil, errors.New("buffer size has to be positive")
+	}
+	bp := &BufferedPublisher{
+		staticDone:      make(chan struct{}),
+		staticEvents:    make(chan BlockEvent, size),
+		staticLogger:    logger,
+		staticPublisher: publisher,
+	}
+	go bp.threadedFlush()
+	return bp, nil
+}
+
+// Publish buffers the given event, it returns ErrBufferFull if the buffer is
+// full, in which case the event is dropped.
+func (bp *BufferedPublisher) Publish(event BlockEvent) error {
+	bp.staticMu.RLock()
+	defer bp.staticMu.RUnlock()
+	if bp.closed {
+		return ErrPublisherClosed
+	}
+	select {
+	case bp.staticEvents <- event:
+		return nil
+	default:
+		return ErrBufferFull
+	}
+}
+
+// Close stops accepting new events and waits for the buffered events to be
+// published, it times out after closeTimeout.
+func (bp *BufferedPublisher) Close() error {
+	bp.staticMu.Lock()
+	if bp.closed {
+		bp.staticMu.Unlock()
+		return ErrPublisherClosed
+	}
+	bp.closed = true
+	close(bp.staticEvents)
+	bp.staticMu.Unlock()
+
+	select {
+	case <-bp.staticDone:
+		return nil
+	case <-time.After(closeTimeout):
+		return errors.New("timed out flushing the buffered events")
+	}
+}
+
+// threadedFlush publishes the buffered events until the publisher is closed.
+func (bp *BufferedPublisher) threadedFlush() {
+	defer close(bp.staticDone)
+	for event := range bp.staticEvents {
+		err := bp.staticPublisher.Publish(event)
+		if err != nil {
+			bp.staticLogger.Errorf("failed to publish block event for hash %v: %v", event.Hash, err)
+		}
+	}
+}
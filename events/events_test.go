@@ -0,0 +1,235 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SkynetLabs/blocker/database"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+type (
+	// mockPublisher is a publisher that records the events it publishes, it
+	// blocks until it's unblocked if a block channel is set.
+	mockPublisher struct {
+		block  chan struct{}
+		events []BlockEvent
+		mu     sync.Mutex
+	}
+)
+
+// Publish implements the Publisher interface.
+func (mp *mockPublisher) Publish(event BlockEvent) error {
+	if mp.block != nil {
+		<-mp.block
+	}
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.events = append(mp.events, event)
+	return nil
+}
+
+// TestEvents runs the events unit tests.
+func TestEvents(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		test func(t *testing.T)
+	}{
+		{
+			name: "BufferedPublisher",
+			test: testBufferedPublisher,
+		},
+		{
+			name: "NATSPublisher",
+			test: testNATSPublisher,
+		},
+		{
+			name: "NewNATSPublisher",
+			test: testNewNATSPublisher,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, test.test)
+	}
+}
+
+// testBufferedPublisher verifies the buffered publisher never blocks, drops
+// events when its buffer is full and flushes the buffered events on close.
+func testBufferedPublisher(t *testing.T) {
+	// create a discard logger
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	// create a publisher that blocks until we unblock it
+	mp := &mockPublisher{block: make(chan struct{})}
+	bp, err := NewBufferedPublisher(mp, 1, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// publish events until the buffer is full, the first event might be
+	// picked up by the flush thread already so we allow for one extra
+	var full bool
+	for i := 0; i < 3; i++ {
+		err = bp.Publish(BlockEvent{Hash: database.HashBytes([]byte{byte(i)})})
+		if errors.Contains(err, ErrBufferFull) {
+			full = true
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !full {
+		t.Fatal("expected the buffer to be full")
+	}
+
+	// unblock the publisher and close, assert the buffered events got flushed
+	close(mp.block)
+	err = bp.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp.mu.Lock()
+	published := len(mp.events)
+	mp.mu.Unlock()
+	if published == 0 || published > 2 {
+		t.Fatal("unexpected amount of published events", published)
+	}
+
+	// assert we can't publish after close
+	err = bp.Publish(BlockEvent{})
+	if !errors.Contains(err, ErrPublisherClosed) {
+		t.Fatal("unexpected error", err)
+	}
+	err = bp.Close()
+	if !errors.Contains(err, ErrPublisherClosed) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert the constructor validates its input
+	_, err = NewBufferedPublisher(nil, 1, logger)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	_, err = NewBufferedPublisher(mp, 0, logger)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// testNATSPublisher verifies the NATS publisher speaks the NATS protocol
+// against a fake NATS server.
+func testNATSPublisher(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// run a fake NATS server that accepts a single connection and forwards
+	// the connect and publish messages it receives
+	connects := make(chan natsConnect, 1)
+	received := make(chan BlockEvent, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "INFO {\"server_id\":\"test\"}\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, "CONNECT "):
+				var c natsConnect
+				_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "CONNECT ")), &c)
+				connects <- c
+				fmt.Fprint(conn, "PING\r\n+OK\r\n")
+			case strings.HasPrefix(line, "PUB "):
+				fields := strings.Fields(line)
+				if len(fields) != 3 || fields[1] != "blocker.blocked" {
+					fmt.Fprint(conn, "-ERR 'Unknown Protocol Operation'\r\n")
+					return
+				}
+				size, _ := strconv.Atoi(fields[2])
+				payload := make([]byte, size+2)
+				_, err = io.ReadFull(r, payload)
+				if err != nil {
+					return
+				}
+				var event BlockEvent
+				_ = json.Unmarshal(payload[:size], &event)
+				received <- event
+				fmt.Fprint(conn, "+OK\r\n")
+			}
+		}
+	}()
+
+	np, err := NewNATSPublisher("nats://user:pass@"+ln.Addr().String(), "blocker.blocked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer np.Close()
+
+	// publish an event
+	event := BlockEvent{
+		Hash:      database.HashBytes([]byte("skylink")),
+		Source:    "abuse@siasky.net",
+		Timestamp: time.Now().UTC().Round(time.Second),
+	}
+	err = np.Publish(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the server received our credentials and the event
+	c := <-connects
+	if !c.Verbose || c.User != "user" || c.Pass != "pass" {
+		t.Fatal("unexpected connect", c)
+	}
+	got := <-received
+	if got.Hash != event.Hash || got.Source != event.Source || !got.Timestamp.Equal(event.Timestamp) {
+		t.Fatal("unexpected event", got)
+	}
+}
+
+// testNewNATSPublisher verifies the URL and the subject are validated.
+func testNewNATSPublisher(t *testing.T) {
+	np, err := NewNATSPublisher("nats://localhost", "blocker.blocked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if np.staticAddress != "localhost:4222" {
+		t.Fatal("unexpected address", np.staticAddress)
+	}
+
+	_, err = NewNATSPublisher("http://localhost:4222", "blocker.blocked")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	_, err = NewNATSPublisher("nats://localhost:4222", "")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	_, err = NewNATSPublisher("nats://localhost:4222", "blocker blocked")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,237 @@
+package ingester
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SkynetLabs/blocker/database"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/NebulousLabs/errors"
+	"go.sia.tech/siad/build"
+)
+
+const (
+	// ingestTimeout is the amount of time we allow for ingesting the reports
+	// of a single source.
+	ingestTimeout = 5 * time.Minute
+
+	// stopTimeoutDuration is the amount of time we wait when stop is called
+	// before cancelling out and returning with an error indicating an unclean
+	// shutdown.
+	stopTimeoutDuration = time.Minute
+)
+
+var (
+	// ingestInterval defines the amount of time between polling the report
+	// sources for new reports.
+	ingestInterval = build.Select(
+		build.Var{
+			Dev:      time.Minute,
+			Testing:  time.Second,
+			Standard: 5 * time.Minute,
+		},
+	).(time.Duration)
+)
+
+type (
+	// ReportSource is an external system that abuse reports are pulled from.
+	ReportSource interface {
+		// Name returns a name that uniquely identifies the source, it is used
+		// as the reporter's name for reports that don't specify one.
+		Name() string
+
+		// Fetch returns the reports that were added to the source since the
+		// last checkpoint.
+		Fetch(ctx context.Context) ([]database.BlockedSkylink, error)
+
+		// Checkpoint marks all reports returned by the last call to Fetch as
+		// ingested, ensuring they're not returned again.
+		Checkpoint(ctx context.Context) error
+	}
+
+	// Ingester periodically polls a set of report sources and adds their
+	// reports to the blocklist database. This makes the blocker the single
+	// point of ingestion for reports from external systems.
+	Ingester struct {
+		started bool
+
+		staticDB        *database.DB
+		staticLogger    *logrus.Logger
+		staticMu        sync.Mutex
+		staticSources   []ReportSource
+		staticStopChan  chan struct{}
+		staticWaitGroup sync.WaitGroup
+	}
+)
+
+// New returns a new Ingester with the given parameters.
+func New(db *database.DB, sources []ReportSource, logger *logrus.Logger) (*Ingester, error) {
+	if db == nil {
+		return nil, errors.New("no DB provided")
+	}
+	if logger == nil {
+		return nil, errors.New("no logger provided")
+	}
+
+	// assert the source names are unique
+	names := make(map[string]struct{})
+	for _, source := range sources {
+		if _, exists := names[source.Name()]; exists {
+			return nil, fmt.Errorf("duplicate report source '%v'", source.Name())
+		}
+		names[source.Name()] = struct{}{}
+	}
+
+	return &Ingester{
+		staticDB:       db,
+		staticLogger:   logger,
+		staticSources:  sources,
+		staticStopChan: make(chan struct{}),
+	}, nil
+}
+
+// Start launches a background task that periodically ingests the reports of
+// all report sources.
+func (i *Ingester) Start() error {
+	i.staticMu.Lock()
+	defer i.staticMu.Unlock()
+
+	// escape early if the ingester has no sources configured
+	if len(i.staticSources) == 0 {
+		i.staticLogger.Infof("ingester is not being started because no report sources have been defined")
+		return nil
+	}
+
+	// assert 'Start' is only called once
+	if i.started {
+		return errors.New("ingester already started")
+	}
+	i.started = true
+
+	// start the ingest loop
+	i.staticWaitGroup.Add(1)
+	go func() {
+		i.threadedIngestLoop()
+		i.staticWaitGroup.Done()
+	}()
+
+	return nil
+}
+
+// Stop waits for the ingester's waitgroup and times out after one minute.
+func (i *Ingester) Stop() error {
+	// check whether the ingester was started
+	i.staticMu.Lock()
+	if !i.started {
+		i.staticMu.Unlock()
+		return nil
+	}
+	i.started = false
+	i.staticMu.Unlock()
+
+	// stop the ingester by closing the stop channel
+	close(i.staticStopChan)
+
+	// wait for the waitgroup, timeout and signal unclean shutdown after 1m
+	c := make(chan struct{})
+	go func() {
+		defer close(c)
+		i.staticWaitGroup.Wait()
+	}()
+	select {
+	case <-c:
+		return nil
+	case <-time.After(stopTimeoutDuration):
+		return errors.New("unclean ingester shutdown")
+	}
+}
+
+// threadedIngestLoop holds the main ingest loop
+func (i *Ingester) threadedIngestLoop() {
+	for {
+		for _, source := range i.staticSources {
+			added, err := i.managedIngest(source)
+			if err != nil {
+				i.staticLogger.Errorf("failed to ingest reports from source '%s', error %v", source.Name(), err)
+			} else if added > 0 {
+				i.staticLogger.Infof("added %v hashes from source '%s'", added, source.Name())
+			}
+		}
+
+		select {
+		case <-i.staticStopChan:
+			return
+		case <-time.After(ingestInterval):
+		}
+	}
+}
+
+// managedIngest fetches the reports of the given source and adds them to the
+// database, after which the source is checkpointed. Reports for hashes that
+// are on the allow list are skipped. It returns the number of hashes that got
+// added to the database.
+func (i *Ingester) managedIngest(source ReportSource) (int, error) {
+	ctx, cancel := i.staticStopContext(context.Background())
+	defer cancel()
+	ctx, cancel = context.WithTimeout(ctx, ingestTimeout)
+	defer cancel()
+
+	// fetch the reports
+	reports, err := source.Fetch(ctx)
+	if err != nil {
+		return 0, errors.AddContext(err, "failed to fetch reports")
+	}
+
+	// prepare the reports, skipping the ones that are allow listed
+	var toAdd []database.BlockedSkylink
+	for _, report := range reports {
+		allowListed, err := i.staticDB.IsAllowListed(ctx, report.Hash.Hash)
+		if err != nil {
+			return 0, errors.AddContext(err, "failed to check the allow list")
+		}
+		if allowListed {
+			i.staticLogger.Debugf("skipping allow listed hash %v reported by source '%s'", report.Hash, source.Name())
+			continue
+		}
+		if report.Reporter.Name == "" {
+			report.Reporter.Name = source.Name()
+		}
+		if report.TimestampAdded.IsZero() {
+			report.TimestampAdded = time.Now().UTC()
+		}
+		toAdd = append(toAdd, report)
+	}
+
+	// add the reports to the database
+	var added int
+	if len(toAdd) > 0 {
+		added, err = i.staticDB.CreateBlockedSkylinkBulk(ctx, toAdd)
+		if err != nil {
+			return 0, errors.AddContext(err, "failed to insert hashes into the database")
+		}
+	}
+
+	// checkpoint the source, we only do this after the reports were added to
+	// ensure we don't lose any reports
+	err = source.Checkpoint(ctx)
+	if err != nil {
+		return added, errors.AddContext(err, "failed to checkpoint source")
+	}
+	return added, nil
+}
+
+// staticStopContext returns a child of the given context that is cancelled
+// when the ingester is stopped.
+func (i *Ingester) staticStopContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-i.staticStopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,317 @@
+package ingester
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SkynetLabs/blocker/database"
+	"github.com/sirupsen/logrus"
+	skyapi "gitlab.com/SkynetLabs/skyd/node/api"
+)
+
+var (
+	// v1SkylinkStr is a random skylink
+	v1SkylinkStr = "BAAWi3ou51qCH24Im0ESS-5_gKg60qGIYtta-ryrl1kBnQ"
+	// v2SkylinkStr is a v2 skylink
+	v2SkylinkStr = "AQBst6HgaJ0PIBMtmQ2qgH_wQlFg4bNnwAhff7DmJP6oyg"
+)
+
+// TestReport is a unit test that covers converting a report into a blocked
+// skylink.
+func TestReport(t *testing.T) {
+	t.Parallel()
+
+	hash := database.HashBytes([]byte("skylink_1"))
+	tests := []struct {
+		report Report
+		err    string
+	}{
+		// valid cases
+		{Report{Hash: hash.String()}, ""},
+		{Report{Skylink: v1SkylinkStr}, ""},
+
+		// invalid cases
+		{Report{}, "hash or skylink is required"},
+		{Report{Hash: "not_a_hash"}, "invalid hash"},
+		{Report{Skylink: "not_a_skylink"}, "invalid skylink"},
+		{Report{Skylink: v2SkylinkStr}, "V2 skylinks are not supported"},
+	}
+
+	for _, test := range tests {
+		bsl, err := test.report.BlockedSkylink()
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Fatalf("Expected error containing '%v' but was %v", test.err, err)
+		}
+		if test.err == "" && err != nil {
+			t.Fatalf("Expected no error, but received '%v'", err.Error())
+		}
+		if test.err == "" && bsl.Validate() != nil {
+			t.Fatal("expected a valid blocked skylink", bsl.Validate())
+		}
+	}
+}
+
+// TestDirectorySource is a unit test that verifies the directory source only
+// ingests files that are completely written and that every file is ingested
+// once.
+func TestDirectorySource(t *testing.T) {
+	t.Parallel()
+
+	// create a directory source
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ds, err := NewDirectorySource(dir, newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// drop a valid file with a ready marker, an invalid file and a file that
+	// is still being written
+	hash := database.HashBytes([]byte("skylink_1"))
+	writeFile(t, filepath.Join(dir, "valid.json"), `[{"hash":"`+hash.String()+`","reporter":{"name":"authority"},"tags":["a"]}]`)
+	writeFile(t, filepath.Join(dir, "valid.json"+readyMarkerExt), "")
+	writeFile(t, filepath.Join(dir, "invalid.json"), `{"hash":`)
+	writeFile(t, filepath.Join(dir, "writing.json"), `[{"hash":`)
+	settled := time.Now().Add(-2 * settleTime)
+	err = os.Chtimes(filepath.Join(dir, "invalid.json"), settled, settled)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the valid file is fetched
+	reports, err := ds.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].Hash != hash || reports[0].Reporter.Name != "authority" {
+		t.Fatal("unexpected reports", reports)
+	}
+
+	// assert the invalid file was moved to the failed directory, and the file
+	// that is being written was left alone
+	if _, err := os.Stat(filepath.Join(dir, dirFailed, "invalid.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "writing.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the file is fetched again if we did not checkpoint
+	reports, err = ds.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 {
+		t.Fatal("unexpected reports", reports)
+	}
+
+	// checkpoint and assert the file is not fetched again
+	err = ds.Checkpoint(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"valid.json", "valid.json" + readyMarkerExt} {
+		if _, err := os.Stat(filepath.Join(dir, dirProcessed, file)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reports, err = ds.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 0 {
+		t.Fatal("unexpected reports", reports)
+	}
+}
+
+// TestDropSource is a unit test that verifies the drop source only ingests
+// files that are completely written, that every file is ingested once and
+// that a file that can't be parsed does not affect the other files.
+func TestDropSource(t *testing.T) {
+	t.Parallel()
+
+	// create a drop source
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ds, err := NewDropSource(dir, newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// drop a settled file, a file with a ready marker, a file that is still
+	// being written and an invalid file
+	settled := time.Now().Add(-2 * settleTime)
+	writeFile(t, filepath.Join(dir, "settled.txt"), "# legacy export\n"+v1SkylinkStr+"\n\n")
+	writeFile(t, filepath.Join(dir, "marked.txt"), v1SkylinkStr)
+	writeFile(t, filepath.Join(dir, "marked.txt"+readyMarkerExt), "")
+	writeFile(t, filepath.Join(dir, "writing.txt"), v1SkylinkStr)
+	writeFile(t, filepath.Join(dir, "invalid.txt"), v1SkylinkStr+"\nnot_a_skylink")
+	for _, file := range []string{"settled.txt", "invalid.txt"} {
+		err = os.Chtimes(filepath.Join(dir, file), settled, settled)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// assert the settled and the marked file are fetched, with the file name
+	// as reporter
+	reports, err := ds.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 || reports[0].Reporter.Name != "marked.txt" || reports[1].Reporter.Name != "settled.txt" {
+		t.Fatal("unexpected reports", reports)
+	}
+	if reports[0].Hash != reports[1].Hash {
+		t.Fatal("expected both files to report the same skylink")
+	}
+
+	// assert the invalid file was moved to the failed directory
+	if _, err := os.Stat(filepath.Join(dir, dirFailed, "invalid.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	// checkpoint and assert the files and the marker were moved to the done
+	// directory
+	err = ds.Checkpoint(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"settled.txt", "marked.txt", "marked.txt" + readyMarkerExt} {
+		if _, err := os.Stat(filepath.Join(dir, dirDone, file)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// assert the file that is being written is fetched once it settled
+	reports, err = ds.Fetch(context.Background())
+	if err != nil || len(reports) != 0 {
+		t.Fatal("unexpected outcome", reports, err)
+	}
+	err = os.Chtimes(filepath.Join(dir, "writing.txt"), settled, settled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports, err = ds.Fetch(context.Background())
+	if err != nil || len(reports) != 1 {
+		t.Fatal("unexpected outcome", reports, err)
+	}
+}
+
+// TestIngester is an integration test that ingests reports from a directory
+// and an HTTP source.
+func TestIngester(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+
+	// create test database
+	db := database.NewTestDB(ctx, t.Name())
+	logger := newTestLogger()
+
+	// create a directory source with a single report
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ds, err := NewDirectorySource(dir, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash1 := database.HashBytes([]byte("skylink_1"))
+	writeFile(t, filepath.Join(dir, "reports.json"), `[{"hash":"`+hash1.String()+`"}]`)
+	writeFile(t, filepath.Join(dir, "reports.json"+readyMarkerExt), "")
+
+	// create an HTTP source that returns a report and a checkpoint, unless
+	// the checkpoint is passed
+	hash2 := database.HashBytes([]byte("skylink_2"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("checkpoint") == "1" {
+			skyapi.WriteJSON(w, httpSourceResponse{Checkpoint: "1"})
+			return
+		}
+		skyapi.WriteJSON(w, httpSourceResponse{
+			Reports:    []Report{{Hash: hash2.String()}},
+			Checkpoint: "1",
+		})
+	}))
+	defer server.Close()
+	hs, err := NewHTTPSource(server.URL, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// create the ingester
+	i, err := New(db, []ReportSource{ds, hs}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ingest both sources twice and assert the reports are only added once
+	for _, source := range []ReportSource{ds, hs} {
+		added, err := i.managedIngest(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added != 1 {
+			t.Fatalf("unexpected number of hashes added, %v != 1", added)
+		}
+		added, err = i.managedIngest(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added != 0 {
+			t.Fatalf("unexpected number of hashes added, %v != 0", added)
+		}
+	}
+
+	// assert the reports made it into the database, using the source's name
+	// as reporter
+	doc, err := db.FindByHash(ctx, hash2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc == nil || doc.Reporter.Name != hs.Name() {
+		t.Fatal("unexpected document", doc)
+	}
+
+	// assert duplicate sources are rejected
+	_, err = New(db, []ReportSource{ds, ds}, logger)
+	if err == nil || !strings.Contains(err.Error(), "duplicate report source") {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+// newTestLogger returns a logger that discards its output
+func newTestLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logger
+}
+
+// writeFile is a helper that writes the given content to the given file
+func writeFile(t *testing.T, path, content string) {
+	err := ioutil.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,497 @@
+package ingester
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SkynetLabs/blocker/database"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/SkynetLabs/skyd/skymodules"
+	"go.sia.tech/siad/build"
+)
+
+const (
+	// dirDone is the name of the directory, inside the directory of a drop
+	// source, where files that were ingested are moved to.
+	dirDone = "done"
+
+	// dirFailed is the name of the directory, inside the directory of a
+	// directory source, where files that could not be parsed are moved to.
+	dirFailed = "failed"
+
+	// dirProcessed is the name of the directory, inside the directory of a
+	// directory source, where files that were ingested are moved to.
+	dirProcessed = "processed"
+
+	// httpSourceTimeout is the timeout of the requests made by the HTTP
+	// source.
+	httpSourceTimeout = time.Minute
+
+	// readyMarkerExt is the extension of the marker file that signals a file
+	// dropped in the directory of a directory or drop source is completely
+	// written.
+	readyMarkerExt = ".ready"
+)
+
+var (
+	// settleTime is the amount of time a file dropped in the directory of a
+	// directory or drop source has to remain unmodified before it's
+	// considered completely written, if it has no ready marker.
+	settleTime = build.Select(
+		build.Var{
+			Dev:      10 * time.Second,
+			Testing:  time.Second,
+			Standard: time.Minute,
+		},
+	).(time.Duration)
+)
+
+type (
+	// Report is the format in which the built-in report sources expect
+	// reports. Either the hash or the skylink has to be set. V2 skylinks are
+	// not supported, seeing as they need to be resolved by skyd, those have to
+	// be reported through the API.
+	Report struct {
+		Hash       string   `json:"hash"`
+		Skylink    string   `json:"skylink"`
+		Reporter   Reporter `json:"reporter"`
+		Tags       []string `json:"tags"`
+		LegalBasis string   `json:"legalbasis"`
+	}
+
+	// Reporter is the person or system that filed the report.
+	Reporter struct {
+		Name         string `json:"name"`
+		Email        string `json:"email"`
+		OtherContact string `json:"othercontact"`
+	}
+
+	// DirectorySource is a report source that ingests JSON files that get
+	// dropped in a directory. Every file contains an array of reports. A
+	// file is only ingested once it's completely written, which is signalled
+	// by a '<file>.ready' marker or by the file remaining unmodified for the
+	// settle time. After a file has been ingested, it is moved to the
+	// 'processed' directory, files that can't be parsed are moved to the
+	// 'failed' directory.
+	DirectorySource struct {
+		pending []string
+
+		staticDir    string
+		staticLogger *logrus.Logger
+		staticMu     sync.Mutex
+	}
+
+	// DropSource is a report source that ingests plain text files of
+	// skylinks that get dropped in a directory by legacy tooling. Every line
+	// of a file holds a V1 skylink, empty lines and lines starting with '#'
+	// are ignored. The file name is recorded as the reporter of its
+	// skylinks. A file is only ingested once it's completely written, which
+	// is signalled by a '<file>.ready' marker or by the file remaining
+	// unmodified for the settle time. After a file has been ingested, it is
+	// moved to the 'done' directory, files that can't be parsed are moved to
+	// the 'failed' directory.
+	DropSource struct {
+		pending []string
+
+		staticDir    string
+		staticLogger *logrus.Logger
+		staticMu     sync.Mutex
+	}
+
+	// HTTPSource is a report source that polls a REST API for reports. The
+	// source passes its checkpoint as the 'checkpoint' query parameter and
+	// expects the API to return the reports that were added after it, along
+	// with a new checkpoint. The checkpoint is persisted in the database.
+	HTTPSource struct {
+		pending string
+
+		staticClient *http.Client
+		staticDB     *database.DB
+		staticMu     sync.Mutex
+		staticURL    string
+	}
+
+	// httpSourceResponse is the response expected from the REST API polled by
+	// the HTTP source.
+	httpSourceResponse struct {
+		Reports    []Report `json:"reports"`
+		Checkpoint string   `json:"checkpoint"`
+	}
+)
+
+// NewDirectorySource returns a new directory source for the given directory.
+func NewDirectorySource(dir string, logger *logrus.Logger) (*DirectorySource, error) {
+	if logger == nil {
+		return nil, errors.New("no logger provided")
+	}
+	for _, sub := range []string{dirFailed, dirProcessed} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0700)
+		if err != nil {
+			return nil, errors.AddContext(err, fmt.Sprintf("failed to create directory '%v'", sub))
+		}
+	}
+	return &DirectorySource{
+		staticDir:    dir,
+		staticLogger: logger,
+	}, nil
+}
+
+// NewDropSource returns a new drop source for the given directory.
+func NewDropSource(dir string, logger *logrus.Logger) (*DropSource, error) {
+	if logger == nil {
+		return nil, errors.New("no logger provided")
+	}
+	for _, sub := range []string{dirDone, dirFailed} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0700)
+		if err != nil {
+			return nil, errors.AddContext(err, fmt.Sprintf("failed to create directory '%v'", sub))
+		}
+	}
+	return &DropSource{
+		staticDir:    dir,
+		staticLogger: logger,
+	}, nil
+}
+
+// NewHTTPSource returns a new HTTP source that polls the given URL.
+func NewHTTPSource(sourceURL string, db *database.DB) (*HTTPSource, error) {
+	if db == nil {
+		return nil, errors.New("no DB provided")
+	}
+	_, err := url.ParseRequestURI(sourceURL)
+	if err != nil {
+		return nil, errors.AddContext(err, "invalid source URL")
+	}
+	return &HTTPSource{
+		staticClient: &http.Client{Timeout: httpSourceTimeout},
+		staticDB:     db,
+		staticURL:    sourceURL,
+	}, nil
+}
+
+// Name implements the ReportSource interface.
+func (ds *DirectorySource) Name() string {
+	return fmt.Sprintf("dir:%s", ds.staticDir)
+}
+
+// Fetch implements the ReportSource interface. Files that are still being
+// written are skipped until a later call. Files that can't be parsed, or
+// moved, are logged and do not prevent the other files from being fetched.
+func (ds *DirectorySource) Fetch(ctx context.Context) ([]database.BlockedSkylink, error) {
+	ds.staticMu.Lock()
+	defer ds.staticMu.Unlock()
+
+	files, err := settledFiles(ds.staticDir, func(name string) bool {
+		return strings.HasSuffix(name, ".json")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// parse the files
+	var reports []database.BlockedSkylink
+	ds.pending = nil
+	for _, file := range files {
+		parsed, err := parseReportsFile(filepath.Join(ds.staticDir, file))
+		if err != nil {
+			ds.staticLogger.Errorf("failed to parse reports file '%s', moving it to '%s', err: %v", file, dirFailed, err)
+			err = moveFile(ds.staticDir, file, dirFailed)
+			if err != nil {
+				ds.staticLogger.Error(err)
+			}
+			continue
+		}
+		reports = append(reports, parsed...)
+		ds.pending = append(ds.pending, file)
+	}
+	return reports, nil
+}
+
+// Checkpoint implements the ReportSource interface.
+func (ds *DirectorySource) Checkpoint(ctx context.Context) error {
+	ds.staticMu.Lock()
+	defer ds.staticMu.Unlock()
+
+	for len(ds.pending) > 0 {
+		err := moveFile(ds.staticDir, ds.pending[0], dirProcessed)
+		if err != nil {
+			return err
+		}
+		ds.pending = ds.pending[1:]
+	}
+	return nil
+}
+
+// Name implements the ReportSource interface.
+func (ds *DropSource) Name() string {
+	return fmt.Sprintf("drop:%s", ds.staticDir)
+}
+
+// Fetch implements the ReportSource interface. Files that are still being
+// written are skipped until a later call. Files that can't be parsed, or
+// moved, are logged and do not prevent the other files from being fetched.
+func (ds *DropSource) Fetch(ctx context.Context) ([]database.BlockedSkylink, error) {
+	ds.staticMu.Lock()
+	defer ds.staticMu.Unlock()
+
+	files, err := settledFiles(ds.staticDir, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// parse the files
+	var reports []database.BlockedSkylink
+	ds.pending = nil
+	for _, file := range files {
+		parsed, err := parseDropFile(filepath.Join(ds.staticDir, file))
+		if err != nil {
+			ds.staticLogger.Errorf("failed to parse dropped file '%s', moving it to '%s', err: %v", file, dirFailed, err)
+			err = moveFile(ds.staticDir, file, dirFailed)
+			if err != nil {
+				ds.staticLogger.Error(err)
+			}
+			continue
+		}
+		reports = append(reports, parsed...)
+		ds.pending = append(ds.pending, file)
+	}
+	return reports, nil
+}
+
+// Checkpoint implements the ReportSource interface.
+func (ds *DropSource) Checkpoint(ctx context.Context) error {
+	ds.staticMu.Lock()
+	defer ds.staticMu.Unlock()
+
+	var errs []error
+	for _, file := range ds.pending {
+		err := moveFile(ds.staticDir, file, dirDone)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	ds.pending = nil
+	return errors.Compose(errs...)
+}
+
+// Name implements the ReportSource interface.
+func (hs *HTTPSource) Name() string {
+	return fmt.Sprintf("http:%s", hs.staticURL)
+}
+
+// Fetch implements the ReportSource interface.
+func (hs *HTTPSource) Fetch(ctx context.Context) ([]database.BlockedSkylink, error) {
+	hs.staticMu.Lock()
+	defer hs.staticMu.Unlock()
+
+	// fetch the checkpoint
+	checkpoint, err := hs.staticDB.SourceCheckpoint(ctx, hs.Name())
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to fetch checkpoint")
+	}
+
+	// build the request
+	u, err := url.Parse(hs.staticURL)
+	if err != nil {
+		return nil, errors.AddContext(err, "invalid source URL")
+	}
+	if checkpoint != "" {
+		query := u.Query()
+		query.Set("checkpoint", checkpoint)
+		u.RawQuery = query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to create request")
+	}
+
+	// execute the request
+	res, err := hs.staticClient.Do(req)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to execute request")
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("GET request to '%s' failed with status %d", hs.staticURL, res.StatusCode)
+	}
+
+	// parse the response
+	var response httpSourceResponse
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to decode response")
+	}
+	reports, err := toBlockedSkylinks(response.Reports)
+	if err != nil {
+		return nil, err
+	}
+
+	// keep track of the checkpoint, if the API did not return one we keep
+	// the current one
+	hs.pending = response.Checkpoint
+	if hs.pending == "" {
+		hs.pending = checkpoint
+	}
+	return reports, nil
+}
+
+// Checkpoint implements the ReportSource interface.
+func (hs *HTTPSource) Checkpoint(ctx context.Context) error {
+	hs.staticMu.Lock()
+	defer hs.staticMu.Unlock()
+
+	if hs.pending == "" {
+		return nil
+	}
+	return hs.staticDB.SetSourceCheckpoint(ctx, hs.Name(), hs.pending)
+}
+
+// BlockedSkylink converts the report into a blocked skylink.
+func (r Report) BlockedSkylink() (database.BlockedSkylink, error) {
+	var hash database.Hash
+	switch {
+	case r.Hash != "":
+		err := hash.LoadString(r.Hash)
+		if err != nil {
+			return database.BlockedSkylink{}, errors.AddContext(err, "invalid hash")
+		}
+	case r.Skylink != "":
+		var sl skymodules.Skylink
+		err := sl.LoadString(r.Skylink)
+		if err != nil {
+			return database.BlockedSkylink{}, errors.AddContext(err, "invalid skylink")
+		}
+		if !sl.IsSkylinkV1() {
+			return database.BlockedSkylink{}, errors.New("V2 skylinks are not supported")
+		}
+		hash = database.NewHash(sl)
+	default:
+		return database.BlockedSkylink{}, errors.New("hash or skylink is required")
+	}
+
+	return database.BlockedSkylink{
+		Hash: hash,
+		Reporter: database.Reporter{
+			Name:         r.Reporter.Name,
+			Email:        r.Reporter.Email,
+			OtherContact: r.Reporter.OtherContact,
+		},
+		LegalBasis:     r.LegalBasis,
+		Tags:           r.Tags,
+		TimestampAdded: time.Now().UTC(),
+	}, nil
+}
+
+// settledFiles returns the files in the given directory that are completely
+// written, sorted by name to ensure a stable order. A file is completely
+// written if it has a ready marker, or if it remained unmodified for the
+// settle time. Hidden files, ready markers and the files the given filter
+// rejects, if any, are skipped.
+func settledFiles(dir string, filter func(name string) bool) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to read directory")
+	}
+	names := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		names[entry.Name()] = struct{}{}
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, readyMarkerExt) {
+			continue
+		}
+		if filter != nil && !filter(name) {
+			continue
+		}
+		if _, ready := names[name+readyMarkerExt]; !ready {
+			info, err := entry.Info()
+			if err != nil || time.Since(info.ModTime()) < settleTime {
+				continue
+			}
+		}
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// moveFile moves the given file in the given directory, and its ready marker
+// if it has one, to the given sub directory.
+func moveFile(dir, file, sub string) error {
+	err := os.Rename(filepath.Join(dir, file), filepath.Join(dir, sub, file))
+	if err != nil {
+		return errors.AddContext(err, fmt.Sprintf("failed to move file '%s' to '%s'", file, sub))
+	}
+	marker := file + readyMarkerExt
+	err = os.Rename(filepath.Join(dir, marker), filepath.Join(dir, sub, marker))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.AddContext(err, fmt.Sprintf("failed to move file '%s' to '%s'", marker, sub))
+	}
+	return nil
+}
+
+// parseReportsFile parses the reports in the given file.
+func parseReportsFile(path string) ([]database.BlockedSkylink, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var reports []Report
+	err = json.Unmarshal(b, &reports)
+	if err != nil {
+		return nil, err
+	}
+	return toBlockedSkylinks(reports)
+}
+
+// parseDropFile parses the skylinks in the given dropped file, the file name
+// is recorded as the reporter of the skylinks.
+func parseDropFile(path string) ([]database.BlockedSkylink, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var skylinks []database.BlockedSkylink
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		report := Report{
+			Skylink:  line,
+			Reporter: Reporter{Name: filepath.Base(path)},
+		}
+		bsl, err := report.BlockedSkylink()
+		if err != nil {
+			return nil, errors.AddContext(err, fmt.Sprintf("invalid skylink on line %d", i+1))
+		}
+		skylinks = append(skylinks, bsl)
+	}
+	return skylinks, nil
+}
+
+// toBlockedSkylinks converts the given reports into blocked skylinks, it
+// returns an error if any of the reports is invalid.
+func toBlockedSkylinks(reports []Report) ([]database.BlockedSkylink, error) {
+	skylinks := make([]database.BlockedSkylink, len(reports))
+	for i, report := range reports {
+		bsl, err := report.BlockedSkylink()
+		if err != nil {
+			return nil, errors.AddContext(err, fmt.Sprintf("invalid report at index %d", i))
+		}
+		skylinks[i] = bsl
+	}
+	return skylinks, nil
+}
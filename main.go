@@ -2,22 +2,32 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/hex"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/SkynetLabs/blocker/api"
 	"github.com/SkynetLabs/blocker/blocker"
 	"github.com/SkynetLabs/blocker/database"
+	"github.com/SkynetLabs/blocker/events"
+	"github.com/SkynetLabs/blocker/ingester"
+	"github.com/SkynetLabs/blocker/portal"
 	"github.com/SkynetLabs/blocker/syncer"
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
 	"gitlab.com/NebulousLabs/errors"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.sia.tech/siad/crypto"
 )
 
 const (
@@ -28,6 +38,11 @@ const (
 	// defaultSkydPort is where we connect to skyd unless overwritten by
 	// "API_PORT" environment variables.
 	defaultSkydPort = 9980
+
+	// defaultEventsSubject is the NATS subject block events are published to
+	// unless overwritten by the "BLOCKER_EVENTS_NATS_SUBJECT" environment
+	// variable.
+	defaultEventsSubject = "blocker.blocked"
 )
 
 func main() {
@@ -55,29 +70,25 @@ func main() {
 		log.Fatal(errors.AddContext(err, "failed to fetch db credentials"))
 	}
 
+	// Load the database options
+	dbOpts, err := loadDBOptions()
+	if err != nil {
+		log.Fatal(errors.AddContext(err, "failed to load db options"))
+	}
+
+	// Run the self-test instead of the blocker if asked to
+	if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		os.Exit(runSelfTest(uri, dbCreds, dbOpts, logger))
+	}
+
 	// Create a connection to the database
 	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
 	defer cancel()
-	db, err := database.New(ctx, uri, dbCreds, logger)
+	db, err := database.New(ctx, uri, dbCreds, dbOpts, logger)
 	if err != nil {
 		log.Fatal(errors.AddContext(err, "failed to connect to the db"))
 	}
 
-	// Blocker env vars.
-	skydPort := defaultSkydPort
-	skydPortEnv, err := strconv.Atoi(os.Getenv("API_PORT"))
-	if err == nil && skydPortEnv > 0 {
-		skydPort = skydPortEnv
-	}
-	skydHost := defaultSkydHost
-	if skydHostEnv := os.Getenv("API_HOST"); skydHostEnv != "" {
-		skydHost = skydHostEnv
-	}
-	skydAPIPassword := os.Getenv("SIA_API_PASSWORD")
-	if skydAPIPassword == "" {
-		log.Fatal(errors.New("SIA_API_PASSWORD is empty, exiting"))
-	}
-
 	// Accounts.
 	if aHost := os.Getenv("SKYNET_ACCOUNTS_HOST"); aHost != "" {
 		api.AccountsHost = aHost
@@ -86,15 +97,32 @@ func main() {
 		api.AccountsPort = aPort
 	}
 
+	// Admin.
+	api.AdminPassword = os.Getenv("BLOCKER_ADMIN_PASSWORD")
+
 	// Create a skyd client
-	skydUrl := fmt.Sprintf("http://%s:%d", skydHost, skydPort)
-	skydClient := api.NewSkydClient(skydUrl, skydAPIPassword)
+	skydClient, err := loadSkydClient()
+	if err != nil {
+		log.Fatal(err)
+	}
 	if !skydClient.DaemonReady() {
 		log.Fatal(errors.New("skyd down, exiting"))
 	}
 
 	// Create the blocker.
-	bl, err := blocker.New(skydClient, db, logger)
+	blockerOpts, err := loadBlockerOptions()
+	if err != nil {
+		log.Fatal(errors.AddContext(err, "failed to load blocker options"))
+	}
+	blockerOpts.PortalBlocker, err = loadPortalBlocker(logger)
+	if err != nil {
+		log.Fatal(errors.AddContext(err, "failed to load portal blocker"))
+	}
+	blockerOpts.Publisher, err = loadEventPublisher()
+	if err != nil {
+		log.Fatal(errors.AddContext(err, "failed to load event publisher"))
+	}
+	bl, err := blocker.New(skydClient, db, blockerOpts, logger)
 	if err != nil {
 		log.Fatal(errors.AddContext(err, "failed to instantiate blocker"))
 	}
@@ -107,7 +135,11 @@ func main() {
 
 	// Create the syncer.
 	portalURLs := loadPortalURLs()
-	sync, err := syncer.New(db, portalURLs, logger)
+	syncerOpts, err := loadSyncerOptions()
+	if err != nil {
+		log.Fatal(errors.AddContext(err, "failed to load syncer options"))
+	}
+	sync, err := syncer.New(db, portalURLs, syncerOpts, logger)
 	if err != nil {
 		log.Fatal(errors.AddContext(err, "failed to instantiate syncer"))
 	}
@@ -118,8 +150,28 @@ func main() {
 		log.Fatal(errors.AddContext(err, "failed to start syncer"))
 	}
 
+	// Create the ingester.
+	sources, err := loadReportSources(db, logger)
+	if err != nil {
+		log.Fatal(errors.AddContext(err, "failed to load report sources"))
+	}
+	ingest, err := ingester.New(db, sources, logger)
+	if err != nil {
+		log.Fatal(errors.AddContext(err, "failed to instantiate ingester"))
+	}
+
+	// Start the ingester.
+	err = ingest.Start()
+	if err != nil {
+		log.Fatal(errors.AddContext(err, "failed to start ingester"))
+	}
+
 	// Initialise the server.
-	server, err := api.New(skydClient, db, logger)
+	apiOpts, err := loadAPIOptions()
+	if err != nil {
+		log.Fatal(errors.AddContext(err, "failed to load api options"))
+	}
+	server, err := api.New(skydClient, db, bl, logger, apiOpts)
 	if err != nil {
 		log.Fatal(errors.AddContext(err, "failed to build the api"))
 	}
@@ -132,6 +184,15 @@ func main() {
 		}
 	}()
 
+	// Suspend or resume the sweeps on SIGUSR1, e.g. during an incident
+	suspendSignal := make(chan os.Signal, 1)
+	signal.Notify(suspendSignal, syscall.SIGUSR1)
+	go func() {
+		for range suspendSignal {
+			bl.ToggleSuspended()
+		}
+	}()
+
 	// Catch exit signals
 	exitSignal := make(chan os.Signal, 1)
 	signal.Notify(exitSignal, syscall.SIGINT, syscall.SIGTERM)
@@ -141,6 +202,7 @@ func main() {
 	err = errors.Compose(
 		bl.Stop(),
 		sync.Stop(),
+		ingest.Stop(),
 	)
 	if err != nil {
 		log.Fatal("Failed to cleanly stop all components, err: ", err)
@@ -157,6 +219,181 @@ func main() {
 	logger.Info("Blocker Terminated.")
 }
 
+// loadAPIOptions loads the API options from the environment. Setting
+// BLOCKER_REQUIRE_LEGAL_BASIS to 'true' makes the block endpoints reject
+// reports that do not specify the legal basis of the block. Setting
+// BLOCKER_FETCH_METADATA to 'true' enriches reported skylinks with their
+// metadata. The binary blocklist export is signed if BLOCKER_SIGNING_KEY is set
+// to a hex encoded 32 byte seed, from which the ed25519 key is derived. The
+// maximum size of the body of the block endpoints is configured through
+// BLOCKER_MAX_BLOCK_BODY_SIZE in bytes.
+func loadAPIOptions() (api.Options, error) {
+	var opts api.Options
+	if requireStr := os.Getenv("BLOCKER_REQUIRE_LEGAL_BASIS"); requireStr != "" {
+		require, err := strconv.ParseBool(requireStr)
+		if err != nil {
+			return api.Options{}, fmt.Errorf("invalid BLOCKER_REQUIRE_LEGAL_BASIS '%v'", requireStr)
+		}
+		opts.RequireLegalBasis = require
+	}
+	if fetchStr := os.Getenv("BLOCKER_FETCH_METADATA"); fetchStr != "" {
+		fetch, err := strconv.ParseBool(fetchStr)
+		if err != nil {
+			return api.Options{}, fmt.Errorf("invalid BLOCKER_FETCH_METADATA '%v'", fetchStr)
+		}
+		opts.FetchMetadata = fetch
+	}
+	if seedStr := os.Getenv("BLOCKER_SIGNING_KEY"); seedStr != "" {
+		var seed [crypto.EntropySize]byte
+		b, err := hex.DecodeString(seedStr)
+		if err != nil || len(b) != len(seed) {
+			return api.Options{}, fmt.Errorf("invalid BLOCKER_SIGNING_KEY, expected %d hex encoded bytes", len(seed))
+		}
+		copy(seed[:], b)
+		sk, _ := crypto.GenerateKeyPairDeterministic(seed)
+		opts.SigningKey = &sk
+	}
+	if sizeStr := os.Getenv("BLOCKER_MAX_BLOCK_BODY_SIZE"); sizeStr != "" {
+		size, err := strconv.ParseInt(sizeStr, 10, 64)
+		if err != nil || size <= 0 {
+			return api.Options{}, fmt.Errorf("invalid BLOCKER_MAX_BLOCK_BODY_SIZE '%v'", sizeStr)
+		}
+		opts.MaxBlockBodySize = size
+	}
+	return opts, nil
+}
+
+// loadBlockerOptions loads the blocker options from the environment. The
+// interval between sweeps is configured through BLOCKER_SWEEP_INTERVAL, it
+// defaults to the interval of the build. The sweep lease is enabled by setting
+// BLOCKER_SWEEP_LEASE_TTL to a duration, e.g. '5m', which is necessary when
+// running multiple blocker instances against the same database. The maximum
+// amount of time resolving a skylink may take is configured through
+// BLOCKER_RESOLVE_TIMEOUT. The log level of the sweeps can be set separately
+// through BLOCKER_SWEEP_LOG_LEVEL. The backoff after failed sweeps is
+// configured through BLOCKER_ERROR_BACKOFF_STEP, _STEPS and _MAX. The daily
+// maintenance windows are configured through BLOCKER_MAINTENANCE_WINDOWS. The
+// fraction of hashes skyd may reject before a sweep is aborted is configured
+// through BLOCKER_MAX_REJECTION_RATE, the fraction of blocked hashes that are
+// verified to be in skyd's blocklist through BLOCKER_VERIFY_RATE. The amount of
+// time the latest block timestamp may be in the future before it's clamped is
+// configured through BLOCKER_MAX_CLOCK_SKEW. The local block log is enabled by
+// setting BLOCKER_BLOCK_LOG_PATH, the size at which it's rotated is configured
+// through BLOCKER_BLOCK_LOG_MAX_SIZE in bytes. Blocking skylinks as soon as
+// they're inserted is enabled by setting BLOCKER_WATCH_INSERTS. The tag skyd
+// records with every blocked hash is configured through BLOCKER_SKYD_BLOCK_TAG.
+// The number of the most recently added skylinks that are blocked first after
+// startup is configured through BLOCKER_WARM_START.
+func loadBlockerOptions() (blocker.Options, error) {
+	var opts blocker.Options
+	if intervalStr := os.Getenv("BLOCKER_SWEEP_INTERVAL"); intervalStr != "" {
+		interval, err := time.ParseDuration(intervalStr)
+		if err != nil || interval <= 0 {
+			return blocker.Options{}, fmt.Errorf("invalid BLOCKER_SWEEP_INTERVAL '%v'", intervalStr)
+		}
+		opts.SweepInterval = interval
+	}
+	if ttlStr := os.Getenv("BLOCKER_SWEEP_LEASE_TTL"); ttlStr != "" {
+		ttl, err := time.ParseDuration(ttlStr)
+		if err != nil {
+			return blocker.Options{}, errors.AddContext(err, "invalid BLOCKER_SWEEP_LEASE_TTL")
+		}
+		opts.SweepLeaseTTL = ttl
+	}
+	if timeoutStr := os.Getenv("BLOCKER_RESOLVE_TIMEOUT"); timeoutStr != "" {
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil {
+			return blocker.Options{}, errors.AddContext(err, "invalid BLOCKER_RESOLVE_TIMEOUT")
+		}
+		opts.ResolveTimeout = timeout
+	}
+	if levelStr := os.Getenv("BLOCKER_SWEEP_LOG_LEVEL"); levelStr != "" {
+		_, err := logrus.ParseLevel(levelStr)
+		if err != nil {
+			return blocker.Options{}, errors.AddContext(err, "invalid BLOCKER_SWEEP_LOG_LEVEL")
+		}
+		opts.LogLevel = levelStr
+	}
+	if stepStr := os.Getenv("BLOCKER_ERROR_BACKOFF_STEP"); stepStr != "" {
+		step, err := time.ParseDuration(stepStr)
+		if err != nil {
+			return blocker.Options{}, errors.AddContext(err, "invalid BLOCKER_ERROR_BACKOFF_STEP")
+		}
+		opts.ErrorBackoff.Step = step
+	}
+	if stepsStr := os.Getenv("BLOCKER_ERROR_BACKOFF_STEPS"); stepsStr != "" {
+		steps, err := strconv.Atoi(stepsStr)
+		if err != nil {
+			return blocker.Options{}, errors.AddContext(err, "invalid BLOCKER_ERROR_BACKOFF_STEPS")
+		}
+		opts.ErrorBackoff.Steps = steps
+	}
+	if maxStr := os.Getenv("BLOCKER_ERROR_BACKOFF_MAX"); maxStr != "" {
+		max, err := time.ParseDuration(maxStr)
+		if err != nil {
+			return blocker.Options{}, errors.AddContext(err, "invalid BLOCKER_ERROR_BACKOFF_MAX")
+		}
+		opts.ErrorBackoff.Max = max
+	}
+	if scheduleStr := os.Getenv("BLOCKER_MAINTENANCE_WINDOWS"); scheduleStr != "" {
+		schedule, err := blocker.ParseMaintenanceSchedule(scheduleStr)
+		if err != nil {
+			return blocker.Options{}, errors.AddContext(err, "invalid BLOCKER_MAINTENANCE_WINDOWS")
+		}
+		opts.Maintenance = schedule
+	}
+	if rateStr := os.Getenv("BLOCKER_MAX_REJECTION_RATE"); rateStr != "" {
+		rate, err := strconv.ParseFloat(rateStr, 64)
+		if err != nil {
+			return blocker.Options{}, errors.AddContext(err, "invalid BLOCKER_MAX_REJECTION_RATE")
+		}
+		opts.MaxRejectionRate = rate
+	}
+	if rateStr := os.Getenv("BLOCKER_VERIFY_RATE"); rateStr != "" {
+		rate, err := strconv.ParseFloat(rateStr, 64)
+		if err != nil {
+			return blocker.Options{}, errors.AddContext(err, "invalid BLOCKER_VERIFY_RATE")
+		}
+		opts.VerifyRate = rate
+	}
+	if skewStr := os.Getenv("BLOCKER_MAX_CLOCK_SKEW"); skewStr != "" {
+		skew, err := time.ParseDuration(skewStr)
+		if err != nil {
+			return blocker.Options{}, errors.AddContext(err, "invalid BLOCKER_MAX_CLOCK_SKEW")
+		}
+		opts.MaxClockSkew = skew
+	}
+	if watchStr := os.Getenv("BLOCKER_WATCH_INSERTS"); watchStr != "" {
+		watch, err := strconv.ParseBool(watchStr)
+		if err != nil {
+			return blocker.Options{}, errors.AddContext(err, "invalid BLOCKER_WATCH_INSERTS")
+		}
+		opts.WatchInserts = watch
+	}
+	if warmStr := os.Getenv("BLOCKER_WARM_START"); warmStr != "" {
+		warm, err := strconv.Atoi(warmStr)
+		if err != nil || warm < 0 {
+			return blocker.Options{}, fmt.Errorf("invalid BLOCKER_WARM_START '%v'", warmStr)
+		}
+		opts.WarmStart = warm
+	}
+	switch tag := os.Getenv("BLOCKER_SKYD_BLOCK_TAG"); tag {
+	case "", blocker.BlockTagSource, blocker.BlockTagLegalBasis:
+		opts.BlockTag = tag
+	default:
+		return blocker.Options{}, fmt.Errorf("invalid BLOCKER_SKYD_BLOCK_TAG '%v', expected '%v' or '%v'", tag, blocker.BlockTagSource, blocker.BlockTagLegalBasis)
+	}
+	opts.BlockLogPath = os.Getenv("BLOCKER_BLOCK_LOG_PATH")
+	if sizeStr := os.Getenv("BLOCKER_BLOCK_LOG_MAX_SIZE"); sizeStr != "" {
+		size, err := strconv.ParseInt(sizeStr, 10, 64)
+		if err != nil {
+			return blocker.Options{}, errors.AddContext(err, "invalid BLOCKER_BLOCK_LOG_MAX_SIZE")
+		}
+		opts.BlockLogMaxSize = size
+	}
+	return opts, nil
+}
+
 // loadDBCredentials creates a new db connection based on credentials found in
 // the environment variables.
 func loadDBCredentials() (string, options.Credential, error) {
@@ -178,6 +415,378 @@ func loadDBCredentials() (string, options.Credential, error) {
 	return fmt.Sprintf("mongodb://%v:%v", host, port), creds, nil
 }
 
+// loadDBOptions loads the database options from the environment. The read
+// preference used by the sweep is configured through BLOCKER_DB_READ_PREFERENCE
+// and takes a mode, e.g. 'secondaryPreferred'. The write concern used when
+// updating the latest block timestamp is configured through
+// BLOCKER_DB_TIMESTAMP_WRITE_CONCERN and takes either 'majority' or the number
+// of nodes that need to acknowledge the write. The retention period of
+// diagnostic data is configured through BLOCKER_DB_DIAGNOSTICS_RETENTION and
+// takes a duration, e.g. '720h'. Setting BLOCKER_DB_DEGRADED_START to 'true'
+// allows the blocker to start while the database is unreachable. Blockers that
+// share a database are isolated from one another through BLOCKER_DB_TENANT.
+// The number of distinct reporters a skylink needs before it gets blocked is
+// configured through BLOCKER_REPORT_THRESHOLD and, per source,
+// BLOCKER_REPORT_THRESHOLD_SOURCES.
+func loadDBOptions() (database.Options, error) {
+	opts := database.DefaultOptions()
+	if rpStr := os.Getenv("BLOCKER_DB_READ_PREFERENCE"); rpStr != "" {
+		mode, err := readpref.ModeFromString(rpStr)
+		if err != nil {
+			return database.Options{}, errors.AddContext(err, "invalid BLOCKER_DB_READ_PREFERENCE")
+		}
+		rp, err := readpref.New(mode)
+		if err != nil {
+			return database.Options{}, errors.AddContext(err, "invalid BLOCKER_DB_READ_PREFERENCE")
+		}
+		opts.SweepReadPreference = rp
+	}
+	if wcStr := os.Getenv("BLOCKER_DB_TIMESTAMP_WRITE_CONCERN"); wcStr != "" {
+		if wcStr == "majority" {
+			opts.TimestampWriteConcern = writeconcern.New(writeconcern.WMajority(), writeconcern.WTimeout(database.MongoWriteTimeout))
+		} else {
+			w, err := strconv.Atoi(wcStr)
+			if err != nil || w < 0 {
+				return database.Options{}, fmt.Errorf("invalid BLOCKER_DB_TIMESTAMP_WRITE_CONCERN '%v'", wcStr)
+			}
+			opts.TimestampWriteConcern = writeconcern.New(writeconcern.W(w), writeconcern.WTimeout(database.MongoWriteTimeout))
+		}
+	}
+	if degradedStr := os.Getenv("BLOCKER_DB_DEGRADED_START"); degradedStr != "" {
+		degraded, err := strconv.ParseBool(degradedStr)
+		if err != nil {
+			return database.Options{}, fmt.Errorf("invalid BLOCKER_DB_DEGRADED_START '%v'", degradedStr)
+		}
+		opts.AllowDegradedStart = degraded
+	}
+	if delayStr := os.Getenv("BLOCKER_BLOCK_DELAY"); delayStr != "" {
+		delay, err := time.ParseDuration(delayStr)
+		if err != nil || delay < 0 {
+			return database.Options{}, fmt.Errorf("invalid BLOCKER_BLOCK_DELAY '%v'", delayStr)
+		}
+		opts.BlockDelay.Default = delay
+	}
+	for _, tagDelay := range strings.Split(os.Getenv("BLOCKER_BLOCK_DELAY_TAGS"), ",") {
+		tagDelay = strings.TrimSpace(tagDelay)
+		if tagDelay == "" {
+			continue
+		}
+		parts := strings.SplitN(tagDelay, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return database.Options{}, fmt.Errorf("invalid BLOCKER_BLOCK_DELAY_TAGS entry '%v', expected 'tag=duration'", tagDelay)
+		}
+		delay, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil || delay < 0 {
+			return database.Options{}, fmt.Errorf("invalid BLOCKER_BLOCK_DELAY_TAGS entry '%v', expected 'tag=duration'", tagDelay)
+		}
+		if opts.BlockDelay.Tags == nil {
+			opts.BlockDelay.Tags = make(map[string]time.Duration)
+		}
+		opts.BlockDelay.Tags[strings.TrimSpace(parts[0])] = delay
+	}
+	if thresholdStr := os.Getenv("BLOCKER_REPORT_THRESHOLD"); thresholdStr != "" {
+		threshold, err := strconv.Atoi(thresholdStr)
+		if err != nil || threshold < 1 {
+			return database.Options{}, fmt.Errorf("invalid BLOCKER_REPORT_THRESHOLD '%v', expected a positive number", thresholdStr)
+		}
+		opts.ReportThreshold.Default = threshold
+	}
+	for _, sourceThreshold := range strings.Split(os.Getenv("BLOCKER_REPORT_THRESHOLD_SOURCES"), ",") {
+		sourceThreshold = strings.TrimSpace(sourceThreshold)
+		if sourceThreshold == "" {
+			continue
+		}
+		parts := strings.SplitN(sourceThreshold, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return database.Options{}, fmt.Errorf("invalid BLOCKER_REPORT_THRESHOLD_SOURCES entry '%v', expected 'source=threshold'", sourceThreshold)
+		}
+		threshold, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || threshold < 1 {
+			return database.Options{}, fmt.Errorf("invalid BLOCKER_REPORT_THRESHOLD_SOURCES entry '%v', expected 'source=threshold'", sourceThreshold)
+		}
+		if opts.ReportThreshold.Sources == nil {
+			opts.ReportThreshold.Sources = make(map[string]int)
+		}
+		opts.ReportThreshold.Sources[strings.TrimSpace(parts[0])] = threshold
+	}
+	if retentionStr := os.Getenv("BLOCKER_DB_DIAGNOSTICS_RETENTION"); retentionStr != "" {
+		retention, err := time.ParseDuration(retentionStr)
+		if err != nil || retention <= 0 {
+			return database.Options{}, fmt.Errorf("invalid BLOCKER_DB_DIAGNOSTICS_RETENTION '%v'", retentionStr)
+		}
+		opts.DiagnosticsRetention = retention
+	}
+	if tenant := os.Getenv("BLOCKER_DB_TENANT"); tenant != "" {
+		err := database.ValidateTenant(tenant)
+		if err != nil {
+			return database.Options{}, errors.AddContext(err, "invalid BLOCKER_DB_TENANT")
+		}
+		opts.Tenant = tenant
+	}
+	return opts, nil
+}
+
+// loadReportSources returns the report sources configured in the environment.
+// A directory source is configured through BLOCKER_INGEST_DIR, a drop source
+// for plain text files of skylinks through BLOCKER_INGEST_DROP_DIR and HTTP
+// sources are configured through BLOCKER_INGEST_URLS, which is a comma
+// separated list of URLs.
+func loadReportSources(db *database.DB, logger *logrus.Logger) ([]ingester.ReportSource, error) {
+	var sources []ingester.ReportSource
+	if dir := os.Getenv("BLOCKER_INGEST_DIR"); dir != "" {
+		ds, err := ingester.NewDirectorySource(dir, logger)
+		if err != nil {
+			return nil, errors.AddContext(err, "invalid BLOCKER_INGEST_DIR")
+		}
+		sources = append(sources, ds)
+	}
+	if dir := os.Getenv("BLOCKER_INGEST_DROP_DIR"); dir != "" {
+		ds, err := ingester.NewDropSource(dir, logger)
+		if err != nil {
+			return nil, errors.AddContext(err, "invalid BLOCKER_INGEST_DROP_DIR")
+		}
+		sources = append(sources, ds)
+	}
+	for _, sourceURL := range strings.Split(os.Getenv("BLOCKER_INGEST_URLS"), ",") {
+		sourceURL = strings.TrimSpace(sourceURL)
+		if sourceURL == "" {
+			continue
+		}
+		hs, err := ingester.NewHTTPSource(sourceURL, db)
+		if err != nil {
+			return nil, errors.AddContext(err, "invalid BLOCKER_INGEST_URLS")
+		}
+		sources = append(sources, hs)
+	}
+	return sources, nil
+}
+
+// loadSkydClient returns a skyd client configured through API_HOST, API_PORT
+// and SIA_API_PASSWORD. If TLS is configured we talk HTTPS to skyd. The circuit
+// breaker around skyd is configured through BLOCKER_SKYD_CIRCUIT_THRESHOLD, the
+// number of consecutive failures after which it opens, and
+// BLOCKER_SKYD_CIRCUIT_COOLDOWN, the duration it stays open. The paths of
+// skyd's endpoints can be overridden as well, see loadSkydPaths, and so can the
+// user agent, through BLOCKER_SKYD_USER_AGENT. The pool of connections to skyd
+// is configured by loadConnectionPool.
+func loadSkydClient() (*api.SkydClient, error) {
+	skydPort := defaultSkydPort
+	skydPortEnv, err := strconv.Atoi(os.Getenv("API_PORT"))
+	if err == nil && skydPortEnv > 0 {
+		skydPort = skydPortEnv
+	}
+	skydHost := defaultSkydHost
+	if skydHostEnv := os.Getenv("API_HOST"); skydHostEnv != "" {
+		skydHost = skydHostEnv
+	}
+	skydAPIPassword := os.Getenv("SIA_API_PASSWORD")
+	if skydAPIPassword == "" {
+		return nil, errors.New("SIA_API_PASSWORD is empty, exiting")
+	}
+
+	skydTLSConfig, err := loadSkydTLSConfig()
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to load skyd TLS config")
+	}
+	skydScheme := "http"
+	if skydTLSConfig != nil {
+		skydScheme = "https"
+	}
+	skydUrl := fmt.Sprintf("%s://%s:%d", skydScheme, skydHost, skydPort)
+	client := api.NewSkydClientWithTLS(skydUrl, skydAPIPassword, skydTLSConfig)
+	err = loadConnectionPool(client)
+	if err != nil {
+		return nil, errors.AddContext(err, "invalid skyd connection pool")
+	}
+	err = loadResolveCache(client)
+	if err != nil {
+		return nil, errors.AddContext(err, "invalid resolve cache")
+	}
+	err = loadSkydPaths(client)
+	if err != nil {
+		return nil, errors.AddContext(err, "invalid skyd paths")
+	}
+	err = client.ConfigureUserAgent(os.Getenv("BLOCKER_SKYD_USER_AGENT"))
+	if err != nil {
+		return nil, errors.AddContext(err, "invalid BLOCKER_SKYD_USER_AGENT")
+	}
+
+	// configure the circuit breaker, the defaults apply if neither is set
+	thresholdStr := os.Getenv("BLOCKER_SKYD_CIRCUIT_THRESHOLD")
+	cooldownStr := os.Getenv("BLOCKER_SKYD_CIRCUIT_COOLDOWN")
+	if thresholdStr == "" && cooldownStr == "" {
+		return client, nil
+	}
+	threshold := api.DefaultCircuitThreshold
+	if thresholdStr != "" {
+		threshold, err = strconv.Atoi(thresholdStr)
+		if err != nil || threshold < 0 {
+			return nil, fmt.Errorf("invalid BLOCKER_SKYD_CIRCUIT_THRESHOLD '%v'", thresholdStr)
+		}
+	}
+	cooldown := api.DefaultCircuitCooldown
+	if cooldownStr != "" {
+		cooldown, err = time.ParseDuration(cooldownStr)
+		if err != nil || cooldown <= 0 {
+			return nil, fmt.Errorf("invalid BLOCKER_SKYD_CIRCUIT_COOLDOWN '%v'", cooldownStr)
+		}
+	}
+	err = client.ConfigureCircuitBreaker(threshold, cooldown)
+	if err != nil {
+		return nil, errors.AddContext(err, "invalid skyd circuit breaker")
+	}
+	return client, nil
+}
+
+// loadConnectionPool configures the pool of connections of the given skyd
+// client from the environment. The number of idle connections that are kept is
+// configured through BLOCKER_SKYD_MAX_IDLE_CONNS, the limit on the number of
+// connections through BLOCKER_SKYD_MAX_CONNS, where zero means there's no
+// limit, and the amount of time idle connections are kept through
+// BLOCKER_SKYD_IDLE_CONN_TIMEOUT. The defaults apply if none are set.
+func loadConnectionPool(client *api.SkydClient) error {
+	maxIdleStr := os.Getenv("BLOCKER_SKYD_MAX_IDLE_CONNS")
+	maxConnsStr := os.Getenv("BLOCKER_SKYD_MAX_CONNS")
+	timeoutStr := os.Getenv("BLOCKER_SKYD_IDLE_CONN_TIMEOUT")
+	if maxIdleStr == "" && maxConnsStr == "" && timeoutStr == "" {
+		return nil
+	}
+	maxIdle := api.DefaultSkydMaxIdleConnsPerHost
+	if maxIdleStr != "" {
+		var err error
+		maxIdle, err = strconv.Atoi(maxIdleStr)
+		if err != nil || maxIdle < 1 {
+			return fmt.Errorf("invalid BLOCKER_SKYD_MAX_IDLE_CONNS '%v'", maxIdleStr)
+		}
+	}
+	maxConns := api.DefaultSkydMaxConnsPerHost
+	if maxConnsStr != "" {
+		var err error
+		maxConns, err = strconv.Atoi(maxConnsStr)
+		if err != nil || maxConns < 0 {
+			return fmt.Errorf("invalid BLOCKER_SKYD_MAX_CONNS '%v'", maxConnsStr)
+		}
+		// keep the default number of idle connections within the limit
+		if maxIdleStr == "" && maxConns > 0 && maxIdle > maxConns {
+			maxIdle = maxConns
+		}
+	}
+	timeout := api.DefaultSkydIdleConnTimeout
+	if timeoutStr != "" {
+		var err error
+		timeout, err = time.ParseDuration(timeoutStr)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid BLOCKER_SKYD_IDLE_CONN_TIMEOUT '%v'", timeoutStr)
+		}
+	}
+	return client.ConfigureConnectionPool(maxIdle, maxConns, timeout)
+}
+
+// loadResolveCache configures the cache of resolved skylinks of the given
+// skyd client from the environment. The size is configured through
+// BLOCKER_RESOLVE_CACHE_SIZE, where zero disables the cache, the TTL through
+// BLOCKER_RESOLVE_CACHE_TTL. The defaults apply if neither is set.
+func loadResolveCache(client *api.SkydClient) error {
+	sizeStr := os.Getenv("BLOCKER_RESOLVE_CACHE_SIZE")
+	ttlStr := os.Getenv("BLOCKER_RESOLVE_CACHE_TTL")
+	if sizeStr == "" && ttlStr == "" {
+		return nil
+	}
+	size := api.DefaultResolveCacheSize
+	if sizeStr != "" {
+		var err error
+		size, err = strconv.Atoi(sizeStr)
+		if err != nil || size < 0 {
+			return fmt.Errorf("invalid BLOCKER_RESOLVE_CACHE_SIZE '%v'", sizeStr)
+		}
+	}
+	ttl := api.DefaultResolveCacheTTL
+	if ttlStr != "" {
+		var err error
+		ttl, err = time.ParseDuration(ttlStr)
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("invalid BLOCKER_RESOLVE_CACHE_TTL '%v'", ttlStr)
+		}
+	}
+	return client.ConfigureResolveCache(size, ttl)
+}
+
+// loadSkydPaths configures the paths of the skyd endpoints the given client
+// calls from the environment, through BLOCKER_SKYD_BLOCKLIST_PATH,
+// BLOCKER_SKYD_READY_PATH and BLOCKER_SKYD_RESOLVE_PATH. If none of these are
+// set the client selects the paths based on the version of skyd, otherwise the
+// paths that are not set default to the paths of current skyd versions.
+func loadSkydPaths(client *api.SkydClient) error {
+	paths := api.SkydPaths{
+		Blocklist: os.Getenv("BLOCKER_SKYD_BLOCKLIST_PATH"),
+		Ready:     os.Getenv("BLOCKER_SKYD_READY_PATH"),
+		Resolve:   os.Getenv("BLOCKER_SKYD_RESOLVE_PATH"),
+	}
+	if paths == (api.SkydPaths{}) {
+		return nil
+	}
+	return client.ConfigurePaths(paths)
+}
+
+// loadSkydTLSConfig loads the TLS config used to connect to skyd from the
+// environment. TLS is enabled by setting API_TLS_CA to the path of the CA
+// bundle that signed skyd's certificate, or API_TLS_CERT and API_TLS_KEY to
+// the paths of the client certificate presented to skyd. If none of these are
+// set, nil is returned and we talk plain HTTP to skyd.
+func loadSkydTLSConfig() (*tls.Config, error) {
+	caFile := os.Getenv("API_TLS_CA")
+	certFile := os.Getenv("API_TLS_CERT")
+	keyFile := os.Getenv("API_TLS_KEY")
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	return api.LoadTLSConfig(caFile, certFile, keyFile)
+}
+
+// loadEventPublisher returns the publisher of the block events configured in
+// the environment. Events are published to NATS if BLOCKER_EVENTS_NATS_URL is
+// set, the subject is configured through BLOCKER_EVENTS_NATS_SUBJECT. If no
+// broker is configured, nil is returned.
+func loadEventPublisher() (events.Publisher, error) {
+	natsURL := os.Getenv("BLOCKER_EVENTS_NATS_URL")
+	if natsURL == "" {
+		return nil, nil
+	}
+	subject := os.Getenv("BLOCKER_EVENTS_NATS_SUBJECT")
+	if subject == "" {
+		subject = defaultEventsSubject
+	}
+	publisher, err := events.NewNATSPublisher(natsURL, subject)
+	if err != nil {
+		return nil, errors.AddContext(err, "invalid BLOCKER_EVENTS_NATS_URL or BLOCKER_EVENTS_NATS_SUBJECT")
+	}
+	return publisher, nil
+}
+
+// loadPortalBlocker returns a portal blocker for the portals configured in the
+// environment under the key BLOCKER_PORTALS_BLOCK, which is a comma separated
+// list of portal URLs. The portal's API password can be passed as the
+// password of the URL's user info, e.g. 'https://:password@siasky.net'. Hashes
+// blocked by the local skyd are blocked on these portals as well. It returns
+// nil if no portals are configured.
+func loadPortalBlocker(logger *logrus.Logger) (*portal.PortalBlocker, error) {
+	var portals []portal.Portal
+	for _, portalURL := range strings.Split(os.Getenv("BLOCKER_PORTALS_BLOCK"), ",") {
+		if strings.TrimSpace(portalURL) == "" {
+			continue
+		}
+		p, err := portal.ParsePortal(portalURL)
+		if err != nil {
+			return nil, errors.AddContext(err, "invalid BLOCKER_PORTALS_BLOCK")
+		}
+		portals = append(portals, p)
+	}
+	if len(portals) == 0 {
+		return nil, nil
+	}
+	return portal.New(portals, logger)
+}
+
 // loadPortalURLs returns a slice of portal urls, configured in the environment
 // under the key BLOCKER_SYNC_PORTALS. The blocker will keep in sync the
 // blocklist from these portals with the local skyd instance.
@@ -192,6 +801,48 @@ func loadPortalURLs() (portalURLs []string) {
 	return
 }
 
+// loadSyncerOptions loads the syncer options from the environment. Setting
+// BLOCKER_PORTALS_SYNC_BINARY to 'true' makes the syncer fetch the blocklists
+// in the compact binary format. BLOCKER_PORTALS_SYNC_KEYS holds a comma
+// separated list of 'portal=key' pairs, where the key is the hex encoded
+// public key the portal's blocklist has to be signed with.
+// BLOCKER_COMMUNITY_BLOCKLIST_URL is the URL of the community blocklist that
+// gets imported on every sync.
+func loadSyncerOptions() (syncer.Options, error) {
+	var opts syncer.Options
+	if binaryStr := os.Getenv("BLOCKER_PORTALS_SYNC_BINARY"); binaryStr != "" {
+		binary, err := strconv.ParseBool(binaryStr)
+		if err != nil {
+			return syncer.Options{}, fmt.Errorf("invalid BLOCKER_PORTALS_SYNC_BINARY '%v'", binaryStr)
+		}
+		opts.Binary = binary
+	}
+	if keysStr := os.Getenv("BLOCKER_PORTALS_SYNC_KEYS"); keysStr != "" {
+		opts.PublicKeys = make(map[string]crypto.PublicKey)
+		for _, entry := range strings.Split(keysStr, ",") {
+			sep := strings.LastIndex(entry, "=")
+			if sep == -1 {
+				return syncer.Options{}, fmt.Errorf("invalid BLOCKER_PORTALS_SYNC_KEYS entry '%v', expected 'portal=key'", entry)
+			}
+			var pk crypto.PublicKey
+			b, err := hex.DecodeString(strings.TrimSpace(entry[sep+1:]))
+			if err != nil || len(b) != len(pk) {
+				return syncer.Options{}, fmt.Errorf("invalid BLOCKER_PORTALS_SYNC_KEYS key for portal '%v'", entry[:sep])
+			}
+			copy(pk[:], b)
+			opts.PublicKeys[sanitizePortalURL(entry[:sep])] = pk
+		}
+	}
+	if communityURL := strings.TrimSpace(os.Getenv("BLOCKER_COMMUNITY_BLOCKLIST_URL")); communityURL != "" {
+		_, err := url.ParseRequestURI(communityURL)
+		if err != nil {
+			return syncer.Options{}, fmt.Errorf("invalid BLOCKER_COMMUNITY_BLOCKLIST_URL '%v'", communityURL)
+		}
+		opts.CommunityBlocklistURL = communityURL
+	}
+	return opts, nil
+}
+
 // sanitizePortalURL is a helper function that sanitizes the given input portal
 // URL, stripping away trailing slashes and ensuring it's prefixed with https.
 func sanitizePortalURL(portalURL string) string {
@@ -0,0 +1,262 @@
+package portal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SkynetLabs/blocker/database"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/NebulousLabs/errors"
+	skyapi "gitlab.com/SkynetLabs/skyd/node/api"
+)
+
+const (
+	// blockEndpoint is the endpoint on the portal we call to block skylinks.
+	blockEndpoint = "/skynet/blocklist"
+
+	// blockTimeout is the timeout of the block call in seconds.
+	blockTimeout = "30"
+
+	// requestTimeout is the timeout of the requests to the portals, it
+	// exceeds the block timeout to give the portal time to respond.
+	requestTimeout = 45 * time.Second
+)
+
+var (
+	// ErrUnknownPortal is returned when blocking on a portal that is not
+	// configured.
+	ErrUnknownPortal = errors.New("unknown portal")
+)
+
+type (
+	// Portal describes a downstream portal the blocker propagates blocks to.
+	Portal struct {
+		// URL is the base URL of the portal.
+		URL string
+
+		// APIPassword is used to authenticate with the portal's block
+		// endpoint, it's optional.
+		APIPassword string
+	}
+
+	// PortalBlocker propagates blocks to a set of downstream portals by
+	// calling each portal's block endpoint.
+	PortalBlocker struct {
+		// successes keeps track of the amount of skylinks that were blocked
+		// successfully per portal URL.
+		successes map[string]uint64
+
+		staticHTTPClient *http.Client
+		staticLogger     *logrus.Logger
+		staticMu         sync.Mutex
+		staticPortals    []Portal
+	}
+)
+
+// New returns a new PortalBlocker that propagates blocks to the given portals.
+func New(portals []Portal, logger *logrus.Logger) (*PortalBlocker, error) {
+	if logger == nil {
+		return nil, errors.New("no logger provided")
+	}
+	if len(portals) == 0 {
+		return nil, errors.New("no portals provided")
+	}
+	for _, p := range portals {
+		if p.URL == "" {
+			return nil, errors.New("portal URL can not be empty")
+		}
+	}
+	return &PortalBlocker{
+		successes: make(map[string]uint64),
+
+		staticHTTPClient: &http.Client{Timeout: requestTimeout},
+		staticLogger:     logger,
+		staticPortals:    portals,
+	}, nil
+}
+
+// ParsePortal parses a portal from the given URL, the API password can be
+// passed as the password of the URL's user info, e.g.
+// 'https://:password@siasky.net'.
+func ParsePortal(portalURL string) (Portal, error) {
+	u, err := url.Parse(strings.TrimSpace(portalURL))
+	if err != nil {
+		return Portal{}, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return Portal{}, fmt.Errorf("portal URL '%v' is missing scheme or host", portalURL)
+	}
+	var p Portal
+	if u.User != nil {
+		p.APIPassword, _ = u.User.Password()
+		u.User = nil
+	}
+	p.URL = strings.TrimSuffix(u.String(), "/")
+	return p, nil
+}
+
+// BlockHashes blocks the given hashes on all portals. Failing to block the
+// hashes on one portal does not abort blocking them on the others, the URLs of
+// the portals that failed are returned and all errors are composed into the
+// returned error.
+func (pb *PortalBlocker) BlockHashes(ctx context.Context, hashes []database.Hash) ([]string, error) {
+	return pb.managedBlock(ctx, pb.staticPortals, hashStrings(hashes), true)
+}
+
+// BlockHashesOn blocks the given hashes on the portal with the given URL, which
+// allows retrying the hashes that failed to get blocked on that portal. If the
+// portal is not configured ErrUnknownPortal is returned.
+func (pb *PortalBlocker) BlockHashesOn(ctx context.Context, portalURL string, hashes []database.Hash) error {
+	for _, p := range pb.staticPortals {
+		if p.URL == portalURL {
+			_, err := pb.managedBlock(ctx, []Portal{p}, hashStrings(hashes), true)
+			return err
+		}
+	}
+	return ErrUnknownPortal
+}
+
+// BlockSkylinks blocks the given skylinks on all portals. Failing to block the
+// skylinks on one portal does not abort blocking them on the others, the URLs
+// of the portals that failed are returned and all errors are composed into
+// the returned error.
+func (pb *PortalBlocker) BlockSkylinks(ctx context.Context, sls []string) ([]string, error) {
+	return pb.managedBlock(ctx, pb.staticPortals, sls, false)
+}
+
+// URLs returns the URLs of the portals blocks are propagated to.
+func (pb *PortalBlocker) URLs() []string {
+	urls := make([]string, len(pb.staticPortals))
+	for i, p := range pb.staticPortals {
+		urls[i] = p.URL
+	}
+	return urls
+}
+
+// SuccessCounts returns the amount of skylinks that were blocked successfully
+// per portal URL.
+func (pb *PortalBlocker) SuccessCounts() map[string]uint64 {
+	pb.staticMu.Lock()
+	defer pb.staticMu.Unlock()
+	counts := make(map[string]uint64, len(pb.successes))
+	for portalURL, count := range pb.successes {
+		counts[portalURL] = count
+	}
+	return counts
+}
+
+// managedBlock fans out the block request to the given portals in parallel. It
+// returns the URLs of the portals that failed.
+func (pb *PortalBlocker) managedBlock(ctx context.Context, portals []Portal, adds []string, isHash bool) ([]string, error) {
+	if len(adds) == 0 {
+		return nil, nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(portals))
+	for i, p := range portals {
+		wg.Add(1)
+		go func(i int, p Portal) {
+			defer wg.Done()
+			blocked, err := pb.staticBlock(ctx, p, adds, isHash)
+			if err != nil {
+				errs[i] = errors.AddContext(err, fmt.Sprintf("failed to block on portal '%v'", p.URL))
+			}
+			if blocked == 0 {
+				return
+			}
+			pb.staticMu.Lock()
+			pb.successes[p.URL] += uint64(blocked)
+			pb.staticMu.Unlock()
+			pb.staticLogger.Debugf("blocked %d skylinks on portal '%v'", blocked, p.URL)
+		}(i, p)
+	}
+	wg.Wait()
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, portals[i].URL)
+		}
+	}
+	return failed, errors.Compose(errs...)
+}
+
+// staticBlock calls the block endpoint of the given portal. It returns the
+// amount of skylinks that were blocked, skylinks that the portal deemed
+// invalid are not counted.
+func (pb *PortalBlocker) staticBlock(ctx context.Context, p Portal, adds []string, isHash bool) (int, error) {
+	// build the post body
+	reqBody, err := json.Marshal(skyapi.SkynetBlocklistPOST{
+		Add:    adds,
+		IsHash: isHash,
+	})
+	if err != nil {
+		return 0, errors.AddContext(err, "failed to build request body")
+	}
+
+	// build the request
+	query := url.Values{}
+	query.Add("timeout", blockTimeout)
+	url := fmt.Sprintf("%s%s?%s", p.URL, blockEndpoint, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return 0, errors.AddContext(err, "failed to create request")
+	}
+	req.Header.Set("User-Agent", "Sia-Agent")
+	if p.APIPassword != "" {
+		encoded := base64.StdEncoding.EncodeToString([]byte(":" + p.APIPassword))
+		req.Header.Set("Authorization", fmt.Sprintf("Basic %s", encoded))
+	}
+
+	// execute the request
+	res, err := pb.staticHTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer drainAndClose(res.Body)
+
+	// return an error if the status code is not in the 200s
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return 0, fmt.Errorf("POST request to '%s' with status %d", url, res.StatusCode)
+	}
+
+	// decode the response to find out which skylinks were invalid
+	var response struct {
+		Invalids []struct {
+			Input string `json:"input"`
+		} `json:"invalids"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		return 0, errors.AddContext(err, "failed to decode response")
+	}
+	return len(adds) - len(response.Invalids), nil
+}
+
+// hashStrings returns the string representation of the given hashes.
+func hashStrings(hashes []database.Hash) []string {
+	strs := make([]string, len(hashes))
+	for i, hash := range hashes {
+		strs[i] = hash.String()
+	}
+	return strs
+}
+
+// drainAndClose reads rc until EOF and then closes it. drainAndClose should
+// always be called on HTTP response bodies, because if the body is not fully
+// read, the underlying connection can't be reused.
+func drainAndClose(rc io.ReadCloser) {
+	io.Copy(ioutil.Discard, rc)
+	rc.Close()
+}
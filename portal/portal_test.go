@@ -0,0 +1,207 @@
+package portal
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SkynetLabs/blocker/database"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/NebulousLabs/errors"
+	skyapi "gitlab.com/SkynetLabs/skyd/node/api"
+)
+
+// TestPortalBlocker runs the portal blocker unit tests.
+func TestPortalBlocker(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		test func(t *testing.T)
+	}{
+		{
+			name: "BlockSkylinks",
+			test: testBlockSkylinks,
+		},
+		{
+			name: "BlockInterrupted",
+			test: testBlockInterrupted,
+		},
+		{
+			name: "ParsePortal",
+			test: testParsePortal,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, test.test)
+	}
+}
+
+// testBlockSkylinks verifies the block request is fanned out to all portals
+// and that a failing portal does not abort the others.
+func testBlockSkylinks(t *testing.T) {
+	// create a portal that blocks everything but reports one invalid input,
+	// and verifies the authorization header
+	var received skyapi.SkynetBlocklistPOST
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, password, ok := r.BasicAuth()
+		if !ok || password != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != blockEndpoint {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		err := json.NewDecoder(r.Body).Decode(&received)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"invalids":[{"input":"invalid","error":"invalid"}]}`))
+	}))
+	defer healthy.Close()
+
+	// create a portal that always fails
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	// create a discard logger
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	// create the portal blocker
+	pb, err := New([]Portal{
+		{URL: failing.URL},
+		{URL: healthy.URL, APIPassword: "password"},
+	}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// block two skylinks, assert we get an error for the failing portal
+	failed, err := pb.BlockSkylinks(context.Background(), []string{"skylink_1", "skylink_2"})
+	if err == nil || !strings.Contains(err.Error(), failing.URL) {
+		t.Fatalf("expected error for portal '%v', instead it was '%v'", failing.URL, err)
+	}
+	if strings.Contains(err.Error(), healthy.URL) {
+		t.Fatalf("unexpected error for portal '%v'", healthy.URL)
+	}
+	if len(failed) != 1 || failed[0] != failing.URL {
+		t.Fatalf("unexpected failed portals %v", failed)
+	}
+
+	// assert the healthy portal received the skylinks
+	if len(received.Add) != 2 || received.IsHash {
+		t.Fatalf("unexpected request %+v", received)
+	}
+
+	// block a hash, assert it's sent as a hash
+	hash := database.HashBytes([]byte("skylink_3"))
+	failed, err = pb.BlockHashes(context.Background(), []database.Hash{hash})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if len(failed) != 1 || failed[0] != failing.URL {
+		t.Fatalf("unexpected failed portals %v", failed)
+	}
+	if len(received.Add) != 1 || received.Add[0] != hash.String() || !received.IsHash {
+		t.Fatalf("unexpected request %+v", received)
+	}
+
+	// block a hash on the healthy portal only, assert it succeeds
+	hash = database.HashBytes([]byte("skylink_4"))
+	err = pb.BlockHashesOn(context.Background(), healthy.URL, []database.Hash{hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received.Add) != 1 || received.Add[0] != hash.String() {
+		t.Fatalf("unexpected request %+v", received)
+	}
+
+	// assert blocking on an unknown portal fails
+	err = pb.BlockHashesOn(context.Background(), "https://unknown.net", []database.Hash{hash})
+	if !errors.Contains(err, ErrUnknownPortal) {
+		t.Fatalf("expected ErrUnknownPortal, instead it was '%v'", err)
+	}
+
+	// assert the success counts, the invalid inputs are not counted
+	counts := pb.SuccessCounts()
+	if len(counts) != 1 || counts[healthy.URL] != 1 {
+		t.Fatalf("unexpected success counts %v", counts)
+	}
+}
+
+// testBlockInterrupted verifies the request to a portal that hangs is aborted
+// when the context is cancelled and the portal is reported as failed.
+func testBlockInterrupted(t *testing.T) {
+	// create a portal that hangs until the test is done
+	done := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer hanging.Close()
+	defer close(done)
+
+	// create a discard logger
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	// create the portal blocker
+	pb, err := New([]Portal{{URL: hanging.URL}}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// block a hash with a context that times out
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	failed, err := pb.BlockHashes(ctx, []database.Hash{database.HashBytes([]byte("skylink"))})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if len(failed) != 1 || failed[0] != hanging.URL {
+		t.Fatalf("unexpected failed portals %v", failed)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("block was not interrupted, it took %v", elapsed)
+	}
+}
+
+// testParsePortal verifies the portal gets parsed correctly.
+func testParsePortal(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Portal
+		valid    bool
+	}{
+		{"https://siasky.net", Portal{URL: "https://siasky.net"}, true},
+		{" https://siasky.net/ ", Portal{URL: "https://siasky.net"}, true},
+		{"https://:pass@siasky.net", Portal{URL: "https://siasky.net", APIPassword: "pass"}, true},
+		{"siasky.net", Portal{}, false},
+		{"", Portal{}, false},
+	}
+	for _, test := range tests {
+		p, err := ParsePortal(test.input)
+		if test.valid && err != nil {
+			t.Fatalf("unexpected error for input '%v', %v", test.input, err)
+		}
+		if !test.valid && err == nil {
+			t.Fatalf("expected error for input '%v'", test.input)
+		}
+		if p != test.expected {
+			t.Fatalf("unexpected portal for input '%v', %+v != %+v", test.input, p, test.expected)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/SkynetLabs/blocker/api"
+	"github.com/SkynetLabs/blocker/blocker"
+	"github.com/SkynetLabs/blocker/database"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// selfTestDBPrefix is the prefix of the name of the scratch database the
+	// self-test runs against, it's suffixed with a random identifier.
+	selfTestDBPrefix = "blocker_selftest_"
+
+	// selfTestTimeout is the maximum amount of time the self-test may take.
+	selfTestTimeout = 5 * time.Minute
+)
+
+// runSelfTest runs the self-test and returns the exit code of the process. The
+// self-test verifies the full pipeline against a scratch database and the
+// configured skyd, using the same code paths as the blocker.
+func runSelfTest(uri string, creds options.Credential, dbOpts database.Options, logger *logrus.Logger) int {
+	skydClient, err := loadSkydClient()
+	if err != nil {
+		logger.Errorf("selftest failed: %v", err)
+		return 1
+	}
+	blockerOpts, err := loadBlockerOptions()
+	if err != nil {
+		logger.Errorf("selftest failed: %v", errors.AddContext(err, "failed to load blocker options"))
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), selfTestTimeout)
+	defer cancel()
+	err = selfTest(ctx, uri, creds, dbOpts, skydClient, blockerOpts, logger)
+	if err != nil {
+		logger.Errorf("selftest failed: %v", err)
+		return 1
+	}
+	logger.Info("selftest passed")
+	return 0
+}
+
+// selfTest creates a scratch database, inserts a random test hash, sweeps
+// until the scratch database is drained and verifies the hash got blocked in skyd. Afterwards the hash
+// is unblocked and the scratch database is dropped. The returned error
+// indicates at which stage the self-test failed.
+func selfTest(ctx context.Context, uri string, creds options.Credential, dbOpts database.Options, skydClient *api.SkydClient, blockerOpts blocker.Options, logger *logrus.Logger) (err error) {
+	// check skyd
+	if !skydClient.DaemonReady() {
+		return errors.New("stage 'skyd': skyd is unreachable or not ready")
+	}
+	capabilities, err := skydClient.Capabilities()
+	if err != nil {
+		return errors.AddContext(err, "stage 'skyd': failed to probe skyd")
+	}
+	if !capabilities.BlockByHash {
+		return fmt.Errorf("stage 'skyd': skyd %v does not support blocking by hash", capabilities.Version)
+	}
+	logger.Infof("selftest: skyd %v is ready", capabilities.Version)
+
+	// create the scratch database, we want to fail fast if it's unreachable
+	dbOpts.AllowDegradedStart = false
+	dbName := selfTestDBPrefix + hex.EncodeToString(fastrand.Bytes(4))
+	db, err := database.NewCustomDB(ctx, uri, dbName, creds, dbOpts, logger)
+	if err != nil {
+		return errors.AddContext(err, "stage 'database': failed to connect to the database")
+	}
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+		defer cancel()
+		dropErr := db.Drop(cleanupCtx)
+		closeErr := db.Close(cleanupCtx)
+		if cleanupErr := errors.Compose(dropErr, closeErr); cleanupErr != nil {
+			err = errors.Compose(err, errors.AddContext(cleanupErr, "stage 'cleanup': failed to drop the scratch database"))
+		}
+	}()
+	logger.Infof("selftest: created scratch database %v", dbName)
+
+	// insert a random hash, it does not correspond to any content
+	hash := database.HashBytes(fastrand.Bytes(32))
+	err = db.CreateBlockedSkylink(ctx, &database.BlockedSkylink{
+		Hash:           hash,
+		Reporter:       database.Reporter{Name: "selftest"},
+		Tags:           []string{"selftest"},
+		TimestampAdded: time.Now().UTC(),
+	})
+	if err != nil {
+		return errors.AddContext(err, "stage 'insert': failed to insert the test hash")
+	}
+
+	// sweep until the scratch database is drained
+	bl, err := blocker.New(skydClient, db, blockerOpts, logger)
+	if err != nil {
+		return errors.AddContext(err, "stage 'sweep': failed to create the blocker")
+	}
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+		defer cancel()
+		unblockErr := bl.UnblockHashes(cleanupCtx, []database.Hash{hash}, "selftest")
+		if unblockErr != nil {
+			err = errors.Compose(err, errors.AddContext(unblockErr, "stage 'cleanup': failed to unblock the test hash"))
+		}
+	}()
+	_, _, err = bl.RunUntilDrained(ctx)
+	if errors.Contains(err, blocker.ErrSweepLeaseNotHeld) {
+		return errors.AddContext(err, "stage 'sweep': failed to acquire the sweep lease")
+	}
+	if err != nil {
+		return errors.AddContext(err, "stage 'sweep': skyd failed to block the test hash")
+	}
+
+	// verify the hash got blocked
+	doc, err := db.FindByHash(ctx, hash)
+	if err != nil {
+		return errors.AddContext(err, "stage 'verify': failed to find the test hash")
+	}
+	if doc == nil {
+		return errors.New("stage 'verify': the test hash is missing from the database")
+	}
+	if doc.Invalid {
+		return errors.New("stage 'verify': skyd rejected the test hash as invalid")
+	}
+	if doc.BlockedAt.IsZero() {
+		return errors.New("stage 'verify': the sweep did not block the test hash")
+	}
+	blocklist, err := skydClient.Blocklist()
+	if err != nil {
+		return errors.AddContext(err, "stage 'verify': failed to fetch skyd's blocklist")
+	}
+	for _, blocked := range blocklist {
+		if blocked == hash {
+			logger.Info("selftest: the test hash got blocked in skyd")
+			return nil
+		}
+	}
+	return errors.New("stage 'verify': the test hash is missing from skyd's blocklist")
+}
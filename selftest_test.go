@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SkynetLabs/blocker/api"
+	"github.com/SkynetLabs/blocker/blocker"
+	"github.com/SkynetLabs/blocker/database"
+	"github.com/SkynetLabs/blocker/skyd/skydtest"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TestSelfTest verifies the self-test reports the stage it failed at.
+func TestSelfTest(t *testing.T) {
+	t.Parallel()
+
+	// create a discard logger
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	// create a mock skyd
+	server := skydtest.NewServer()
+	defer server.Close()
+	skydClient := api.NewSkydClient(server.URL(), "")
+
+	// use a database that is unreachable
+	uri := "mongodb://localhost:1"
+	creds := options.Credential{Username: "admin", Password: "aO4tV5tC1oU3oQ7u"}
+
+	// assert the self-test fails at the skyd stage if skyd is not ready
+	server.SetReady(false)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := selfTest(ctx, uri, creds, database.Options{}, skydClient, blocker.Options{}, logger)
+	if err == nil || !strings.Contains(err.Error(), "stage 'skyd'") {
+		t.Fatal("unexpected outcome", err)
+	}
+
+	// assert the self-test fails at the skyd stage if skyd can't block by hash
+	server.SetReady(true)
+	server.SetVersion("1.5.0")
+	skydClient.ResetCapabilities()
+	err = selfTest(ctx, uri, creds, database.Options{}, skydClient, blocker.Options{}, logger)
+	if err == nil || !strings.Contains(err.Error(), "stage 'skyd'") {
+		t.Fatal("unexpected outcome", err)
+	}
+
+	// assert the self-test fails at the database stage, even if degraded
+	// starts are allowed
+	server.SetVersion(skydtest.DefaultVersion)
+	skydClient.ResetCapabilities()
+	err = selfTest(ctx, uri, creds, database.Options{AllowDegradedStart: true}, skydClient, blocker.Options{}, logger)
+	if err == nil || !strings.Contains(err.Error(), "stage 'database'") {
+		t.Fatal("unexpected outcome", err)
+	}
+}
@@ -0,0 +1,362 @@
+package skydtest
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SkynetLabs/blocker/database"
+	skyapi "gitlab.com/SkynetLabs/skyd/node/api"
+	"gitlab.com/SkynetLabs/skyd/skymodules"
+	"go.sia.tech/siad/crypto"
+)
+
+const (
+	// EndpointBlocklist is skyd's blocklist endpoint, a GET returns the
+	// blocklist and a POST updates it.
+	EndpointBlocklist = "/skynet/blocklist"
+
+	// EndpointReady is skyd's ready endpoint.
+	EndpointReady = "/daemon/ready"
+
+	// EndpointResolve is skyd's resolve endpoint, the skylink that has to be
+	// resolved is appended to it.
+	EndpointResolve = "/skynet/resolve/"
+
+	// EndpointVersion is skyd's version endpoint.
+	EndpointVersion = "/daemon/version"
+
+	// DefaultVersion is the version the server reports by default.
+	DefaultVersion = "1.5.9"
+)
+
+type (
+	// Server is a mock skyd server for integration testing. It implements
+	// skyd's blocklist, resolve, ready and version endpoints on top of an
+	// httptest server. All skylinks resolve to themselves unless a
+	// resolution is configured, all hashes are considered valid unless they
+	// are marked as invalid and skyd is ready until it's marked otherwise.
+	// Every endpoint can be configured to fail or respond with a delay.
+	Server struct {
+		blocked     []database.Hash
+		blockedSet  map[database.Hash]struct{}
+		delays      map[string]time.Duration
+		errors      map[string]mockError
+		invalid     map[database.Hash]struct{}
+		notReady    bool
+		resolutions map[string]string
+		version     string
+
+		staticMu     sync.Mutex
+		staticServer *httptest.Server
+	}
+
+	// mockError is an error that is returned by a certain endpoint.
+	mockError struct {
+		message string
+		status  int
+	}
+
+	// readyResponse is the response of the ready endpoint.
+	readyResponse struct {
+		Ready     bool `json:"ready"`
+		Consensus bool `json:"consensus"`
+		Gateway   bool `json:"gateway"`
+		Renter    bool `json:"renter"`
+	}
+
+	// invalidInput is an input skyd deemed invalid when blocking.
+	invalidInput struct {
+		Input string `json:"input"`
+		Error string `json:"error"`
+	}
+)
+
+// NewServer starts and returns a new mock skyd server. The caller should call
+// Close when finished to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		blockedSet:  make(map[database.Hash]struct{}),
+		delays:      make(map[string]time.Duration),
+		errors:      make(map[string]mockError),
+		invalid:     make(map[database.Hash]struct{}),
+		resolutions: make(map[string]string),
+		version:     DefaultVersion,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(EndpointBlocklist, s.handleBlocklist)
+	mux.HandleFunc(EndpointReady, s.handleReady)
+	mux.HandleFunc(EndpointResolve, s.handleResolve)
+	mux.HandleFunc(EndpointVersion, s.handleVersion)
+	s.staticServer = httptest.NewServer(mux)
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.staticServer.Close()
+}
+
+// URL returns the base URL of the server, e.g. to construct an
+// api.SkydClient.
+func (s *Server) URL() string {
+	return s.staticServer.URL
+}
+
+// Host returns the host the server is listening on, e.g. to construct a
+// skyd.API.
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.staticServer.Listener.Addr().String())
+	return host
+}
+
+// Port returns the port the server is listening on, e.g. to construct a
+// skyd.API.
+func (s *Server) Port() int {
+	_, portStr, _ := net.SplitHostPort(s.staticServer.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	return port
+}
+
+// SetDelay delays all responses of the given endpoint by the given duration.
+func (s *Server) SetDelay(endpoint string, delay time.Duration) {
+	s.staticMu.Lock()
+	defer s.staticMu.Unlock()
+	s.delays[endpoint] = delay
+}
+
+// SetError makes the given endpoint respond with the given status and error
+// message. Passing a status of zero clears the error.
+func (s *Server) SetError(endpoint string, status int, message string) {
+	s.staticMu.Lock()
+	defer s.staticMu.Unlock()
+	if status == 0 {
+		delete(s.errors, endpoint)
+		return
+	}
+	s.errors[endpoint] = mockError{message: message, status: status}
+}
+
+// SetInvalid marks the given hash as invalid, skyd reports it as invalid when
+// asked to block it.
+func (s *Server) SetInvalid(hash database.Hash) {
+	s.staticMu.Lock()
+	defer s.staticMu.Unlock()
+	s.invalid[hash] = struct{}{}
+}
+
+// SetReady sets whether skyd reports it's ready.
+func (s *Server) SetReady(ready bool) {
+	s.staticMu.Lock()
+	defer s.staticMu.Unlock()
+	s.notReady = !ready
+}
+
+// SetResolution makes the given skylink resolve to the given V1 skylink.
+func (s *Server) SetResolution(skylink, v1 skymodules.Skylink) {
+	s.staticMu.Lock()
+	defer s.staticMu.Unlock()
+	s.resolutions[skylink.String()] = v1.String()
+}
+
+// SetVersion sets the version skyd reports, versions before 1.5.1 don't
+// support blocking by hash.
+func (s *Server) SetVersion(version string) {
+	s.staticMu.Lock()
+	defer s.staticMu.Unlock()
+	s.version = version
+}
+
+// Blocked returns the hashes that got blocked, in the order they got blocked.
+func (s *Server) Blocked() []database.Hash {
+	s.staticMu.Lock()
+	defer s.staticMu.Unlock()
+	return append([]database.Hash{}, s.blocked...)
+}
+
+// IsBlocked returns whether the given hash got blocked.
+func (s *Server) IsBlocked(hash database.Hash) bool {
+	s.staticMu.Lock()
+	defer s.staticMu.Unlock()
+	_, blocked := s.blockedSet[hash]
+	return blocked
+}
+
+// AssertBlocked fails the test if any of the given hashes did not get
+// blocked.
+func (s *Server) AssertBlocked(t testing.TB, hashes ...database.Hash) {
+	t.Helper()
+	for _, hash := range hashes {
+		if !s.IsBlocked(hash) {
+			t.Fatalf("expected hash %v to be blocked", hash)
+		}
+	}
+}
+
+// AssertNotBlocked fails the test if any of the given hashes got blocked.
+func (s *Server) AssertNotBlocked(t testing.TB, hashes ...database.Hash) {
+	t.Helper()
+	for _, hash := range hashes {
+		if s.IsBlocked(hash) {
+			t.Fatalf("expected hash %v to not be blocked", hash)
+		}
+	}
+}
+
+// handleBlocklist handles the blocklist endpoint.
+func (s *Server) handleBlocklist(w http.ResponseWriter, r *http.Request) {
+	if s.managedFail(w, EndpointBlocklist) {
+		return
+	}
+
+	// GET requests return the blocklist
+	if r.Method == http.MethodGet {
+		s.staticMu.Lock()
+		blocklist := make([]crypto.Hash, len(s.blocked))
+		for i, hash := range s.blocked {
+			blocklist[i] = hash.Hash
+		}
+		s.staticMu.Unlock()
+		skyapi.WriteJSON(w, skyapi.SkynetBlocklistGET{Blocklist: blocklist})
+		return
+	}
+
+	var req skyapi.SkynetBlocklistPOST
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		skyapi.WriteError(w, skyapi.Error{Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	s.staticMu.Lock()
+	defer s.staticMu.Unlock()
+
+	// block the additions, collecting the invalid inputs
+	var invalids []invalidInput
+	for _, add := range req.Add {
+		hash, err := parseInput(add, req.IsHash)
+		if err != nil {
+			invalids = append(invalids, invalidInput{Input: add, Error: err.Error()})
+			continue
+		}
+		if _, invalid := s.invalid[hash]; invalid {
+			invalids = append(invalids, invalidInput{Input: add, Error: "invalid hash"})
+			continue
+		}
+		if _, exists := s.blockedSet[hash]; !exists {
+			s.blockedSet[hash] = struct{}{}
+			s.blocked = append(s.blocked, hash)
+		}
+	}
+
+	// unblock the removals
+	for _, remove := range req.Remove {
+		hash, err := parseInput(remove, req.IsHash)
+		if err != nil {
+			continue
+		}
+		if _, exists := s.blockedSet[hash]; !exists {
+			continue
+		}
+		delete(s.blockedSet, hash)
+		for i, blocked := range s.blocked {
+			if blocked == hash {
+				s.blocked = append(s.blocked[:i], s.blocked[i+1:]...)
+				break
+			}
+		}
+	}
+
+	skyapi.WriteJSON(w, struct {
+		Invalids []invalidInput `json:"invalids"`
+	}{invalids})
+}
+
+// handleReady handles the ready endpoint.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if s.managedFail(w, EndpointReady) {
+		return
+	}
+	s.staticMu.Lock()
+	ready := !s.notReady
+	s.staticMu.Unlock()
+	skyapi.WriteJSON(w, readyResponse{
+		Ready:     ready,
+		Consensus: ready,
+		Gateway:   ready,
+		Renter:    ready,
+	})
+}
+
+// handleResolve handles the resolve endpoint.
+func (s *Server) handleResolve(w http.ResponseWriter, r *http.Request) {
+	if s.managedFail(w, EndpointResolve) {
+		return
+	}
+
+	var sl skymodules.Skylink
+	err := sl.LoadString(strings.TrimPrefix(r.URL.Path, EndpointResolve))
+	if err != nil {
+		skyapi.WriteError(w, skyapi.Error{Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	s.staticMu.Lock()
+	resolved, exists := s.resolutions[sl.String()]
+	s.staticMu.Unlock()
+	if !exists {
+		resolved = sl.String()
+	}
+	skyapi.WriteJSON(w, struct {
+		Skylink string `json:"skylink"`
+	}{resolved})
+}
+
+// handleVersion handles the version endpoint.
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if s.managedFail(w, EndpointVersion) {
+		return
+	}
+	s.staticMu.Lock()
+	version := s.version
+	s.staticMu.Unlock()
+	skyapi.WriteJSON(w, skyapi.DaemonVersion{Version: version})
+}
+
+// managedFail applies the delay configured for the given endpoint and writes
+// the configured error, if any. It returns true if an error was written.
+func (s *Server) managedFail(w http.ResponseWriter, endpoint string) bool {
+	s.staticMu.Lock()
+	delay := s.delays[endpoint]
+	mockErr, fail := s.errors[endpoint]
+	s.staticMu.Unlock()
+
+	time.Sleep(delay)
+	if fail {
+		skyapi.WriteError(w, skyapi.Error{Message: mockErr.message}, mockErr.status)
+	}
+	return fail
+}
+
+// parseInput parses the given blocklist input, which is either a hash or a
+// skylink.
+func parseInput(input string, isHash bool) (database.Hash, error) {
+	if isHash {
+		var hash database.Hash
+		err := hash.LoadString(input)
+		return hash, err
+	}
+	var sl skymodules.Skylink
+	err := sl.LoadString(input)
+	if err != nil {
+		return database.Hash{}, err
+	}
+	return database.NewHash(sl), nil
+}
@@ -0,0 +1,176 @@
+package skydtest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SkynetLabs/blocker/api"
+	"github.com/SkynetLabs/blocker/database"
+	"gitlab.com/SkynetLabs/skyd/skymodules"
+)
+
+var (
+	// v1SkylinkStr is a random skylink
+	v1SkylinkStr = "BAAWi3ou51qCH24Im0ESS-5_gKg60qGIYtta-ryrl1kBnQ"
+	// v2SkylinkStr is a v2 skylink that resolves to the v1 skylink
+	v2SkylinkStr = "AQBst6HgaJ0PIBMtmQ2qgH_wQlFg4bNnwAhff7DmJP6oyg"
+)
+
+// TestServer runs the mock skyd server unit tests.
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		test func(t *testing.T)
+	}{
+		{
+			name: "Block",
+			test: testBlock,
+		},
+		{
+			name: "Errors",
+			test: testErrors,
+		},
+		{
+			name: "Resolve",
+			test: testResolve,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, test.test)
+	}
+}
+
+// testBlock verifies the server keeps track of the blocked hashes.
+func testBlock(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := api.NewSkydClient(s.URL(), "")
+
+	// mark one hash as invalid
+	hash1 := database.HashBytes([]byte("skylink_1"))
+	hash2 := database.HashBytes([]byte("skylink_2"))
+	s.SetInvalid(hash2)
+
+	// block both hashes
+	blocked, invalid, err := client.BlockHashes([]database.Hash{hash1, hash2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocked) != 1 || blocked[0] != hash1 || len(invalid) != 1 || invalid[0] != hash2 {
+		t.Fatal("unexpected outcome", blocked, invalid)
+	}
+	s.AssertBlocked(t, hash1)
+	s.AssertNotBlocked(t, hash2)
+
+	// assert the blocklist is returned
+	blocklist, err := client.Blocklist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocklist) != 1 || blocklist[0] != hash1 {
+		t.Fatal("unexpected blocklist", blocklist)
+	}
+
+	// unblock the hash
+	err = client.UnblockHashes([]database.Hash{hash1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AssertNotBlocked(t, hash1)
+	if len(s.Blocked()) != 0 {
+		t.Fatal("unexpected blocked hashes", s.Blocked())
+	}
+
+	// assert the ready endpoint
+	if !client.DaemonReady() {
+		t.Fatal("expected skyd to be ready")
+	}
+	s.SetReady(false)
+	if client.DaemonReady() {
+		t.Fatal("expected skyd to not be ready")
+	}
+
+	// assert the version endpoint
+	s.SetVersion("1.5.0")
+	capabilities, err := client.Capabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capabilities.Version != "1.5.0" || capabilities.BlockByHash {
+		t.Fatal("unexpected capabilities", capabilities)
+	}
+}
+
+// testErrors verifies the endpoints can be configured to fail or to respond
+// with a delay.
+func testErrors(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := api.NewSkydClient(s.URL(), "")
+
+	// assert the configured error is returned
+	hash := database.HashBytes([]byte("skylink"))
+	s.SetError(EndpointBlocklist, http.StatusInternalServerError, "skyd is down")
+	_, _, err := client.BlockHashes([]database.Hash{hash})
+	if err == nil || !strings.Contains(err.Error(), "skyd is down") {
+		t.Fatal("unexpected error", err)
+	}
+	s.AssertNotBlocked(t, hash)
+
+	// clear the error and assert the hash gets blocked
+	s.SetError(EndpointBlocklist, 0, "")
+	_, _, err = client.BlockHashes([]database.Hash{hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AssertBlocked(t, hash)
+
+	// assert the delay is applied
+	var sl skymodules.Skylink
+	err = sl.LoadString(v2SkylinkStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetDelay(EndpointResolve, 200*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.ResolveSkylink(ctx, sl)
+	if err == nil || !strings.Contains(err.Error(), api.ErrResolveTimeout.Error()) {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+// testResolve verifies the configured resolutions are returned.
+func testResolve(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := api.NewSkydClient(s.URL(), "")
+
+	var v1, v2 skymodules.Skylink
+	err1 := v1.LoadString(v1SkylinkStr)
+	err2 := v2.LoadString(v2SkylinkStr)
+	if err1 != nil || err2 != nil {
+		t.Fatal(err1, err2)
+	}
+
+	// assert the V2 skylink resolves to the configured V1 skylink
+	s.SetResolution(v2, v1)
+	resolved, err := client.ResolveSkylink(context.Background(), v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved != v1 {
+		t.Fatal("unexpected skylink", resolved)
+	}
+
+	// assert the host and port point to the server
+	if s.URL() != fmt.Sprintf("http://%s:%d", s.Host(), s.Port()) {
+		t.Fatal("unexpected host or port", s.Host(), s.Port())
+	}
+}
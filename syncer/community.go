@@ -0,0 +1,207 @@
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/SkynetLabs/blocker/database"
+	"gitlab.com/NebulousLabs/errors"
+	"go.sia.tech/siad/crypto"
+)
+
+const (
+	// CommunityTag is the tag of the skylinks that were imported from the
+	// community blocklist, it distinguishes them from the skylinks that were
+	// reported to this portal.
+	CommunityTag = "community"
+
+	// maxCommunityBlocklistSize is the maximum size of the community
+	// blocklist we are willing to download.
+	maxCommunityBlocklistSize = 1 << 28 // 256 MiB
+)
+
+var (
+	// ErrUnsupportedCommunityVersion is returned when the community blocklist
+	// is published in a version of the format we can't parse.
+	ErrUnsupportedCommunityVersion = errors.New("unsupported community blocklist version")
+
+	// communityParsers holds the parser for every version of the community
+	// blocklist format we support, by version.
+	communityParsers = map[int]communityParser{
+		1: parseCommunityEntriesV1,
+	}
+)
+
+type (
+	// communityBlocklist is the envelope of the community blocklist, the
+	// version determines the format of the entries.
+	communityBlocklist struct {
+		Version int             `json:"version"`
+		Entries json.RawMessage `json:"entries"`
+	}
+
+	// communityEntryV1 is an entry of version 1 of the community blocklist
+	// format.
+	communityEntryV1 struct {
+		Hash string   `json:"hash"`
+		Tags []string `json:"tags"`
+	}
+
+	// communityEntry is an entry of the community blocklist, regardless of
+	// the version of the format it was published in.
+	communityEntry struct {
+		Hash database.Hash
+		Tags []string
+	}
+
+	// communityParser parses the entries of a certain version of the
+	// community blocklist format.
+	communityParser func(entries json.RawMessage) ([]communityEntry, error)
+)
+
+// ImportCommunityBlocklist fetches the community blocklist from the given URL
+// and adds its hashes to the database, tagged with CommunityTag. Hashes that
+// are on the allow list are skipped, which allows opting out of specific
+// entries. The import is incremental, the digest of the last imported
+// blocklist is persisted as the checkpoint of the source and the blocklist is
+// only parsed if it changed, hashes that were imported before are merged into
+// their existing records. It returns the number of hashes that were added.
+func (s *Syncer) ImportCommunityBlocklist(ctx context.Context, url string) (int, error) {
+	source := communitySource(url)
+
+	// fetch the blocklist
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, errors.AddContext(err, "failed to create request")
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, errors.AddContext(err, "failed to execute request")
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return 0, fmt.Errorf("GET request to '%s' failed with status %d", url, res.StatusCode)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxCommunityBlocklistSize+1))
+	if err != nil {
+		return 0, errors.AddContext(err, "failed to read response")
+	}
+	if len(body) > maxCommunityBlocklistSize {
+		return 0, fmt.Errorf("community blocklist exceeds the maximum size of %d bytes", maxCommunityBlocklistSize)
+	}
+
+	// escape early if the blocklist did not change since the last import
+	digest := crypto.HashBytes(body).String()
+	checkpoint, err := s.staticDB.SourceCheckpoint(ctx, source)
+	if err != nil {
+		return 0, errors.AddContext(err, "failed to fetch checkpoint")
+	}
+	if checkpoint == digest {
+		return 0, nil
+	}
+
+	// parse the blocklist
+	entries, err := parseCommunityBlocklist(body)
+	if err != nil {
+		return 0, err
+	}
+
+	// skip the hashes that are on the allow list
+	hashes := make([]database.Hash, len(entries))
+	for i, entry := range entries {
+		hashes[i] = entry.Hash
+	}
+	allowListed, err := s.staticDB.AllowListedHashes(ctx, hashes)
+	if err != nil {
+		return 0, errors.AddContext(err, "failed to check the allow list")
+	}
+	now := time.Now().UTC()
+	skylinks := make([]database.BlockedSkylink, 0, len(entries))
+	for _, entry := range entries {
+		if _, skip := allowListed[entry.Hash]; skip {
+			continue
+		}
+		skylinks = append(skylinks, database.BlockedSkylink{
+			Hash:           entry.Hash,
+			Reporter:       database.Reporter{Name: url},
+			Tags:           append([]string{CommunityTag}, entry.Tags...),
+			TimestampAdded: now,
+		})
+	}
+
+	// add the hashes and update the checkpoint
+	added, err := s.staticDB.CreateBlockedSkylinkBulk(ctx, skylinks)
+	if err != nil {
+		return 0, errors.AddContext(err, "failed to add hashes")
+	}
+	err = s.staticDB.SetSourceCheckpoint(ctx, source, digest)
+	if err != nil {
+		return added, errors.AddContext(err, "failed to update checkpoint")
+	}
+	return added, nil
+}
+
+// managedImportCommunityBlocklist imports the community blocklist, if one is
+// configured.
+func (s *Syncer) managedImportCommunityBlocklist() error {
+	url := s.staticOpts.CommunityBlocklistURL
+	if url == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), syncInterval)
+	defer cancel()
+
+	s.staticLogger.Infof("importing community blocklist '%s'", url)
+	added, err := s.ImportCommunityBlocklist(ctx, url)
+	if err != nil {
+		return errors.AddContext(err, fmt.Sprintf("could not import community blocklist %s", url))
+	}
+	s.staticLogger.Infof("added %v hashes from community blocklist '%s'", added, url)
+	return nil
+}
+
+// parseCommunityBlocklist parses the given community blocklist, using the
+// parser that corresponds to the version it was published in.
+func parseCommunityBlocklist(b []byte) ([]communityEntry, error) {
+	var cb communityBlocklist
+	err := json.Unmarshal(b, &cb)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to decode community blocklist")
+	}
+	parser, exists := communityParsers[cb.Version]
+	if !exists {
+		return nil, errors.AddContext(ErrUnsupportedCommunityVersion, fmt.Sprintf("version %d", cb.Version))
+	}
+	return parser(cb.Entries)
+}
+
+// parseCommunityEntriesV1 parses the entries of version 1 of the community
+// blocklist format, which is an array of hex encoded hashes and their tags.
+func parseCommunityEntriesV1(b json.RawMessage) ([]communityEntry, error) {
+	var entriesV1 []communityEntryV1
+	err := json.Unmarshal(b, &entriesV1)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to decode entries")
+	}
+	entries := make([]communityEntry, len(entriesV1))
+	for i, entry := range entriesV1 {
+		err = entries[i].Hash.LoadString(entry.Hash)
+		if err != nil {
+			return nil, errors.AddContext(err, fmt.Sprintf("invalid hash '%v'", entry.Hash))
+		}
+		entries[i].Tags = entry.Tags
+	}
+	return entries, nil
+}
+
+// communitySource returns the name of the report source under which the
+// checkpoint of the community blocklist at the given URL is persisted.
+func communitySource(url string) string {
+	return fmt.Sprintf("community:%s", url)
+}
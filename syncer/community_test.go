@@ -0,0 +1,161 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SkynetLabs/blocker/database"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+// TestParseCommunityBlocklist verifies the community blocklist is parsed using
+// the parser of its version and that unknown versions are rejected.
+func TestParseCommunityBlocklist(t *testing.T) {
+	t.Parallel()
+
+	hash := database.Hash{randomHash()}
+	tests := []struct {
+		name        string
+		blocklist   string
+		entries     []communityEntry
+		expectedErr string
+	}{
+		{
+			name:      "V1",
+			blocklist: fmt.Sprintf(`{"version":1,"entries":[{"hash":"%v","tags":["malware"]}]}`, hash),
+			entries:   []communityEntry{{Hash: hash, Tags: []string{"malware"}}},
+		},
+		{
+			name:      "V1Empty",
+			blocklist: `{"version":1,"entries":[]}`,
+			entries:   []communityEntry{},
+		},
+		{
+			name:        "V1InvalidHash",
+			blocklist:   `{"version":1,"entries":[{"hash":"not a hash"}]}`,
+			expectedErr: "invalid hash",
+		},
+		{
+			name:        "UnknownVersion",
+			blocklist:   `{"version":2,"entries":{}}`,
+			expectedErr: ErrUnsupportedCommunityVersion.Error(),
+		},
+		{
+			name:        "MissingVersion",
+			blocklist:   `{"entries":[]}`,
+			expectedErr: ErrUnsupportedCommunityVersion.Error(),
+		},
+		{
+			name:        "Malformed",
+			blocklist:   `[]`,
+			expectedErr: "failed to decode community blocklist",
+		},
+	}
+	for _, test := range tests {
+		entries, err := parseCommunityBlocklist([]byte(test.blocklist))
+		if test.expectedErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+				t.Fatal("unexpected error", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(test.name, err)
+		}
+		if !reflect.DeepEqual(entries, test.entries) {
+			t.Fatal("unexpected entries", test.name, entries)
+		}
+	}
+}
+
+// testCommunityBlocklist verifies the community blocklist is imported, that
+// its hashes are tagged, that allow listed hashes are skipped and that an
+// unchanged blocklist is not imported again.
+func testCommunityBlocklist(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+
+	// create a server that serves the community blocklist
+	hash1 := database.Hash{randomHash()}
+	hash2 := database.Hash{randomHash()}
+	allowed := database.Hash{randomHash()}
+	var blocklist atomic.Value
+	blocklist.Store(fmt.Sprintf(`{"version":1,"entries":[{"hash":"%v","tags":["malware"]},{"hash":"%v"}]}`, hash1, allowed))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(blocklist.Load().(string)))
+	}))
+	defer server.Close()
+
+	// create a syncer and allow list a hash
+	s, err := newTestSyncer(t.Name(), nil, Options{CommunityBlocklistURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.staticDB.CreateAllowListedSkylink(ctx, &database.AllowListedSkylink{
+		Hash:           allowed,
+		TimestampAdded: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// import the blocklist
+	added, err := s.ImportCommunityBlocklist(ctx, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 1 {
+		t.Fatal("unexpected number of hashes added", added)
+	}
+
+	// assert the hash is tagged and the allow listed hash got skipped
+	bsl, err := s.staticDB.FindByHash(ctx, hash1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bsl == nil || !reflect.DeepEqual(bsl.Tags, []string{CommunityTag, "malware"}) || bsl.Reporter.Name != server.URL {
+		t.Fatal("unexpected blocked skylink", bsl)
+	}
+	bsl, err = s.staticDB.FindByHash(ctx, allowed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bsl != nil {
+		t.Fatal("expected allow listed hash to be skipped")
+	}
+
+	// assert an unchanged blocklist is not imported again
+	added, err = s.ImportCommunityBlocklist(ctx, server.URL)
+	if err != nil || added != 0 {
+		t.Fatal("unexpected outcome", added, err)
+	}
+
+	// assert new entries are imported
+	blocklist.Store(fmt.Sprintf(`{"version":1,"entries":[{"hash":"%v"},{"hash":"%v"}]}`, hash1, hash2))
+	err = s.managedImportCommunityBlocklist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bsl, err = s.staticDB.FindByHash(ctx, hash2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bsl == nil {
+		t.Fatal("expected hash to be imported")
+	}
+
+	// assert an unsupported version is rejected
+	blocklist.Store(`{"version":2}`)
+	_, err = s.ImportCommunityBlocklist(ctx, server.URL)
+	if !errors.Contains(err, ErrUnsupportedCommunityVersion) {
+		t.Fatal("unexpected error", err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"gitlab.com/NebulousLabs/errors"
 	"go.sia.tech/siad/build"
+	"go.sia.tech/siad/crypto"
 )
 
 const (
@@ -34,6 +35,24 @@ var (
 )
 
 type (
+	// Options contains the configuration of the syncer.
+	Options struct {
+		// Binary indicates whether the syncer fetches the blocklists in the
+		// compact binary format, which does not carry tags. If a portal does
+		// not support it, the syncer falls back to the JSON format.
+		Binary bool
+
+		// CommunityBlocklistURL is optional, if set the community
+		// blocklist published at this URL is imported on every sync.
+		CommunityBlocklistURL string
+
+		// PublicKeys holds the keys of the portals, by portal URL, whose
+		// blocklist has to be signed. These portals are always synced using
+		// the binary format, and their blocklist is only ingested if it's
+		// signed by their key.
+		PublicKeys map[string]crypto.PublicKey
+	}
+
 	// Syncer periodically fetches the latest blocklist additions from a
 	// configured set of portals, adding them the local blocklist database.
 	Syncer struct {
@@ -47,6 +66,7 @@ type (
 		staticDB         *database.DB
 		staticLogger     *logrus.Logger
 		staticMu         sync.Mutex
+		staticOpts       Options
 		staticPortalURLs []string
 
 		staticStopChan  chan struct{}
@@ -55,7 +75,7 @@ type (
 )
 
 // New returns a new Syncer with the given parameters.
-func New(db *database.DB, portalURLs []string, logger *logrus.Logger) (*Syncer, error) {
+func New(db *database.DB, portalURLs []string, opts Options, logger *logrus.Logger) (*Syncer, error) {
 	if db == nil {
 		return nil, errors.New("no DB provided")
 	}
@@ -67,6 +87,7 @@ func New(db *database.DB, portalURLs []string, logger *logrus.Logger) (*Syncer,
 
 		staticDB:         db,
 		staticLogger:     logger,
+		staticOpts:       opts,
 		staticPortalURLs: portalURLs,
 		staticStopChan:   make(chan struct{}),
 	}
@@ -82,9 +103,9 @@ func (s *Syncer) Start() error {
 	// convenience variables
 	logger := s.staticLogger
 
-	// escape early if the syncer has no portal urls configured
-	if len(s.staticPortalURLs) == 0 {
-		logger.Infof("syncer is not being started because no portal URLs have been defined")
+	// escape early if the syncer has nothing to sync
+	if len(s.staticPortalURLs) == 0 && s.staticOpts.CommunityBlocklistURL == "" {
+		logger.Infof("syncer is not being started because no portal URLs or community blocklist have been defined")
 		return nil
 	}
 
@@ -142,6 +163,10 @@ func (s *Syncer) threadedSyncLoop() {
 		if err != nil {
 			logger.Errorf("failed to sync portals with skyd, error %v", err)
 		}
+		err = s.managedImportCommunityBlocklist()
+		if err != nil {
+			logger.Errorf("failed to import community blocklist, error %v", err)
+		}
 
 		select {
 		case <-s.staticStopChan:
@@ -155,7 +180,7 @@ func (s *Syncer) threadedSyncLoop() {
 // given portal URL
 func (s *Syncer) managedLastSyncedHash(portalURL string) string {
 	s.staticMu.Lock()
-	s.staticMu.Unlock()
+	defer s.staticMu.Unlock()
 	return s.lastSyncedHash[portalURL]
 }
 
@@ -173,43 +198,31 @@ func (s *Syncer) managedSyncPortals() error {
 		// create a client and fetch the last synced hash
 		client := api.NewSkydClient(portalURL, "")
 		lastSynced := s.managedLastSyncedHash(portalURL)
-		reporter := database.Reporter{Name: portalURL}
 
-		// define loop variables
-		offset := 0
-		hasMore := true
-		seen := false
-
-		// fetch all entries
+		// fetch all entries, if we know the portal's key we only accept its
+		// signed binary blocklist, otherwise if the binary format is
+		// enabled we try that first and fall back to the JSON format if the
+		// portal doesn't support it or the export turns out to be corrupt
 		var hashes []database.BlockedSkylink
-		for hasMore && !seen {
-			// fetch at current offset
-			blg, err := client.BlocklistGET(offset)
+		var err error
+		fetched := false
+		if pk, exists := s.staticOpts.PublicKeys[portalURL]; exists {
+			hashes, err = fetchBlocklistBinary(client, portalURL, lastSynced, &pk)
+			fetched = true
+		} else if s.staticOpts.Binary {
+			hashes, err = fetchBlocklistBinary(client, portalURL, lastSynced, nil)
 			if err != nil {
-				errs = append(errs, errors.AddContext(err, fmt.Sprintf("could not get blocklist for portal %s", portalURL)))
-				break
-			}
-
-			// update loop state
-			hasMore = blg.HasMore
-			offset += len(blg.Entries)
-
-			// check whether we're seeing entries we know already
-			for _, entry := range blg.Entries {
-				hash := database.Hash{entry.Hash}
-				if lastSynced != "" && hash.String() == lastSynced {
-					seen = true
-					break
-				}
-
-				hashes = append(hashes, database.BlockedSkylink{
-					Hash:           hash,
-					Reporter:       reporter,
-					Tags:           entry.Tags,
-					TimestampAdded: time.Now().UTC(),
-				})
+				logger.Warnf("failed to fetch binary blocklist for portal '%s', falling back to JSON, err '%v'", portalURL, err)
+			} else {
+				fetched = true
 			}
 		}
+		if !fetched {
+			hashes, err = fetchBlocklist(client, portalURL, lastSynced)
+		}
+		if err != nil {
+			errs = append(errs, errors.AddContext(err, fmt.Sprintf("could not get blocklist for portal %s", portalURL)))
+		}
 
 		// continue if no hashes were found
 		if len(hashes) == 0 {
@@ -240,6 +253,93 @@ func (s *Syncer) managedSyncPortals() error {
 	return errors.Compose(errs...)
 }
 
+// fetchBlocklist pages through the blocklist of the given portal until it
+// encounters the last synced hash. It returns the hashes it fetched, even if it
+// encountered an error.
+func fetchBlocklist(client *api.SkydClient, portalURL, lastSynced string) ([]database.BlockedSkylink, error) {
+	reporter := database.Reporter{Name: portalURL}
+
+	// define loop variables
+	offset := 0
+	hasMore := true
+	seen := false
+
+	// fetch all entries
+	var hashes []database.BlockedSkylink
+	for hasMore && !seen {
+		// fetch at current offset
+		blg, err := client.BlocklistGET(offset)
+		if err != nil {
+			return hashes, err
+		}
+
+		// update loop state
+		hasMore = blg.HasMore
+		offset += len(blg.Entries)
+
+		// check whether we're seeing entries we know already
+		for _, entry := range blg.Entries {
+			hash := database.Hash{entry.Hash}
+			if lastSynced != "" && hash.String() == lastSynced {
+				seen = true
+				break
+			}
+
+			hashes = append(hashes, database.BlockedSkylink{
+				Hash:           hash,
+				Reporter:       reporter,
+				Tags:           entry.Tags,
+				TimestampAdded: time.Now().UTC(),
+			})
+		}
+	}
+	return hashes, nil
+}
+
+// fetchBlocklistBinary streams the blocklist of the given portal in the binary
+// format and returns the hashes up to the last synced hash. The binary format
+// does not carry tags. The entire blocklist is streamed, seeing as its
+// checksum, and its signature if a key is given, can only be verified after
+// the last hash. No hashes are returned unless the export is complete and
+// valid, the hashes of a truncated or corrupt export are never ingested.
+func fetchBlocklistBinary(client *api.SkydClient, portalURL, lastSynced string, pk *crypto.PublicKey) ([]database.BlockedSkylink, error) {
+	reporter := database.Reporter{Name: portalURL}
+
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), syncInterval)
+	defer cancel()
+
+	// stream all entries, we can't stop at the last synced hash without
+	// skipping the verification so we skip all hashes after it instead
+	var hashes []database.BlockedSkylink
+	seen := false
+	fn := func(hash database.Hash) error {
+		if seen {
+			return nil
+		}
+		if lastSynced != "" && hash.String() == lastSynced {
+			seen = true
+			return nil
+		}
+		hashes = append(hashes, database.BlockedSkylink{
+			Hash:           hash,
+			Reporter:       reporter,
+			TimestampAdded: time.Now().UTC(),
+		})
+		return nil
+	}
+	var err error
+	if pk != nil {
+		err = client.BlocklistBinaryVerified(ctx, *pk, fn)
+	} else {
+		err = client.BlocklistBinary(ctx, fn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
 // managedUpdateLastSyncedHash updates the last synced hash for the given portal
 func (s *Syncer) managedUpdateLastSyncedHash(portalURL string, hash string) {
 	s.staticMu.Lock()
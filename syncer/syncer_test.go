@@ -1,6 +1,7 @@
 package syncer
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"io/ioutil"
@@ -26,9 +27,86 @@ func TestSyncer(t *testing.T) {
 	}
 	t.Parallel()
 
+	t.Run("communityBlocklist", testCommunityBlocklist)
 	t.Run("lastSyncedHash", testLastSyncedHash)
 	t.Run("randomHash", testRandomHash)
 	t.Run("syncer", testSyncer)
+	t.Run("syncerBinary", testSyncerBinary)
+	t.Run("syncerSigned", testSyncerSigned)
+}
+
+// TestFetchBlocklistBinarySigned verifies a signed blocklist is only returned
+// if it's signed by the portal's key, and that it stops collecting hashes at
+// the last synced hash.
+func TestFetchBlocklistBinarySigned(t *testing.T) {
+	t.Parallel()
+
+	// create a signed export holding three hashes, most recent first
+	hash1 := database.Hash{randomHash()}
+	hash2 := database.Hash{randomHash()}
+	hash3 := database.Hash{randomHash()}
+	sk, pk := crypto.GenerateKeyPair()
+	export := newBinaryExport(t, []database.Hash{hash3, hash2, hash1}, &sk)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(export)
+	}))
+	defer server.Close()
+	client := api.NewSkydClient(server.URL, "")
+
+	// assert only the hashes after the last synced hash are returned
+	hashes, err := fetchBlocklistBinary(client, server.URL, hash2.String(), &pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 1 || hashes[0].Hash != hash3 {
+		t.Fatal("unexpected hashes", hashes)
+	}
+
+	// assert nothing is returned if the key doesn't match
+	_, otherPK := crypto.GenerateKeyPair()
+	hashes, err = fetchBlocklistBinary(client, server.URL, "", &otherPK)
+	if !errors.Contains(err, api.ErrBinaryBlocklistSignature) {
+		t.Fatal("unexpected error", err)
+	}
+	if len(hashes) != 0 {
+		t.Fatal("unexpected hashes", hashes)
+	}
+}
+
+// TestFetchBlocklistBinaryCorrupt verifies no hashes are returned if the
+// binary blocklist is truncated or its checksum does not match.
+func TestFetchBlocklistBinaryCorrupt(t *testing.T) {
+	t.Parallel()
+
+	// create an unsigned export holding three hashes
+	hash1 := database.Hash{randomHash()}
+	hash2 := database.Hash{randomHash()}
+	hash3 := database.Hash{randomHash()}
+	export := newBinaryExport(t, []database.Hash{hash3, hash2, hash1}, nil)
+
+	// corrupt it by truncating the trailer or by flipping a bit of the last
+	// hash
+	truncated := export[:len(export)-2]
+	flipped := append([]byte{}, export...)
+	flipped[len(flipped)-5] ^= 1
+
+	for _, corrupt := range [][]byte{truncated, flipped} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(corrupt)
+		}))
+		client := api.NewSkydClient(server.URL, "")
+
+		// assert nothing is returned, even though the last synced hash
+		// comes before the corruption
+		hashes, err := fetchBlocklistBinary(client, server.URL, hash2.String(), nil)
+		server.Close()
+		if !errors.Contains(err, api.ErrBinaryBlocklistCorrupt) {
+			t.Fatal("unexpected error", err)
+		}
+		if len(hashes) != 0 {
+			t.Fatal("unexpected hashes", hashes)
+		}
+	}
 }
 
 // testLastSyncedHash is a unit test that verifies the last synced hash setter
@@ -37,7 +115,7 @@ func testLastSyncedHash(t *testing.T) {
 	t.Parallel()
 
 	// create a test syncer
-	s, err := newTestSyncer(t.Name(), nil)
+	s, err := newTestSyncer(t.Name(), nil, Options{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -93,7 +171,7 @@ func testSyncer(t *testing.T) {
 	defer server.Close()
 
 	// create a test syncer that syncs from our server
-	s, err := newTestSyncer(t.Name(), []string{server.URL})
+	s, err := newTestSyncer(t.Name(), []string{server.URL}, Options{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -109,7 +187,7 @@ func testSyncer(t *testing.T) {
 	}
 
 	// assert the database contains our one entry
-	hashes, _, err := s.staticDB.BlockedHashes(ctx, 1, 0, 1)
+	hashes, _, err := s.staticDB.BlockedHashes(ctx, 1, 0, 1, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -133,7 +211,7 @@ func testSyncer(t *testing.T) {
 
 	// check in a loop whether we're filling up the database
 	err = build.Retry(100, 100*time.Millisecond, func() error {
-		hashes, _, err := s.staticDB.BlockedHashes(ctx, 1, 0, 2)
+		hashes, _, err := s.staticDB.BlockedHashes(ctx, 1, 0, 2, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -180,8 +258,131 @@ func testSyncer(t *testing.T) {
 	}
 }
 
+// testSyncerBinary verifies the syncer fetches the binary blocklist if it's
+// enabled and falls back to the JSON blocklist if a portal doesn't support it.
+func testSyncerBinary(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+
+	// create a binary export holding two hashes
+	hash1 := database.Hash{randomHash()}
+	hash2 := database.Hash{randomHash()}
+	export := newBinaryExport(t, []database.Hash{hash2, hash1}, nil)
+
+	// create a server that serves the binary export and one that only
+	// supports the JSON format
+	binaryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(export)
+	}))
+	defer binaryServer.Close()
+	hash3 := randomHash()
+	jsonServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("format") != "" {
+			skyapi.WriteError(w, skyapi.Error{Message: "invalid format"}, http.StatusBadRequest)
+			return
+		}
+		skyapi.WriteJSON(w, api.BlocklistGET{Entries: []api.BlockedHash{{Hash: hash3, Tags: []string{"tag_3"}}}})
+	}))
+	defer jsonServer.Close()
+
+	// sync both portals
+	s, err := newTestSyncer(t.Name(), []string{binaryServer.URL, jsonServer.URL}, Options{Binary: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.managedSyncPortals()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert all hashes were synced
+	for _, hash := range []database.Hash{hash1, hash2, {hash3}} {
+		bsl, err := s.staticDB.FindByHash(ctx, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bsl == nil {
+			t.Fatal("expected hash to be synced", hash)
+		}
+	}
+
+	// assert the last synced hash is set
+	if s.managedLastSyncedHash(binaryServer.URL) != hash1.String() {
+		t.Fatal("unexpected last synced hash")
+	}
+}
+
+// testSyncerSigned verifies the syncer aborts the sync of a portal whose
+// blocklist is not signed by its key, without ingesting any of its hashes.
+func testSyncerSigned(t *testing.T) {
+	// create context
+	ctx, cancel := context.WithTimeout(context.Background(), database.MongoDefaultTimeout)
+	defer cancel()
+
+	// create a server that serves an export signed by another key
+	hash := database.Hash{randomHash()}
+	sk, _ := crypto.GenerateKeyPair()
+	export := newBinaryExport(t, []database.Hash{hash}, &sk)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(export)
+	}))
+	defer server.Close()
+
+	// sync the portal
+	_, pk := crypto.GenerateKeyPair()
+	opts := Options{PublicKeys: map[string]crypto.PublicKey{server.URL: pk}}
+	s, err := newTestSyncer(t.Name(), []string{server.URL}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.managedSyncPortals()
+	if !errors.Contains(err, api.ErrBinaryBlocklistSignature) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert nothing was ingested
+	bsl, err := s.staticDB.FindByHash(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bsl != nil {
+		t.Fatal("expected hash not to be synced")
+	}
+	if s.managedLastSyncedHash(server.URL) != "" {
+		t.Fatal("unexpected last synced hash")
+	}
+}
+
+// newBinaryExport returns the binary export of the given hashes, it's signed
+// if a key is given.
+func newBinaryExport(t *testing.T, hashes []database.Hash, sk *crypto.SecretKey) []byte {
+	var buf bytes.Buffer
+	var bw *api.BinaryBlocklistWriter
+	var err error
+	if sk != nil {
+		bw, err = api.NewSignedBinaryBlocklistWriter(&buf, uint64(len(hashes)), *sk)
+	} else {
+		bw, err = api.NewBinaryBlocklistWriter(&buf, uint64(len(hashes)))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range hashes {
+		err = bw.WriteHash(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = bw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
 // newTestSyncer returns a test syncer object.
-func newTestSyncer(dbName string, portalURLs []string) (*Syncer, error) {
+func newTestSyncer(dbName string, portalURLs []string, opts Options) (*Syncer, error) {
 	// create a nil logger
 	logger := logrus.New()
 	logger.Out = ioutil.Discard
@@ -194,7 +395,7 @@ func newTestSyncer(dbName string, portalURLs []string) (*Syncer, error) {
 	db := database.NewTestDB(ctx, dbName)
 
 	// create a syncer
-	return New(db, portalURLs, logger)
+	return New(db, portalURLs, opts, logger)
 }
 
 // randomHash returns a random hash